@@ -0,0 +1,73 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/grafana/timestream-datasource/pkg/timestream/validator"
+)
+
+// ANSI styles of the span kinds, issues are underlined in red on top of the others
+var spanStyles = map[validator.SpanKind]string{
+	validator.SpanTable:   "\x1b[36m",
+	validator.SpanTime:    "\x1b[32m",
+	validator.SpanMeasure: "\x1b[33m",
+	validator.SpanAlias:   "\x1b[35m",
+}
+
+const (
+	styleIssue = "\x1b[4;31m"
+	styleReset = "\x1b[0m"
+)
+
+// render returns the SQL with the spans highlighted, followed by a list of the spans.
+// Without color only the list is added.
+func render(sql string, spans []validator.Span, color bool) string {
+	var sb strings.Builder
+	if color {
+		current := ""
+		for i := 0; i < len(sql); i++ {
+			if style := styleAt(spans, i); style != current {
+				sb.WriteString(styleReset + style)
+				current = style
+			}
+			sb.WriteByte(sql[i])
+		}
+		if current != "" {
+			sb.WriteString(styleReset)
+		}
+	} else {
+		sb.WriteString(sql)
+	}
+	sb.WriteString("\n")
+	for _, span := range spans {
+		text := strings.Join(strings.Fields(sql[span.Start:span.End]), " ")
+		if span.Note != "" {
+			text = span.Note + ": " + text
+		}
+		kind := fmt.Sprintf("%-8s", span.Kind)
+		if color {
+			kind = styleOf(span.Kind) + kind + styleReset
+		}
+		fmt.Fprintf(&sb, "  %s %s\n", kind, text)
+	}
+	return strings.TrimRight(sb.String(), "\n")
+}
+
+// styleAt combines the styles of the spans covering the byte at i
+func styleAt(spans []validator.Span, i int) string {
+	style := ""
+	for _, span := range spans {
+		if i >= span.Start && i < span.End {
+			style += styleOf(span.Kind)
+		}
+	}
+	return style
+}
+
+func styleOf(kind validator.SpanKind) string {
+	if kind == validator.SpanIssue {
+		return styleIssue
+	}
+	return spanStyles[kind]
+}
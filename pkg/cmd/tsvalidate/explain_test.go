@@ -0,0 +1,39 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/grafana/timestream-datasource/pkg/timestream/validator"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRender(t *testing.T) {
+	sql := "SELECT * FROM db.tbl WHERE time > ago(1h)"
+	spans, _ := validator.Explain(sql, nil)
+
+	plain := render(sql, spans, false)
+	assert.Equal(t, `SELECT * FROM db.tbl WHERE time > ago(1h)
+  issue    WHERE clause lacks a valid measure_name predicate (requires = '...', IN ('...') or regexp_like): SELECT * FROM db.tbl WHERE time > ago(1h)
+  table    db.tbl
+  time     time > ago(1h)`, plain)
+
+	colored := render(sql, spans, true)
+	assert.True(t, strings.Contains(colored, styleReset+styleIssue+spanStyles[validator.SpanTable]+"db.tbl"+styleReset+styleIssue+" WHERE"))
+	assert.True(t, strings.HasSuffix(strings.SplitN(colored, "\n", 2)[0], "ago(1h)"+styleReset))
+}
+
+func TestPrintIssues(t *testing.T) {
+	var sb strings.Builder
+	printIssues(&sb, "a.sql", nil)
+	printIssues(&sb, "b.sql", []validator.Issue{{Start: 7, Reason: "missing WHERE clause"}})
+	printIssues(&sb, "c.sql", []validator.Issue{{Start: 0, Reason: "GROUP BY bins time but WHERE doesn't restrict it", Fix: "add AND $__timeFilter"}})
+	assert.Equal(t, "a.sql: ok\nb.sql:7: missing WHERE clause\nc.sql:0: GROUP BY bins time but WHERE doesn't restrict it\nc.sql:0: fix: add AND $__timeFilter\n", sb.String())
+}
+
+func TestPrintReport(t *testing.T) {
+	var sb strings.Builder
+	report := validator.ValidateReport(`SELECT * FROM db.tbl WHERE time > ago(1h) AND measure_name = 'cpu'`, nil)
+	assert.NoError(t, printReport(&sb, "a.sql", report))
+	assert.Equal(t, `{"name":"a.sql","valid":true,"verdict":"accepted","errors":0,"warnings":0,"issues":[]}`+"\n", sb.String())
+}
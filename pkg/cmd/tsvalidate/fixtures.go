@@ -0,0 +1,33 @@
+package main
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/grafana/timestream-datasource/pkg/timestream/validator/validatortest"
+)
+
+// runFixtures checks the cases of the fixture files and returns the number of failed cases
+func runFixtures(w io.Writer, pattern string) (int, error) {
+	fixtures, err := validatortest.LoadFixtures(pattern)
+	if err != nil {
+		return 0, err
+	}
+	failed, total := 0, 0
+	for _, f := range fixtures {
+		for _, c := range f.Cases {
+			total++
+			failures := f.Check(c)
+			if len(failures) == 0 {
+				continue
+			}
+			failed++
+			fmt.Fprintf(w, "FAIL %s: %s\n", f.Path, c.Name)
+			for _, failure := range failures {
+				fmt.Fprintf(w, "    %s\n", failure)
+			}
+		}
+	}
+	fmt.Fprintf(w, "%d of %d cases passed\n", total-failed, total)
+	return failed, nil
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunFixtures(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rules.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(`
+cases:
+  - name: ok
+    sql: SELECT * FROM db.tbl WHERE time > ago(1h) AND measure_name = 'cpu'
+    valid: true
+  - name: wrong expectation
+    sql: SELECT * FROM db.tbl
+    valid: true
+`), 0o600))
+
+	var sb strings.Builder
+	failed, err := runFixtures(&sb, path)
+	require.NoError(t, err)
+	assert.Equal(t, 1, failed)
+	assert.Equal(t, "FAIL "+path+": wrong expectation\n    valid = false, want true (issues: missing WHERE clause)\n1 of 2 cases passed\n", sb.String())
+}
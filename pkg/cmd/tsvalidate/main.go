@@ -0,0 +1,161 @@
+// Command tsvalidate checks Timestream queries with the reasonable query
+// validator of the datasource, e.g. in CI or while writing rule configs.
+//
+//	tsvalidate [-config options.json] [-explain] [-no-color] [-json] [file.sql ...]
+//	tsvalidate -fixtures 'rules/*.yaml'
+//	tsvalidate -anonymize [file.sql ...]
+//
+// Queries are read from the files or from stdin. The exit code is 1 when a
+// query is rejected. With -fixtures the YAML rule fixtures described in
+// package validatortest are run instead, failing when a case doesn't match.
+// With -anonymize the queries are printed with their literals replaced by
+// placeholders and their fingerprint, e.g. to share them with support. With
+// -json a validation report is printed per query as a line of JSON.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/grafana/timestream-datasource/pkg/timestream/validator"
+)
+
+func main() {
+	configPath := flag.String("config", "", "JSON file with the validator options of the datasource")
+	explain := flag.Bool("explain", false, "print the query with the recognized tables, predicates and issues highlighted")
+	noColor := flag.Bool("no-color", false, "disable colors in explain mode")
+	fixtures := flag.String("fixtures", "", "glob of YAML rule fixtures to run")
+	anonymize := flag.Bool("anonymize", false, "print the queries with their literals replaced by placeholders")
+	jsonOutput := flag.Bool("json", false, "print a JSON validation report per query")
+	flag.Parse()
+
+	if *fixtures != "" {
+		failed, err := runFixtures(os.Stdout, *fixtures)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
+		if failed > 0 {
+			os.Exit(1)
+		}
+		return
+	}
+
+	rules, err := loadRules(*configPath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	inputs, err := readInputs(flag.Args())
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
+	if *anonymize {
+		for _, in := range inputs {
+			fmt.Printf("== %s (fingerprint %s)\n%s\n", in.name, validator.Fingerprint(in.sql), validator.Anonymize(in.sql))
+		}
+		return
+	}
+
+	if *jsonOutput {
+		failed := false
+		for _, in := range inputs {
+			report := rules.ValidateReport(in.sql)
+			if err := printReport(os.Stdout, in.name, report); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(2)
+			}
+			failed = failed || len(report.Issues) > 0
+		}
+		if failed {
+			os.Exit(1)
+		}
+		return
+	}
+
+	color := !*noColor && os.Getenv("NO_COLOR") == ""
+	failed := false
+	for _, in := range inputs {
+		var issues []validator.Issue
+		if *explain {
+			var spans []validator.Span
+			spans, issues = rules.Explain(in.sql)
+			fmt.Printf("== %s\n%s\n", in.name, render(in.sql, spans, color))
+		} else {
+			_, issues = rules.Validate(in.sql)
+		}
+		printIssues(os.Stdout, in.name, issues)
+		failed = failed || len(issues) > 0
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
+func loadRules(path string) (*validator.Compiled, error) {
+	opts := &validator.Options{}
+	if path != "" {
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(b, opts); err != nil {
+			return nil, fmt.Errorf("error reading %s: %w", path, err)
+		}
+	}
+	return opts.Compile()
+}
+
+type input struct {
+	name string
+	sql  string
+}
+
+func readInputs(paths []string) ([]input, error) {
+	if len(paths) == 0 {
+		b, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			return nil, err
+		}
+		return []input{{name: "stdin", sql: strings.TrimRight(string(b), "\n")}}, nil
+	}
+	inputs := make([]input, 0, len(paths))
+	for _, path := range paths {
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		inputs = append(inputs, input{name: path, sql: strings.TrimRight(string(b), "\n")})
+	}
+	return inputs, nil
+}
+
+func printIssues(w io.Writer, name string, issues []validator.Issue) {
+	if len(issues) == 0 {
+		fmt.Fprintf(w, "%s: ok\n", name)
+		return
+	}
+	for _, issue := range issues {
+		fmt.Fprintf(w, "%s:%d: %s\n", name, issue.Start, issue.Reason)
+		if issue.Fix != "" {
+			fmt.Fprintf(w, "%s:%d: fix: %s\n", name, issue.Start, issue.Fix)
+		}
+		if issue.Waiver != "" {
+			fmt.Fprintf(w, "%s:%d: allowed: %s\n", name, issue.Start, issue.Waiver)
+		}
+	}
+}
+
+// printReport writes the report of a query as a line of JSON
+func printReport(w io.Writer, name string, report validator.Report) error {
+	return json.NewEncoder(w).Encode(struct {
+		Name string `json:"name"`
+		validator.Report
+	}{name, report})
+}
@@ -15,4 +15,33 @@ type TimestreamCustomMeta struct {
 	HasSeries bool   `json:"hasSeries,omitempty"`
 
 	Status *timestreamquerytypes.QueryStatus `json:"status,omitempty"`
+
+	// Set when a Timestream quota rejected the query
+	QuotaExceeded string `json:"quotaExceeded,omitempty"`
+	RetryAfterMs  int64  `json:"retryAfterMs,omitempty"`
+
+	// Checksum of the returned data, set for alert queries
+	Checksum string `json:"checksum,omitempty"`
+
+	// Set when paging stopped at the deadline of the request, the result holds
+	// the rows read before
+	TruncatedByTimeout bool `json:"truncatedByTimeout,omitempty"`
+
+	// Number of sub-range queries merged into the result
+	SplitQueries int `json:"splitQueries,omitempty"`
+
+	// Set when the query was rejected before it was sent to Timestream
+	Problem *Problem `json:"problem,omitempty"`
+
+	// The result columns with their Timestream types, e.g. for correlations
+	// from a column to another datasource
+	Columns []ColumnMeta `json:"columns,omitempty"`
+}
+
+// ColumnMeta is a result column as Timestream returned it, before the columns
+// are mapped to fields
+type ColumnMeta struct {
+	Name string `json:"name"`
+	// Type is the SQL type, e.g. VARCHAR, DOUBLE or ARRAY(BIGINT)
+	Type string `json:"type"`
 }
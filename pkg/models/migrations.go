@@ -0,0 +1,90 @@
+package models
+
+import (
+	"bytes"
+	"encoding/json"
+)
+
+// queryMigration upgrades the JSON of queries saved before the version
+type queryMigration struct {
+	version int
+	name    string
+	// migrate changes the query in place and reports whether it changed anything
+	migrate func(query map[string]any) bool
+}
+
+// queryMigrations are applied in order to queries below their version, before the
+// query is read. Append a migration when a field is renamed or its values change,
+// so saved dashboards keep working.
+var queryMigrations = []queryMigration{
+	{version: 1, name: "format-names", migrate: migrateFormatNames},
+	{version: 1, name: "raw-sql", migrate: migrateRawSQL},
+}
+
+// migrateFormatNames replaces the format names of old panels, e.g. "time_series",
+// with the format options
+func migrateFormatNames(query map[string]any) bool {
+	name, ok := query["format"].(string)
+	if !ok {
+		return false
+	}
+	switch name {
+	case "table":
+		query["format"] = FormatOptionTable
+	case "time_series", "timeseries":
+		query["format"] = FormatOptionTimeSeries
+	default:
+		return false
+	}
+	return true
+}
+
+// migrateRawSQL renames the rawSql of queries copied from the SQL editors of other
+// datasources to rawQuery
+func migrateRawSQL(query map[string]any) bool {
+	sql, ok := query["rawSql"].(string)
+	if !ok {
+		return false
+	}
+	if _, exists := query["rawQuery"]; exists {
+		return false
+	}
+	query["rawQuery"] = sql
+	delete(query, "rawSql")
+	return true
+}
+
+// MigrateQuery upgrades query JSON saved by older versions of the plugin to the
+// current model and returns the names of the migrations applied. The JSON is
+// returned unchanged when no migration applies or it isn't a JSON object. The
+// version of the query is kept, migrated queries are still read leniently.
+func MigrateQuery(raw json.RawMessage) (json.RawMessage, []string) {
+	query := map[string]any{}
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	// keep numbers as written, e.g. large integers
+	dec.UseNumber()
+	if err := dec.Decode(&query); err != nil {
+		return raw, nil
+	}
+	version := 0
+	if v, ok := query["version"].(json.Number); ok {
+		if n, err := v.Int64(); err == nil {
+			version = int(n)
+		}
+	}
+
+	var applied []string
+	for _, m := range queryMigrations {
+		if version < m.version && m.migrate(query) {
+			applied = append(applied, m.name)
+		}
+	}
+	if len(applied) == 0 {
+		return raw, nil
+	}
+	migrated, err := json.Marshal(query)
+	if err != nil {
+		return raw, nil
+	}
+	return migrated, applied
+}
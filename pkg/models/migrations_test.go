@@ -0,0 +1,72 @@
+package models
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+)
+
+func TestMigrateQuery(t *testing.T) {
+	tests := []struct {
+		name    string
+		json    string
+		want    string
+		applied []string
+	}{
+		{
+			name:    "format names",
+			json:    `{"format":"time_series","rawQuery":"SELECT 1"}`,
+			want:    `{"format":1,"rawQuery":"SELECT 1"}`,
+			applied: []string{"format-names"},
+		},
+		{
+			name:    "raw sql",
+			json:    `{"format":"table","rawSql":"SELECT 1","seriesHint":12345678901234567}`,
+			want:    `{"format":0,"rawQuery":"SELECT 1","seriesHint":12345678901234567}`,
+			applied: []string{"format-names", "raw-sql"},
+		},
+		{
+			name: "raw sql doesn't replace the raw query",
+			json: `{"rawQuery":"SELECT 1","rawSql":"SELECT 2"}`,
+			want: `{"rawQuery":"SELECT 1","rawSql":"SELECT 2"}`,
+		},
+		{
+			name: "current queries",
+			json: `{"format":1, "rawQuery":"SELECT 1"}`,
+			want: `{"format":1, "rawQuery":"SELECT 1"}`,
+		},
+		{
+			name: "versioned queries",
+			json: `{"version":1,"format":"table"}`,
+			want: `{"version":1,"format":"table"}`,
+		},
+		{
+			name: "not an object",
+			json: `[]`,
+			want: `[]`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, applied := MigrateQuery(json.RawMessage(tt.json))
+			if string(got) != tt.want {
+				t.Errorf("want %s, got %s", tt.want, got)
+			}
+			if !reflect.DeepEqual(applied, tt.applied) {
+				t.Errorf("want migrations %v, got %v", tt.applied, applied)
+			}
+		})
+	}
+}
+
+func TestGetQueryModel_Migrated(t *testing.T) {
+	model, err := GetQueryModel(backend.DataQuery{JSON: []byte(`{"format":"time_series","rawSql":"SELECT 1","waitForResult":true}`)})
+	if err != nil {
+		t.Fatalf("Error reading query: %s", err.Error())
+	}
+	if model.Format != FormatOptionTimeSeries || model.RawQuery != "SELECT 1" || !model.WaitForResult {
+		t.Fatalf("query not migrated: %+v", model)
+	}
+}
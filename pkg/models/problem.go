@@ -0,0 +1,26 @@
+package models
+
+// Problem describes why a query was rejected, modeled on problem+json (RFC 9457).
+// Code and Title are stable so the frontend can render and translate them.
+type Problem struct {
+	Code   string        `json:"code"`
+	Title  string        `json:"title"`
+	Detail string        `json:"detail"`
+	Status int           `json:"status"`
+	Spans  []ProblemSpan `json:"spans,omitempty"`
+	Docs   string        `json:"docs,omitempty"`
+	// IssueCode is the kind of issue of the detail, e.g. missing-time-predicate
+	IssueCode string `json:"issueCode,omitempty"`
+	// Fix suggests how to resolve the problem, set for problems with a common cause
+	Fix string `json:"fix,omitempty"`
+}
+
+// ProblemSpan is the byte range of the executed query causing the problem
+type ProblemSpan struct {
+	Start   int    `json:"start"`
+	End     int    `json:"end"`
+	Snippet string `json:"snippet,omitempty"`
+	Detail  string `json:"detail,omitempty"`
+	// IssueCode is the kind of issue of the detail
+	IssueCode string `json:"issueCode,omitempty"`
+}
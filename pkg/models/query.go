@@ -18,12 +18,48 @@ const (
 	FormatOptionTable FormatQueryOption = iota
 	//FormatOptionTimeSeries formats the query results as a timeseries using "WideToLong"
 	FormatOptionTimeSeries
+	// FormatOptionLogs formats the query results as a table shown as log lines
+	FormatOptionLogs
+	// FormatOptionStateTimeline formats the query results as timeseries with the
+	// consecutive equal values of each series merged into ranges
+	FormatOptionStateTimeline
+	// FormatOptionGeo formats the query results as a table of locations for the
+	// Geomap panel
+	FormatOptionGeo
 )
 
 var LegacyQueryCheck = regexp.MustCompile(`"format":\s*"table"`)
 
+// QueryTypeFreshness returns the latest data point of each measure of the table
+// instead of running the raw query
+const QueryTypeFreshness = "freshness"
+
+// QueryTypePreview returns the latest rows of the table, up to MaxRows, instead of
+// running the raw query
+const QueryTypePreview = "preview"
+
+// QueryTypeMerge joins the time series of other queries of the request, named by
+// Refs, into one wide frame instead of running a query
+const QueryTypeMerge = "merge"
+
+// QueryTypeMath evaluates Expression, e.g. $A / $B * 100, over the time series of
+// the queries it references instead of running a query
+const QueryTypeMath = "math"
+
+// QueryTypeMultiAccount runs the raw query in each of the accounts of the
+// datasource, or the ones named by Accounts, and concatenates the results
+const QueryTypeMultiAccount = "multiAccount"
+
+// QueryTypeLogContext returns the rows written before or after a row of a logs
+// query, with the same dimensions, instead of running the raw query
+const QueryTypeLogContext = "logContext"
+
 // QueryModel represents a spreadsheet query.
 type QueryModel struct {
+	// Version of the query model, see QueryModelVersion
+	Version int `json:"version,omitempty"`
+
+	QueryType string `json:"queryType,omitempty"`
 	RawQuery  string `json:"rawQuery,omitempty"`
 	NextToken string `json:"nextToken,omitempty"`
 
@@ -36,19 +72,286 @@ type QueryModel struct {
 	Interval      time.Duration     `json:"-"`
 	TimeRange     backend.TimeRange `json:"-"`
 	MaxDataPoints int64             `json:"-"`
+	// Set for requests of the alerting engine
+	FromAlert bool `json:"-"`
+	// State mappings of the datasource applied to varchar measures
+	StateMappings []StateMapping `json:"-"`
+	// Lists the tables of a database, the $__shards macro skips the shards that
+	// don't exist. Nil keeps every shard.
+	ListTables func(database string) ([]string, error) `json:"-"`
 
 	// Return several pages (if exist) in one response
 	WaitForResult bool `json:"waitForResult"`
 
 	// Format the results
 	Format FormatQueryOption `json:"format"`
+
+	// Expected number of series, used to scale $__limit
+	SeriesHint int64 `json:"seriesHint,omitempty"`
+	// Append $__limit to queries without a LIMIT
+	AutoLimit bool `json:"autoLimit,omitempty"`
+
+	// Run only the statement enclosing this part of RawQuery
+	Selection *QuerySelection `json:"selection,omitempty"`
+
+	// Rename, hide, reorder and convert result columns
+	Columns []ColumnMapping `json:"columns,omitempty"`
+
+	// Send low cardinality string columns of large tables as enums
+	DictionaryEncode bool `json:"dictionaryEncode,omitempty"`
+
+	// Explicit handling of NULL values and empty results
+	Nulls *NullHandling `json:"nulls,omitempty"`
+
+	// Named validator configuration of the datasource the query is checked with
+	ValidatorProfile string `json:"validatorProfile,omitempty"`
+
+	// Parts of builder queries, RawQuery holds their SQL. Set in the query JSON,
+	// the query editor doesn't write them.
+	Builder *BuilderQuery `json:"builder,omitempty"`
+	// Sorting and filters run in the SQL of builder queries
+	TableHints *TableHints `json:"tableHints,omitempty"`
+
+	// Keep the largest series, e.g. of a query grouped by a high cardinality dimension
+	SeriesLimit *SeriesLimit `json:"seriesLimit,omitempty"`
+
+	// Also return the series of the range shifted back by this duration, e.g. 1w
+	CompareOffset string `json:"compareOffset,omitempty"`
+
+	// Run long ranges as concurrent sub-range queries of this duration, e.g. 7d
+	SplitInterval string `json:"splitInterval,omitempty"`
+
+	// Fill missing values when converting to time series
+	FillMode  FillMode `json:"fillMode,omitempty"`
+	FillValue float64  `json:"fillValue,omitempty"`
+
+	// Stop reading results after this many rows
+	MaxRows int64 `json:"maxRows,omitempty"`
+
+	// Serve responses of the result cache only while they are younger than this,
+	// the cache TTL of the datasource bounds it
+	MaxStalenessSeconds int `json:"maxStalenessSeconds,omitempty"`
+
+	// Cancel the request after this many seconds, overrides the datasource
+	// timeout up to its maximum
+	TimeoutSeconds int `json:"timeoutSeconds,omitempty"`
+
+	// Map dimension values with the lookups of the datasource
+	Enrich []Enrichment `json:"enrich,omitempty"`
+
+	// Ad-hoc filters of the dashboard, added to queries of the table
+	AdhocFilters []AdhocFilter `json:"adhocFilters,omitempty"`
+
+	// RefIDs of the queries joined by a merge query
+	Refs []string `json:"refs,omitempty"`
+
+	// Expression of a math query
+	Expression string `json:"expression,omitempty"`
+
+	// Row of a log context query
+	LogContext *LogContext `json:"logContext,omitempty"`
+
+	// Names of the accounts a multi-account query runs in, all when empty
+	Accounts []string `json:"accounts,omitempty"`
+}
+
+// LogContext is the row of a logs query to show the surrounding rows of
+type LogContext struct {
+	// Time of the row in epoch milliseconds
+	Time int64 `json:"time"`
+	// Values of the row by column, the dimensions and measure_name among them
+	// select the rows of the context
+	Values map[string]string `json:"values,omitempty"`
+	// Direction is backward for the rows before, forward for the rows after
+	Direction LogContextDirection `json:"direction"`
+	// Limit of the rows returned, defaults to 100
+	Limit int64 `json:"limit,omitempty"`
+}
+
+// LogContextDirection selects the rows before or after the row of a log context
+type LogContextDirection string
+
+const (
+	LogContextBackward LogContextDirection = "backward"
+	LogContextForward  LogContextDirection = "forward"
+)
+
+// AdhocFilter is a Grafana ad-hoc filter on a dimension
+type AdhocFilter struct {
+	Key      string `json:"key"`
+	Operator string `json:"operator"`
+	Value    string `json:"value"`
+}
+
+// UnmarshalJSON reads the filter leniently, Grafana adds further keys to
+// ad-hoc filters, e.g. their condition
+func (f *AdhocFilter) UnmarshalJSON(b []byte) error {
+	type filter AdhocFilter
+	return json.Unmarshal(b, (*filter)(f))
+}
+
+// Enrichment adds the lookup values of a result column, as a column of table
+// results and as a label of time series
+type Enrichment struct {
+	Lookup string `json:"lookup"`
+	Column string `json:"column"`
+	// As names the added column or label, defaults to the lookup name
+	As string `json:"as,omitempty"`
+}
+
+// BuilderFilter is an additional predicate of a builder query. A filter of the
+// measure column compares its values.
+type BuilderFilter struct {
+	Column   string `json:"column"`
+	Operator string `json:"operator"`
+	Value    string `json:"value"`
+}
+
+// BuilderOrder sorts the rows of a builder query by a column of its result
+type BuilderOrder struct {
+	Column string `json:"column"`
+	Desc   bool   `json:"desc,omitempty"`
+}
+
+// BuilderQuery describes a query by its parts. The generated SQL always
+// restricts time and measure_name, so it passes the reasonable query check.
+type BuilderQuery struct {
+	Database string `json:"database"`
+	Table    string `json:"table"`
+	Measure  string `json:"measure"`
+
+	// ValueType selects the measure_value::<type> column, defaults to double.
+	// For multi-measure records the Attribute column is selected instead.
+	ValueType string `json:"valueType,omitempty"`
+	Attribute string `json:"attribute,omitempty"`
+	// Aggregation like avg, min, max, sum or count. Empty returns raw points.
+	Aggregation string `json:"aggregation,omitempty"`
+	// Bin groups the points by $__interval_ms
+	Bin bool `json:"bin,omitempty"`
+
+	GroupBy []string        `json:"groupBy,omitempty"`
+	Filters []BuilderFilter `json:"filters,omitempty"`
+	// OrderBy sorts the rows, by time by default
+	OrderBy []BuilderOrder `json:"orderBy,omitempty"`
+	Limit   int64          `json:"limit,omitempty"`
+}
+
+// TableHints are the sorting and filters of the table showing the query, e.g.
+// kept by a frontend calling the query API
+type TableHints struct {
+	Sort    []BuilderOrder  `json:"sort,omitempty"`
+	Filters []BuilderFilter `json:"filters,omitempty"`
+}
+
+// FillMode selects how missing values of wide time series are filled
+type FillMode string
+
+const (
+	FillModeNull     FillMode = "null"
+	FillModePrevious FillMode = "previous"
+	FillModeValue    FillMode = "value"
+)
+
+// QueryDefaults are inherited by queries that don't set the option themselves
+type QueryDefaults struct {
+	Format    *FormatQueryOption `json:"format,omitempty"`
+	FillMode  FillMode           `json:"fillMode,omitempty"`
+	FillValue float64            `json:"fillValue,omitempty"`
+	MaxRows   int64              `json:"maxRows,omitempty"`
+
+	MaxStalenessSeconds int `json:"maxStalenessSeconds,omitempty"`
+}
+
+// apply sets the defaults on a model before the query is read into it
+func (d *QueryDefaults) apply(model *QueryModel) {
+	if d == nil {
+		return
+	}
+	if d.Format != nil {
+		model.Format = *d.Format
+	}
+	model.FillMode = d.FillMode
+	model.FillValue = d.FillValue
+	model.MaxRows = d.MaxRows
+	model.MaxStalenessSeconds = d.MaxStalenessSeconds
+}
+
+// OtherAggregation combines the series beyond a series limit per timestamp
+type OtherAggregation string
+
+const (
+	OtherSum OtherAggregation = "sum"
+	OtherAvg OtherAggregation = "avg"
+)
+
+// SeriesLimit bounds the number of time series of each value column. Series are
+// ranked by the sum of their values, or their mean when averaged.
+type SeriesLimit struct {
+	// Limit is the number of series kept
+	Limit int `json:"limit"`
+	// Other aggregates the remaining series into an "other" series, they are
+	// dropped without an aggregation
+	Other OtherAggregation `json:"other,omitempty"`
+}
+
+// NullHandling makes missing values explicit, e.g. for alert reductions
+type NullHandling struct {
+	// DropEmptySeries removes value columns (series) without any value
+	DropEmptySeries bool `json:"dropEmptySeries,omitempty"`
+	// DropZeroSeries removes value columns (series) whose values are all NULL or zero,
+	// e.g. the idle devices of sparse fleet metrics
+	DropZeroSeries bool `json:"dropZeroSeries,omitempty"`
+	// ReplaceWith replaces NULL numbers with this value
+	ReplaceWith *float64 `json:"replaceWith,omitempty"`
+	// ErrorOnNoData fails the query when it returns no rows
+	ErrorOnNoData bool `json:"errorOnNoData,omitempty"`
+}
+
+// ColumnRole converts a column to the type expected for the role
+type ColumnRole string
+
+const (
+	ColumnRoleTime  ColumnRole = "time"
+	ColumnRoleValue ColumnRole = "value"
+	ColumnRoleLabel ColumnRole = "label"
+	// the location columns of the geo format
+	ColumnRoleLatitude  ColumnRole = "latitude"
+	ColumnRoleLongitude ColumnRole = "longitude"
+	ColumnRoleGeohash   ColumnRole = "geohash"
+)
+
+// ColumnMapping configures a single result column
+type ColumnMapping struct {
+	Name   string     `json:"name"`
+	Rename string     `json:"rename,omitempty"`
+	Hide   bool       `json:"hide,omitempty"`
+	Role   ColumnRole `json:"role,omitempty"`
+}
+
+// QuerySelection is a byte range of the raw query selected in the editor
+type QuerySelection struct {
+	Start int `json:"start"`
+	End   int `json:"end"`
 }
 
 // GetQueryModel returns a parsed query
 func GetQueryModel(query backend.DataQuery) (*QueryModel, error) {
+	return GetQueryModelWithDefaults(query, nil)
+}
+
+// GetQueryModelWithDefaults returns a parsed query, options missing in the query
+// are taken from the datasource defaults
+func GetQueryModelWithDefaults(query backend.DataQuery, defaults *QueryDefaults) (*QueryModel, error) {
 	model := &QueryModel{}
+	defaults.apply(model)
+
+	// Upgrade queries saved by older versions of the plugin
+	raw, migrations := MigrateQuery(query.JSON)
+	if len(migrations) > 0 {
+		backend.Logger.Debug("Migrated query", "refId", query.RefID, "migrations", migrations)
+	}
 
-	err := json.Unmarshal(query.JSON, &model)
+	err := json.Unmarshal(raw, &model)
 	if err != nil {
 		if LegacyQueryCheck.Match(query.JSON) {
 			return nil, backend.DownstreamError(fmt.Errorf("query is incompatible with current structure, please rebuild it: %w", err))
@@ -56,7 +359,23 @@ func GetQueryModel(query backend.DataQuery) (*QueryModel, error) {
 		return nil, backend.PluginError(fmt.Errorf("error reading query: %s", err.Error()))
 	}
 
+	// Versioned queries are read strictly, on top of the defaults as well
+	if model.Version > 0 {
+		strict := &QueryModel{}
+		defaults.apply(strict)
+		if err := decodeStrict(raw, strict); err != nil {
+			return nil, backend.DownstreamError(fmt.Errorf("invalid query: %w", err))
+		}
+		if err := strict.Validate(); err != nil {
+			return nil, backend.DownstreamError(fmt.Errorf("invalid query: %w", err))
+		}
+		model = strict
+	}
+
 	// Copy directly from the well typed query
+	if model.QueryType == "" {
+		model.QueryType = query.QueryType
+	}
 	model.TimeRange = query.TimeRange
 	model.Interval = query.Interval
 	model.MaxDataPoints = query.MaxDataPoints
@@ -90,3 +409,186 @@ type MeasuresRequest struct {
 	Database string `json:"database"`
 	Table    string `json:"table"`
 }
+
+// TableRetention is the queryable window of a table
+type TableRetention struct {
+	Database          string `json:"database"`
+	Table             string `json:"table"`
+	MemoryStoreHours  int64  `json:"memoryStoreHours"`
+	MagneticStoreDays int64  `json:"magneticStoreDays"`
+	// Earliest is the approximate time of the oldest available data point
+	Earliest time.Time `json:"earliest"`
+}
+
+// FreshnessRequest asks for the latest data point of a table, or of one measure
+type FreshnessRequest struct {
+	Database string `json:"database"`
+	Table    string `json:"table"`
+	Measure  string `json:"measure,omitempty"`
+
+	// ValidatorProfile selects the validator options the lookup is checked with
+	ValidatorProfile string `json:"validatorProfile,omitempty"`
+}
+
+// Freshness is the latest data point of a measure
+type Freshness struct {
+	Database   string    `json:"database"`
+	Table      string    `json:"table"`
+	Measure    string    `json:"measure"`
+	LastTime   time.Time `json:"lastTime"`
+	AgeSeconds int64     `json:"ageSeconds"`
+}
+
+// TagKeysRequest asks for the dimensions of a table, the default table when empty
+type TagKeysRequest struct {
+	Database string `json:"database,omitempty"`
+	Table    string `json:"table,omitempty"`
+}
+
+// TagValuesRequest asks for the values of a dimension, narrowed by the other
+// ad-hoc filters of the dashboard
+type TagValuesRequest struct {
+	Database string        `json:"database,omitempty"`
+	Table    string        `json:"table,omitempty"`
+	Key      string        `json:"key"`
+	Filters  []AdhocFilter `json:"filters,omitempty"`
+}
+
+// LookupRefreshRequest fetches a lookup again, every lookup when Name is empty
+type LookupRefreshRequest struct {
+	Name string `json:"name,omitempty"`
+}
+
+// PrefetchRequest lists the queries of a dashboard to run ahead of its panels
+type PrefetchRequest struct {
+	Queries       []json.RawMessage `json:"queries"`
+	From          time.Time         `json:"from"`
+	To            time.Time         `json:"to"`
+	IntervalMs    int64             `json:"intervalMs,omitempty"`
+	MaxDataPoints int64             `json:"maxDataPoints,omitempty"`
+}
+
+// TableRef names a table of a table comparison
+type TableRef struct {
+	Database string `json:"database"`
+	Table    string `json:"table"`
+}
+
+// CompareTablesRequest runs a query written with the $__database and $__table
+// macros against two tables, e.g. before and after a schema migration
+type CompareTablesRequest struct {
+	Query     json.RawMessage `json:"query"`
+	From      time.Time       `json:"from"`
+	To        time.Time       `json:"to"`
+	Baseline  TableRef        `json:"baseline"`
+	Candidate TableRef        `json:"candidate"`
+}
+
+// TableComparison summarizes the differences of the results of two tables
+type TableComparison struct {
+	Baseline  TableResult  `json:"baseline"`
+	Candidate TableResult  `json:"candidate"`
+	Series    []SeriesDiff `json:"series"`
+}
+
+// TableResult is the result of the compared query against one table
+type TableResult struct {
+	TableRef
+	ExecutedQuery string `json:"executedQuery"`
+	Rows          int    `json:"rows"`
+}
+
+// SeriesDiff compares the values of a numeric column or series. Points are
+// matched by time, or by the string columns of table results.
+type SeriesDiff struct {
+	Name               string            `json:"name"`
+	Labels             map[string]string `json:"labels,omitempty"`
+	Matched            int               `json:"matched"`
+	MissingInBaseline  int               `json:"missingInBaseline"`
+	MissingInCandidate int               `json:"missingInCandidate"`
+	MaxAbsDelta        float64           `json:"maxAbsDelta"`
+}
+
+// ExportRequest will run a query and return all of its frames
+type ExportRequest struct {
+	Query json.RawMessage `json:"query"`
+	From  time.Time       `json:"from"`
+	To    time.Time       `json:"to"`
+	// Format is either "json" (default) or "arrow"
+	Format string `json:"format,omitempty"`
+}
+
+// MaterializationRequest derives a scheduled query from a panel query, which
+// writes its results to a table every interval
+type MaterializationRequest struct {
+	// Name identifies the materialization, it is the measure name of the
+	// written records without MeasureName
+	Name  string          `json:"name"`
+	Query json.RawMessage `json:"query"`
+	// Interval is how often the scheduled query runs, e.g. 1h. Each run reads
+	// and rewrites the Lookback before it, the interval without it.
+	// Resolution replaces $__interval, the interval without it.
+	Interval   string `json:"interval"`
+	Lookback   string `json:"lookback,omitempty"`
+	Resolution string `json:"resolution,omitempty"`
+	// Database and Table receive the results, the table is created when it
+	// doesn't exist
+	Database    string `json:"database,omitempty"`
+	Table       string `json:"table"`
+	MeasureName string `json:"measureName,omitempty"`
+	// Retention of a created table, zero uses the defaults
+	MemoryStoreHours  int64 `json:"memoryStoreHours,omitempty"`
+	MagneticStoreDays int64 `json:"magneticStoreDays,omitempty"`
+}
+
+// MaterializationStateRequest enables or disables the scheduled query of a
+// materialization, or deletes it
+type MaterializationStateRequest struct {
+	Arn     string `json:"arn"`
+	Enabled bool   `json:"enabled,omitempty"`
+}
+
+// Materialization is a scheduled query writing the results of a panel query to a table
+type Materialization struct {
+	Name     string `json:"name"`
+	Arn      string `json:"arn,omitempty"`
+	State    string `json:"state,omitempty"`
+	Database string `json:"database"`
+	Table    string `json:"table"`
+	// ScheduledQuery, Schedule and PanelQuery are returned when the
+	// materialization is previewed or created. PanelQuery reads the panel
+	// results from the table.
+	ScheduledQuery string   `json:"scheduledQuery,omitempty"`
+	Schedule       string   `json:"schedule,omitempty"`
+	PanelQuery     string   `json:"panelQuery,omitempty"`
+	Dimensions     []string `json:"dimensions,omitempty"`
+	Measures       []string `json:"measures,omitempty"`
+	// TableCreated is false when the materialization writes to an existing table
+	TableCreated  bool       `json:"tableCreated,omitempty"`
+	LastRunStatus string     `json:"lastRunStatus,omitempty"`
+	PreviousRun   *time.Time `json:"previousRun,omitempty"`
+	NextRun       *time.Time `json:"nextRun,omitempty"`
+}
+
+// DashboardsRequest will return example dashboards for a table
+type DashboardsRequest struct {
+	Database  string `json:"database"`
+	Table     string `json:"table"`
+	Measure   string `json:"measure"`
+	ValueType string `json:"valueType,omitempty"`
+	Dimension string `json:"dimension"`
+}
+
+// AlertStateRequest is the payload of a Grafana webhook contact point
+type AlertStateRequest struct {
+	Alerts []AlertState `json:"alerts"`
+}
+
+// AlertState is a single alert instance in a webhook notification
+type AlertState struct {
+	Status      string            `json:"status"`
+	Labels      map[string]string `json:"labels"`
+	StartsAt    time.Time         `json:"startsAt"`
+	EndsAt      time.Time         `json:"endsAt"`
+	Fingerprint string            `json:"fingerprint"`
+}
@@ -64,3 +64,35 @@ func TestGetQueryModel_Errors(t *testing.T) {
 		})
 	}
 }
+
+func TestGetQueryModelWithDefaults(t *testing.T) {
+	timeSeries := FormatOptionTimeSeries
+	defaults := &QueryDefaults{Format: &timeSeries, FillMode: FillModePrevious, MaxRows: 5000, MaxStalenessSeconds: 30}
+
+	model, err := GetQueryModelWithDefaults(backend.DataQuery{JSON: []byte(`{"rawQuery":"SELECT 1"}`)}, defaults)
+	if err != nil {
+		t.Fatalf("Error reading query: %s", err.Error())
+	}
+	if model.Format != FormatOptionTimeSeries || model.FillMode != FillModePrevious || model.MaxRows != 5000 || model.MaxStalenessSeconds != 30 {
+		t.Fatalf("defaults not applied: %+v", model)
+	}
+
+	// the panel overrides the defaults
+	model, err = GetQueryModelWithDefaults(backend.DataQuery{JSON: []byte(`{"format":0,"fillMode":"null","maxRows":10,"maxStalenessSeconds":5}`)}, defaults)
+	if err != nil {
+		t.Fatalf("Error reading query: %s", err.Error())
+	}
+	if model.Format != FormatOptionTable || model.FillMode != FillModeNull || model.MaxRows != 10 || model.MaxStalenessSeconds != 5 {
+		t.Fatalf("defaults not overridden: %+v", model)
+	}
+}
+
+func TestGetQueryModel_QueryType(t *testing.T) {
+	model, err := GetQueryModel(backend.DataQuery{QueryType: QueryTypeFreshness, JSON: []byte(`{"table":"metrics"}`)})
+	if err != nil {
+		t.Fatalf("Error reading query: %s", err.Error())
+	}
+	if model.QueryType != QueryTypeFreshness {
+		t.Fatalf("want query type %s, got %q", QueryTypeFreshness, model.QueryType)
+	}
+}
@@ -0,0 +1,225 @@
+package models
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// QueryModelVersion is the version of the query model written by the current
+// editor. Queries without a version predate it and are read leniently, versioned
+// queries are rejected for unknown fields and invalid values.
+const QueryModelVersion = 1
+
+// strictQuery adds the fields Grafana sends with every query to the model, so
+// only fields unknown to both are rejected
+type strictQuery struct {
+	QueryModel
+
+	RefID         string          `json:"refId,omitempty"`
+	Datasource    json.RawMessage `json:"datasource,omitempty"`
+	DatasourceID  int64           `json:"datasourceId,omitempty"`
+	Hide          bool            `json:"hide,omitempty"`
+	Key           string          `json:"key,omitempty"`
+	IntervalMs    float64         `json:"intervalMs,omitempty"`
+	MaxDataPoints int64           `json:"maxDataPoints,omitempty"`
+	TimeRange     json.RawMessage `json:"timeRange,omitempty"`
+}
+
+// decodeStrict reads the query JSON into model, failing on unknown fields
+func decodeStrict(raw []byte, model *QueryModel) error {
+	q := strictQuery{QueryModel: *model}
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&q); err != nil {
+		return err
+	}
+	*model = q.QueryModel
+	return nil
+}
+
+// Validate checks the options of the query against their allowed values
+func (q *QueryModel) Validate() error {
+	if q.Version > QueryModelVersion {
+		return fmt.Errorf("query version %d is newer than the supported version %d", q.Version, QueryModelVersion)
+	}
+	if q.Format != FormatOptionTable && q.Format != FormatOptionTimeSeries && q.Format != FormatOptionLogs && q.Format != FormatOptionStateTimeline && q.Format != FormatOptionGeo {
+		return fmt.Errorf("unknown format %d", q.Format)
+	}
+	if q.FillMode != "" && !q.FillMode.valid() {
+		return fmt.Errorf("unknown fill mode %q", q.FillMode)
+	}
+	for _, c := range q.Columns {
+		if c.Name == "" {
+			return fmt.Errorf("column mapping without a name")
+		}
+		if c.Role != "" && !c.Role.valid() {
+			return fmt.Errorf("unknown role %q of column %s", c.Role, c.Name)
+		}
+	}
+	if q.Selection != nil && (q.Selection.Start < 0 || q.Selection.End < q.Selection.Start) {
+		return fmt.Errorf("invalid selection %d-%d", q.Selection.Start, q.Selection.End)
+	}
+	for name, v := range map[string]int64{"seriesHint": q.SeriesHint, "maxRows": q.MaxRows, "timeoutSeconds": int64(q.TimeoutSeconds), "maxStalenessSeconds": int64(q.MaxStalenessSeconds)} {
+		if v < 0 {
+			return fmt.Errorf("%s must not be negative", name)
+		}
+	}
+	for _, e := range q.Enrich {
+		if e.Lookup == "" || e.Column == "" {
+			return fmt.Errorf("enrichment requires a lookup and a column")
+		}
+	}
+	if l := q.SeriesLimit; l != nil {
+		if l.Limit < 1 {
+			return fmt.Errorf("series limit must be positive")
+		}
+		if l.Other != "" && !l.Other.valid() {
+			return fmt.Errorf("unknown aggregation %q of other series", l.Other)
+		}
+	}
+	if h := q.TableHints; h != nil {
+		for _, o := range h.Sort {
+			if o.Column == "" {
+				return fmt.Errorf("table sort requires a column")
+			}
+		}
+		for _, f := range h.Filters {
+			if f.Column == "" || f.Operator == "" {
+				return fmt.Errorf("table filter requires a column and an operator")
+			}
+		}
+	}
+	if q.LogContext != nil && !q.LogContext.Direction.valid() {
+		return fmt.Errorf("unknown log context direction %q", q.LogContext.Direction)
+	}
+	return nil
+}
+
+// schemaEnum is implemented by the options with a fixed set of values
+type schemaEnum interface {
+	enumValues() []any
+}
+
+func (FormatQueryOption) enumValues() []any {
+	return []any{FormatOptionTable, FormatOptionTimeSeries, FormatOptionLogs, FormatOptionStateTimeline, FormatOptionGeo}
+}
+
+func (FillMode) enumValues() []any {
+	return []any{FillModeNull, FillModePrevious, FillModeValue}
+}
+
+func (m FillMode) valid() bool {
+	return m == FillModeNull || m == FillModePrevious || m == FillModeValue
+}
+
+func (LogContextDirection) enumValues() []any {
+	return []any{LogContextBackward, LogContextForward}
+}
+
+func (d LogContextDirection) valid() bool {
+	return d == LogContextBackward || d == LogContextForward
+}
+
+func (OtherAggregation) enumValues() []any {
+	return []any{OtherSum, OtherAvg}
+}
+
+func (a OtherAggregation) valid() bool {
+	return a == OtherSum || a == OtherAvg
+}
+
+func (ColumnRole) enumValues() []any {
+	return []any{ColumnRoleTime, ColumnRoleValue, ColumnRoleLabel, ColumnRoleLatitude, ColumnRoleLongitude, ColumnRoleGeohash}
+}
+
+func (r ColumnRole) valid() bool {
+	switch r {
+	case ColumnRoleTime, ColumnRoleValue, ColumnRoleLabel, ColumnRoleLatitude, ColumnRoleLongitude, ColumnRoleGeohash:
+		return true
+	}
+	return false
+}
+
+// QuerySchema returns the JSON schema of versioned queries, including the fields
+// Grafana adds to every query, e.g. for validating provisioned dashboards
+func QuerySchema() map[string]any {
+	schema := typeSchema(reflect.TypeOf(strictQuery{}))
+	schema["$schema"] = "https://json-schema.org/draft/2020-12/schema"
+	schema["title"] = "Timestream query"
+	return schema
+}
+
+var (
+	rawMessageType  = reflect.TypeOf(json.RawMessage{})
+	unmarshalerType = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+	enumType        = reflect.TypeOf((*schemaEnum)(nil)).Elem()
+)
+
+// typeSchema maps a Go type to its JSON schema. Structs reading their JSON
+// themselves accept additional properties.
+func typeSchema(t reflect.Type) map[string]any {
+	if t == rawMessageType {
+		return map[string]any{}
+	}
+	if t.Kind() == reflect.Pointer {
+		return typeSchema(t.Elem())
+	}
+	schema := map[string]any{}
+	if t.Implements(enumType) {
+		schema["enum"] = reflect.Zero(t).Interface().(schemaEnum).enumValues()
+	}
+	switch t.Kind() {
+	case reflect.String:
+		schema["type"] = "string"
+	case reflect.Bool:
+		schema["type"] = "boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		schema["type"] = "integer"
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		schema["type"] = "integer"
+		schema["minimum"] = 0
+	case reflect.Float32, reflect.Float64:
+		schema["type"] = "number"
+	case reflect.Slice, reflect.Array:
+		schema["type"] = "array"
+		schema["items"] = typeSchema(t.Elem())
+	case reflect.Map:
+		schema["type"] = "object"
+		schema["additionalProperties"] = typeSchema(t.Elem())
+	case reflect.Struct:
+		schema["type"] = "object"
+		properties := map[string]any{}
+		addProperties(t, properties)
+		schema["properties"] = properties
+		if !reflect.PointerTo(t).Implements(unmarshalerType) {
+			schema["additionalProperties"] = false
+		}
+	}
+	return schema
+}
+
+// addProperties adds the JSON fields of the struct, including those of embedded structs
+func addProperties(t reflect.Type, properties map[string]any) {
+	for i := range t.NumField() {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, _, _ := strings.Cut(tag, ",")
+		if f.Anonymous && name == "" {
+			addProperties(f.Type, properties)
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		properties[name] = typeSchema(f.Type)
+	}
+}
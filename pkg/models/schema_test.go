@@ -0,0 +1,157 @@
+package models
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+)
+
+func TestGetQueryModel_Versioned(t *testing.T) {
+	tests := []struct {
+		name    string
+		json    string
+		wantErr string
+	}{
+		{
+			name: "unversioned queries are read leniently",
+			json: `{"rawQuery":"SELECT 1","rawSql":"select 1","fillMode":"linear"}`,
+		},
+		{
+			name: "grafana query fields",
+			json: `{"version":1,"refId":"A","datasource":{"type":"grafana-timestream-datasource","uid":"ts"},"hide":false,"intervalMs":1000,"maxDataPoints":500,"rawQuery":"SELECT 1"}`,
+		},
+		{
+			name: "ad-hoc filters keep the keys added by grafana",
+			json: `{"version":1,"adhocFilters":[{"key":"host","operator":"=","value":"a","condition":""}]}`,
+		},
+		{
+			name:    "unknown field",
+			json:    `{"version":1,"rawSql":"select 1"}`,
+			wantErr: `unknown field "rawSql"`,
+		},
+		{
+			name:    "unknown nested field",
+			json:    `{"version":1,"nulls":{"dropEmpty":true}}`,
+			wantErr: `unknown field "dropEmpty"`,
+		},
+		{
+			name:    "newer version",
+			json:    `{"version":2}`,
+			wantErr: "query version 2 is newer than the supported version 1",
+		},
+		{
+			name:    "unknown fill mode",
+			json:    `{"version":1,"fillMode":"linear"}`,
+			wantErr: `unknown fill mode "linear"`,
+		},
+		{
+			name:    "unknown column role",
+			json:    `{"version":1,"columns":[{"name":"host","role":"dimension"}]}`,
+			wantErr: `unknown role "dimension" of column host`,
+		},
+		{
+			name: "series limit",
+			json: `{"version":1,"seriesLimit":{"limit":10,"other":"sum"}}`,
+		},
+		{
+			name:    "unknown aggregation of other series",
+			json:    `{"version":1,"seriesLimit":{"limit":10,"other":"max"}}`,
+			wantErr: `unknown aggregation "max" of other series`,
+		},
+		{
+			name:    "series limit without a limit",
+			json:    `{"version":1,"seriesLimit":{"other":"avg"}}`,
+			wantErr: "series limit must be positive",
+		},
+		{
+			name: "table hints of a builder query",
+			json: `{"version":1,"builder":{"database":"db","table":"t","measure":"cpu","groupBy":["host"]},"tableHints":{"sort":[{"column":"cpu","desc":true}],"filters":[{"column":"host","operator":"=","value":"a"}]}}`,
+		},
+		{
+			name:    "table sort without a column",
+			json:    `{"version":1,"tableHints":{"sort":[{"desc":true}]}}`,
+			wantErr: "table sort requires a column",
+		},
+		{
+			name: "log context",
+			json: `{"version":1,"queryType":"logContext","format":2,"logContext":{"time":1700000000000,"values":{"host":"a"},"direction":"forward","limit":10}}`,
+		},
+		{
+			name:    "unknown log context direction",
+			json:    `{"version":1,"logContext":{"time":1700000000000,"direction":"around"}}`,
+			wantErr: `unknown log context direction "around"`,
+		},
+		{
+			name:    "negative max rows",
+			json:    `{"version":1,"maxRows":-1}`,
+			wantErr: "maxRows must not be negative",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := GetQueryModel(backend.DataQuery{JSON: []byte(tt.json)})
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %s", err.Error())
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("want error %q, got %v", tt.wantErr, err)
+			}
+			if !backend.IsDownstreamError(err) {
+				t.Errorf("want a downstream error, got %v", err)
+			}
+		})
+	}
+}
+
+func TestGetQueryModel_VersionedDefaults(t *testing.T) {
+	timeSeries := FormatOptionTimeSeries
+	model, err := GetQueryModelWithDefaults(backend.DataQuery{JSON: []byte(`{"version":1,"rawQuery":"SELECT 1"}`)}, &QueryDefaults{Format: &timeSeries, MaxRows: 100})
+	if err != nil {
+		t.Fatalf("Error reading query: %s", err.Error())
+	}
+	if model.Format != FormatOptionTimeSeries || model.MaxRows != 100 || model.RawQuery != "SELECT 1" {
+		t.Fatalf("defaults not applied: %+v", model)
+	}
+}
+
+func TestQuerySchema(t *testing.T) {
+	b, err := json.Marshal(QuerySchema())
+	if err != nil {
+		t.Fatalf("Error writing schema: %s", err.Error())
+	}
+	schema := struct {
+		Type                 string                     `json:"type"`
+		AdditionalProperties *bool                      `json:"additionalProperties"`
+		Properties           map[string]json.RawMessage `json:"properties"`
+	}{}
+	if err := json.Unmarshal(b, &schema); err != nil {
+		t.Fatalf("Error reading schema: %s", err.Error())
+	}
+	if schema.Type != "object" || schema.AdditionalProperties == nil || *schema.AdditionalProperties {
+		t.Fatalf("queries should be objects without additional properties: %s", b)
+	}
+	for _, name := range []string{"version", "rawQuery", "refId", "datasource", "nulls", "adhocFilters"} {
+		if _, ok := schema.Properties[name]; !ok {
+			t.Errorf("missing property %s", name)
+		}
+	}
+	for _, name := range []string{"Interval", "TimeRange", "FromAlert"} {
+		if _, ok := schema.Properties[name]; ok {
+			t.Errorf("unexpected property %s", name)
+		}
+	}
+	for name, want := range map[string]string{
+		"fillMode":     `{"enum":["null","previous","value"],"type":"string"}`,
+		"format":       `{"enum":[0,1,2,3,4],"minimum":0,"type":"integer"}`,
+		"adhocFilters": `{"items":{"properties":{"key":{"type":"string"},"operator":{"type":"string"},"value":{"type":"string"}},"type":"object"},"type":"array"}`,
+	} {
+		if got := string(schema.Properties[name]); got != want {
+			t.Errorf("property %s: want %s, got %s", name, want, got)
+		}
+	}
+}
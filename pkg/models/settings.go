@@ -3,9 +3,14 @@ package models
 import (
 	"encoding/json"
 	"fmt"
+	"maps"
+	"path"
+	"slices"
+	"time"
 
 	"github.com/grafana/grafana-aws-sdk/pkg/awsds"
 	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/timestream-datasource/pkg/timestream/validator"
 )
 
 // DatasourceSettings holds basic connection info
@@ -18,6 +23,243 @@ type DatasourceSettings struct {
 	DefaultDatabase string `json:"defaultDatabase,omitempty"`
 	DefaultTable    string `json:"defaultTable,omitempty"`
 	DefaultMeasure  string `json:"defaultMeasure,omitempty"`
+
+	// Validator configures the reasonable query check enforced before execution
+	Validator *validator.Options `json:"validator,omitempty"`
+
+	// ValidatorProfiles are named validator configurations queries may select
+	// with their validatorProfile, e.g. a lenient one for Explore. Queries
+	// without a profile are checked with Validator.
+	ValidatorProfiles map[string]ValidatorProfile `json:"validatorProfiles,omitempty"`
+	// ExploreValidatorProfile is selected by the queries of Explore without a profile
+	ExploreValidatorProfile string `json:"exploreValidatorProfile,omitempty"`
+
+	// RepairTimeFilter adds the time range of the query to SELECTs the validator
+	// rejects for their time filter, instead of rejecting the query
+	RepairTimeFilter bool `json:"repairTimeFilter,omitempty"`
+
+	// ValidatorDryRun evaluates a proposed validator configuration without enforcing it
+	ValidatorDryRun *ValidatorDryRun `json:"validatorDryRun,omitempty"`
+
+	// AlertStateTable receives alert state transitions posted to the alert-state resource
+	AlertStateTable *AlertStateTable `json:"alertStateTable,omitempty"`
+
+	// CompressionThreshold is the resource response size in bytes from which responses are
+	// gzip encoded. Zero uses the default, a negative value disables compression.
+	CompressionThreshold int64 `json:"compressionThreshold,omitempty"`
+
+	// LogScrubbing configures how literals are masked in logged and audited queries
+	LogScrubbing *validator.ScrubOptions `json:"logScrubbing,omitempty"`
+
+	// Audit exports a record of every executed query for compliance retention
+	Audit *AuditSettings `json:"audit,omitempty"`
+
+	// SlowQuerySeconds adds a notice to queries whose median latency exceeds it; zero disables the notice
+	SlowQuerySeconds float64 `json:"slowQuerySeconds,omitempty"`
+
+	// Fallback serves read queries from a replica when the primary keeps failing
+	Fallback *FallbackSettings `json:"fallback,omitempty"`
+
+	// Accounts are the AWS accounts multi-account queries run in
+	Accounts []AccountTarget `json:"accounts,omitempty"`
+
+	// Materialization lets admins turn dashboard queries into scheduled queries
+	// writing pre-aggregated tables
+	Materialization *MaterializationSettings `json:"materialization,omitempty"`
+
+	// QueryDefaults are inherited by queries that don't set the option themselves
+	QueryDefaults *QueryDefaults `json:"queryDefaults,omitempty"`
+
+	// IngestionDelaySeconds shifts time ranges ending now back by the delay, so
+	// the right edge of graphs doesn't dip for data that is not ingested yet
+	IngestionDelaySeconds int `json:"ingestionDelaySeconds,omitempty"`
+
+	// QueryTimeoutSeconds limits the requests of queries without their own timeout,
+	// MaxQueryTimeoutSeconds bounds the timeout queries may set; zero is unlimited
+	QueryTimeoutSeconds    int `json:"queryTimeoutSeconds,omitempty"`
+	MaxQueryTimeoutSeconds int `json:"maxQueryTimeoutSeconds,omitempty"`
+
+	// Lookups map dimension values to friendly names for query enrichment
+	Lookups []LookupSource `json:"lookups,omitempty"`
+
+	// ResultCacheSeconds keeps query responses for this long, so panels of
+	// prefetched dashboards render from the cache; zero disables the cache
+	ResultCacheSeconds int `json:"resultCacheSeconds,omitempty"`
+
+	// QueryBudgetPerHour limits the dashboard queries sent to Timestream, over
+	// budget refreshes are served from the result cache with a notice; zero
+	// disables the budget
+	QueryBudgetPerHour int `json:"queryBudgetPerHour,omitempty"`
+
+	// KeepWarm queries are refreshed in the background, so wallboard dashboards
+	// always render from the result cache. Refreshes spend the query budget.
+	KeepWarm []KeepWarmQuery `json:"keepWarm,omitempty"`
+
+	// SampledMeasureTables ("db.table" or "table") discover their measures from the
+	// distinct measures of the last hour instead of SHOW MEASURES, which times out on
+	// very large tables
+	SampledMeasureTables []string `json:"sampledMeasureTables,omitempty"`
+
+	// AdhocTables ("db.table" or "table") may be read by the ad-hoc filter
+	// lookups of tag keys and values besides the default table
+	AdhocTables []string `json:"adhocTables,omitempty"`
+
+	// DisabledRewrites turns off stages of the query rewrite pipeline by name,
+	// e.g. "adhoc-filters"; macro expansion can't be disabled
+	DisabledRewrites []string `json:"disabledRewrites,omitempty"`
+
+	// StateMappings convert the states of varchar measures to numbers, so state
+	// timelines and alerts work without value mappings in every panel
+	StateMappings []StateMapping `json:"stateMappings,omitempty"`
+}
+
+// ValidatorProfile is a named validator configuration with the organization
+// roles allowed to select it
+type ValidatorProfile struct {
+	Validator *validator.Options `json:"validator,omitempty"`
+	// Roles are the roles, e.g. Editor and Admin, whose queries may select the
+	// profile; empty allows every user
+	Roles []string `json:"roles,omitempty"`
+}
+
+// Allows reports whether queries of users with the role may select the profile
+func (p ValidatorProfile) Allows(role string) bool {
+	return len(p.Roles) == 0 || slices.Contains(p.Roles, role)
+}
+
+// The organization roles of Grafana users
+var orgRoles = []string{"Viewer", "Editor", "Admin"}
+
+// ValidatorOptions returns the validator configuration of the profile, the
+// default one for an empty name
+func (s *DatasourceSettings) ValidatorOptions(profile string) (*validator.Options, error) {
+	if profile == "" {
+		return s.Validator, nil
+	}
+	p, ok := s.ValidatorProfiles[profile]
+	if !ok {
+		return nil, fmt.Errorf("unknown validator profile %q", profile)
+	}
+	return p.Validator, nil
+}
+
+// StateMapping converts the states of a varchar measure to numbers, e.g. online
+// to 1 and offline to 0
+type StateMapping struct {
+	// Measure is the measure_name of single-measure tables or the column of
+	// multi-measure records, a glob pattern like "*_state" matches several
+	Measure string             `json:"measure"`
+	States  map[string]float64 `json:"states"`
+}
+
+// KeepWarmQuery is a panel query the result cache keeps fresh. Interval and
+// MaxDataPoints must match the panel for it to hit the cache.
+type KeepWarmQuery struct {
+	Query json.RawMessage `json:"query"`
+	// Range is the relative time range of the panel, e.g. 6h for now-6h to now
+	Range         string `json:"range"`
+	IntervalMs    int64  `json:"intervalMs,omitempty"`
+	MaxDataPoints int64  `json:"maxDataPoints,omitempty"`
+}
+
+// AuditSettings is the destination of query audit records
+type AuditSettings struct {
+	Bucket string `json:"bucket"`
+	// Prefix is prepended to the object keys, e.g. "grafana/audit/"
+	Prefix string `json:"prefix,omitempty"`
+	// BatchSize and FlushIntervalSeconds bound how long records are buffered; zero uses the defaults
+	BatchSize            int `json:"batchSize,omitempty"`
+	FlushIntervalSeconds int `json:"flushIntervalSeconds,omitempty"`
+}
+
+// FallbackSettings describe the replica used when the primary is unavailable.
+// Unset values are taken from the primary connection.
+type FallbackSettings struct {
+	Region        string `json:"region,omitempty"`
+	AssumeRoleARN string `json:"assumeRoleArn,omitempty"`
+	ExternalID    string `json:"externalId,omitempty"`
+	// FailureThreshold consecutive failures switch to the fallback for CooldownSeconds;
+	// zero uses the defaults
+	FailureThreshold int `json:"failureThreshold,omitempty"`
+	CooldownSeconds  int `json:"cooldownSeconds,omitempty"`
+}
+
+// AccountTarget is a database of another AWS account, or region, multi-account
+// queries run in. Unset values are taken from the primary connection.
+type AccountTarget struct {
+	// Name is the value of the account column of its rows
+	Name          string `json:"name"`
+	AssumeRoleARN string `json:"assumeRoleArn,omitempty"`
+	ExternalID    string `json:"externalId,omitempty"`
+	Region        string `json:"region,omitempty"`
+	// Database replaces $__database in the queries run in the account
+	Database string `json:"database,omitempty"`
+}
+
+// MaterializationSettings are what the scheduled queries of materialized tables
+// run with
+type MaterializationSettings struct {
+	// ExecutionRoleARN is the role the scheduled queries run as, it needs to read
+	// the source and write the materialized tables
+	ExecutionRoleARN string `json:"executionRoleArn"`
+	// TopicARN is the SNS topic notified of the runs of the scheduled queries
+	TopicARN string `json:"topicArn"`
+	// ErrorReportBucket receives the reports of failed runs
+	ErrorReportBucket string `json:"errorReportBucket"`
+	// Database receives the materialized tables of requests without one, the
+	// default database without it
+	Database string `json:"database,omitempty"`
+}
+
+// LookupSource is a small key/value table queries can join their results against
+type LookupSource struct {
+	Name string `json:"name"`
+	// Query is a Timestream query returning the keys in the first and the
+	// values in the second column
+	Query string `json:"query,omitempty"`
+	// Bucket and Key locate a CSV object in S3 with a header row, its
+	// KeyColumn and ValueColumn default to the first two columns
+	Bucket      string `json:"bucket,omitempty"`
+	Key         string `json:"key,omitempty"`
+	Format      string `json:"format,omitempty"`
+	KeyColumn   string `json:"keyColumn,omitempty"`
+	ValueColumn string `json:"valueColumn,omitempty"`
+	// RefreshSeconds is how long the values are reused; zero uses the default
+	RefreshSeconds int `json:"refreshSeconds,omitempty"`
+}
+
+// AlertStateTable is the destination of alert state write-back
+type AlertStateTable struct {
+	Database    string `json:"database"`
+	Table       string `json:"table"`
+	MeasureName string `json:"measureName,omitempty"`
+}
+
+// ValidatorDryRun describes a report-only validator configuration
+type ValidatorDryRun struct {
+	Options validator.Options `json:"options"`
+
+	// StartedAt marks the beginning of the evaluation; zero means when the settings were loaded
+	StartedAt time.Time `json:"startedAt,omitempty"`
+	// Days limits how long the evaluation runs; zero means until it is removed
+	Days int `json:"days,omitempty"`
+}
+
+// Until returns the end of the evaluation window, or a zero time when it is open ended
+func (d *ValidatorDryRun) Until() time.Time {
+	if d.Days <= 0 {
+		return time.Time{}
+	}
+	return d.StartedAt.AddDate(0, 0, d.Days)
+}
+
+// Active reports whether the evaluation window contains t
+func (d *ValidatorDryRun) Active(t time.Time) bool {
+	if t.Before(d.StartedAt) {
+		return false
+	}
+	until := d.Until()
+	return until.IsZero() || t.Before(until)
 }
 
 // Load is copied from grafana-aws-sdk -- json.Unmarshal was not loading the nested properties
@@ -37,6 +279,69 @@ func (s *DatasourceSettings) Load(config backend.DataSourceInstanceSettings) err
 		s.Profile = config.Database // legacy support (only for cloudwatch?)
 	}
 
+	if s.AlertStateTable != nil && s.AlertStateTable.MeasureName == "" {
+		s.AlertStateTable.MeasureName = "alert_state"
+	}
+
+	if s.ValidatorDryRun != nil && s.ValidatorDryRun.StartedAt.IsZero() {
+		s.ValidatorDryRun.StartedAt = time.Now()
+	}
+
+	for _, m := range s.StateMappings {
+		if _, err := path.Match(m.Measure, ""); m.Measure == "" || err != nil {
+			return fmt.Errorf("stateMappings: invalid measure %q", m.Measure)
+		}
+		if len(m.States) == 0 {
+			return fmt.Errorf("stateMappings: %q has no states", m.Measure)
+		}
+	}
+
+	if _, err := s.Validator.Compile(); err != nil {
+		return err
+	}
+	for _, name := range slices.Sorted(maps.Keys(s.ValidatorProfiles)) {
+		p := s.ValidatorProfiles[name]
+		if name == "" {
+			return fmt.Errorf("validatorProfiles: a profile has no name")
+		}
+		if _, err := p.Validator.Compile(); err != nil {
+			return fmt.Errorf("validatorProfiles: %s: %w", name, err)
+		}
+		for _, role := range p.Roles {
+			if !slices.Contains(orgRoles, role) {
+				return fmt.Errorf("validatorProfiles: %s: unknown role %q", name, role)
+			}
+		}
+	}
+	if _, err := s.ValidatorOptions(s.ExploreValidatorProfile); err != nil {
+		return fmt.Errorf("exploreValidatorProfile: %w", err)
+	}
+	names := map[string]bool{}
+	for _, a := range s.Accounts {
+		if a.Name == "" {
+			return fmt.Errorf("accounts: an account has no name")
+		}
+		if names[a.Name] {
+			return fmt.Errorf("accounts: duplicate account %q", a.Name)
+		}
+		names[a.Name] = true
+	}
+	if m := s.Materialization; m != nil {
+		switch {
+		case m.ExecutionRoleARN == "":
+			return fmt.Errorf("materialization: executionRoleArn is required")
+		case m.TopicARN == "":
+			return fmt.Errorf("materialization: topicArn is required")
+		case m.ErrorReportBucket == "":
+			return fmt.Errorf("materialization: errorReportBucket is required")
+		}
+	}
+	if s.ValidatorDryRun != nil {
+		if _, err := s.ValidatorDryRun.Options.Compile(); err != nil {
+			return fmt.Errorf("validatorDryRun: %w", err)
+		}
+	}
+
 	s.AccessKey = config.DecryptedSecureJSONData["accessKey"]
 	s.SecretKey = config.DecryptedSecureJSONData["secretKey"]
 
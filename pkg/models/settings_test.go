@@ -1,9 +1,12 @@
 package models
 
 import (
+	"errors"
 	"testing"
+	"time"
 
 	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/timestream-datasource/pkg/timestream/validator"
 )
 
 func TestReadSettings(t *testing.T) {
@@ -29,3 +32,153 @@ func TestReadSettings(t *testing.T) {
 		t.Fatalf("invalid data points: %s", settings.DefaultDatabase)
 	}
 }
+
+func TestReadSettings_ValidatorDryRun(t *testing.T) {
+	s := backend.DataSourceInstanceSettings{
+		JSONData: []byte(`{
+			"validator": {},
+			"validatorDryRun": {"options": {"allowMissingMeasure": true}, "days": 14}
+		  }`),
+	}
+
+	settings := DatasourceSettings{}
+	if err := settings.Load(s); err != nil {
+		t.Fatal("should not error")
+	}
+	if settings.ValidatorDryRun == nil || settings.ValidatorDryRun.StartedAt.IsZero() {
+		t.Fatalf("expected dry-run to start when settings are loaded")
+	}
+	if !settings.ValidatorDryRun.Options.AllowMissingMeasure {
+		t.Fatalf("dry-run options not loaded")
+	}
+	if got := settings.ValidatorDryRun.Until().Sub(settings.ValidatorDryRun.StartedAt); got != 14*24*time.Hour {
+		t.Fatalf("invalid dry-run window: %s", got)
+	}
+}
+
+func TestReadSettings_InvalidValidator(t *testing.T) {
+	s := backend.DataSourceInstanceSettings{
+		JSONData: []byte(`{"validator": {"tenantDimension": "ds_account", "tenantTables": ["metrics_[0-9"]}}`),
+	}
+
+	settings := DatasourceSettings{}
+	err := settings.Load(s)
+	var configErr *validator.ConfigError
+	if !errors.As(err, &configErr) || configErr.Field != "tenantTables" {
+		t.Fatalf("expected tenantTables configuration error, got %v", err)
+	}
+}
+
+func TestReadSettings_StateMappings(t *testing.T) {
+	s := backend.DataSourceInstanceSettings{
+		JSONData: []byte(`{"stateMappings": [{"measure": "*_state", "states": {"online": 1, "offline": 0}}]}`),
+	}
+	settings := DatasourceSettings{}
+	if err := settings.Load(s); err != nil {
+		t.Fatalf("should not error: %v", err)
+	}
+	if got := settings.StateMappings[0].States["online"]; got != 1 {
+		t.Fatalf("invalid state value: %v", got)
+	}
+
+	for _, jsonData := range []string{
+		`{"stateMappings": [{"measure": "", "states": {"online": 1}}]}`,
+		`{"stateMappings": [{"measure": "state[", "states": {"online": 1}}]}`,
+		`{"stateMappings": [{"measure": "state"}]}`,
+	} {
+		s.JSONData = []byte(jsonData)
+		if err := (&DatasourceSettings{}).Load(s); err == nil {
+			t.Errorf("expected an error for %s", jsonData)
+		}
+	}
+}
+
+func TestReadSettings_ValidatorProfiles(t *testing.T) {
+	s := backend.DataSourceInstanceSettings{
+		JSONData: []byte(`{
+			"validatorProfiles": {
+				"exploratory": {"validator": {"ruleLevels": {"measure": "warn"}}, "roles": ["Editor", "Admin"]},
+				"strict": {}
+			},
+			"exploreValidatorProfile": "exploratory"
+		}`),
+	}
+	settings := DatasourceSettings{}
+	if err := settings.Load(s); err != nil {
+		t.Fatalf("should not error: %v", err)
+	}
+	p := settings.ValidatorProfiles["exploratory"]
+	if !p.Allows("Editor") || p.Allows("Viewer") || !settings.ValidatorProfiles["strict"].Allows("Viewer") {
+		t.Errorf("unexpected roles %v", p.Roles)
+	}
+	opts, err := settings.ValidatorOptions("exploratory")
+	if err != nil || opts.Level(validator.RuleMeasure) != validator.LevelWarn {
+		t.Errorf("unexpected options %+v %v", opts, err)
+	}
+	if _, err := settings.ValidatorOptions("lenient"); err == nil {
+		t.Errorf("expected an error of an unknown profile")
+	}
+
+	for _, jsonData := range []string{
+		`{"validatorProfiles": {"x": {"validator": {"parser": "yacc"}}}}`,
+		`{"validatorProfiles": {"x": {"roles": ["Owner"]}}}`,
+		`{"validatorProfiles": {"": {}}}`,
+		`{"exploreValidatorProfile": "missing"}`,
+	} {
+		s.JSONData = []byte(jsonData)
+		if err := (&DatasourceSettings{}).Load(s); err == nil {
+			t.Errorf("expected an error for %s", jsonData)
+		}
+	}
+}
+
+func TestReadSettings_Accounts(t *testing.T) {
+	s := backend.DataSourceInstanceSettings{
+		JSONData: []byte(`{"accounts": [
+			{"name": "prod-eu", "assumeRoleArn": "arn:aws:iam::111111111111:role/grafana", "region": "eu-west-1", "database": "fleet"},
+			{"name": "prod-us", "assumeRoleArn": "arn:aws:iam::222222222222:role/grafana"}
+		]}`),
+	}
+	settings := DatasourceSettings{}
+	if err := settings.Load(s); err != nil {
+		t.Fatalf("should not error: %v", err)
+	}
+	want := AccountTarget{Name: "prod-eu", AssumeRoleARN: "arn:aws:iam::111111111111:role/grafana", Region: "eu-west-1", Database: "fleet"}
+	if len(settings.Accounts) != 2 || settings.Accounts[0] != want {
+		t.Errorf("unexpected accounts %+v", settings.Accounts)
+	}
+
+	for _, jsonData := range []string{
+		`{"accounts": [{"region": "eu-west-1"}]}`,
+		`{"accounts": [{"name": "a"}, {"name": "a"}]}`,
+	} {
+		s.JSONData = []byte(jsonData)
+		if err := (&DatasourceSettings{}).Load(s); err == nil {
+			t.Errorf("expected an error for %s", jsonData)
+		}
+	}
+}
+
+func TestReadSettings_Materialization(t *testing.T) {
+	s := backend.DataSourceInstanceSettings{
+		JSONData: []byte(`{"materialization": {"executionRoleArn": "arn:aws:iam::111111111111:role/scheduled", "topicArn": "arn:aws:sns:eu-west-1:111111111111:runs", "errorReportBucket": "reports"}}`),
+	}
+	settings := DatasourceSettings{}
+	if err := settings.Load(s); err != nil {
+		t.Fatalf("should not error: %v", err)
+	}
+	if settings.Materialization == nil || settings.Materialization.ErrorReportBucket != "reports" {
+		t.Errorf("unexpected materialization %+v", settings.Materialization)
+	}
+
+	for _, jsonData := range []string{
+		`{"materialization": {}}`,
+		`{"materialization": {"executionRoleArn": "arn:aws:iam::111111111111:role/scheduled", "errorReportBucket": "reports"}}`,
+		`{"materialization": {"executionRoleArn": "arn:aws:iam::111111111111:role/scheduled", "topicArn": "arn:aws:sns:eu-west-1:111111111111:runs"}}`,
+	} {
+		s.JSONData = []byte(jsonData)
+		if err := (&DatasourceSettings{}).Load(s); err == nil {
+			t.Errorf("expected an error for %s", jsonData)
+		}
+	}
+}
@@ -0,0 +1,186 @@
+package timestream
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/service/timestreamquery"
+	"github.com/grafana/grafana-aws-sdk/pkg/awsauth"
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/grafana/grafana-plugin-sdk-go/experimental/errorsource"
+	"github.com/grafana/timestream-datasource/pkg/models"
+)
+
+const (
+	// account queries running at the same time
+	maxAccountConcurrency = 4
+	// columns, or labels of time series, naming where rows were read. The
+	// prefix keeps them apart from dimensions like region.
+	accountColumn = "__account"
+	regionColumn  = "__account_region"
+)
+
+// accountClient queries an account of multi-account queries
+type accountClient struct {
+	target models.AccountTarget
+	// region is the one of the target or else of the datasource
+	region string
+	client QueryClient
+}
+
+// newAccountClients creates a client per account of the settings, assuming its
+// role with the credentials of the datasource
+func newAccountClients(ctx context.Context, settings models.DatasourceSettings, region string, httpClient *http.Client) ([]accountClient, error) {
+	var accounts []accountClient
+	for _, target := range settings.Accounts {
+		accountRegion := valueOrDefault(target.Region, region)
+		cfg, err := awsauth.NewConfigProvider().GetConfig(ctx, awsauth.Settings{
+			LegacyAuthType:     settings.AuthType,
+			AccessKey:          settings.AccessKey,
+			SecretKey:          settings.SecretKey,
+			Region:             accountRegion,
+			CredentialsProfile: settings.Profile,
+			AssumeRoleARN:      valueOrDefault(target.AssumeRoleARN, settings.AssumeRoleARN),
+			ExternalID:         valueOrDefault(target.ExternalID, settings.ExternalID),
+			UserAgent:          "Timestream",
+			HTTPClient:         httpClient,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("account %s: %w", target.Name, err)
+		}
+		accounts = append(accounts, accountClient{target: target, region: accountRegion, client: timestreamquery.NewFromConfig(cfg)})
+	}
+	return accounts, nil
+}
+
+type accountClientKey struct{}
+
+// withAccountClient makes the queries run with ctx use the client of an account
+func withAccountClient(ctx context.Context, client QueryClient) context.Context {
+	return context.WithValue(ctx, accountClientKey{}, client)
+}
+
+// queryClient returns the client of the account a multi-account query runs in,
+// the one of the datasource otherwise
+func (ds *timestreamDS) queryClient(ctx context.Context) QueryClient {
+	if client, ok := ctx.Value(accountClientKey{}).(QueryClient); ok {
+		return client
+	}
+	return ds.Client
+}
+
+// executeMultiAccount runs the query in each selected account, a few at a time,
+// and concatenates the frames with the same fields. The rows of tables get
+// account and region columns, time series are labeled with them instead.
+// Accounts whose query fails are reported as a warning.
+func (ds *timestreamDS) executeMultiAccount(ctx context.Context, query models.QueryModel) backend.DataResponse {
+	accounts, err := ds.selectAccounts(query.Accounts)
+	if err != nil {
+		return errorsource.Response(errorsource.DownstreamError(err, false))
+	}
+
+	query.QueryType = ""
+	query.WaitForResult = true
+	responses := make([]backend.DataResponse, len(accounts))
+	sem := make(chan struct{}, maxAccountConcurrency)
+	var wg sync.WaitGroup
+	for i, account := range accounts {
+		wg.Add(1)
+		go func(i int, account accountClient) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			sub := query
+			if account.target.Database != "" {
+				sub.Database = account.target.Database
+			}
+			responses[i] = ds.executeQuery(withAccountClient(ctx, account.client), sub)
+			for _, frame := range responses[i].Frames {
+				labelAccount(frame, account, query.Format)
+			}
+		}(i, account)
+	}
+	wg.Wait()
+
+	merged, failed := concatResponses(responses)
+	if merged == nil {
+		return responses[0]
+	}
+	if len(failed) > 0 {
+		names := make([]string, len(failed))
+		for i, f := range failed {
+			names[i] = accounts[f].target.Name
+		}
+		merged.Frames[0].AppendNotices(data.Notice{
+			Severity: data.NoticeSeverityWarning,
+			Text:     fmt.Sprintf("%d of %d accounts failed, results are incomplete: %s: %s", len(failed), len(responses), strings.Join(names, ", "), responses[failed[0]].Error.Error()),
+		})
+	}
+	return *merged
+}
+
+// queryCost is the number of queries the query runs, one in each account of
+// a multi-account query
+func (ds *timestreamDS) queryCost(query models.QueryModel) int {
+	if query.QueryType != models.QueryTypeMultiAccount {
+		return 1
+	}
+	accounts, err := ds.selectAccounts(query.Accounts)
+	if err != nil {
+		return 1
+	}
+	return len(accounts)
+}
+
+// selectAccounts returns the accounts named, all of them for no names
+func (ds *timestreamDS) selectAccounts(names []string) ([]accountClient, error) {
+	if len(ds.accounts) == 0 {
+		return nil, fmt.Errorf("multi-account queries need the accounts of the datasource settings")
+	}
+	if len(names) == 0 {
+		return ds.accounts, nil
+	}
+	var selected []accountClient
+	for _, name := range names {
+		i := slices.IndexFunc(ds.accounts, func(a accountClient) bool { return a.target.Name == name })
+		if i == -1 {
+			return nil, fmt.Errorf("unknown account %q", name)
+		}
+		selected = append(selected, ds.accounts[i])
+	}
+	return selected, nil
+}
+
+// labelAccount adds the account and region columns to the frame, or labels the
+// value fields of time series with them
+func labelAccount(frame *data.Frame, account accountClient, format models.FormatQueryOption) {
+	if format == models.FormatOptionTimeSeries {
+		for _, field := range frame.Fields {
+			if field.Type().Time() {
+				continue
+			}
+			if field.Labels == nil {
+				field.Labels = data.Labels{}
+			}
+			field.Labels[accountColumn] = account.target.Name
+			field.Labels[regionColumn] = account.region
+		}
+		return
+	}
+	rows := frame.Rows()
+	accountValues := make([]string, rows)
+	regionValues := make([]string, rows)
+	for i := range rows {
+		accountValues[i] = account.target.Name
+		regionValues[i] = account.region
+	}
+	frame.Fields = append([]*data.Field{
+		data.NewField(accountColumn, nil, accountValues),
+		data.NewField(regionColumn, nil, regionValues),
+	}, frame.Fields...)
+}
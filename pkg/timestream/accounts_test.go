@@ -0,0 +1,95 @@
+package timestream
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/timestreamquery"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/grafana/timestream-datasource/pkg/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExecuteMultiAccount(t *testing.T) {
+	eu := &fakeClient{output: deviceValues([2]string{"a", "1"}, [2]string{"b", "2"})}
+	us := &fakeClient{output: deviceValues([2]string{"c", "3"})}
+	apac := &fakeClient{err: errors.New("access denied")}
+	primary := &fakeClient{output: &timestreamquery.QueryOutput{}}
+	ds := &timestreamDS{Client: primary, accounts: []accountClient{
+		{target: models.AccountTarget{Name: "prod-eu", Database: "fleet_eu"}, region: "eu-west-1", client: eu},
+		{target: models.AccountTarget{Name: "prod-us"}, region: "us-east-1", client: us},
+		{target: models.AccountTarget{Name: "prod-apac"}, region: "ap-southeast-2", client: apac},
+	}}
+	query := models.QueryModel{
+		QueryType: models.QueryTypeMultiAccount,
+		Database:  `"fleet"`,
+		RawQuery:  "SELECT device, value FROM $__database.kpis WHERE time > ago(1h) AND measure_name = 'kpi'",
+	}
+
+	dr := ds.ExecuteQuery(context.Background(), query)
+	require.NoError(t, dr.Error)
+	assert.Empty(t, primary.calls.runQuery)
+	require.Len(t, eu.calls.runQuery, 1)
+	assert.Contains(t, *eu.calls.runQuery[0].QueryString, "fleet_eu.kpis")
+	require.Len(t, us.calls.runQuery, 1)
+	assert.Contains(t, *us.calls.runQuery[0].QueryString, `"fleet".kpis`)
+
+	require.Len(t, dr.Frames, 1)
+	frame := dr.Frames[0]
+	require.Equal(t, 4, len(frame.Fields))
+	assert.Equal(t, []string{"prod-eu", "prod-eu", "prod-us"}, stringValues(frame.Fields[0]))
+	assert.Equal(t, []string{"eu-west-1", "eu-west-1", "us-east-1"}, stringValues(frame.Fields[1]))
+	require.Len(t, frame.Meta.Notices, 1)
+	assert.Contains(t, frame.Meta.Notices[0].Text, "1 of 3 accounts failed, results are incomplete: prod-apac: ")
+
+	query.Accounts = []string{"prod-us"}
+	dr = ds.ExecuteQuery(context.Background(), query)
+	require.NoError(t, dr.Error)
+	assert.Equal(t, []string{"prod-us"}, stringValues(dr.Frames[0].Fields[0]))
+
+	query.Accounts = []string{"prod-ca"}
+	dr = ds.ExecuteQuery(context.Background(), query)
+	require.ErrorContains(t, dr.Error, `unknown account "prod-ca"`)
+
+	ds.accounts = nil
+	query.Accounts = nil
+	dr = ds.ExecuteQuery(context.Background(), query)
+	require.Error(t, dr.Error)
+}
+
+func TestLabelAccount(t *testing.T) {
+	account := accountClient{target: models.AccountTarget{Name: "prod-eu"}, region: "eu-west-1"}
+	frame := data.NewFrame("", data.NewField("time", nil, []time.Time{}), data.NewField("value", data.Labels{"device": "a", "region": "eu-west-1a"}, []float64{}))
+	labelAccount(frame, account, models.FormatOptionTimeSeries)
+	require.Len(t, frame.Fields, 2)
+	assert.Nil(t, frame.Fields[0].Labels)
+	assert.Equal(t, data.Labels{"device": "a", "region": "eu-west-1a", "__account": "prod-eu", "__account_region": "eu-west-1"}, frame.Fields[1].Labels)
+
+	frame = data.NewFrame("", data.NewField("region", nil, []string{"eu-west-1a"}))
+	labelAccount(frame, account, models.FormatOptionTable)
+	require.Len(t, frame.Fields, 3)
+	assert.Equal(t, []string{"__account", "__account_region", "region"}, []string{frame.Fields[0].Name, frame.Fields[1].Name, frame.Fields[2].Name})
+}
+
+func stringValues(field *data.Field) []string {
+	values := make([]string, field.Len())
+	for i := range values {
+		values[i] = field.At(i).(string)
+	}
+	return values
+}
+
+func TestQueryCost(t *testing.T) {
+	ds := &timestreamDS{accounts: []accountClient{
+		{target: models.AccountTarget{Name: "prod-eu"}},
+		{target: models.AccountTarget{Name: "prod-us"}},
+		{target: models.AccountTarget{Name: "prod-apac"}},
+	}}
+	assert.Equal(t, 1, ds.queryCost(models.QueryModel{}))
+	assert.Equal(t, 3, ds.queryCost(models.QueryModel{QueryType: models.QueryTypeMultiAccount}))
+	assert.Equal(t, 1, ds.queryCost(models.QueryModel{QueryType: models.QueryTypeMultiAccount, Accounts: []string{"prod-us"}}))
+	assert.Equal(t, 1, ds.queryCost(models.QueryModel{QueryType: models.QueryTypeMultiAccount, Accounts: []string{"prod-ca"}}))
+}
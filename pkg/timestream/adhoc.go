@@ -0,0 +1,59 @@
+package timestream
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/grafana/timestream-datasource/pkg/models"
+	"github.com/grafana/timestream-datasource/pkg/timestream/validator"
+)
+
+// adhocPredicate translates ad-hoc filters to a WHERE predicate, filters joined with AND
+func adhocPredicate(filters []models.AdhocFilter) (string, error) {
+	predicates := make([]string, 0, len(filters))
+	for _, f := range filters {
+		if f.Key == "" {
+			return "", fmt.Errorf("ad-hoc filter without a key")
+		}
+		column, value := quoteIdentifier(f.Key), quoteLiteral(f.Value)
+		if f.Key == "measure_name" {
+			// unquoted, so the validator counts it as the measure filter
+			column = f.Key
+		}
+		switch f.Operator {
+		case "=", "!=", "<", ">":
+			predicates = append(predicates, fmt.Sprintf("%s %s %s", column, f.Operator, value))
+		case "=~":
+			predicates = append(predicates, fmt.Sprintf("regexp_like(%s, %s)", column, value))
+		case "!~":
+			predicates = append(predicates, fmt.Sprintf("NOT regexp_like(%s, %s)", column, value))
+		default:
+			return "", fmt.Errorf("ad-hoc filter on %s has unsupported operator %q", f.Key, f.Operator)
+		}
+	}
+	return strings.Join(predicates, " AND "), nil
+}
+
+// applyAdhocFilters adds the ad-hoc filters of the query to every SELECT reading
+// the table of the query, or the default table of the datasource
+func applyAdhocFilters(sql string, model models.QueryModel, settings models.DatasourceSettings) (string, error) {
+	if len(model.AdhocFilters) == 0 {
+		return sql, nil
+	}
+	table := valueOrDefault(model.Table, settings.DefaultTable)
+	if table == "" {
+		return sql, nil
+	}
+	if database := valueOrDefault(model.Database, settings.DefaultDatabase); database != "" {
+		table = database + "." + table
+	}
+	predicate, err := adhocPredicate(model.AdhocFilters)
+	if err != nil {
+		return sql, err
+	}
+	sql, _, err = validator.InjectPredicate(sql, table, predicate)
+	if err != nil {
+		return sql, fmt.Errorf("applying ad-hoc filters: %w", err)
+	}
+	return sql, nil
+}
@@ -0,0 +1,45 @@
+package timestream
+
+import (
+	"testing"
+
+	"github.com/grafana/timestream-datasource/pkg/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAdhocPredicate(t *testing.T) {
+	predicate, err := adhocPredicate([]models.AdhocFilter{
+		{Key: "site", Operator: "=", Value: "O'Hare"},
+		{Key: "device", Operator: "!=", Value: "d1"},
+		{Key: "region", Operator: "=~", Value: "eu-.*"},
+		{Key: "host", Operator: "!~", Value: "test"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, `"site" = 'O''Hare' AND "device" != 'd1' AND regexp_like("region", 'eu-.*') AND NOT regexp_like("host", 'test')`, predicate)
+
+	_, err = adhocPredicate([]models.AdhocFilter{{Key: "site", Operator: "LIKE", Value: "x"}})
+	assert.ErrorContains(t, err, "unsupported operator")
+	_, err = adhocPredicate([]models.AdhocFilter{{Operator: "=", Value: "x"}})
+	assert.Error(t, err)
+}
+
+func TestInterpolate_AdhocFilters(t *testing.T) {
+	settings := models.DatasourceSettings{DefaultDatabase: "db", DefaultTable: "tbl"}
+	query := models.QueryModel{
+		RawQuery:     "SELECT * FROM $__database.$__table WHERE time > ago(1h) OR measure_name = 'cpu'",
+		AdhocFilters: []models.AdhocFilter{{Key: "site", Operator: "=", Value: `x"`}},
+	}
+	sql, err := Interpolate(query, settings)
+	require.NoError(t, err)
+	assert.Equal(t, `SELECT * FROM db.tbl WHERE (time > ago(1h) OR measure_name = 'cpu') AND "site" = 'x"'`, sql)
+
+	query.RawQuery = "SELECT * FROM db.other WHERE time > ago(1h)"
+	sql, err = Interpolate(query, settings)
+	require.NoError(t, err)
+	assert.Equal(t, query.RawQuery, sql)
+
+	query.AdhocFilters[0].Operator = "<>"
+	_, err = Interpolate(query, settings)
+	assert.Error(t, err)
+}
@@ -0,0 +1,88 @@
+package timestream
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/timestreamwrite"
+	timestreamwritetypes "github.com/aws/aws-sdk-go-v2/service/timestreamwrite/types"
+	"github.com/grafana/timestream-datasource/pkg/models"
+)
+
+// WriteClient is the subset of the Timestream write API used for alert state write-back
+// and table retention lookups
+type WriteClient interface {
+	WriteRecords(context.Context, *timestreamwrite.WriteRecordsInput, ...func(*timestreamwrite.Options)) (*timestreamwrite.WriteRecordsOutput, error)
+	DescribeTable(context.Context, *timestreamwrite.DescribeTableInput, ...func(*timestreamwrite.Options)) (*timestreamwrite.DescribeTableOutput, error)
+}
+
+// Timestream accepts at most 100 records per WriteRecords call
+const maxRecordsPerWrite = 100
+
+// alertStateRecords converts alert notifications into one record per state transition.
+// Labels become dimensions, the alert status becomes the measure value.
+func alertStateRecords(req models.AlertStateRequest, measureName string) []timestreamwritetypes.Record {
+	records := []timestreamwritetypes.Record{}
+	for _, alert := range req.Alerts {
+		at := alert.StartsAt
+		if alert.Status == "resolved" && !alert.EndsAt.IsZero() {
+			at = alert.EndsAt
+		}
+		if at.IsZero() || alert.Status == "" {
+			continue
+		}
+
+		keys := make([]string, 0, len(alert.Labels))
+		for k := range alert.Labels {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		dimensions := []timestreamwritetypes.Dimension{}
+		for _, k := range keys {
+			// Timestream rejects empty dimension values
+			if alert.Labels[k] == "" {
+				continue
+			}
+			dimensions = append(dimensions, timestreamwritetypes.Dimension{
+				Name:  aws.String(k),
+				Value: aws.String(alert.Labels[k]),
+			})
+		}
+		if alert.Fingerprint != "" {
+			dimensions = append(dimensions, timestreamwritetypes.Dimension{
+				Name:  aws.String("fingerprint"),
+				Value: aws.String(alert.Fingerprint),
+			})
+		}
+
+		records = append(records, timestreamwritetypes.Record{
+			Dimensions:       dimensions,
+			MeasureName:      aws.String(measureName),
+			MeasureValue:     aws.String(alert.Status),
+			MeasureValueType: timestreamwritetypes.MeasureValueTypeVarchar,
+			Time:             aws.String(strconv.FormatInt(at.UnixMilli(), 10)),
+			TimeUnit:         timestreamwritetypes.TimeUnitMilliseconds,
+		})
+	}
+	return records
+}
+
+// writeAlertStates stores the alert state transitions in the configured table
+func writeAlertStates(ctx context.Context, client WriteClient, table models.AlertStateTable, req models.AlertStateRequest) (int, error) {
+	records := alertStateRecords(req, table.MeasureName)
+	for start := 0; start < len(records); start += maxRecordsPerWrite {
+		end := min(start+maxRecordsPerWrite, len(records))
+		_, err := client.WriteRecords(ctx, &timestreamwrite.WriteRecordsInput{
+			DatabaseName: aws.String(table.Database),
+			TableName:    aws.String(table.Table),
+			Records:      records[start:end],
+		})
+		if err != nil {
+			return start, fmt.Errorf("error writing alert states: %w", err)
+		}
+	}
+	return len(records), nil
+}
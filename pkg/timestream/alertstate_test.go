@@ -0,0 +1,61 @@
+package timestream
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/timestreamwrite"
+	timestreamwritetypes "github.com/aws/aws-sdk-go-v2/service/timestreamwrite/types"
+	"github.com/grafana/timestream-datasource/pkg/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeWriter struct {
+	calls []*timestreamwrite.WriteRecordsInput
+	table *timestreamwritetypes.Table
+}
+
+func (f *fakeWriter) WriteRecords(_ context.Context, input *timestreamwrite.WriteRecordsInput, _ ...func(*timestreamwrite.Options)) (*timestreamwrite.WriteRecordsOutput, error) {
+	f.calls = append(f.calls, input)
+	return &timestreamwrite.WriteRecordsOutput{}, nil
+}
+
+func (f *fakeWriter) DescribeTable(context.Context, *timestreamwrite.DescribeTableInput, ...func(*timestreamwrite.Options)) (*timestreamwrite.DescribeTableOutput, error) {
+	return &timestreamwrite.DescribeTableOutput{Table: f.table}, nil
+}
+
+func TestAlertStateRecords(t *testing.T) {
+	start := time.UnixMilli(1700000000000)
+	end := time.UnixMilli(1700000060000)
+	records := alertStateRecords(models.AlertStateRequest{Alerts: []models.AlertState{
+		{Status: "firing", StartsAt: start, Labels: map[string]string{"alertname": "cpu", "device": "d1", "empty": ""}, Fingerprint: "abc"},
+		{Status: "resolved", StartsAt: start, EndsAt: end, Labels: map[string]string{"alertname": "cpu"}},
+		{Status: "firing"},
+	}}, "alert_state")
+
+	require.Len(t, records, 2)
+	assert.Equal(t, "firing", *records[0].MeasureValue)
+	assert.Equal(t, "1700000000000", *records[0].Time)
+	require.Len(t, records[0].Dimensions, 3)
+	assert.Equal(t, "alertname", *records[0].Dimensions[0].Name)
+	assert.Equal(t, "fingerprint", *records[0].Dimensions[2].Name)
+	assert.Equal(t, "resolved", *records[1].MeasureValue)
+	assert.Equal(t, "1700000060000", *records[1].Time)
+}
+
+func TestWriteAlertStates_Batches(t *testing.T) {
+	req := models.AlertStateRequest{}
+	for i := 0; i < 150; i++ {
+		req.Alerts = append(req.Alerts, models.AlertState{Status: "firing", StartsAt: time.UnixMilli(int64(i + 1))})
+	}
+	writer := &fakeWriter{}
+	written, err := writeAlertStates(context.Background(), writer, models.AlertStateTable{Database: "db", Table: "alerts", MeasureName: "alert_state"}, req)
+	require.NoError(t, err)
+	assert.Equal(t, 150, written)
+	require.Len(t, writer.calls, 2)
+	assert.Len(t, writer.calls[0].Records, 100)
+	assert.Len(t, writer.calls[1].Records, 50)
+	assert.Equal(t, "alerts", *writer.calls[0].TableName)
+}
@@ -0,0 +1,208 @@
+package timestream
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/timestream-datasource/pkg/models"
+	"github.com/grafana/timestream-datasource/pkg/timestream/validator"
+)
+
+// AuditRecord describes a single executed query
+type AuditRecord struct {
+	Time          time.Time `json:"time"`
+	User          string    `json:"user,omitempty"`
+	OrgID         int64     `json:"orgId,omitempty"`
+	DatasourceUID string    `json:"datasourceUid,omitempty"`
+	RefID         string    `json:"refId,omitempty"`
+	Fingerprint   string    `json:"fingerprint"`
+	Query         string    `json:"query,omitempty"`
+	QueryID       string    `json:"queryId,omitempty"`
+	BytesScanned  int64     `json:"bytesScanned,omitempty"`
+	BytesMetered  int64     `json:"bytesMetered,omitempty"`
+	Status        string    `json:"status"`
+	Error         string    `json:"error,omitempty"`
+	// Directives are the comments of the query relaxing validator rules, with
+	// the reasons given for them
+	Directives []validator.Directive `json:"directives,omitempty"`
+}
+
+// AuditSink stores batches of audit records
+type AuditSink interface {
+	WriteAudit(ctx context.Context, records []AuditRecord) error
+}
+
+// S3Client is the subset of the S3 API used by the plugin
+type S3Client interface {
+	PutObject(context.Context, *s3.PutObjectInput, ...func(*s3.Options)) (*s3.PutObjectOutput, error)
+	GetObject(context.Context, *s3.GetObjectInput, ...func(*s3.Options)) (*s3.GetObjectOutput, error)
+	HeadObject(context.Context, *s3.HeadObjectInput, ...func(*s3.Options)) (*s3.HeadObjectOutput, error)
+}
+
+// s3AuditSink writes every batch as a newline delimited JSON object
+type s3AuditSink struct {
+	client S3Client
+	bucket string
+	prefix string
+}
+
+func (s *s3AuditSink) WriteAudit(ctx context.Context, records []AuditRecord) error {
+	var body bytes.Buffer
+	enc := json.NewEncoder(&body)
+	for _, r := range records {
+		if err := enc.Encode(r); err != nil {
+			return err
+		}
+	}
+	now := time.Now().UTC()
+	key := fmt.Sprintf("%s%s/%d.jsonl", s.prefix, now.Format("2006/01/02"), now.UnixNano())
+	_, err := s.client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:      aws.String(s.bucket),
+		Key:         aws.String(key),
+		Body:        bytes.NewReader(body.Bytes()),
+		ContentType: aws.String("application/x-ndjson"),
+	})
+	return err
+}
+
+// Defaults for batching audit records
+const (
+	defaultAuditBatchSize     = 500
+	defaultAuditFlushInterval = time.Minute
+)
+
+// auditLogger batches records and flushes them to the sink when the batch is full
+// or the flush interval elapses. A nil logger ignores every record.
+type auditLogger struct {
+	sink      AuditSink
+	batchSize int
+
+	mu      sync.Mutex
+	pending []AuditRecord
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+func newAuditLogger(sink AuditSink, batchSize int, interval time.Duration) *auditLogger {
+	if batchSize <= 0 {
+		batchSize = defaultAuditBatchSize
+	}
+	if interval <= 0 {
+		interval = defaultAuditFlushInterval
+	}
+	a := &auditLogger{
+		sink:      sink,
+		batchSize: batchSize,
+		stop:      make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+	go a.run(interval)
+	return a
+}
+
+func (a *auditLogger) run(interval time.Duration) {
+	defer close(a.done)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			a.flush()
+		case <-a.stop:
+			a.flush()
+			return
+		}
+	}
+}
+
+func (a *auditLogger) record(r AuditRecord) {
+	if a == nil {
+		return
+	}
+	a.mu.Lock()
+	a.pending = append(a.pending, r)
+	full := len(a.pending) >= a.batchSize
+	a.mu.Unlock()
+	if full {
+		go a.flush()
+	}
+}
+
+func (a *auditLogger) flush() {
+	a.mu.Lock()
+	batch := a.pending
+	a.pending = nil
+	a.mu.Unlock()
+	if len(batch) == 0 {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := a.sink.WriteAudit(ctx, batch); err != nil {
+		backend.Logger.Error("failed to write audit records", "records", len(batch), "error", err.Error())
+	}
+}
+
+// close flushes the pending records and stops the background flushing
+func (a *auditLogger) close() {
+	if a == nil {
+		return
+	}
+	close(a.stop)
+	<-a.done
+}
+
+// queryFingerprint identifies a query independent of formatting, literals and the
+// dashboard time range
+func queryFingerprint(rawQuery string) string {
+	return validator.Fingerprint(rawQuery)
+}
+
+// auditQuery records a query run outside of QueryData, e.g. by a resource, for
+// the user of the plugin context of ctx
+func (ds *timestreamDS) auditQuery(ctx context.Context, refID string, query models.QueryModel, dr backend.DataResponse) {
+	rules, _ := ds.Settings.ValidatorOptions(query.ValidatorProfile)
+	ds.audit.record(auditRecord(backend.PluginConfigFromContext(ctx), refID, query, dr, ds.Scrubber, rules))
+}
+
+// auditRecord summarizes an executed query, the SQL is scrubbed before it is
+// stored. The directives honored by the validator are kept with their reasons.
+func auditRecord(pCtx backend.PluginContext, refID string, query models.QueryModel, dr backend.DataResponse, scrubber Scrubber, rules *validator.Options) AuditRecord {
+	r := AuditRecord{
+		Time:        time.Now().UTC(),
+		OrgID:       pCtx.OrgID,
+		RefID:       refID,
+		Fingerprint: queryFingerprint(query.RawQuery),
+		Query:       scrubSQL(scrubber, query.RawQuery),
+		Status:      "ok",
+		Directives:  rules.Waivers(query.RawQuery),
+	}
+	if pCtx.User != nil {
+		r.User = pCtx.User.Login
+	}
+	if pCtx.DataSourceInstanceSettings != nil {
+		r.DatasourceUID = pCtx.DataSourceInstanceSettings.UID
+	}
+	if dr.Error != nil {
+		r.Status = "error"
+		r.Error = dr.Error.Error()
+	}
+	if len(dr.Frames) > 0 && dr.Frames[0].Meta != nil {
+		if meta, ok := dr.Frames[0].Meta.Custom.(*models.TimestreamCustomMeta); ok {
+			r.QueryID = meta.QueryID
+			if meta.Status != nil {
+				r.BytesScanned = meta.Status.CumulativeBytesScanned
+				r.BytesMetered = meta.Status.CumulativeBytesMetered
+			}
+		}
+	}
+	return r
+}
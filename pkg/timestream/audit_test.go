@@ -0,0 +1,169 @@
+package timestream
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	timestreamquerytypes "github.com/aws/aws-sdk-go-v2/service/timestreamquery/types"
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/grafana/timestream-datasource/pkg/models"
+	"github.com/grafana/timestream-datasource/pkg/timestream/validator"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeAuditSink struct {
+	mu      sync.Mutex
+	batches [][]AuditRecord
+}
+
+func (f *fakeAuditSink) WriteAudit(_ context.Context, records []AuditRecord) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.batches = append(f.batches, records)
+	return nil
+}
+
+func (f *fakeAuditSink) count() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	n := 0
+	for _, b := range f.batches {
+		n += len(b)
+	}
+	return n
+}
+
+type fakeS3 struct {
+	inputs []*s3.PutObjectInput
+	bodies []string
+
+	// objects and etags are served by GetObject and HeadObject
+	objects map[string]string
+	etags   map[string]string
+	gets    int
+}
+
+func (f *fakeS3) PutObject(_ context.Context, input *s3.PutObjectInput, _ ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
+	body, err := io.ReadAll(input.Body)
+	if err != nil {
+		return nil, err
+	}
+	f.inputs = append(f.inputs, input)
+	f.bodies = append(f.bodies, string(body))
+	return &s3.PutObjectOutput{}, nil
+}
+
+func (f *fakeS3) GetObject(_ context.Context, input *s3.GetObjectInput, _ ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+	body, ok := f.objects[*input.Key]
+	if !ok {
+		return nil, fmt.Errorf("NoSuchKey: %s", *input.Key)
+	}
+	f.gets++
+	return &s3.GetObjectOutput{Body: io.NopCloser(strings.NewReader(body)), ETag: aws.String(f.etags[*input.Key])}, nil
+}
+
+func (f *fakeS3) HeadObject(_ context.Context, input *s3.HeadObjectInput, _ ...func(*s3.Options)) (*s3.HeadObjectOutput, error) {
+	if _, ok := f.objects[*input.Key]; !ok {
+		return nil, fmt.Errorf("NotFound: %s", *input.Key)
+	}
+	return &s3.HeadObjectOutput{ETag: aws.String(f.etags[*input.Key])}, nil
+}
+
+func TestAuditLogger_FlushOnBatchSize(t *testing.T) {
+	sink := &fakeAuditSink{}
+	logger := newAuditLogger(sink, 2, time.Hour)
+	logger.record(AuditRecord{RefID: "A"})
+	logger.record(AuditRecord{RefID: "B"})
+	assert.Eventually(t, func() bool { return sink.count() == 2 }, time.Second, 10*time.Millisecond)
+
+	logger.record(AuditRecord{RefID: "C"})
+	logger.close()
+	assert.Equal(t, 3, sink.count())
+}
+
+func TestAuditLogger_FlushOnInterval(t *testing.T) {
+	sink := &fakeAuditSink{}
+	logger := newAuditLogger(sink, 100, 10*time.Millisecond)
+	defer logger.close()
+	logger.record(AuditRecord{RefID: "A"})
+	assert.Eventually(t, func() bool { return sink.count() == 1 }, time.Second, 10*time.Millisecond)
+}
+
+func TestAuditLogger_Nil(t *testing.T) {
+	var logger *auditLogger
+	logger.record(AuditRecord{})
+	logger.close()
+}
+
+func TestS3AuditSink(t *testing.T) {
+	client := &fakeS3{}
+	sink := &s3AuditSink{client: client, bucket: "audit", prefix: "grafana/"}
+	err := sink.WriteAudit(context.Background(), []AuditRecord{{RefID: "A", Status: "ok"}, {RefID: "B", Status: "error"}})
+	require.NoError(t, err)
+
+	require.Len(t, client.inputs, 1)
+	assert.Equal(t, "audit", *client.inputs[0].Bucket)
+	assert.True(t, strings.HasPrefix(*client.inputs[0].Key, "grafana/"+time.Now().UTC().Format("2006/01/02")+"/"))
+
+	lines := 0
+	scanner := bufio.NewScanner(strings.NewReader(client.bodies[0]))
+	for scanner.Scan() {
+		record := AuditRecord{}
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &record))
+		lines++
+	}
+	assert.Equal(t, 2, lines)
+}
+
+func TestQueryFingerprint(t *testing.T) {
+	assert.Equal(t, queryFingerprint("SELECT *\n  FROM t"), queryFingerprint("SELECT * FROM t"))
+	assert.NotEqual(t, queryFingerprint("SELECT * FROM t"), queryFingerprint("SELECT * FROM u"))
+}
+
+func TestAuditRecord(t *testing.T) {
+	pCtx := backend.PluginContext{
+		OrgID:                      1,
+		User:                       &backend.User{Login: "admin"},
+		DataSourceInstanceSettings: &backend.DataSourceInstanceSettings{UID: "ds"},
+	}
+	frame := data.NewFrame("")
+	frame.Meta = &data.FrameMeta{Custom: &models.TimestreamCustomMeta{
+		QueryID: "q1",
+		Status:  &timestreamquerytypes.QueryStatus{CumulativeBytesScanned: 10, CumulativeBytesMetered: 20},
+	}}
+
+	record := auditRecord(pCtx, "A", models.QueryModel{RawQuery: "SELECT * FROM t WHERE device = 'd1'"}, backend.DataResponse{Frames: data.Frames{frame}}, nil, nil)
+	assert.Equal(t, "admin", record.User)
+	assert.Equal(t, "ds", record.DatasourceUID)
+	assert.Equal(t, "SELECT * FROM t WHERE device = ?", record.Query)
+	assert.Equal(t, "q1", record.QueryID)
+	assert.Equal(t, int64(10), record.BytesScanned)
+	assert.Equal(t, int64(20), record.BytesMetered)
+	assert.Equal(t, "ok", record.Status)
+
+	assert.Empty(t, record.Directives)
+
+	record = auditRecord(pCtx, "A", models.QueryModel{}, backend.DataResponse{Error: errors.New("boom")}, nil, nil)
+	assert.Equal(t, "error", record.Status)
+	assert.Equal(t, "boom", record.Error)
+
+	// directives honored by the validator are recorded with their reason
+	raw := "-- ts:allow-missing-measure reason=\"aggregated rollup\"\n-- ts:allow-missing-time reason=\"not allowed\"\nSELECT * FROM db.rollup WHERE time > ago(1h)"
+	rules := &validator.Options{DirectiveRules: []validator.Rule{validator.RuleMeasure}}
+	record = auditRecord(pCtx, "A", models.QueryModel{RawQuery: raw}, backend.DataResponse{}, nil, rules)
+	require.Len(t, record.Directives, 1)
+	assert.Equal(t, validator.RuleMeasure, record.Directives[0].Rule)
+	assert.Equal(t, "aggregated rollup", record.Directives[0].Reason)
+}
@@ -0,0 +1,86 @@
+package timestream
+
+import (
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+const (
+	// How long cached responses are served past their TTL when the budget is spent
+	budgetStaleFor = time.Hour
+	// The budget absorbs bursts of up to this share of an hour, e.g. a dashboard load
+	budgetBurst = 5 * time.Minute
+)
+
+// queryBudget spreads the queries of the datasource over the hour: it refills at
+// the hourly budget and holds at most a few minutes of it. A nil budget is never
+// spent.
+type queryBudget struct {
+	perHour int
+	burst   float64
+
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+func newQueryBudget(perHour int) *queryBudget {
+	if perHour <= 0 {
+		return nil
+	}
+	burst := max(float64(perHour)*budgetBurst.Hours(), 1)
+	return &queryBudget{perHour: perHour, burst: burst, tokens: burst}
+}
+
+// take spends a query of the budget, it reports false when the budget is spent
+func (b *queryBudget) take(now time.Time) bool {
+	return b.takeN(now, 1)
+}
+
+// takeN spends n queries of the budget, or none when fewer are left. A request
+// of more queries than the burst holds spends the full burst.
+func (b *queryBudget) takeN(now time.Time, n int) bool {
+	if b == nil {
+		return true
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !b.last.IsZero() {
+		b.tokens = min(b.burst, b.tokens+now.Sub(b.last).Hours()*float64(b.perHour))
+	}
+	b.last = now
+	cost := min(float64(n), b.burst)
+	if b.tokens < cost {
+		return false
+	}
+	b.tokens -= cost
+	return true
+}
+
+// budgetResponse is a cached response served instead of a refresh, with a notice
+// telling its age. The cached frames are copied, not changed.
+func (b *queryBudget) budgetResponse(cached backend.DataResponse, stored, now time.Time) backend.DataResponse {
+	dr := cached
+	dr.Frames = slices.Clone(cached.Frames)
+	if len(dr.Frames) == 0 {
+		return dr
+	}
+	frame := *dr.Frames[0]
+	meta := data.FrameMeta{}
+	if frame.Meta != nil {
+		meta = *frame.Meta
+	}
+	meta.Notices = append(slices.Clone(meta.Notices), data.Notice{
+		Severity: data.NoticeSeverityInfo,
+		Text: fmt.Sprintf("refresh skipped to stay within the budget of %d queries per hour, showing data from %s ago",
+			b.perHour, now.Sub(stored).Round(time.Second)),
+	})
+	frame.Meta = &meta
+	dr.Frames[0] = &frame
+	return dr
+}
@@ -0,0 +1,85 @@
+package timestream
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/timestreamquery"
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQueryBudget(t *testing.T) {
+	now := time.Now()
+	// 120 per hour: a burst of 10, then one query every 30 seconds
+	b := newQueryBudget(120)
+	for i := range 10 {
+		assert.True(t, b.take(now), i)
+	}
+	assert.False(t, b.take(now))
+	assert.False(t, b.take(now.Add(20*time.Second)))
+	assert.True(t, b.take(now.Add(30*time.Second)))
+	assert.False(t, b.take(now.Add(30*time.Second)))
+
+	// the burst doesn't grow past five minutes of budget
+	later := now.Add(24 * time.Hour)
+	for i := range 10 {
+		assert.True(t, b.take(later), i)
+	}
+	assert.False(t, b.take(later))
+
+	assert.True(t, newQueryBudget(1).take(now))
+	var unlimited *queryBudget
+	assert.True(t, unlimited.take(now))
+
+	// several queries are spent at once, or none
+	b = newQueryBudget(120)
+	assert.True(t, b.takeN(now, 8))
+	assert.False(t, b.takeN(now, 3))
+	assert.True(t, b.takeN(now, 2))
+	assert.False(t, b.take(now))
+	// more than the burst spends all of it
+	assert.True(t, newQueryBudget(12).takeN(now, 3))
+}
+
+func TestQueryBudget_Response(t *testing.T) {
+	now := time.Now()
+	cached := backend.DataResponse{Frames: data.Frames{data.NewFrame("a").SetMeta(&data.FrameMeta{ExecutedQueryString: "SELECT 1"})}}
+	dr := newQueryBudget(100).budgetResponse(cached, now.Add(-90*time.Second), now)
+
+	require.Len(t, dr.Frames[0].Meta.Notices, 1)
+	assert.Equal(t, "refresh skipped to stay within the budget of 100 queries per hour, showing data from 1m30s ago", dr.Frames[0].Meta.Notices[0].Text)
+	assert.Equal(t, "SELECT 1", dr.Frames[0].Meta.ExecutedQueryString)
+	assert.Empty(t, cached.Frames[0].Meta.Notices, "the cached response is unchanged")
+}
+
+func TestQueryData_Budget(t *testing.T) {
+	client := &fakeClient{output: &timestreamquery.QueryOutput{}}
+	frames := newFrameCache(time.Nanosecond)
+	frames.staleFor = time.Hour
+	ds := &timestreamDS{Client: client, frames: frames, budget: newQueryBudget(1)}
+	req := &backend.QueryDataRequest{Queries: []backend.DataQuery{{
+		RefID:     "A",
+		JSON:      []byte(`{"rawQuery":"SELECT * FROM db.tbl WHERE $__timeFilter AND measure_name = 'cpu'"}`),
+		TimeRange: backend.TimeRange{From: time.Now().Add(-time.Hour), To: time.Now()},
+	}}}
+
+	res, err := ds.QueryData(context.Background(), req)
+	require.NoError(t, err)
+	require.NoError(t, res.Responses["A"].Error)
+	res, err = ds.QueryData(context.Background(), req)
+	require.NoError(t, err)
+	require.Len(t, res.Responses["A"].Frames[0].Meta.Notices, 1)
+	assert.Contains(t, res.Responses["A"].Frames[0].Meta.Notices[0].Text, "refresh skipped")
+	assert.Len(t, client.calls.runQuery, 1)
+
+	// alerts are never served stale
+	req.Headers = map[string]string{fromAlertHeader: "true"}
+	res, err = ds.QueryData(context.Background(), req)
+	require.NoError(t, err)
+	assert.Empty(t, res.Responses["A"].Frames[0].Meta.Notices)
+	assert.Len(t, client.calls.runQuery, 2)
+}
@@ -0,0 +1,215 @@
+package timestream
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	timestreamquerytypes "github.com/aws/aws-sdk-go-v2/service/timestreamquery/types"
+	"github.com/grafana/timestream-datasource/pkg/models"
+)
+
+// BuilderQuery describes a query by its parts, see models.BuilderQuery
+type BuilderQuery = models.BuilderQuery
+
+// BuilderFilter is an additional predicate of a builder query
+type BuilderFilter = models.BuilderFilter
+
+var builderOperators = map[string]bool{"=": true, "!=": true, "<>": true, "<": true, "<=": true, ">": true, ">=": true}
+
+// Data types of measures as listed by SHOW MEASURES
+var builderValueTypes = map[string]bool{"double": true, "bigint": true, "varchar": true, "boolean": true, "timestamp": true, "multi": true}
+
+// Aggregations are function names, e.g. avg or approx_percentile
+var builderAggregation = regexp.MustCompile(`^[A-Za-z_]+$`)
+
+// Aggregations that require a numeric measure
+var numericAggregations = map[string]bool{"avg": true, "sum": true, "stddev": true, "variance": true}
+
+// builderSQL renders the query, leaving the time range to the $__timeFilter macro
+func builderSQL(b BuilderQuery) (string, error) {
+	if b.Database == "" || b.Table == "" {
+		return "", fmt.Errorf("database and table are required")
+	}
+	if b.Measure == "" {
+		return "", fmt.Errorf("measure is required")
+	}
+	if b.Aggregation != "" && !builderAggregation.MatchString(b.Aggregation) {
+		return "", fmt.Errorf("unsupported aggregation: %s", b.Aggregation)
+	}
+	valueType := b.ValueType
+	if valueType == "" {
+		valueType = "double"
+	}
+	if !builderValueTypes[valueType] {
+		return "", fmt.Errorf("unsupported value type: %s", valueType)
+	}
+	value := "measure_value::" + valueType
+	switch valueType {
+	case "multi":
+		if b.Attribute == "" {
+			return "", fmt.Errorf("measure %s has multi-measure records, an attribute is required", b.Measure)
+		}
+		value = quoteIdentifier(b.Attribute)
+	case "varchar", "boolean":
+		if numericAggregations[strings.ToLower(b.Aggregation)] {
+			return "", fmt.Errorf("%s requires a numeric measure, %s is %s", b.Aggregation, b.Measure, valueType)
+		}
+	}
+
+	columns := []string{}
+	groups := []string{}
+	for _, dim := range b.GroupBy {
+		columns = append(columns, quoteIdentifier(dim))
+		groups = append(groups, quoteIdentifier(dim))
+	}
+	timeColumn := "time"
+	if b.Bin {
+		timeColumn = "BIN(time, $__interval_ms)"
+		groups = append(groups, timeColumn)
+	}
+	columns = append(columns, timeColumn+" AS time")
+	if b.Aggregation != "" {
+		value = fmt.Sprintf("%s(%s)", b.Aggregation, value)
+		if !b.Bin {
+			// a single aggregated value per group
+			columns = columns[:len(columns)-1]
+			columns = append(columns, "max(time) AS time")
+		}
+	}
+	columns = append(columns, fmt.Sprintf("%s AS %s", value, quoteIdentifier(b.Measure)))
+
+	predicates := []string{"$__timeFilter", "measure_name = " + quoteLiteral(b.Measure)}
+	var having []string
+	for _, f := range b.Filters {
+		if !builderOperators[f.Operator] {
+			return "", fmt.Errorf("unsupported filter operator: %s", f.Operator)
+		}
+		if f.Column != b.Measure {
+			predicates = append(predicates, fmt.Sprintf("%s %s %s", quoteIdentifier(f.Column), f.Operator, quoteLiteral(f.Value)))
+			continue
+		}
+		// filters of the measure compare its values, aggregated ones after grouping
+		literal, err := builderValue(f.Value, valueType, b.Aggregation)
+		if err != nil {
+			return "", err
+		}
+		if b.Aggregation != "" {
+			having = append(having, fmt.Sprintf("%s %s %s", value, f.Operator, literal))
+		} else {
+			predicates = append(predicates, fmt.Sprintf("%s %s %s", value, f.Operator, literal))
+		}
+	}
+
+	order := []string{}
+	for _, o := range b.OrderBy {
+		if !builderColumn(b, o.Column) {
+			return "", fmt.Errorf("cannot sort by %s, it is not a column of the query", o.Column)
+		}
+		column := quoteIdentifier(o.Column)
+		if o.Desc {
+			column += " DESC"
+		}
+		order = append(order, column)
+	}
+	if len(order) == 0 && (b.Aggregation == "" || b.Bin) {
+		order = append(order, "time")
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "SELECT %s\nFROM %s.%s\nWHERE %s", strings.Join(columns, ", "),
+		quoteIdentifier(b.Database), quoteIdentifier(b.Table), strings.Join(predicates, " AND "))
+	if b.Aggregation != "" && len(groups) > 0 {
+		fmt.Fprintf(&sb, "\nGROUP BY %s", strings.Join(groups, ", "))
+	}
+	if len(having) > 0 {
+		fmt.Fprintf(&sb, "\nHAVING %s", strings.Join(having, " AND "))
+	}
+	if len(order) > 0 {
+		fmt.Fprintf(&sb, "\nORDER BY %s", strings.Join(order, ", "))
+	}
+	if b.Limit > 0 {
+		fmt.Fprintf(&sb, "\nLIMIT %d", b.Limit)
+	}
+	return sb.String(), nil
+}
+
+// applyTableHints regenerates the SQL of builder queries with the sorting and
+// filters of their table hints, so Timestream sorts and filters the rows instead
+// of the browser. Queries edited after building are left unchanged.
+func applyTableHints(sql string, query models.QueryModel, _ models.DatasourceSettings) (string, error) {
+	hints := query.TableHints
+	if query.Format != models.FormatOptionTable || query.Builder == nil || hints == nil || len(hints.Sort)+len(hints.Filters) == 0 {
+		return sql, nil
+	}
+	built, err := builderSQL(*query.Builder)
+	if err != nil || strings.TrimSpace(sql) != built {
+		return sql, nil
+	}
+	b := *query.Builder
+	b.Filters = append(slices.Clone(b.Filters), hints.Filters...)
+	if len(hints.Sort) > 0 {
+		b.OrderBy = hints.Sort
+	}
+	out, err := builderSQL(b)
+	if err != nil {
+		return sql, fmt.Errorf("table hints: %w", err)
+	}
+	return out, nil
+}
+
+// builderColumn reports whether the column is selected by the query
+func builderColumn(b BuilderQuery, column string) bool {
+	return column == "time" || column == b.Measure || slices.Contains(b.GroupBy, column)
+}
+
+// builderValue renders the value a measure is compared with. Numbers are not
+// quoted, so they compare with numeric measures and aggregations.
+func builderValue(value, valueType, aggregation string) (string, error) {
+	_, err := strconv.ParseFloat(value, 64)
+	switch aggregation := strings.ToLower(aggregation); {
+	case err == nil && (valueType != "varchar" || aggregation != "" && aggregation != "min" && aggregation != "max"):
+		return value, nil
+	case valueType == "double" || valueType == "bigint" || aggregation != "" && aggregation != "min" && aggregation != "max":
+		return "", fmt.Errorf("cannot compare the measure with %q, a number is required", value)
+	default:
+		return quoteLiteral(value), nil
+	}
+}
+
+// measureTypes maps the measure names of SHOW MEASURES rows to their data type
+func measureTypes(rows []timestreamquerytypes.Row) map[string]string {
+	types := map[string]string{}
+	for _, row := range rows {
+		if len(row.Data) < 2 || row.Data[0].ScalarValue == nil || row.Data[1].ScalarValue == nil {
+			continue
+		}
+		types[*row.Data[0].ScalarValue] = *row.Data[1].ScalarValue
+	}
+	return types
+}
+
+// measureType looks up the data type of a measure, so generated queries select the
+// right measure_value::<type> column
+func (ds *timestreamDS) measureType(ctx context.Context, database, table, measure string) (string, error) {
+	v, err := ds.showMeasures(ctx, database, table)
+	if err != nil {
+		return "", err
+	}
+	valueType, ok := measureTypes(v.Rows)[measure]
+	if !ok {
+		return "", fmt.Errorf("measure %s not found in %s.%s", measure, database, table)
+	}
+	return valueType, nil
+}
+
+func quoteIdentifier(name string) string {
+	return `"` + strings.ReplaceAll(strings.Trim(name, `"`), `"`, `""`) + `"`
+}
+
+func quoteLiteral(value string) string {
+	return "'" + strings.ReplaceAll(value, "'", "''") + "'"
+}
@@ -0,0 +1,86 @@
+package timestream
+
+import (
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/timestream-datasource/pkg/models"
+)
+
+// Parts the builder corpus combines, including names that need quoting or look like SQL
+var (
+	corpusNames        = []string{"metrics", "my table", `say "hi"`, "where", "it's", "a--b", "x/*y*/"}
+	corpusValueTypes   = []string{"", "double", "bigint", "varchar", "boolean", "timestamp", "multi"}
+	corpusAggregations = []string{"", "avg", "max", "min", "count", "sum", "COUNT"}
+	corpusGroupBys     = [][]string{nil, {"device"}, {"region name", "select"}}
+	corpusFilters      = [][]BuilderFilter{
+		nil,
+		{{Column: "device", Operator: "=", Value: "d1"}},
+		{{Column: "region", Operator: "!=", Value: "eu' OR 1=1 --"}},
+		{{Column: "measure_name", Operator: "<>", Value: "other"}, {Column: "load", Operator: ">=", Value: "0.5"}},
+		{{Column: "time", Operator: "<", Value: "2024-01-01"}},
+	}
+)
+
+// builderCorpus returns a query for every combination of builder options, with
+// names and values rotating through corpusNames and corpusFilters
+func builderCorpus() []BuilderQuery {
+	var queries []BuilderQuery
+	n := 0
+	for _, valueType := range corpusValueTypes {
+		for _, aggregation := range corpusAggregations {
+			if valueType == "varchar" || valueType == "boolean" {
+				if numericAggregations[aggregation] {
+					continue
+				}
+			}
+			for _, bin := range []bool{false, true} {
+				for _, groupBy := range corpusGroupBys {
+					for _, limit := range []int64{0, 100} {
+						q := BuilderQuery{
+							Database:    corpusNames[n%len(corpusNames)],
+							Table:       corpusNames[(n+1)%len(corpusNames)],
+							Measure:     corpusNames[(n+2)%len(corpusNames)],
+							ValueType:   valueType,
+							Aggregation: aggregation,
+							Bin:         bin,
+							GroupBy:     groupBy,
+							Filters:     corpusFilters[n%len(corpusFilters)],
+							Limit:       limit,
+						}
+						if valueType == "multi" {
+							q.Attribute = corpusNames[(n+3)%len(corpusNames)]
+						}
+						queries = append(queries, q)
+						n++
+					}
+				}
+			}
+		}
+	}
+	return queries
+}
+
+// BuilderCorpus returns the SQL of queries generated by the query builder, macros
+// expanded. Every query passes the reasonable query check with the default
+// options, which makes them a seed corpus for fuzzing the validator.
+func BuilderCorpus() []string {
+	from := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	model := models.QueryModel{
+		TimeRange:     backend.TimeRange{From: from, To: from.Add(time.Hour)},
+		Interval:      time.Minute,
+		MaxDataPoints: 1000,
+	}
+	var corpus []string
+	for _, q := range builderCorpus() {
+		sql, err := builderSQL(q)
+		if err != nil {
+			continue
+		}
+		model.RawQuery = sql
+		if sql, err = Interpolate(model, models.DatasourceSettings{}); err == nil {
+			corpus = append(corpus, sql)
+		}
+	}
+	return corpus
+}
@@ -0,0 +1,24 @@
+package timestream
+
+import (
+	"testing"
+
+	"github.com/grafana/timestream-datasource/pkg/timestream/validator"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Every query the builder generates must pass the validator with the default
+// options, a failing case is a builder bug
+func TestBuilderCorpus_Valid(t *testing.T) {
+	queries := builderCorpus()
+	corpus := BuilderCorpus()
+	require.Len(t, corpus, len(queries), "every corpus query renders")
+
+	for i, sql := range corpus {
+		valid, issues := validator.Validate(sql, nil)
+		if !assert.True(t, valid, "%+v\n%s", queries[i], sql) {
+			t.Logf("issues: %+v", issues)
+		}
+	}
+}
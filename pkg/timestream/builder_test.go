@@ -0,0 +1,175 @@
+package timestream
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/timestreamquery"
+	timestreamquerytypes "github.com/aws/aws-sdk-go-v2/service/timestreamquery/types"
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/timestream-datasource/pkg/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBuilderSQL(t *testing.T) {
+	t.Run("binned aggregation", func(t *testing.T) {
+		sql, err := builderSQL(BuilderQuery{
+			Database:    "db",
+			Table:       "metrics",
+			Measure:     "cpu",
+			Aggregation: "avg",
+			Bin:         true,
+			GroupBy:     []string{"device"},
+			Filters:     []BuilderFilter{{Column: "region", Operator: "=", Value: "eu's"}},
+		})
+		require.NoError(t, err)
+		assert.Equal(t, `SELECT "device", BIN(time, $__interval_ms) AS time, avg(measure_value::double) AS "cpu"
+FROM "db"."metrics"
+WHERE $__timeFilter AND measure_name = 'cpu' AND "region" = 'eu''s'
+GROUP BY "device", BIN(time, $__interval_ms)
+ORDER BY time`, sql)
+	})
+
+	t.Run("raw points", func(t *testing.T) {
+		sql, err := builderSQL(BuilderQuery{Database: `"db"`, Table: "metrics", Measure: "state", ValueType: "varchar", Limit: 10})
+		require.NoError(t, err)
+		assert.Equal(t, `SELECT time AS time, measure_value::varchar AS "state"
+FROM "db"."metrics"
+WHERE $__timeFilter AND measure_name = 'state'
+ORDER BY time
+LIMIT 10`, sql)
+	})
+
+	t.Run("multi-measure attribute", func(t *testing.T) {
+		sql, err := builderSQL(BuilderQuery{Database: "db", Table: "metrics", Measure: "stats", ValueType: "multi", Attribute: "cpu", Aggregation: "max"})
+		require.NoError(t, err)
+		assert.Equal(t, `SELECT max(time) AS time, max("cpu") AS "stats"
+FROM "db"."metrics"
+WHERE $__timeFilter AND measure_name = 'stats'`, sql)
+	})
+
+	t.Run("sorted and filtered by the measure", func(t *testing.T) {
+		sql, err := builderSQL(BuilderQuery{
+			Database:    "db",
+			Table:       "metrics",
+			Measure:     "cpu",
+			Aggregation: "max",
+			GroupBy:     []string{"device"},
+			Filters:     []BuilderFilter{{Column: "cpu", Operator: ">", Value: "90"}},
+			OrderBy:     []models.BuilderOrder{{Column: "cpu", Desc: true}, {Column: "device"}},
+			Limit:       100,
+		})
+		require.NoError(t, err)
+		assert.Equal(t, `SELECT "device", max(time) AS time, max(measure_value::double) AS "cpu"
+FROM "db"."metrics"
+WHERE $__timeFilter AND measure_name = 'cpu'
+GROUP BY "device"
+HAVING max(measure_value::double) > 90
+ORDER BY "cpu" DESC, "device"
+LIMIT 100`, sql)
+
+		sql, err = builderSQL(BuilderQuery{Database: "db", Table: "metrics", Measure: "state", ValueType: "varchar", Filters: []BuilderFilter{{Column: "state", Operator: "!=", Value: "ok"}}})
+		require.NoError(t, err)
+		assert.Contains(t, sql, "AND measure_value::varchar != 'ok'\nORDER BY time")
+
+		_, err = builderSQL(BuilderQuery{Database: "db", Table: "metrics", Measure: "cpu", Filters: []BuilderFilter{{Column: "cpu", Operator: ">", Value: "high"}}})
+		assert.ErrorContains(t, err, "a number is required")
+		_, err = builderSQL(BuilderQuery{Database: "db", Table: "metrics", Measure: "cpu", OrderBy: []models.BuilderOrder{{Column: "region"}}})
+		assert.ErrorContains(t, err, "cannot sort by region")
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		_, err := builderSQL(BuilderQuery{Database: "db", Table: "metrics"})
+		assert.Error(t, err)
+		_, err = builderSQL(BuilderQuery{Database: "db", Table: "metrics", Measure: "m", Filters: []BuilderFilter{{Column: "a", Operator: "; DROP", Value: "b"}}})
+		assert.Error(t, err)
+		_, err = builderSQL(BuilderQuery{Database: "db", Table: "metrics", Measure: "m", Aggregation: "avg(1)) --"})
+		assert.Error(t, err)
+		_, err = builderSQL(BuilderQuery{Database: "db", Table: "metrics", Measure: "m", ValueType: "double FROM x --"})
+		assert.Error(t, err)
+	})
+}
+
+func TestCallResource_Builder(t *testing.T) {
+	ds := &timestreamDS{Client: &fakeClient{output: &timestreamquery.QueryOutput{
+		Rows: []timestreamquerytypes.Row{
+			{Data: []timestreamquerytypes.Datum{{ScalarValue: aws.String("cpu")}, {ScalarValue: aws.String("bigint")}}},
+			{Data: []timestreamquerytypes.Datum{{ScalarValue: aws.String("state")}, {ScalarValue: aws.String("varchar")}}},
+		},
+	}}}
+
+	sender := &fakeSender{}
+	err := ds.CallResource(context.Background(), &backend.CallResourceRequest{
+		Path:   "builder",
+		Method: "POST",
+		Body:   []byte(`{"database":"db","table":"metrics","measure":"cpu","aggregation":"avg"}`),
+	}, sender)
+	require.NoError(t, err)
+	res := map[string]string{}
+	require.NoError(t, json.Unmarshal(sender.res.Body, &res))
+	assert.Equal(t, "bigint", res["valueType"])
+	assert.Contains(t, res["sql"], "avg(measure_value::bigint)")
+
+	err = ds.CallResource(context.Background(), &backend.CallResourceRequest{
+		Path:   "builder",
+		Method: "POST",
+		Body:   []byte(`{"database":"db","table":"metrics","measure":"state","aggregation":"avg"}`),
+	}, sender)
+	assert.ErrorContains(t, err, "avg requires a numeric measure")
+
+	err = ds.CallResource(context.Background(), &backend.CallResourceRequest{
+		Path:   "builder",
+		Method: "POST",
+		Body:   []byte(`{"database":"db","table":"metrics","measure":"missing"}`),
+	}, sender)
+	assert.ErrorContains(t, err, "measure missing not found")
+}
+
+func TestApplyTableHints(t *testing.T) {
+	builder := &BuilderQuery{Database: "db", Table: "metrics", Measure: "cpu", GroupBy: []string{"device"}, Limit: 1000}
+	built, err := builderSQL(*builder)
+	require.NoError(t, err)
+	query := models.QueryModel{
+		Format:   models.FormatOptionTable,
+		RawQuery: built,
+		Builder:  builder,
+		TableHints: &models.TableHints{
+			Sort:    []models.BuilderOrder{{Column: "cpu", Desc: true}},
+			Filters: []models.BuilderFilter{{Column: "device", Operator: "=", Value: "d1"}},
+		},
+	}
+
+	sql, err := applyTableHints(query.RawQuery, query, models.DatasourceSettings{})
+	require.NoError(t, err)
+	assert.Equal(t, `SELECT "device", time AS time, measure_value::double AS "cpu"
+FROM "db"."metrics"
+WHERE $__timeFilter AND measure_name = 'cpu' AND "device" = 'd1'
+ORDER BY "cpu" DESC
+LIMIT 1000`, sql)
+	assert.Empty(t, builder.Filters, "the builder of the query is unchanged")
+
+	// runs before the macros are expanded
+	sql, err = rewrite(context.Background(), query, models.DatasourceSettings{})
+	require.NoError(t, err)
+	assert.Contains(t, sql, `ORDER BY "cpu" DESC`)
+	assert.NotContains(t, sql, "$__timeFilter")
+
+	// only table queries that still match their builder are regenerated
+	for _, q := range []models.QueryModel{
+		{Format: models.FormatOptionTimeSeries, RawQuery: built, Builder: builder, TableHints: query.TableHints},
+		{Format: models.FormatOptionTable, RawQuery: built + " AND x = 1", Builder: builder, TableHints: query.TableHints},
+		{Format: models.FormatOptionTable, RawQuery: built, TableHints: query.TableHints},
+	} {
+		sql, err := applyTableHints(q.RawQuery, q, models.DatasourceSettings{})
+		require.NoError(t, err)
+		assert.Equal(t, q.RawQuery, sql)
+	}
+
+	query.TableHints = &models.TableHints{Sort: []models.BuilderOrder{{Column: "region"}}}
+	_, err = applyTableHints(query.RawQuery, query, models.DatasourceSettings{})
+	assert.ErrorContains(t, err, "table hints: cannot sort by region")
+}
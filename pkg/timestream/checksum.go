@@ -0,0 +1,71 @@
+package timestream
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/grafana/timestream-datasource/pkg/models"
+)
+
+// Header set by Grafana on requests of the alerting engine
+const fromAlertHeader = "FromAlert"
+
+func isAlertRequest(req *backend.QueryDataRequest) bool {
+	return req.Headers[fromAlertHeader] == "true"
+}
+
+// framesChecksum hashes the names, labels and values of the frames. Metadata like
+// the query ID or execution times is left out, so the checksum only changes when
+// the returned data does.
+func framesChecksum(frames data.Frames) string {
+	h := sha256.New()
+	for _, frame := range frames {
+		fmt.Fprintf(h, "frame:%s\n", frame.Name)
+		for _, field := range frame.Fields {
+			fmt.Fprintf(h, "field:%s:%s:%s\n", field.Name, field.Labels.String(), field.Type())
+			hashValues(h, field)
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func hashValues(h hash.Hash, field *data.Field) {
+	for i := 0; i < field.Len(); i++ {
+		if v, ok := field.ConcreteAt(i); ok {
+			fmt.Fprintf(h, "%v\n", v)
+		} else {
+			fmt.Fprint(h, "null\n")
+		}
+	}
+}
+
+// annotateAlertChecksum adds the result checksum to the meta and logs it, so a
+// flapping alert can be told apart from changing data
+func annotateAlertChecksum(refID string, query models.QueryModel, dr backend.DataResponse) {
+	if dr.Error != nil {
+		return
+	}
+	checksum := framesChecksum(dr.Frames)
+	rows, queryID := 0, ""
+	for _, frame := range dr.Frames {
+		rows += frame.Rows()
+		if frame.Meta == nil {
+			frame.Meta = &data.FrameMeta{}
+		}
+		meta, ok := frame.Meta.Custom.(*models.TimestreamCustomMeta)
+		if !ok {
+			meta = &models.TimestreamCustomMeta{}
+			frame.Meta.Custom = meta
+		}
+		meta.Checksum = checksum
+		if meta.QueryID != "" {
+			queryID = meta.QueryID
+		}
+	}
+	backend.Logger.Info("alert query result", "refId", refID, "fingerprint", queryFingerprint(query.RawQuery),
+		"checksum", checksum, "frames", len(dr.Frames), "rows", rows, "queryId", queryID)
+}
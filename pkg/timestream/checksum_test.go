@@ -0,0 +1,42 @@
+package timestream
+
+import (
+	"testing"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/grafana/timestream-datasource/pkg/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func checksumFrame(values []float64, queryID string) *data.Frame {
+	frame := data.NewFrame("", data.NewField("value", data.Labels{"device": "d1"}, values))
+	frame.Meta = &data.FrameMeta{Custom: &models.TimestreamCustomMeta{QueryID: queryID}}
+	return frame
+}
+
+func TestFramesChecksum(t *testing.T) {
+	a := framesChecksum(data.Frames{checksumFrame([]float64{1, 2}, "q1")})
+	b := framesChecksum(data.Frames{checksumFrame([]float64{1, 2}, "q2")})
+	c := framesChecksum(data.Frames{checksumFrame([]float64{1, 3}, "q1")})
+
+	assert.Equal(t, a, b, "meta must not change the checksum")
+	assert.NotEqual(t, a, c)
+}
+
+func TestAnnotateAlertChecksum(t *testing.T) {
+	frame := checksumFrame([]float64{1}, "q1")
+	bare := data.NewFrame("", data.NewField("value", nil, []float64{2}))
+	annotateAlertChecksum("A", models.QueryModel{}, backend.DataResponse{Frames: data.Frames{frame, bare}})
+
+	meta := frame.Meta.Custom.(*models.TimestreamCustomMeta)
+	assert.Len(t, meta.Checksum, 64)
+	require.NotNil(t, bare.Meta)
+	assert.Equal(t, meta.Checksum, bare.Meta.Custom.(*models.TimestreamCustomMeta).Checksum)
+}
+
+func TestIsAlertRequest(t *testing.T) {
+	assert.True(t, isAlertRequest(&backend.QueryDataRequest{Headers: map[string]string{"FromAlert": "true"}}))
+	assert.False(t, isAlertRequest(&backend.QueryDataRequest{}))
+}
@@ -0,0 +1,149 @@
+package timestream
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/grafana/timestream-datasource/pkg/models"
+)
+
+// applyColumnMappings renames, hides, reorders and converts the fields as configured
+// in the query. Mapped fields come first in mapping order, the rest keep their order.
+func applyColumnMappings(fields []*data.Field, mappings []models.ColumnMapping) ([]*data.Field, error) {
+	if len(mappings) == 0 {
+		return fields, nil
+	}
+	byName := make(map[string]*data.Field, len(fields))
+	for _, field := range fields {
+		byName[field.Name] = field
+	}
+
+	out := make([]*data.Field, 0, len(fields))
+	used := map[string]bool{}
+	for _, mapping := range mappings {
+		field, ok := byName[mapping.Name]
+		if !ok || used[mapping.Name] {
+			continue
+		}
+		used[mapping.Name] = true
+		if mapping.Hide {
+			continue
+		}
+		converted, err := convertFieldRole(field, mapping.Role)
+		if err != nil {
+			return nil, err
+		}
+		if mapping.Rename != "" {
+			converted.Name = mapping.Rename
+		}
+		out = append(out, converted)
+	}
+	for _, field := range fields {
+		if !used[field.Name] {
+			out = append(out, field)
+		}
+	}
+	return out, nil
+}
+
+// convertFieldRole converts the field to the type expected for its role
+func convertFieldRole(field *data.Field, role models.ColumnRole) (*data.Field, error) {
+	var target data.FieldType
+	switch role {
+	case models.ColumnRoleTime:
+		target = data.FieldTypeNullableTime
+	case models.ColumnRoleValue:
+		target = data.FieldTypeNullableFloat64
+	case models.ColumnRoleLabel:
+		target = data.FieldTypeNullableString
+	default:
+		return field, nil
+	}
+	if field.Type() == target || field.Type() == target.NonNullableType() {
+		return field, nil
+	}
+
+	out := data.NewFieldFromFieldType(target, field.Len())
+	out.Name = field.Name
+	out.Labels = field.Labels
+	out.Config = field.Config
+	for i := 0; i < field.Len(); i++ {
+		v, ok := field.ConcreteAt(i)
+		if !ok {
+			continue
+		}
+		converted, err := convertValue(v, role)
+		if err != nil {
+			return nil, fmt.Errorf("column %s: %w", field.Name, err)
+		}
+		out.Set(i, converted)
+	}
+	return out, nil
+}
+
+func convertValue(v interface{}, role models.ColumnRole) (interface{}, error) {
+	switch role {
+	case models.ColumnRoleLabel:
+		s := fmt.Sprintf("%v", v)
+		return &s, nil
+	case models.ColumnRoleValue:
+		switch n := v.(type) {
+		case string:
+			f, err := strconv.ParseFloat(n, 64)
+			if err != nil {
+				return nil, err
+			}
+			return &f, nil
+		case bool:
+			f := 0.0
+			if n {
+				f = 1
+			}
+			return &f, nil
+		}
+		f, err := toFloat64(v)
+		if err != nil {
+			return nil, err
+		}
+		return &f, nil
+	case models.ColumnRoleTime:
+		if s, ok := v.(string); ok {
+			for _, layout := range []string{time.RFC3339Nano, "2006-01-02 15:04:05.999999999"} {
+				if t, err := time.Parse(layout, s); err == nil {
+					return &t, nil
+				}
+			}
+			return nil, fmt.Errorf("invalid time: %s", s)
+		}
+		// numbers are epoch milliseconds
+		ms, err := toFloat64(v)
+		if err != nil {
+			return nil, err
+		}
+		t := time.UnixMilli(int64(ms)).UTC()
+		return &t, nil
+	}
+	return v, nil
+}
+
+func toFloat64(v interface{}) (float64, error) {
+	switch n := v.(type) {
+	case float64:
+		return n, nil
+	case float32:
+		return float64(n), nil
+	case int64:
+		return float64(n), nil
+	case int32:
+		return float64(n), nil
+	case int16:
+		return float64(n), nil
+	case int8:
+		return float64(n), nil
+	case uint64:
+		return float64(n), nil
+	}
+	return 0, fmt.Errorf("unsupported value type %T", v)
+}
@@ -0,0 +1,60 @@
+package timestream
+
+import (
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/grafana/timestream-datasource/pkg/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func strPtr(s string) *string { return &s }
+
+func TestApplyColumnMappings(t *testing.T) {
+	fields := []*data.Field{
+		data.NewField("ts", nil, []*string{strPtr("2024-01-01 10:00:00.000000000"), nil}),
+		data.NewField("device", nil, []*string{strPtr("d1"), strPtr("d2")}),
+		data.NewField("port", nil, []*int64{nil, nil}),
+		data.NewField("raw", nil, []*string{strPtr("1.5"), strPtr("2")}),
+		data.NewField("secret", nil, []*string{strPtr("x"), strPtr("y")}),
+	}
+	fields[2].Set(0, int64Ptr(8080))
+
+	out, err := applyColumnMappings(fields, []models.ColumnMapping{
+		{Name: "raw", Rename: "value", Role: models.ColumnRoleValue},
+		{Name: "ts", Rename: "time", Role: models.ColumnRoleTime},
+		{Name: "secret", Hide: true},
+		{Name: "port", Role: models.ColumnRoleLabel},
+		{Name: "missing", Rename: "ignored"},
+	})
+	require.NoError(t, err)
+
+	names := []string{}
+	for _, f := range out {
+		names = append(names, f.Name)
+	}
+	assert.Equal(t, []string{"value", "time", "port", "device"}, names)
+
+	assert.Equal(t, data.FieldTypeNullableFloat64, out[0].Type())
+	assert.Equal(t, 1.5, *out[0].At(0).(*float64))
+	assert.Equal(t, data.FieldTypeNullableTime, out[1].Type())
+	assert.Equal(t, time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC), *out[1].At(0).(*time.Time))
+	assert.Nil(t, out[1].At(1))
+	assert.Equal(t, data.FieldTypeNullableString, out[2].Type())
+	assert.Equal(t, "8080", *out[2].At(0).(*string))
+	assert.Nil(t, out[2].At(1))
+}
+
+func TestApplyColumnMappings_Errors(t *testing.T) {
+	fields := []*data.Field{data.NewField("raw", nil, []*string{strPtr("not a number")})}
+	_, err := applyColumnMappings(fields, []models.ColumnMapping{{Name: "raw", Role: models.ColumnRoleValue}})
+	assert.ErrorContains(t, err, "column raw")
+
+	out, err := applyColumnMappings(fields, nil)
+	require.NoError(t, err)
+	assert.Equal(t, fields, out)
+}
+
+func int64Ptr(i int64) *int64 { return &i }
@@ -0,0 +1,62 @@
+package timestream
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/backend/gtime"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/grafana/grafana-plugin-sdk-go/experimental/errorsource"
+	"github.com/grafana/timestream-datasource/pkg/models"
+)
+
+// executeComparison runs the query for the dashboard range and again shifted back by
+// the compare offset. The shifted series are realigned to the dashboard range and
+// suffixed with the offset, e.g. "value (1w ago)".
+func (ds *timestreamDS) executeComparison(ctx context.Context, query models.QueryModel) backend.DataResponse {
+	offset, err := gtime.ParseDuration(query.CompareOffset)
+	if err != nil || offset <= 0 {
+		return errorsource.Response(errorsource.DownstreamError(fmt.Errorf("invalid compare offset %q", query.CompareOffset), false))
+	}
+	suffix := fmt.Sprintf(" (%s ago)", query.CompareOffset)
+	query.CompareOffset = ""
+
+	dr := ds.executeQuery(ctx, query)
+	if dr.Error != nil {
+		return dr
+	}
+
+	shifted := query
+	shifted.TimeRange = backend.TimeRange{From: query.TimeRange.From.Add(-offset), To: query.TimeRange.To.Add(-offset)}
+	shiftedDR := ds.executeQuery(ctx, shifted)
+	if shiftedDR.Error != nil {
+		dr.Frames[0].AppendNotices(data.Notice{
+			Severity: data.NoticeSeverityWarning,
+			Text:     "comparison query failed: " + shiftedDR.Error.Error(),
+		})
+		return dr
+	}
+	for _, frame := range shiftedDR.Frames {
+		realignFrame(frame, offset, suffix)
+		dr.Frames = append(dr.Frames, frame)
+	}
+	return dr
+}
+
+// realignFrame moves the times of the frame forward by offset and appends the suffix to
+// the names of the other fields
+func realignFrame(frame *data.Frame, offset time.Duration, suffix string) {
+	for _, field := range frame.Fields {
+		if field.Type().Time() {
+			for i := 0; i < field.Len(); i++ {
+				if v, ok := field.ConcreteAt(i); ok {
+					field.SetConcrete(i, v.(time.Time).Add(offset))
+				}
+			}
+			continue
+		}
+		field.Name += suffix
+	}
+}
@@ -0,0 +1,52 @@
+package timestream
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/timestreamquery"
+	timestreamquerytypes "github.com/aws/aws-sdk-go-v2/service/timestreamquery/types"
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/timestream-datasource/pkg/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExecuteQuery_CompareOffset(t *testing.T) {
+	client := &fakeClient{output: &timestreamquery.QueryOutput{
+		ColumnInfo: []timestreamquerytypes.ColumnInfo{
+			{Name: aws.String("time"), Type: &timestreamquerytypes.Type{ScalarType: timestreamquerytypes.ScalarTypeTimestamp}},
+			{Name: aws.String("value"), Type: &timestreamquerytypes.Type{ScalarType: timestreamquerytypes.ScalarTypeDouble}},
+		},
+		Rows: []timestreamquerytypes.Row{{Data: []timestreamquerytypes.Datum{
+			{ScalarValue: aws.String("2024-01-01 00:00:00.000000000")},
+			{ScalarValue: aws.String("1.5")},
+		}}},
+	}}
+	ds := &timestreamDS{Client: client}
+	to := time.Date(2024, 1, 8, 0, 0, 0, 0, time.UTC)
+
+	dr := ds.ExecuteQuery(context.Background(), models.QueryModel{
+		RawQuery:      "SELECT time, value FROM db.tbl WHERE $__timeFilter AND measure_name = 'cpu'",
+		TimeRange:     backend.TimeRange{From: to.Add(-time.Hour), To: to},
+		Format:        models.FormatOptionTable,
+		CompareOffset: "1w",
+	})
+	require.NoError(t, dr.Error)
+	require.Len(t, client.calls.runQuery, 2)
+	assert.True(t, strings.Contains(*client.calls.runQuery[1].QueryString, "AND from_milliseconds(1704067200000)"))
+
+	require.Len(t, dr.Frames, 2)
+	assert.Equal(t, "value", dr.Frames[0].Fields[1].Name)
+	assert.Equal(t, "value (1w ago)", dr.Frames[1].Fields[1].Name)
+	assert.Equal(t, time.Date(2024, 1, 8, 0, 0, 0, 0, time.UTC), dr.Frames[1].Fields[0].At(0).(*time.Time).UTC())
+}
+
+func TestExecuteQuery_InvalidCompareOffset(t *testing.T) {
+	ds := &timestreamDS{Client: &fakeClient{}}
+	dr := ds.ExecuteQuery(context.Background(), models.QueryModel{RawQuery: "SELECT 1", CompareOffset: "yesterday"})
+	assert.Error(t, dr.Error)
+}
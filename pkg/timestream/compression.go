@@ -0,0 +1,103 @@
+package timestream
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/timestream-datasource/pkg/models"
+)
+
+// Responses smaller than this are sent uncompressed unless configured otherwise
+const defaultCompressionThreshold = 64 * 1024
+
+// compressionThreshold returns the configured threshold, or -1 when compression is disabled
+func compressionThreshold(configured int64) int64 {
+	if configured == 0 {
+		return defaultCompressionThreshold
+	}
+	if configured < 0 {
+		return -1
+	}
+	return configured
+}
+
+func acceptsGzip(req *backend.CallResourceRequest) bool {
+	for key, values := range req.Headers {
+		if !strings.EqualFold(key, "Accept-Encoding") {
+			continue
+		}
+		for _, v := range values {
+			if strings.Contains(strings.ToLower(v), "gzip") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// sendCompressed sends the body, gzip encoded when it exceeds the threshold and the client accepts it
+func sendCompressed(sender backend.CallResourceResponseSender, req *backend.CallResourceRequest, threshold int64, contentType string, body []byte) error {
+	headers := map[string][]string{"Content-Type": {contentType}}
+	if threshold >= 0 && int64(len(body)) >= threshold && acceptsGzip(req) {
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		if _, err := zw.Write(body); err != nil {
+			return err
+		}
+		if err := zw.Close(); err != nil {
+			return err
+		}
+		body = buf.Bytes()
+		headers["Content-Encoding"] = []string{"gzip"}
+	}
+	return sender.Send(&backend.CallResourceResponse{
+		Status:  http.StatusOK,
+		Headers: headers,
+		Body:    body,
+	})
+}
+
+// sendJSON is resource.SendJSON with compression of large payloads
+func (ds *timestreamDS) sendJSON(sender backend.CallResourceResponseSender, req *backend.CallResourceRequest, v any) error {
+	body, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return sendCompressed(sender, req, compressionThreshold(ds.Settings.CompressionThreshold), "application/json", body)
+}
+
+// export runs the query and sends all frames, as JSON or Arrow IPC
+func (ds *timestreamDS) export(ctx context.Context, sender backend.CallResourceResponseSender, req *backend.CallResourceRequest, opts models.ExportRequest) error {
+	query, err := ds.queryModel(backend.DataQuery{
+		JSON:      opts.Query,
+		TimeRange: backend.TimeRange{From: opts.From, To: opts.To},
+	}, time.Now())
+	if err != nil {
+		return err
+	}
+	// Exports always want the complete result
+	query.WaitForResult = true
+	dr := ds.ExecuteQuery(ctx, *query)
+	if dr.Error != nil {
+		return dr.Error
+	}
+
+	switch opts.Format {
+	case "", "json":
+		return ds.sendJSON(sender, req, dr.Frames)
+	case "arrow":
+		frames, err := dr.Frames.MarshalArrow()
+		if err != nil {
+			return err
+		}
+		return ds.sendJSON(sender, req, map[string][][]byte{"frames": frames})
+	}
+	return fmt.Errorf("unknown export format: %s", opts.Format)
+}
@@ -0,0 +1,100 @@
+package timestream
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/timestreamquery"
+	timestreamquerytypes "github.com/aws/aws-sdk-go-v2/service/timestreamquery/types"
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/grafana/timestream-datasource/pkg/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompressionThreshold(t *testing.T) {
+	assert.Equal(t, int64(defaultCompressionThreshold), compressionThreshold(0))
+	assert.Equal(t, int64(-1), compressionThreshold(-5))
+	assert.Equal(t, int64(10), compressionThreshold(10))
+}
+
+func TestSendCompressed(t *testing.T) {
+	body := []byte(strings.Repeat("timestream ", 100))
+	gzipReq := &backend.CallResourceRequest{Headers: map[string][]string{"accept-encoding": {"gzip, deflate"}}}
+
+	t.Run("large body is compressed", func(t *testing.T) {
+		sender := &fakeSender{}
+		require.NoError(t, sendCompressed(sender, gzipReq, 100, "application/json", body))
+		assert.Equal(t, []string{"gzip"}, sender.res.Headers["Content-Encoding"])
+		zr, err := gzip.NewReader(bytes.NewReader(sender.res.Body))
+		require.NoError(t, err)
+		decoded, err := io.ReadAll(zr)
+		require.NoError(t, err)
+		assert.Equal(t, body, decoded)
+	})
+
+	t.Run("small body, disabled or not accepted", func(t *testing.T) {
+		for _, tc := range []struct {
+			req       *backend.CallResourceRequest
+			threshold int64
+		}{
+			{gzipReq, int64(len(body) + 1)},
+			{gzipReq, -1},
+			{&backend.CallResourceRequest{}, 1},
+		} {
+			sender := &fakeSender{}
+			require.NoError(t, sendCompressed(sender, tc.req, tc.threshold, "application/json", body))
+			assert.Nil(t, sender.res.Headers["Content-Encoding"])
+			assert.Equal(t, body, sender.res.Body)
+		}
+	})
+}
+
+func TestExportResource(t *testing.T) {
+	client := &fakeClient{output: &timestreamquery.QueryOutput{
+		ColumnInfo: []timestreamquerytypes.ColumnInfo{
+			{Name: aws.String("v"), Type: &timestreamquerytypes.Type{ScalarType: "VARCHAR"}},
+		},
+		Rows: []timestreamquerytypes.Row{
+			{Data: []timestreamquerytypes.Datum{{ScalarValue: aws.String("a")}}},
+		},
+	}}
+	ds := &timestreamDS{Client: client}
+
+	for _, format := range []string{"json", "arrow"} {
+		body, _ := json.Marshal(models.ExportRequest{Query: json.RawMessage(`{"rawQuery":"SELECT 'a' AS v"}`), Format: format})
+		sender := &fakeSender{}
+		require.NoError(t, ds.CallResource(context.Background(), &backend.CallResourceRequest{Method: "POST", Path: "export", Body: body}, sender))
+		assert.Equal(t, []string{"application/json"}, sender.res.Headers["Content-Type"])
+		assert.NotEmpty(t, sender.res.Body)
+	}
+
+	body, _ := json.Marshal(models.ExportRequest{Query: json.RawMessage(`{}`), Format: "csv"})
+	assert.Error(t, ds.CallResource(context.Background(), &backend.CallResourceRequest{Method: "POST", Path: "export", Body: body}, &fakeSender{}))
+}
+
+func TestExportResource_QueryDefaults(t *testing.T) {
+	row := timestreamquerytypes.Row{Data: []timestreamquerytypes.Datum{{ScalarValue: aws.String("a")}}}
+	client := &fakeClient{output: &timestreamquery.QueryOutput{
+		ColumnInfo: []timestreamquerytypes.ColumnInfo{
+			{Name: aws.String("v"), Type: &timestreamquerytypes.Type{ScalarType: "VARCHAR"}},
+		},
+		Rows: []timestreamquerytypes.Row{row, row, row},
+	}}
+	ds := &timestreamDS{Client: client, Settings: models.DatasourceSettings{QueryDefaults: &models.QueryDefaults{MaxRows: 2}}}
+
+	body, _ := json.Marshal(models.ExportRequest{Query: json.RawMessage(`{"rawQuery":"SELECT 'a' AS v"}`)})
+	sender := &fakeSender{}
+	require.NoError(t, ds.CallResource(context.Background(), &backend.CallResourceRequest{Method: "POST", Path: "export", Body: body}, sender))
+	var frames data.Frames
+	require.NoError(t, json.Unmarshal(sender.res.Body, &frames))
+	require.Len(t, frames, 1)
+	assert.Equal(t, 2, frames[0].Rows())
+}
@@ -0,0 +1,222 @@
+package timestream
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"testing"
+
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/grafana/timestream-datasource/pkg/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// The frontend of the upstream grafana-timestream-datasource reads these keys of
+// the custom meta of the first frame, with the JSON type it expects. Renaming or
+// retyping one breaks pagination and the query inspector of upstream panels.
+var upstreamMetaKeys = map[string]string{
+	"queryId":             "string",
+	"nextToken":           "string",
+	"hasSeries":           "bool",
+	"executionStartTime":  "number",
+	"executionFinishTime": "number",
+	"status":              "object",
+}
+
+// Required by the upstream TimestreamCustomMeta type
+var upstreamRequiredMetaKeys = []string{"queryId", "status"}
+
+// The upstream query inspector shows these status keys as bytes
+var upstreamStatusKeys = []string{"CumulativeBytesMetered", "CumulativeBytesScanned"}
+
+const contractQuery = `SELECT * FROM "db"."tbl" WHERE time > ago(1h) AND measure_name = 'cpu'`
+
+func jsonKind(v any) string {
+	switch v.(type) {
+	case string:
+		return "string"
+	case bool:
+		return "bool"
+	case float64:
+		return "number"
+	case map[string]any:
+		return "object"
+	case []any:
+		return "array"
+	}
+	return "null"
+}
+
+// frontendType is the field type the frontend sees for a field
+func frontendType(t data.FieldType) string {
+	switch {
+	case t.Time():
+		return "time"
+	case t.Numeric():
+		return "number"
+	case t.NonNullableType() == data.FieldTypeString:
+		return "string"
+	case t.NonNullableType() == data.FieldTypeBool:
+		return "boolean"
+	}
+	return "other"
+}
+
+// frameShape lists the fields of a frame as name:type
+func frameShape(frame *data.Frame) []string {
+	shape := make([]string, 0, len(frame.Fields))
+	for _, f := range frame.Fields {
+		shape = append(shape, f.Name+":"+frontendType(f.Type()))
+	}
+	return shape
+}
+
+// schemaKey mirrors getSchemaKey of appendFrames.ts, the frontend appends the
+// frames of later pages to the frames of the first page with the same key
+func schemaKey(frame *data.Frame) string {
+	key := fmt.Sprintf("%s/%d", frame.RefID, len(frame.Fields))
+	for _, f := range frame.Fields {
+		key += "|" + f.Name + ":" + frontendType(f.Type())
+		if len(f.Labels) > 0 {
+			key += f.Labels.String()
+		}
+	}
+	return key
+}
+
+// frontendMeta decodes the custom meta of the frame the way the frontend receives it
+func frontendMeta(t *testing.T, frame *data.Frame) map[string]any {
+	t.Helper()
+	require.NotNil(t, frame.Meta)
+	b, err := json.Marshal(frame.Meta)
+	require.NoError(t, err)
+	meta := map[string]any{}
+	require.NoError(t, json.Unmarshal(b, &meta))
+	custom, ok := meta["custom"].(map[string]any)
+	require.True(t, ok, "first frame has no custom meta")
+	return custom
+}
+
+func assertUpstreamMeta(t *testing.T, frame *data.Frame) map[string]any {
+	t.Helper()
+	custom := frontendMeta(t, frame)
+	for _, key := range upstreamRequiredMetaKeys {
+		assert.Contains(t, custom, key)
+	}
+	for key, kind := range upstreamMetaKeys {
+		if v, ok := custom[key]; ok {
+			assert.Equal(t, kind, jsonKind(v), "meta key %s", key)
+		}
+	}
+	if status, ok := custom["status"].(map[string]any); ok {
+		for _, key := range upstreamStatusKeys {
+			assert.Equal(t, "number", jsonKind(status[key]), "status key %s", key)
+		}
+	}
+	assert.Equal(t, contractQuery, frame.Meta.ExecutedQueryString)
+	return custom
+}
+
+func contractResponse(t *testing.T, names ...string) []*data.Frame {
+	t.Helper()
+	ds := timestreamDS{Client: &MockClient{testFileNames: names}}
+	dr := ds.ExecuteQuery(context.Background(), models.QueryModel{RawQuery: contractQuery, WaitForResult: true})
+	require.NoError(t, dr.Error)
+	require.NotEmpty(t, dr.Frames)
+	return dr.Frames
+}
+
+func TestUpstreamContract_Tables(t *testing.T) {
+	tests := []struct {
+		name  string
+		shape []string
+	}{
+		{
+			name: "select-consts",
+			shape: []string{
+				"t_int32:number", "t_varchar:string", "timestamp:time", "interval_day_to_second:string",
+				"interval_year_to_month:string", "time:time", "date:time",
+			},
+		},
+		{
+			name:  "describe-table",
+			shape: []string{"Column:string", "Type:string", "Timestream attribute type:string"},
+		},
+		{
+			name:  "show-measures",
+			shape: []string{"measure_name:string", "data_type:string", "dimensions:string"},
+		},
+		{
+			name: "select-star",
+			shape: []string{
+				"availability_zone:string", "microservice_name:string", "hostname:string", "instance_name:string",
+				"process_name:string", "os_version:string", "az:string", "jdk_version:string", "region:string",
+				"cell:string", "silo:string", "instance_type:string", "measure_name:string", "time:time",
+				"measure_value::double:number", "measure_value::bigint:number", "measure_value::varchar:string",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			frames := contractResponse(t, tt.name)
+			require.Len(t, frames, 1, "table results are a single frame")
+			custom := assertUpstreamMeta(t, frames[0])
+			assert.NotContains(t, custom, "hasSeries")
+			assert.Equal(t, tt.shape, frameShape(frames[0]))
+		})
+	}
+}
+
+func TestUpstreamContract_TimeSeries(t *testing.T) {
+	for _, name := range []string{"complex-timeseries", "some-timeseries", "time-series-with-null-data-points"} {
+		t.Run(name, func(t *testing.T) {
+			frames := contractResponse(t, name)
+			custom := assertUpstreamMeta(t, frames[0])
+			assert.Equal(t, true, custom["hasSeries"])
+
+			// Upstream panels read one series per frame: the time and a value,
+			// labeled to tell the series apart
+			for _, frame := range frames {
+				require.Len(t, frame.Fields, 2)
+				assert.Equal(t, "time", frontendType(frame.Fields[0].Type()))
+				assert.Equal(t, "number", frontendType(frame.Fields[1].Type()))
+				if len(frames) > 1 {
+					assert.NotEmpty(t, frame.Fields[1].Labels)
+				}
+			}
+		})
+	}
+}
+
+func TestUpstreamContract_Pagination(t *testing.T) {
+	ds := timestreamDS{Client: &MockClient{testFileNames: []string{"pagination-off_1", "pagination-off_2"}}}
+
+	first := ds.ExecuteQuery(context.Background(), models.QueryModel{RawQuery: contractQuery})
+	require.NoError(t, first.Error)
+	require.NotEmpty(t, first.Frames)
+	custom := assertUpstreamMeta(t, first.Frames[0])
+	nextToken, _ := custom["nextToken"].(string)
+	require.NotEmpty(t, nextToken, "first page has no nextToken")
+
+	// The frontend requests the next page with the executed query and the token
+	next := ds.ExecuteQuery(context.Background(), models.QueryModel{
+		RawQuery:  first.Frames[0].Meta.ExecutedQueryString,
+		NextToken: nextToken,
+	})
+	require.NoError(t, next.Error)
+	require.NotEmpty(t, next.Frames)
+	assert.NotContains(t, frontendMeta(t, next.Frames[0]), "nextToken")
+
+	keys := func(frames data.Frames) []string {
+		var res []string
+		for _, frame := range frames {
+			res = append(res, schemaKey(frame))
+		}
+		sort.Strings(res)
+		return res
+	}
+	assert.Equal(t, keys(first.Frames), keys(next.Frames), "pages don't append in the frontend")
+	assert.NotEmpty(t, first.Frames[0].Fields)
+}
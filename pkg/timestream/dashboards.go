@@ -0,0 +1,113 @@
+package timestream
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/timestream-datasource/pkg/models"
+	"github.com/grafana/timestream-datasource/pkg/timestream/validator"
+)
+
+type demoPanel struct {
+	title     string
+	panelType string
+	format    models.FormatQueryOption
+	query     BuilderQuery
+}
+
+// demoDashboards lists the example dashboards, bound to the requested table
+func demoDashboards(req models.DashboardsRequest) map[string][]demoPanel {
+	base := BuilderQuery{Database: req.Database, Table: req.Table, Measure: req.Measure, ValueType: req.ValueType}
+	with := func(change func(*BuilderQuery)) BuilderQuery {
+		q := base
+		change(&q)
+		return q
+	}
+	dimension := []string{req.Dimension}
+
+	return map[string][]demoPanel{
+		"Device overview": {
+			{"Average per device", "timeseries", models.FormatOptionTimeSeries, with(func(q *BuilderQuery) {
+				q.Aggregation, q.Bin, q.GroupBy = "avg", true, dimension
+			})},
+			{"Maximum per device", "table", models.FormatOptionTable, with(func(q *BuilderQuery) {
+				q.Aggregation, q.GroupBy = "max", dimension
+			})},
+		},
+		"Fleet availability": {
+			{"Reported points", "timeseries", models.FormatOptionTimeSeries, with(func(q *BuilderQuery) {
+				q.Aggregation, q.Bin = "count", true
+			})},
+			{"Points per device", "table", models.FormatOptionTable, with(func(q *BuilderQuery) {
+				q.Aggregation, q.GroupBy = "count", dimension
+			})},
+		},
+		"Storage headroom": {
+			{"Minimum per device", "table", models.FormatOptionTable, with(func(q *BuilderQuery) {
+				q.Aggregation, q.GroupBy = "min", dimension
+			})},
+			{"Fleet minimum", "timeseries", models.FormatOptionTimeSeries, with(func(q *BuilderQuery) {
+				q.Aggregation, q.Bin = "min", true
+			})},
+		},
+	}
+}
+
+// generateDashboards renders the example dashboards. Every query is checked with the
+// configured validator so the dashboards work out of the box.
+func generateDashboards(req models.DashboardsRequest, datasourceUID string, settings models.DatasourceSettings) ([]map[string]any, error) {
+	if req.Database == "" || req.Table == "" || req.Measure == "" || req.Dimension == "" {
+		return nil, fmt.Errorf("database, table, measure and dimension are required")
+	}
+	datasource := map[string]any{"type": "grafana-timestream-datasource", "uid": datasourceUID}
+	now := time.Now()
+	sample := models.QueryModel{
+		TimeRange:     backend.TimeRange{From: now.Add(-time.Hour), To: now},
+		Interval:      time.Minute,
+		MaxDataPoints: 1024,
+	}
+
+	dashboards := []map[string]any{}
+	for _, title := range []string{"Device overview", "Fleet availability", "Storage headroom"} {
+		panels := []map[string]any{}
+		for i, panel := range demoDashboards(req)[title] {
+			sql, err := builderSQL(panel.query)
+			if err != nil {
+				return nil, err
+			}
+			sample.RawQuery = sql
+			raw, err := Interpolate(sample, settings)
+			if err != nil {
+				return nil, err
+			}
+			if valid, issues := validator.Validate(raw, settings.Validator); !valid {
+				return nil, fmt.Errorf("generated query for %q fails validation: %s", panel.title, validator.Errors(issues)[0].Reason)
+			}
+			panels = append(panels, map[string]any{
+				"id":         i + 1,
+				"title":      panel.title,
+				"type":       panel.panelType,
+				"datasource": datasource,
+				"gridPos":    map[string]int{"x": (i % 2) * 12, "y": (i / 2) * 8, "w": 12, "h": 8},
+				"targets": []map[string]any{{
+					"refId":      "A",
+					"datasource": datasource,
+					"database":   req.Database,
+					"table":      req.Table,
+					"measure":    req.Measure,
+					"rawQuery":   sql,
+					"format":     panel.format,
+				}},
+			})
+		}
+		dashboards = append(dashboards, map[string]any{
+			"title":         fmt.Sprintf("%s (%s.%s)", title, req.Database, req.Table),
+			"tags":          []string{"timestream", "generated"},
+			"time":          map[string]string{"from": "now-6h", "to": "now"},
+			"schemaVersion": 39,
+			"panels":        panels,
+		})
+	}
+	return dashboards, nil
+}
@@ -0,0 +1,31 @@
+package timestream
+
+import (
+	"testing"
+
+	"github.com/grafana/timestream-datasource/pkg/models"
+	"github.com/grafana/timestream-datasource/pkg/timestream/validator"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGenerateDashboards(t *testing.T) {
+	req := models.DashboardsRequest{Database: "db", Table: "metrics", Measure: "cpu", Dimension: "device"}
+	dashboards, err := generateDashboards(req, "ds-uid", models.DatasourceSettings{})
+	require.NoError(t, err)
+	require.Len(t, dashboards, 3)
+	assert.Equal(t, "Device overview (db.metrics)", dashboards[0]["title"])
+
+	panels := dashboards[0]["panels"].([]map[string]any)
+	require.Len(t, panels, 2)
+	target := panels[0]["targets"].([]map[string]any)[0]
+	assert.Equal(t, "ds-uid", target["datasource"].(map[string]any)["uid"])
+	assert.Contains(t, target["rawQuery"], `FROM "db"."metrics"`)
+
+	_, err = generateDashboards(models.DashboardsRequest{Database: "db"}, "", models.DatasourceSettings{})
+	assert.Error(t, err)
+
+	// The builder cannot satisfy a tenant rule it knows nothing about
+	_, err = generateDashboards(req, "", models.DatasourceSettings{Validator: &validator.Options{TenantDimension: "tenant"}})
+	assert.ErrorContains(t, err, "fails validation")
+}
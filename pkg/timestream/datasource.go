@@ -3,7 +3,9 @@ package timestream
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/grafana/grafana-aws-sdk/pkg/awsauth"
@@ -18,8 +20,10 @@ import (
 	"github.com/grafana/timestream-datasource/pkg/timestream/validator"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/aws/aws-sdk-go-v2/service/timestreamquery"
 	timestreamquerytypes "github.com/aws/aws-sdk-go-v2/service/timestreamquery/types"
+	"github.com/aws/aws-sdk-go-v2/service/timestreamwrite"
 )
 
 type QueryClient interface {
@@ -65,22 +69,194 @@ func NewDatasource(ctx context.Context, s backend.DataSourceInstanceSettings) (i
 		return nil, backend.DownstreamError(err)
 	}
 
+	primary := timestreamquery.NewFromConfig(cfg)
+	writer := timestreamwrite.NewFromConfig(cfg)
+	var client QueryClient = primary
+	if fallback := settings.Fallback; fallback != nil && (fallback.Region != "" || fallback.AssumeRoleARN != "") {
+		fallbackCfg, err := awsauth.NewConfigProvider().GetConfig(ctx, awsauth.Settings{
+			LegacyAuthType:     settings.AuthType,
+			AccessKey:          settings.AccessKey,
+			SecretKey:          settings.SecretKey,
+			Region:             valueOrDefault(fallback.Region, region),
+			CredentialsProfile: settings.Profile,
+			AssumeRoleARN:      valueOrDefault(fallback.AssumeRoleARN, settings.AssumeRoleARN),
+			ExternalID:         valueOrDefault(fallback.ExternalID, settings.ExternalID),
+			UserAgent:          "Timestream",
+			HTTPClient:         httpClient,
+		})
+		if err != nil {
+			return nil, backend.DownstreamError(err)
+		}
+		client = newFailoverClient(client, timestreamquery.NewFromConfig(fallbackCfg), fallback.FailureThreshold, time.Duration(fallback.CooldownSeconds)*time.Second)
+	}
+
+	accounts, err := newAccountClients(ctx, settings, region, httpClient)
+	if err != nil {
+		return nil, backend.DownstreamError(err)
+	}
+
+	rules, err := settings.Validator.Compile()
+	if err != nil {
+		return nil, errorsource.PluginError(err, false)
+	}
+	profiles, err := compileProfiles(settings)
+	if err != nil {
+		return nil, errorsource.PluginError(err, false)
+	}
+	if err := checkRewrites(settings.DisabledRewrites); err != nil {
+		return nil, errorsource.PluginError(err, false)
+	}
+	scrubber := literalScrubber{options: settings.LogScrubbing}
+	s3Client := s3.NewFromConfig(cfg)
+	lookups, err := newLookupStore(client, s3Client, settings.Lookups)
+	if err != nil {
+		return nil, errorsource.PluginError(err, false)
+	}
+	scope, principal := schemaIdentity(settings, region)
+	ds := &timestreamDS{
+		Settings: settings,
+		Client:   client,
+		Writer:   writer,
+		Scrubber: scrubber,
+		accounts: accounts,
+		rules:    rules,
+		profiles: profiles,
+		dryRun:   newDryRunTracker(settings.ValidatorDryRun, scrubber),
+		latency:  newLatencyTracker(time.Duration(settings.SlowQuerySeconds * float64(time.Second))),
+		support:  newSupportRecorder(),
+		lookups:  lookups,
+		running:  newRunningQueries(),
+		tables:   newTableSchemas(schemaSeenWindow),
+		samples:  newMeasureSamples(schemaSeenWindow),
+
+		schema:         sharedSchemaCache(scope),
+		principal:      principal,
+		schemaFailures: newFailureCache(schemaFailureTTL),
+		freshnessCache: newResultCache(freshnessTTL),
+		tagValuesCache: newResultCache(tagValuesTTL),
+		frames:         newFrameCache(time.Duration(settings.ResultCacheSeconds) * time.Second),
+		budget:         newQueryBudget(settings.QueryBudgetPerHour),
+	}
+	if settings.Materialization != nil {
+		ds.materializer = &materializer{settings: *settings.Materialization, scheduler: primary, tables: writer}
+	}
+	if ds.budget != nil {
+		if ds.frames == nil {
+			return nil, errorsource.PluginError(fmt.Errorf("queryBudgetPerHour requires resultCacheSeconds"), false)
+		}
+		ds.frames.staleFor = budgetStaleFor
+	}
+	keepWarm, err := parseKeepWarm(settings.KeepWarm, ds.frames)
+	if err != nil {
+		return nil, errorsource.PluginError(err, false)
+	}
+	if ds.handler, err = middlewareHandler(ds); err != nil {
+		return nil, errorsource.PluginError(err, false)
+	}
+	if settings.Audit != nil && settings.Audit.Bucket != "" {
+		sink := &s3AuditSink{client: s3Client, bucket: settings.Audit.Bucket, prefix: settings.Audit.Prefix}
+		ds.audit = newAuditLogger(sink, settings.Audit.BatchSize, time.Duration(settings.Audit.FlushIntervalSeconds)*time.Second)
+	}
+	// background work starts once nothing can fail anymore, Dispose stops it
+	if ds.frames != nil {
+		ds.prefetcher = ds.startPrefetcher()
+	}
+	if len(keepWarm) > 0 {
+		var ctx context.Context
+		ctx, ds.stopKeepWarm = context.WithCancel(context.Background())
+		go ds.keepWarm(ctx, keepWarm)
+	}
+	return ds, nil
+}
+
+// QueryRunner runs queries through the pipeline of the datasource: macro expansion,
+// validation, paging and conversion to frames
+type QueryRunner interface {
+	ExecuteQuery(ctx context.Context, query models.QueryModel) backend.DataResponse
+}
+
+// NewQueryRunner returns the query pipeline for a client created outside Grafana,
+// see the engine package
+func NewQueryRunner(client QueryClient, settings models.DatasourceSettings) (QueryRunner, error) {
+	rules, err := settings.Validator.Compile()
+	if err != nil {
+		return nil, err
+	}
+	profiles, err := compileProfiles(settings)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkRewrites(settings.DisabledRewrites); err != nil {
+		return nil, err
+	}
 	return &timestreamDS{
+		Client:   client,
 		Settings: settings,
-		Client:   timestreamquery.NewFromConfig(cfg),
+		Scrubber: literalScrubber{options: settings.LogScrubbing},
+		rules:    rules,
+		profiles: profiles,
 	}, nil
 }
 
 type timestreamDS struct {
 	Client   QueryClient
+	Writer   WriteClient
 	Settings models.DatasourceSettings
+	// Scrubber masks sensitive values of queries before they are logged or audited
+	Scrubber Scrubber
+	// accounts are the clients of the accounts multi-account queries run in
+	accounts []accountClient
+
+	rules *validator.Compiled
+	// profiles are the compiled validator options of the named profiles
+	profiles map[string]*validator.Compiled
+	dryRun   *dryRunTracker
+	audit    *auditLogger
+	latency  *latencyTracker
+	support  *supportRecorder
+	lookups  *lookupStore
+	running  *runningQueries
+	// materializer manages the scheduled queries of materialized tables, nil
+	// when materialization is not configured
+	materializer *materializer
+	// tables remembers the measures and columns listed for each table
+	tables *tableSchemas
+	// samples accumulates the measures of tables discovered by sampling
+	samples *measureSamples
+	// handler runs requests through the registered middlewares, nil without any
+	handler backend.Handler
+
+	// schema is shared with the datasources of the same account and region,
+	// principal is who this datasource queries as
+	schema         *schemaCache
+	principal      string
+	schemaFailures *failureCache
+	freshnessCache *resultCache
+	tagValuesCache *resultCache
+
+	// frames caches query responses, the prefetcher fills it for dashboards
+	frames       *frameCache
+	budget       *queryBudget
+	prefetcher   *prefetcher
+	stopKeepWarm context.CancelFunc
 }
 
 var (
-	_ backend.QueryDataHandler   = (*timestreamDS)(nil)
-	_ backend.CheckHealthHandler = (*timestreamDS)(nil)
+	_ backend.QueryDataHandler      = (*timestreamDS)(nil)
+	_ backend.CheckHealthHandler    = (*timestreamDS)(nil)
+	_ instancemgmt.InstanceDisposer = (*timestreamDS)(nil)
 )
 
+// Dispose flushes the pending audit records, stops prefetching and refreshing
+// keep-warm queries when the settings change or the plugin stops
+func (ds *timestreamDS) Dispose() {
+	ds.prefetcher.stop()
+	ds.audit.close()
+	if ds.stopKeepWarm != nil {
+		ds.stopKeepWarm()
+	}
+}
+
 // CheckHealth will check the currently configured settings
 func (ds *timestreamDS) CheckHealth(ctx context.Context, req *backend.CheckHealthRequest) (*backend.CheckHealthResult, error) {
 	// Connection is OK
@@ -116,18 +292,182 @@ func (ds *timestreamDS) CheckHealth(ctx context.Context, req *backend.CheckHealt
 
 // QueryData - Primary method called by grafana-server
 func (ds *timestreamDS) QueryData(ctx context.Context, req *backend.QueryDataRequest) (*backend.QueryDataResponse, error) {
+	// ExecuteQuery checks the validator profiles of queries against the user of the request
+	ctx = backend.WithPluginContext(ctx, req.PluginContext)
+	if ds.handler != nil {
+		return ds.handler.QueryData(ctx, req)
+	}
+	return ds.queryData(ctx, req)
+}
+
+func (ds *timestreamDS) queryData(ctx context.Context, req *backend.QueryDataRequest) (*backend.QueryDataResponse, error) {
 	res := backend.NewQueryDataResponse()
-	for _, q := range req.Queries {
-		query, err := models.GetQueryModel(q)
+	// merge and math queries, evaluated in order once the queries they reference ran
+	var derived []derivedQuery
+	// the queries they reference are read to the last page
+	referenced := map[string]bool{}
+	queries := make([]*models.QueryModel, len(req.Queries))
+	for i, q := range req.Queries {
+		query, err := ds.queryModel(q, time.Now())
 		if err != nil {
 			errorsource.AddErrorToResponse(q.RefID, res, err)
-		} else {
+			continue
+		}
+		queries[i] = query
+		if query.QueryType == models.QueryTypeMerge || query.QueryType == models.QueryTypeMath {
+			d := derivedQuery{refID: q.RefID, query: *query}
+			derived = append(derived, d)
+			for _, ref := range d.refs() {
+				referenced[ref] = true
+			}
+		}
+	}
+	for i, q := range req.Queries {
+		if query := queries[i]; query != nil && query.QueryType != models.QueryTypeMerge && query.QueryType != models.QueryTypeMath {
+			query.FromAlert = isAlertRequest(req)
+			query.WaitForResult = query.WaitForResult || referenced[q.RefID]
+			if problem := ds.profileProblem(req.PluginContext, query.ValidatorProfile); problem != nil {
+				res.Responses[q.RefID] = rejectedResponse(problem, query.RawQuery, problem.Detail)
+				continue
+			}
+			// responses served from the cache are audited, they may have been prefetched
+			if cached, ok := ds.frames.get(*query, time.Now()); ok {
+				res.Responses[q.RefID] = cached
+				ds.auditQuery(ctx, q.RefID, *query, cached)
+				continue
+			}
+			// alerts always run, but spend the budget of dashboard refreshes
+			if !ds.budget.takeN(time.Now(), ds.queryCost(*query)) && !query.FromAlert {
+				if stale, stored, ok := ds.frames.getStale(*query, time.Now()); ok {
+					res.Responses[q.RefID] = ds.budget.budgetResponse(stale, stored, time.Now())
+					ds.auditQuery(ctx, q.RefID, *query, res.Responses[q.RefID])
+					continue
+				}
+			}
 			res.Responses[q.RefID] = ds.ExecuteQuery(ctx, *query)
+			ds.frames.put(*query, res.Responses[q.RefID], time.Now())
+			if query.FromAlert {
+				annotateAlertChecksum(q.RefID, *query, res.Responses[q.RefID])
+			}
+			rules, _ := ds.Settings.ValidatorOptions(query.ValidatorProfile)
+			ds.audit.record(auditRecord(req.PluginContext, q.RefID, *query, res.Responses[q.RefID], ds.Scrubber, rules))
+			ds.support.record(*query, res.Responses[q.RefID], time.Now())
 		}
 	}
+	for _, d := range derived {
+		res.Responses[d.refID] = d.execute(res.Responses)
+	}
 	return res, nil
 }
 
+// metadataQuery runs the SQL of a resource, e.g. the values of an ad-hoc filter,
+// with the checks of panel queries: the user of the plugin context of ctx has
+// to be allowed the validator profile of the query and the SQL has to pass its
+// rules. Results are answered from the cache, running the query spends the
+// query budget. Pages are read until maxRows rows arrived, every page when it
+// is zero. Every lookup is audited.
+func (ds *timestreamDS) metadataQuery(ctx context.Context, cache *resultCache, refID string, query models.QueryModel, maxRows int, now time.Time) (*timestreamquery.QueryOutput, error) {
+	output, err := ds.runMetadataQuery(ctx, cache, query, maxRows, now)
+	ds.auditQuery(ctx, refID, query, backend.DataResponse{Error: err})
+	return output, err
+}
+
+func (ds *timestreamDS) runMetadataQuery(ctx context.Context, cache *resultCache, query models.QueryModel, maxRows int, now time.Time) (*timestreamquery.QueryOutput, error) {
+	if problem := ds.profileProblem(backend.PluginConfigFromContext(ctx), query.ValidatorProfile); problem != nil {
+		return nil, rejectedResponse(problem, query.RawQuery, problem.Detail).Error
+	}
+	rules, err := ds.rulesFor(query.ValidatorProfile)
+	if err != nil {
+		return nil, err
+	}
+	if valid, issues := rules.Validate(query.RawQuery); !valid {
+		return nil, problemResponse(validationProblem(issues), query.RawQuery).Error
+	}
+	if output, ok := cache.get(query.RawQuery, now); ok {
+		return output, nil
+	}
+	if !ds.budget.take(now) {
+		return nil, fmt.Errorf("the query budget of the datasource is spent")
+	}
+	client := ds.queryClient(ctx)
+	input := &timestreamquery.QueryInput{QueryString: aws.String(query.RawQuery)}
+	output, err := client.Query(ctx, input)
+	for err == nil && output.NextToken != nil && (maxRows == 0 || len(output.Rows) < maxRows) {
+		var page *timestreamquery.QueryOutput
+		page, err = client.Query(ctx, &timestreamquery.QueryInput{QueryString: input.QueryString, NextToken: output.NextToken})
+		if err == nil {
+			output.Rows = append(output.Rows, page.Rows...)
+			output.NextToken = page.NextToken
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	cache.put(query.RawQuery, output, now)
+	return output, nil
+}
+
+// queryModel parses a query with the defaults of the datasource and shifts its
+// time range by the ingestion delay
+func (ds *timestreamDS) queryModel(q backend.DataQuery, now time.Time) (*models.QueryModel, error) {
+	query, err := models.GetQueryModelWithDefaults(q, ds.Settings.QueryDefaults)
+	if err != nil {
+		return nil, err
+	}
+	query.TimeRange = shiftForIngestionDelay(query.TimeRange, time.Duration(ds.Settings.IngestionDelaySeconds)*time.Second, now)
+	return query, nil
+}
+
+// rulesFor returns the compiled validator options of the profile, the default
+// ones for an empty name. They are compiled on demand for datasources not
+// created by NewDatasource.
+func (ds *timestreamDS) rulesFor(profile string) (*validator.Compiled, error) {
+	if profile == "" && ds.rules != nil {
+		return ds.rules, nil
+	}
+	if rules, ok := ds.profiles[profile]; ok {
+		return rules, nil
+	}
+	opts, err := ds.Settings.ValidatorOptions(profile)
+	if err != nil {
+		return nil, err
+	}
+	return opts.Compile()
+}
+
+// compileProfiles compiles the validator options of the profiles of the settings
+func compileProfiles(settings models.DatasourceSettings) (map[string]*validator.Compiled, error) {
+	profiles := map[string]*validator.Compiled{}
+	for name, p := range settings.ValidatorProfiles {
+		rules, err := p.Validator.Compile()
+		if err != nil {
+			return nil, fmt.Errorf("validatorProfiles: %s: %w", name, err)
+		}
+		profiles[name] = rules
+	}
+	return profiles, nil
+}
+
+// profileProblem describes why the user of the request may not select the
+// validator profile of the query, nil when they may
+func (ds *timestreamDS) profileProblem(pCtx backend.PluginContext, profile string) *models.Problem {
+	if profile == "" {
+		return nil
+	}
+	p, ok := ds.Settings.ValidatorProfiles[profile]
+	if !ok {
+		return newProblem(codeProfile, backend.StatusBadRequest, fmt.Sprintf("unknown validator profile %q", profile))
+	}
+	role := ""
+	if pCtx.User != nil {
+		role = pCtx.User.Role
+	}
+	if !p.Allows(role) {
+		return newProblem(codeProfileAccess, backend.StatusForbidden, fmt.Sprintf("validator profile %q is not allowed for role %q", profile, role))
+	}
+	return nil
+}
+
 func sliceFromRows(rows []timestreamquerytypes.Row, doubleQuotes bool) []string {
 	res := []string{}
 	for _, row := range rows {
@@ -159,9 +499,219 @@ func dimensionsFromRows(rows []timestreamquerytypes.Row) []string {
 
 // CallResource HTTP style resource
 func (ds *timestreamDS) CallResource(ctx context.Context, req *backend.CallResourceRequest, sender backend.CallResourceResponseSender) error {
+	ctx = backend.WithPluginContext(ctx, req.PluginContext)
+	if ds.handler != nil {
+		return ds.handler.CallResource(ctx, req, sender)
+	}
+	return ds.callResource(ctx, req, sender)
+}
+
+func (ds *timestreamDS) callResource(ctx context.Context, req *backend.CallResourceRequest, sender backend.CallResourceResponseSender) error {
 	if req.Path == "hello" {
 		return resource.SendPlainText(sender, "world")
 	}
+	if req.Path == "alert-state" {
+		if req.Method != "POST" {
+			return fmt.Errorf("alert-state requires a post command")
+		}
+		if ds.Settings.AlertStateTable == nil || ds.Writer == nil {
+			return fmt.Errorf("alert state write-back is not configured")
+		}
+		alerts := models.AlertStateRequest{}
+		err := json.Unmarshal(req.Body, &alerts)
+		if err != nil {
+			return fmt.Errorf("error reading alert state request: %s", err.Error())
+		}
+		written, err := writeAlertStates(ctx, ds.Writer, *ds.Settings.AlertStateTable, alerts)
+		if err != nil {
+			return err
+		}
+		return resource.SendJSON(sender, map[string]int{"written": written})
+	}
+	if req.Path == "dashboards" {
+		if req.Method != "POST" {
+			return fmt.Errorf("dashboards requires a post command")
+		}
+		opts := models.DashboardsRequest{}
+		err := json.Unmarshal(req.Body, &opts)
+		if err != nil {
+			return err
+		}
+		if opts.ValueType == "" && opts.Measure != "" {
+			if opts.ValueType, err = ds.measureType(ctx, opts.Database, opts.Table, opts.Measure); err != nil {
+				return err
+			}
+		}
+		uid := ""
+		if req.PluginContext.DataSourceInstanceSettings != nil {
+			uid = req.PluginContext.DataSourceInstanceSettings.UID
+		}
+		dashboards, err := generateDashboards(opts, uid, ds.Settings)
+		if err != nil {
+			return err
+		}
+		return ds.sendJSON(sender, req, dashboards)
+	}
+	if req.Path == "builder" {
+		if req.Method != "POST" {
+			return fmt.Errorf("builder requires a post command")
+		}
+		query := BuilderQuery{}
+		err := json.Unmarshal(req.Body, &query)
+		if err != nil {
+			return err
+		}
+		if query.ValueType == "" && query.Database != "" && query.Table != "" && query.Measure != "" {
+			if query.ValueType, err = ds.measureType(ctx, query.Database, query.Table, query.Measure); err != nil {
+				return err
+			}
+		}
+		sql, err := builderSQL(query)
+		if err != nil {
+			return err
+		}
+		return resource.SendJSON(sender, map[string]string{"sql": sql, "valueType": query.ValueType})
+	}
+	if req.Path == "export" {
+		if req.Method != "POST" {
+			return fmt.Errorf("export requires a post command")
+		}
+		opts := models.ExportRequest{}
+		err := json.Unmarshal(req.Body, &opts)
+		if err != nil {
+			return err
+		}
+		return ds.export(ctx, sender, req, opts)
+	}
+	if req.Path == "query-schema" {
+		return resource.SendJSON(sender, models.QuerySchema())
+	}
+	if req.Path == "slow-queries" {
+		if user := req.PluginContext.User; user == nil || user.Role != "Admin" {
+			return fmt.Errorf("slow-queries requires the Admin role")
+		}
+		return resource.SendJSON(sender, ds.latency.worst(slowQueriesListed))
+	}
+	if req.Path == "freshness" {
+		if req.Method != "POST" {
+			return fmt.Errorf("freshness requires a post command")
+		}
+		opts := models.FreshnessRequest{}
+		err := json.Unmarshal(req.Body, &opts)
+		if err != nil {
+			return err
+		}
+		freshness, err := ds.freshness(ctx, opts, time.Now())
+		if err != nil {
+			return err
+		}
+		return resource.SendJSON(sender, freshness)
+	}
+	if req.Path == "compare" {
+		if req.Method != "POST" {
+			return fmt.Errorf("compare requires a post command")
+		}
+		opts := models.CompareTablesRequest{}
+		err := json.Unmarshal(req.Body, &opts)
+		if err != nil {
+			return err
+		}
+		comparison, err := ds.compareTables(ctx, opts)
+		if err != nil {
+			return err
+		}
+		return resource.SendJSON(sender, comparison)
+	}
+	if req.Path == "prefetch" {
+		if req.Method != "POST" {
+			return fmt.Errorf("prefetch requires a post command")
+		}
+		opts := models.PrefetchRequest{}
+		err := json.Unmarshal(req.Body, &opts)
+		if err != nil {
+			return err
+		}
+		queries, err := ds.prefetchQueries(opts, time.Now())
+		if err != nil {
+			return err
+		}
+		if !ds.prefetcher.enqueue(req.PluginContext, queries) {
+			return fmt.Errorf("too many dashboards are being prefetched, try again later")
+		}
+		return resource.SendJSON(sender, map[string]int{"queued": len(queries)})
+	}
+	if req.Path == "tag-keys" {
+		if req.Method != "POST" {
+			return fmt.Errorf("tag-keys requires a post command")
+		}
+		opts := models.TagKeysRequest{}
+		if len(req.Body) > 0 {
+			if err := json.Unmarshal(req.Body, &opts); err != nil {
+				return err
+			}
+		}
+		keys, err := ds.tagKeys(ctx, opts)
+		if err != nil {
+			return err
+		}
+		return resource.SendJSON(sender, keys)
+	}
+	if req.Path == "tag-values" {
+		if req.Method != "POST" {
+			return fmt.Errorf("tag-values requires a post command")
+		}
+		opts := models.TagValuesRequest{}
+		err := json.Unmarshal(req.Body, &opts)
+		if err != nil {
+			return err
+		}
+		values, err := ds.tagValues(ctx, opts, time.Now())
+		if err != nil {
+			return err
+		}
+		return resource.SendJSON(sender, values)
+	}
+	if req.Path == "lookups" || req.Path == "lookups/refresh" {
+		if user := req.PluginContext.User; user == nil || user.Role != "Admin" {
+			return fmt.Errorf("lookups requires the Admin role")
+		}
+		if req.Path == "lookups/refresh" {
+			if req.Method != "POST" {
+				return fmt.Errorf("lookups/refresh requires a post command")
+			}
+			opts := models.LookupRefreshRequest{}
+			if len(req.Body) > 0 {
+				if err := json.Unmarshal(req.Body, &opts); err != nil {
+					return err
+				}
+			}
+			if err := ds.lookups.refresh(ctx, opts.Name, time.Now()); err != nil {
+				return err
+			}
+		}
+		return resource.SendJSON(sender, ds.lookups.list())
+	}
+	if req.Path == "materializations" || strings.HasPrefix(req.Path, "materializations/") {
+		if user := req.PluginContext.User; user == nil || user.Role != "Admin" {
+			return fmt.Errorf("materializations requires the Admin role")
+		}
+		if ds.materializer == nil {
+			return fmt.Errorf("materialization is not configured")
+		}
+		return ds.materializationResource(ctx, req, sender)
+	}
+	if req.Path == "support-bundle" {
+		if user := req.PluginContext.User; user == nil || user.Role != "Admin" {
+			return fmt.Errorf("support-bundle requires the Admin role")
+		}
+		return ds.sendSupportBundle(ctx, sender)
+	}
+	if req.Path == "validator/dry-run" {
+		return resource.SendJSON(sender, ds.dryRun.snapshot(time.Now()))
+	}
+	if req.Path == "queries/running" {
+		return resource.SendJSON(sender, ds.running.list(req.PluginContext.User))
+	}
 	if req.Path == "cancel" {
 		if req.Method != "POST" {
 			return fmt.Errorf("cancel requires a post command")
@@ -176,6 +726,13 @@ func (ds *timestreamDS) CallResource(ctx context.Context, req *backend.CallResou
 			QueryId: aws.String(cancel.QueryID),
 		}
 		msg := "cancel: " + cancel.QueryID
+		// stop paging first, so no further page of the query is requested.
+		// Users may cancel their running queries, admins any query
+		if !ds.running.cancel(cancel.QueryID, req.PluginContext.User) {
+			if user := req.PluginContext.User; user == nil || user.Role != "Admin" {
+				return fmt.Errorf("query %s is not a running query of the user", cancel.QueryID)
+			}
+		}
 		v, err := ds.Client.CancelQuery(ctx, cancelQueryInput)
 		if v != nil && v.CancellationMessage != nil {
 			msg = *v.CancellationMessage
@@ -186,9 +743,7 @@ func (ds *timestreamDS) CallResource(ctx context.Context, req *backend.CallResou
 	}
 	if req.Path == "databases" {
 		// TODO: Use API endpoint to list databases
-		v, err := ds.Client.Query(ctx, &timestreamquery.QueryInput{
-			QueryString: aws.String("SHOW DATABASES"),
-		})
+		v, err := ds.schemaQuery(ctx, "SHOW DATABASES")
 		if err != nil {
 			return err
 		}
@@ -205,15 +760,23 @@ func (ds *timestreamDS) CallResource(ctx context.Context, req *backend.CallResou
 			return err
 		}
 		// TODO: Use API endpoint to list tables
-		v, err := ds.Client.Query(ctx, &timestreamquery.QueryInput{
-			QueryString: aws.String(fmt.Sprintf("SHOW TABLES FROM %s", applyQuotesIfNeeded(opts.Database))),
-		})
+		v, err := ds.schemaQuery(ctx, fmt.Sprintf("SHOW TABLES FROM %s", applyQuotesIfNeeded(opts.Database)))
 		if err != nil {
 			return err
 		}
 		// Tables are returned wrapped in double quotes
 		return resource.SendJSON(sender, sliceFromRows(v.Rows, true))
 	}
+	if database, table, ok := parseRetentionPath(req.Path); ok {
+		if ds.Writer == nil {
+			return fmt.Errorf("retention requires the Timestream write API")
+		}
+		retention, err := tableRetention(ctx, ds.Writer, database, table, time.Now())
+		if err != nil {
+			return err
+		}
+		return resource.SendJSON(sender, retention)
+	}
 	if req.Path == "measures" || req.Path == "dimensions" {
 		if req.Method != "POST" {
 			return fmt.Errorf("measures requires a post command")
@@ -223,9 +786,7 @@ func (ds *timestreamDS) CallResource(ctx context.Context, req *backend.CallResou
 		if err != nil {
 			return err
 		}
-		v, err := ds.Client.Query(ctx, &timestreamquery.QueryInput{
-			QueryString: aws.String(fmt.Sprintf("SHOW MEASURES FROM %s.%s", applyQuotesIfNeeded(opts.Database), applyQuotesIfNeeded(opts.Table))),
-		})
+		v, err := ds.showMeasures(ctx, opts.Database, opts.Table)
 		if err != nil {
 			return err
 		}
@@ -246,15 +807,92 @@ func applyQuotesIfNeeded(input string) string {
 	return input
 }
 
-// ExecuteQuery -- run a query
+// ExecuteQuery -- run a query. Its validator profile is checked against the
+// user of the plugin context of ctx, every path running queries comes here.
 func (ds *timestreamDS) ExecuteQuery(ctx context.Context, query models.QueryModel) backend.DataResponse {
-	raw, err := Interpolate(query, ds.Settings)
+	if wholeResult(query) {
+		query.WaitForResult = true
+	}
+	return finishFrames(ds.executeQuery(ctx, query), query)
+}
+
+// runningQuery describes the query of output for the user of the plugin context
+// of ctx, start is when it was sent
+func (ds *timestreamDS) runningQuery(ctx context.Context, query models.QueryModel, raw string, output *timestreamquery.QueryOutput, start int64) RunningQuery {
+	running := RunningQuery{
+		QueryID:     aws.ToString(output.QueryId),
+		Fingerprint: queryFingerprint(query.RawQuery),
+		Query:       scrubSQL(ds.Scrubber, raw),
+		StartedAt:   time.UnixMilli(start),
+	}
+	if user := backend.PluginConfigFromContext(ctx).User; user != nil {
+		running.User = user.Login
+	}
+	return running
+}
+
+// executeQuery runs a query without the post-processing of its whole result,
+// sub-queries run here and are post-processed once merged
+func (ds *timestreamDS) executeQuery(ctx context.Context, query models.QueryModel) backend.DataResponse {
+	if problem := ds.profileProblem(backend.PluginConfigFromContext(ctx), query.ValidatorProfile); problem != nil {
+		return rejectedResponse(problem, query.RawQuery, problem.Detail)
+	}
+	if query.QueryType == models.QueryTypeFreshness {
+		return ds.executeFreshness(ctx, query)
+	}
+	if query.QueryType == models.QueryTypePreview {
+		return ds.executePreview(ctx, query)
+	}
+	if query.QueryType == models.QueryTypeLogContext {
+		return ds.executeLogContext(ctx, query)
+	}
+	if query.QueryType == models.QueryTypeMerge || query.QueryType == models.QueryTypeMath {
+		return errorsource.Response(errorsource.DownstreamError(fmt.Errorf("%s queries only run as part of a request with the queries they reference", query.QueryType), false))
+	}
+	if query.QueryType == models.QueryTypeMultiAccount {
+		return ds.executeMultiAccount(ctx, query)
+	}
+	if query.CompareOffset != "" && query.NextToken == "" {
+		return ds.executeComparison(ctx, query)
+	}
+	if query.SplitInterval != "" && query.NextToken == "" {
+		return ds.executeSplit(ctx, query)
+	}
+	timeout, err := queryTimeout(query, ds.Settings)
+	if err != nil {
+		return errorsource.Response(errorsource.DownstreamError(err, false))
+	}
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	query.ListTables = ds.listTables(ctx)
+	raw, err := rewrite(ctx, query, ds.Settings)
 	if err != nil {
 		return errorsource.Response(err)
 	}
-	valid, issues := validator.Validate(raw)
+	rules, err := ds.rulesFor(query.ValidatorProfile)
+	if err != nil {
+		return rejectedResponse(newProblem(codeOptions, backend.StatusBadRequest, err.Error()), raw, err.Error())
+	}
+	valid, issues := rules.Validate(raw)
+	ds.dryRun.observe(raw, valid, time.Now())
+	repaired := 0
+	if !valid && ds.Settings.RepairTimeFilter {
+		if fixed, n := rules.Rewrite(raw, validator.TimeRange{From: query.TimeRange.From, To: query.TimeRange.To}); n > 0 {
+			if ok, fixedIssues := rules.Validate(fixed); ok {
+				raw, valid, issues, repaired = fixed, ok, fixedIssues, n
+			}
+		}
+	}
 	if !valid {
-		return backend.ErrDataResponse(backend.StatusBadRequest, "reasonable query check failed: "+issues[0].Reason)
+		return problemResponse(validationProblem(issues), raw)
+	}
+	// the tables of other accounts aren't described
+	if query.NextToken == "" && ctx.Value(accountClientKey{}) == nil {
+		opts, _ := ds.Settings.ValidatorOptions(query.ValidatorProfile)
+		issues = append(issues, ds.unknownDimensions(ctx, raw, opts)...)
 	}
 	input := &timestreamquery.QueryInput{
 		QueryString: aws.String(raw),
@@ -262,34 +900,92 @@ func (ds *timestreamDS) ExecuteQuery(ctx context.Context, query models.QueryMode
 
 	if query.NextToken != "" {
 		input.NextToken = aws.String(query.NextToken)
-		backend.Logger.Info("running continue query", "query", raw, "token", query.NextToken)
+		backend.Logger.Info("running continue query", "query", scrubSQL(ds.Scrubber, raw), "token", query.NextToken)
 	} else {
-		backend.Logger.Info("starting query", "query", raw)
+		backend.Logger.Info("starting query", "query", scrubSQL(ds.Scrubber, raw))
 	}
 
+	ctx = withFallbackMarker(ctx)
+	var stopPaging context.CancelFunc
+	if query.WaitForResult {
+		ctx, stopPaging = context.WithCancel(ctx)
+		defer stopPaging()
+	}
 	start := time.Now().UnixMilli()
-	output, err := ds.Client.Query(ctx, input)
+	// set when paging stopped at the deadline of the request
+	truncated := false
+	client := ds.queryClient(ctx)
+	output, err := client.Query(ctx, input)
+	// the client requests the further pages, and may cancel the query meanwhile
+	if err == nil && !query.WaitForResult {
+		ds.running.page(ds.runningQuery(ctx, query, raw, output, start), output.NextToken == nil)
+	}
 	if err == nil && query.WaitForResult && output.NextToken != nil {
-		for output.NextToken != nil {
+		done := ds.running.start(ds.runningQuery(ctx, query, raw, output, start), stopPaging)
+		defer done()
+		slowestPage := time.Since(time.UnixMilli(start))
+		for output.NextToken != nil && !reachedMaxRows(output, query.MaxRows) {
+			// the rows collected so far are better than a timeout after all the work
+			if deadlineNear(ctx, slowestPage, time.Now()) {
+				truncated = true
+				output.NextToken = nil
+				continue
+			}
+			pageStart := time.Now()
 			newPageInput := *input
 			newPageInput.NextToken = output.NextToken
-			newPageOutput, newPageErr := ds.Client.Query(ctx, &newPageInput)
+			newPageOutput, newPageErr := client.Query(ctx, &newPageInput)
+			for retries := 0; newPageErr != nil && retries < maxPageRetries && waitForRetry(ctx, newPageErr); retries++ {
+				newPageOutput, newPageErr = client.Query(ctx, &newPageInput)
+			}
 			if newPageErr != nil {
-				err = newPageErr
+				if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+					truncated = true
+				} else {
+					err = newPageErr
+				}
 				output.NextToken = nil
 				continue
 			}
 			output.Rows = append(output.Rows, newPageOutput.Rows...)
 			output.NextToken = newPageOutput.NextToken
+			slowestPage = max(slowestPage, time.Since(pageStart))
 		}
 	}
 
 	dr := backend.DataResponse{}
 	if err == nil {
-		dr = QueryResultToDataFrame(output, query.Format)
+		query.StateMappings = ds.Settings.StateMappings
+		dr = QueryResultToDataFrame(output, query)
+		if isExplainQuery(raw) {
+			dr = explainResponse(dr)
+		}
+		if len(query.Enrich) > 0 && dr.Error == nil {
+			if err := ds.enrichFrames(ctx, dr.Frames, query.Enrich); err != nil {
+				dr.Frames[0].AppendNotices(data.Notice{Severity: data.NoticeSeverityWarning, Text: "enrichment failed: " + err.Error()})
+			}
+		}
+		if truncated && dr.Error == nil {
+			dr.Frames[0].AppendNotices(data.Notice{
+				Severity: data.NoticeSeverityWarning,
+				Text:     fmt.Sprintf("Results truncated due to timeout after %d rows", len(output.Rows)),
+			})
+		}
 	} else {
+		if timeout > 0 && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			err = fmt.Errorf("query timed out after %s: %w", timeout, err)
+		} else if errors.Is(ctx.Err(), context.Canceled) && output != nil && output.QueryId != nil {
+			err = fmt.Errorf("query %s was cancelled: %w", *output.QueryId, err)
+		}
+		quotaErr := asQuotaError(err)
+		if quotaErr != nil {
+			err = quotaErr
+		}
 		// override: false here because runQuery may return a PluginError
 		dr = errorsource.Response(errorsource.DownstreamError(err, false))
+		if quotaErr != nil {
+			dr.Status = backend.StatusTooManyRequests
+		}
 	}
 	finish := time.Now().UnixMilli()
 
@@ -301,7 +997,13 @@ func (ds *timestreamDS) ExecuteQuery(ctx context.Context, query models.QueryMode
 	if frame.Meta == nil {
 		frame.SetMeta(&data.FrameMeta{})
 	}
-	frame.Meta.ExecutedQueryString = raw
+	// every series frame carries the query, e.g. for correlations from its fields
+	for _, f := range dr.Frames {
+		if f.Meta == nil {
+			f.SetMeta(&data.FrameMeta{})
+		}
+		f.Meta.ExecutedQueryString = raw
+	}
 
 	if frame.Meta.Custom == nil {
 		frame.Meta.Custom = &models.TimestreamCustomMeta{}
@@ -310,6 +1012,48 @@ func (ds *timestreamDS) ExecuteQuery(ctx context.Context, query models.QueryMode
 		c := frame.Meta.Custom.(*models.TimestreamCustomMeta)
 		c.Status = output.QueryStatus
 	}
+	if c := frame.Meta.Custom.(*models.TimestreamCustomMeta); output != nil && output.QueryId != nil && c.QueryID == "" {
+		// failed queries keep their id, e.g. to look them up in CloudTrail
+		c.QueryID = *output.QueryId
+	}
+	if truncated && err == nil {
+		frame.Meta.Custom.(*models.TimestreamCustomMeta).TruncatedByTimeout = true
+	}
+	if quotaErr := asQuotaError(err); quotaErr != nil {
+		c := frame.Meta.Custom.(*models.TimestreamCustomMeta)
+		c.QuotaExceeded = string(quotaErr.Quota)
+		c.RetryAfterMs = quotaErr.RetryAfter.Milliseconds()
+	}
+	if err == nil && input.NextToken == nil {
+		fingerprint := queryFingerprint(query.RawQuery)
+		ds.latency.observe(fingerprint, scrubSQL(ds.Scrubber, raw), time.Duration(finish-start)*time.Millisecond, time.Now())
+		if text, slow := ds.latency.sloNotice(fingerprint); slow {
+			frame.AppendNotices(data.Notice{Severity: data.NoticeSeverityWarning, Text: text})
+		}
+	}
+	if err == nil && input.NextToken == nil && dr.Error == nil {
+		frame.AppendNotices(ds.driftNotices(ctx, raw)...)
+	}
+	if repaired > 0 {
+		frame.AppendNotices(data.Notice{
+			Severity: data.NoticeSeverityWarning,
+			Text:     fmt.Sprintf("Added the time range of the query to %d SELECTs without a time filter", repaired),
+		})
+	}
+	for _, issue := range validator.Warnings(issues) {
+		if issue.Waiver != "" {
+			// relaxed by a comment of the query
+			frame.AppendNotices(data.Notice{Severity: data.NoticeSeverityInfo, Text: fmt.Sprintf("%s, allowed: %s", issue.Reason, issue.Waiver)})
+			continue
+		}
+		frame.AppendNotices(data.Notice{Severity: data.NoticeSeverityWarning, Text: issue.Reason})
+	}
+	if servedFromFallback(ctx) {
+		frame.AppendNotices(data.Notice{
+			Severity: data.NoticeSeverityInfo,
+			Text:     "served from fallback",
+		})
+	}
 
 	// Apply the timing info
 	meta := frame.Meta.Custom.(*models.TimestreamCustomMeta)
@@ -8,11 +8,15 @@ import (
 	"github.com/grafana/grafana-plugin-sdk-go/experimental"
 	"github.com/grafana/timestream-datasource/pkg/models"
 	"os"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/timestreamquery"
 	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/grafana/timestream-datasource/pkg/timestream/validator"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -28,7 +32,9 @@ func (f *fakeSender) Send(res *backend.CallResourceResponse) error {
 
 type fakeClient struct {
 	output *timestreamquery.QueryOutput
+	err    error
 
+	mu    sync.Mutex
 	calls runnerCalls
 }
 
@@ -37,8 +43,10 @@ type runnerCalls struct {
 }
 
 func (f *fakeClient) Query(_ context.Context, input *timestreamquery.QueryInput, _ ...func(*timestreamquery.Options)) (*timestreamquery.QueryOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
 	f.calls.runQuery = append(f.calls.runQuery, input)
-	return f.output, nil
+	return f.output, f.err
 }
 
 func (f *fakeClient) CancelQuery(context.Context, *timestreamquery.CancelQueryInput, ...func(*timestreamquery.Options)) (*timestreamquery.CancelQueryOutput, error) {
@@ -136,6 +144,16 @@ func TestCallResource(t *testing.T) {
 	}
 }
 
+func TestCallResource_QuerySchema(t *testing.T) {
+	sender := &fakeSender{}
+	require.NoError(t, (&timestreamDS{}).CallResource(context.Background(), &backend.CallResourceRequest{Path: "query-schema"}, sender))
+
+	schema := map[string]any{}
+	require.NoError(t, json.Unmarshal(sender.res.Body, &schema))
+	assert.Equal(t, "Timestream query", schema["title"])
+	assert.Contains(t, schema["properties"], "rawQuery")
+}
+
 func Test_runQuery_always_wraps_db_and_table_name_in_quotes(t *testing.T) {
 	testCases := []struct {
 		name, resource, requestBody, expectedQuery string
@@ -199,8 +217,10 @@ func runTest(t *testing.T, names []string) *backend.DataResponse {
 
 	// Remove changeable fields
 	for _, frame := range dr.Frames {
-		if frame.Meta != nil {
-			meta := frame.Meta.Custom.(*models.TimestreamCustomMeta)
+		if frame.Meta == nil {
+			continue
+		}
+		if meta, ok := frame.Meta.Custom.(*models.TimestreamCustomMeta); ok {
 			meta.StartTime = 1111
 			meta.FinishTime = 2222
 			if meta.QueryID != "" {
@@ -209,10 +229,10 @@ func runTest(t *testing.T, names []string) *backend.DataResponse {
 			if meta.NextToken != "" {
 				meta.NextToken = "$nextToken$"
 			}
-
-			// TODO: fix: https://github.com/grafana/grafana-plugin-sdk-go/issues/213
-			frame.Meta.Custom = nil
 		}
+
+		// TODO: fix: https://github.com/grafana/grafana-plugin-sdk-go/issues/213
+		frame.Meta.Custom = nil
 	}
 
 	// Set the last parameter of CheckGoldenDataResponse to true to write new golden responses
@@ -415,3 +435,163 @@ func TestGenerateTestData(t *testing.T) {
 		}
 	}
 }
+
+func TestExecuteQuery_Selection(t *testing.T) {
+	rawQuery := "SELECT 1;\nSELECT 2"
+	client := &fakeClient{output: &timestreamquery.QueryOutput{}}
+	ds := &timestreamDS{Client: client}
+
+	dr := ds.ExecuteQuery(context.Background(), models.QueryModel{
+		RawQuery:  rawQuery,
+		Selection: &models.QuerySelection{Start: 10, End: 10},
+	})
+	require.NoError(t, dr.Error)
+	require.Len(t, client.calls.runQuery, 1)
+	assert.Equal(t, "SELECT 2", *client.calls.runQuery[0].QueryString)
+
+	dr = ds.ExecuteQuery(context.Background(), models.QueryModel{
+		RawQuery:  rawQuery,
+		Selection: &models.QuerySelection{Start: 0, End: len(rawQuery)},
+	})
+	assert.Error(t, dr.Error)
+}
+
+func TestExecuteQuery_FromAlertOrdersRows(t *testing.T) {
+	rawQuery := "SELECT device, time, measure_value::double FROM db.tbl WHERE time > ago(1h) AND measure_name = 'cpu'"
+	client := &fakeClient{output: &timestreamquery.QueryOutput{}}
+	ds := &timestreamDS{Client: client}
+
+	dr := ds.ExecuteQuery(context.Background(), models.QueryModel{RawQuery: rawQuery, FromAlert: true})
+	require.NoError(t, dr.Error)
+	want := rawQuery + " ORDER BY time, device"
+	assert.Equal(t, want, *client.calls.runQuery[0].QueryString)
+	assert.Equal(t, want, dr.Frames[0].Meta.ExecutedQueryString)
+
+	ds.ExecuteQuery(context.Background(), models.QueryModel{RawQuery: rawQuery})
+	assert.Equal(t, rawQuery, *client.calls.runQuery[1].QueryString)
+}
+
+func TestExecuteQuery_ValidatorWarnings(t *testing.T) {
+	client := &fakeClient{output: &timestreamquery.QueryOutput{}}
+	ds := &timestreamDS{Client: client, Settings: models.DatasourceSettings{
+		Validator: &validator.Options{WarningRules: []validator.Rule{validator.RuleMeasure}},
+	}}
+
+	dr := ds.ExecuteQuery(context.Background(), models.QueryModel{RawQuery: "SELECT * FROM db.tbl WHERE time > ago(1h)"})
+	require.NoError(t, dr.Error)
+	require.Len(t, client.calls.runQuery, 1)
+	require.Len(t, dr.Frames[0].Meta.Notices, 1)
+	assert.Equal(t, data.NoticeSeverityWarning, dr.Frames[0].Meta.Notices[0].Severity)
+	assert.Contains(t, dr.Frames[0].Meta.Notices[0].Text, "measure_name")
+
+	dr = ds.ExecuteQuery(context.Background(), models.QueryModel{RawQuery: "SELECT * FROM db.tbl WHERE host = 'a'"})
+	require.Error(t, dr.Error)
+	assert.Contains(t, dr.Error.Error(), "time")
+	assert.Len(t, client.calls.runQuery, 1)
+}
+
+func TestExecuteQuery_RepairTimeFilter(t *testing.T) {
+	client := &fakeClient{output: &timestreamquery.QueryOutput{}}
+	ds := &timestreamDS{Client: client, Settings: models.DatasourceSettings{RepairTimeFilter: true}}
+	query := models.QueryModel{
+		RawQuery:  "SELECT * FROM db.tbl WHERE measure_name = 'cpu'",
+		TimeRange: backend.TimeRange{From: time.UnixMilli(1700000000000), To: time.UnixMilli(1700003600000)},
+	}
+
+	dr := ds.ExecuteQuery(context.Background(), query)
+	require.NoError(t, dr.Error)
+	require.Len(t, client.calls.runQuery, 1)
+	assert.Equal(t, "SELECT * FROM db.tbl WHERE (measure_name = 'cpu') AND time BETWEEN from_milliseconds(1700000000000) AND from_milliseconds(1700003600000)", *client.calls.runQuery[0].QueryString)
+	require.Len(t, dr.Frames[0].Meta.Notices, 1)
+	assert.Equal(t, "Added the time range of the query to 1 SELECTs without a time filter", dr.Frames[0].Meta.Notices[0].Text)
+
+	// other issues still reject the query
+	query.RawQuery = "SELECT * FROM db.tbl"
+	dr = ds.ExecuteQuery(context.Background(), query)
+	require.Error(t, dr.Error)
+	assert.Len(t, client.calls.runQuery, 1)
+
+	ds.Settings.RepairTimeFilter = false
+	query.RawQuery = "SELECT * FROM db.tbl WHERE measure_name = 'cpu'"
+	dr = ds.ExecuteQuery(context.Background(), query)
+	require.Error(t, dr.Error)
+	assert.Len(t, client.calls.runQuery, 1)
+}
+
+func TestExecuteQuery_ValidatorDirectives(t *testing.T) {
+	client := &fakeClient{output: &timestreamquery.QueryOutput{}}
+	ds := &timestreamDS{Client: client, Settings: models.DatasourceSettings{
+		Validator: &validator.Options{DirectiveRules: []validator.Rule{validator.RuleMeasure}},
+	}}
+
+	dr := ds.ExecuteQuery(context.Background(), models.QueryModel{RawQuery: "-- ts:allow-missing-measure reason=\"aggregated rollup\"\nSELECT * FROM db.rollup WHERE time > ago(1h)"})
+	require.NoError(t, dr.Error)
+	require.Len(t, client.calls.runQuery, 1)
+	require.Len(t, dr.Frames[0].Meta.Notices, 1)
+	assert.Equal(t, data.NoticeSeverityInfo, dr.Frames[0].Meta.Notices[0].Severity)
+	assert.Contains(t, dr.Frames[0].Meta.Notices[0].Text, "allowed: aggregated rollup")
+
+	dr = ds.ExecuteQuery(context.Background(), models.QueryModel{RawQuery: "-- ts:allow-missing-time reason=\"everything\"\nSELECT * FROM db.rollup WHERE measure_name = 'cpu'"})
+	require.Error(t, dr.Error)
+	assert.Len(t, client.calls.runQuery, 1)
+}
+
+func TestQueryData_ValidatorProfiles(t *testing.T) {
+	client := &fakeClient{output: &timestreamquery.QueryOutput{}}
+	ds := &timestreamDS{Client: client, Settings: models.DatasourceSettings{
+		ValidatorProfiles: map[string]models.ValidatorProfile{
+			"exploratory": {Validator: &validator.Options{WarningRules: []validator.Rule{validator.RuleMeasure}}, Roles: []string{"Editor", "Admin"}},
+			"strict":      {Validator: &validator.Options{}},
+		},
+	}}
+	query := func(profile string, role string) backend.DataResponse {
+		res, err := ds.QueryData(context.Background(), &backend.QueryDataRequest{
+			PluginContext: backend.PluginContext{User: &backend.User{Role: role}},
+			Queries: []backend.DataQuery{{
+				RefID: "A",
+				JSON:  []byte(`{"rawQuery":"SELECT * FROM db.tbl WHERE time > ago(1h)","validatorProfile":"` + profile + `"}`),
+			}},
+		})
+		require.NoError(t, err)
+		return res.Responses["A"]
+	}
+
+	dr := query("exploratory", "Editor")
+	require.NoError(t, dr.Error)
+	require.Len(t, client.calls.runQuery, 1)
+	assert.Equal(t, data.NoticeSeverityWarning, dr.Frames[0].Meta.Notices[0].Severity)
+
+	dr = query("exploratory", "Viewer")
+	require.ErrorContains(t, dr.Error, `validator profile "exploratory" is not allowed for role "Viewer"`)
+	assert.Equal(t, backend.StatusForbidden, dr.Status)
+	require.Len(t, dr.Frames, 1)
+	meta, ok := dr.Frames[0].Meta.Custom.(*models.TimestreamCustomMeta)
+	require.True(t, ok)
+	require.NotNil(t, meta.Problem)
+	assert.Equal(t, "validator.profile-access", meta.Problem.Code)
+	assert.Equal(t, "Validator profile not allowed for the role", meta.Problem.Title)
+	dr = query("strict", "Viewer")
+	require.Error(t, dr.Error)
+	require.NotContains(t, dr.Error.Error(), "not allowed")
+	dr = query("nope", "Admin")
+	require.ErrorContains(t, dr.Error, `unknown validator profile "nope"`)
+	assert.Equal(t, backend.StatusBadRequest, dr.Status)
+	meta, ok = dr.Frames[0].Meta.Custom.(*models.TimestreamCustomMeta)
+	require.True(t, ok)
+	assert.Equal(t, "validator.profile", meta.Problem.Code)
+	assert.Len(t, client.calls.runQuery, 1)
+
+	// resources running queries are checked the same way
+	viewer := backend.PluginContext{User: &backend.User{Role: "Viewer"}}
+	exportBody, _ := json.Marshal(models.ExportRequest{Query: json.RawMessage(`{"rawQuery":"SELECT * FROM db.tbl WHERE time > ago(1h)","validatorProfile":"exploratory"}`)})
+	err := ds.CallResource(context.Background(), &backend.CallResourceRequest{Method: "POST", Path: "export", Body: exportBody, PluginContext: viewer}, &fakeSender{})
+	require.ErrorContains(t, err, "is not allowed for role")
+	compareBody, _ := json.Marshal(models.CompareTablesRequest{
+		Query:     json.RawMessage(`{"rawQuery":"SELECT * FROM $__database.$__table WHERE time > ago(1h)","validatorProfile":"exploratory"}`),
+		Baseline:  models.TableRef{Database: "db", Table: "a"},
+		Candidate: models.TableRef{Database: "db", Table: "b"},
+	})
+	err = ds.CallResource(context.Background(), &backend.CallResourceRequest{Method: "POST", Path: "compare", Body: compareBody, PluginContext: viewer}, &fakeSender{})
+	require.ErrorContains(t, err, "is not allowed for role")
+	assert.Len(t, client.calls.runQuery, 1)
+}
@@ -0,0 +1,67 @@
+package timestream
+
+import (
+	"fmt"
+
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+const (
+	// smaller results don't benefit from encoding
+	dictionaryMinRows = 1000
+	// keep the lookup table small compared to the values it replaces
+	dictionaryMaxCardinality = 256
+)
+
+// dictionaryEncodeFields replaces low cardinality string and boolean fields by enum fields,
+// sending each distinct value once instead of on every row
+func dictionaryEncodeFields(fields []*data.Field, minRows, maxCardinality int) []*data.Field {
+	for i, field := range fields {
+		if field.Len() < minRows {
+			continue
+		}
+		switch field.Type() {
+		case data.FieldTypeNullableString, data.FieldTypeString, data.FieldTypeNullableBool, data.FieldTypeBool:
+		default:
+			continue
+		}
+		if encoded := dictionaryEncodeField(field, maxCardinality); encoded != nil {
+			fields[i] = encoded
+		}
+	}
+	return fields
+}
+
+// dictionaryEncodeField returns nil when the field has too many distinct values
+func dictionaryEncodeField(field *data.Field, maxCardinality int) *data.Field {
+	index := map[string]data.EnumItemIndex{}
+	texts := []string{}
+	values := make([]*data.EnumItemIndex, field.Len())
+	for i := 0; i < field.Len(); i++ {
+		v, ok := field.ConcreteAt(i)
+		if !ok {
+			continue
+		}
+		text := fmt.Sprintf("%v", v)
+		idx, seen := index[text]
+		if !seen {
+			if len(texts) == maxCardinality {
+				return nil
+			}
+			idx = data.EnumItemIndex(len(texts))
+			index[text] = idx
+			texts = append(texts, text)
+		}
+		values[i] = &idx
+	}
+
+	encoded := data.NewField(field.Name, field.Labels, values)
+	config := &data.FieldConfig{}
+	if field.Config != nil {
+		copied := *field.Config
+		config = &copied
+	}
+	config.TypeConfig = &data.FieldTypeConfig{Enum: &data.EnumFieldConfig{Text: texts}}
+	encoded.SetConfig(config)
+	return encoded
+}
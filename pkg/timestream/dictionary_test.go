@@ -0,0 +1,40 @@
+package timestream
+
+import (
+	"testing"
+
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDictionaryEncodeFields(t *testing.T) {
+	online, offline := true, false
+	fields := []*data.Field{
+		data.NewField("device", nil, []*string{strPtr("d1"), strPtr("d2"), nil, strPtr("d1")}),
+		data.NewField("online", nil, []*bool{&online, &offline, &online, nil}),
+		data.NewField("unique", nil, []string{"a", "b", "c", "d"}),
+		data.NewField("value", nil, []float64{1, 2, 3, 4}),
+	}
+
+	out := dictionaryEncodeFields(fields, 2, 3)
+	require.Len(t, out, 4)
+
+	assert.Equal(t, data.FieldTypeNullableEnum, out[0].Type())
+	assert.Equal(t, []string{"d1", "d2"}, out[0].Config.TypeConfig.Enum.Text)
+	assert.Equal(t, data.EnumItemIndex(0), *out[0].At(3).(*data.EnumItemIndex))
+	assert.Nil(t, out[0].At(2))
+
+	assert.Equal(t, data.FieldTypeNullableEnum, out[1].Type())
+	assert.Equal(t, []string{"true", "false"}, out[1].Config.TypeConfig.Enum.Text)
+
+	// too many distinct values
+	assert.Equal(t, data.FieldTypeString, out[2].Type())
+	assert.Equal(t, data.FieldTypeFloat64, out[3].Type())
+}
+
+func TestDictionaryEncodeFields_SmallResults(t *testing.T) {
+	fields := []*data.Field{data.NewField("device", nil, []string{"d1", "d1"})}
+	out := dictionaryEncodeFields(fields, dictionaryMinRows, dictionaryMaxCardinality)
+	assert.Equal(t, data.FieldTypeString, out[0].Type())
+}
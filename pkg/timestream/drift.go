@@ -0,0 +1,174 @@
+package timestream
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	timestreamquerytypes "github.com/aws/aws-sdk-go-v2/service/timestreamquery/types"
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/grafana/timestream-datasource/pkg/timestream/validator"
+)
+
+// How long a measure or column is remembered after the table last listed it
+const schemaSeenWindow = 24 * time.Hour
+
+// tableSchemas remembers when the measures of each table last had data and when
+// its columns were last listed, so a query selecting a measure that is no longer written, e.g. after a
+// firmware release renamed it, or filtering a mistyped dimension gets a notice
+// instead of a silently empty panel. A nil tableSchemas remembers nothing.
+type tableSchemas struct {
+	window time.Duration
+
+	mu     sync.Mutex
+	tables map[string]*tableSchema
+}
+
+type tableSchema struct {
+	measures map[string]time.Time
+	// columns are lower case, like the names of the validator
+	columns map[string]time.Time
+}
+
+func newTableSchemas(window time.Duration) *tableSchemas {
+	return &tableSchemas{window: window, tables: map[string]*tableSchema{}}
+}
+
+// observe records the measures in the first column of the rows of the table
+func (s *tableSchemas) observe(table string, rows []timestreamquerytypes.Row, now time.Time) {
+	s.record(table, rows, now, func(schema *tableSchema, name string) { schema.measures[name] = now })
+}
+
+// observeColumns records the columns of the DESCRIBE rows of the table
+func (s *tableSchemas) observeColumns(table string, rows []timestreamquerytypes.Row, now time.Time) {
+	s.record(table, rows, now, func(schema *tableSchema, name string) { schema.columns[strings.ToLower(name)] = now })
+}
+
+// record adds the names in the first column of the rows to the schema of the table
+// and forgets the names not listed within the window
+func (s *tableSchemas) record(table string, rows []timestreamquerytypes.Row, now time.Time, add func(*tableSchema, string)) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	schema, ok := s.tables[table]
+	if !ok {
+		schema = &tableSchema{measures: map[string]time.Time{}, columns: map[string]time.Time{}}
+		s.tables[table] = schema
+	}
+	for _, row := range rows {
+		if len(row.Data) > 0 && row.Data[0].ScalarValue != nil {
+			add(schema, *row.Data[0].ScalarValue)
+		}
+	}
+	for _, seen := range []map[string]time.Time{schema.measures, schema.columns} {
+		for name, at := range seen {
+			if now.Sub(at) > s.window {
+				delete(seen, name)
+			}
+		}
+	}
+}
+
+// unseenMeasures returns the measures the table hasn't listed within the window
+func (s *tableSchemas) unseenMeasures(table string, measures []string, now time.Time) []string {
+	if s == nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	schema, ok := s.tables[table]
+	if !ok {
+		return nil
+	}
+	var unseen []string
+	for _, measure := range measures {
+		if at, ok := schema.measures[measure]; !ok || now.Sub(at) > s.window {
+			unseen = append(unseen, measure)
+		}
+	}
+	return unseen
+}
+
+// columns returns the columns the table listed within the window
+func (s *tableSchemas) columns(table string, now time.Time) map[string]bool {
+	if s == nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	columns := map[string]bool{}
+	if schema, ok := s.tables[table]; ok {
+		for name, at := range schema.columns {
+			if now.Sub(at) <= s.window {
+				columns[name] = true
+			}
+		}
+	}
+	return columns
+}
+
+// driftSQL selects which of the measures have data in the table within the window.
+// SHOW MEASURES can't tell, it keeps listing measures that are no longer written.
+func driftSQL(database, table string, measures []string, window time.Duration) string {
+	quoted := make([]string, len(measures))
+	for i, measure := range measures {
+		quoted[i] = quoteLiteral(measure)
+	}
+	return fmt.Sprintf("SELECT DISTINCT measure_name FROM %s.%s WHERE time > ago(%dh) AND measure_name IN (%s)",
+		quoteIdentifier(database), quoteIdentifier(table), int(window.Hours()), strings.Join(quoted, ", "))
+}
+
+// driftNotices warns about the measures the query selects by name that have no
+// data in the tables it reads within the window. The lookups are answered from
+// the schema cache, a failed lookup only skips the check of its table.
+func (ds *timestreamDS) driftNotices(ctx context.Context, sql string) []data.Notice {
+	if ds.tables == nil {
+		return nil
+	}
+	var notices []data.Notice
+	now := time.Now()
+	for _, ref := range validator.References(sql) {
+		if len(ref.Measures) == 0 {
+			continue
+		}
+		table := ref.Database + "." + ref.Table
+		v, err := ds.schemaQuery(ctx, driftSQL(ref.Database, ref.Table, ref.Measures, ds.tables.window))
+		if err != nil {
+			backend.Logger.Debug("schema drift check skipped", "table", table, "error", err)
+			continue
+		}
+		ds.tables.observe(table, v.Rows, now)
+		for _, measure := range ds.tables.unseenMeasures(table, ref.Measures, now) {
+			notices = append(notices, data.Notice{
+				Severity: data.NoticeSeverityWarning,
+				Text:     fmt.Sprintf("measure '%s' not seen in last %dh in %s", measure, int(ds.tables.window.Hours()), table),
+			})
+		}
+	}
+	return notices
+}
+
+// unknownDimensions lints the WHERE and GROUP BY clauses of the query against the
+// columns DESCRIBE lists for its tables, see validator.UnknownDimensions. Tables
+// whose lookup fails aren't checked, nor queries whose validator options turn
+// the rule off.
+func (ds *timestreamDS) unknownDimensions(ctx context.Context, sql string, opts *validator.Options) []validator.Issue {
+	if ds.tables == nil || opts.Level(validator.RuleUnknownDimension) == validator.LevelOff {
+		return nil
+	}
+	now := time.Now()
+	return validator.UnknownDimensions(sql, func(database, table string) (map[string]bool, bool) {
+		v, err := ds.schemaQuery(ctx, fmt.Sprintf("DESCRIBE %s.%s", applyQuotesIfNeeded(database), applyQuotesIfNeeded(table)))
+		if err != nil {
+			backend.Logger.Debug("dimension check skipped", "table", database+"."+table, "error", err)
+			return nil, false
+		}
+		ds.tables.observeColumns(database+"."+table, v.Rows, now)
+		return ds.tables.columns(database+"."+table, now), true
+	})
+}
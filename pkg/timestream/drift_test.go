@@ -0,0 +1,103 @@
+package timestream
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/timestreamquery"
+	timestreamquerytypes "github.com/aws/aws-sdk-go-v2/service/timestreamquery/types"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/grafana/timestream-datasource/pkg/models"
+	"github.com/grafana/timestream-datasource/pkg/timestream/validator"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTableSchemas(t *testing.T) {
+	now := time.Now()
+	schemas := newTableSchemas(24 * time.Hour)
+	schemas.observe("db.tbl", []timestreamquerytypes.Row{measureRow("cpu", "host"), measureRow("mem", "host", "region")}, now)
+
+	assert.Empty(t, schemas.unseenMeasures("db.tbl", []string{"cpu", "mem"}, now))
+	assert.Equal(t, []string{"disk"}, schemas.unseenMeasures("db.tbl", []string{"cpu", "disk"}, now))
+	assert.Empty(t, schemas.unseenMeasures("db.other", []string{"disk"}, now), "tables never listed are not checked")
+
+	// the firmware renamed mem, it is remembered for the window
+	schemas.observe("db.tbl", []timestreamquerytypes.Row{measureRow("cpu", "host"), measureRow("memory", "host")}, now.Add(time.Hour))
+	assert.Empty(t, schemas.unseenMeasures("db.tbl", []string{"mem"}, now.Add(time.Hour)))
+	later := now.Add(25 * time.Hour)
+	schemas.observe("db.tbl", []timestreamquerytypes.Row{measureRow("cpu", "host"), measureRow("memory", "host")}, later)
+	assert.Equal(t, []string{"mem"}, schemas.unseenMeasures("db.tbl", []string{"mem", "memory"}, later))
+
+	schemas.observeColumns("db.tbl", []timestreamquerytypes.Row{columnRow("time"), columnRow("Device")}, now)
+	assert.Equal(t, map[string]bool{"time": true, "device": true}, schemas.columns("db.tbl", now))
+	schemas.observeColumns("db.tbl", []timestreamquerytypes.Row{columnRow("time")}, later)
+	assert.Equal(t, map[string]bool{"time": true}, schemas.columns("db.tbl", later))
+	assert.Empty(t, schemas.columns("db.other", now))
+
+	var nilSchemas *tableSchemas
+	nilSchemas.observe("db.tbl", []timestreamquerytypes.Row{measureRow("cpu")}, now)
+	assert.Nil(t, nilSchemas.unseenMeasures("db.tbl", []string{"cpu"}, now))
+	assert.Nil(t, nilSchemas.columns("db.tbl", now))
+}
+
+func columnRow(name string) timestreamquerytypes.Row {
+	return timestreamquerytypes.Row{Data: []timestreamquerytypes.Datum{{ScalarValue: aws.String(name)}, {ScalarValue: aws.String("varchar")}, {ScalarValue: aws.String("DIMENSION")}}}
+}
+
+func TestDriftSQL(t *testing.T) {
+	assert.Equal(t, `SELECT DISTINCT measure_name FROM "db"."tbl" WHERE time > ago(24h) AND measure_name IN ('cpu', 'it''s')`,
+		driftSQL("db", `"tbl"`, []string{"cpu", "it's"}, 24*time.Hour))
+}
+
+func TestDriftNotices(t *testing.T) {
+	// only the measures with data in the window are returned, unlike SHOW MEASURES
+	client := &tableClient{outputs: map[string]*timestreamquery.QueryOutput{
+		`SELECT DISTINCT measure_name FROM "db"."tbl" WHERE time > ago(24h)`: {Rows: []timestreamquerytypes.Row{measureRow("cpu")}},
+	}}
+	ds := &timestreamDS{Client: client, tables: newTableSchemas(24 * time.Hour)}
+
+	notices := ds.driftNotices(context.Background(), `SELECT * FROM "db"."tbl" WHERE time > ago(1h) AND measure_name IN ('cpu', 'temp')`)
+	assert.Equal(t, []data.Notice{{Severity: data.NoticeSeverityWarning, Text: "measure 'temp' not seen in last 24h in db.tbl"}}, notices)
+
+	assert.Empty(t, ds.driftNotices(context.Background(), `SELECT * FROM "db"."tbl" WHERE measure_name = 'cpu'`))
+	assert.Empty(t, ds.driftNotices(context.Background(), `SELECT * FROM "db"."tbl" WHERE time > ago(1h)`))
+
+	ds.tables = nil
+	assert.Empty(t, ds.driftNotices(context.Background(), `SELECT * FROM "db"."tbl" WHERE measure_name = 'temp'`))
+}
+
+func TestUnknownDimensions(t *testing.T) {
+	client := &tableClient{outputs: map[string]*timestreamquery.QueryOutput{
+		`DESCRIBE "db"."fleet"`: {Rows: []timestreamquerytypes.Row{columnRow("time"), columnRow("measure_name"), columnRow("releasegroup")}},
+	}}
+	ds := &timestreamDS{Client: client, tables: newTableSchemas(24 * time.Hour)}
+
+	issues := ds.unknownDimensions(context.Background(), `SELECT * FROM "db"."fleet" WHERE time > ago(1h) AND measure_name = 'cpu' AND relasegroup = 'stable'`, ds.Settings.Validator)
+	require.Len(t, issues, 1)
+	assert.Equal(t, "column 'relasegroup' does not exist in db.fleet", issues[0].Reason)
+	assert.Equal(t, validator.SeverityWarning, issues[0].Severity)
+
+	ds.Settings.Validator = &validator.Options{RuleLevels: map[validator.Rule]validator.RuleLevel{validator.RuleUnknownDimension: validator.LevelOff}}
+	assert.Empty(t, ds.unknownDimensions(context.Background(), `SELECT * FROM "db"."fleet" WHERE relasegroup = 'stable'`, ds.Settings.Validator))
+
+	ds.Settings.Validator = nil
+	ds.tables = nil
+	assert.Empty(t, ds.unknownDimensions(context.Background(), `SELECT * FROM "db"."fleet" WHERE relasegroup = 'stable'`, ds.Settings.Validator))
+}
+
+func TestExecuteQuery_UnknownDimensionNotice(t *testing.T) {
+	client := &tableClient{outputs: map[string]*timestreamquery.QueryOutput{
+		`DESCRIBE "db"."fleet"`: {Rows: []timestreamquerytypes.Row{columnRow("time"), columnRow("measure_name"), columnRow("releasegroup")}},
+	}}
+	ds := &timestreamDS{Client: client, tables: newTableSchemas(24 * time.Hour)}
+
+	dr := ds.ExecuteQuery(context.Background(), models.QueryModel{
+		RawQuery: `SELECT * FROM "db"."fleet" WHERE time > ago(1h) AND measure_name = 'cpu' AND relasegroup = 'stable'`,
+	})
+	require.NoError(t, dr.Error)
+	require.NotEmpty(t, dr.Frames)
+	assert.Contains(t, dr.Frames[0].Meta.Notices, data.Notice{Severity: data.NoticeSeverityWarning, Text: "column 'relasegroup' does not exist in db.fleet"})
+}
@@ -0,0 +1,102 @@
+package timestream
+
+import (
+	"sync"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/timestream-datasource/pkg/models"
+	"github.com/grafana/timestream-datasource/pkg/timestream/validator"
+)
+
+// DryRunReport summarizes what a proposed validator configuration would have rejected
+type DryRunReport struct {
+	Active bool      `json:"active"`
+	Since  time.Time `json:"since"`
+	Until  time.Time `json:"until,omitempty"`
+
+	// Queries counts every query observed while the evaluation was active
+	Queries int64 `json:"queries"`
+	// WouldReject counts queries the proposed configuration rejects
+	WouldReject int64 `json:"wouldReject"`
+	// NewlyRejected counts queries the proposed configuration rejects but the enforced one accepts
+	NewlyRejected int64 `json:"newlyRejected"`
+	// Rules counts would-be rejections per issue code, e.g. missing-time-predicate
+	Rules map[string]int64 `json:"rules"`
+}
+
+// dryRunTracker evaluates the proposed validator configuration against live traffic.
+// A nil tracker ignores every observation.
+type dryRunTracker struct {
+	config   models.ValidatorDryRun
+	rules    *validator.Compiled
+	scrubber Scrubber
+
+	mu     sync.Mutex
+	report DryRunReport
+}
+
+func newDryRunTracker(config *models.ValidatorDryRun, scrubber Scrubber) *dryRunTracker {
+	if config == nil {
+		return nil
+	}
+	rules, err := config.Options.Compile()
+	if err != nil {
+		backend.Logger.Error("invalid dry-run validator options", "error", err.Error())
+		return nil
+	}
+	return &dryRunTracker{
+		config:   *config,
+		rules:    rules,
+		scrubber: scrubber,
+		report: DryRunReport{
+			Since: config.StartedAt,
+			Until: config.Until(),
+			Rules: map[string]int64{},
+		},
+	}
+}
+
+// observe validates sql with the proposed configuration and records the would-be rejections
+func (t *dryRunTracker) observe(sql string, enforcedValid bool, now time.Time) {
+	if t == nil || !t.config.Active(now) {
+		return
+	}
+	valid, issues := t.rules.Validate(sql)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.report.Queries++
+	if valid {
+		return
+	}
+	t.report.WouldReject++
+	if enforcedValid {
+		t.report.NewlyRejected++
+	}
+	rejected := validator.Errors(issues)
+	seen := map[validator.IssueCode]bool{}
+	for _, issue := range rejected {
+		if seen[issue.Code] {
+			continue
+		}
+		seen[issue.Code] = true
+		t.report.Rules[string(issue.Code)]++
+	}
+	backend.Logger.Info("dry-run validator would reject query", "query", scrubSQL(t.scrubber, sql), "code", rejected[0].Code, "reason", rejected[0].Reason)
+}
+
+func (t *dryRunTracker) snapshot(now time.Time) DryRunReport {
+	if t == nil {
+		return DryRunReport{Rules: map[string]int64{}}
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	report := t.report
+	report.Active = t.config.Active(now)
+	report.Rules = make(map[string]int64, len(t.report.Rules))
+	for rule, count := range t.report.Rules {
+		report.Rules[rule] = count
+	}
+	return report
+}
@@ -0,0 +1,54 @@
+package timestream
+
+import (
+	"testing"
+	"time"
+
+	"github.com/grafana/timestream-datasource/pkg/models"
+	"github.com/grafana/timestream-datasource/pkg/timestream/validator"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDryRunTracker(t *testing.T) {
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	tracker := newDryRunTracker(&models.ValidatorDryRun{StartedAt: start, Days: 7}, nil)
+
+	noMeasure := `SELECT * FROM "db"."tbl" WHERE time > ago(1h)`
+	noWhere := `SELECT * FROM "db"."tbl"`
+	valid := `SELECT * FROM "db"."tbl" WHERE time > ago(1h) AND measure_name = 'a'`
+
+	tracker.observe(valid, true, start.Add(time.Hour))
+	tracker.observe(noMeasure, true, start.Add(time.Hour))
+	tracker.observe(noWhere, false, start.Add(time.Hour))
+	// outside of the evaluation window
+	tracker.observe(noWhere, false, start.AddDate(0, 0, 8))
+
+	report := tracker.snapshot(start.Add(2 * time.Hour))
+	assert.True(t, report.Active)
+	assert.Equal(t, start.AddDate(0, 0, 7), report.Until)
+	assert.Equal(t, int64(3), report.Queries)
+	assert.Equal(t, int64(2), report.WouldReject)
+	assert.Equal(t, int64(1), report.NewlyRejected)
+	assert.Equal(t, map[string]int64{"invalid-measure-predicate": 1, "missing-where": 1}, report.Rules)
+
+	assert.False(t, tracker.snapshot(start.AddDate(0, 0, 8)).Active)
+}
+
+func TestDryRunTracker_Options(t *testing.T) {
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	tracker := newDryRunTracker(&models.ValidatorDryRun{
+		StartedAt: start,
+		Options:   validator.Options{AllowMissingMeasure: true},
+	}, nil)
+	tracker.observe(`SELECT * FROM "db"."tbl" WHERE time > ago(1h)`, false, start.AddDate(1, 0, 0))
+
+	report := tracker.snapshot(start)
+	assert.Equal(t, int64(1), report.Queries)
+	assert.Equal(t, int64(0), report.WouldReject)
+}
+
+func TestDryRunTracker_Nil(t *testing.T) {
+	var tracker *dryRunTracker
+	tracker.observe("SELECT 1", true, time.Now())
+	assert.Equal(t, int64(0), tracker.snapshot(time.Now()).Queries)
+}
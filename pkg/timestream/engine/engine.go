@@ -0,0 +1,196 @@
+// Package engine runs Timestream queries through the same pipeline as the Grafana
+// datasource, macro expansion, validation, paging and result conversion, for
+// services outside Grafana. Its API doesn't use Grafana plugin SDK types.
+package engine
+
+import (
+	"context"
+	"math"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/grafana/timestream-datasource/pkg/common"
+	"github.com/grafana/timestream-datasource/pkg/models"
+	"github.com/grafana/timestream-datasource/pkg/timestream"
+	"github.com/grafana/timestream-datasource/pkg/timestream/validator"
+)
+
+// Client is the Timestream query API, e.g. *timestreamquery.Client
+type Client = timestream.QueryClient
+
+// Config holds the datasource options relevant to queries
+type Config struct {
+	// Defaults for the $__database, $__table and $__measure macros
+	DefaultDatabase string
+	DefaultTable    string
+	DefaultMeasure  string
+	// Validator configures the reasonable query check, nil uses the defaults
+	Validator *validator.Options
+	// Timeout of queries without their own, zero is unlimited. It is rounded up
+	// to whole seconds.
+	Timeout time.Duration
+}
+
+// Format selects the shape of the result
+type Format int
+
+const (
+	// FormatTable returns one series per result set
+	FormatTable Format = iota
+	// FormatTimeSeries returns one series per dimension combination
+	FormatTimeSeries
+)
+
+// Query is a SQL query with the context its macros expand to
+type Query struct {
+	SQL string
+	// Override the default database, table and measure of the config
+	Database string
+	Table    string
+	Measure  string
+	// Time range of $__timeFilter, $__timeFrom and $__timeTo
+	From, To time.Time
+	// Interval of $__interval, computed from MaxDataPoints when zero
+	Interval      time.Duration
+	MaxDataPoints int64
+	Format        Format
+	// Stop reading results after this many rows, zero reads all
+	MaxRows int64
+	// Timeout overrides the config timeout, rounded up to whole seconds
+	Timeout time.Duration
+}
+
+// Result is the outcome of a query
+type Result struct {
+	// ExecutedSQL is the query sent to Timestream, macros expanded
+	ExecutedSQL string
+	Series      []Series
+	// Notices are warnings about the result, e.g. truncation
+	Notices []string
+	// Bytes scanned and metered as reported by Timestream
+	BytesScanned int64
+	BytesMetered int64
+}
+
+// Series is a set of columns of equal length
+type Series struct {
+	Name    string
+	Columns []Column
+}
+
+// Column holds the values of a result column. Values are Go values like float64,
+// string or time.Time, and nil for NULL.
+type Column struct {
+	Name   string
+	Labels map[string]string
+	Values []any
+}
+
+// Engine runs queries with a client and config
+type Engine struct {
+	config Config
+	runner timestream.QueryRunner
+}
+
+// New returns an engine running queries with the client
+func New(client Client, config Config) (*Engine, error) {
+	runner, err := timestream.NewQueryRunner(client, config.settings())
+	if err != nil {
+		return nil, err
+	}
+	return &Engine{config: config, runner: runner}, nil
+}
+
+func (c Config) settings() models.DatasourceSettings {
+	return models.DatasourceSettings{
+		DefaultDatabase:     c.DefaultDatabase,
+		DefaultTable:        c.DefaultTable,
+		DefaultMeasure:      c.DefaultMeasure,
+		Validator:           c.Validator,
+		QueryTimeoutSeconds: timeoutSeconds(c.Timeout),
+	}
+}
+
+// Interpolate expands the macros of the query
+func (e *Engine) Interpolate(q Query) (string, error) {
+	return timestream.Interpolate(e.model(q), e.config.settings())
+}
+
+// Query runs the query, reading all pages of the result
+func (e *Engine) Query(ctx context.Context, q Query) (*Result, error) {
+	dr := e.runner.ExecuteQuery(ctx, e.model(q))
+	if dr.Error != nil {
+		return nil, dr.Error
+	}
+	return toResult(dr), nil
+}
+
+func (e *Engine) model(q Query) models.QueryModel {
+	model := models.QueryModel{
+		RawQuery:       q.SQL,
+		Database:       q.Database,
+		Table:          q.Table,
+		Measure:        q.Measure,
+		TimeRange:      backend.TimeRange{From: q.From, To: q.To},
+		Interval:       q.Interval,
+		MaxDataPoints:  q.MaxDataPoints,
+		WaitForResult:  true,
+		MaxRows:        q.MaxRows,
+		TimeoutSeconds: timeoutSeconds(q.Timeout),
+	}
+	if q.Format == FormatTimeSeries {
+		model.Format = models.FormatOptionTimeSeries
+	}
+	if model.MaxDataPoints == 0 {
+		model.MaxDataPoints = 1024
+	}
+	if model.Interval == 0 {
+		millis := model.TimeRange.Duration().Milliseconds() / model.MaxDataPoints
+		model.Interval = time.Millisecond * time.Duration(common.RoundInterval(millis))
+	}
+	return model
+}
+
+// timeoutSeconds rounds the timeout up, so a sub-second one doesn't become zero,
+// which is unlimited
+func timeoutSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
+
+func toResult(dr backend.DataResponse) *Result {
+	r := &Result{Series: []Series{}}
+	for _, frame := range dr.Frames {
+		if frame.Meta != nil {
+			if r.ExecutedSQL == "" {
+				r.ExecutedSQL = frame.Meta.ExecutedQueryString
+			}
+			for _, notice := range frame.Meta.Notices {
+				r.Notices = append(r.Notices, notice.Text)
+			}
+			if meta, ok := frame.Meta.Custom.(*models.TimestreamCustomMeta); ok && meta.Status != nil {
+				r.BytesScanned += meta.Status.CumulativeBytesScanned
+				r.BytesMetered += meta.Status.CumulativeBytesMetered
+			}
+		}
+		if len(frame.Fields) == 0 {
+			continue
+		}
+		r.Series = append(r.Series, toSeries(frame))
+	}
+	return r
+}
+
+func toSeries(frame *data.Frame) Series {
+	s := Series{Name: frame.Name, Columns: make([]Column, len(frame.Fields))}
+	for i, field := range frame.Fields {
+		values := make([]any, field.Len())
+		for j := range values {
+			if v, ok := field.ConcreteAt(j); ok {
+				values[j] = v
+			}
+		}
+		s.Columns[i] = Column{Name: field.Name, Labels: map[string]string(field.Labels), Values: values}
+	}
+	return s
+}
@@ -0,0 +1,91 @@
+package engine
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/timestreamquery"
+	timestreamquerytypes "github.com/aws/aws-sdk-go-v2/service/timestreamquery/types"
+	"github.com/grafana/timestream-datasource/pkg/timestream/validator"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeClient struct {
+	output  *timestreamquery.QueryOutput
+	queries []string
+}
+
+func (f *fakeClient) Query(_ context.Context, input *timestreamquery.QueryInput, _ ...func(*timestreamquery.Options)) (*timestreamquery.QueryOutput, error) {
+	f.queries = append(f.queries, *input.QueryString)
+	return f.output, nil
+}
+
+func (f *fakeClient) CancelQuery(context.Context, *timestreamquery.CancelQueryInput, ...func(*timestreamquery.Options)) (*timestreamquery.CancelQueryOutput, error) {
+	return nil, nil
+}
+
+func TestEngine_Query(t *testing.T) {
+	client := &fakeClient{output: &timestreamquery.QueryOutput{
+		ColumnInfo: []timestreamquerytypes.ColumnInfo{
+			{Name: aws.String("device"), Type: &timestreamquerytypes.Type{ScalarType: timestreamquerytypes.ScalarTypeVarchar}},
+			{Name: aws.String("value"), Type: &timestreamquerytypes.Type{ScalarType: timestreamquerytypes.ScalarTypeDouble}},
+		},
+		Rows: []timestreamquerytypes.Row{
+			{Data: []timestreamquerytypes.Datum{{ScalarValue: aws.String("a")}, {ScalarValue: aws.String("1.5")}}},
+			{Data: []timestreamquerytypes.Datum{{ScalarValue: aws.String("b")}, {NullValue: aws.Bool(true)}}},
+		},
+		QueryStatus: &timestreamquerytypes.QueryStatus{CumulativeBytesScanned: 100},
+	}}
+	e, err := New(client, Config{DefaultDatabase: "db", DefaultTable: "metrics"})
+	require.NoError(t, err)
+
+	from := time.UnixMilli(1700000000000)
+	result, err := e.Query(context.Background(), Query{
+		SQL:  "SELECT device, value FROM $__database.$__table WHERE $__timeFilter AND measure_name = 'cpu'",
+		From: from,
+		To:   from.Add(time.Hour),
+	})
+	require.NoError(t, err)
+	want := `SELECT device, value FROM db.metrics WHERE time BETWEEN from_milliseconds(1700000000000) AND from_milliseconds(1700003600000) AND measure_name = 'cpu'`
+	assert.Equal(t, []string{want}, client.queries)
+	assert.Equal(t, want, result.ExecutedSQL)
+	assert.Equal(t, int64(100), result.BytesScanned)
+
+	require.Len(t, result.Series, 1)
+	require.Len(t, result.Series[0].Columns, 2)
+	assert.Equal(t, "device", result.Series[0].Columns[0].Name)
+	assert.Equal(t, []any{"a", "b"}, result.Series[0].Columns[0].Values)
+	assert.Equal(t, []any{1.5, nil}, result.Series[0].Columns[1].Values)
+}
+
+func TestEngine_Validation(t *testing.T) {
+	client := &fakeClient{output: &timestreamquery.QueryOutput{}}
+	e, err := New(client, Config{})
+	require.NoError(t, err)
+
+	_, err = e.Query(context.Background(), Query{SQL: "SELECT * FROM db.metrics"})
+	assert.ErrorContains(t, err, "missing WHERE clause")
+	assert.Empty(t, client.queries)
+
+	_, err = New(client, Config{Validator: &validator.Options{TenantDimension: "a = b"}})
+	assert.Error(t, err)
+}
+
+func TestEngine_Interpolate(t *testing.T) {
+	e, err := New(&fakeClient{}, Config{DefaultDatabase: "db"})
+	require.NoError(t, err)
+
+	sql, err := e.Interpolate(Query{SQL: "SELECT $__interval_ms FROM $__database.t", From: time.UnixMilli(0), To: time.UnixMilli(0).Add(1024 * time.Second)})
+	require.NoError(t, err)
+	assert.Equal(t, "SELECT 1000ms FROM db.t", sql)
+}
+
+func TestTimeoutSeconds(t *testing.T) {
+	e := &Engine{config: Config{Timeout: 500 * time.Millisecond}}
+	assert.Equal(t, 1, e.config.settings().QueryTimeoutSeconds)
+	assert.Equal(t, 2, e.model(Query{Timeout: 1500 * time.Millisecond}).TimeoutSeconds)
+	assert.Equal(t, 0, e.model(Query{}).TimeoutSeconds)
+}
@@ -0,0 +1,243 @@
+package timestream
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/timestreamquery"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/grafana/timestream-datasource/pkg/models"
+)
+
+const (
+	// How long lookup values are reused by default
+	defaultLookupRefresh = 5 * time.Minute
+	// Lookups are joined in memory, larger tables belong in the query
+	maxLookupEntries = 100000
+)
+
+// lookupFetcher reads the key/value pairs of a lookup source
+type lookupFetcher interface {
+	fetch(ctx context.Context) (map[string]string, error)
+}
+
+// timestreamLookup reads the first two columns of a Timestream query
+type timestreamLookup struct {
+	client QueryClient
+	query  string
+}
+
+func (l timestreamLookup) fetch(ctx context.Context) (map[string]string, error) {
+	values := map[string]string{}
+	input := &timestreamquery.QueryInput{QueryString: aws.String(l.query)}
+	for {
+		output, err := l.client.Query(ctx, input)
+		if err != nil {
+			return nil, err
+		}
+		for _, row := range output.Rows {
+			if len(row.Data) < 2 || row.Data[0].ScalarValue == nil || row.Data[1].ScalarValue == nil {
+				continue
+			}
+			values[*row.Data[0].ScalarValue] = *row.Data[1].ScalarValue
+		}
+		if len(values) > maxLookupEntries {
+			return nil, fmt.Errorf("lookup has more than %d entries", maxLookupEntries)
+		}
+		if output.NextToken == nil {
+			return values, nil
+		}
+		input = &timestreamquery.QueryInput{QueryString: input.QueryString, NextToken: output.NextToken}
+	}
+}
+
+type lookupSource struct {
+	kind    string
+	fetcher lookupFetcher
+	refresh time.Duration
+}
+
+type lookupEntry struct {
+	values  map[string]string
+	fetched time.Time
+	err     error
+}
+
+// LookupStatus describes a lookup for the lookups resource
+type LookupStatus struct {
+	Name           string    `json:"name"`
+	Source         string    `json:"source"`
+	RefreshSeconds int64     `json:"refreshSeconds"`
+	Entries        int       `json:"entries"`
+	FetchedAt      time.Time `json:"fetchedAt,omitempty"`
+	Error          string    `json:"error,omitempty"`
+}
+
+// lookupStore reads the lookups of the datasource and keeps their values for the
+// refresh period. A nil store has no lookups.
+type lookupStore struct {
+	sources map[string]lookupSource
+
+	mu      sync.Mutex
+	entries map[string]lookupEntry
+}
+
+func newLookupStore(client QueryClient, s3Client S3Client, sources []models.LookupSource) (*lookupStore, error) {
+	s := &lookupStore{sources: map[string]lookupSource{}, entries: map[string]lookupEntry{}}
+	for _, source := range sources {
+		if source.Name == "" {
+			return nil, fmt.Errorf("lookups: missing name")
+		}
+		if _, ok := s.sources[source.Name]; ok {
+			return nil, fmt.Errorf("lookups: duplicate name %q", source.Name)
+		}
+		refresh := time.Duration(source.RefreshSeconds) * time.Second
+		if refresh <= 0 {
+			refresh = defaultLookupRefresh
+		}
+		switch {
+		case source.Query != "" && source.Bucket == "":
+			s.sources[source.Name] = lookupSource{kind: "timestream", fetcher: timestreamLookup{client: client, query: source.Query}, refresh: refresh}
+		case source.Query == "" && source.Bucket != "" && source.Key != "":
+			if source.Format != "" && source.Format != "csv" {
+				return nil, fmt.Errorf("lookups: %q has unsupported format %q, only csv is supported", source.Name, source.Format)
+			}
+			fetcher := &s3Lookup{client: s3Client, bucket: source.Bucket, key: source.Key, keyColumn: source.KeyColumn, valueColumn: source.ValueColumn}
+			s.sources[source.Name] = lookupSource{kind: "s3", fetcher: fetcher, refresh: refresh}
+		default:
+			return nil, fmt.Errorf("lookups: %q needs either a query or an S3 bucket and key", source.Name)
+		}
+	}
+	return s, nil
+}
+
+// values returns the key/value pairs of the lookup, fetching them when they are
+// older than the refresh period. Concurrent callers may fetch the same lookup.
+func (s *lookupStore) values(ctx context.Context, name string, now time.Time) (map[string]string, error) {
+	if s == nil {
+		return nil, fmt.Errorf("unknown lookup %q", name)
+	}
+	if _, ok := s.sources[name]; !ok {
+		return nil, fmt.Errorf("unknown lookup %q", name)
+	}
+	s.mu.Lock()
+	entry, ok := s.entries[name]
+	s.mu.Unlock()
+	if ok && entry.err == nil && now.Sub(entry.fetched) < s.sources[name].refresh {
+		return entry.values, nil
+	}
+	return s.fetch(ctx, name, now)
+}
+
+// refresh fetches the lookup regardless of its age, every lookup for an empty name
+func (s *lookupStore) refresh(ctx context.Context, name string, now time.Time) error {
+	if name != "" {
+		if s == nil || s.sources[name].fetcher == nil {
+			return fmt.Errorf("unknown lookup %q", name)
+		}
+		_, err := s.fetch(ctx, name, now)
+		return err
+	}
+	for _, status := range s.list() {
+		if _, err := s.fetch(ctx, status.Name, now); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *lookupStore) fetch(ctx context.Context, name string, now time.Time) (map[string]string, error) {
+	values, err := s.sources[name].fetcher.fetch(ctx)
+	if err != nil {
+		err = fmt.Errorf("lookup %q: %w", name, err)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err != nil {
+		entry := s.entries[name]
+		entry.err = err
+		s.entries[name] = entry
+		return nil, err
+	}
+	s.entries[name] = lookupEntry{values: values, fetched: now}
+	return values, nil
+}
+
+// list returns the status of the lookups, ordered by name
+func (s *lookupStore) list() []LookupStatus {
+	out := []LookupStatus{}
+	if s == nil {
+		return out
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for name, source := range s.sources {
+		status := LookupStatus{Name: name, Source: source.kind, RefreshSeconds: int64(source.refresh.Seconds())}
+		if entry, ok := s.entries[name]; ok {
+			status.Entries = len(entry.values)
+			status.FetchedAt = entry.fetched
+			if entry.err != nil {
+				status.Error = entry.err.Error()
+			}
+		}
+		out = append(out, status)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out
+}
+
+// enrichFrames adds the lookup values of the enrichment columns. Table frames get a
+// column of the values, time series fields labeled with the column a label.
+func (ds *timestreamDS) enrichFrames(ctx context.Context, frames data.Frames, enrich []models.Enrichment) error {
+	for _, e := range enrich {
+		values, err := ds.lookups.values(ctx, e.Lookup, time.Now())
+		if err != nil {
+			return err
+		}
+		as := e.As
+		if as == "" {
+			as = e.Lookup
+		}
+		for _, frame := range frames {
+			enrichFrame(frame, e.Column, as, values)
+		}
+	}
+	return nil
+}
+
+func enrichFrame(frame *data.Frame, column, as string, values map[string]string) {
+	for _, field := range frame.Fields {
+		if key, ok := field.Labels[column]; ok {
+			if value, ok := values[key]; ok {
+				field.Labels[as] = value
+			}
+		}
+	}
+	idx := -1
+	for i, field := range frame.Fields {
+		if field.Name == column {
+			idx = i
+			break
+		}
+	}
+	if idx == -1 {
+		return
+	}
+	keys := frame.Fields[idx]
+	enriched := data.NewFieldFromFieldType(data.FieldTypeNullableString, keys.Len())
+	enriched.Name = as
+	for i := 0; i < keys.Len(); i++ {
+		key, ok := keys.ConcreteAt(i)
+		if !ok {
+			continue
+		}
+		if value, found := values[fmt.Sprint(key)]; found {
+			enriched.Set(i, &value)
+		}
+	}
+	frame.Fields = append(frame.Fields[:idx+1], append([]*data.Field{enriched}, frame.Fields[idx+1:]...)...)
+}
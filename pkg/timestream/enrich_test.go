@@ -0,0 +1,142 @@
+package timestream
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/timestreamquery"
+	timestreamquerytypes "github.com/aws/aws-sdk-go-v2/service/timestreamquery/types"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/grafana/timestream-datasource/pkg/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type staticLookup struct {
+	values map[string]string
+	err    error
+	calls  int
+}
+
+func (l *staticLookup) fetch(context.Context) (map[string]string, error) {
+	l.calls++
+	return l.values, l.err
+}
+
+func TestNewLookupStore(t *testing.T) {
+	store, err := newLookupStore(nil, nil, []models.LookupSource{
+		{Name: "devices", Query: "SELECT 1"},
+		{Name: "sites", Bucket: "lookups", Key: "sites.csv", RefreshSeconds: 60},
+	})
+	require.NoError(t, err)
+	list := store.list()
+	require.Len(t, list, 2)
+	assert.Equal(t, "timestream", list[0].Source)
+	assert.Equal(t, "s3", list[1].Source)
+	assert.Equal(t, int64(60), list[1].RefreshSeconds)
+
+	for _, sources := range [][]models.LookupSource{
+		{{Query: "SELECT 1"}},
+		{{Name: "devices"}},
+		{{Name: "devices", Query: "SELECT 1"}, {Name: "devices", Query: "SELECT 2"}},
+		{{Name: "devices", Query: "SELECT 1", Bucket: "lookups", Key: "devices.csv"}},
+		{{Name: "devices", Bucket: "lookups"}},
+		{{Name: "devices", Bucket: "lookups", Key: "devices.parquet", Format: "parquet"}},
+	} {
+		_, err := newLookupStore(nil, nil, sources)
+		assert.Error(t, err, sources)
+	}
+}
+
+func TestLookupStore_Values(t *testing.T) {
+	now := time.Now()
+	fetcher := &staticLookup{values: map[string]string{"d1": "Boiler"}}
+	store := &lookupStore{
+		sources: map[string]lookupSource{"devices": {fetcher: fetcher, refresh: time.Minute}},
+		entries: map[string]lookupEntry{},
+	}
+
+	values, err := store.values(context.Background(), "devices", now)
+	require.NoError(t, err)
+	assert.Equal(t, "Boiler", values["d1"])
+	_, err = store.values(context.Background(), "devices", now.Add(30*time.Second))
+	require.NoError(t, err)
+	assert.Equal(t, 1, fetcher.calls)
+	_, err = store.values(context.Background(), "devices", now.Add(time.Minute))
+	require.NoError(t, err)
+	assert.Equal(t, 2, fetcher.calls)
+
+	_, err = store.values(context.Background(), "sites", now)
+	assert.ErrorContains(t, err, "unknown lookup")
+	var nilStore *lookupStore
+	_, err = nilStore.values(context.Background(), "devices", now)
+	assert.ErrorContains(t, err, "unknown lookup")
+}
+
+func TestTimestreamLookup(t *testing.T) {
+	client := &fakeClient{output: &timestreamquery.QueryOutput{Rows: []timestreamquerytypes.Row{
+		{Data: []timestreamquerytypes.Datum{{ScalarValue: aws.String("d1")}, {ScalarValue: aws.String("Boiler")}}},
+		{Data: []timestreamquerytypes.Datum{{ScalarValue: aws.String("d2")}, {NullValue: aws.Bool(true)}}},
+	}}}
+	values, err := timestreamLookup{client: client, query: "SELECT device_id, name FROM db.devices WHERE time > ago(1d)"}.fetch(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"d1": "Boiler"}, values)
+}
+
+func TestEnrichFrame(t *testing.T) {
+	values := map[string]string{"d1": "Boiler", "d2": "Heat pump"}
+
+	table := data.NewFrame("",
+		data.NewField("device", nil, []string{"d1", "d2", "d3"}),
+		data.NewField("value", nil, []float64{1, 2, 3}),
+	)
+	enrichFrame(table, "device", "name", values)
+	require.Len(t, table.Fields, 3)
+	assert.Equal(t, "name", table.Fields[1].Name)
+	name, _ := table.Fields[1].ConcreteAt(0)
+	assert.Equal(t, "Boiler", name)
+	_, ok := table.Fields[1].ConcreteAt(2)
+	assert.False(t, ok, "unknown keys are null")
+
+	series := data.NewFrame("",
+		data.NewField("time", nil, []time.Time{time.Now()}),
+		data.NewField("value", data.Labels{"device": "d2"}, []float64{1}),
+	)
+	enrichFrame(series, "device", "name", values)
+	assert.Len(t, series.Fields, 2)
+	assert.Equal(t, "Heat pump", series.Fields[1].Labels["name"])
+}
+
+func TestExecuteQuery_Enrich(t *testing.T) {
+	client := &fakeClient{output: &timestreamquery.QueryOutput{
+		ColumnInfo: []timestreamquerytypes.ColumnInfo{
+			{Name: aws.String("device"), Type: &timestreamquerytypes.Type{ScalarType: timestreamquerytypes.ScalarTypeVarchar}},
+		},
+		Rows: []timestreamquerytypes.Row{{Data: []timestreamquerytypes.Datum{{ScalarValue: aws.String("d1")}}}},
+	}}
+	fetcher := &staticLookup{values: map[string]string{"d1": "Boiler"}}
+	ds := &timestreamDS{Client: client, lookups: &lookupStore{
+		sources: map[string]lookupSource{"devices": {fetcher: fetcher, refresh: time.Minute}},
+		entries: map[string]lookupEntry{},
+	}}
+	query := models.QueryModel{
+		RawQuery: "SELECT device FROM db.tbl WHERE time > ago(1h) AND measure_name = 'cpu'",
+		Enrich:   []models.Enrichment{{Lookup: "devices", Column: "device"}},
+	}
+
+	dr := ds.ExecuteQuery(context.Background(), query)
+	require.NoError(t, dr.Error)
+	require.Len(t, dr.Frames[0].Fields, 2)
+	assert.Equal(t, "devices", dr.Frames[0].Fields[1].Name)
+
+	fetcher.err = errors.New("access denied")
+	ds.lookups.entries = map[string]lookupEntry{}
+	dr = ds.ExecuteQuery(context.Background(), query)
+	require.NoError(t, dr.Error)
+	assert.Len(t, dr.Frames[0].Fields, 1)
+	require.Len(t, dr.Frames[0].Meta.Notices, 1)
+	assert.Contains(t, dr.Frames[0].Meta.Notices[0].Text, "access denied")
+}
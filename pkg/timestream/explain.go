@@ -0,0 +1,156 @@
+package timestream
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+type planNode struct {
+	id            int64
+	parent        *int64
+	level         int64
+	operator      string
+	details       []string
+	estimatedRows *float64
+}
+
+// operator lines are prefixed by a tree marker
+var planOperatorPrefixes = []string{"- ", "└─ ", "├─ "}
+
+var (
+	planFragmentLine = regexp.MustCompile(`^Fragment \d+`)
+	planRowsEstimate = regexp.MustCompile(`rows:\s*([0-9][0-9,.]*)`)
+)
+
+// isExplainQuery reports whether the query asks for an execution plan
+func isExplainQuery(sql string) bool {
+	fields := strings.Fields(sql)
+	return len(fields) > 0 && strings.EqualFold(fields[0], "explain")
+}
+
+// parseExplainPlan turns the textual plan of EXPLAIN [ANALYZE] into an operator tree.
+// Nesting is derived from the indentation of each operator line.
+func parseExplainPlan(text string) []planNode {
+	nodes := []planNode{}
+	// indentation and index of the open operators, innermost last
+	type open struct {
+		indent int
+		index  int
+	}
+	stack := []open{}
+
+	for _, line := range strings.Split(text, "\n") {
+		trimmed := strings.TrimLeftFunc(line, func(r rune) bool {
+			return unicode.IsSpace(r) || r == '│'
+		})
+		if trimmed == "" {
+			continue
+		}
+		indent := len([]rune(line)) - len([]rune(trimmed))
+
+		operator := ""
+		isFragment := planFragmentLine.MatchString(trimmed)
+		if isFragment {
+			operator = trimmed
+		}
+		for _, prefix := range planOperatorPrefixes {
+			if strings.HasPrefix(trimmed, prefix) {
+				operator = strings.TrimSpace(strings.TrimPrefix(trimmed, prefix))
+			}
+		}
+		if operator == "" {
+			if len(nodes) == 0 {
+				continue
+			}
+			node := &nodes[len(nodes)-1]
+			node.details = append(node.details, trimmed)
+			if node.estimatedRows == nil {
+				if m := planRowsEstimate.FindStringSubmatch(trimmed); m != nil {
+					if v, err := strconv.ParseFloat(strings.ReplaceAll(m[1], ",", ""), 64); err == nil {
+						node.estimatedRows = &v
+					}
+				}
+			}
+			continue
+		}
+
+		if isFragment {
+			// Fragments are independent sub plans
+			stack = stack[:0]
+		}
+		for len(stack) > 0 && stack[len(stack)-1].indent >= indent {
+			stack = stack[:len(stack)-1]
+		}
+		node := planNode{
+			id:       int64(len(nodes)),
+			level:    int64(len(stack)),
+			operator: operator,
+		}
+		if len(stack) > 0 {
+			parent := nodes[stack[len(stack)-1].index].id
+			node.parent = &parent
+		}
+		nodes = append(nodes, node)
+		stack = append(stack, open{indent: indent, index: len(nodes) - 1})
+	}
+	return nodes
+}
+
+// explainPlanFrame converts the plan into a table friendly frame
+func explainPlanFrame(nodes []planNode) *data.Frame {
+	ids := make([]int64, len(nodes))
+	parents := make([]*int64, len(nodes))
+	levels := make([]int64, len(nodes))
+	operators := make([]string, len(nodes))
+	details := make([]string, len(nodes))
+	rows := make([]*float64, len(nodes))
+	for i, node := range nodes {
+		ids[i] = node.id
+		parents[i] = node.parent
+		levels[i] = node.level
+		operators[i] = strings.Repeat("  ", int(node.level)) + node.operator
+		details[i] = strings.Join(node.details, "\n")
+		rows[i] = node.estimatedRows
+	}
+	return data.NewFrame("",
+		data.NewField("id", nil, ids),
+		data.NewField("parentId", nil, parents),
+		data.NewField("level", nil, levels),
+		data.NewField("operator", nil, operators),
+		data.NewField("estimatedRows", nil, rows),
+		data.NewField("details", nil, details),
+	)
+}
+
+// explainResponse replaces the plain text plan in the response with the structured plan
+func explainResponse(dr backend.DataResponse) backend.DataResponse {
+	if dr.Error != nil || len(dr.Frames) == 0 {
+		return dr
+	}
+	frame := dr.Frames[0]
+	lines := []string{}
+	for _, field := range frame.Fields {
+		if field.Type() != data.FieldTypeNullableString {
+			continue
+		}
+		for i := 0; i < field.Len(); i++ {
+			if v, ok := field.ConcreteAt(i); ok {
+				lines = append(lines, v.(string))
+			}
+		}
+		break
+	}
+	nodes := parseExplainPlan(strings.Join(lines, "\n"))
+	if len(nodes) == 0 {
+		return dr
+	}
+	plan := explainPlanFrame(nodes)
+	plan.Meta = frame.Meta
+	dr.Frames[0] = plan
+	return dr
+}
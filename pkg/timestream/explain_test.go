@@ -0,0 +1,83 @@
+package timestream
+
+import (
+	"testing"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const samplePlan = `Fragment 0 [SINGLE]
+    Output layout: [device, avg]
+    Output partitioning: SINGLE []
+    - Output[columnNames = [device, avg]]
+        │   Layout: [device:varchar, avg:double]
+        │   Estimates: {rows: 1,200 (24kB), cpu: ?, memory: 0B, network: ?}
+        └─ Aggregate[type = FINAL, keys = [device]]
+            │   Estimates: {rows: ? (?), cpu: ?, memory: ?, network: ?}
+            ├─ LocalExchange[partitioning = HASH]
+            │      Estimates: {rows: 5 (1kB), cpu: ?, memory: ?, network: ?}
+            └─ RemoteSource[sourceFragmentIds = [1]]
+
+Fragment 1 [SOURCE]
+    - ScanFilter[table = db.tbl]
+        Estimates: {rows: 10 (1kB), cpu: ?, memory: ?, network: ?}`
+
+func TestIsExplainQuery(t *testing.T) {
+	assert.True(t, isExplainQuery("  explain analyze SELECT 1"))
+	assert.True(t, isExplainQuery("EXPLAIN\nSELECT 1"))
+	assert.False(t, isExplainQuery("SELECT 'explain'"))
+	assert.False(t, isExplainQuery(""))
+}
+
+func TestParseExplainPlan(t *testing.T) {
+	nodes := parseExplainPlan(samplePlan)
+	require.Len(t, nodes, 7)
+
+	ops := []string{}
+	for _, n := range nodes {
+		ops = append(ops, n.operator)
+	}
+	assert.Equal(t, []string{
+		"Fragment 0 [SINGLE]",
+		"Output[columnNames = [device, avg]]",
+		"Aggregate[type = FINAL, keys = [device]]",
+		"LocalExchange[partitioning = HASH]",
+		"RemoteSource[sourceFragmentIds = [1]]",
+		"Fragment 1 [SOURCE]",
+		"ScanFilter[table = db.tbl]",
+	}, ops)
+
+	assert.Nil(t, nodes[0].parent)
+	assert.Equal(t, int64(0), *nodes[1].parent)
+	assert.Equal(t, int64(1), *nodes[2].parent)
+	assert.Equal(t, int64(2), *nodes[3].parent)
+	assert.Equal(t, int64(2), *nodes[4].parent)
+	assert.Nil(t, nodes[5].parent)
+	assert.Equal(t, int64(5), *nodes[6].parent)
+	assert.Equal(t, int64(3), nodes[4].level)
+
+	assert.Equal(t, 1200.0, *nodes[1].estimatedRows)
+	assert.Nil(t, nodes[2].estimatedRows)
+	assert.Equal(t, 5.0, *nodes[3].estimatedRows)
+	assert.Equal(t, 10.0, *nodes[6].estimatedRows)
+}
+
+func TestExplainResponse(t *testing.T) {
+	line := samplePlan
+	frame := data.NewFrame("", data.NewField("Query Plan", nil, []*string{&line}))
+	frame.Meta = &data.FrameMeta{ExecutedQueryString: "EXPLAIN SELECT 1"}
+
+	dr := explainResponse(backend.DataResponse{Frames: data.Frames{frame}})
+	require.Len(t, dr.Frames, 1)
+	assert.Equal(t, 7, dr.Frames[0].Rows())
+	assert.Equal(t, "operator", dr.Frames[0].Fields[3].Name)
+	assert.Equal(t, "EXPLAIN SELECT 1", dr.Frames[0].Meta.ExecutedQueryString)
+
+	plain := "not a plan"
+	unchanged := data.NewFrame("", data.NewField("text", nil, []*string{&plain}))
+	dr = explainResponse(backend.DataResponse{Frames: data.Frames{unchanged}})
+	assert.Equal(t, unchanged, dr.Frames[0])
+}
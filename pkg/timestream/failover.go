@@ -0,0 +1,202 @@
+package timestream
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/timestreamquery"
+	"github.com/aws/smithy-go"
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+)
+
+// Defaults for switching to the fallback client
+const (
+	defaultFailoverThreshold = 3
+	defaultFailoverCooldown  = 5 * time.Minute
+	// How long the pages and cancellation of a query stay with the client that
+	// started it
+	failoverPinTTL = time.Hour
+)
+
+// failoverClient sends queries to the primary client until it fails threshold times
+// in a row, then to the fallback client for the cooldown before trying the primary
+// again. Only server faults and connection errors count as failures, errors caused
+// by the query itself would fail on the replica as well. The next pages and the
+// cancellation of a query go to the client that started it, the other one doesn't
+// know its tokens.
+type failoverClient struct {
+	primary   QueryClient
+	fallback  QueryClient
+	threshold int
+	cooldown  time.Duration
+
+	mu       sync.Mutex
+	failures int
+	until    time.Time
+	// the client answering a query id or next token
+	pins map[string]pinnedClient
+}
+
+type pinnedClient struct {
+	client  QueryClient
+	expires time.Time
+}
+
+func newFailoverClient(primary, fallback QueryClient, threshold int, cooldown time.Duration) *failoverClient {
+	if threshold <= 0 {
+		threshold = defaultFailoverThreshold
+	}
+	if cooldown <= 0 {
+		cooldown = defaultFailoverCooldown
+	}
+	return &failoverClient{primary: primary, fallback: fallback, threshold: threshold, cooldown: cooldown, pins: map[string]pinnedClient{}}
+}
+
+func (c *failoverClient) Query(ctx context.Context, input *timestreamquery.QueryInput, opts ...func(*timestreamquery.Options)) (*timestreamquery.QueryOutput, error) {
+	if input.NextToken != nil {
+		if client := c.pinned("token:"+*input.NextToken, time.Now()); client != nil {
+			return c.query(ctx, client, input, opts...)
+		}
+	}
+	if c.failedOver(time.Now()) {
+		return c.query(ctx, c.fallback, input, opts...)
+	}
+	output, err := c.primary.Query(ctx, input, opts...)
+	if !c.observe(ctx, err, time.Now()) {
+		c.pin(input, output, err, c.primary, time.Now())
+		return output, err
+	}
+	return c.query(ctx, c.fallback, input, opts...)
+}
+
+// query runs the request on the client without failing over and pins the query to it
+func (c *failoverClient) query(ctx context.Context, client QueryClient, input *timestreamquery.QueryInput, opts ...func(*timestreamquery.Options)) (*timestreamquery.QueryOutput, error) {
+	if client == c.fallback {
+		markFallback(ctx)
+	}
+	output, err := client.Query(ctx, input, opts...)
+	c.pin(input, output, err, client, time.Now())
+	return output, err
+}
+
+func (c *failoverClient) CancelQuery(ctx context.Context, input *timestreamquery.CancelQueryInput, opts ...func(*timestreamquery.Options)) (*timestreamquery.CancelQueryOutput, error) {
+	if input.QueryId != nil {
+		if client := c.pinned("query:"+*input.QueryId, time.Now()); client != nil {
+			return client.CancelQuery(ctx, input, opts...)
+		}
+	}
+	if c.failedOver(time.Now()) {
+		return c.fallback.CancelQuery(ctx, input, opts...)
+	}
+	return c.primary.CancelQuery(ctx, input, opts...)
+}
+
+// pinned returns the client a query id or next token is pinned to, or nil
+func (c *failoverClient) pinned(key string, now time.Time) QueryClient {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	pin, ok := c.pins[key]
+	if !ok || !now.Before(pin.expires) {
+		return nil
+	}
+	return pin.client
+}
+
+// pin sends the next page and the cancellation of the query of output to client.
+// The query is unpinned once its last page arrived.
+func (c *failoverClient) pin(input *timestreamquery.QueryInput, output *timestreamquery.QueryOutput, err error, client QueryClient, now time.Time) {
+	if err != nil || output == nil || output.QueryId == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for k, pin := range c.pins {
+		if !now.Before(pin.expires) {
+			delete(c.pins, k)
+		}
+	}
+	if input.NextToken != nil {
+		delete(c.pins, "token:"+*input.NextToken)
+	}
+	if output.NextToken == nil {
+		delete(c.pins, "query:"+*output.QueryId)
+		return
+	}
+	pin := pinnedClient{client: client, expires: now.Add(failoverPinTTL)}
+	c.pins["query:"+*output.QueryId] = pin
+	c.pins["token:"+*output.NextToken] = pin
+}
+
+func (c *failoverClient) failedOver(now time.Time) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return now.Before(c.until)
+}
+
+// observe counts the consecutive failures of the primary and reports whether the
+// request should be retried on the fallback
+func (c *failoverClient) observe(ctx context.Context, err error, now time.Time) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err == nil {
+		c.failures = 0
+		return false
+	}
+	if !isAvailabilityError(ctx, err) {
+		return false
+	}
+	c.failures++
+	if c.failures < c.threshold {
+		return false
+	}
+	backend.Logger.Warn("primary failed, using the fallback", "failures", c.failures, "cooldown", c.cooldown.String(), "error", err.Error())
+	c.failures = 0
+	c.until = now.Add(c.cooldown)
+	return true
+}
+
+// isAvailabilityError reports whether err says the service is unavailable rather than
+// the request being invalid, throttled or canceled
+func isAvailabilityError(ctx context.Context, err error) bool {
+	if ctx.Err() != nil || errors.Is(err, context.Canceled) || asQuotaError(err) != nil {
+		return false
+	}
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.ErrorFault() == smithy.FaultServer
+	}
+	// no response from the service, e.g. connection or DNS failures
+	return true
+}
+
+type fallbackMarkerKey struct{}
+
+// withFallbackMarker returns a context recording whether a fallback client answered
+func withFallbackMarker(ctx context.Context) context.Context {
+	return context.WithValue(ctx, fallbackMarkerKey{}, &fallbackMarker{})
+}
+
+type fallbackMarker struct {
+	mu   sync.Mutex
+	used bool
+}
+
+func markFallback(ctx context.Context) {
+	if m, ok := ctx.Value(fallbackMarkerKey{}).(*fallbackMarker); ok {
+		m.mu.Lock()
+		m.used = true
+		m.mu.Unlock()
+	}
+}
+
+func servedFromFallback(ctx context.Context) bool {
+	m, ok := ctx.Value(fallbackMarkerKey{}).(*fallbackMarker)
+	if !ok {
+		return false
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.used
+}
@@ -0,0 +1,127 @@
+package timestream
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/timestreamquery"
+	timestreamquerytypes "github.com/aws/aws-sdk-go-v2/service/timestreamquery/types"
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/timestream-datasource/pkg/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFailoverClient(t *testing.T) {
+	primary := &fakeClient{output: &timestreamquery.QueryOutput{}, err: &timestreamquerytypes.InternalServerException{Message: aws.String("down")}}
+	fallback := &fakeClient{output: &timestreamquery.QueryOutput{}}
+	client := newFailoverClient(primary, fallback, 2, time.Hour)
+	input := &timestreamquery.QueryInput{QueryString: aws.String("SELECT 1")}
+
+	_, err := client.Query(context.Background(), input)
+	assert.Error(t, err)
+	assert.Len(t, fallback.calls.runQuery, 0)
+
+	// the second failure in a row switches over and retries the request
+	ctx := withFallbackMarker(context.Background())
+	_, err = client.Query(ctx, input)
+	require.NoError(t, err)
+	assert.True(t, servedFromFallback(ctx))
+	assert.Len(t, primary.calls.runQuery, 2)
+
+	// during the cooldown the primary is skipped
+	_, err = client.Query(context.Background(), input)
+	require.NoError(t, err)
+	assert.Len(t, primary.calls.runQuery, 2)
+	assert.Len(t, fallback.calls.runQuery, 2)
+}
+
+func TestFailoverClient_QueryErrors(t *testing.T) {
+	primary := &fakeClient{err: &timestreamquerytypes.ValidationException{Message: aws.String("bad query")}}
+	fallback := &fakeClient{}
+	client := newFailoverClient(primary, fallback, 1, time.Hour)
+
+	for i := 0; i < 3; i++ {
+		_, err := client.Query(context.Background(), &timestreamquery.QueryInput{})
+		assert.Error(t, err)
+	}
+	assert.Len(t, fallback.calls.runQuery, 0)
+}
+
+// cancelClient records the queries it was asked to cancel
+type cancelClient struct {
+	*fakeClient
+	canceled []string
+}
+
+func (c *cancelClient) CancelQuery(_ context.Context, input *timestreamquery.CancelQueryInput, _ ...func(*timestreamquery.Options)) (*timestreamquery.CancelQueryOutput, error) {
+	c.canceled = append(c.canceled, *input.QueryId)
+	return &timestreamquery.CancelQueryOutput{}, nil
+}
+
+func TestFailoverClient_PinsQueries(t *testing.T) {
+	down := &timestreamquerytypes.InternalServerException{Message: aws.String("down")}
+	primary := &cancelClient{fakeClient: &fakeClient{output: &timestreamquery.QueryOutput{QueryId: aws.String("p1"), NextToken: aws.String("p1-2")}}}
+	fallback := &cancelClient{fakeClient: &fakeClient{output: &timestreamquery.QueryOutput{QueryId: aws.String("f1"), NextToken: aws.String("f1-2")}}}
+	client := newFailoverClient(primary, fallback, 1, time.Hour)
+	ctx := context.Background()
+
+	_, err := client.Query(ctx, &timestreamquery.QueryInput{QueryString: aws.String("SELECT 1")})
+	require.NoError(t, err)
+
+	// another query fails over, the started one keeps reading from the primary
+	primary.err = down
+	_, err = client.Query(ctx, &timestreamquery.QueryInput{QueryString: aws.String("SELECT 2")})
+	require.NoError(t, err)
+	require.True(t, client.failedOver(time.Now()))
+
+	primary.err = nil
+	primary.output = &timestreamquery.QueryOutput{QueryId: aws.String("p1")}
+	_, err = client.Query(ctx, &timestreamquery.QueryInput{QueryString: aws.String("SELECT 1"), NextToken: aws.String("p1-2")})
+	require.NoError(t, err)
+	assert.Len(t, primary.calls.runQuery, 3)
+	assert.Len(t, fallback.calls.runQuery, 1)
+
+	// the query started on the fallback is canceled and paged there after the cooldown
+	client.until = time.Time{}
+	_, err = client.CancelQuery(ctx, &timestreamquery.CancelQueryInput{QueryId: aws.String("f1")})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"f1"}, fallback.canceled)
+	assert.Empty(t, primary.canceled)
+	_, err = client.Query(ctx, &timestreamquery.QueryInput{QueryString: aws.String("SELECT 2"), NextToken: aws.String("f1-2")})
+	require.NoError(t, err)
+	assert.Len(t, fallback.calls.runQuery, 2)
+	assert.Len(t, primary.calls.runQuery, 3)
+
+	// finished queries are unpinned
+	_, err = client.CancelQuery(ctx, &timestreamquery.CancelQueryInput{QueryId: aws.String("p1")})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"p1"}, primary.canceled)
+	assert.Len(t, client.pins, 2)
+}
+
+func TestIsAvailabilityError(t *testing.T) {
+	ctx := context.Background()
+	assert.True(t, isAvailabilityError(ctx, errors.New("dial tcp: connection refused")))
+	assert.True(t, isAvailabilityError(ctx, &timestreamquerytypes.InternalServerException{}))
+	assert.False(t, isAvailabilityError(ctx, &timestreamquerytypes.ValidationException{}))
+	assert.False(t, isAvailabilityError(ctx, &timestreamquerytypes.ThrottlingException{}))
+	assert.False(t, isAvailabilityError(ctx, context.Canceled))
+}
+
+func TestExecuteQuery_FallbackNotice(t *testing.T) {
+	primary := &fakeClient{err: errors.New("connection reset")}
+	fallback := &fakeClient{output: &timestreamquery.QueryOutput{}}
+	ds := &timestreamDS{Client: newFailoverClient(primary, fallback, 1, time.Hour)}
+
+	dr := ds.ExecuteQuery(context.Background(), models.QueryModel{
+		RawQuery:  "SELECT * FROM db.tbl WHERE $__timeFilter AND measure_name = 'cpu'",
+		TimeRange: backend.TimeRange{From: time.Now().Add(-time.Hour), To: time.Now()},
+	})
+	require.NoError(t, dr.Error)
+	require.Len(t, dr.Frames[0].Meta.Notices, 1)
+	assert.Equal(t, "served from fallback", dr.Frames[0].Meta.Notices[0].Text)
+}
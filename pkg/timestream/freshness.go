@@ -0,0 +1,143 @@
+package timestream
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/timestreamquery"
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/grafana/grafana-plugin-sdk-go/experimental/errorsource"
+	"github.com/grafana/timestream-datasource/pkg/models"
+)
+
+const (
+	// Freshness lookups only scan this far back, older data counts as missing
+	freshnessLookback = 24 * time.Hour
+	// How long a freshness lookup is answered from the cache
+	freshnessTTL = time.Minute
+)
+
+// freshnessSQL selects the latest time of each measure of the table within the lookback
+func freshnessSQL(database, table, measure string) string {
+	sql := fmt.Sprintf("SELECT measure_name, max(time) AS last_time FROM %s.%s WHERE time > ago(%dh)",
+		quoteIdentifier(database), quoteIdentifier(table), int(freshnessLookback.Hours()))
+	if measure != "" {
+		sql += " AND measure_name = " + quoteLiteral(measure)
+	}
+	return sql + " GROUP BY measure_name"
+}
+
+// freshness returns the latest data point of each measure, ordered by measure name.
+// Measures without data in the lookback are not listed. The lookup is checked
+// like panel queries, see metadataQuery.
+func (ds *timestreamDS) freshness(ctx context.Context, req models.FreshnessRequest, now time.Time) ([]models.Freshness, error) {
+	if req.Database == "" || req.Table == "" {
+		return nil, fmt.Errorf("freshness requires a database and a table")
+	}
+	sql := freshnessSQL(req.Database, req.Table, req.Measure)
+	output, err := ds.metadataQuery(ctx, ds.freshnessCache, "freshness", models.QueryModel{RawQuery: sql, ValidatorProfile: req.ValidatorProfile}, 0, now)
+	if err != nil {
+		return nil, err
+	}
+
+	out := []models.Freshness{}
+	for _, row := range output.Rows {
+		if len(row.Data) < 2 || row.Data[0].ScalarValue == nil || row.Data[1].ScalarValue == nil {
+			continue
+		}
+		last, err := time.Parse("2006-01-02 15:04:05.999999999", *row.Data[1].ScalarValue)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, models.Freshness{
+			Database:   req.Database,
+			Table:      req.Table,
+			Measure:    *row.Data[0].ScalarValue,
+			LastTime:   last,
+			AgeSeconds: int64(now.Sub(last).Seconds()),
+		})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Measure < out[j].Measure })
+	return out, nil
+}
+
+// executeFreshness answers a freshness query with a frame of the latest time and
+// age of each measure
+func (ds *timestreamDS) executeFreshness(ctx context.Context, query models.QueryModel) backend.DataResponse {
+	req := models.FreshnessRequest{
+		Database: valueOrDefault(query.Database, ds.Settings.DefaultDatabase),
+		Table:    valueOrDefault(query.Table, ds.Settings.DefaultTable),
+		Measure:  query.Measure,
+
+		ValidatorProfile: query.ValidatorProfile,
+	}
+	rows, err := ds.freshness(ctx, req, time.Now())
+	if err != nil {
+		return errorsource.Response(errorsource.DownstreamError(err, false))
+	}
+	frame := data.NewFrame("freshness",
+		data.NewField("measure", nil, []string{}),
+		data.NewField("last_time", nil, []time.Time{}),
+		data.NewField("age", nil, []int64{}).SetConfig(&data.FieldConfig{Unit: "s"}),
+	)
+	for _, r := range rows {
+		frame.AppendRow(r.Measure, r.LastTime, r.AgeSeconds)
+	}
+	if len(rows) == 0 {
+		frame.AppendNotices(data.Notice{
+			Severity: data.NoticeSeverityWarning,
+			Text:     fmt.Sprintf("no data in %s.%s within the last %s", req.Database, req.Table, freshnessLookback),
+		})
+	}
+	return backend.DataResponse{Frames: data.Frames{frame}}
+}
+
+// resultCache keeps the results of metadata queries like freshness lookups for a
+// short time, so every panel of a dashboard showing the data age doesn't scan the
+// table. A nil cache keeps nothing.
+type resultCache struct {
+	ttl time.Duration
+
+	mu      sync.Mutex
+	entries map[string]cachedResult
+}
+
+type cachedResult struct {
+	output  *timestreamquery.QueryOutput
+	expires time.Time
+}
+
+func newResultCache(ttl time.Duration) *resultCache {
+	return &resultCache{ttl: ttl, entries: map[string]cachedResult{}}
+}
+
+func (c *resultCache) get(sql string, now time.Time) (*timestreamquery.QueryOutput, bool) {
+	if c == nil {
+		return nil, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[sql]
+	if !ok || !now.Before(entry.expires) {
+		return nil, false
+	}
+	return entry.output, true
+}
+
+func (c *resultCache) put(sql string, output *timestreamquery.QueryOutput, now time.Time) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for k, entry := range c.entries {
+		if !now.Before(entry.expires) {
+			delete(c.entries, k)
+		}
+	}
+	c.entries[sql] = cachedResult{output: output, expires: now.Add(c.ttl)}
+}
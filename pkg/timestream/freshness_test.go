@@ -0,0 +1,116 @@
+package timestream
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/timestreamquery"
+	timestreamquerytypes "github.com/aws/aws-sdk-go-v2/service/timestreamquery/types"
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/timestream-datasource/pkg/models"
+	"github.com/grafana/timestream-datasource/pkg/timestream/validator"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func freshnessOutput() *timestreamquery.QueryOutput {
+	row := func(measure, last string) timestreamquerytypes.Row {
+		return timestreamquerytypes.Row{Data: []timestreamquerytypes.Datum{{ScalarValue: aws.String(measure)}, {ScalarValue: aws.String(last)}}}
+	}
+	return &timestreamquery.QueryOutput{Rows: []timestreamquerytypes.Row{
+		row("mem", "2024-01-01 11:50:00.000000000"),
+		row("cpu", "2024-01-01 11:58:30.000000000"),
+	}}
+}
+
+func TestFreshnessSQL(t *testing.T) {
+	assert.Equal(t, `SELECT measure_name, max(time) AS last_time FROM "db"."metrics" WHERE time > ago(24h) GROUP BY measure_name`, freshnessSQL("db", `"metrics"`, ""))
+	assert.Equal(t, `SELECT measure_name, max(time) AS last_time FROM "db"."metrics" WHERE time > ago(24h) AND measure_name = 'it''s' GROUP BY measure_name`, freshnessSQL("db", "metrics", "it's"))
+}
+
+func TestFreshness(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	client := &fakeClient{output: freshnessOutput()}
+	ds := &timestreamDS{Client: client, freshnessCache: newResultCache(time.Minute), Settings: models.DatasourceSettings{Validator: &validator.Options{AllowMissingMeasure: true}}}
+	req := models.FreshnessRequest{Database: "db", Table: "metrics"}
+
+	rows, err := ds.freshness(context.Background(), req, now)
+	require.NoError(t, err)
+	require.Len(t, rows, 2)
+	assert.Equal(t, "cpu", rows[0].Measure)
+	assert.Equal(t, int64(90), rows[0].AgeSeconds)
+	assert.Equal(t, int64(600), rows[1].AgeSeconds)
+
+	// cached lookups still age
+	rows, err = ds.freshness(context.Background(), req, now.Add(30*time.Second))
+	require.NoError(t, err)
+	assert.Equal(t, int64(120), rows[0].AgeSeconds)
+	assert.Len(t, client.calls.runQuery, 1)
+
+	_, err = ds.freshness(context.Background(), req, now.Add(time.Minute))
+	require.NoError(t, err)
+	assert.Len(t, client.calls.runQuery, 2)
+
+	_, err = ds.freshness(context.Background(), models.FreshnessRequest{Database: "db"}, now)
+	assert.Error(t, err)
+}
+
+func TestFreshness_Checked(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	client := &fakeClient{output: freshnessOutput()}
+	ds := &timestreamDS{Client: client}
+
+	_, err := ds.freshness(context.Background(), models.FreshnessRequest{Database: "db", Table: "metrics"}, now)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "measure_name")
+	assert.Empty(t, client.calls.runQuery)
+
+	_, err = ds.freshness(context.Background(), models.FreshnessRequest{Database: "db", Table: "metrics", Measure: "cpu", ValidatorProfile: "strict"}, now)
+	require.Error(t, err)
+	assert.Empty(t, client.calls.runQuery)
+
+	ds.budget = newQueryBudget(1)
+	_, err = ds.freshness(context.Background(), models.FreshnessRequest{Database: "db", Table: "metrics", Measure: "cpu"}, now)
+	require.NoError(t, err)
+	_, err = ds.freshness(context.Background(), models.FreshnessRequest{Database: "db", Table: "metrics", Measure: "mem"}, now)
+	assert.ErrorContains(t, err, "budget")
+	assert.Len(t, client.calls.runQuery, 1)
+}
+
+func TestCallResource_Freshness(t *testing.T) {
+	client := &fakeClient{output: freshnessOutput()}
+	ds := &timestreamDS{Client: client}
+	sender := &fakeSender{}
+	err := ds.CallResource(context.Background(), &backend.CallResourceRequest{
+		Path:   "freshness",
+		Method: "POST",
+		Body:   []byte(`{"database":"db","table":"metrics","measure":"cpu"}`),
+	}, sender)
+	require.NoError(t, err)
+	assert.Contains(t, *client.calls.runQuery[0].QueryString, "measure_name = 'cpu'")
+
+	var rows []models.Freshness
+	require.NoError(t, json.Unmarshal(sender.res.Body, &rows))
+	require.Len(t, rows, 2)
+	assert.Equal(t, "metrics", rows[0].Table)
+}
+
+func TestExecuteQuery_Freshness(t *testing.T) {
+	client := &fakeClient{output: freshnessOutput()}
+	ds := &timestreamDS{Client: client, Settings: models.DatasourceSettings{DefaultDatabase: "db", Validator: &validator.Options{AllowMissingMeasure: true}}}
+
+	dr := ds.ExecuteQuery(context.Background(), models.QueryModel{QueryType: models.QueryTypeFreshness, Table: "metrics"})
+	require.NoError(t, dr.Error)
+	require.Len(t, dr.Frames, 1)
+	assert.Equal(t, 2, dr.Frames[0].Rows())
+	assert.Contains(t, *client.calls.runQuery[0].QueryString, `FROM "db"."metrics"`)
+
+	client.output = &timestreamquery.QueryOutput{}
+	dr = ds.ExecuteQuery(context.Background(), models.QueryModel{QueryType: models.QueryTypeFreshness, Database: "db", Table: "idle"})
+	require.NoError(t, dr.Error)
+	require.Len(t, dr.Frames[0].Meta.Notices, 1)
+	assert.Contains(t, dr.Frames[0].Meta.Notices[0].Text, "no data")
+}
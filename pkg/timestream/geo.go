@@ -0,0 +1,141 @@
+package timestream
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/grafana/timestream-datasource/pkg/models"
+)
+
+// geoNames are the column names the Geomap panel finds locations by, the first
+// is used for the columns given a location role
+var geoNames = map[models.ColumnRole][]string{
+	models.ColumnRoleLatitude:  {"latitude", "lat"},
+	models.ColumnRoleLongitude: {"longitude", "lon", "lng", "long"},
+	models.ColumnRoleGeohash:   {"geohash"},
+}
+
+const geohashAlphabet = "0123456789bcdefghjkmnpqrstuvwxyz"
+
+// geoFields converts the location columns of the fields for the Geomap panel:
+// latitudes and longitudes to numbers, e.g. from varchar dimensions, and
+// geohashes to strings. Columns are found by their location role, or else by
+// name. Invalid locations are left empty and counted in a notice.
+func geoFields(fields []*data.Field, mappings []models.ColumnMapping) ([]*data.Field, []data.Notice) {
+	roles := map[string]models.ColumnRole{}
+	for _, mapping := range mappings {
+		if _, ok := geoNames[mapping.Role]; ok && !mapping.Hide {
+			roles[valueOrDefault(mapping.Rename, mapping.Name)] = mapping.Role
+		}
+	}
+
+	located := map[models.ColumnRole]*data.Field{}
+	for i, field := range fields {
+		role, ok := roles[field.Name]
+		if !ok {
+			role = geoRoleByName(field.Name)
+		}
+		if role == "" || located[role] != nil {
+			continue
+		}
+		fields[i] = geoField(field, role)
+		located[role] = fields[i]
+	}
+
+	lat, lon, hash := located[models.ColumnRoleLatitude], located[models.ColumnRoleLongitude], located[models.ColumnRoleGeohash]
+	if (lat == nil || lon == nil) && hash == nil {
+		return fields, []data.Notice{{
+			Severity: data.NoticeSeverityWarning,
+			Text:     "No locations found: the geo format expects latitude and longitude or geohash columns",
+		}}
+	}
+
+	set := func(field *data.Field, row int) bool {
+		if field == nil {
+			return false
+		}
+		_, ok := field.ConcreteAt(row)
+		return ok
+	}
+	missing := 0
+	for row := range fields[0].Len() {
+		if !(set(lat, row) && set(lon, row) || set(hash, row)) {
+			missing++
+		}
+	}
+	if missing == 0 {
+		return fields, nil
+	}
+	return fields, []data.Notice{{
+		Severity: data.NoticeSeverityWarning,
+		Text:     fmt.Sprintf("%d rows without a valid location are not shown on the map", missing),
+	}}
+}
+
+// geoRoleByName returns the location role of a column name, empty for other columns
+func geoRoleByName(name string) models.ColumnRole {
+	name = strings.ToLower(name)
+	for role, names := range geoNames {
+		for _, n := range names {
+			if name == n {
+				return role
+			}
+		}
+	}
+	return ""
+}
+
+// geoField converts the values of a location column, named so the Geomap panel
+// finds it
+func geoField(field *data.Field, role models.ColumnRole) *data.Field {
+	target, valueRole := data.FieldTypeNullableFloat64, models.ColumnRoleValue
+	if role == models.ColumnRoleGeohash {
+		target, valueRole = data.FieldTypeNullableString, models.ColumnRoleLabel
+	}
+	out := data.NewFieldFromFieldType(target, field.Len())
+	out.Name = field.Name
+	if geoRoleByName(field.Name) != role {
+		out.Name = geoNames[role][0]
+	}
+	out.Labels = field.Labels
+	out.Config = field.Config
+	for i := range field.Len() {
+		v, ok := field.ConcreteAt(i)
+		if !ok {
+			continue
+		}
+		converted, err := convertValue(v, valueRole)
+		if hash, ok := converted.(*string); ok {
+			lower := strings.ToLower(*hash)
+			converted = &lower
+		}
+		if err != nil || !validLocation(converted, role) {
+			continue
+		}
+		out.Set(i, converted)
+	}
+	return out
+}
+
+// validLocation checks the range of coordinates and the alphabet of geohashes
+func validLocation(v interface{}, role models.ColumnRole) bool {
+	switch role {
+	case models.ColumnRoleLatitude:
+		f := *v.(*float64)
+		return f >= -90 && f <= 90
+	case models.ColumnRoleLongitude:
+		f := *v.(*float64)
+		return f >= -180 && f <= 180
+	}
+	hash := *v.(*string)
+	if hash == "" {
+		return false
+	}
+	for _, c := range hash {
+		if !strings.ContainsRune(geohashAlphabet, c) {
+			return false
+		}
+	}
+	return true
+}
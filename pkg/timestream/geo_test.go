@@ -0,0 +1,85 @@
+package timestream
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/timestreamquery"
+	timestreamquerytypes "github.com/aws/aws-sdk-go-v2/service/timestreamquery/types"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/grafana/timestream-datasource/pkg/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGeoFields(t *testing.T) {
+	fields := []*data.Field{
+		data.NewField("asset", nil, []string{"a1", "a2", "a3"}),
+		data.NewField("Lat", nil, []*string{strPtr("52.52"), strPtr("91"), strPtr("48.1")}),
+		data.NewField("lng", nil, []*string{strPtr("13.40"), strPtr("0"), strPtr("east")}),
+	}
+
+	out, notices := geoFields(fields, nil)
+	require.Len(t, out, 3)
+	assert.Equal(t, "Lat", out[1].Name)
+	assert.Equal(t, data.FieldTypeNullableFloat64, out[1].Type())
+	assert.Equal(t, 52.52, *out[1].At(0).(*float64))
+	assert.Equal(t, 13.40, *out[2].At(0).(*float64))
+	// out of range and unparseable coordinates are empty
+	assert.Nil(t, out[1].At(1))
+	assert.Nil(t, out[2].At(2))
+	require.Len(t, notices, 1)
+	assert.Equal(t, "2 rows without a valid location are not shown on the map", notices[0].Text)
+}
+
+func TestGeoFields_Roles(t *testing.T) {
+	fields := []*data.Field{
+		data.NewField("site", nil, []string{"u33DC0", "u33d!"}),
+		data.NewField("pos_y", nil, []float64{52.52, 0}),
+	}
+	mappings := []models.ColumnMapping{
+		{Name: "site", Role: models.ColumnRoleGeohash},
+		{Name: "y", Rename: "pos_y", Role: models.ColumnRoleLatitude},
+	}
+
+	out, notices := geoFields(fields, mappings)
+	assert.Equal(t, "geohash", out[0].Name)
+	assert.Equal(t, "u33dc0", *out[0].At(0).(*string))
+	assert.Nil(t, out[0].At(1))
+	// a latitude without a longitude is no location
+	assert.Equal(t, "latitude", out[1].Name)
+	require.Len(t, notices, 1)
+	assert.Equal(t, "1 rows without a valid location are not shown on the map", notices[0].Text)
+
+	_, notices = geoFields([]*data.Field{data.NewField("asset", nil, []string{"a1"})}, nil)
+	require.Len(t, notices, 1)
+	assert.Contains(t, notices[0].Text, "No locations found")
+}
+
+func TestExecuteQuery_Geo(t *testing.T) {
+	varchar := &timestreamquerytypes.Type{ScalarType: timestreamquerytypes.ScalarTypeVarchar}
+	input := &timestreamquery.QueryOutput{
+		ColumnInfo: []timestreamquerytypes.ColumnInfo{
+			{Name: aws.String("asset"), Type: varchar},
+			{Name: aws.String("latitude"), Type: varchar},
+			{Name: aws.String("longitude"), Type: varchar},
+		},
+		Rows: []timestreamquerytypes.Row{{Data: []timestreamquerytypes.Datum{
+			{ScalarValue: aws.String("a1")}, {ScalarValue: aws.String("52.52")}, {ScalarValue: aws.String("13.40")},
+		}}},
+	}
+
+	ds := &timestreamDS{Client: &tableClient{outputs: map[string]*timestreamquery.QueryOutput{"latitude": input}}}
+	res := ds.ExecuteQuery(context.Background(), models.QueryModel{
+		Format:   models.FormatOptionGeo,
+		RawQuery: `SELECT asset, latitude, longitude FROM db.assets WHERE time > ago(1h) AND measure_name = 'position'`,
+	})
+	require.NoError(t, res.Error)
+	require.Len(t, res.Frames, 1)
+	frame := res.Frames[0]
+	assert.Equal(t, data.FieldTypeNullableFloat64, frame.Fields[1].Type())
+	assert.Equal(t, 52.52, *frame.Fields[1].At(0).(*float64))
+	assert.Equal(t, 13.40, *frame.Fields[2].At(0).(*float64))
+	assert.Empty(t, frame.Meta.Notices)
+}
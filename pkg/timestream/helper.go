@@ -2,9 +2,11 @@ package timestream
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"time"
 
+	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/timestreamquery"
 	"github.com/grafana/grafana-plugin-sdk-go/backend"
 	"github.com/grafana/grafana-plugin-sdk-go/data"
@@ -13,14 +15,25 @@ import (
 )
 
 // QueryResultToDataFrame creates a DataFrame from query results
-func QueryResultToDataFrame(res *timestreamquery.QueryOutput, format models.FormatQueryOption) backend.DataResponse {
+func QueryResultToDataFrame(res *timestreamquery.QueryOutput, query models.QueryModel) backend.DataResponse {
 	dr := backend.DataResponse{}
 	notices := []data.Notice{}
+	if reachedMaxRows(res, query.MaxRows) && int64(len(res.Rows)) > query.MaxRows {
+		truncated := *res
+		truncated.Rows = res.Rows[:query.MaxRows]
+		res = &truncated
+		notices = append(notices, data.Notice{
+			Severity: data.NoticeSeverityWarning,
+			Text:     fmt.Sprintf("Results truncated to %d rows", query.MaxRows),
+		})
+	}
 	builders := []*fieldBuilder{}
 	timeseriesColumns := []*fieldBuilder{}
 	cellParsingError := false
 	length := len(res.Rows)
 	hasTimeseries := false
+	// states of varchar measures without a number in the state mappings
+	var unmapped []string
 
 	// Inspect the column structure
 	for index, columnMeta := range res.ColumnInfo {
@@ -74,6 +87,14 @@ func QueryResultToDataFrame(res *timestreamquery.QueryOutput, format models.Form
 					vf.Set(i, v)
 				}
 
+				// the measure of varchar series is their measure_name label or the column
+				if mapped, missing := mapStates(vf, query.StateMappings, func(int) string {
+					return valueOrDefault(vf.Labels["measure_name"], vf.Name)
+				}); mapped != nil {
+					vf = mapped
+					unmapped = append(unmapped, missing...)
+				}
+
 				// Add the series as a frame
 				dr.Frames = append(dr.Frames, data.NewFrame("", tf, vf))
 			}
@@ -113,22 +134,40 @@ func QueryResultToDataFrame(res *timestreamquery.QueryOutput, format models.Form
 			fields = append(fields, field)
 		}
 
+		fields, unmapped = applyStateMappings(fields, query.StateMappings)
+		fields, err := applyColumnMappings(fields, query.Columns)
+		if err != nil {
+			return errorsource.Response(errorsource.DownstreamError(err, false))
+		}
 		frame := data.NewFrame("", fields...)
 
-		if length > 0 && format == models.FormatOptionTimeSeries {
+		if length > 0 && (query.Format == models.FormatOptionTimeSeries || query.Format == models.FormatOptionStateTimeline) {
 			if frame.TimeSeriesSchema().Type == data.TimeSeriesTypeLong {
 				var err error
-				frame, err = data.LongToWide(frame, &data.FillMissing{
-					Mode: data.FillModeNull,
-				})
+				frame, err = data.LongToWide(frame, fillMissing(query))
 				if err != nil {
 					return errorsource.Response(errorsource.PluginError(fmt.Errorf("error formatting as timeseries: %s", err), false))
 				}
 			}
 		}
+		if query.Format == models.FormatOptionGeo {
+			var geoNotices []data.Notice
+			frame.Fields, geoNotices = geoFields(frame.Fields, query.Columns)
+			notices = append(notices, geoNotices...)
+		}
+		if query.DictionaryEncode && query.Format == models.FormatOptionTable {
+			frame.Fields = dictionaryEncodeFields(frame.Fields, dictionaryMinRows, dictionaryMaxCardinality)
+		}
+		if query.Format == models.FormatOptionLogs {
+			frame.SetMeta(&data.FrameMeta{PreferredVisualization: data.VisTypeLogs})
+		}
 		dr.Frames = append(dr.Frames, frame)
 	}
 
+	if len(unmapped) > 0 {
+		notices = append(notices, unmappedStatesNotice(unmapped))
+	}
+
 	meta := &models.TimestreamCustomMeta{
 		HasSeries: hasTimeseries,
 	}
@@ -138,6 +177,9 @@ func QueryResultToDataFrame(res *timestreamquery.QueryOutput, format models.Form
 	if res.NextToken != nil {
 		meta.NextToken = *res.NextToken
 	}
+	for _, column := range res.ColumnInfo {
+		meta.Columns = append(meta.Columns, models.ColumnMeta{Name: aws.ToString(column.Name), Type: columnTypeName(column.Type)})
+	}
 
 	// At least one empty result
 	if len(dr.Frames) == 0 {
@@ -154,3 +196,73 @@ func QueryResultToDataFrame(res *timestreamquery.QueryOutput, format models.Form
 	dr.Frames[0].Meta.Custom = meta
 	return dr
 }
+
+// wholeResult reports whether the query is post-processed over all of its rows,
+// which then have to arrive in a single response: per page, a series empty on
+// one page would be dropped from it only, filling with the previous value
+// would restart on every page, the largest series would be those of a page
+// and state ranges would end at page boundaries.
+func wholeResult(query models.QueryModel) bool {
+	return query.Nulls != nil || query.FillMode == models.FillModePrevious ||
+		(query.SeriesLimit != nil && query.Format == models.FormatOptionTimeSeries) ||
+		query.Format == models.FormatOptionStateTimeline
+}
+
+// finishFrames applies the steps of the query that need all of its rows, once
+// the pages and sub-queries of the query are merged. The metadata of the first
+// frame stays with the first frame.
+func finishFrames(dr backend.DataResponse, query models.QueryModel) backend.DataResponse {
+	if dr.Error != nil || len(dr.Frames) == 0 {
+		return dr
+	}
+	first := dr.Frames[0]
+	frames, err := applyNullHandling(dr.Frames, query.Nulls)
+	if errors.Is(err, errNoData) {
+		return errorsource.Response(errorsource.DownstreamError(err, false))
+	}
+	if err != nil {
+		// the options of the query don't fit its results
+		return errorsource.Response(errorsource.PluginError(err, false))
+	}
+	var notice *data.Notice
+	if query.SeriesLimit != nil && query.Format == models.FormatOptionTimeSeries {
+		frames, notice = limitSeries(frames, *query.SeriesLimit)
+	}
+	if query.Format == models.FormatOptionStateTimeline {
+		frames = stateTimelineFrames(frames)
+	}
+	if len(frames) == 0 {
+		frames = data.Frames{data.NewFrame("")}
+	}
+	if meta := first.Meta; frames[0] != first && meta != nil {
+		first.Meta = &data.FrameMeta{ExecutedQueryString: meta.ExecutedQueryString}
+		frames[0].Meta = meta
+	}
+	// every series frame carries the query, also new ones
+	for _, frame := range frames {
+		if frame.Meta == nil && first.Meta != nil {
+			frame.SetMeta(&data.FrameMeta{ExecutedQueryString: first.Meta.ExecutedQueryString})
+		}
+	}
+	if notice != nil {
+		frames[0].AppendNotices(*notice)
+	}
+	dr.Frames = frames
+	return dr
+}
+
+// fillMissing converts the fill mode of the query, defaulting to null
+func fillMissing(query models.QueryModel) *data.FillMissing {
+	switch query.FillMode {
+	case models.FillModePrevious:
+		return &data.FillMissing{Mode: data.FillModePrevious}
+	case models.FillModeValue:
+		return &data.FillMissing{Mode: data.FillModeValue, Value: query.FillValue}
+	}
+	return &data.FillMissing{Mode: data.FillModeNull}
+}
+
+// reachedMaxRows reports whether the results hold at least maxRows rows, zero means no limit
+func reachedMaxRows(res *timestreamquery.QueryOutput, maxRows int64) bool {
+	return maxRows > 0 && int64(len(res.Rows)) >= maxRows
+}
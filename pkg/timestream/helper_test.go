@@ -6,6 +6,7 @@ import (
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/timestreamquery"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
 	"github.com/grafana/timestream-datasource/pkg/models"
 	"github.com/stretchr/testify/assert"
 )
@@ -75,7 +76,7 @@ func TestQueryResultToDataFrame(t *testing.T) {
 	}
 
 	t.Run("table format", func(t *testing.T) {
-		res := QueryResultToDataFrame(input, models.FormatOptionTable)
+		res := QueryResultToDataFrame(input, models.QueryModel{Format: models.FormatOptionTable})
 
 		// Assert that it returns one frame with four fields
 		assert.Equal(t, 1, len(res.Frames))
@@ -87,7 +88,7 @@ func TestQueryResultToDataFrame(t *testing.T) {
 	})
 
 	t.Run("timeseries format", func(t *testing.T) {
-		res := QueryResultToDataFrame(input, models.FormatOptionTimeSeries)
+		res := QueryResultToDataFrame(input, models.QueryModel{Format: models.FormatOptionTimeSeries})
 		// Assert that it returns one frame with three fields
 		assert.Equal(t, 1, len(res.Frames))
 		assert.Equal(t, 3, len(res.Frames[0].Fields))
@@ -104,14 +105,52 @@ func TestQueryResultToDataFrame(t *testing.T) {
 		assert.Equal(t, "instance-1.amazonaws.com", res.Frames[0].Fields[2].Labels["instance_name"])
 		assert.Equal(t, "zeus", res.Frames[0].Fields[2].Labels["microservice_name"])
 	})
+	t.Run("max rows", func(t *testing.T) {
+		res := QueryResultToDataFrame(input, models.QueryModel{Format: models.FormatOptionTable, MaxRows: 3})
+		assert.Equal(t, 3, res.Frames[0].Rows())
+		assert.Equal(t, 4, len(input.Rows))
+		assert.Equal(t, "Results truncated to 3 rows", res.Frames[0].Meta.Notices[0].Text)
+	})
+	t.Run("column meta", func(t *testing.T) {
+		res := QueryResultToDataFrame(input, models.QueryModel{Format: models.FormatOptionTimeSeries})
+		meta := res.Frames[0].Meta.Custom.(*models.TimestreamCustomMeta)
+		assert.Equal(t, []models.ColumnMeta{
+			{Name: "time", Type: "TIMESTAMP"},
+			{Name: "instance_name", Type: "VARCHAR"},
+			{Name: "microservice_name", Type: "VARCHAR"},
+			{Name: "value", Type: "DOUBLE"},
+		}, meta.Columns)
+	})
+	t.Run("fill mode", func(t *testing.T) {
+		assert.Equal(t, data.FillModeNull, fillMissing(models.QueryModel{}).Mode)
+		assert.Equal(t, data.FillModePrevious, fillMissing(models.QueryModel{FillMode: models.FillModePrevious}).Mode)
+		fill := fillMissing(models.QueryModel{FillMode: models.FillModeValue, FillValue: 2})
+		assert.Equal(t, data.FillModeValue, fill.Mode)
+		assert.Equal(t, 2.0, fill.Value)
+	})
 	t.Run("timeseries format with no rows", func(t *testing.T) {
 		input.Rows = []timestreamquerytypes.Row{}
 		inputWithNoRows := input
 		inputWithNoRows.Rows = []timestreamquerytypes.Row{}
-		res := QueryResultToDataFrame(inputWithNoRows, models.FormatOptionTimeSeries)
+		res := QueryResultToDataFrame(inputWithNoRows, models.QueryModel{Format: models.FormatOptionTimeSeries})
 		// Assert that it returns one frame with no fields
 		assert.Equal(t, 1, len(res.Frames))
 		assert.Equal(t, 4, len(res.Frames[0].Fields))
 		assert.Equal(t, 0, res.Frames[0].Fields[0].Len())
 	})
 }
+
+func TestColumnTypeName(t *testing.T) {
+	double := &timestreamquerytypes.Type{ScalarType: timestreamquerytypes.ScalarTypeDouble}
+	assert.Equal(t, "DOUBLE", columnTypeName(double))
+	assert.Equal(t, "TIMESERIES(DOUBLE)", columnTypeName(&timestreamquerytypes.Type{
+		TimeSeriesMeasureValueColumnInfo: &timestreamquerytypes.ColumnInfo{Type: double},
+	}))
+	assert.Equal(t, "ARRAY(ROW(host VARCHAR, cpu DOUBLE))", columnTypeName(&timestreamquerytypes.Type{
+		ArrayColumnInfo: &timestreamquerytypes.ColumnInfo{Type: &timestreamquerytypes.Type{RowColumnInfo: []timestreamquerytypes.ColumnInfo{
+			{Name: aws.String("host"), Type: &timestreamquerytypes.Type{ScalarType: timestreamquerytypes.ScalarTypeVarchar}},
+			{Name: aws.String("cpu"), Type: double},
+		}}},
+	}))
+	assert.Equal(t, "", columnTypeName(nil))
+}
@@ -0,0 +1,17 @@
+package timestream
+
+import (
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+)
+
+// shiftForIngestionDelay moves a time range ending within the delay before now back
+// by the delay, so it ends before the data that may still be ingested. Ranges ending
+// earlier, like those of past incidents, are kept.
+func shiftForIngestionDelay(tr backend.TimeRange, delay time.Duration, now time.Time) backend.TimeRange {
+	if delay <= 0 || tr.To.Before(now.Add(-delay)) {
+		return tr
+	}
+	return backend.TimeRange{From: tr.From.Add(-delay), To: tr.To.Add(-delay)}
+}
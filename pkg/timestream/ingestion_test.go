@@ -0,0 +1,43 @@
+package timestream
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/timestreamquery"
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/timestream-datasource/pkg/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestShiftForIngestionDelay(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	lastHour := backend.TimeRange{From: now.Add(-time.Hour), To: now}
+
+	shifted := shiftForIngestionDelay(lastHour, 5*time.Minute, now)
+	assert.Equal(t, now.Add(-65*time.Minute), shifted.From)
+	assert.Equal(t, now.Add(-5*time.Minute), shifted.To)
+
+	assert.Equal(t, lastHour, shiftForIngestionDelay(lastHour, 0, now), "disabled")
+
+	past := backend.TimeRange{From: now.Add(-2 * time.Hour), To: now.Add(-time.Hour)}
+	assert.Equal(t, past, shiftForIngestionDelay(past, 5*time.Minute, now), "absolute range in the past")
+}
+
+func TestQueryData_IngestionDelay(t *testing.T) {
+	client := &fakeClient{output: &timestreamquery.QueryOutput{}}
+	ds := &timestreamDS{Client: client, Settings: models.DatasourceSettings{IngestionDelaySeconds: 300}}
+	now := time.Now()
+
+	_, err := ds.QueryData(context.Background(), &backend.QueryDataRequest{Queries: []backend.DataQuery{{
+		RefID:     "A",
+		JSON:      []byte(`{"rawQuery":"SELECT $__timeTo FROM db.tbl WHERE $__timeFilter AND measure_name = 'cpu'"}`),
+		TimeRange: backend.TimeRange{From: now.Add(-time.Hour), To: now},
+	}}})
+	require.NoError(t, err)
+	require.Len(t, client.calls.runQuery, 1)
+	assert.Contains(t, *client.calls.runQuery[0].QueryString, fmt.Sprintf("SELECT %d ", now.Add(-5*time.Minute).UnixMilli()))
+}
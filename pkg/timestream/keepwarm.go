@@ -0,0 +1,80 @@
+package timestream
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/backend/gtime"
+	"github.com/grafana/timestream-datasource/pkg/models"
+)
+
+// keepWarmQuery is a keep-warm entry with its range parsed
+type keepWarmQuery struct {
+	query         json.RawMessage
+	span          time.Duration
+	interval      time.Duration
+	maxDataPoints int64
+}
+
+func parseKeepWarm(entries []models.KeepWarmQuery, cache *frameCache) ([]keepWarmQuery, error) {
+	if len(entries) > 0 && cache == nil {
+		return nil, fmt.Errorf("keepWarm requires the result cache, set resultCacheSeconds")
+	}
+	queries := make([]keepWarmQuery, 0, len(entries))
+	for i, entry := range entries {
+		span, err := gtime.ParseDuration(entry.Range)
+		if err != nil || span <= 0 {
+			return nil, fmt.Errorf("keepWarm[%d]: invalid range %q", i, entry.Range)
+		}
+		if _, err := models.GetQueryModel(backend.DataQuery{JSON: entry.Query}); err != nil {
+			return nil, fmt.Errorf("keepWarm[%d]: %w", i, err)
+		}
+		queries = append(queries, keepWarmQuery{
+			query:         entry.Query,
+			span:          span,
+			interval:      time.Duration(entry.IntervalMs) * time.Millisecond,
+			maxDataPoints: entry.MaxDataPoints,
+		})
+	}
+	return queries, nil
+}
+
+// refreshKeepWarm runs the keep-warm queries whose cached response is past half
+// its TTL, for the range ending now. They run without a user, so they may only
+// select validator profiles open to every role. Refreshes spend the query budget,
+// once it is spent the entries are refreshed on a later tick.
+func (ds *timestreamDS) refreshKeepWarm(ctx context.Context, entries []keepWarmQuery, now time.Time) {
+	var stale []models.QueryModel
+	for _, entry := range entries {
+		query, err := ds.queryModel(backend.DataQuery{
+			JSON:          entry.query,
+			TimeRange:     backend.TimeRange{From: now.Add(-entry.span), To: now},
+			Interval:      entry.interval,
+			MaxDataPoints: entry.maxDataPoints,
+		}, now)
+		if err == nil && ds.frames.stale(*query, now) {
+			stale = append(stale, *query)
+		}
+	}
+	ds.prefetch(ctx, backend.PluginContext{}, stale)
+}
+
+// keepWarm refreshes the entries until ctx is canceled, which also cancels a
+// running refresh. It checks four times per TTL, so entries are refreshed before
+// their cached response expires.
+func (ds *timestreamDS) keepWarm(ctx context.Context, entries []keepWarmQuery) {
+	ticker := time.NewTicker(max(ds.frames.ttl/4, time.Second))
+	defer ticker.Stop()
+	ds.refreshKeepWarm(ctx, entries, time.Now())
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			ds.refreshKeepWarm(ctx, entries, time.Now())
+		}
+	}
+}
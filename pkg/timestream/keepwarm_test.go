@@ -0,0 +1,92 @@
+package timestream
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/timestreamquery"
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/timestream-datasource/pkg/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseKeepWarm(t *testing.T) {
+	cache := newFrameCache(time.Minute)
+	entries, err := parseKeepWarm([]models.KeepWarmQuery{{Query: []byte(`{"rawQuery":"SELECT 1"}`), Range: "6h", IntervalMs: 60000}}, cache)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, 6*time.Hour, entries[0].span)
+	assert.Equal(t, time.Minute, entries[0].interval)
+
+	for _, entry := range []models.KeepWarmQuery{
+		{Query: []byte(`{"rawQuery":"SELECT 1"}`), Range: "soon"},
+		{Query: []byte(`{"rawQuery":"SELECT 1"}`)},
+		{Query: []byte(`[]`), Range: "1h"},
+	} {
+		_, err := parseKeepWarm([]models.KeepWarmQuery{entry}, cache)
+		assert.Error(t, err, string(entry.Query))
+	}
+	_, err = parseKeepWarm([]models.KeepWarmQuery{{Query: []byte(`{}`), Range: "1h"}}, nil)
+	assert.ErrorContains(t, err, "resultCacheSeconds")
+}
+
+func TestRefreshKeepWarm(t *testing.T) {
+	client := &fakeClient{output: &timestreamquery.QueryOutput{}}
+	ds := &timestreamDS{Client: client, frames: newFrameCache(time.Minute)}
+	raw := []byte(`{"rawQuery":"SELECT * FROM db.tbl WHERE $__timeFilter AND measure_name = 'cpu'"}`)
+	entries, err := parseKeepWarm([]models.KeepWarmQuery{{Query: raw, Range: "1h", IntervalMs: 1000, MaxDataPoints: 100}}, ds.frames)
+	require.NoError(t, err)
+
+	now := time.Now()
+	ds.refreshKeepWarm(context.Background(), entries, now)
+	ds.refreshKeepWarm(context.Background(), entries, now.Add(10*time.Second))
+	assert.Len(t, client.calls.runQuery, 1, "fresh entries are not refreshed")
+
+	// the wallboard panel renders from the cache
+	_, err = ds.QueryData(context.Background(), &backend.QueryDataRequest{Queries: []backend.DataQuery{{
+		RefID:         "A",
+		JSON:          raw,
+		TimeRange:     backend.TimeRange{From: now.Add(-time.Hour), To: now},
+		Interval:      time.Second,
+		MaxDataPoints: 100,
+	}}})
+	require.NoError(t, err)
+	assert.Len(t, client.calls.runQuery, 1)
+}
+
+func TestRefreshKeepWarm_Budget(t *testing.T) {
+	client := &fakeClient{output: &timestreamquery.QueryOutput{}}
+	ds := &timestreamDS{Client: client, frames: newFrameCache(time.Minute), budget: newQueryBudget(1)}
+	entries, err := parseKeepWarm([]models.KeepWarmQuery{
+		{Query: []byte(`{"rawQuery":"SELECT * FROM db.tbl WHERE $__timeFilter AND measure_name = 'cpu'"}`), Range: "1h"},
+		{Query: []byte(`{"rawQuery":"SELECT * FROM db.tbl WHERE $__timeFilter AND measure_name = 'mem'"}`), Range: "1h"},
+	}, ds.frames)
+	require.NoError(t, err)
+
+	ds.refreshKeepWarm(context.Background(), entries, time.Now())
+	assert.Len(t, client.calls.runQuery, 1, "the budget holds a single query")
+	assert.False(t, ds.budget.take(time.Now()))
+}
+
+func TestKeepWarm_Stop(t *testing.T) {
+	client := &fakeClient{output: &timestreamquery.QueryOutput{}}
+	ds := &timestreamDS{Client: client, frames: newFrameCache(time.Minute)}
+	entries, err := parseKeepWarm([]models.KeepWarmQuery{{Query: []byte(`{"rawQuery":"SELECT 1"}`), Range: "1h"}}, ds.frames)
+	require.NoError(t, err)
+
+	var ctx context.Context
+	ctx, ds.stopKeepWarm = context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		ds.keepWarm(ctx, entries)
+		close(done)
+	}()
+	ds.Dispose()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("keepWarm didn't stop")
+	}
+}
@@ -0,0 +1,147 @@
+package timestream
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Bounds of the in-memory latency history
+const (
+	latencySamples      = 50
+	latencyFingerprints = 1000
+	// samples required before a query counts as consistently slow
+	latencyMinSamples = 5
+	slowQueriesListed = 20
+)
+
+// SlowQuery summarizes the recent latencies of a query
+type SlowQuery struct {
+	Fingerprint string    `json:"fingerprint"`
+	Query       string    `json:"query"`
+	Samples     int       `json:"samples"`
+	P50Ms       int64     `json:"p50Ms"`
+	P90Ms       int64     `json:"p90Ms"`
+	P99Ms       int64     `json:"p99Ms"`
+	MaxMs       int64     `json:"maxMs"`
+	LastSeen    time.Time `json:"lastSeen"`
+}
+
+type latencyEntry struct {
+	query    string
+	samples  []time.Duration
+	next     int
+	lastSeen time.Time
+}
+
+// latencyTracker keeps the last latencies per query fingerprint. A nil tracker
+// records nothing.
+type latencyTracker struct {
+	slo time.Duration
+
+	mu      sync.Mutex
+	entries map[string]*latencyEntry
+}
+
+func newLatencyTracker(slo time.Duration) *latencyTracker {
+	return &latencyTracker{slo: slo, entries: map[string]*latencyEntry{}}
+}
+
+// observe records a latency; query is the scrubbed SQL shown by the slow-queries resource
+func (l *latencyTracker) observe(fingerprint, query string, latency time.Duration, now time.Time) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	e, ok := l.entries[fingerprint]
+	if !ok {
+		if len(l.entries) >= latencyFingerprints {
+			l.evictOldest()
+		}
+		e = &latencyEntry{}
+		l.entries[fingerprint] = e
+	}
+	e.query = query
+	e.lastSeen = now
+	if len(e.samples) < latencySamples {
+		e.samples = append(e.samples, latency)
+		return
+	}
+	e.samples[e.next] = latency
+	e.next = (e.next + 1) % latencySamples
+}
+
+func (l *latencyTracker) evictOldest() {
+	oldest := ""
+	for fingerprint, e := range l.entries {
+		if oldest == "" || e.lastSeen.Before(l.entries[oldest].lastSeen) {
+			oldest = fingerprint
+		}
+	}
+	delete(l.entries, oldest)
+}
+
+// sloNotice returns the notice text when the median latency of the query exceeds the SLO
+func (l *latencyTracker) sloNotice(fingerprint string) (string, bool) {
+	if l == nil || l.slo <= 0 {
+		return "", false
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	e, ok := l.entries[fingerprint]
+	if !ok || len(e.samples) < latencyMinSamples {
+		return "", false
+	}
+	if percentile(e.samples, 0.5) <= l.slo {
+		return "", false
+	}
+	return fmt.Sprintf("this query is consistently > %s; consider a rollup", l.slo), true
+}
+
+// worst lists the queries with the highest p90 latency
+func (l *latencyTracker) worst(n int) []SlowQuery {
+	if l == nil {
+		return []SlowQuery{}
+	}
+	l.mu.Lock()
+	out := make([]SlowQuery, 0, len(l.entries))
+	for fingerprint, e := range l.entries {
+		out = append(out, SlowQuery{
+			Fingerprint: fingerprint,
+			Query:       e.query,
+			Samples:     len(e.samples),
+			P50Ms:       percentile(e.samples, 0.5).Milliseconds(),
+			P90Ms:       percentile(e.samples, 0.9).Milliseconds(),
+			P99Ms:       percentile(e.samples, 0.99).Milliseconds(),
+			MaxMs:       percentile(e.samples, 1).Milliseconds(),
+			LastSeen:    e.lastSeen,
+		})
+	}
+	l.mu.Unlock()
+
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].P90Ms != out[j].P90Ms {
+			return out[i].P90Ms > out[j].P90Ms
+		}
+		return out[i].Fingerprint < out[j].Fingerprint
+	})
+	if len(out) > n {
+		out = out[:n]
+	}
+	return out
+}
+
+// percentile returns the nearest-rank percentile p (0-1] of the samples
+func percentile(samples []time.Duration, p float64) time.Duration {
+	if len(samples) == 0 {
+		return 0
+	}
+	sorted := append([]time.Duration(nil), samples...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	idx := int(math.Ceil(p*float64(len(sorted)))) - 1
+	idx = max(0, min(idx, len(sorted)-1))
+	return sorted[idx]
+}
@@ -0,0 +1,76 @@
+package timestream
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPercentile(t *testing.T) {
+	samples := []time.Duration{5, 1, 4, 2, 3}
+	assert.Equal(t, time.Duration(3), percentile(samples, 0.5))
+	assert.Equal(t, time.Duration(5), percentile(samples, 0.9))
+	assert.Equal(t, time.Duration(5), percentile(samples, 1))
+	assert.Equal(t, time.Duration(0), percentile(nil, 0.5))
+}
+
+func TestLatencyTracker(t *testing.T) {
+	tracker := newLatencyTracker(10 * time.Second)
+	now := time.Now()
+
+	for i := 0; i < latencyMinSamples-1; i++ {
+		tracker.observe("slow", "SELECT slow", 20*time.Second, now)
+		tracker.observe("fast", "SELECT fast", time.Second, now)
+	}
+	_, slow := tracker.sloNotice("slow")
+	assert.False(t, slow, "too few samples")
+
+	tracker.observe("slow", "SELECT slow", 20*time.Second, now)
+	text, slow := tracker.sloNotice("slow")
+	assert.True(t, slow)
+	assert.Equal(t, "this query is consistently > 10s; consider a rollup", text)
+
+	worst := tracker.worst(1)
+	require.Len(t, worst, 1)
+	assert.Equal(t, "SELECT slow", worst[0].Query)
+	assert.Equal(t, int64(20000), worst[0].P90Ms)
+
+	// the history is bounded
+	for i := 0; i < 2*latencySamples; i++ {
+		tracker.observe("fast", "SELECT fast", time.Second, now)
+	}
+	assert.Len(t, tracker.entries["fast"].samples, latencySamples)
+	for i := 0; i < latencyFingerprints; i++ {
+		tracker.observe(fmt.Sprint(i), "", time.Second, now.Add(time.Second))
+	}
+	assert.Len(t, tracker.entries, latencyFingerprints)
+}
+
+func TestLatencyTracker_Nil(t *testing.T) {
+	var tracker *latencyTracker
+	tracker.observe("a", "", time.Second, time.Now())
+	_, slow := tracker.sloNotice("a")
+	assert.False(t, slow)
+	assert.Empty(t, tracker.worst(10))
+}
+
+func TestCallResource_SlowQueries(t *testing.T) {
+	ds := &timestreamDS{latency: newLatencyTracker(0)}
+	ds.latency.observe("a", "SELECT a", time.Second, time.Now())
+	sender := &fakeSender{}
+	err := ds.CallResource(context.Background(), &backend.CallResourceRequest{Path: "slow-queries", PluginContext: backend.PluginContext{User: &backend.User{Role: "Viewer"}}}, sender)
+	require.ErrorContains(t, err, "requires the Admin role")
+	err = ds.CallResource(context.Background(), &backend.CallResourceRequest{Path: "slow-queries", PluginContext: backend.PluginContext{User: &backend.User{Role: "Admin"}}}, sender)
+	require.NoError(t, err)
+
+	queries := []SlowQuery{}
+	require.NoError(t, json.Unmarshal(sender.res.Body, &queries))
+	require.Len(t, queries, 1)
+	assert.Equal(t, int64(1000), queries[0].P50Ms)
+}
@@ -0,0 +1,119 @@
+package timestream
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/experimental/errorsource"
+	"github.com/grafana/timestream-datasource/pkg/models"
+	"github.com/grafana/timestream-datasource/pkg/timestream/validator"
+)
+
+const (
+	// Log context queries only scan this far before or after the row
+	logContextWindow = time.Hour
+	// Rows of a log context without a limit, and the most returned
+	defaultLogContextRows = 100
+	maxLogContextRows     = 1000
+)
+
+// logContextSQL selects the rows written before or after the row of the log
+// context within the window, with the same values of the columns
+func logContextSQL(database, table string, lc models.LogContext, columns []string) string {
+	at := fmt.Sprintf("from_milliseconds(%d)", lc.Time)
+	window := fmt.Sprintf("%dh", int(logContextWindow.Hours()))
+	predicates := []string{fmt.Sprintf("time < %s", at), fmt.Sprintf("time >= %s - %s", at, window)}
+	order := "DESC"
+	if lc.Direction == models.LogContextForward {
+		predicates = []string{fmt.Sprintf("time > %s", at), fmt.Sprintf("time <= %s + %s", at, window)}
+		order = "ASC"
+	}
+	for _, column := range columns {
+		// the checks of the query only recognize measure_name unquoted
+		name := quoteIdentifier(column)
+		if column == "measure_name" {
+			name = column
+		}
+		predicates = append(predicates, name+" = "+quoteLiteral(lc.Values[column]))
+	}
+
+	limit := lc.Limit
+	if limit <= 0 {
+		limit = defaultLogContextRows
+	}
+	limit = min(limit, maxLogContextRows)
+	return fmt.Sprintf("SELECT * FROM %s.%s WHERE %s ORDER BY time %s LIMIT %d",
+		quoteIdentifier(database), quoteIdentifier(table), strings.Join(predicates, " AND "), order, limit)
+}
+
+// logContextColumns returns the columns of the row identifying its source, the
+// dimensions and measure_name the table lists, ordered by name. Measure values
+// like the log line itself differ between the rows of a context.
+func (ds *timestreamDS) logContextColumns(ctx context.Context, database, table string, values map[string]string) ([]string, error) {
+	v, err := ds.schemaQuery(ctx, fmt.Sprintf("DESCRIBE %s.%s", applyQuotesIfNeeded(database), applyQuotesIfNeeded(table)))
+	if err != nil {
+		return nil, err
+	}
+	var columns []string
+	for _, row := range v.Rows {
+		if len(row.Data) < 3 || row.Data[0].ScalarValue == nil || row.Data[2].ScalarValue == nil {
+			continue
+		}
+		name, kind := *row.Data[0].ScalarValue, *row.Data[2].ScalarValue
+		if _, ok := values[name]; ok && (kind == "DIMENSION" || kind == "MEASURE_NAME") {
+			columns = append(columns, name)
+		}
+	}
+	slices.Sort(columns)
+	return columns, nil
+}
+
+// executeLogContext answers a log context query with the rows before or after its
+// row, read from the table of the raw query like a logs query
+func (ds *timestreamDS) executeLogContext(ctx context.Context, query models.QueryModel) backend.DataResponse {
+	if query.LogContext == nil {
+		return errorsource.Response(errorsource.DownstreamError(fmt.Errorf("log context requires the row"), false))
+	}
+	database := valueOrDefault(query.Database, ds.Settings.DefaultDatabase)
+	table := valueOrDefault(query.Table, ds.Settings.DefaultTable)
+	// the table of the logs query, with its macros like $__table expanded
+	query.ListTables = ds.listTables(ctx)
+	raw, err := rewrite(ctx, query, ds.Settings)
+	if err != nil {
+		return errorsource.Response(err)
+	}
+	if refs := validator.References(raw); len(refs) > 0 && refs[0].Table != "" {
+		database, table = valueOrDefault(refs[0].Database, database), refs[0].Table
+	}
+	if database == "" || table == "" {
+		return errorsource.Response(errorsource.DownstreamError(fmt.Errorf("log context requires a database and a table"), false))
+	}
+	columns, err := ds.logContextColumns(ctx, database, table, query.LogContext.Values)
+	if err != nil {
+		return errorsource.Response(errorsource.DownstreamError(err, false))
+	}
+
+	sub := models.QueryModel{
+		RawQuery:       logContextSQL(database, table, *query.LogContext, columns),
+		Format:         models.FormatOptionLogs,
+		WaitForResult:  true,
+		TimeRange:      query.TimeRange,
+		Interval:       query.Interval,
+		MaxDataPoints:  query.MaxDataPoints,
+		TimeoutSeconds: query.TimeoutSeconds,
+		Columns:        query.Columns,
+		Nulls:          query.Nulls,
+
+		// the ad-hoc filters apply to the table the rows are read from
+		Database:         database,
+		Table:            table,
+		ValidatorProfile: query.ValidatorProfile,
+		AdhocFilters:     query.AdhocFilters,
+		TableHints:       query.TableHints,
+	}
+	return ds.executeQuery(ctx, sub)
+}
@@ -0,0 +1,82 @@
+package timestream
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/timestreamquery"
+	timestreamquerytypes "github.com/aws/aws-sdk-go-v2/service/timestreamquery/types"
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/grafana/timestream-datasource/pkg/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func describeRow(name, kind string) timestreamquerytypes.Row {
+	return timestreamquerytypes.Row{Data: []timestreamquerytypes.Datum{{ScalarValue: aws.String(name)}, {ScalarValue: aws.String("varchar")}, {ScalarValue: aws.String(kind)}}}
+}
+
+func TestLogContextSQL(t *testing.T) {
+	row := models.LogContext{
+		Time:   1700000000000,
+		Values: map[string]string{"host": "a", "measure_name": "syslog", "message": "it's up"},
+	}
+	columns := []string{"host", "measure_name"}
+
+	row.Direction = models.LogContextBackward
+	assert.Equal(t, `SELECT * FROM "db"."logs" WHERE time < from_milliseconds(1700000000000) AND time >= from_milliseconds(1700000000000) - 1h AND "host" = 'a' AND measure_name = 'syslog' ORDER BY time DESC LIMIT 100`,
+		logContextSQL("db", "logs", row, columns))
+
+	row.Direction = models.LogContextForward
+	row.Limit = 5000
+	assert.Equal(t, `SELECT * FROM "db"."logs" WHERE time > from_milliseconds(1700000000000) AND time <= from_milliseconds(1700000000000) + 1h AND "host" = 'a' AND measure_name = 'syslog' ORDER BY time ASC LIMIT 1000`,
+		logContextSQL("db", "logs", row, columns))
+}
+
+func TestExecuteLogContext(t *testing.T) {
+	client := &tableClient{outputs: map[string]*timestreamquery.QueryOutput{
+		"DESCRIBE": {Rows: []timestreamquerytypes.Row{
+			describeRow("host", "DIMENSION"),
+			describeRow("region", "DIMENSION"),
+			describeRow("measure_name", "MEASURE_NAME"),
+			describeRow("time", "TIMESTAMP"),
+			describeRow("message", "MULTI"),
+		}},
+		"from_milliseconds": deviceValues([2]string{"a", "1"}),
+	}}
+	ds := &timestreamDS{Client: client, Settings: models.DatasourceSettings{DefaultDatabase: "db", DefaultTable: "metrics"}}
+	query := models.QueryModel{
+		QueryType: models.QueryTypeLogContext,
+		Table:     "logs",
+		RawQuery:  `SELECT * FROM $__database.$__table WHERE time > ago(1h) AND measure_name = 'syslog'`,
+		LogContext: &models.LogContext{
+			Time:      1700000000000,
+			Values:    map[string]string{"host": "a", "measure_name": "syslog", "message": "started"},
+			Direction: models.LogContextBackward,
+			Limit:     10,
+		},
+	}
+
+	dr := ds.ExecuteQuery(context.Background(), query)
+	require.NoError(t, dr.Error)
+	require.Len(t, dr.Frames, 1)
+	meta := dr.Frames[0].Meta
+	assert.Equal(t, data.VisType(data.VisTypeLogs), meta.PreferredVisualization)
+	assert.Equal(t, `SELECT * FROM "db"."logs" WHERE time < from_milliseconds(1700000000000) AND time >= from_milliseconds(1700000000000) - 1h AND "host" = 'a' AND measure_name = 'syslog' ORDER BY time DESC LIMIT 10`, meta.ExecutedQueryString)
+
+	// the rows are filtered and checked like the rows of the logs query
+	query.AdhocFilters = []models.AdhocFilter{{Key: "region", Operator: "=", Value: "eu"}}
+	dr = ds.ExecuteQuery(context.Background(), query)
+	require.NoError(t, dr.Error)
+	assert.Contains(t, dr.Frames[0].Meta.ExecutedQueryString, `"region" = 'eu'`)
+
+	ds.Settings.ValidatorProfiles = map[string]models.ValidatorProfile{"exploratory": {Roles: []string{"Editor"}}}
+	query.ValidatorProfile = "exploratory"
+	ctx := backend.WithPluginContext(context.Background(), backend.PluginContext{User: &backend.User{Role: "Viewer"}})
+	assert.ErrorContains(t, ds.ExecuteQuery(ctx, query).Error, "is not allowed for role")
+
+	query.ValidatorProfile, query.LogContext = "", nil
+	assert.ErrorContains(t, ds.ExecuteQuery(context.Background(), query).Error, "log context requires the row")
+}
@@ -1,12 +1,13 @@
 package timestream
 
 import (
+	"context"
 	"fmt"
+	"regexp"
 	"slices"
 	"strings"
 	"time"
 
-	"github.com/grafana/grafana-plugin-sdk-go/experimental/errorsource"
 	"github.com/grafana/timestream-datasource/pkg/models"
 	"golang.org/x/exp/maps"
 )
@@ -26,6 +27,7 @@ var macroFuncs = map[string]macroFunc{
 	"database":        macroDatabase,
 	"table":           macroTable,
 	"measure":         macroMeasure,
+	"limit":           macroLimit,
 }
 
 var macroKeys []string
@@ -82,6 +84,39 @@ func macroMeasure(model models.QueryModel, settings models.DatasourceSettings) (
 	return valueOrDefault(model.Measure, settings.DefaultMeasure), nil
 }
 
+// rowLimit scales maxDataPoints by the expected number of series
+func rowLimit(model models.QueryModel) int64 {
+	series := model.SeriesHint
+	if series < 1 {
+		series = 1
+	}
+	return model.MaxDataPoints * series
+}
+
+func macroLimit(model models.QueryModel, _ models.DatasourceSettings) (string, error) {
+	if model.MaxDataPoints <= 0 {
+		return "", fmt.Errorf("invalid max data points: %d", model.MaxDataPoints)
+	}
+	return fmt.Sprintf("LIMIT %d", rowLimit(model)), nil
+}
+
+var (
+	selectQuery   = regexp.MustCompile(`(?i)^\s*(select|with)\b`)
+	trailingLimit = regexp.MustCompile(`(?i)\blimit\s+\d+\s*$`)
+)
+
+// appendLimit adds a LIMIT to SELECT queries that don't end with one
+func appendLimit(query string, model models.QueryModel) string {
+	if !selectQuery.MatchString(query) || model.MaxDataPoints <= 0 {
+		return query
+	}
+	trimmed := strings.TrimRight(strings.TrimSpace(query), ";")
+	if trailingLimit.MatchString(trimmed) {
+		return query
+	}
+	return fmt.Sprintf("%s LIMIT %d", trimmed, rowLimit(model))
+}
+
 func valueOrDefault(value string, defaultValue string) string {
 	if value == "" || strings.HasPrefix(value, "${") {
 		return defaultValue
@@ -89,9 +124,8 @@ func valueOrDefault(value string, defaultValue string) string {
 	return value
 }
 
-// Interpolate processes macros
-func Interpolate(model models.QueryModel, settings models.DatasourceSettings) (string, error) {
-	query := model.RawQuery
+// expandMacros replaces the $__ macros of the query
+func expandMacros(query string, model models.QueryModel, settings models.DatasourceSettings) (string, error) {
 	for _, key := range macroKeys {
 		macroKey := fmt.Sprintf("$__%s", key)
 		if !strings.Contains(query, macroKey) {
@@ -99,9 +133,14 @@ func Interpolate(model models.QueryModel, settings models.DatasourceSettings) (s
 		}
 		replacement, err := macroFuncs[key](model, settings)
 		if err != nil {
-			return query, errorsource.DownstreamError(err, false)
+			return query, err
 		}
 		query = strings.ReplaceAll(query, macroKey, replacement)
 	}
 	return query, nil
 }
+
+// Interpolate processes macros, runs the rewrite pipeline without tracing
+func Interpolate(model models.QueryModel, settings models.DatasourceSettings) (string, error) {
+	return rewrite(context.Background(), model, settings)
+}
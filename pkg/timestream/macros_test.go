@@ -150,4 +150,41 @@ func TestInterpolate(t *testing.T) {
 			t.Fatalf("Result mismatch (-want +got):\n%s", diff)
 		}
 	})
+	t.Run("using limit", func(t *testing.T) {
+		sqltxt := `SELECT * FROM db.tbl WHERE $__timeFilter $__limit`
+		expect := `SELECT * FROM db.tbl WHERE time BETWEEN from_milliseconds(1500376552001) AND from_milliseconds(1500376552002) LIMIT 3000`
+
+		query := models.QueryModel{
+			TimeRange:     timeRange,
+			RawQuery:      sqltxt,
+			MaxDataPoints: 1000,
+			SeriesHint:    3,
+		}
+
+		text, _ := Interpolate(query, models.DatasourceSettings{})
+		if diff := cmp.Diff(text, expect); diff != "" {
+			t.Fatalf("Result mismatch (-want +got):\n%s", diff)
+		}
+	})
+
+	t.Run("auto limit", func(t *testing.T) {
+		tests := map[string]string{
+			"SELECT * FROM db.tbl;":                "SELECT * FROM db.tbl LIMIT 500",
+			"WITH a AS (SELECT 1) SELECT * FROM a": "WITH a AS (SELECT 1) SELECT * FROM a LIMIT 500",
+			"SELECT * FROM db.tbl LIMIT 10":        "SELECT * FROM db.tbl LIMIT 10",
+			"SELECT * FROM db.tbl $__limit":        "SELECT * FROM db.tbl LIMIT 500",
+			"SHOW DATABASES":                       "SHOW DATABASES",
+		}
+		for sqltxt, expect := range tests {
+			query := models.QueryModel{
+				RawQuery:      sqltxt,
+				MaxDataPoints: 500,
+				AutoLimit:     true,
+			}
+			text, _ := Interpolate(query, models.DatasourceSettings{})
+			if diff := cmp.Diff(text, expect); diff != "" {
+				t.Fatalf("Result mismatch (-want +got):\n%s", diff)
+			}
+		}
+	})
 }
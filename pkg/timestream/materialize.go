@@ -0,0 +1,436 @@
+package timestream
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/timestreamquery"
+	timestreamquerytypes "github.com/aws/aws-sdk-go-v2/service/timestreamquery/types"
+	"github.com/aws/aws-sdk-go-v2/service/timestreamwrite"
+	timestreamwritetypes "github.com/aws/aws-sdk-go-v2/service/timestreamwrite/types"
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/backend/gtime"
+	"github.com/grafana/grafana-plugin-sdk-go/backend/resource"
+	"github.com/grafana/timestream-datasource/pkg/models"
+)
+
+const (
+	// materializationPrefix marks the scheduled queries the datasource manages,
+	// the rest of the name is the one of the materialization
+	materializationPrefix = "grafana-materialized-"
+	// scheduledRuntime is the parameter Timestream sets to the time of each run
+	scheduledRuntime = "@scheduled_runtime"
+	// retention of created tables: the memory store keeps at least a day and
+	// the lookback of the runs, which can't write to the magnetic store
+	defaultMaterializedMemoryHours  = 24
+	defaultMaterializedMagneticDays = 365
+	maxMemoryStoreHours             = 8766
+	maxMagneticStoreDays            = 73000
+)
+
+// Scheduled query names are at most 64 characters
+var materializationName = regexp.MustCompile(`^[a-zA-Z0-9_.-]{1,43}$`)
+
+// ScheduledQueryClient manages the scheduled queries of materializations
+type ScheduledQueryClient interface {
+	CreateScheduledQuery(context.Context, *timestreamquery.CreateScheduledQueryInput, ...func(*timestreamquery.Options)) (*timestreamquery.CreateScheduledQueryOutput, error)
+	ListScheduledQueries(context.Context, *timestreamquery.ListScheduledQueriesInput, ...func(*timestreamquery.Options)) (*timestreamquery.ListScheduledQueriesOutput, error)
+	UpdateScheduledQuery(context.Context, *timestreamquery.UpdateScheduledQueryInput, ...func(*timestreamquery.Options)) (*timestreamquery.UpdateScheduledQueryOutput, error)
+	DeleteScheduledQuery(context.Context, *timestreamquery.DeleteScheduledQueryInput, ...func(*timestreamquery.Options)) (*timestreamquery.DeleteScheduledQueryOutput, error)
+}
+
+// TableCreator creates the tables materializations write to
+type TableCreator interface {
+	CreateTable(context.Context, *timestreamwrite.CreateTableInput, ...func(*timestreamwrite.Options)) (*timestreamwrite.CreateTableOutput, error)
+}
+
+// materializer creates the scheduled queries writing the results of panel
+// queries to tables, so panels can read the pre-aggregated tables instead
+type materializer struct {
+	settings  models.MaterializationSettings
+	scheduler ScheduledQueryClient
+	tables    TableCreator
+}
+
+// materializationPlan is a scheduled query derived from a panel query
+type materializationPlan struct {
+	models.Materialization
+	target                    timestreamquerytypes.TimestreamConfiguration
+	memoryHours, magneticDays int64
+	// validatorProfile is the one of the panel query, the SQL passed its rules
+	validatorProfile string
+}
+
+// materializationResource serves the materializations resources: the list,
+// preview and create of materializations, state to enable or disable one and
+// delete. Deleting stops the scheduled query, the table and its data are kept.
+func (ds *timestreamDS) materializationResource(ctx context.Context, req *backend.CallResourceRequest, sender backend.CallResourceResponseSender) error {
+	if req.Path == "materializations" {
+		list, err := ds.materializer.list(ctx)
+		if err != nil {
+			return err
+		}
+		return resource.SendJSON(sender, list)
+	}
+	if req.Method != "POST" {
+		return fmt.Errorf("%s requires a post command", req.Path)
+	}
+	switch req.Path {
+	case "materializations/preview", "materializations/create":
+		opts := models.MaterializationRequest{}
+		if err := json.Unmarshal(req.Body, &opts); err != nil {
+			return err
+		}
+		plan, err := ds.planMaterialization(ctx, opts)
+		if err != nil {
+			return err
+		}
+		if req.Path == "materializations/create" {
+			err := ds.materializer.create(ctx, plan)
+			ds.auditQuery(ctx, "materializations/create", models.QueryModel{RawQuery: plan.ScheduledQuery, ValidatorProfile: plan.validatorProfile}, backend.DataResponse{Error: err})
+			if err != nil {
+				return err
+			}
+		}
+		return resource.SendJSON(sender, plan.Materialization)
+	case "materializations/state", "materializations/delete":
+		opts := models.MaterializationStateRequest{}
+		if err := json.Unmarshal(req.Body, &opts); err != nil {
+			return err
+		}
+		if !isMaterializationArn(opts.Arn) {
+			return fmt.Errorf("%q is not a scheduled query of a materialization", opts.Arn)
+		}
+		if req.Path == "materializations/delete" {
+			_, err := ds.materializer.scheduler.DeleteScheduledQuery(ctx, &timestreamquery.DeleteScheduledQueryInput{ScheduledQueryArn: aws.String(opts.Arn)})
+			if err != nil {
+				return err
+			}
+		} else {
+			state := timestreamquerytypes.ScheduledQueryStateDisabled
+			if opts.Enabled {
+				state = timestreamquerytypes.ScheduledQueryStateEnabled
+			}
+			_, err := ds.materializer.scheduler.UpdateScheduledQuery(ctx, &timestreamquery.UpdateScheduledQueryInput{ScheduledQueryArn: aws.String(opts.Arn), State: state})
+			if err != nil {
+				return err
+			}
+		}
+		list, err := ds.materializer.list(ctx)
+		if err != nil {
+			return err
+		}
+		return resource.SendJSON(sender, list)
+	}
+	return fmt.Errorf("unknown resource")
+}
+
+// planMaterialization derives the scheduled query of the request: the panel
+// query reading the lookback before each run, and the columns it writes, read
+// from a run of the query now. The run has to pass the checks of panel queries.
+func (ds *timestreamDS) planMaterialization(ctx context.Context, req models.MaterializationRequest) (*materializationPlan, error) {
+	if !materializationName.MatchString(req.Name) {
+		return nil, fmt.Errorf("invalid materialization name %q, use up to 43 letters, digits, '_', '-' and '.'", req.Name)
+	}
+	database := strings.Trim(valueOrDefault(req.Database, valueOrDefault(ds.materializer.settings.Database, ds.Settings.DefaultDatabase)), `"`)
+	table := strings.Trim(req.Table, `"`)
+	if database == "" || table == "" {
+		return nil, fmt.Errorf("materializations require a database and a table")
+	}
+	interval, err := materializationDuration("interval", req.Interval)
+	if err != nil {
+		return nil, err
+	}
+	lookback, resolution := interval, interval
+	if req.Lookback != "" {
+		if lookback, err = materializationDuration("lookback", req.Lookback); err != nil {
+			return nil, err
+		}
+	}
+	if req.Resolution != "" {
+		if resolution, err = materializationDuration("resolution", req.Resolution); err != nil {
+			return nil, err
+		}
+	}
+	memoryHours, magneticDays, err := materializedRetention(req, lookback)
+	if err != nil {
+		return nil, err
+	}
+
+	query, err := ds.queryModel(backend.DataQuery{JSON: req.Query}, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	if query.RawQuery == "" {
+		return nil, fmt.Errorf("materializations require a query with SQL")
+	}
+	sql, err := scheduledSQL(*query, lookback, resolution, ds.Settings)
+	if err != nil {
+		return nil, err
+	}
+	// a run now is checked, spends the budget and is audited like the queries
+	// of resources, the scheduled query runs the same SQL later
+	trial := models.QueryModel{RawQuery: strings.ReplaceAll(sql, scheduledRuntime, "now()"), ValidatorProfile: query.ValidatorProfile}
+	out, err := ds.metadataQuery(ctx, nil, "materializations/preview", trial, 1, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	measureName := valueOrDefault(req.MeasureName, req.Name)
+	target, err := materializedTarget(out.ColumnInfo, database, table, measureName)
+	if err != nil {
+		return nil, err
+	}
+
+	plan := &materializationPlan{
+		Materialization: models.Materialization{
+			Name:           req.Name,
+			Database:       database,
+			Table:          table,
+			ScheduledQuery: sql,
+			Schedule:       scheduleExpression(interval),
+		},
+		target:           *target,
+		memoryHours:      memoryHours,
+		magneticDays:     magneticDays,
+		validatorProfile: query.ValidatorProfile,
+	}
+	for _, d := range target.DimensionMappings {
+		plan.Dimensions = append(plan.Dimensions, aws.ToString(d.Name))
+	}
+	for _, m := range target.MultiMeasureMappings.MultiMeasureAttributeMappings {
+		plan.Measures = append(plan.Measures, aws.ToString(m.SourceColumn))
+	}
+	plan.PanelQuery = materializedPanelQuery(plan.Materialization, aws.ToString(target.TimeColumn), measureName)
+	return plan, nil
+}
+
+// materializationDuration parses a duration of whole minutes, the resolution
+// of scheduled queries
+func materializationDuration(name, value string) (time.Duration, error) {
+	d, err := gtime.ParseDuration(value)
+	if err != nil || d < time.Minute || d%time.Minute != 0 {
+		return 0, fmt.Errorf("invalid %s %q, use whole minutes like 5m or 1h", name, value)
+	}
+	return d, nil
+}
+
+// materializedRetention returns the retention of a created table: the memory
+// store has to keep the lookback, the runs rewrite it
+func materializedRetention(req models.MaterializationRequest, lookback time.Duration) (int64, int64, error) {
+	lookbackHours := int64((lookback + time.Hour - 1) / time.Hour)
+	memoryHours, magneticDays := req.MemoryStoreHours, req.MagneticStoreDays
+	if memoryHours == 0 {
+		memoryHours = max(defaultMaterializedMemoryHours, lookbackHours)
+	}
+	if magneticDays == 0 {
+		magneticDays = defaultMaterializedMagneticDays
+	}
+	if memoryHours < lookbackHours || memoryHours > maxMemoryStoreHours {
+		return 0, 0, fmt.Errorf("memoryStoreHours must be from the %dh of the lookback to %d", lookbackHours, maxMemoryStoreHours)
+	}
+	if magneticDays < 1 || magneticDays > maxMagneticStoreDays {
+		return 0, 0, fmt.Errorf("magneticStoreDays must be from 1 to %d", maxMagneticStoreDays)
+	}
+	return memoryHours, magneticDays, nil
+}
+
+// scheduledSQL replaces $__timeFilter with the lookback before each run and
+// expands the other macros. Macros of the time range of the panel would be
+// fixed at the creation of the scheduled query.
+func scheduledSQL(query models.QueryModel, lookback, resolution time.Duration, settings models.DatasourceSettings) (string, error) {
+	sql := query.RawQuery
+	if !strings.Contains(sql, "$__timeFilter") {
+		return "", fmt.Errorf("materialized queries need $__timeFilter, it reads the lookback of each run")
+	}
+	for _, macro := range []string{"$__timeFrom", "$__timeTo", "$__now_ms", "$__limit"} {
+		if strings.Contains(sql, macro) {
+			return "", fmt.Errorf("%s can't be materialized, it depends on the panel", macro)
+		}
+	}
+	sql = strings.ReplaceAll(sql, "$__timeFilter", fmt.Sprintf("time BETWEEN %s - %s AND %s", scheduledRuntime, sqlDuration(lookback), scheduledRuntime))
+	query.Interval = resolution
+	return expandMacros(sql, query, settings)
+}
+
+// sqlDuration writes a duration of whole minutes as an interval literal, e.g. 2h
+func sqlDuration(d time.Duration) string {
+	switch {
+	case d%(24*time.Hour) == 0:
+		return fmt.Sprintf("%dd", d/(24*time.Hour))
+	case d%time.Hour == 0:
+		return fmt.Sprintf("%dh", d/time.Hour)
+	}
+	return fmt.Sprintf("%dm", d/time.Minute)
+}
+
+// scheduleExpression runs the scheduled query every interval, e.g. rate(2 hours)
+func scheduleExpression(interval time.Duration) string {
+	n, unit := interval/time.Minute, "minute"
+	switch {
+	case interval%(24*time.Hour) == 0:
+		n, unit = interval/(24*time.Hour), "day"
+	case interval%time.Hour == 0:
+		n, unit = interval/time.Hour, "hour"
+	}
+	if n != 1 {
+		unit += "s"
+	}
+	return fmt.Sprintf("rate(%d %s)", n, unit)
+}
+
+// Types of the columns written as measures
+var materializedMeasureTypes = map[timestreamquerytypes.ScalarType]timestreamquerytypes.ScalarMeasureValueType{
+	timestreamquerytypes.ScalarTypeBigint:    timestreamquerytypes.ScalarMeasureValueTypeBigint,
+	timestreamquerytypes.ScalarTypeInteger:   timestreamquerytypes.ScalarMeasureValueTypeBigint,
+	timestreamquerytypes.ScalarTypeDouble:    timestreamquerytypes.ScalarMeasureValueTypeDouble,
+	timestreamquerytypes.ScalarTypeBoolean:   timestreamquerytypes.ScalarMeasureValueTypeBoolean,
+	timestreamquerytypes.ScalarTypeTimestamp: timestreamquerytypes.ScalarMeasureValueTypeTimestamp,
+}
+
+// materializedTarget maps the result columns to a multi-measure record of the
+// table: the first timestamp is its time, varchar columns are dimensions and
+// the others measures
+func materializedTarget(columns []timestreamquerytypes.ColumnInfo, database, table, measureName string) (*timestreamquerytypes.TimestreamConfiguration, error) {
+	target := &timestreamquerytypes.TimestreamConfiguration{
+		DatabaseName:         aws.String(database),
+		TableName:            aws.String(table),
+		MultiMeasureMappings: &timestreamquerytypes.MultiMeasureMappings{TargetMultiMeasureName: aws.String(measureName)},
+	}
+	for _, c := range columns {
+		name := aws.ToString(c.Name)
+		var scalar timestreamquerytypes.ScalarType
+		if c.Type != nil {
+			scalar = c.Type.ScalarType
+		}
+		switch {
+		case scalar == timestreamquerytypes.ScalarTypeTimestamp && target.TimeColumn == nil:
+			target.TimeColumn = aws.String(name)
+		case scalar == timestreamquerytypes.ScalarTypeVarchar:
+			if name == "measure_name" {
+				return nil, fmt.Errorf("the measure_name column can't be materialized, the records are named %s", measureName)
+			}
+			target.DimensionMappings = append(target.DimensionMappings, timestreamquerytypes.DimensionMapping{
+				Name:               aws.String(name),
+				DimensionValueType: timestreamquerytypes.DimensionValueTypeVarchar,
+			})
+		default:
+			valueType, ok := materializedMeasureTypes[scalar]
+			if !ok {
+				return nil, fmt.Errorf("column %s can't be materialized, its type is not a scalar measure type", name)
+			}
+			target.MultiMeasureMappings.MultiMeasureAttributeMappings = append(target.MultiMeasureMappings.MultiMeasureAttributeMappings, timestreamquerytypes.MultiMeasureAttributeMapping{
+				SourceColumn:     aws.String(name),
+				MeasureValueType: valueType,
+			})
+		}
+	}
+	if target.TimeColumn == nil {
+		return nil, fmt.Errorf("materialized queries need a time column, e.g. bin(time, $__interval) AS time")
+	}
+	if len(target.MultiMeasureMappings.MultiMeasureAttributeMappings) == 0 {
+		return nil, fmt.Errorf("materialized queries need a numeric or boolean column")
+	}
+	return target, nil
+}
+
+// materializedPanelQuery reads the columns of the original query back from the
+// materialized table
+func materializedPanelQuery(m models.Materialization, timeColumn, measureName string) string {
+	columns := []string{"time"}
+	if timeColumn != "time" {
+		columns[0] = "time AS " + quoteIdentifier(timeColumn)
+	}
+	for _, c := range slices.Concat(m.Dimensions, m.Measures) {
+		columns = append(columns, quoteIdentifier(c))
+	}
+	return fmt.Sprintf("SELECT %s FROM %s.%s WHERE $__timeFilter AND measure_name = %s ORDER BY time",
+		strings.Join(columns, ", "), quoteIdentifier(m.Database), quoteIdentifier(m.Table), quoteLiteral(measureName))
+}
+
+// create creates the table of the plan, unless it exists, and its scheduled query
+func (m *materializer) create(ctx context.Context, plan *materializationPlan) error {
+	_, err := m.tables.CreateTable(ctx, &timestreamwrite.CreateTableInput{
+		DatabaseName: aws.String(plan.Database),
+		TableName:    aws.String(plan.Table),
+		RetentionProperties: &timestreamwritetypes.RetentionProperties{
+			MemoryStoreRetentionPeriodInHours:  aws.Int64(plan.memoryHours),
+			MagneticStoreRetentionPeriodInDays: aws.Int64(plan.magneticDays),
+		},
+	})
+	var conflict *timestreamwritetypes.ConflictException
+	if err != nil && !errors.As(err, &conflict) {
+		return fmt.Errorf("creating table %s.%s: %w", plan.Database, plan.Table, err)
+	}
+	plan.TableCreated = err == nil
+
+	name := materializationPrefix + plan.Name
+	out, err := m.scheduler.CreateScheduledQuery(ctx, &timestreamquery.CreateScheduledQueryInput{
+		Name:                  aws.String(name),
+		QueryString:           aws.String(plan.ScheduledQuery),
+		ScheduleConfiguration: &timestreamquerytypes.ScheduleConfiguration{ScheduleExpression: aws.String(plan.Schedule)},
+		NotificationConfiguration: &timestreamquerytypes.NotificationConfiguration{
+			SnsConfiguration: &timestreamquerytypes.SnsConfiguration{TopicArn: aws.String(m.settings.TopicARN)},
+		},
+		TargetConfiguration:            &timestreamquerytypes.TargetConfiguration{TimestreamConfiguration: &plan.target},
+		ScheduledQueryExecutionRoleArn: aws.String(m.settings.ExecutionRoleARN),
+		ErrorReportConfiguration: &timestreamquerytypes.ErrorReportConfiguration{
+			S3Configuration: &timestreamquerytypes.S3Configuration{BucketName: aws.String(m.settings.ErrorReportBucket), ObjectKeyPrefix: aws.String(name)},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("creating scheduled query %s: %w", name, err)
+	}
+	plan.Arn = aws.ToString(out.Arn)
+	plan.State = string(timestreamquerytypes.ScheduledQueryStateEnabled)
+	return nil
+}
+
+// list returns the materializations of the scheduled queries, by name
+func (m *materializer) list(ctx context.Context) ([]models.Materialization, error) {
+	list := []models.Materialization{}
+	input := &timestreamquery.ListScheduledQueriesInput{}
+	for {
+		out, err := m.scheduler.ListScheduledQueries(ctx, input)
+		if err != nil {
+			return nil, err
+		}
+		for _, q := range out.ScheduledQueries {
+			name, ok := strings.CutPrefix(aws.ToString(q.Name), materializationPrefix)
+			if !ok {
+				continue
+			}
+			item := models.Materialization{
+				Name:          name,
+				Arn:           aws.ToString(q.Arn),
+				State:         string(q.State),
+				LastRunStatus: string(q.LastRunStatus),
+				PreviousRun:   q.PreviousInvocationTime,
+				NextRun:       q.NextInvocationTime,
+			}
+			if d := q.TargetDestination; d != nil && d.TimestreamDestination != nil {
+				item.Database = aws.ToString(d.TimestreamDestination.DatabaseName)
+				item.Table = aws.ToString(d.TimestreamDestination.TableName)
+			}
+			list = append(list, item)
+		}
+		if out.NextToken == nil {
+			break
+		}
+		input.NextToken = out.NextToken
+	}
+	slices.SortFunc(list, func(a, b models.Materialization) int { return strings.Compare(a.Name, b.Name) })
+	return list, nil
+}
+
+// isMaterializationArn reports whether the ARN is of a scheduled query of a
+// materialization, so other scheduled queries of the account can't be changed
+func isMaterializationArn(arn string) bool {
+	return strings.HasPrefix(arn, "arn:") && strings.Contains(arn, ":scheduled-query/"+materializationPrefix)
+}
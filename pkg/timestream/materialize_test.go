@@ -0,0 +1,244 @@
+package timestream
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/timestreamquery"
+	timestreamquerytypes "github.com/aws/aws-sdk-go-v2/service/timestreamquery/types"
+	"github.com/aws/aws-sdk-go-v2/service/timestreamwrite"
+	timestreamwritetypes "github.com/aws/aws-sdk-go-v2/service/timestreamwrite/types"
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/timestream-datasource/pkg/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeScheduler struct {
+	queries []timestreamquerytypes.ScheduledQuery
+	created []*timestreamquery.CreateScheduledQueryInput
+	updated []*timestreamquery.UpdateScheduledQueryInput
+	deleted []string
+}
+
+func (f *fakeScheduler) CreateScheduledQuery(_ context.Context, input *timestreamquery.CreateScheduledQueryInput, _ ...func(*timestreamquery.Options)) (*timestreamquery.CreateScheduledQueryOutput, error) {
+	f.created = append(f.created, input)
+	return &timestreamquery.CreateScheduledQueryOutput{Arn: aws.String("arn:aws:timestream:eu-west-1:111111111111:scheduled-query/" + *input.Name + "-abc")}, nil
+}
+
+// ListScheduledQueries returns a page per query
+func (f *fakeScheduler) ListScheduledQueries(_ context.Context, input *timestreamquery.ListScheduledQueriesInput, _ ...func(*timestreamquery.Options)) (*timestreamquery.ListScheduledQueriesOutput, error) {
+	i := 0
+	if input.NextToken != nil {
+		i, _ = strconv.Atoi(*input.NextToken)
+	}
+	out := &timestreamquery.ListScheduledQueriesOutput{}
+	if i < len(f.queries) {
+		out.ScheduledQueries = f.queries[i : i+1]
+	}
+	if i+1 < len(f.queries) {
+		out.NextToken = aws.String(strconv.Itoa(i + 1))
+	}
+	return out, nil
+}
+
+func (f *fakeScheduler) UpdateScheduledQuery(_ context.Context, input *timestreamquery.UpdateScheduledQueryInput, _ ...func(*timestreamquery.Options)) (*timestreamquery.UpdateScheduledQueryOutput, error) {
+	f.updated = append(f.updated, input)
+	return &timestreamquery.UpdateScheduledQueryOutput{}, nil
+}
+
+func (f *fakeScheduler) DeleteScheduledQuery(_ context.Context, input *timestreamquery.DeleteScheduledQueryInput, _ ...func(*timestreamquery.Options)) (*timestreamquery.DeleteScheduledQueryOutput, error) {
+	f.deleted = append(f.deleted, *input.ScheduledQueryArn)
+	return &timestreamquery.DeleteScheduledQueryOutput{}, nil
+}
+
+type fakeTableCreator struct {
+	created []*timestreamwrite.CreateTableInput
+	err     error
+}
+
+func (f *fakeTableCreator) CreateTable(_ context.Context, input *timestreamwrite.CreateTableInput, _ ...func(*timestreamwrite.Options)) (*timestreamwrite.CreateTableOutput, error) {
+	f.created = append(f.created, input)
+	return &timestreamwrite.CreateTableOutput{}, f.err
+}
+
+func hostLoadColumns() *timestreamquery.QueryOutput {
+	column := func(name string, t timestreamquerytypes.ScalarType) timestreamquerytypes.ColumnInfo {
+		return timestreamquerytypes.ColumnInfo{Name: aws.String(name), Type: &timestreamquerytypes.Type{ScalarType: t}}
+	}
+	return &timestreamquery.QueryOutput{ColumnInfo: []timestreamquerytypes.ColumnInfo{
+		column("binned", timestreamquerytypes.ScalarTypeTimestamp),
+		column("host", timestreamquerytypes.ScalarTypeVarchar),
+		column("avg_load", timestreamquerytypes.ScalarTypeDouble),
+		column("samples", timestreamquerytypes.ScalarTypeBigint),
+	}}
+}
+
+func materializationDS(client *fakeClient, scheduler *fakeScheduler, tables *fakeTableCreator) *timestreamDS {
+	settings := models.MaterializationSettings{
+		ExecutionRoleARN:  "arn:aws:iam::111111111111:role/scheduled",
+		TopicARN:          "arn:aws:sns:eu-west-1:111111111111:runs",
+		ErrorReportBucket: "reports",
+		Database:          "rollups",
+	}
+	return &timestreamDS{
+		Client:       client,
+		Settings:     models.DatasourceSettings{DefaultDatabase: "metrics", Materialization: &settings},
+		materializer: &materializer{settings: settings, scheduler: scheduler, tables: tables},
+	}
+}
+
+const hostLoadQuery = `{"rawQuery":"SELECT bin(time, $__interval) AS binned, host, avg(measure_value::double) AS avg_load, count(*) AS samples FROM $__database.hosts WHERE $__timeFilter AND measure_name = 'load' GROUP BY 1, 2","database":"\"metrics\""}`
+
+func TestPlanMaterialization(t *testing.T) {
+	client := &fakeClient{output: hostLoadColumns()}
+	ds := materializationDS(client, &fakeScheduler{}, &fakeTableCreator{})
+
+	plan, err := ds.planMaterialization(context.Background(), models.MaterializationRequest{
+		Name:       "host-load",
+		Query:      []byte(hostLoadQuery),
+		Interval:   "1h",
+		Lookback:   "2h",
+		Resolution: "5m",
+		Table:      "host_load_5m",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, `SELECT bin(time, 300000ms) AS binned, host, avg(measure_value::double) AS avg_load, count(*) AS samples FROM "metrics".hosts WHERE time BETWEEN @scheduled_runtime - 2h AND @scheduled_runtime AND measure_name = 'load' GROUP BY 1, 2`, plan.ScheduledQuery)
+	assert.Equal(t, "rate(1 hour)", plan.Schedule)
+	require.Len(t, client.calls.runQuery, 1)
+	assert.Contains(t, *client.calls.runQuery[0].QueryString, "time BETWEEN now() - 2h AND now()")
+
+	assert.Equal(t, "binned", *plan.target.TimeColumn)
+	assert.Equal(t, "host-load", *plan.target.MultiMeasureMappings.TargetMultiMeasureName)
+	assert.Equal(t, []string{"host"}, plan.Dimensions)
+	assert.Equal(t, []string{"avg_load", "samples"}, plan.Measures)
+	assert.Equal(t, timestreamquerytypes.ScalarMeasureValueTypeBigint, plan.target.MultiMeasureMappings.MultiMeasureAttributeMappings[1].MeasureValueType)
+	assert.Equal(t, `SELECT time AS "binned", "host", "avg_load", "samples" FROM "rollups"."host_load_5m" WHERE $__timeFilter AND measure_name = 'host-load' ORDER BY time`, plan.PanelQuery)
+	assert.Equal(t, int64(24), plan.memoryHours)
+	assert.Equal(t, int64(365), plan.magneticDays)
+
+	for desc, req := range map[string]models.MaterializationRequest{
+		"invalid name":      {Name: "host load", Query: []byte(hostLoadQuery), Interval: "1h", Table: "t"},
+		"no table":          {Name: "a", Query: []byte(hostLoadQuery), Interval: "1h"},
+		"seconds interval":  {Name: "a", Query: []byte(hostLoadQuery), Interval: "30s", Table: "t"},
+		"short retention":   {Name: "a", Query: []byte(hostLoadQuery), Interval: "1h", Lookback: "2d", MemoryStoreHours: 24, Table: "t"},
+		"no time filter":    {Name: "a", Query: []byte(`{"rawQuery":"SELECT * FROM db.t WHERE time > ago(1h)"}`), Interval: "1h", Table: "t"},
+		"panel time macros": {Name: "a", Query: []byte(`{"rawQuery":"SELECT * FROM db.t WHERE $__timeFilter AND time < from_milliseconds($__timeTo)"}`), Interval: "1h", Table: "t"},
+		"no measure filter": {Name: "a", Query: []byte(`{"rawQuery":"SELECT bin(time, $__interval) AS t, avg(measure_value::double) AS v FROM db.t WHERE $__timeFilter GROUP BY 1"}`), Interval: "1h", Table: "t"},
+		"unknown profile":   {Name: "a", Query: []byte(`{"rawQuery":"SELECT * FROM db.t WHERE $__timeFilter AND measure_name = 'a'","validatorProfile":"raw"}`), Interval: "1h", Table: "t"},
+	} {
+		_, err := ds.planMaterialization(context.Background(), req)
+		assert.Error(t, err, desc)
+	}
+}
+
+func TestMaterializedTarget(t *testing.T) {
+	column := func(name string, t timestreamquerytypes.ScalarType) timestreamquerytypes.ColumnInfo {
+		return timestreamquerytypes.ColumnInfo{Name: aws.String(name), Type: &timestreamquerytypes.Type{ScalarType: t}}
+	}
+	for desc, columns := range map[string][]timestreamquerytypes.ColumnInfo{
+		"no time":          {column("host", timestreamquerytypes.ScalarTypeVarchar), column("v", timestreamquerytypes.ScalarTypeDouble)},
+		"no measure":       {column("time", timestreamquerytypes.ScalarTypeTimestamp), column("host", timestreamquerytypes.ScalarTypeVarchar)},
+		"measure_name":     {column("time", timestreamquerytypes.ScalarTypeTimestamp), column("measure_name", timestreamquerytypes.ScalarTypeVarchar), column("v", timestreamquerytypes.ScalarTypeDouble)},
+		"unsupported type": {column("time", timestreamquerytypes.ScalarTypeTimestamp), column("day", timestreamquerytypes.ScalarTypeDate)},
+	} {
+		_, err := materializedTarget(columns, "db", "t", "m")
+		assert.Error(t, err, desc)
+	}
+}
+
+func TestScheduleExpression(t *testing.T) {
+	for d, want := range map[time.Duration]string{
+		time.Minute:      "rate(1 minute)",
+		90 * time.Minute: "rate(90 minutes)",
+		2 * time.Hour:    "rate(2 hours)",
+		24 * time.Hour:   "rate(1 day)",
+	} {
+		assert.Equal(t, want, scheduleExpression(d))
+	}
+}
+
+func TestMaterializationResources(t *testing.T) {
+	scheduler := &fakeScheduler{queries: []timestreamquerytypes.ScheduledQuery{
+		{Name: aws.String("grafana-materialized-b"), Arn: aws.String("arn:aws:timestream:eu-west-1:111111111111:scheduled-query/grafana-materialized-b-abc"), State: timestreamquerytypes.ScheduledQueryStateEnabled},
+		{Name: aws.String("nightly-report"), Arn: aws.String("arn:aws:timestream:eu-west-1:111111111111:scheduled-query/nightly-report-abc")},
+		{Name: aws.String("grafana-materialized-a"), Arn: aws.String("arn:aws:timestream:eu-west-1:111111111111:scheduled-query/grafana-materialized-a-abc"), TargetDestination: &timestreamquerytypes.TargetDestination{
+			TimestreamDestination: &timestreamquerytypes.TimestreamDestination{DatabaseName: aws.String("rollups"), TableName: aws.String("a")},
+		}},
+	}}
+	tables := &fakeTableCreator{err: &timestreamwritetypes.ConflictException{}}
+	ds := materializationDS(&fakeClient{output: hostLoadColumns()}, scheduler, tables)
+	sink := &fakeAuditSink{}
+	ds.audit = newAuditLogger(sink, 100, time.Hour)
+	admin := backend.PluginContext{User: &backend.User{Role: "Admin"}}
+	call := func(req *backend.CallResourceRequest) (*backend.CallResourceResponse, error) {
+		var res *backend.CallResourceResponse
+		err := ds.CallResource(context.Background(), req, backend.CallResourceResponseSenderFunc(func(r *backend.CallResourceResponse) error {
+			res = r
+			return nil
+		}))
+		return res, err
+	}
+
+	_, err := call(&backend.CallResourceRequest{Path: "materializations", PluginContext: backend.PluginContext{User: &backend.User{Role: "Editor"}}})
+	require.ErrorContains(t, err, "requires the Admin role")
+
+	res, err := call(&backend.CallResourceRequest{Path: "materializations", PluginContext: admin})
+	require.NoError(t, err)
+	list := []models.Materialization{}
+	require.NoError(t, json.Unmarshal(res.Body, &list))
+	require.Len(t, list, 2)
+	assert.Equal(t, "a", list[0].Name)
+	assert.Equal(t, "rollups", list[0].Database)
+	assert.Equal(t, "b", list[1].Name)
+
+	body, _ := json.Marshal(models.MaterializationRequest{Name: "host-load", Query: []byte(hostLoadQuery), Interval: "15m", Table: "host_load"})
+	res, err = call(&backend.CallResourceRequest{Path: "materializations/preview", Method: "POST", Body: body, PluginContext: admin})
+	require.NoError(t, err)
+	assert.Empty(t, scheduler.created)
+	assert.Empty(t, tables.created)
+
+	res, err = call(&backend.CallResourceRequest{Path: "materializations/create", Method: "POST", Body: body, PluginContext: admin})
+	require.NoError(t, err)
+	created := models.Materialization{}
+	require.NoError(t, json.Unmarshal(res.Body, &created))
+	assert.False(t, created.TableCreated)
+	assert.Equal(t, "ENABLED", created.State)
+	assert.Contains(t, created.Arn, "scheduled-query/grafana-materialized-host-load")
+	require.Len(t, tables.created, 1)
+	assert.Equal(t, int64(24), *tables.created[0].RetentionProperties.MemoryStoreRetentionPeriodInHours)
+	require.Len(t, scheduler.created, 1)
+	input := scheduler.created[0]
+	assert.Equal(t, "grafana-materialized-host-load", *input.Name)
+	assert.Equal(t, "rate(15 minutes)", *input.ScheduleConfiguration.ScheduleExpression)
+	assert.Equal(t, "arn:aws:iam::111111111111:role/scheduled", *input.ScheduledQueryExecutionRoleArn)
+	assert.Equal(t, "reports", *input.ErrorReportConfiguration.S3Configuration.BucketName)
+	assert.Equal(t, "host_load", *input.TargetConfiguration.TimestreamConfiguration.TableName)
+	// the trial runs of preview and create, and the create
+	ds.audit.close()
+	require.Equal(t, 3, sink.count())
+	assert.Equal(t, "materializations/create", sink.batches[0][2].RefID)
+
+	body, _ = json.Marshal(models.MaterializationStateRequest{Arn: *scheduler.queries[0].Arn})
+	_, err = call(&backend.CallResourceRequest{Path: "materializations/state", Method: "POST", Body: body, PluginContext: admin})
+	require.NoError(t, err)
+	require.Len(t, scheduler.updated, 1)
+	assert.Equal(t, timestreamquerytypes.ScheduledQueryStateDisabled, scheduler.updated[0].State)
+
+	_, err = call(&backend.CallResourceRequest{Path: "materializations/delete", Method: "POST", Body: body, PluginContext: admin})
+	require.NoError(t, err)
+	assert.Equal(t, []string{*scheduler.queries[0].Arn}, scheduler.deleted)
+
+	body, _ = json.Marshal(models.MaterializationStateRequest{Arn: *scheduler.queries[1].Arn})
+	_, err = call(&backend.CallResourceRequest{Path: "materializations/delete", Method: "POST", Body: body, PluginContext: admin})
+	require.ErrorContains(t, err, "is not a scheduled query of a materialization")
+	assert.Len(t, scheduler.deleted, 1)
+
+	ds.materializer = nil
+	_, err = call(&backend.CallResourceRequest{Path: "materializations", PluginContext: admin})
+	require.ErrorContains(t, err, "materialization is not configured")
+}
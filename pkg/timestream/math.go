@@ -0,0 +1,246 @@
+package timestream
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/grafana/grafana-plugin-sdk-go/experimental/errorsource"
+	"github.com/grafana/timestream-datasource/pkg/models"
+)
+
+// mathNode is a node of a parsed math expression, either a number, a reference
+// to another query or an operator applied to two nodes
+type mathNode struct {
+	op          byte
+	ref         string
+	value       float64
+	left, right *mathNode
+}
+
+// parseMath parses expressions like $A / $B * 100 with + - * /, parentheses,
+// unary minus and references to other queries, with or without $
+func parseMath(expr string) (*mathNode, error) {
+	p := &mathParser{src: expr}
+	node, err := p.sum()
+	if err != nil {
+		return nil, err
+	}
+	if p.skipSpace(); p.pos < len(p.src) {
+		return nil, fmt.Errorf("unexpected %q at %d in expression", p.src[p.pos:], p.pos)
+	}
+	return node, nil
+}
+
+type mathParser struct {
+	src string
+	pos int
+}
+
+func (p *mathParser) skipSpace() {
+	for p.pos < len(p.src) && unicode.IsSpace(rune(p.src[p.pos])) {
+		p.pos++
+	}
+}
+
+// next consumes the operator if it is one of ops
+func (p *mathParser) next(ops string) (byte, bool) {
+	p.skipSpace()
+	if p.pos < len(p.src) && strings.IndexByte(ops, p.src[p.pos]) >= 0 {
+		p.pos++
+		return p.src[p.pos-1], true
+	}
+	return 0, false
+}
+
+func (p *mathParser) sum() (*mathNode, error) {
+	left, err := p.product()
+	for err == nil {
+		op, ok := p.next("+-")
+		if !ok {
+			return left, nil
+		}
+		var right *mathNode
+		if right, err = p.product(); err == nil {
+			left = &mathNode{op: op, left: left, right: right}
+		}
+	}
+	return nil, err
+}
+
+func (p *mathParser) product() (*mathNode, error) {
+	left, err := p.operand()
+	for err == nil {
+		op, ok := p.next("*/")
+		if !ok {
+			return left, nil
+		}
+		var right *mathNode
+		if right, err = p.operand(); err == nil {
+			left = &mathNode{op: op, left: left, right: right}
+		}
+	}
+	return nil, err
+}
+
+func (p *mathParser) operand() (*mathNode, error) {
+	if _, ok := p.next("-"); ok {
+		node, err := p.operand()
+		if err != nil {
+			return nil, err
+		}
+		return &mathNode{op: '-', left: &mathNode{}, right: node}, nil
+	}
+	if _, ok := p.next("("); ok {
+		node, err := p.sum()
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := p.next(")"); !ok {
+			return nil, fmt.Errorf("missing ) at %d in expression", p.pos)
+		}
+		return node, nil
+	}
+	p.skipSpace()
+	start := p.pos
+	p.next("$")
+	for p.pos < len(p.src) && (unicode.IsLetter(rune(p.src[p.pos])) || unicode.IsDigit(rune(p.src[p.pos])) || p.src[p.pos] == '_' || p.src[p.pos] == '.') {
+		p.pos++
+	}
+	word := p.src[start:p.pos]
+	switch {
+	case word == "" || word == "$":
+		return nil, fmt.Errorf("expected a number or a query at %d in expression", start)
+	case unicode.IsDigit(rune(word[0])) || word[0] == '.':
+		v, err := strconv.ParseFloat(word, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %q in expression", word)
+		}
+		return &mathNode{value: v}, nil
+	}
+	return &mathNode{ref: strings.TrimPrefix(word, "$")}, nil
+}
+
+// refs returns the queries the expression references, in order of appearance
+func (n *mathNode) refs() []string {
+	var refs []string
+	var walk func(*mathNode)
+	walk = func(n *mathNode) {
+		switch {
+		case n == nil:
+		case n.ref != "":
+			if !slices.Contains(refs, n.ref) {
+				refs = append(refs, n.ref)
+			}
+		default:
+			walk(n.left)
+			walk(n.right)
+		}
+	}
+	walk(n)
+	return refs
+}
+
+// eval returns the value of the expression at row i of the fields picked for the
+// refs, nil when a value is missing or divided by zero
+func (n *mathNode) eval(i int, fields map[string]*data.Field) *float64 {
+	if n.ref != "" {
+		v, _ := fields[n.ref].At(i).(*float64)
+		return v
+	}
+	if n.op == 0 {
+		v := n.value
+		return &v
+	}
+	left, right := n.left.eval(i, fields), n.right.eval(i, fields)
+	if left == nil || right == nil {
+		return nil
+	}
+	var v float64
+	switch n.op {
+	case '+':
+		v = *left + *right
+	case '-':
+		v = *left - *right
+	case '*':
+		v = *left * *right
+	case '/':
+		if *right == 0 {
+			return nil
+		}
+		v = *left / *right
+	}
+	return &v
+}
+
+// executeMath evaluates the expression of the math query over the series of the
+// queries it references, aligned on time like a merge. Queries with several series
+// are matched by labels, a query with a single series applies to all of them.
+func executeMath(ref string, query models.QueryModel, responses backend.Responses) backend.DataResponse {
+	expr, err := parseMath(query.Expression)
+	if err != nil {
+		return errorsource.Response(errorsource.DownstreamError(fmt.Errorf("math query %s: %w", ref, err), false))
+	}
+	refs := expr.refs()
+	if len(refs) == 0 {
+		return errorsource.Response(errorsource.DownstreamError(fmt.Errorf("math query %s references no query", ref), false))
+	}
+	series, err := refSeries(refs, responses)
+	if err != nil {
+		return errorsource.Response(errorsource.DownstreamError(err, false))
+	}
+	joined := joinOnTime(series, query)
+
+	// the fields of each ref, and the ref with the most series giving the labels
+	byRef := map[string][]*data.Field{}
+	widest := refs[0]
+	for i, s := range series {
+		byRef[s.ref] = append(byRef[s.ref], joined.Fields[i+1])
+	}
+	for _, r := range refs {
+		if len(byRef[r]) == 0 {
+			return errorsource.Response(errorsource.DownstreamError(fmt.Errorf("query %s has no time series", r), false))
+		}
+		if len(byRef[r]) > len(byRef[widest]) {
+			widest = r
+		}
+	}
+
+	fields := []*data.Field{joined.Fields[0]}
+	for _, target := range byRef[widest] {
+		picked := map[string]*data.Field{}
+		for _, r := range refs {
+			if field := matchSeries(byRef[r], target.Labels); field != nil {
+				picked[r] = field
+			}
+		}
+		if len(picked) < len(refs) {
+			continue
+		}
+		values := make([]*float64, joined.Rows())
+		for i := range values {
+			values[i] = expr.eval(i, picked)
+		}
+		fields = append(fields, data.NewField(ref, target.Labels.Copy(), values))
+	}
+	frame := data.NewFrame("", fields...)
+	frame.SetMeta(&data.FrameMeta{Custom: &models.TimestreamCustomMeta{}})
+	return backend.DataResponse{Frames: data.Frames{frame}}
+}
+
+// matchSeries returns the only field, or the field with the labels
+func matchSeries(fields []*data.Field, labels data.Labels) *data.Field {
+	if len(fields) == 1 {
+		return fields[0]
+	}
+	for _, field := range fields {
+		if field.Labels.Equals(labels) {
+			return field
+		}
+	}
+	return nil
+}
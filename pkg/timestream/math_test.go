@@ -0,0 +1,109 @@
+package timestream
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/timestreamquery"
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/grafana/timestream-datasource/pkg/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseMath(t *testing.T) {
+	fields := map[string]*data.Field{
+		"A": data.NewField("a", nil, []*float64{float64Ptr(6), nil}),
+		"B": data.NewField("b", nil, []*float64{float64Ptr(3), float64Ptr(1)}),
+	}
+	tests := []struct {
+		expr string
+		want *float64
+		refs []string
+	}{
+		{expr: "$A / $B * 100", want: float64Ptr(200), refs: []string{"A", "B"}},
+		{expr: "A - B - 1", want: float64Ptr(2), refs: []string{"A", "B"}},
+		{expr: "A - (B - 1)", want: float64Ptr(4), refs: []string{"A", "B"}},
+		{expr: "-A + 2 * B", want: float64Ptr(0), refs: []string{"A", "B"}},
+		{expr: "1.5 * 2", want: float64Ptr(3)},
+		{expr: "A / (B - 3)", want: nil, refs: []string{"A", "B"}},
+		{expr: "$A * $A", want: float64Ptr(36), refs: []string{"A"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			expr, err := parseMath(tt.expr)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, expr.eval(0, fields))
+			assert.Equal(t, tt.refs, expr.refs())
+		})
+	}
+
+	expr, err := parseMath("A + B")
+	require.NoError(t, err)
+	assert.Nil(t, expr.eval(1, fields), "missing values stay missing")
+
+	for _, invalid := range []string{"", "A +", "(A", "A B", "1..2", "A % B"} {
+		_, err := parseMath(invalid)
+		assert.Error(t, err, invalid)
+	}
+}
+
+func TestExecuteMath(t *testing.T) {
+	a := seriesResponse("errors", data.Labels{"host": "a"}, []int64{1, 2}, []*float64{float64Ptr(1), float64Ptr(2)})
+	a.Frames = append(a.Frames, seriesResponse("errors", data.Labels{"host": "b"}, []int64{1, 2}, []*float64{float64Ptr(3), float64Ptr(4)}).Frames...)
+	b := seriesResponse("requests", data.Labels{"host": "b"}, []int64{1, 2}, []*float64{float64Ptr(10), float64Ptr(20)})
+	b.Frames = append(b.Frames, seriesResponse("requests", data.Labels{"host": "c"}, []int64{1, 2}, []*float64{float64Ptr(1), float64Ptr(1)}).Frames...)
+	responses := backend.Responses{
+		"A": a,
+		"B": b,
+		"T": seriesResponse("total", nil, []int64{2, 3}, []*float64{float64Ptr(100), float64Ptr(100)}),
+	}
+
+	t.Run("single series applies to all", func(t *testing.T) {
+		dr := executeMath("C", models.QueryModel{Expression: "$A / $T * 100"}, responses)
+		require.NoError(t, dr.Error)
+		frame := dr.Frames[0]
+		require.Len(t, frame.Fields, 3)
+		assert.Equal(t, "C", frame.Fields[1].Name)
+		assert.Equal(t, data.Labels{"host": "a"}, frame.Fields[1].Labels)
+		assert.Equal(t, []*float64{nil, float64Ptr(2), nil}, fieldValues(frame.Fields[1]))
+		assert.Equal(t, []*float64{nil, float64Ptr(4), nil}, fieldValues(frame.Fields[2]))
+	})
+
+	t.Run("series matched by labels", func(t *testing.T) {
+		dr := executeMath("C", models.QueryModel{Expression: "A / B"}, responses)
+		require.NoError(t, dr.Error)
+		frame := dr.Frames[0]
+		require.Len(t, frame.Fields, 2, "host a has no requests")
+		assert.Equal(t, data.Labels{"host": "b"}, frame.Fields[1].Labels)
+		assert.Equal(t, []*float64{float64Ptr(0.3), float64Ptr(0.2)}, fieldValues(frame.Fields[1]))
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		assert.ErrorContains(t, executeMath("C", models.QueryModel{Expression: "A +"}, responses).Error, "math query C")
+		assert.EqualError(t, executeMath("C", models.QueryModel{Expression: "1 + 2"}, responses).Error, "math query C references no query")
+		assert.EqualError(t, executeMath("C", models.QueryModel{Expression: "A + Z"}, responses).Error, "query Z is not part of the request")
+		empty := backend.Responses{"A": {Frames: data.Frames{data.NewFrame("")}}}
+		assert.EqualError(t, executeMath("C", models.QueryModel{Expression: "A * 2"}, empty).Error, "query A has no time series")
+	})
+}
+
+func TestQueryData_Math(t *testing.T) {
+	client := &tableClient{outputs: map[string]*timestreamquery.QueryOutput{
+		"db.a": valueOutput("a", [2]string{"2024-01-01 00:00:00.000000000", "1"}, [2]string{"2024-01-01 00:01:00.000000000", "2"}),
+		"db.b": valueOutput("b", [2]string{"2024-01-01 00:00:00.000000000", "4"}, [2]string{"2024-01-01 00:01:00.000000000", "5"}),
+	}}
+	ds := &timestreamDS{Client: client}
+	tr := backend.TimeRange{From: time.Now().Add(-time.Hour), To: time.Now()}
+	res, err := ds.QueryData(context.Background(), &backend.QueryDataRequest{Queries: []backend.DataQuery{
+		{RefID: "A", TimeRange: tr, JSON: []byte(`{"rawQuery":"SELECT time, a FROM db.a WHERE $__timeFilter AND measure_name = 'a'"}`)},
+		{RefID: "B", TimeRange: tr, JSON: []byte(`{"rawQuery":"SELECT time, b FROM db.b WHERE $__timeFilter AND measure_name = 'b'"}`)},
+		{RefID: "C", TimeRange: tr, JSON: []byte(`{"queryType":"math","expression":"$A + $B"}`)},
+		{RefID: "D", TimeRange: tr, JSON: []byte(`{"queryType":"math","expression":"$C * 2"}`)},
+	}})
+	require.NoError(t, err)
+	require.NoError(t, res.Responses["D"].Error)
+	assert.Equal(t, []*float64{float64Ptr(10), float64Ptr(14)}, fieldValues(res.Responses["D"].Frames[0].Fields[1]))
+}
@@ -0,0 +1,150 @@
+package timestream
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/timestreamquery"
+	timestreamquerytypes "github.com/aws/aws-sdk-go-v2/service/timestreamquery/types"
+)
+
+const (
+	// Sampled measure discovery reads the measures written this far back
+	measureSampleLookback = time.Hour
+	// Sampled measure discovery reads at most this many measures per lookup
+	measureSampleLimit = 1000
+)
+
+// showMeasures returns the measures of the table as SHOW MEASURES rows: the
+// measure name, its data type and its dimensions. The measures of the tables
+// listed in sampledMeasureTables are sampled instead, see sampleMeasures.
+func (ds *timestreamDS) showMeasures(ctx context.Context, database, table string) (*timestreamquery.QueryOutput, error) {
+	if !ds.samplesMeasures(database, table) {
+		return ds.schemaQuery(ctx, fmt.Sprintf("SHOW MEASURES FROM %s.%s", applyQuotesIfNeeded(database), applyQuotesIfNeeded(table)))
+	}
+	return ds.sampleMeasures(ctx, database, table)
+}
+
+// samplesMeasures reports whether the table is listed as "db.table" or "table"
+// in sampledMeasureTables
+func (ds *timestreamDS) samplesMeasures(database, table string) bool {
+	for _, name := range ds.Settings.SampledMeasureTables {
+		if name == database+"."+table || name == table {
+			return true
+		}
+	}
+	return false
+}
+
+// sampledMeasuresSQL selects the distinct measures of the lookback with their data
+// type, told apart by the measure_value column holding their value
+func sampledMeasuresSQL(database, table string, valueColumns []string) string {
+	dataType := "'multi'"
+	if len(valueColumns) > 0 {
+		var sb strings.Builder
+		sb.WriteString("CASE")
+		for _, column := range valueColumns {
+			fmt.Fprintf(&sb, " WHEN %s IS NOT NULL THEN %s", column, quoteLiteral(strings.TrimPrefix(column, "measure_value::")))
+		}
+		sb.WriteString(" ELSE 'multi' END")
+		dataType = sb.String()
+	}
+	return fmt.Sprintf("SELECT DISTINCT measure_name, %s AS data_type FROM %s.%s WHERE time > ago(%dm) LIMIT %d",
+		dataType, quoteIdentifier(database), quoteIdentifier(table), int(measureSampleLookback.Minutes()), measureSampleLimit)
+}
+
+// sampleMeasures discovers the measures of a table too large for SHOW MEASURES
+// from the distinct measures written within the lookback. DESCRIBE gives the value
+// columns and dimensions, every measure is listed with all dimensions of the table.
+// Samples are answered from the schema cache and merged into the measures sampled
+// before, so measures written less than hourly stay listed for a while once seen.
+func (ds *timestreamDS) sampleMeasures(ctx context.Context, database, table string) (*timestreamquery.QueryOutput, error) {
+	columns, err := ds.schemaQuery(ctx, fmt.Sprintf("DESCRIBE %s.%s", applyQuotesIfNeeded(database), applyQuotesIfNeeded(table)))
+	if err != nil {
+		return nil, err
+	}
+	var valueColumns []string
+	var dimensions []timestreamquerytypes.Datum
+	for _, row := range columns.Rows {
+		if len(row.Data) < 3 || row.Data[0].ScalarValue == nil {
+			continue
+		}
+		name := *row.Data[0].ScalarValue
+		switch {
+		case strings.HasPrefix(name, "measure_value::"):
+			valueColumns = append(valueColumns, name)
+		case aws.ToString(row.Data[2].ScalarValue) == "DIMENSION":
+			dimensions = append(dimensions, timestreamquerytypes.Datum{RowValue: &timestreamquerytypes.Row{Data: []timestreamquerytypes.Datum{
+				{ScalarValue: aws.String(name)}, row.Data[1],
+			}}})
+		}
+	}
+	sample, err := ds.schemaQuery(ctx, sampledMeasuresSQL(database, table, valueColumns))
+	if err != nil {
+		return nil, err
+	}
+
+	measures := measureTypes(sample.Rows)
+	if ds.samples != nil {
+		measures = ds.samples.merge(database+"."+table, measures, time.Now())
+	}
+	names := make([]string, 0, len(measures))
+	for name := range measures {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	output := &timestreamquery.QueryOutput{}
+	for _, name := range names {
+		output.Rows = append(output.Rows, timestreamquerytypes.Row{Data: []timestreamquerytypes.Datum{
+			{ScalarValue: aws.String(name)}, {ScalarValue: aws.String(measures[name])}, {ArrayValue: dimensions},
+		}})
+	}
+	return output, nil
+}
+
+// measureSamples accumulates the sampled measures of each table, a measure not
+// sampled again within the window is forgotten
+type measureSamples struct {
+	window time.Duration
+
+	mu     sync.Mutex
+	tables map[string]map[string]sampledMeasure
+}
+
+type sampledMeasure struct {
+	dataType string
+	seen     time.Time
+}
+
+func newMeasureSamples(window time.Duration) *measureSamples {
+	return &measureSamples{window: window, tables: map[string]map[string]sampledMeasure{}}
+}
+
+// merge adds the sampled measures and their types to the table and returns all
+// measures of the table seen within the window
+func (s *measureSamples) merge(table string, sampled map[string]string, now time.Time) map[string]string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	known, ok := s.tables[table]
+	if !ok {
+		known = map[string]sampledMeasure{}
+		s.tables[table] = known
+	}
+	for name, dataType := range sampled {
+		known[name] = sampledMeasure{dataType: dataType, seen: now}
+	}
+	merged := map[string]string{}
+	for name, m := range known {
+		if now.Sub(m.seen) > s.window {
+			delete(known, name)
+			continue
+		}
+		merged[name] = m.dataType
+	}
+	return merged
+}
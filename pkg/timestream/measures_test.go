@@ -0,0 +1,66 @@
+package timestream
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/timestreamquery"
+	timestreamquerytypes "github.com/aws/aws-sdk-go-v2/service/timestreamquery/types"
+	"github.com/grafana/timestream-datasource/pkg/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func sampleRow(measure, dataType string) timestreamquerytypes.Row {
+	return timestreamquerytypes.Row{Data: []timestreamquerytypes.Datum{{ScalarValue: aws.String(measure)}, {ScalarValue: aws.String(dataType)}}}
+}
+
+func TestSampledMeasuresSQL(t *testing.T) {
+	assert.Equal(t,
+		`SELECT DISTINCT measure_name, CASE WHEN measure_value::double IS NOT NULL THEN 'double' WHEN measure_value::bigint IS NOT NULL THEN 'bigint' ELSE 'multi' END AS data_type FROM "db"."big" WHERE time > ago(60m) LIMIT 1000`,
+		sampledMeasuresSQL("db", "big", []string{"measure_value::double", "measure_value::bigint"}))
+	assert.Equal(t,
+		`SELECT DISTINCT measure_name, 'multi' AS data_type FROM "db"."big" WHERE time > ago(60m) LIMIT 1000`,
+		sampledMeasuresSQL("db", "big", nil))
+}
+
+func TestShowMeasures_Sampled(t *testing.T) {
+	valueColumn := timestreamquerytypes.Row{Data: []timestreamquerytypes.Datum{{ScalarValue: aws.String("measure_value::double")}, {ScalarValue: aws.String("double")}, {ScalarValue: aws.String("MEASURE_VALUE")}}}
+	client := &tableClient{outputs: map[string]*timestreamquery.QueryOutput{
+		`DESCRIBE "db"."big"`: {Rows: []timestreamquerytypes.Row{columnRow("host"), valueColumn}},
+		`SELECT DISTINCT`:     {Rows: []timestreamquerytypes.Row{sampleRow("cpu", "double")}},
+		`SHOW MEASURES`:       {Rows: []timestreamquerytypes.Row{measureRow("temp", "site")}},
+	}}
+	ds := &timestreamDS{
+		Client:   client,
+		Settings: models.DatasourceSettings{SampledMeasureTables: []string{"db.big"}},
+		samples:  newMeasureSamples(24 * time.Hour),
+	}
+
+	v, err := ds.showMeasures(context.Background(), "db", "big")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"cpu": "double"}, measureTypes(v.Rows))
+	assert.Equal(t, []string{"host"}, dimensionsFromRows(v.Rows))
+
+	// measures sampled before stay listed when a later sample misses them
+	client.outputs[`SELECT DISTINCT`] = &timestreamquery.QueryOutput{Rows: []timestreamquerytypes.Row{sampleRow("mem", "double")}}
+	v, err = ds.showMeasures(context.Background(), "db", "big")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"cpu": "double", "mem": "double"}, measureTypes(v.Rows))
+
+	v, err = ds.showMeasures(context.Background(), "db", "small")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"temp": "double"}, measureTypes(v.Rows))
+}
+
+func TestMeasureSamples_Merge(t *testing.T) {
+	samples := newMeasureSamples(time.Hour)
+	now := time.Now()
+
+	assert.Equal(t, map[string]string{"cpu": "double"}, samples.merge("db.big", map[string]string{"cpu": "double"}, now))
+	assert.Equal(t, map[string]string{"cpu": "double", "mem": "bigint"}, samples.merge("db.big", map[string]string{"mem": "bigint"}, now.Add(time.Minute)))
+	assert.Equal(t, map[string]string{"mem": "bigint"}, samples.merge("db.big", nil, now.Add(61*time.Minute)))
+	assert.Empty(t, samples.merge("db.other", nil, now))
+}
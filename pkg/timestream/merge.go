@@ -0,0 +1,173 @@
+package timestream
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/grafana/grafana-plugin-sdk-go/experimental/errorsource"
+	"github.com/grafana/timestream-datasource/pkg/models"
+)
+
+// derivedQuery is a merge or math query of a request, evaluated over the responses
+// of the other queries
+type derivedQuery struct {
+	refID string
+	query models.QueryModel
+}
+
+func (d derivedQuery) execute(responses backend.Responses) backend.DataResponse {
+	if d.query.QueryType == models.QueryTypeMath {
+		return executeMath(d.refID, d.query, responses)
+	}
+	return executeMerge(d.query, responses)
+}
+
+// refs returns the queries the derived query reads
+func (d derivedQuery) refs() []string {
+	if d.query.QueryType != models.QueryTypeMath {
+		return d.query.Refs
+	}
+	expr, err := parseMath(d.query.Expression)
+	if err != nil {
+		return nil
+	}
+	return expr.refs()
+}
+
+// timeSeries is a value field of a query response with its timestamps
+type timeSeries struct {
+	ref    string
+	times  []time.Time
+	values *data.Field
+}
+
+// responseSeries returns the numeric series of the response of ref, long frames
+// are converted to wide ones first. Frames without a time field are skipped.
+func responseSeries(ref string, dr backend.DataResponse) ([]timeSeries, error) {
+	var series []timeSeries
+	for _, frame := range dr.Frames {
+		schema := frame.TimeSeriesSchema()
+		if schema.Type == data.TimeSeriesTypeLong {
+			wide, err := data.LongToWide(frame, nil)
+			if err != nil {
+				return nil, fmt.Errorf("query %s: %w", ref, err)
+			}
+			frame, schema = wide, wide.TimeSeriesSchema()
+		}
+		if schema.Type != data.TimeSeriesTypeWide {
+			continue
+		}
+		timeField := frame.Fields[schema.TimeIndex]
+		times := make([]time.Time, 0, timeField.Len())
+		for i := 0; i < timeField.Len(); i++ {
+			t, _ := timeField.ConcreteAt(i)
+			tt, _ := t.(time.Time)
+			times = append(times, tt)
+		}
+		for _, idx := range schema.ValueIndices {
+			if frame.Fields[idx].Type().Numeric() {
+				series = append(series, timeSeries{ref: ref, times: times, values: frame.Fields[idx]})
+			}
+		}
+	}
+	return series, nil
+}
+
+// refSeries returns the series of the responses of the refs, in the order of the refs
+func refSeries(refs []string, responses backend.Responses) ([]timeSeries, error) {
+	var series []timeSeries
+	for _, ref := range refs {
+		dr, ok := responses[ref]
+		if !ok {
+			return nil, fmt.Errorf("query %s is not part of the request", ref)
+		}
+		if dr.Error != nil {
+			return nil, fmt.Errorf("query %s failed: %w", ref, dr.Error)
+		}
+		for _, frame := range dr.Frames {
+			if meta, ok := customMeta(frame); ok && meta.NextToken != "" {
+				return nil, fmt.Errorf("query %s has more rows than it read, e.g. for its max rows", ref)
+			}
+		}
+		s, err := responseSeries(ref, dr)
+		if err != nil {
+			return nil, err
+		}
+		series = append(series, s...)
+	}
+	return series, nil
+}
+
+// joinOnTime outer joins the series on their timestamps into one wide frame with a
+// float64 field per series, missing values are filled as the query asks
+func joinOnTime(series []timeSeries, query models.QueryModel) *data.Frame {
+	index := map[int64]int{}
+	var times []time.Time
+	for _, s := range series {
+		for _, t := range s.times {
+			if _, ok := index[t.UnixNano()]; !ok {
+				index[t.UnixNano()] = 0
+				times = append(times, t)
+			}
+		}
+	}
+	sort.Slice(times, func(i, j int) bool { return times[i].Before(times[j]) })
+	for i, t := range times {
+		index[t.UnixNano()] = i
+	}
+
+	fields := []*data.Field{data.NewField("time", nil, times)}
+	for _, s := range series {
+		values := make([]*float64, len(times))
+		for i, t := range s.times {
+			if _, ok := s.values.ConcreteAt(i); !ok {
+				continue
+			}
+			if v, err := s.values.FloatAt(i); err == nil {
+				values[index[t.UnixNano()]] = &v
+			}
+		}
+		fillValues(values, query)
+		field := data.NewField(s.values.Name, s.values.Labels.Copy(), values)
+		if s.values.Config != nil {
+			config := *s.values.Config
+			field.Config = &config
+		}
+		fields = append(fields, field)
+	}
+	return data.NewFrame("", fields...)
+}
+
+// fillValues fills the missing values with the fill mode of the query
+func fillValues(values []*float64, query models.QueryModel) {
+	var last *float64
+	for i, v := range values {
+		switch {
+		case v != nil:
+			last = v
+		case query.FillMode == models.FillModePrevious && last != nil:
+			values[i] = last
+		case query.FillMode == models.FillModeValue:
+			fill := query.FillValue
+			values[i] = &fill
+		}
+	}
+}
+
+// executeMerge joins the time series of the queries named by the refs of the merge
+// query into one wide frame, e.g. for alert expressions working on a single frame
+func executeMerge(query models.QueryModel, responses backend.Responses) backend.DataResponse {
+	if len(query.Refs) == 0 {
+		return errorsource.Response(errorsource.DownstreamError(fmt.Errorf("merge query requires refs"), false))
+	}
+	series, err := refSeries(query.Refs, responses)
+	if err != nil {
+		return errorsource.Response(errorsource.DownstreamError(err, false))
+	}
+	frame := joinOnTime(series, query)
+	frame.SetMeta(&data.FrameMeta{Custom: &models.TimestreamCustomMeta{}})
+	return backend.DataResponse{Frames: data.Frames{frame}}
+}
@@ -0,0 +1,161 @@
+package timestream
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/timestreamquery"
+	timestreamquerytypes "github.com/aws/aws-sdk-go-v2/service/timestreamquery/types"
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/grafana/timestream-datasource/pkg/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func seriesResponse(name string, labels data.Labels, times []int64, values []*float64) backend.DataResponse {
+	ts := make([]time.Time, len(times))
+	for i, t := range times {
+		ts[i] = time.Unix(t, 0).UTC()
+	}
+	return backend.DataResponse{Frames: data.Frames{data.NewFrame("",
+		data.NewField("time", nil, ts),
+		data.NewField(name, labels, values),
+	)}}
+}
+
+func TestExecuteMerge(t *testing.T) {
+	responses := backend.Responses{
+		"A": seriesResponse("cpu", data.Labels{"host": "a"}, []int64{1, 2, 3}, []*float64{float64Ptr(1), nil, float64Ptr(3)}),
+		"B": seriesResponse("mem", nil, []int64{2, 4}, []*float64{float64Ptr(20), float64Ptr(40)}),
+	}
+
+	t.Run("outer join", func(t *testing.T) {
+		dr := executeMerge(models.QueryModel{Refs: []string{"A", "B"}}, responses)
+		require.NoError(t, dr.Error)
+		require.Len(t, dr.Frames, 1)
+		frame := dr.Frames[0]
+		require.Len(t, frame.Fields, 3)
+		assert.Equal(t, 4, frame.Rows())
+		assert.Equal(t, "cpu", frame.Fields[1].Name)
+		assert.Equal(t, data.Labels{"host": "a"}, frame.Fields[1].Labels)
+		assert.Equal(t, []*float64{float64Ptr(1), nil, float64Ptr(3), nil}, fieldValues(frame.Fields[1]))
+		assert.Equal(t, []*float64{nil, float64Ptr(20), nil, float64Ptr(40)}, fieldValues(frame.Fields[2]))
+	})
+
+	t.Run("fill previous", func(t *testing.T) {
+		dr := executeMerge(models.QueryModel{Refs: []string{"B", "A"}, FillMode: models.FillModePrevious}, responses)
+		require.NoError(t, dr.Error)
+		frame := dr.Frames[0]
+		assert.Equal(t, "mem", frame.Fields[1].Name)
+		assert.Equal(t, []*float64{nil, float64Ptr(20), float64Ptr(20), float64Ptr(40)}, fieldValues(frame.Fields[1]))
+		assert.Equal(t, []*float64{float64Ptr(1), float64Ptr(1), float64Ptr(3), float64Ptr(3)}, fieldValues(frame.Fields[2]))
+	})
+
+	t.Run("fill value", func(t *testing.T) {
+		dr := executeMerge(models.QueryModel{Refs: []string{"B"}, FillMode: models.FillModeValue, FillValue: 0}, responses)
+		require.NoError(t, dr.Error)
+		assert.Equal(t, []*float64{float64Ptr(20), float64Ptr(40)}, fieldValues(dr.Frames[0].Fields[1]))
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		assert.EqualError(t, executeMerge(models.QueryModel{}, responses).Error, "merge query requires refs")
+		assert.EqualError(t, executeMerge(models.QueryModel{Refs: []string{"A", "Z"}}, responses).Error, "query Z is not part of the request")
+		failed := backend.Responses{"A": {Error: assert.AnError}}
+		assert.ErrorContains(t, executeMerge(models.QueryModel{Refs: []string{"A"}}, failed).Error, "query A failed")
+	})
+}
+
+func fieldValues(field *data.Field) []*float64 {
+	values := make([]*float64, field.Len())
+	for i := range values {
+		values[i] = field.At(i).(*float64)
+	}
+	return values
+}
+
+func valueOutput(column string, rows ...[2]string) *timestreamquery.QueryOutput {
+	output := &timestreamquery.QueryOutput{ColumnInfo: []timestreamquerytypes.ColumnInfo{
+		{Name: aws.String("time"), Type: &timestreamquerytypes.Type{ScalarType: timestreamquerytypes.ScalarTypeTimestamp}},
+		{Name: aws.String(column), Type: &timestreamquerytypes.Type{ScalarType: timestreamquerytypes.ScalarTypeDouble}},
+	}}
+	for _, row := range rows {
+		output.Rows = append(output.Rows, timestreamquerytypes.Row{Data: []timestreamquerytypes.Datum{{ScalarValue: aws.String(row[0])}, {ScalarValue: aws.String(row[1])}}})
+	}
+	return output
+}
+
+func TestQueryData_Merge(t *testing.T) {
+	client := &tableClient{outputs: map[string]*timestreamquery.QueryOutput{
+		"db.a": valueOutput("a", [2]string{"2024-01-01 00:00:00.000000000", "1"}, [2]string{"2024-01-01 00:01:00.000000000", "2"}),
+		"db.b": valueOutput("b", [2]string{"2024-01-01 00:01:00.000000000", "5"}),
+	}}
+	ds := &timestreamDS{Client: client}
+	tr := backend.TimeRange{From: time.Now().Add(-time.Hour), To: time.Now()}
+	res, err := ds.QueryData(context.Background(), &backend.QueryDataRequest{Queries: []backend.DataQuery{
+		{RefID: "M", TimeRange: tr, JSON: []byte(`{"queryType":"merge","refs":["A","B"]}`)},
+		{RefID: "A", TimeRange: tr, JSON: []byte(`{"rawQuery":"SELECT time, a FROM db.a WHERE $__timeFilter AND measure_name = 'a'"}`)},
+		{RefID: "B", TimeRange: tr, JSON: []byte(`{"rawQuery":"SELECT time, b FROM db.b WHERE $__timeFilter AND measure_name = 'b'"}`)},
+	}})
+	require.NoError(t, err)
+	merged := res.Responses["M"]
+	require.NoError(t, merged.Error)
+	require.Len(t, merged.Frames, 1)
+	frame := merged.Frames[0]
+	require.Len(t, frame.Fields, 3)
+	assert.Equal(t, 2, frame.Rows())
+	assert.Equal(t, []*float64{nil, float64Ptr(5)}, fieldValues(frame.Fields[2]))
+	assert.NoError(t, res.Responses["A"].Error)
+
+	dr := ds.ExecuteQuery(context.Background(), models.QueryModel{QueryType: models.QueryTypeMerge, Refs: []string{"A"}})
+	assert.Error(t, dr.Error)
+}
+
+// pagedTableClient answers like tableClient, a row per page
+type pagedTableClient struct {
+	tableClient
+}
+
+func (c *pagedTableClient) Query(ctx context.Context, input *timestreamquery.QueryInput, opts ...func(*timestreamquery.Options)) (*timestreamquery.QueryOutput, error) {
+	output, _ := c.tableClient.Query(ctx, input, opts...)
+	page := 0
+	if input.NextToken != nil {
+		page, _ = strconv.Atoi(*input.NextToken)
+	}
+	paged := *output
+	paged.Rows = output.Rows[page : page+1]
+	paged.NextToken = nil
+	if page+1 < len(output.Rows) {
+		paged.NextToken = aws.String(strconv.Itoa(page + 1))
+	}
+	return &paged, nil
+}
+
+func TestQueryData_MergePages(t *testing.T) {
+	client := &pagedTableClient{tableClient{outputs: map[string]*timestreamquery.QueryOutput{
+		"db.a": valueOutput("a", [2]string{"2024-01-01 00:00:00.000000000", "1"}, [2]string{"2024-01-01 00:01:00.000000000", "2"}),
+	}}}
+	ds := &timestreamDS{Client: client}
+	tr := backend.TimeRange{From: time.Now().Add(-time.Hour), To: time.Now()}
+	res, err := ds.QueryData(context.Background(), &backend.QueryDataRequest{Queries: []backend.DataQuery{
+		{RefID: "M", TimeRange: tr, JSON: []byte(`{"queryType":"merge","refs":["A"]}`)},
+		{RefID: "N", TimeRange: tr, JSON: []byte(`{"queryType":"math","expression":"$A * 2"}`)},
+		{RefID: "A", TimeRange: tr, JSON: []byte(`{"rawQuery":"SELECT time, a FROM db.a WHERE $__timeFilter AND measure_name = 'a'"}`)},
+	}})
+	require.NoError(t, err)
+	require.NoError(t, res.Responses["M"].Error)
+	assert.Equal(t, 2, res.Responses["M"].Frames[0].Rows())
+	require.NoError(t, res.Responses["N"].Error)
+	assert.Equal(t, []*float64{float64Ptr(2), float64Ptr(4)}, fieldValues(res.Responses["N"].Frames[0].Fields[1]))
+
+	// rows left unread fail the merge instead of merging part of them
+	res, err = ds.QueryData(context.Background(), &backend.QueryDataRequest{Queries: []backend.DataQuery{
+		{RefID: "M", TimeRange: tr, JSON: []byte(`{"queryType":"merge","refs":["A"]}`)},
+		{RefID: "A", TimeRange: tr, JSON: []byte(`{"rawQuery":"SELECT time, a FROM db.a WHERE $__timeFilter AND measure_name = 'a' AND 1 = 1","maxRows":1}`)},
+	}})
+	require.NoError(t, err)
+	assert.ErrorContains(t, res.Responses["M"].Error, "query A has more rows than it read")
+}
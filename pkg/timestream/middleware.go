@@ -0,0 +1,58 @@
+package timestream
+
+import (
+	"context"
+	"sync"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+)
+
+// middlewares wrap the QueryData and CallResource handlers of the datasources,
+// see RegisterMiddleware
+var middlewares struct {
+	mu   sync.Mutex
+	list []backend.HandlerMiddleware
+}
+
+// RegisterMiddleware adds a middleware wrapping QueryData and CallResource of the
+// datasources created afterwards, so forks can add organization specific checks,
+// logging, quotas or tracing without patching the handlers. Register middlewares in
+// main before datasource.Manage. The first registered middleware sees a request
+// first. Only QueryData and CallResource pass through the middlewares, the other
+// methods of the next handler must not be called.
+func RegisterMiddleware(m backend.HandlerMiddleware) {
+	middlewares.mu.Lock()
+	defer middlewares.mu.Unlock()
+	middlewares.list = append(middlewares.list, m)
+}
+
+// middlewareHandler returns the handler running the requests of the datasource
+// through the registered middlewares, or nil when none are registered
+func middlewareHandler(ds *timestreamDS) (backend.Handler, error) {
+	middlewares.mu.Lock()
+	list := append([]backend.HandlerMiddleware(nil), middlewares.list...)
+	middlewares.mu.Unlock()
+	if len(list) == 0 {
+		return nil, nil
+	}
+	h, err := backend.HandlerFromMiddlewares(&datasourceHandler{ds: ds}, list...)
+	if err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+// datasourceHandler is the last handler of the middleware chain, it answers the
+// requests without passing them through the middlewares again
+type datasourceHandler struct {
+	backend.BaseHandler
+	ds *timestreamDS
+}
+
+func (h *datasourceHandler) QueryData(ctx context.Context, req *backend.QueryDataRequest) (*backend.QueryDataResponse, error) {
+	return h.ds.queryData(ctx, req)
+}
+
+func (h *datasourceHandler) CallResource(ctx context.Context, req *backend.CallResourceRequest, sender backend.CallResourceResponseSender) error {
+	return h.ds.callResource(ctx, req, sender)
+}
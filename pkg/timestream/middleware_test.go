@@ -0,0 +1,68 @@
+package timestream
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/timestreamquery"
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// recordingMiddleware records the requests it sees and rejects resource calls
+// of anonymous users
+type recordingMiddleware struct {
+	backend.BaseHandler
+	name  string
+	calls *[]string
+}
+
+func (m *recordingMiddleware) QueryData(ctx context.Context, req *backend.QueryDataRequest) (*backend.QueryDataResponse, error) {
+	*m.calls = append(*m.calls, m.name+" query")
+	return m.BaseHandler.QueryData(ctx, req)
+}
+
+func (m *recordingMiddleware) CallResource(ctx context.Context, req *backend.CallResourceRequest, sender backend.CallResourceResponseSender) error {
+	*m.calls = append(*m.calls, m.name+" "+req.Path)
+	if backend.UserFromContext(ctx) == nil {
+		return errors.New("forbidden")
+	}
+	return m.BaseHandler.CallResource(ctx, req, sender)
+}
+
+func recording(name string, calls *[]string) backend.HandlerMiddleware {
+	return backend.HandlerMiddlewareFunc(func(next backend.Handler) backend.Handler {
+		return &recordingMiddleware{BaseHandler: backend.NewBaseHandler(next), name: name, calls: calls}
+	})
+}
+
+func TestMiddleware(t *testing.T) {
+	defer func() { middlewares.list = nil }()
+	ds := &timestreamDS{Client: &fakeClient{output: &timestreamquery.QueryOutput{}}}
+	handler, err := middlewareHandler(ds)
+	require.NoError(t, err)
+	assert.Nil(t, handler, "no middlewares registered")
+
+	var calls []string
+	RegisterMiddleware(recording("outer", &calls))
+	RegisterMiddleware(recording("inner", &calls))
+	ds.handler, err = middlewareHandler(ds)
+	require.NoError(t, err)
+
+	res, err := ds.QueryData(context.Background(), &backend.QueryDataRequest{Queries: []backend.DataQuery{{RefID: "A", JSON: []byte(`{"rawQuery":"SHOW DATABASES"}`)}}})
+	require.NoError(t, err)
+	assert.NoError(t, res.Responses["A"].Error)
+	assert.Equal(t, []string{"outer query", "inner query"}, calls)
+
+	sender := &fakeSender{}
+	err = ds.CallResource(context.Background(), &backend.CallResourceRequest{Path: "hello"}, sender)
+	assert.EqualError(t, err, "forbidden")
+	assert.Nil(t, sender.res)
+
+	err = ds.CallResource(context.Background(), &backend.CallResourceRequest{Path: "hello", PluginContext: backend.PluginContext{User: &backend.User{Login: "admin"}}}, sender)
+	require.NoError(t, err)
+	assert.Equal(t, "world", string(sender.res.Body))
+	assert.Equal(t, []string{"outer query", "inner query", "outer hello", "outer hello", "inner hello"}, calls)
+}
@@ -0,0 +1,130 @@
+package timestream
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/grafana/timestream-datasource/pkg/models"
+)
+
+// errNoData is returned for empty results when the query asks for it
+var errNoData = fmt.Errorf("query returned no data")
+
+// applyNullHandling drops all-NULL or all-zero series, replaces NULL values or rejects
+// empty results as configured in the query, so alert reductions don't depend on panel
+// side settings
+func applyNullHandling(frames data.Frames, nulls *models.NullHandling) (data.Frames, error) {
+	if nulls == nil {
+		return frames, nil
+	}
+	if nulls.ErrorOnNoData {
+		rows := 0
+		for _, frame := range frames {
+			rows += frame.Rows()
+		}
+		if rows == 0 {
+			return nil, errNoData
+		}
+	}
+
+	out := data.Frames{}
+	for _, frame := range frames {
+		if nulls.DropEmptySeries || nulls.DropZeroSeries {
+			values, nonEmpty, kept := 0, 0, []*data.Field{}
+			for _, field := range frame.Fields {
+				if !field.Type().Numeric() {
+					kept = append(kept, field)
+					continue
+				}
+				values++
+				if !allNull(field) && !(nulls.DropZeroSeries && allNullOrZero(field)) {
+					nonEmpty++
+					kept = append(kept, field)
+				}
+			}
+			if values > 0 && nonEmpty == 0 {
+				// every value field was dropped, the series is empty
+				continue
+			}
+			frame.Fields = kept
+		}
+		if nulls.ReplaceWith != nil {
+			for _, field := range frame.Fields {
+				if err := replaceNulls(field, *nulls.ReplaceWith); err != nil {
+					return nil, err
+				}
+			}
+		}
+		out = append(out, frame)
+	}
+	return out, nil
+}
+
+func allNull(field *data.Field) bool {
+	if !field.Nullable() {
+		return field.Len() == 0
+	}
+	for i := 0; i < field.Len(); i++ {
+		if _, ok := field.ConcreteAt(i); ok {
+			return false
+		}
+	}
+	return true
+}
+
+// allNullOrZero reports whether every value of the numeric field is NULL or zero
+func allNullOrZero(field *data.Field) bool {
+	for i := 0; i < field.Len(); i++ {
+		if _, ok := field.ConcreteAt(i); !ok {
+			continue
+		}
+		if v, err := field.FloatAt(i); err != nil || v != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// replaceNulls sets the NULL values of nullable numeric fields to value, which
+// has to be a whole number in the range of integer fields
+func replaceNulls(field *data.Field, value float64) error {
+	if !field.Nullable() || !field.Type().Numeric() {
+		return nil
+	}
+	var v interface{}
+	lo, hi := math.Inf(-1), math.Inf(1)
+	switch field.Type().NonNullableType() {
+	case data.FieldTypeFloat64:
+		v = value
+	case data.FieldTypeFloat32:
+		v = float32(value)
+	case data.FieldTypeInt64:
+		v, lo, hi = int64(value), math.MinInt64, math.MaxInt64
+	case data.FieldTypeInt32:
+		v, lo, hi = int32(value), math.MinInt32, math.MaxInt32
+	case data.FieldTypeInt16:
+		v, lo, hi = int16(value), math.MinInt16, math.MaxInt16
+	case data.FieldTypeInt8:
+		v, lo, hi = int8(value), math.MinInt8, math.MaxInt8
+	case data.FieldTypeUint64:
+		v, lo, hi = uint64(value), 0, math.MaxUint64
+	case data.FieldTypeUint32:
+		v, lo, hi = uint32(value), 0, math.MaxUint32
+	case data.FieldTypeUint16:
+		v, lo, hi = uint16(value), 0, math.MaxUint16
+	case data.FieldTypeUint8:
+		v, lo, hi = uint8(value), 0, math.MaxUint8
+	default:
+		return fmt.Errorf("column %s: cannot replace NULL values of type %s", field.Name, field.Type())
+	}
+	if !math.IsInf(lo, 0) && (value != math.Trunc(value) || value < lo || value > hi) {
+		return fmt.Errorf("column %s: cannot replace NULL integers with %v", field.Name, value)
+	}
+	for i := 0; i < field.Len(); i++ {
+		if _, ok := field.ConcreteAt(i); !ok {
+			field.SetConcrete(i, v)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,122 @@
+package timestream
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/timestreamquery"
+	timestreamquerytypes "github.com/aws/aws-sdk-go-v2/service/timestreamquery/types"
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/grafana/timestream-datasource/pkg/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func float64Ptr(v float64) *float64 {
+	return &v
+}
+
+func nullsFrame() *data.Frame {
+	return data.NewFrame("",
+		data.NewField("time", nil, []time.Time{time.UnixMilli(1), time.UnixMilli(2)}),
+		data.NewField("a", data.Labels{"device": "d1"}, []*float64{float64Ptr(1), nil}),
+		data.NewField("b", data.Labels{"device": "d2"}, []*float64{nil, nil}),
+		data.NewField("c", data.Labels{"device": "d3"}, []*int64{nil, int64Ptr(3)}),
+	)
+}
+
+func TestApplyNullHandling_DropEmptySeries(t *testing.T) {
+	empty := data.NewFrame("",
+		data.NewField("time", nil, []time.Time{time.UnixMilli(1)}),
+		data.NewField("value", nil, []*float64{nil}),
+	)
+	frames, err := applyNullHandling(data.Frames{nullsFrame(), empty}, &models.NullHandling{DropEmptySeries: true})
+	require.NoError(t, err)
+	require.Len(t, frames, 1)
+	require.Len(t, frames[0].Fields, 3)
+	assert.Equal(t, "a", frames[0].Fields[1].Name)
+	assert.Equal(t, "c", frames[0].Fields[2].Name)
+}
+
+func TestApplyNullHandling_DropZeroSeries(t *testing.T) {
+	frame := nullsFrame()
+	frame.Fields = append(frame.Fields,
+		data.NewField("d", data.Labels{"device": "d4"}, []*float64{float64Ptr(0), nil}),
+		data.NewField("e", data.Labels{"device": "d5"}, []int64{0, 0}),
+		data.NewField("f", data.Labels{"device": "d6"}, []int64{0, 2}),
+	)
+	zeros := data.NewFrame("",
+		data.NewField("time", nil, []time.Time{time.UnixMilli(1)}),
+		data.NewField("value", nil, []float64{0}),
+	)
+	frames, err := applyNullHandling(data.Frames{frame, zeros}, &models.NullHandling{DropZeroSeries: true})
+	require.NoError(t, err)
+	require.Len(t, frames, 1)
+	var names []string
+	for _, field := range frames[0].Fields {
+		names = append(names, field.Name)
+	}
+	assert.Equal(t, []string{"time", "a", "c", "f"}, names)
+}
+
+func TestApplyNullHandling_ReplaceWith(t *testing.T) {
+	frames, err := applyNullHandling(data.Frames{nullsFrame()}, &models.NullHandling{ReplaceWith: float64Ptr(-1)})
+	require.NoError(t, err)
+	fields := frames[0].Fields
+	assert.Equal(t, -1.0, *fields[1].At(1).(*float64))
+	assert.Equal(t, -1.0, *fields[2].At(0).(*float64))
+	assert.Equal(t, int64(-1), *fields[3].At(0).(*int64))
+	assert.Equal(t, int64(3), *fields[3].At(1).(*int64))
+
+	// integers aren't truncated
+	_, err = applyNullHandling(data.Frames{nullsFrame()}, &models.NullHandling{ReplaceWith: float64Ptr(1.5)})
+	assert.ErrorContains(t, err, "column c: cannot replace NULL integers with 1.5")
+	dr := finishFrames(backend.DataResponse{Frames: data.Frames{nullsFrame()}}, models.QueryModel{Nulls: &models.NullHandling{ReplaceWith: float64Ptr(1.5)}})
+	require.Error(t, dr.Error)
+	assert.Equal(t, backend.ErrorSourcePlugin, dr.ErrorSource)
+}
+
+func TestApplyNullHandling_ErrorOnNoData(t *testing.T) {
+	_, err := applyNullHandling(data.Frames{data.NewFrame("", data.NewField("value", nil, []*float64{}))}, &models.NullHandling{ErrorOnNoData: true})
+	assert.ErrorIs(t, err, errNoData)
+
+	frames, err := applyNullHandling(data.Frames{nullsFrame()}, &models.NullHandling{ErrorOnNoData: true})
+	require.NoError(t, err)
+	assert.Len(t, frames, 1)
+}
+
+func TestExecuteQuery_NullHandlingPages(t *testing.T) {
+	output := valueOutput("v", [2]string{"2024-01-01 00:00:00.000000000", "1"}, [2]string{"2024-01-01 00:01:00.000000000", "2"})
+	output.Rows[1].Data[1] = timestreamquerytypes.Datum{NullValue: aws.Bool(true)}
+	ds := &timestreamDS{Client: &pagedTableClient{tableClient{outputs: map[string]*timestreamquery.QueryOutput{"db.a": output}}}}
+	dr := ds.ExecuteQuery(context.Background(), models.QueryModel{
+		RawQuery: "SELECT time, v FROM db.a WHERE time > ago(1h) AND measure_name = 'v'",
+		Format:   models.FormatOptionTable,
+		Nulls:    &models.NullHandling{ReplaceWith: float64Ptr(-1)},
+	})
+	require.NoError(t, dr.Error)
+	require.Len(t, dr.Frames, 1)
+	assert.Equal(t, []*float64{float64Ptr(1), float64Ptr(-1)}, fieldValues(dr.Frames[0].Fields[1]))
+	assert.Empty(t, dr.Frames[0].Meta.Custom.(*models.TimestreamCustomMeta).NextToken)
+}
+
+func TestExecuteQuery_DropEmptySeriesPages(t *testing.T) {
+	output := valueOutput("v", [2]string{"2024-01-01 00:00:00.000000000", "0"}, [2]string{"2024-01-01 00:01:00.000000000", "2"})
+	output.Rows[0].Data[1] = timestreamquerytypes.Datum{NullValue: aws.Bool(true)}
+	ds := &timestreamDS{Client: &pagedTableClient{tableClient{outputs: map[string]*timestreamquery.QueryOutput{"db.a": output}}}}
+	query := models.QueryModel{
+		RawQuery: "SELECT time, v FROM db.a WHERE time > ago(1h) AND measure_name = 'v'",
+		Format:   models.FormatOptionTable,
+		Nulls:    &models.NullHandling{DropEmptySeries: true, DropZeroSeries: true},
+	}
+
+	// the series is empty on the first page only
+	dr := ds.ExecuteQuery(context.Background(), query)
+	require.NoError(t, dr.Error)
+	require.Len(t, dr.Frames, 1)
+	require.Len(t, dr.Frames[0].Fields, 2)
+	assert.Equal(t, []*float64{nil, float64Ptr(2)}, fieldValues(dr.Frames[0].Fields[1]))
+}
@@ -3,8 +3,10 @@ package timestream
 import (
 	"fmt"
 	"strconv"
+	"strings"
 	"time"
 
+	"github.com/aws/aws-sdk-go-v2/aws"
 	timestreamquerytypes "github.com/aws/aws-sdk-go-v2/service/timestreamquery/types"
 	"github.com/grafana/grafana-plugin-sdk-go/data"
 )
@@ -105,6 +107,28 @@ func getFieldBuilder(t *timestreamquerytypes.Type) (*fieldBuilder, error) {
 	return nil, fmt.Errorf("unsupported column: %+v", t)
 }
 
+// columnTypeName spells the type of a column the way Timestream SQL does, e.g.
+// ARRAY(BIGINT) or ROW(host VARCHAR, cpu DOUBLE)
+func columnTypeName(t *timestreamquerytypes.Type) string {
+	switch {
+	case t == nil:
+		return ""
+	case t.ScalarType != "":
+		return string(t.ScalarType)
+	case t.TimeSeriesMeasureValueColumnInfo != nil:
+		return "TIMESERIES(" + columnTypeName(t.TimeSeriesMeasureValueColumnInfo.Type) + ")"
+	case t.ArrayColumnInfo != nil:
+		return "ARRAY(" + columnTypeName(t.ArrayColumnInfo.Type) + ")"
+	case t.RowColumnInfo != nil:
+		fields := make([]string, len(t.RowColumnInfo))
+		for i, column := range t.RowColumnInfo {
+			fields[i] = strings.TrimSpace(aws.ToString(column.Name) + " " + columnTypeName(column.Type))
+		}
+		return "ROW(" + strings.Join(fields, ", ") + ")"
+	}
+	return ""
+}
+
 func getArrayBuilder(column *timestreamquerytypes.ColumnInfo) (*fieldBuilder, error) {
 	elem, err := getFieldBuilder(column.Type)
 	if err != nil {
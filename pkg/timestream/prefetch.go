@@ -0,0 +1,131 @@
+package timestream
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/timestream-datasource/pkg/models"
+)
+
+const (
+	// Prefetched queries run without a request, this bounds each of them
+	prefetchTimeout = time.Minute
+	// Dashboards prefetched at the same time, the others wait in the queue
+	prefetchWorkers = 2
+	// Dashboards waiting to be prefetched, more are refused
+	prefetchQueueSize = 16
+)
+
+// prefetchQueries parses the queries of a dashboard the same way QueryData does,
+// keeping those without a fresh cached response
+func (ds *timestreamDS) prefetchQueries(req models.PrefetchRequest, now time.Time) ([]models.QueryModel, error) {
+	if ds.frames == nil {
+		return nil, fmt.Errorf("prefetch requires the result cache, set resultCacheSeconds")
+	}
+	var stale []models.QueryModel
+	for _, raw := range req.Queries {
+		query, err := ds.queryModel(backend.DataQuery{
+			JSON:          raw,
+			TimeRange:     backend.TimeRange{From: req.From, To: req.To},
+			Interval:      time.Duration(req.IntervalMs) * time.Millisecond,
+			MaxDataPoints: req.MaxDataPoints,
+		}, now)
+		if err != nil {
+			return nil, err
+		}
+		if query.QueryType == models.QueryTypeMerge || query.QueryType == models.QueryTypeMath {
+			// derived from the responses of the other queries
+			continue
+		}
+		if ds.frames.stale(*query, now) {
+			stale = append(stale, *query)
+		}
+	}
+	return stale, nil
+}
+
+// prefetcher prefetches the queries of dashboards on a few workers, so prefetches
+// queue up behind each other instead of competing with the queries of visible
+// panels. A nil prefetcher queues nothing.
+type prefetcher struct {
+	jobs chan prefetchJob
+	// ctx is canceled when the datasource is disposed
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+type prefetchJob struct {
+	pCtx    backend.PluginContext
+	queries []models.QueryModel
+}
+
+// startPrefetcher starts the workers prefetching the queued dashboards until the
+// prefetcher is stopped
+func (ds *timestreamDS) startPrefetcher() *prefetcher {
+	ctx, cancel := context.WithCancel(context.Background())
+	p := &prefetcher{jobs: make(chan prefetchJob, prefetchQueueSize), ctx: ctx, cancel: cancel}
+	for range prefetchWorkers {
+		go func() {
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case job := <-p.jobs:
+					ds.prefetch(ctx, job.pCtx, job.queries)
+				}
+			}
+		}()
+	}
+	return p
+}
+
+// enqueue queues the queries of a dashboard, it reports false when the queue is full
+func (p *prefetcher) enqueue(pCtx backend.PluginContext, queries []models.QueryModel) bool {
+	if p == nil {
+		return false
+	}
+	select {
+	case p.jobs <- prefetchJob{pCtx: pCtx, queries: queries}:
+		return true
+	default:
+		return false
+	}
+}
+
+// stop cancels the running prefetches and stops the workers
+func (p *prefetcher) stop() {
+	if p != nil {
+		p.cancel()
+	}
+}
+
+// prefetch runs the queries one at a time and caches their responses, until ctx is
+// canceled or the query budget is spent. They run as the user of pCtx and are
+// audited like the queries of panels.
+func (ds *timestreamDS) prefetch(ctx context.Context, pCtx backend.PluginContext, queries []models.QueryModel) {
+	for _, query := range queries {
+		if ctx.Err() != nil {
+			return
+		}
+		if !ds.frames.stale(query, time.Now()) {
+			continue
+		}
+		if !ds.budget.takeN(time.Now(), ds.queryCost(query)) {
+			backend.Logger.Debug("prefetch stopped, the query budget is spent")
+			return
+		}
+		queryCtx, cancel := context.WithTimeout(backend.WithPluginContext(ctx, pCtx), prefetchTimeout)
+		dr := ds.ExecuteQuery(queryCtx, query)
+		ds.auditQuery(queryCtx, "prefetch", query, dr)
+		cancel()
+		if dr.Error != nil {
+			backend.Logger.Debug("prefetch failed", "error", dr.Error)
+			if ctx.Err() != nil {
+				return
+			}
+		}
+		ds.frames.put(query, dr, time.Now())
+	}
+}
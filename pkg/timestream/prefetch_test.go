@@ -0,0 +1,116 @@
+package timestream
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/timestreamquery"
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/timestream-datasource/pkg/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPrefetch(t *testing.T) {
+	client := &fakeClient{output: &timestreamquery.QueryOutput{}}
+	sink := &fakeAuditSink{}
+	ds := &timestreamDS{Client: client, frames: newFrameCache(time.Minute), audit: newAuditLogger(sink, 100, time.Hour)}
+	now := time.Now()
+	req := models.PrefetchRequest{
+		Queries: []json.RawMessage{
+			[]byte(`{"rawQuery":"SELECT * FROM db.tbl WHERE $__timeFilter AND measure_name = 'cpu'"}`),
+			[]byte(`{"rawQuery":"SELECT * FROM db.tbl WHERE $__timeFilter AND measure_name = 'mem'"}`),
+		},
+		From:          now.Add(-time.Hour),
+		To:            now,
+		IntervalMs:    1000,
+		MaxDataPoints: 100,
+	}
+
+	queries, err := ds.prefetchQueries(req, now)
+	require.NoError(t, err)
+	require.Len(t, queries, 2)
+	ds.prefetch(context.Background(), backend.PluginContext{}, queries)
+	assert.Len(t, client.calls.runQuery, 2)
+
+	// the panels render from the cache, the prefetches and the cache hit are audited
+	_, err = ds.QueryData(context.Background(), &backend.QueryDataRequest{Queries: []backend.DataQuery{{
+		RefID:         "A",
+		JSON:          req.Queries[0],
+		TimeRange:     backend.TimeRange{From: req.From, To: req.To},
+		Interval:      time.Second,
+		MaxDataPoints: 100,
+	}}})
+	require.NoError(t, err)
+	assert.Len(t, client.calls.runQuery, 2)
+	ds.audit.close()
+	require.Equal(t, 3, sink.count())
+	assert.Equal(t, "prefetch", sink.batches[0][0].RefID)
+	assert.Equal(t, "A", sink.batches[0][2].RefID)
+
+	queries, err = ds.prefetchQueries(req, time.Now())
+	require.NoError(t, err)
+	assert.Empty(t, queries, "fresh responses are not prefetched again")
+
+	_, err = (&timestreamDS{Client: client}).prefetchQueries(req, now)
+	assert.ErrorContains(t, err, "resultCacheSeconds")
+}
+
+func TestPrefetch_Budget(t *testing.T) {
+	client := &fakeClient{output: &timestreamquery.QueryOutput{}}
+	// one query fits the burst of the budget
+	ds := &timestreamDS{Client: client, frames: newFrameCache(time.Minute), budget: newQueryBudget(1)}
+	queries := []models.QueryModel{
+		{RawQuery: "SELECT * FROM db.tbl WHERE time > ago(1h) AND measure_name = 'cpu'"},
+		{RawQuery: "SELECT * FROM db.tbl WHERE time > ago(1h) AND measure_name = 'mem'"},
+	}
+	ds.prefetch(context.Background(), backend.PluginContext{}, queries)
+	assert.Len(t, client.calls.runQuery, 1)
+	assert.False(t, ds.budget.take(time.Now()))
+}
+
+func TestPrefetcher(t *testing.T) {
+	client := &fakeClient{output: &timestreamquery.QueryOutput{}}
+	ds := &timestreamDS{Client: client, frames: newFrameCache(time.Minute)}
+	query := models.QueryModel{RawQuery: "SELECT * FROM db.tbl WHERE time > ago(1h) AND measure_name = 'cpu'"}
+
+	var stopped *prefetcher
+	assert.False(t, stopped.enqueue(backend.PluginContext{}, []models.QueryModel{query}))
+	stopped.stop()
+
+	// the queue is bounded while the workers are busy
+	p := &prefetcher{jobs: make(chan prefetchJob, prefetchQueueSize)}
+	for range prefetchQueueSize {
+		require.True(t, p.enqueue(backend.PluginContext{}, []models.QueryModel{query}))
+	}
+	assert.False(t, p.enqueue(backend.PluginContext{}, []models.QueryModel{query}))
+
+	// disposing the datasource cancels the prefetches
+	ds.prefetcher = ds.startPrefetcher()
+	ds.Dispose()
+	assert.Error(t, ds.prefetcher.ctx.Err())
+	ds.prefetch(ds.prefetcher.ctx, backend.PluginContext{}, []models.QueryModel{query})
+	assert.Empty(t, client.calls.runQuery)
+}
+
+func TestCallResource_Prefetch(t *testing.T) {
+	client := &fakeClient{output: &timestreamquery.QueryOutput{}}
+	ds := &timestreamDS{Client: client, frames: newFrameCache(time.Minute)}
+	ds.prefetcher = ds.startPrefetcher()
+	defer ds.prefetcher.stop()
+	sender := &fakeSender{}
+	err := ds.CallResource(context.Background(), &backend.CallResourceRequest{
+		Method: "POST",
+		Path:   "prefetch",
+		Body:   []byte(`{"queries":[{"rawQuery":"SELECT * FROM db.tbl WHERE $__timeFilter AND measure_name = 'cpu'"}],"from":"2024-01-01T00:00:00Z","to":"2024-01-01T01:00:00Z"}`),
+	}, sender)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"queued":1}`, string(sender.res.Body))
+	assert.Eventually(t, func() bool {
+		client.mu.Lock()
+		defer client.mu.Unlock()
+		return len(client.calls.runQuery) == 1
+	}, time.Second, 10*time.Millisecond)
+}
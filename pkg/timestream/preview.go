@@ -0,0 +1,79 @@
+package timestream
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/timestreamquery"
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/grafana/grafana-plugin-sdk-go/experimental/errorsource"
+	"github.com/grafana/timestream-datasource/pkg/models"
+)
+
+const (
+	// Previews only scan this far back
+	previewWindow = time.Hour
+	// Rows of a preview when the query sets no maxRows, and the most it may set
+	defaultPreviewRows = 100
+	maxPreviewRows     = 1000
+)
+
+// previewSQL selects the latest rows of the table within the preview window. It
+// is bounded by construction, so it isn't validated.
+func previewSQL(database, table, measure string, rows int64) string {
+	sql := fmt.Sprintf("SELECT * FROM %s.%s WHERE time > ago(%dm)",
+		quoteIdentifier(database), quoteIdentifier(table), int(previewWindow.Minutes()))
+	if measure != "" {
+		sql += " AND measure_name = " + quoteLiteral(measure)
+	}
+	return fmt.Sprintf("%s ORDER BY time DESC LIMIT %d", sql, rows)
+}
+
+// executePreview answers a preview query with the latest rows of the table, as a table
+func (ds *timestreamDS) executePreview(ctx context.Context, query models.QueryModel) backend.DataResponse {
+	database := valueOrDefault(query.Database, ds.Settings.DefaultDatabase)
+	table := valueOrDefault(query.Table, ds.Settings.DefaultTable)
+	if database == "" || table == "" {
+		return errorsource.Response(errorsource.DownstreamError(fmt.Errorf("preview requires a database and a table"), false))
+	}
+	rows := query.MaxRows
+	if rows <= 0 {
+		rows = defaultPreviewRows
+	}
+	rows = min(rows, maxPreviewRows)
+
+	sql := previewSQL(database, table, query.Measure, rows)
+	input := &timestreamquery.QueryInput{QueryString: aws.String(sql)}
+	output, err := ds.Client.Query(ctx, input)
+	// the LIMIT bounds the rows of all pages, but a page may arrive empty while
+	// the query still runs
+	for err == nil && output.NextToken != nil && int64(len(output.Rows)) < rows {
+		var page *timestreamquery.QueryOutput
+		page, err = ds.Client.Query(ctx, &timestreamquery.QueryInput{QueryString: input.QueryString, NextToken: output.NextToken})
+		if err == nil {
+			output.Rows = append(output.Rows, page.Rows...)
+			output.NextToken = page.NextToken
+		}
+	}
+	if err != nil {
+		return errorsource.Response(errorsource.DownstreamError(err, false))
+	}
+	output.NextToken = nil
+	query.Format = models.FormatOptionTable
+	dr := QueryResultToDataFrame(output, query)
+	if dr.Error != nil {
+		return dr
+	}
+	frame := dr.Frames[0]
+	frame.Meta.ExecutedQueryString = sql
+	if len(output.Rows) == 0 {
+		frame.AppendNotices(data.Notice{
+			Severity: data.NoticeSeverityWarning,
+			Text:     fmt.Sprintf("no data in %s.%s within the last %s", database, table, previewWindow),
+		})
+	}
+	return dr
+}
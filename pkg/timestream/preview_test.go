@@ -0,0 +1,96 @@
+package timestream
+
+import (
+	"context"
+	"strconv"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/timestreamquery"
+	timestreamquerytypes "github.com/aws/aws-sdk-go-v2/service/timestreamquery/types"
+	"github.com/grafana/timestream-datasource/pkg/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPreviewSQL(t *testing.T) {
+	assert.Equal(t, `SELECT * FROM "db"."metrics" WHERE time > ago(60m) ORDER BY time DESC LIMIT 100`, previewSQL("db", "metrics", "", 100))
+	assert.Equal(t, `SELECT * FROM "db"."metrics" WHERE time > ago(60m) AND measure_name = 'cpu' ORDER BY time DESC LIMIT 5`, previewSQL("db", "metrics", "cpu", 5))
+}
+
+func TestExecuteQuery_Preview(t *testing.T) {
+	client := &fakeClient{output: &timestreamquery.QueryOutput{
+		ColumnInfo: []timestreamquerytypes.ColumnInfo{
+			{Name: aws.String("device"), Type: &timestreamquerytypes.Type{ScalarType: timestreamquerytypes.ScalarTypeVarchar}},
+		},
+		Rows: []timestreamquerytypes.Row{{Data: []timestreamquerytypes.Datum{{ScalarValue: aws.String("d1")}}}},
+	}}
+	ds := &timestreamDS{Client: client, Settings: models.DatasourceSettings{DefaultDatabase: "db"}}
+
+	dr := ds.ExecuteQuery(context.Background(), models.QueryModel{QueryType: models.QueryTypePreview, Table: "metrics", MaxRows: 5000})
+	require.NoError(t, dr.Error)
+	require.Len(t, client.calls.runQuery, 1)
+	assert.Equal(t, `SELECT * FROM "db"."metrics" WHERE time > ago(60m) ORDER BY time DESC LIMIT 1000`, *client.calls.runQuery[0].QueryString)
+	assert.Equal(t, 1, dr.Frames[0].Rows())
+	assert.Equal(t, *client.calls.runQuery[0].QueryString, dr.Frames[0].Meta.ExecutedQueryString)
+	assert.Empty(t, dr.Frames[0].Meta.Custom.(*models.TimestreamCustomMeta).NextToken)
+
+	client.output = &timestreamquery.QueryOutput{}
+	dr = ds.ExecuteQuery(context.Background(), models.QueryModel{QueryType: models.QueryTypePreview, Table: "metrics"})
+	require.NoError(t, dr.Error)
+	require.Len(t, dr.Frames[0].Meta.Notices, 1)
+	assert.Contains(t, dr.Frames[0].Meta.Notices[0].Text, "no data in db.metrics")
+
+	dr = ds.ExecuteQuery(context.Background(), models.QueryModel{QueryType: models.QueryTypePreview})
+	assert.ErrorContains(t, dr.Error, "requires a database and a table")
+}
+
+// previewPagesClient returns the pages in order, the token of a page is the index of the next one
+type previewPagesClient struct {
+	fakeClient
+	pages []*timestreamquery.QueryOutput
+}
+
+func (c *previewPagesClient) Query(_ context.Context, input *timestreamquery.QueryInput, _ ...func(*timestreamquery.Options)) (*timestreamquery.QueryOutput, error) {
+	c.calls.runQuery = append(c.calls.runQuery, input)
+	i := 0
+	if input.NextToken != nil {
+		i, _ = strconv.Atoi(*input.NextToken)
+	}
+	page := *c.pages[i]
+	if i+1 < len(c.pages) {
+		page.NextToken = aws.String(strconv.Itoa(i + 1))
+	}
+	return &page, nil
+}
+
+func TestExecuteQuery_PreviewPages(t *testing.T) {
+	columns := []timestreamquerytypes.ColumnInfo{
+		{Name: aws.String("device"), Type: &timestreamquerytypes.Type{ScalarType: timestreamquerytypes.ScalarTypeVarchar}},
+	}
+	row := func(v string) timestreamquerytypes.Row {
+		return timestreamquerytypes.Row{Data: []timestreamquerytypes.Datum{{ScalarValue: aws.String(v)}}}
+	}
+	client := &previewPagesClient{pages: []*timestreamquery.QueryOutput{
+		{ColumnInfo: columns},
+		{ColumnInfo: columns, Rows: []timestreamquerytypes.Row{row("d1")}},
+		{ColumnInfo: columns, Rows: []timestreamquerytypes.Row{row("d2")}},
+		{ColumnInfo: columns, Rows: []timestreamquerytypes.Row{row("d3")}},
+	}}
+	ds := &timestreamDS{Client: client, Settings: models.DatasourceSettings{DefaultDatabase: "db"}}
+
+	dr := ds.ExecuteQuery(context.Background(), models.QueryModel{QueryType: models.QueryTypePreview, Table: "metrics", MaxRows: 2})
+	require.NoError(t, dr.Error)
+	assert.Equal(t, 2, dr.Frames[0].Rows())
+	assert.Empty(t, dr.Frames[0].Meta.Notices)
+	assert.Empty(t, dr.Frames[0].Meta.Custom.(*models.TimestreamCustomMeta).NextToken)
+	assert.Len(t, client.calls.runQuery, 3)
+
+	client.pages = []*timestreamquery.QueryOutput{{ColumnInfo: columns}, {ColumnInfo: columns}}
+	client.calls.runQuery = nil
+	dr = ds.ExecuteQuery(context.Background(), models.QueryModel{QueryType: models.QueryTypePreview, Table: "metrics"})
+	require.NoError(t, dr.Error)
+	assert.Len(t, client.calls.runQuery, 2)
+	require.Len(t, dr.Frames[0].Meta.Notices, 1)
+	assert.Contains(t, dr.Frames[0].Meta.Notices[0].Text, "no data")
+}
@@ -0,0 +1,85 @@
+package timestream
+
+import (
+	"fmt"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/grafana/timestream-datasource/pkg/models"
+	"github.com/grafana/timestream-datasource/pkg/timestream/validator"
+)
+
+// queryChecksDocs documents the checks queries are rejected by
+const queryChecksDocs = "https://github.com/grafana/timestream-datasource/blob/main/src/README.md#query-checks"
+
+// Codes of the rejections that aren't validator rules, rules are coded by ruleCode
+const (
+	codeOptions       = "validator.options"
+	codeProfile       = "validator.profile"
+	codeProfileAccess = "validator.profile-access"
+)
+
+// problemTitles are the titles of the rejections, by problem code
+var problemTitles = map[string]string{
+	ruleCode(validator.RuleWhere):                  "Query has no WHERE clause",
+	ruleCode(validator.RuleTime):                   "Query has no time filter",
+	ruleCode(validator.RuleBoundedTime):            "Query time filter has no upper bound",
+	ruleCode(validator.RuleTimeWindow):             "Query time range is too long",
+	ruleCode(validator.RuleMeasure):                "Query has no measure_name filter",
+	ruleCode(validator.RuleTenant):                 "Query has no tenant filter",
+	ruleCode(validator.RuleNegatedDimensionFilter): "Query only has negated dimension filters",
+	ruleCode(validator.RuleMeasurePattern):         "Query measure_name pattern matches too much",
+	ruleCode(validator.RuleRequiredColumn):         "Query lacks a required column filter",
+	ruleCode(validator.RuleUnknownDimension):       "Query references an unknown dimension",
+	codeOptions:                                    "Invalid validator options",
+	codeProfile:                                    "Unknown validator profile",
+	codeProfileAccess:                              "Validator profile not allowed for the role",
+}
+
+// ruleCode is the problem code of a validator rule
+func ruleCode(rule validator.Rule) string {
+	return "validator." + string(rule)
+}
+
+// newProblem describes a rejection without spans
+func newProblem(code string, status backend.Status, detail string) *models.Problem {
+	return &models.Problem{Code: code, Title: problemTitles[code], Detail: detail, Status: int(status), Docs: queryChecksDocs}
+}
+
+// validationProblem describes the errors of a rejected query, the first one is
+// the detail and every error adds a span
+func validationProblem(issues []validator.Issue) *models.Problem {
+	errs := validator.Errors(issues)
+	if len(errs) == 0 {
+		return nil
+	}
+	code := codeOptions
+	if rule := errs[0].Rule; rule != "" {
+		code = ruleCode(rule)
+	}
+	problem := newProblem(code, backend.StatusBadRequest, errs[0].Reason)
+	problem.Fix = errs[0].Fix
+	problem.IssueCode = string(errs[0].Code)
+	for _, issue := range errs {
+		if issue.End <= issue.Start {
+			continue
+		}
+		problem.Spans = append(problem.Spans, models.ProblemSpan{Start: issue.Start, End: issue.End, Snippet: issue.Snippet, Detail: issue.Reason, IssueCode: string(issue.Code)})
+	}
+	return problem
+}
+
+// problemResponse is the error response of a query rejected by the validator
+func problemResponse(problem *models.Problem, executed string) backend.DataResponse {
+	return rejectedResponse(problem, executed, fmt.Sprintf("reasonable query check failed: %s", problem.Detail))
+}
+
+// rejectedResponse is the error response of a rejected query, the problem is set
+// on the custom metadata of its frame
+func rejectedResponse(problem *models.Problem, executed string, message string) backend.DataResponse {
+	dr := backend.ErrDataResponse(backend.Status(problem.Status), message)
+	frame := data.NewFrame("")
+	frame.SetMeta(&data.FrameMeta{ExecutedQueryString: executed, Custom: &models.TimestreamCustomMeta{Problem: problem}})
+	dr.Frames = data.Frames{frame}
+	return dr
+}
@@ -0,0 +1,65 @@
+package timestream
+
+import (
+	"context"
+	"testing"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/timestream-datasource/pkg/models"
+	"github.com/grafana/timestream-datasource/pkg/timestream/validator"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidationProblem(t *testing.T) {
+	assert.Nil(t, validationProblem(nil))
+
+	problem := validationProblem([]validator.Issue{
+		{Reason: "no time filter", Snippet: "SELECT *", Start: 0, End: 8, Rule: validator.RuleTime, Code: validator.CodeMissingTimePredicate, Severity: validator.SeverityError},
+		{Reason: "no measure filter", Start: 0, End: 8, Rule: validator.RuleMeasure, Severity: validator.SeverityWarning},
+	})
+	require.NotNil(t, problem)
+	assert.Equal(t, "validator.time", problem.Code)
+	assert.Equal(t, "Query has no time filter", problem.Title)
+	assert.Equal(t, "no time filter", problem.Detail)
+	assert.Equal(t, 400, problem.Status)
+	assert.Equal(t, queryChecksDocs, problem.Docs)
+	assert.Equal(t, "missing-time-predicate", problem.IssueCode)
+	assert.Equal(t, []models.ProblemSpan{{Start: 0, End: 8, Snippet: "SELECT *", Detail: "no time filter", IssueCode: "missing-time-predicate"}}, problem.Spans)
+
+	assert.Empty(t, problem.Fix)
+
+	problem = validationProblem([]validator.Issue{{Reason: "GROUP BY bins time but WHERE doesn't restrict it", Fix: "add AND $__timeFilter", Rule: validator.RuleTime, Severity: validator.SeverityError}})
+	assert.Equal(t, "add AND $__timeFilter", problem.Fix)
+
+	problem = validationProblem([]validator.Issue{{Reason: "unknown rule", Severity: validator.SeverityError}})
+	assert.Equal(t, "validator.options", problem.Code)
+	assert.Empty(t, problem.Spans)
+}
+
+func TestExecuteQuery_Problem(t *testing.T) {
+	client := &fakeClient{}
+	ds := &timestreamDS{Client: client}
+	dr := ds.ExecuteQuery(context.Background(), models.QueryModel{RawQuery: "SELECT * FROM db.tbl"})
+
+	require.Error(t, dr.Error)
+	assert.Contains(t, dr.Error.Error(), "reasonable query check failed")
+	assert.Equal(t, backend.StatusBadRequest, dr.Status)
+	require.Len(t, dr.Frames, 1)
+	meta, ok := dr.Frames[0].Meta.Custom.(*models.TimestreamCustomMeta)
+	require.True(t, ok)
+	require.NotNil(t, meta.Problem)
+	assert.Equal(t, "validator.where", meta.Problem.Code)
+	require.Len(t, meta.Problem.Spans, 1)
+	assert.Equal(t, "SELECT * FROM db.tbl", dr.Frames[0].Meta.ExecutedQueryString[meta.Problem.Spans[0].Start:meta.Problem.Spans[0].End])
+	assert.Zero(t, client.calls.runQuery)
+}
+
+func TestProblemTitles(t *testing.T) {
+	for _, rule := range validator.Rules() {
+		assert.NotEmpty(t, problemTitles[ruleCode(rule)], rule)
+	}
+	for _, code := range []string{codeOptions, codeProfile, codeProfileAccess} {
+		assert.NotEmpty(t, problemTitles[code], code)
+	}
+}
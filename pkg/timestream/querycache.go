@@ -0,0 +1,146 @@
+package timestream
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/timestream-datasource/pkg/models"
+)
+
+// Most queries kept by the result cache, the oldest are dropped first
+const maxCachedResults = 500
+
+// frameCache keeps the responses of dashboard queries for the configured TTL. A
+// query matches a cached response when its time range is shifted by less than the
+// TTL, so relative ranges like "last 6 hours" still hit while time moves on. A nil
+// cache keeps nothing.
+type frameCache struct {
+	ttl time.Duration
+	// staleFor keeps responses past their TTL, served when the query budget is spent
+	staleFor time.Duration
+
+	mu      sync.Mutex
+	entries map[string]cachedFrames
+}
+
+type cachedFrames struct {
+	timeRange backend.TimeRange
+	response  backend.DataResponse
+	stored    time.Time
+}
+
+func newFrameCache(ttl time.Duration) *frameCache {
+	if ttl <= 0 {
+		return nil
+	}
+	return &frameCache{ttl: ttl, entries: map[string]cachedFrames{}}
+}
+
+// frameCacheKey identifies a query apart from its time range and the staleness it accepts
+func frameCacheKey(query models.QueryModel) string {
+	query.MaxStalenessSeconds = 0
+	options, _ := json.Marshal(query)
+	return fmt.Sprintf("%s|%d|%d", options, query.Interval.Milliseconds(), query.MaxDataPoints)
+}
+
+// cacheable reports whether the response is the complete, successful result of the query
+func cacheable(query models.QueryModel, dr backend.DataResponse) bool {
+	if query.FromAlert || query.NextToken != "" || dr.Error != nil || len(dr.Frames) == 0 {
+		return false
+	}
+	if meta := dr.Frames[0].Meta; meta != nil {
+		if custom, ok := meta.Custom.(*models.TimestreamCustomMeta); ok && (custom.NextToken != "" || custom.TruncatedByTimeout) {
+			return false
+		}
+	}
+	return true
+}
+
+// lookup returns the cached response of the query stored less than maxAge ago
+func (c *frameCache) lookup(query models.QueryModel, now time.Time, maxAge time.Duration) (cachedFrames, bool) {
+	if c == nil || query.FromAlert {
+		return cachedFrames{}, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[frameCacheKey(query)]
+	if !ok || now.Sub(entry.stored) >= maxAge ||
+		absDuration(query.TimeRange.From.Sub(entry.timeRange.From)) >= maxAge ||
+		absDuration(query.TimeRange.To.Sub(entry.timeRange.To)) >= maxAge {
+		return cachedFrames{}, false
+	}
+	return entry, true
+}
+
+// maxAge is how old a cached response of the query may be served, the TTL unless
+// the query accepts less staleness
+func (c *frameCache) maxAge(query models.QueryModel) time.Duration {
+	if staleness := time.Duration(query.MaxStalenessSeconds) * time.Second; staleness > 0 && staleness < c.ttl {
+		return staleness
+	}
+	return c.ttl
+}
+
+// get returns the cached response of the query
+func (c *frameCache) get(query models.QueryModel, now time.Time) (backend.DataResponse, bool) {
+	if c == nil {
+		return backend.DataResponse{}, false
+	}
+	entry, ok := c.lookup(query, now, c.maxAge(query))
+	return entry.response, ok
+}
+
+// getStale returns the cached response of the query past its TTL, but within
+// the stale period, and when it was stored
+func (c *frameCache) getStale(query models.QueryModel, now time.Time) (backend.DataResponse, time.Time, bool) {
+	if c == nil || c.staleFor <= 0 {
+		return backend.DataResponse{}, time.Time{}, false
+	}
+	entry, ok := c.lookup(query, now, c.ttl+c.staleFor)
+	return entry.response, entry.stored, ok
+}
+
+// stale reports whether the query has no cached response, or one past half the
+// age it may be served at
+func (c *frameCache) stale(query models.QueryModel, now time.Time) bool {
+	if c == nil {
+		return true
+	}
+	maxAge := c.maxAge(query)
+	entry, ok := c.lookup(query, now, maxAge)
+	return !ok || now.Sub(entry.stored) >= maxAge/2
+}
+
+func (c *frameCache) put(query models.QueryModel, dr backend.DataResponse, now time.Time) {
+	if c == nil || !cacheable(query, dr) {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for k, entry := range c.entries {
+		if now.Sub(entry.stored) >= c.ttl+c.staleFor {
+			delete(c.entries, k)
+		}
+	}
+	key := frameCacheKey(query)
+	if _, ok := c.entries[key]; !ok && len(c.entries) >= maxCachedResults {
+		oldest := ""
+		for k, entry := range c.entries {
+			if oldest == "" || entry.stored.Before(c.entries[oldest].stored) {
+				oldest = k
+			}
+		}
+		delete(c.entries, oldest)
+	}
+	c.entries[key] = cachedFrames{timeRange: query.TimeRange, response: dr, stored: now}
+}
+
+func absDuration(d time.Duration) time.Duration {
+	if d < 0 {
+		return -d
+	}
+	return d
+}
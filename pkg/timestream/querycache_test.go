@@ -0,0 +1,104 @@
+package timestream
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/timestreamquery"
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/grafana/timestream-datasource/pkg/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFrameCache(t *testing.T) {
+	now := time.Now()
+	cache := newFrameCache(time.Minute)
+	query := models.QueryModel{
+		RawQuery:  "SELECT 1",
+		TimeRange: backend.TimeRange{From: now.Add(-time.Hour), To: now},
+		Interval:  time.Second,
+	}
+	dr := backend.DataResponse{Frames: data.Frames{data.NewFrame("a")}}
+	cache.put(query, dr, now)
+
+	cached, ok := cache.get(query, now.Add(10*time.Second))
+	require.True(t, ok)
+	assert.Equal(t, "a", cached.Frames[0].Name)
+
+	// relative ranges move on
+	moved := query
+	moved.TimeRange = backend.TimeRange{From: query.TimeRange.From.Add(30 * time.Second), To: query.TimeRange.To.Add(30 * time.Second)}
+	_, ok = cache.get(moved, now.Add(30*time.Second))
+	assert.True(t, ok)
+	assert.False(t, cache.stale(moved, now.Add(20*time.Second)))
+	assert.True(t, cache.stale(moved, now.Add(30*time.Second)), "past half the TTL")
+
+	_, ok = cache.get(query, now.Add(time.Minute))
+	assert.False(t, ok, "expired")
+	moved.TimeRange.From = query.TimeRange.From.Add(-time.Hour)
+	_, ok = cache.get(moved, now)
+	assert.False(t, ok, "other range")
+	other := query
+	other.Interval = time.Minute
+	_, ok = cache.get(other, now)
+	assert.False(t, ok, "other interval")
+	other = query
+	other.FromAlert = true
+	_, ok = cache.get(other, now)
+	assert.False(t, ok, "alerts always query")
+
+	failed := query
+	failed.RawQuery = "SELECT 2"
+	cache.put(failed, backend.DataResponse{Error: errors.New("boom")}, now)
+	_, ok = cache.get(failed, now)
+	assert.False(t, ok, "errors are not cached")
+
+	var nilCache *frameCache
+	nilCache.put(query, dr, now)
+	_, ok = nilCache.get(query, now)
+	assert.False(t, ok)
+	assert.Nil(t, newFrameCache(0))
+}
+
+func TestFrameCache_MaxStaleness(t *testing.T) {
+	now := time.Now()
+	cache := newFrameCache(time.Minute)
+	query := models.QueryModel{RawQuery: "SELECT 1", TimeRange: backend.TimeRange{From: now.Add(-time.Hour), To: now}}
+	cache.put(query, backend.DataResponse{Frames: data.Frames{data.NewFrame("a")}}, now)
+
+	fresh := query
+	fresh.MaxStalenessSeconds = 10
+	_, ok := cache.get(fresh, now.Add(5*time.Second))
+	assert.True(t, ok, "the staleness doesn't change the key")
+	assert.True(t, cache.stale(fresh, now.Add(5*time.Second)))
+	_, ok = cache.get(fresh, now.Add(10*time.Second))
+	assert.False(t, ok)
+	_, ok = cache.get(query, now.Add(10*time.Second))
+	assert.True(t, ok)
+
+	// the TTL bounds the staleness
+	fresh.MaxStalenessSeconds = 600
+	_, ok = cache.get(fresh, now.Add(time.Minute))
+	assert.False(t, ok)
+}
+
+func TestQueryData_ResultCache(t *testing.T) {
+	client := &fakeClient{output: &timestreamquery.QueryOutput{}}
+	ds := &timestreamDS{Client: client, frames: newFrameCache(time.Minute)}
+	req := &backend.QueryDataRequest{Queries: []backend.DataQuery{{
+		RefID:     "A",
+		JSON:      []byte(`{"rawQuery":"SELECT * FROM db.tbl WHERE $__timeFilter AND measure_name = 'cpu'"}`),
+		TimeRange: backend.TimeRange{From: time.Now().Add(-time.Hour), To: time.Now()},
+	}}}
+
+	for range 2 {
+		res, err := ds.QueryData(context.Background(), req)
+		require.NoError(t, err)
+		require.NoError(t, res.Responses["A"].Error)
+	}
+	assert.Len(t, client.calls.runQuery, 1)
+}
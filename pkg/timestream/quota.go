@@ -0,0 +1,115 @@
+package timestream
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	timestreamquerytypes "github.com/aws/aws-sdk-go-v2/service/timestreamquery/types"
+	"github.com/aws/smithy-go"
+)
+
+// QuotaKind names the Timestream quota that rejected a request
+type QuotaKind string
+
+const (
+	QuotaQueryTPS          QuotaKind = "query-tps"
+	QuotaConcurrentQueries QuotaKind = "concurrent-queries"
+	QuotaBytesScanned      QuotaKind = "bytes-scanned"
+	QuotaUnknown           QuotaKind = "unknown"
+)
+
+// Suggested back off when the service does not provide one
+var defaultRetryAfter = map[QuotaKind]time.Duration{
+	QuotaQueryTPS:          time.Second,
+	QuotaConcurrentQueries: 5 * time.Second,
+	QuotaUnknown:           2 * time.Second,
+}
+
+// Retrying a page is only worth it for short waits, longer ones are left to the caller
+const (
+	maxPageRetryAfter = 5 * time.Second
+	maxPageRetries    = 3
+)
+
+// QuotaError is a request rejected by a Timestream quota.
+// A zero RetryAfter means retrying the same request will not help.
+type QuotaError struct {
+	Quota      QuotaKind
+	RetryAfter time.Duration
+	Err        error
+}
+
+func (e *QuotaError) Error() string {
+	msg := fmt.Sprintf("timestream quota exceeded (%s)", e.Quota)
+	if e.RetryAfter > 0 {
+		msg += fmt.Sprintf(", retry after %s", e.RetryAfter)
+	}
+	return msg + ": " + e.Err.Error()
+}
+
+func (e *QuotaError) Unwrap() error {
+	return e.Err
+}
+
+var retryAfterPattern = regexp.MustCompile(`(?i)retry after (\d+) ?(ms|milliseconds?|s|seconds?)`)
+
+// asQuotaError classifies quota and throttling errors, returns nil for any other error
+func asQuotaError(err error) *QuotaError {
+	if err == nil {
+		return nil
+	}
+	var quotaErr *QuotaError
+	if errors.As(err, &quotaErr) {
+		return quotaErr
+	}
+
+	message := strings.ToLower(err.Error())
+	kind := QuotaKind("")
+	var throttling *timestreamquerytypes.ThrottlingException
+	var exceeded *timestreamquerytypes.ServiceQuotaExceededException
+	var apiErr smithy.APIError
+	switch {
+	case strings.Contains(message, "bytes") && (strings.Contains(message, "exceed") || strings.Contains(message, "limit")):
+		kind = QuotaBytesScanned
+	case errors.As(err, &throttling), errors.As(err, &exceeded),
+		errors.As(err, &apiErr) && (apiErr.ErrorCode() == "ThrottlingException" || apiErr.ErrorCode() == "TooManyRequestsException"):
+		kind = QuotaQueryTPS
+		if strings.Contains(message, "concurren") {
+			kind = QuotaConcurrentQueries
+		} else if exceeded != nil {
+			kind = QuotaUnknown
+		}
+	default:
+		return nil
+	}
+
+	retryAfter := defaultRetryAfter[kind]
+	if m := retryAfterPattern.FindStringSubmatch(message); m != nil {
+		n, _ := strconv.Atoi(m[1])
+		retryAfter = time.Duration(n) * time.Second
+		if strings.HasPrefix(m[2], "m") {
+			retryAfter = time.Duration(n) * time.Millisecond
+		}
+	}
+	return &QuotaError{Quota: kind, RetryAfter: retryAfter, Err: err}
+}
+
+// waitForRetry sleeps for the suggested back off of err, if it is a short lived quota error.
+// It returns false when the request should not be retried.
+func waitForRetry(ctx context.Context, err error) bool {
+	quotaErr := asQuotaError(err)
+	if quotaErr == nil || quotaErr.RetryAfter <= 0 || quotaErr.RetryAfter > maxPageRetryAfter {
+		return false
+	}
+	select {
+	case <-ctx.Done():
+		return false
+	case <-time.After(quotaErr.RetryAfter):
+		return true
+	}
+}
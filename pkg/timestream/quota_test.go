@@ -0,0 +1,71 @@
+package timestream
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	timestreamquerytypes "github.com/aws/aws-sdk-go-v2/service/timestreamquery/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAsQuotaError(t *testing.T) {
+	tests := []struct {
+		name       string
+		err        error
+		quota      QuotaKind
+		retryAfter time.Duration
+	}{
+		{
+			name:       "rate exceeded",
+			err:        &timestreamquerytypes.ThrottlingException{Message: aws.String("Rate exceeded")},
+			quota:      QuotaQueryTPS,
+			retryAfter: time.Second,
+		},
+		{
+			name:       "concurrency",
+			err:        fmt.Errorf("operation error: %w", &timestreamquerytypes.ThrottlingException{Message: aws.String("Query concurrency limit exceeded, retry after 3 seconds")}),
+			quota:      QuotaConcurrentQueries,
+			retryAfter: 3 * time.Second,
+		},
+		{
+			name:  "bytes scanned",
+			err:   &timestreamquerytypes.QueryExecutionException{Message: aws.String("Query exceeded the maximum bytes scanned limit")},
+			quota: QuotaBytesScanned,
+		},
+		{
+			name:       "service quota",
+			err:        &timestreamquerytypes.ServiceQuotaExceededException{Message: aws.String("quota")},
+			quota:      QuotaUnknown,
+			retryAfter: 2 * time.Second,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			quotaErr := asQuotaError(tt.err)
+			require.NotNil(t, quotaErr)
+			assert.Equal(t, tt.quota, quotaErr.Quota)
+			assert.Equal(t, tt.retryAfter, quotaErr.RetryAfter)
+			assert.ErrorIs(t, quotaErr, tt.err)
+		})
+	}
+
+	assert.Nil(t, asQuotaError(nil))
+	assert.Nil(t, asQuotaError(errors.New("syntax error")))
+}
+
+func TestWaitForRetry(t *testing.T) {
+	ctx := context.Background()
+	assert.False(t, waitForRetry(ctx, errors.New("syntax error")))
+	assert.False(t, waitForRetry(ctx, &QuotaError{Quota: QuotaBytesScanned, Err: errors.New("bytes")}))
+	assert.False(t, waitForRetry(ctx, &QuotaError{Quota: QuotaQueryTPS, RetryAfter: time.Minute, Err: errors.New("slow down")}))
+	assert.True(t, waitForRetry(ctx, &QuotaError{Quota: QuotaQueryTPS, RetryAfter: time.Millisecond, Err: errors.New("slow down")}))
+
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	assert.False(t, waitForRetry(cancelled, &QuotaError{Quota: QuotaQueryTPS, RetryAfter: time.Second, Err: errors.New("slow down")}))
+}
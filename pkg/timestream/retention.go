@@ -0,0 +1,58 @@
+package timestream
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/timestreamwrite"
+	"github.com/grafana/timestream-datasource/pkg/models"
+)
+
+// parseRetentionPath returns the database and table of a tables/{db}/{table}/retention path
+func parseRetentionPath(path string) (string, string, bool) {
+	parts := strings.Split(path, "/")
+	if len(parts) != 4 || parts[0] != "tables" || parts[3] != "retention" {
+		return "", "", false
+	}
+	database, err := url.PathUnescape(parts[1])
+	if err != nil || database == "" {
+		return "", "", false
+	}
+	table, err := url.PathUnescape(parts[2])
+	if err != nil || table == "" {
+		return "", "", false
+	}
+	return database, table, true
+}
+
+// tableRetention describes the queryable window of a table. Records older than the
+// magnetic store retention are deleted, so the earliest data point is approximated
+// from the retention and the table creation.
+func tableRetention(ctx context.Context, client WriteClient, database, table string, now time.Time) (models.TableRetention, error) {
+	out, err := client.DescribeTable(ctx, &timestreamwrite.DescribeTableInput{
+		DatabaseName: aws.String(database),
+		TableName:    aws.String(table),
+	})
+	if err != nil {
+		return models.TableRetention{}, err
+	}
+	if out.Table == nil || out.Table.RetentionProperties == nil {
+		return models.TableRetention{}, fmt.Errorf("no retention properties for %s.%s", database, table)
+	}
+	props := out.Table.RetentionProperties
+	r := models.TableRetention{
+		Database:          database,
+		Table:             table,
+		MemoryStoreHours:  aws.ToInt64(props.MemoryStoreRetentionPeriodInHours),
+		MagneticStoreDays: aws.ToInt64(props.MagneticStoreRetentionPeriodInDays),
+	}
+	r.Earliest = now.UTC().AddDate(0, 0, -int(r.MagneticStoreDays))
+	if created := aws.ToTime(out.Table.CreationTime); created.After(r.Earliest) {
+		r.Earliest = created.UTC()
+	}
+	return r, nil
+}
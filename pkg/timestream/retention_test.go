@@ -0,0 +1,72 @@
+package timestream
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	timestreamwritetypes "github.com/aws/aws-sdk-go-v2/service/timestreamwrite/types"
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/timestream-datasource/pkg/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseRetentionPath(t *testing.T) {
+	database, table, ok := parseRetentionPath("tables/db/my%20table/retention")
+	assert.True(t, ok)
+	assert.Equal(t, "db", database)
+	assert.Equal(t, "my table", table)
+
+	for _, path := range []string{"tables", "tables/db/retention", "tables//tbl/retention", "tables/db/tbl/measures"} {
+		_, _, ok := parseRetentionPath(path)
+		assert.False(t, ok, path)
+	}
+}
+
+func TestTableRetention(t *testing.T) {
+	now := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	writer := &fakeWriter{table: &timestreamwritetypes.Table{
+		CreationTime: aws.Time(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)),
+		RetentionProperties: &timestreamwritetypes.RetentionProperties{
+			MemoryStoreRetentionPeriodInHours:  aws.Int64(24),
+			MagneticStoreRetentionPeriodInDays: aws.Int64(365),
+		},
+	}}
+
+	r, err := tableRetention(context.Background(), writer, "db", "tbl", now)
+	require.NoError(t, err)
+	assert.Equal(t, int64(24), r.MemoryStoreHours)
+	assert.Equal(t, int64(365), r.MagneticStoreDays)
+	assert.Equal(t, now.AddDate(0, 0, -365), r.Earliest)
+
+	// tables younger than the retention have data since their creation
+	writer.table.CreationTime = aws.Time(time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC))
+	r, err = tableRetention(context.Background(), writer, "db", "tbl", now)
+	require.NoError(t, err)
+	assert.Equal(t, time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC), r.Earliest)
+
+	writer.table.RetentionProperties = nil
+	_, err = tableRetention(context.Background(), writer, "db", "tbl", now)
+	assert.Error(t, err)
+}
+
+func TestCallResource_Retention(t *testing.T) {
+	ds := &timestreamDS{Writer: &fakeWriter{table: &timestreamwritetypes.Table{
+		RetentionProperties: &timestreamwritetypes.RetentionProperties{
+			MemoryStoreRetentionPeriodInHours:  aws.Int64(12),
+			MagneticStoreRetentionPeriodInDays: aws.Int64(30),
+		},
+	}}}
+	sender := &fakeSender{}
+	err := ds.CallResource(context.Background(), &backend.CallResourceRequest{Path: "tables/db/tbl/retention"}, sender)
+	require.NoError(t, err)
+
+	r := models.TableRetention{}
+	require.NoError(t, json.Unmarshal(sender.res.Body, &r))
+	assert.Equal(t, "tbl", r.Table)
+	assert.Equal(t, int64(12), r.MemoryStoreHours)
+	assert.Equal(t, int64(30), r.MagneticStoreDays)
+}
@@ -0,0 +1,101 @@
+package timestream
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/backend/tracing"
+	"github.com/grafana/grafana-plugin-sdk-go/experimental/errorsource"
+	"github.com/grafana/timestream-datasource/pkg/models"
+	"github.com/grafana/timestream-datasource/pkg/timestream/validator"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// rewriteStage is a step turning the query of a panel into the SQL sent to
+// Timestream. Stages see the output of the previous stage and return the SQL
+// unchanged when they don't apply to the query.
+type rewriteStage struct {
+	name string
+	// required stages can't be disabled
+	required bool
+	apply    func(sql string, query models.QueryModel, settings models.DatasourceSettings) (string, error)
+}
+
+// rewriteStages run in this order: table hints regenerate builder queries, the
+// selection refers to the query as written,
+// table names are known after macro expansion, filters are injected into the
+// final tables and limits apply to the filtered query.
+var rewriteStages = []rewriteStage{
+	{name: "table-hints", apply: applyTableHints},
+	{name: "selection", apply: rewriteSelection},
+	{name: "macros", required: true, apply: expandMacros},
+	{name: "shards", apply: expandShards},
+	{name: "adhoc-filters", apply: applyAdhocFilters},
+	{name: "limit", apply: rewriteLimit},
+	{name: "alert-order", apply: rewriteAlertOrder},
+}
+
+// checkRewrites validates the names of the stages disabled in the settings
+func checkRewrites(disabled []string) error {
+	for _, name := range disabled {
+		i := slices.IndexFunc(rewriteStages, func(s rewriteStage) bool { return s.name == name })
+		if i == -1 {
+			return fmt.Errorf("disabledRewrites: unknown stage %q", name)
+		}
+		if rewriteStages[i].required {
+			return fmt.Errorf("disabledRewrites: stage %q can't be disabled", name)
+		}
+	}
+	return nil
+}
+
+// rewrite runs the enabled stages on the raw query, each in its own trace span
+func rewrite(ctx context.Context, query models.QueryModel, settings models.DatasourceSettings) (string, error) {
+	sql := query.RawQuery
+	for _, stage := range rewriteStages {
+		if !stage.required && slices.Contains(settings.DisabledRewrites, stage.name) {
+			continue
+		}
+		_, span := tracing.DefaultTracer().Start(ctx, "timestream.rewrite."+stage.name)
+		out, err := stage.apply(sql, query, settings)
+		span.SetAttributes(attribute.Bool("changed", out != sql))
+		if err != nil {
+			tracing.Error(span, err)
+			span.End()
+			return out, errorsource.DownstreamError(err, false)
+		}
+		span.End()
+		if out != sql {
+			backend.Logger.Debug("rewrote query", "stage", stage.name)
+		}
+		sql = out
+	}
+	return sql, nil
+}
+
+// rewriteSelection keeps only the statement enclosing the selection of the editor
+func rewriteSelection(sql string, query models.QueryModel, _ models.DatasourceSettings) (string, error) {
+	if query.Selection == nil {
+		return sql, nil
+	}
+	return validator.ExtractSelection(sql, query.Selection.Start, query.Selection.End)
+}
+
+func rewriteLimit(sql string, query models.QueryModel, _ models.DatasourceSettings) (string, error) {
+	if !query.AutoLimit {
+		return sql, nil
+	}
+	return appendLimit(sql, query), nil
+}
+
+// rewriteAlertOrder orders alert queries, reductions like last() need the same
+// row order on every evaluation
+func rewriteAlertOrder(sql string, query models.QueryModel, _ models.DatasourceSettings) (string, error) {
+	if !query.FromAlert {
+		return sql, nil
+	}
+	sql, _ = validator.DeterministicOrder(sql)
+	return sql, nil
+}
@@ -0,0 +1,57 @@
+package timestream
+
+import (
+	"context"
+	"testing"
+
+	"github.com/grafana/timestream-datasource/pkg/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckRewrites(t *testing.T) {
+	assert.NoError(t, checkRewrites(nil))
+	assert.NoError(t, checkRewrites([]string{"adhoc-filters", "limit"}))
+	assert.ErrorContains(t, checkRewrites([]string{"macros"}), "can't be disabled")
+	assert.ErrorContains(t, checkRewrites([]string{"rollups"}), "unknown stage")
+}
+
+func TestRewrite(t *testing.T) {
+	query := models.QueryModel{
+		RawQuery:      "SELECT * FROM $__database.$__table WHERE measure_name = 'cpu'",
+		Database:      "db",
+		Table:         "tbl",
+		AutoLimit:     true,
+		MaxDataPoints: 100,
+		AdhocFilters:  []models.AdhocFilter{{Key: "host", Operator: "=", Value: "a"}},
+	}
+
+	sql, err := rewrite(context.Background(), query, models.DatasourceSettings{})
+	require.NoError(t, err)
+	assert.Contains(t, sql, `"host" = 'a'`)
+	assert.Contains(t, sql, "LIMIT")
+
+	sql, err = rewrite(context.Background(), query, models.DatasourceSettings{DisabledRewrites: []string{"adhoc-filters", "limit"}})
+	require.NoError(t, err)
+	assert.Equal(t, `SELECT * FROM db.tbl WHERE measure_name = 'cpu'`, sql)
+
+	// required stages run even when listed
+	sql, err = rewrite(context.Background(), query, models.DatasourceSettings{DisabledRewrites: []string{"macros", "adhoc-filters", "limit"}})
+	require.NoError(t, err)
+	assert.NotContains(t, sql, "$__")
+}
+
+func TestRewrite_StageError(t *testing.T) {
+	query := models.QueryModel{
+		RawQuery:  "SELECT 1; SELECT 2",
+		Selection: &models.QuerySelection{Start: 100, End: 120},
+	}
+	_, err := rewrite(context.Background(), query, models.DatasourceSettings{})
+	assert.Error(t, err)
+
+	query.RawQuery = "SELECT 1"
+	query.Selection = nil
+	sql, err := rewrite(context.Background(), query, models.DatasourceSettings{})
+	require.NoError(t, err)
+	assert.Equal(t, "SELECT 1", sql)
+}
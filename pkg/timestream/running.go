@@ -0,0 +1,129 @@
+package timestream
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+)
+
+// RunningQuery is a query the datasource is paging through, listed by the
+// queries/running resource so its user, or an admin, can cancel it
+type RunningQuery struct {
+	QueryID     string    `json:"queryId"`
+	Fingerprint string    `json:"fingerprint"`
+	Query       string    `json:"query"`
+	StartedAt   time.Time `json:"startedAt"`
+	// User is the login of the user running the query
+	User string `json:"user,omitempty"`
+}
+
+// ownedBy reports whether user may see and cancel the query, admins may see
+// and cancel every query
+func (q RunningQuery) ownedBy(user *backend.User) bool {
+	return user != nil && (user.Role == "Admin" || (user.Login != "" && user.Login == q.User))
+}
+
+type runningEntry struct {
+	query  RunningQuery
+	cancel context.CancelFunc
+}
+
+// pagedQueryTTL is how long the owner of a query paged by the client is kept,
+// Timestream stops queries after an hour
+const pagedQueryTTL = time.Hour
+
+// runningQueries tracks the queries waiting for all their pages, and the owners
+// of the queries whose pages the client requests. A nil tracker tracks nothing.
+type runningQueries struct {
+	mu      sync.Mutex
+	entries map[string]runningEntry
+	// paged are the queries with further pages the client requests, there is
+	// no paging to stop but their owners may cancel them
+	paged map[string]RunningQuery
+}
+
+func newRunningQueries() *runningQueries {
+	return &runningQueries{entries: map[string]runningEntry{}, paged: map[string]RunningQuery{}}
+}
+
+// page records the owner of a query the client pages through until its last
+// page arrived
+func (r *runningQueries) page(q RunningQuery, last bool) {
+	if r == nil || q.QueryID == "" {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if last {
+		delete(r.paged, q.QueryID)
+		return
+	}
+	for id, p := range r.paged {
+		if q.StartedAt.Sub(p.StartedAt) > pagedQueryTTL {
+			delete(r.paged, id)
+		}
+	}
+	if _, ok := r.paged[q.QueryID]; !ok {
+		r.paged[q.QueryID] = q
+	}
+}
+
+// start tracks the query until the returned function is called, cancel stops
+// its paging
+func (r *runningQueries) start(q RunningQuery, cancel context.CancelFunc) func() {
+	if r == nil || q.QueryID == "" {
+		return func() {}
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.entries[q.QueryID] = runningEntry{query: q, cancel: cancel}
+	return func() {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		delete(r.entries, q.QueryID)
+	}
+}
+
+// cancel stops paging through the results of the query of user, it reports
+// whether the query was running or paged by the client for user
+func (r *runningQueries) cancel(queryID string, user *backend.User) bool {
+	if r == nil {
+		return false
+	}
+	r.mu.Lock()
+	if paged, ok := r.paged[queryID]; ok && paged.ownedBy(user) {
+		delete(r.paged, queryID)
+		r.mu.Unlock()
+		return true
+	}
+	entry, ok := r.entries[queryID]
+	ok = ok && entry.query.ownedBy(user)
+	if ok {
+		delete(r.entries, queryID)
+	}
+	r.mu.Unlock()
+	if ok {
+		entry.cancel()
+	}
+	return ok
+}
+
+// list returns the running queries of user, the oldest first
+func (r *runningQueries) list(user *backend.User) []RunningQuery {
+	out := []RunningQuery{}
+	if r == nil {
+		return out
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, entry := range r.entries {
+		if entry.query.ownedBy(user) {
+			out = append(out, entry.query)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].StartedAt.Before(out[j].StartedAt) })
+	return out
+}
@@ -0,0 +1,142 @@
+package timestream
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/timestreamquery"
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/timestream-datasource/pkg/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunningQueries(t *testing.T) {
+	r := newRunningQueries()
+	now := time.Now()
+	admin := &backend.User{Login: "admin", Role: "Admin"}
+	cancelled := false
+	done := r.start(RunningQuery{QueryID: "q2", StartedAt: now}, func() { cancelled = true })
+	r.start(RunningQuery{QueryID: "q1", StartedAt: now.Add(-time.Minute)}, func() {})
+	r.start(RunningQuery{}, func() {})()
+
+	list := r.list(admin)
+	require.Len(t, list, 2)
+	assert.Equal(t, "q1", list[0].QueryID)
+
+	done()
+	assert.False(t, r.cancel("q2", admin))
+	assert.False(t, cancelled)
+	assert.True(t, r.cancel("q1", admin))
+	assert.Empty(t, r.list(admin))
+
+	var nilRunning *runningQueries
+	nilRunning.start(RunningQuery{QueryID: "q3"}, func() {})()
+	assert.False(t, nilRunning.cancel("q3", admin))
+	assert.Empty(t, nilRunning.list(admin))
+}
+
+func TestRunningQueries_Owner(t *testing.T) {
+	r := newRunningQueries()
+	alice := &backend.User{Login: "alice", Role: "Viewer"}
+	bob := &backend.User{Login: "bob", Role: "Editor"}
+	r.start(RunningQuery{QueryID: "q1", User: "alice"}, func() {})
+	r.start(RunningQuery{QueryID: "q2"}, func() {})
+
+	assert.Equal(t, []RunningQuery{{QueryID: "q1", User: "alice"}}, r.list(alice))
+	assert.Empty(t, r.list(bob))
+	assert.Empty(t, r.list(nil))
+	assert.False(t, r.cancel("q1", bob))
+	assert.False(t, r.cancel("q2", bob))
+	assert.False(t, r.cancel("q1", nil))
+	assert.True(t, r.cancel("q1", alice))
+	assert.Len(t, r.list(&backend.User{Role: "Admin"}), 1)
+}
+
+// pagingClient returns the first page of a query and blocks on the next ones
+type pagingClient struct {
+	fakeClient
+}
+
+func (c *pagingClient) Query(ctx context.Context, input *timestreamquery.QueryInput, _ ...func(*timestreamquery.Options)) (*timestreamquery.QueryOutput, error) {
+	if input.NextToken == nil {
+		return &timestreamquery.QueryOutput{QueryId: aws.String("q1"), NextToken: aws.String("page-2")}, nil
+	}
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func TestExecuteQuery_CancelRunning(t *testing.T) {
+	ds := &timestreamDS{Client: &pagingClient{}, running: newRunningQueries()}
+	query := models.QueryModel{RawQuery: "SELECT * FROM db.tbl WHERE time > ago(1h) AND measure_name = 'cpu'", WaitForResult: true}
+
+	viewer := backend.PluginContext{User: &backend.User{Login: "alice", Role: "Viewer"}}
+	other := backend.PluginContext{User: &backend.User{Login: "bob", Role: "Viewer"}}
+
+	result := make(chan backend.DataResponse)
+	go func() { result <- ds.ExecuteQuery(backend.WithPluginContext(context.Background(), viewer), query) }()
+
+	require.Eventually(t, func() bool { return len(ds.running.list(viewer.User)) == 1 }, time.Second, time.Millisecond)
+	sender := &fakeSender{}
+	require.NoError(t, ds.CallResource(context.Background(), &backend.CallResourceRequest{PluginContext: other, Path: "queries/running"}, sender))
+	assert.JSONEq(t, "[]", string(sender.res.Body))
+	require.NoError(t, ds.CallResource(context.Background(), &backend.CallResourceRequest{PluginContext: viewer, Path: "queries/running"}, sender))
+	var running []RunningQuery
+	require.NoError(t, json.Unmarshal(sender.res.Body, &running))
+	require.Len(t, running, 1)
+	assert.Equal(t, "q1", running[0].QueryID)
+	assert.Equal(t, "alice", running[0].User)
+	assert.Contains(t, running[0].Query, "measure_name = ?")
+
+	body, _ := json.Marshal(models.CancelRequest{QueryID: "q1"})
+	err := ds.CallResource(context.Background(), &backend.CallResourceRequest{PluginContext: other, Method: "POST", Path: "cancel", Body: body}, &fakeSender{})
+	require.ErrorContains(t, err, "not a running query of the user")
+	require.NoError(t, ds.CallResource(context.Background(), &backend.CallResourceRequest{PluginContext: viewer, Method: "POST", Path: "cancel", Body: body}, &fakeSender{}))
+
+	dr := <-result
+	require.Error(t, dr.Error)
+	assert.Contains(t, dr.Error.Error(), "query q1 was cancelled")
+	assert.Equal(t, "q1", dr.Frames[0].Meta.Custom.(*models.TimestreamCustomMeta).QueryID)
+	assert.Empty(t, ds.running.list(viewer.User))
+}
+
+func TestExecuteQuery_CancelClientPaged(t *testing.T) {
+	ds := &timestreamDS{Client: &pagingClient{}, running: newRunningQueries()}
+	query := models.QueryModel{RawQuery: "SELECT * FROM db.tbl WHERE time > ago(1h) AND measure_name = 'cpu'"}
+
+	viewer := backend.PluginContext{User: &backend.User{Login: "alice", Role: "Viewer"}}
+	other := backend.PluginContext{User: &backend.User{Login: "bob", Role: "Editor"}}
+
+	dr := ds.ExecuteQuery(backend.WithPluginContext(context.Background(), viewer), query)
+	require.NoError(t, dr.Error)
+	meta := dr.Frames[0].Meta.Custom.(*models.TimestreamCustomMeta)
+	assert.Equal(t, "q1", meta.QueryID)
+	assert.Equal(t, "page-2", meta.NextToken)
+	// the browser requests the next pages, nothing is paging through them here
+	assert.Empty(t, ds.running.list(viewer.User))
+
+	body, _ := json.Marshal(models.CancelRequest{QueryID: "q1"})
+	err := ds.CallResource(context.Background(), &backend.CallResourceRequest{PluginContext: other, Method: "POST", Path: "cancel", Body: body}, &fakeSender{})
+	require.ErrorContains(t, err, "not a running query of the user")
+	require.NoError(t, ds.CallResource(context.Background(), &backend.CallResourceRequest{PluginContext: viewer, Method: "POST", Path: "cancel", Body: body}, &fakeSender{}))
+	err = ds.CallResource(context.Background(), &backend.CallResourceRequest{PluginContext: viewer, Method: "POST", Path: "cancel", Body: body}, &fakeSender{})
+	require.ErrorContains(t, err, "not a running query of the user")
+}
+
+func TestRunningQueries_Paged(t *testing.T) {
+	r := newRunningQueries()
+	alice := &backend.User{Login: "alice", Role: "Viewer"}
+	now := time.Now()
+	r.page(RunningQuery{QueryID: "q1", User: "alice", StartedAt: now}, false)
+	r.page(RunningQuery{QueryID: "q2", User: "alice", StartedAt: now}, false)
+	r.page(RunningQuery{QueryID: "q2", User: "alice", StartedAt: now}, true)
+	assert.False(t, r.cancel("q2", alice))
+
+	// owners of queries abandoned long ago are forgotten
+	r.page(RunningQuery{QueryID: "q3", User: "alice", StartedAt: now.Add(2 * pagedQueryTTL)}, false)
+	assert.False(t, r.cancel("q1", alice))
+	assert.True(t, r.cancel("q3", alice))
+}
@@ -0,0 +1,97 @@
+package timestream
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"slices"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// s3Lookup reads a CSV object with a header row. The object is only downloaded
+// again when its ETag changes.
+type s3Lookup struct {
+	client      S3Client
+	bucket      string
+	key         string
+	keyColumn   string
+	valueColumn string
+
+	mu     sync.Mutex
+	etag   string
+	values map[string]string
+}
+
+func (l *s3Lookup) fetch(ctx context.Context) (map[string]string, error) {
+	head, err := l.client.HeadObject(ctx, &s3.HeadObjectInput{Bucket: aws.String(l.bucket), Key: aws.String(l.key)})
+	if err != nil {
+		return nil, err
+	}
+	l.mu.Lock()
+	if etag := aws.ToString(head.ETag); etag != "" && etag == l.etag {
+		values := l.values
+		l.mu.Unlock()
+		return values, nil
+	}
+	l.mu.Unlock()
+
+	obj, err := l.client.GetObject(ctx, &s3.GetObjectInput{Bucket: aws.String(l.bucket), Key: aws.String(l.key)})
+	if err != nil {
+		return nil, err
+	}
+	defer obj.Body.Close()
+	values, err := parseCSVLookup(obj.Body, l.keyColumn, l.valueColumn)
+	if err != nil {
+		return nil, fmt.Errorf("s3://%s/%s: %w", l.bucket, l.key, err)
+	}
+
+	l.mu.Lock()
+	l.etag = aws.ToString(obj.ETag)
+	l.values = values
+	l.mu.Unlock()
+	return values, nil
+}
+
+// parseCSVLookup reads the key and value columns of a CSV with a header row, the
+// first two columns when they are not named
+func parseCSVLookup(r io.Reader, keyColumn, valueColumn string) (map[string]string, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	header, err := cr.Read()
+	if err != nil {
+		return nil, fmt.Errorf("reading header: %w", err)
+	}
+	keyIdx, valueIdx := 0, 1
+	if keyColumn != "" {
+		if keyIdx = slices.Index(header, keyColumn); keyIdx == -1 {
+			return nil, fmt.Errorf("column %q not found", keyColumn)
+		}
+	}
+	if valueColumn != "" {
+		if valueIdx = slices.Index(header, valueColumn); valueIdx == -1 {
+			return nil, fmt.Errorf("column %q not found", valueColumn)
+		}
+	}
+
+	values := map[string]string{}
+	for {
+		record, err := cr.Read()
+		if err == io.EOF {
+			return values, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if keyIdx >= len(record) || valueIdx >= len(record) {
+			continue
+		}
+		values[record[keyIdx]] = record[valueIdx]
+		if len(values) > maxLookupEntries {
+			return nil, fmt.Errorf("lookup has more than %d entries", maxLookupEntries)
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package timestream
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/timestream-datasource/pkg/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseCSVLookup(t *testing.T) {
+	csv := "device_id,site,name\nd1,berlin,Boiler\nd2,hamburg,\"Heat pump, north\"\nshort\n"
+
+	values, err := parseCSVLookup(strings.NewReader(csv), "", "")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"d1": "berlin", "d2": "hamburg"}, values)
+
+	values, err = parseCSVLookup(strings.NewReader(csv), "device_id", "name")
+	require.NoError(t, err)
+	assert.Equal(t, "Heat pump, north", values["d2"])
+
+	_, err = parseCSVLookup(strings.NewReader(csv), "device_id", "label")
+	assert.ErrorContains(t, err, `column "label" not found`)
+	_, err = parseCSVLookup(strings.NewReader(""), "", "")
+	assert.Error(t, err)
+}
+
+func TestS3Lookup_ETag(t *testing.T) {
+	client := &fakeS3{
+		objects: map[string]string{"devices.csv": "id,name\nd1,Boiler\n"},
+		etags:   map[string]string{"devices.csv": `"v1"`},
+	}
+	lookup := &s3Lookup{client: client, bucket: "lookups", key: "devices.csv"}
+
+	values, err := lookup.fetch(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "Boiler", values["d1"])
+	_, err = lookup.fetch(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 1, client.gets, "unchanged ETag")
+
+	client.objects["devices.csv"] = "id,name\nd1,Heat pump\n"
+	client.etags["devices.csv"] = `"v2"`
+	values, err = lookup.fetch(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "Heat pump", values["d1"])
+	assert.Equal(t, 2, client.gets)
+
+	_, err = (&s3Lookup{client: client, bucket: "lookups", key: "missing.csv"}).fetch(context.Background())
+	assert.Error(t, err)
+}
+
+func TestCallResource_Lookups(t *testing.T) {
+	client := &fakeS3{
+		objects: map[string]string{"devices.csv": "id,name\nd1,Boiler\nd2,Heat pump\n"},
+		etags:   map[string]string{"devices.csv": `"v1"`},
+	}
+	store, err := newLookupStore(nil, client, []models.LookupSource{{Name: "devices", Bucket: "lookups", Key: "devices.csv"}})
+	require.NoError(t, err)
+	ds := &timestreamDS{lookups: store}
+	admin := backend.PluginContext{User: &backend.User{Login: "admin", Role: "Admin"}}
+
+	err = ds.CallResource(context.Background(), &backend.CallResourceRequest{Path: "lookups", PluginContext: backend.PluginContext{User: &backend.User{Role: "Viewer"}}}, &fakeSender{})
+	assert.ErrorContains(t, err, "Admin role")
+
+	sender := &fakeSender{}
+	require.NoError(t, ds.CallResource(context.Background(), &backend.CallResourceRequest{Path: "lookups/refresh", Method: "POST", PluginContext: admin}, sender))
+	var statuses []LookupStatus
+	require.NoError(t, json.Unmarshal(sender.res.Body, &statuses))
+	require.Len(t, statuses, 1)
+	assert.Equal(t, 2, statuses[0].Entries)
+	assert.WithinDuration(t, time.Now(), statuses[0].FetchedAt, time.Minute)
+
+	err = ds.CallResource(context.Background(), &backend.CallResourceRequest{Path: "lookups/refresh", Method: "POST", Body: []byte(`{"name":"sites"}`), PluginContext: admin}, &fakeSender{})
+	assert.ErrorContains(t, err, "unknown lookup")
+}
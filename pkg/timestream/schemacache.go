@@ -0,0 +1,211 @@
+package timestream
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/timestreamquery"
+	"github.com/grafana/timestream-datasource/pkg/models"
+)
+
+const (
+	// How long a failed schema lookup is answered from the cache
+	schemaFailureTTL = 30 * time.Second
+	// How long a schema lookup is shared with other datasources of the account
+	schemaTTL = 5 * time.Minute
+	// Lookups kept per account and region
+	schemaEntries = 1000
+)
+
+// failureCache remembers failed lookups for a short time, so an editor asking for
+// the measures of a mistyped table doesn't call AWS on every keystroke.
+// A nil cache remembers nothing.
+type failureCache struct {
+	ttl time.Duration
+
+	mu      sync.Mutex
+	entries map[string]cachedFailure
+}
+
+type cachedFailure struct {
+	err     error
+	expires time.Time
+}
+
+func newFailureCache(ttl time.Duration) *failureCache {
+	return &failureCache{ttl: ttl, entries: map[string]cachedFailure{}}
+}
+
+// get returns the cached error of the key, or nil
+func (c *failureCache) get(key string, now time.Time) error {
+	if c == nil {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[key]
+	if !ok || !now.Before(entry.expires) {
+		return nil
+	}
+	return entry.err
+}
+
+func (c *failureCache) put(key string, err error, now time.Time) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for k, entry := range c.entries {
+		if !now.Before(entry.expires) {
+			delete(c.entries, k)
+		}
+	}
+	c.entries[key] = cachedFailure{err: err, expires: now.Add(c.ttl)}
+}
+
+// schemaScope identifies the AWS account and region a schema cache describes
+type schemaScope struct {
+	account  string
+	region   string
+	endpoint string
+}
+
+// schemaCaches are shared by the datasource instances of the same scope, so ten
+// datasources pointing at one account list its tables once
+var schemaCaches = struct {
+	mu     sync.Mutex
+	caches map[schemaScope]*schemaCache
+}{caches: map[schemaScope]*schemaCache{}}
+
+// sharedSchemaCache returns the schema cache of the scope, creating it on first use
+func sharedSchemaCache(scope schemaScope) *schemaCache {
+	schemaCaches.mu.Lock()
+	defer schemaCaches.mu.Unlock()
+	c, ok := schemaCaches.caches[scope]
+	if !ok {
+		c = newSchemaCache(schemaTTL)
+		schemaCaches.caches[scope] = c
+	}
+	return c
+}
+
+// schemaIdentity returns the scope of the settings and the principal the datasource
+// queries as. The account is read from the assumed role; datasources using their own
+// credentials only share a cache when the credentials are the same.
+func schemaIdentity(settings models.DatasourceSettings, region string) (schemaScope, string) {
+	principal := fmt.Sprintf("%v|%s|%s", settings.AuthType, settings.Profile, settings.AccessKey)
+	account := principal
+	if settings.AssumeRoleARN != "" {
+		principal = settings.AssumeRoleARN + "|" + settings.ExternalID
+		if parts := strings.Split(settings.AssumeRoleARN, ":"); len(parts) > 4 && parts[4] != "" {
+			account = parts[4]
+		}
+	}
+	return schemaScope{account: account, region: region, endpoint: settings.Endpoint}, principal
+}
+
+// schemaCache keeps successful schema lookups. Every entry records the principals
+// that ran the lookup themselves, a principal that didn't is not answered from the
+// entry since its permissions may differ. A nil cache keeps nothing.
+type schemaCache struct {
+	ttl time.Duration
+
+	mu      sync.Mutex
+	entries map[string]*schemaEntry
+}
+
+type schemaEntry struct {
+	output     *timestreamquery.QueryOutput
+	expires    time.Time
+	principals map[string]bool
+}
+
+func newSchemaCache(ttl time.Duration) *schemaCache {
+	return &schemaCache{ttl: ttl, entries: map[string]*schemaEntry{}}
+}
+
+// get returns the cached output of the lookup if the principal may read it. The
+// output is shared and must not be modified.
+func (c *schemaCache) get(sql, principal string, now time.Time) (*timestreamquery.QueryOutput, bool) {
+	if c == nil {
+		return nil, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[sql]
+	if !ok || !now.Before(entry.expires) || !entry.principals[principal] {
+		return nil, false
+	}
+	return entry.output, true
+}
+
+// put stores the output the principal read. A fresh entry with the same rows keeps
+// the principals that read it before.
+func (c *schemaCache) put(sql, principal string, output *timestreamquery.QueryOutput, now time.Time) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[sql]
+	if ok && now.Before(entry.expires) && !reflect.DeepEqual(entry.output.Rows, output.Rows) {
+		// the principals see different rows, keep the latest
+		ok = false
+	}
+	if !ok || !now.Before(entry.expires) {
+		c.evict(now)
+		entry = &schemaEntry{principals: map[string]bool{}}
+		c.entries[sql] = entry
+	}
+	entry.output = output
+	entry.expires = now.Add(c.ttl)
+	entry.principals[principal] = true
+}
+
+// evict removes the expired entries and, when the cache is still full, the entry
+// expiring first
+func (c *schemaCache) evict(now time.Time) {
+	var oldest string
+	for sql, entry := range c.entries {
+		if !now.Before(entry.expires) {
+			delete(c.entries, sql)
+			continue
+		}
+		if oldest == "" || entry.expires.Before(c.entries[oldest].expires) {
+			oldest = sql
+		}
+	}
+	if len(c.entries) >= schemaEntries {
+		delete(c.entries, oldest)
+	}
+}
+
+// schemaQuery runs a schema lookup like SHOW TABLES. Lookups are answered from the
+// schema cache shared with the datasources of the same account, and recently failed
+// lookups from the failure cache. Throttling and cancellation are not cached,
+// since they say nothing about the lookup itself.
+func (ds *timestreamDS) schemaQuery(ctx context.Context, sql string) (*timestreamquery.QueryOutput, error) {
+	now := time.Now()
+	if v, ok := ds.schema.get(sql, ds.principal, now); ok {
+		return v, nil
+	}
+	if err := ds.schemaFailures.get(sql, now); err != nil {
+		return nil, fmt.Errorf("%w (cached)", err)
+	}
+	v, err := ds.Client.Query(ctx, &timestreamquery.QueryInput{
+		QueryString: aws.String(sql),
+	})
+	if err == nil {
+		ds.schema.put(sql, ds.principal, v, now)
+	} else if ctx.Err() == nil && !errors.Is(err, context.Canceled) && asQuotaError(err) == nil {
+		ds.schemaFailures.put(sql, err, now)
+	}
+	return v, err
+}
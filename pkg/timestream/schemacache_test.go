@@ -0,0 +1,124 @@
+package timestream
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/timestreamquery"
+	timestreamquerytypes "github.com/aws/aws-sdk-go-v2/service/timestreamquery/types"
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/timestream-datasource/pkg/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFailureCache(t *testing.T) {
+	now := time.Now()
+	cache := newFailureCache(time.Minute)
+	cache.put("a", errors.New("boom"), now)
+
+	assert.EqualError(t, cache.get("a", now.Add(30*time.Second)), "boom")
+	assert.NoError(t, cache.get("a", now.Add(time.Minute)))
+	assert.NoError(t, cache.get("b", now))
+
+	var nilCache *failureCache
+	nilCache.put("a", errors.New("boom"), now)
+	assert.NoError(t, nilCache.get("a", now))
+}
+
+func TestSchemaQuery_CachesFailures(t *testing.T) {
+	client := &fakeClient{err: &timestreamquerytypes.ValidationException{Message: aws.String("table not found")}}
+	ds := &timestreamDS{Client: client, schemaFailures: newFailureCache(time.Minute)}
+	req := &backend.CallResourceRequest{Path: "measures", Method: "POST", Body: []byte(`{"database":"db","table":"typo"}`)}
+
+	for i := 0; i < 3; i++ {
+		err := ds.CallResource(context.Background(), req, &fakeSender{})
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "table not found")
+	}
+	assert.Len(t, client.calls.runQuery, 1)
+}
+
+func TestSchemaQuery_DoesNotCacheThrottling(t *testing.T) {
+	client := &fakeClient{err: &timestreamquerytypes.ThrottlingException{Message: aws.String("Rate exceeded")}}
+	ds := &timestreamDS{Client: client, schemaFailures: newFailureCache(time.Minute)}
+
+	for i := 0; i < 2; i++ {
+		_, err := ds.schemaQuery(context.Background(), "SHOW DATABASES")
+		require.Error(t, err)
+	}
+	assert.Len(t, client.calls.runQuery, 2)
+}
+
+func TestSchemaCache(t *testing.T) {
+	now := time.Now()
+	cache := newSchemaCache(time.Minute)
+	tables := &timestreamquery.QueryOutput{Rows: []timestreamquerytypes.Row{{Data: []timestreamquerytypes.Datum{{ScalarValue: aws.String("metrics")}}}}}
+	cache.put("SHOW TABLES", "role-a", tables, now)
+
+	v, ok := cache.get("SHOW TABLES", "role-a", now.Add(30*time.Second))
+	assert.True(t, ok)
+	assert.Same(t, tables, v)
+	_, ok = cache.get("SHOW TABLES", "role-b", now)
+	assert.False(t, ok, "principal that didn't read the entry")
+	_, ok = cache.get("SHOW TABLES", "role-a", now.Add(time.Minute))
+	assert.False(t, ok, "expired")
+
+	same := &timestreamquery.QueryOutput{Rows: tables.Rows}
+	cache.put("SHOW TABLES", "role-b", same, now)
+	_, ok = cache.get("SHOW TABLES", "role-a", now)
+	assert.True(t, ok, "same rows keep the principals")
+
+	cache.put("SHOW TABLES", "role-c", &timestreamquery.QueryOutput{}, now)
+	_, ok = cache.get("SHOW TABLES", "role-a", now)
+	assert.False(t, ok, "different rows reset the principals")
+
+	var nilCache *schemaCache
+	nilCache.put("SHOW TABLES", "role-a", tables, now)
+	_, ok = nilCache.get("SHOW TABLES", "role-a", now)
+	assert.False(t, ok)
+}
+
+func TestSchemaIdentity(t *testing.T) {
+	role := func(arn string) models.DatasourceSettings {
+		s := models.DatasourceSettings{}
+		s.AssumeRoleARN = arn
+		return s
+	}
+	scopeA, principalA := schemaIdentity(role("arn:aws:iam::123456789012:role/a"), "eu-west-1")
+	scopeB, principalB := schemaIdentity(role("arn:aws:iam::123456789012:role/b"), "eu-west-1")
+	assert.Equal(t, scopeA, scopeB)
+	assert.NotEqual(t, principalA, principalB)
+
+	scopeC, _ := schemaIdentity(role("arn:aws:iam::123456789012:role/a"), "us-east-1")
+	assert.NotEqual(t, scopeA, scopeC)
+
+	keys := models.DatasourceSettings{}
+	keys.AccessKey = "AKIA1"
+	scopeD, _ := schemaIdentity(keys, "eu-west-1")
+	keys.AccessKey = "AKIA2"
+	scopeE, _ := schemaIdentity(keys, "eu-west-1")
+	assert.NotEqual(t, scopeD, scopeE)
+}
+
+func TestSchemaQuery_SharedAcrossDatasources(t *testing.T) {
+	scope := schemaScope{account: "123456789012", region: "eu-west-1"}
+	output := &timestreamquery.QueryOutput{Rows: []timestreamquerytypes.Row{{Data: []timestreamquerytypes.Datum{{ScalarValue: aws.String("db")}}}}}
+	first := &fakeClient{output: output}
+	second := &fakeClient{output: output}
+	other := &fakeClient{output: output}
+	ds1 := &timestreamDS{Client: first, schema: sharedSchemaCache(scope), principal: "role-a"}
+	ds2 := &timestreamDS{Client: second, schema: sharedSchemaCache(scope), principal: "role-a"}
+	ds3 := &timestreamDS{Client: other, schema: sharedSchemaCache(scope), principal: "role-b"}
+
+	for _, ds := range []*timestreamDS{ds1, ds2, ds3} {
+		_, err := ds.schemaQuery(context.Background(), "SHOW DATABASES")
+		require.NoError(t, err)
+	}
+	assert.Len(t, first.calls.runQuery, 1)
+	assert.Len(t, second.calls.runQuery, 0)
+	assert.Len(t, other.calls.runQuery, 1)
+}
@@ -0,0 +1,27 @@
+package timestream
+
+import (
+	"github.com/grafana/timestream-datasource/pkg/timestream/validator"
+)
+
+// Scrubber masks sensitive values in SQL before it is logged or stored
+type Scrubber interface {
+	Scrub(sql string) string
+}
+
+// literalScrubber masks the literals of a query, keeping its time bounds
+type literalScrubber struct {
+	options *validator.ScrubOptions
+}
+
+func (s literalScrubber) Scrub(sql string) string {
+	return validator.Scrub(sql, s.options)
+}
+
+// scrubSQL applies the scrubber, falling back to the default literal masking
+func scrubSQL(s Scrubber, sql string) string {
+	if s == nil {
+		return validator.Scrub(sql, nil)
+	}
+	return s.Scrub(sql)
+}
@@ -0,0 +1,19 @@
+package timestream
+
+import (
+	"testing"
+
+	"github.com/grafana/timestream-datasource/pkg/timestream/validator"
+	"github.com/stretchr/testify/assert"
+)
+
+type constScrubber struct{}
+
+func (constScrubber) Scrub(string) string { return "SCRUBBED" }
+
+func TestScrubSQL(t *testing.T) {
+	sql := `SELECT * FROM db.tbl WHERE time > ago(1h) AND device = 'ACME-1'`
+	assert.Equal(t, `SELECT * FROM db.tbl WHERE time > ago(1h) AND device = ?`, scrubSQL(nil, sql))
+	assert.Equal(t, sql, scrubSQL(literalScrubber{&validator.ScrubOptions{Disabled: true}}, sql))
+	assert.Equal(t, "SCRUBBED", scrubSQL(constScrubber{}, sql))
+}
@@ -0,0 +1,177 @@
+package timestream
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/grafana/timestream-datasource/pkg/models"
+)
+
+// otherSeries is the label value and name of the series combining the series
+// beyond the limit
+const otherSeries = "other"
+
+// limitedSeries is a value field of a frame with its times
+type limitedSeries struct {
+	times, values *data.Field
+	rank          float64
+}
+
+// limitSeries keeps the largest series of each value column and combines the
+// rest per timestamp into an "other" series, or drops them without an
+// aggregation. The frames are unchanged when no column exceeds the limit.
+func limitSeries(frames data.Frames, limit models.SeriesLimit) (data.Frames, *data.Notice) {
+	var names []string
+	columns := map[string][]*limitedSeries{}
+	for _, frame := range frames {
+		times := frameTimes(frame)
+		if times == nil {
+			continue
+		}
+		for _, field := range frame.Fields {
+			if !field.Type().Numeric() {
+				continue
+			}
+			if columns[field.Name] == nil {
+				names = append(names, field.Name)
+			}
+			columns[field.Name] = append(columns[field.Name], &limitedSeries{times: times, values: field})
+		}
+	}
+
+	dropped := map[*data.Field]bool{}
+	var others data.Frames
+	total, kept := 0, 0
+	for _, name := range names {
+		series := columns[name]
+		total += len(series)
+		if len(series) <= limit.Limit {
+			kept += len(series)
+			continue
+		}
+		for _, s := range series {
+			s.rank = seriesRank(s.values, limit.Other)
+		}
+		sort.SliceStable(series, func(i, j int) bool { return series[i].rank > series[j].rank })
+		kept += limit.Limit
+		for _, s := range series[limit.Limit:] {
+			dropped[s.values] = true
+		}
+		if limit.Other != "" {
+			others = append(others, otherFrame(name, series[limit.Limit:], limit.Other))
+		}
+	}
+	if len(dropped) == 0 {
+		return frames, nil
+	}
+
+	out := make(data.Frames, 0, len(frames)+len(others))
+	for _, frame := range frames {
+		fields := slices.DeleteFunc(slices.Clone(frame.Fields), func(f *data.Field) bool { return dropped[f] })
+		if len(fields) < len(frame.Fields) && !slices.ContainsFunc(fields, func(f *data.Field) bool { return f.Type().Numeric() }) {
+			// every series of the frame was dropped
+			continue
+		}
+		frame.Fields = fields
+		out = append(out, frame)
+	}
+	out = append(out, others...)
+
+	text := fmt.Sprintf("Showing the largest %d of %d series, the rest are dropped", kept, total)
+	if limit.Other != "" {
+		text = fmt.Sprintf("Showing the largest %d of %d series, the rest are combined into %q", kept, total, otherSeries)
+	}
+	return out, &data.Notice{Severity: data.NoticeSeverityInfo, Text: text}
+}
+
+// frameTimes returns the first time field of the frame
+func frameTimes(frame *data.Frame) *data.Field {
+	for _, field := range frame.Fields {
+		if field.Type().Time() {
+			return field
+		}
+	}
+	return nil
+}
+
+// seriesRank is the sum of the values of a series, or their mean when the
+// other series are averaged
+func seriesRank(field *data.Field, other models.OtherAggregation) float64 {
+	sum, n := 0.0, 0
+	for i := range field.Len() {
+		v, ok := field.ConcreteAt(i)
+		if !ok {
+			continue
+		}
+		if f, err := toFloat64(v); err == nil {
+			sum += f
+			n++
+		}
+	}
+	if other == models.OtherAvg && n > 0 {
+		return sum / float64(n)
+	}
+	return sum
+}
+
+// otherFrame aggregates the series per timestamp. Its labels are the ones all
+// series share, other labels are "other".
+func otherFrame(name string, series []*limitedSeries, other models.OtherAggregation) *data.Frame {
+	type point struct {
+		sum float64
+		n   int
+	}
+	points := map[time.Time]*point{}
+	labels := data.Labels{}
+	for i, s := range series {
+		for key, value := range s.values.Labels {
+			if prev, ok := labels[key]; i > 0 && (!ok || prev != value) {
+				value = otherSeries
+			}
+			labels[key] = value
+		}
+		for key := range labels {
+			if _, ok := s.values.Labels[key]; !ok {
+				labels[key] = otherSeries
+			}
+		}
+		for row := range s.values.Len() {
+			t, okT := s.times.ConcreteAt(row)
+			v, okV := s.values.ConcreteAt(row)
+			if !okT || !okV {
+				continue
+			}
+			f, err := toFloat64(v)
+			if err != nil {
+				continue
+			}
+			p := points[t.(time.Time)]
+			if p == nil {
+				p = &point{}
+				points[t.(time.Time)] = p
+			}
+			p.sum += f
+			p.n++
+		}
+	}
+
+	times := make([]time.Time, 0, len(points))
+	for t := range points {
+		times = append(times, t)
+	}
+	slices.SortFunc(times, func(a, b time.Time) int { return a.Compare(b) })
+	values := make([]float64, len(times))
+	for i, t := range times {
+		values[i] = points[t].sum
+		if other == models.OtherAvg {
+			values[i] /= float64(points[t].n)
+		}
+	}
+	return data.NewFrame(otherSeries,
+		data.NewField("time", nil, times),
+		data.NewField(name, labels, values),
+	)
+}
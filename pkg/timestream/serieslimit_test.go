@@ -0,0 +1,114 @@
+package timestream
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/timestreamquery"
+	timestreamquerytypes "github.com/aws/aws-sdk-go-v2/service/timestreamquery/types"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/grafana/timestream-datasource/pkg/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLimitSeries(t *testing.T) {
+	t0 := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	times := []time.Time{t0, t0.Add(time.Minute)}
+	power := func(device string, values ...*float64) *data.Field {
+		return data.NewField("power", data.Labels{"device": device, "site": "berlin"}, values)
+	}
+	wide := func() data.Frames {
+		return data.Frames{data.NewFrame("",
+			data.NewField("time", nil, times),
+			power("d1", float64Ptr(1), float64Ptr(1)),
+			power("d2", float64Ptr(10), float64Ptr(20)),
+			power("d3", float64Ptr(5), nil),
+			power("d4", float64Ptr(2), float64Ptr(4)),
+		)}
+	}
+
+	out, notice := limitSeries(wide(), models.SeriesLimit{Limit: 2, Other: models.OtherSum})
+	require.Len(t, out, 2)
+	require.Len(t, out[0].Fields, 3)
+	assert.Equal(t, data.Labels{"device": "d2", "site": "berlin"}, out[0].Fields[1].Labels)
+	assert.Equal(t, data.Labels{"device": "d4", "site": "berlin"}, out[0].Fields[2].Labels)
+
+	// the totals per timestamp are kept
+	other := out[1]
+	assert.Equal(t, "other", other.Name)
+	assert.Equal(t, data.Labels{"device": "other", "site": "berlin"}, other.Fields[1].Labels)
+	assert.Equal(t, "power", other.Fields[1].Name)
+	assert.Equal(t, times, []time.Time{other.Fields[0].At(0).(time.Time), other.Fields[0].At(1).(time.Time)})
+	assert.Equal(t, 6.0, other.Fields[1].At(0))
+	assert.Equal(t, 1.0, other.Fields[1].At(1))
+	require.NotNil(t, notice)
+	assert.Equal(t, `Showing the largest 2 of 4 series, the rest are combined into "other"`, notice.Text)
+
+	// averages rank by the mean and ignore missing values
+	out, _ = limitSeries(wide(), models.SeriesLimit{Limit: 2, Other: models.OtherAvg})
+	assert.Equal(t, "d2", out[0].Fields[1].Labels["device"])
+	assert.Equal(t, "d3", out[0].Fields[2].Labels["device"])
+	assert.Equal(t, 1.5, out[1].Fields[1].At(0))
+	assert.Equal(t, 2.5, out[1].Fields[1].At(1))
+
+	// without an aggregation the rest is dropped
+	out, notice = limitSeries(wide(), models.SeriesLimit{Limit: 3})
+	require.Len(t, out, 1)
+	assert.Len(t, out[0].Fields, 4)
+	assert.Equal(t, "Showing the largest 3 of 4 series, the rest are dropped", notice.Text)
+
+	// within the limit
+	frames := wide()
+	out, notice = limitSeries(frames, models.SeriesLimit{Limit: 4, Other: models.OtherSum})
+	assert.Equal(t, frames, out)
+	assert.Nil(t, notice)
+}
+
+func TestLimitSeries_Frames(t *testing.T) {
+	t0 := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	series := func(device string, v float64) *data.Frame {
+		return data.NewFrame("", data.NewField("time", nil, []time.Time{t0}), data.NewField("power", data.Labels{"device": device}, []float64{v}))
+	}
+
+	out, _ := limitSeries(data.Frames{series("d1", 1), series("d2", 2), series("d3", 3)}, models.SeriesLimit{Limit: 1, Other: models.OtherSum})
+	require.Len(t, out, 2)
+	assert.Equal(t, "d3", out[0].Fields[1].Labels["device"])
+	assert.Equal(t, 3.0, out[1].Fields[1].At(0))
+}
+
+func TestExecuteQuery_SeriesLimit(t *testing.T) {
+	row := func(device, value string) timestreamquerytypes.Row {
+		return timestreamquerytypes.Row{Data: []timestreamquerytypes.Datum{
+			{ScalarValue: aws.String("2024-01-01 00:00:00.000000000")}, {ScalarValue: aws.String(device)}, {ScalarValue: aws.String(value)},
+		}}
+	}
+	input := &timestreamquery.QueryOutput{
+		ColumnInfo: []timestreamquerytypes.ColumnInfo{
+			{Name: aws.String("time"), Type: &timestreamquerytypes.Type{ScalarType: timestreamquerytypes.ScalarTypeTimestamp}},
+			{Name: aws.String("device"), Type: &timestreamquerytypes.Type{ScalarType: timestreamquerytypes.ScalarTypeVarchar}},
+			{Name: aws.String("power"), Type: &timestreamquerytypes.Type{ScalarType: timestreamquerytypes.ScalarTypeDouble}},
+		},
+		Rows: []timestreamquerytypes.Row{row("d1", "1"), row("d2", "2"), row("d3", "3")},
+	}
+
+	tables := tableClient{outputs: map[string]*timestreamquery.QueryOutput{"power": input}}
+	// the largest series of all pages, not of the first
+	for _, client := range []QueryClient{&tables, &pagedTableClient{tables}} {
+		ds := &timestreamDS{Client: client}
+		res := ds.ExecuteQuery(context.Background(), models.QueryModel{
+			Format:      models.FormatOptionTimeSeries,
+			RawQuery:    `SELECT time, device, power FROM db.meters WHERE time > ago(1h) AND measure_name = 'power'`,
+			SeriesLimit: &models.SeriesLimit{Limit: 1, Other: models.OtherSum},
+		})
+		require.NoError(t, res.Error)
+		require.Len(t, res.Frames, 2)
+		assert.Len(t, res.Frames[0].Fields, 2)
+		assert.Equal(t, "d3", res.Frames[0].Fields[1].Labels["device"])
+		assert.Equal(t, 3.0, res.Frames[1].Fields[1].At(0))
+		require.Len(t, res.Frames[0].Meta.Notices, 1)
+		assert.Equal(t, data.NoticeSeverityInfo, res.Frames[0].Meta.Notices[0].Severity)
+	}
+}
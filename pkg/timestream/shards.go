@@ -0,0 +1,135 @@
+package timestream
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/grafana/timestream-datasource/pkg/models"
+)
+
+const (
+	shardsMacro = "$__shards("
+	// monthly shards are named <table>_2024_01
+	shardSuffixLayout = "_2006_01"
+	// keeps a misconfigured range from generating a huge query
+	maxShards = 60
+)
+
+// expandShards replaces every $__shards(table[, filter]) with a UNION ALL over the
+// monthly shards of table overlapping the query range. Each shard gets its own time
+// filter and the optional filter, so the query passes the validator. Shards missing
+// from the tables listed by ListTables of the model are left out, e.g.
+//
+//	SELECT * FROM $__shards(db.metrics, measure_name = 'cpu')
+func expandShards(query string, model models.QueryModel, settings models.DatasourceSettings) (string, error) {
+	for {
+		start := strings.Index(query, shardsMacro)
+		if start == -1 {
+			return query, nil
+		}
+		end := closingParen(query, start+len(shardsMacro)-1)
+		if end == -1 {
+			return query, fmt.Errorf("unterminated %s", shardsMacro)
+		}
+		replacement, err := shardsUnion(query[start+len(shardsMacro):end], model, settings)
+		if err != nil {
+			return query, err
+		}
+		query = query[:start] + replacement + query[end+1:]
+	}
+}
+
+func shardsUnion(args string, model models.QueryModel, settings models.DatasourceSettings) (string, error) {
+	table, filter, _ := strings.Cut(args, ",")
+	table = strings.TrimSpace(table)
+	filter = strings.TrimSpace(filter)
+	if table == "" {
+		return "", fmt.Errorf("%s) requires a table", shardsMacro)
+	}
+	database := valueOrDefault(model.Database, settings.DefaultDatabase)
+	if idx := strings.LastIndex(table, "."); idx >= 0 {
+		database, table = table[:idx], table[idx+1:]
+	}
+	table = strings.Trim(table, `"`)
+	if database == "" {
+		return "", fmt.Errorf("%s) requires a database for table %s", shardsMacro, table)
+	}
+
+	from, to := model.TimeRange.From.UTC(), model.TimeRange.To.UTC()
+	if to.Before(from) {
+		return "", fmt.Errorf("invalid time range for %s)", shardsMacro)
+	}
+	timeFilter := fmt.Sprintf("time BETWEEN from_milliseconds(%d) AND from_milliseconds(%d)", from.UnixMilli(), to.UnixMilli())
+	if filter != "" {
+		timeFilter += " AND (" + filter + ")"
+	}
+
+	var exists map[string]bool
+	if model.ListTables != nil {
+		tables, err := model.ListTables(database)
+		if err != nil {
+			return "", fmt.Errorf("listing the shards of %s: %w", table, err)
+		}
+		exists = map[string]bool{}
+		for _, name := range tables {
+			exists[strings.Trim(name, `"`)] = true
+		}
+	}
+
+	var selects []string
+	shards := 0
+	month := time.Date(from.Year(), from.Month(), 1, 0, 0, 0, 0, time.UTC)
+	for !month.After(to) {
+		if shards == maxShards {
+			return "", fmt.Errorf("time range spans more than %d shards of %s", maxShards, table)
+		}
+		shards++
+		name := table + month.Format(shardSuffixLayout)
+		month = month.AddDate(0, 1, 0)
+		if exists != nil && !exists[name] {
+			continue
+		}
+		shard := quoteIdentifier(database) + "." + quoteIdentifier(name)
+		selects = append(selects, fmt.Sprintf("SELECT * FROM %s WHERE %s", shard, timeFilter))
+	}
+	if len(selects) == 0 {
+		return "", fmt.Errorf("no shards of %s.%s exist in the time range", database, table)
+	}
+	return "(" + strings.Join(selects, " UNION ALL ") + ")", nil
+}
+
+// listTables returns a lookup of the tables of a database for the $__shards macro.
+// The lookups are answered from the schema cache.
+func (ds *timestreamDS) listTables(ctx context.Context) func(database string) ([]string, error) {
+	return func(database string) ([]string, error) {
+		v, err := ds.schemaQuery(ctx, fmt.Sprintf("SHOW TABLES FROM %s", quoteIdentifier(database)))
+		if err != nil {
+			return nil, err
+		}
+		return sliceFromRows(v.Rows, false), nil
+	}
+}
+
+// closingParen returns the index of the parenthesis closing the one at open,
+// ignoring parentheses within string literals, or -1
+func closingParen(s string, open int) int {
+	depth := 0
+	inString := false
+	for i := open; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '\'':
+			inString = !inString
+		case inString:
+		case c == '(':
+			depth++
+		case c == ')':
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
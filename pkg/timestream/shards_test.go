@@ -0,0 +1,103 @@
+package timestream
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/timestreamquery"
+	timestreamquerytypes "github.com/aws/aws-sdk-go-v2/service/timestreamquery/types"
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/timestream-datasource/pkg/models"
+	"github.com/grafana/timestream-datasource/pkg/timestream/validator"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExpandShards(t *testing.T) {
+	model := models.QueryModel{
+		TimeRange: backend.TimeRange{
+			From: time.Date(2024, 1, 20, 0, 0, 0, 0, time.UTC),
+			To:   time.Date(2024, 3, 5, 0, 0, 0, 0, time.UTC),
+		},
+	}
+	timeFilter := "time BETWEEN from_milliseconds(1705708800000) AND from_milliseconds(1709596800000)"
+
+	t.Run("expands to the overlapping months", func(t *testing.T) {
+		model.RawQuery = "SELECT device, avg(measure_value::double) FROM $__shards(db.metrics, measure_name = 'cpu' AND (region = 'eu' OR region = 'us')) GROUP BY device"
+		sql, err := Interpolate(model, models.DatasourceSettings{})
+		require.NoError(t, err)
+
+		filter := timeFilter + " AND (measure_name = 'cpu' AND (region = 'eu' OR region = 'us'))"
+		assert.Equal(t, "SELECT device, avg(measure_value::double) FROM ("+
+			`SELECT * FROM "db"."metrics_2024_01" WHERE `+filter+
+			` UNION ALL SELECT * FROM "db"."metrics_2024_02" WHERE `+filter+
+			` UNION ALL SELECT * FROM "db"."metrics_2024_03" WHERE `+filter+
+			") GROUP BY device", sql)
+
+		valid, issues := validator.Validate(sql, nil)
+		assert.True(t, valid, issues)
+	})
+
+	t.Run("default database", func(t *testing.T) {
+		model.RawQuery = `SELECT * FROM $__shards("metrics")`
+		sql, err := Interpolate(model, models.DatasourceSettings{DefaultDatabase: "db"})
+		require.NoError(t, err)
+		assert.Contains(t, sql, `"db"."metrics_2024_01"`)
+		assert.Equal(t, 3, strings.Count(sql, timeFilter))
+	})
+
+	t.Run("existing shards", func(t *testing.T) {
+		listed := model
+		listed.RawQuery = "SELECT * FROM $__shards(db.metrics, measure_name = 'cpu')"
+		listed.ListTables = func(database string) ([]string, error) {
+			assert.Equal(t, "db", database)
+			return []string{"metrics_2024_02", "metrics_2024_03", "other_2024_01"}, nil
+		}
+		sql, err := Interpolate(listed, models.DatasourceSettings{})
+		require.NoError(t, err)
+		assert.NotContains(t, sql, "metrics_2024_01")
+		assert.Equal(t, 1, strings.Count(sql, "UNION ALL"))
+
+		listed.ListTables = func(string) ([]string, error) { return []string{"other_2024_01"}, nil }
+		_, err = Interpolate(listed, models.DatasourceSettings{})
+		assert.ErrorContains(t, err, "no shards of db.metrics")
+
+		listed.ListTables = func(string) ([]string, error) { return nil, errors.New("denied") }
+		_, err = Interpolate(listed, models.DatasourceSettings{})
+		assert.ErrorContains(t, err, "denied")
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		for _, raw := range []string{
+			"SELECT * FROM $__shards(metrics)",
+			"SELECT * FROM $__shards()",
+			"SELECT * FROM $__shards(db.metrics",
+		} {
+			model.RawQuery = raw
+			_, err := Interpolate(model, models.DatasourceSettings{})
+			assert.Error(t, err, raw)
+		}
+
+		long := model
+		long.RawQuery = "SELECT * FROM $__shards(db.metrics)"
+		long.TimeRange.From = long.TimeRange.To.AddDate(-10, 0, 0)
+		_, err := Interpolate(long, models.DatasourceSettings{})
+		assert.ErrorContains(t, err, "more than 60 shards")
+	})
+}
+
+func TestListTables(t *testing.T) {
+	client := &fakeClient{output: &timestreamquery.QueryOutput{Rows: []timestreamquerytypes.Row{
+		{Data: []timestreamquerytypes.Datum{{ScalarValue: aws.String("metrics_2024_01")}}},
+	}}}
+	ds := &timestreamDS{Client: client}
+
+	tables, err := ds.listTables(context.Background())(`"db"`)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"metrics_2024_01"}, tables)
+	assert.Equal(t, `SHOW TABLES FROM "db"`, *client.calls.runQuery[0].QueryString)
+}
@@ -0,0 +1,188 @@
+package timestream
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/backend/gtime"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/grafana/grafana-plugin-sdk-go/experimental/errorsource"
+	"github.com/grafana/timestream-datasource/pkg/models"
+	"github.com/grafana/timestream-datasource/pkg/timestream/validator"
+)
+
+const (
+	// sub-range queries running at the same time
+	maxSplitConcurrency = 4
+	// keeps a small split interval from flooding Timestream
+	maxSplits = 100
+)
+
+// executeSplit runs the query once per sub-range of the split interval, a few at a
+// time, and merges the frames in time order. Sub-ranges that fail are reported as a
+// warning, so a long scan still returns what could be read. Queries whose results
+// over the sub-ranges can't be appended, e.g. ungrouped aggregates, are refused.
+func (ds *timestreamDS) executeSplit(ctx context.Context, query models.QueryModel) backend.DataResponse {
+	interval, err := gtime.ParseDuration(query.SplitInterval)
+	if err != nil || interval <= 0 {
+		return errorsource.Response(errorsource.DownstreamError(fmt.Errorf("invalid split interval %q", query.SplitInterval), false))
+	}
+	query.SplitInterval = ""
+	ranges := splitTimeRange(query.TimeRange, interval)
+	if len(ranges) < 2 || !usesTimeRange(query.RawQuery) {
+		return ds.executeQuery(ctx, query)
+	}
+	if reason := validator.SplitBlocker(query.RawQuery); reason != "" {
+		return errorsource.Response(errorsource.DownstreamError(fmt.Errorf("the query can't be split into sub-ranges, %s", reason), false))
+	}
+	if len(ranges) > maxSplits {
+		return errorsource.Response(errorsource.DownstreamError(fmt.Errorf("split interval %s creates more than %d queries", interval, maxSplits), false))
+	}
+
+	responses := make([]backend.DataResponse, len(ranges))
+	sem := make(chan struct{}, maxSplitConcurrency)
+	var wg sync.WaitGroup
+	for i, r := range ranges {
+		wg.Add(1)
+		go func(i int, r backend.TimeRange) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			sub := query
+			sub.TimeRange = r
+			sub.WaitForResult = true
+			responses[i] = ds.executeQuery(ctx, sub)
+		}(i, r)
+	}
+	wg.Wait()
+	return mergeSplitResponses(responses)
+}
+
+// splitTimeRange cuts the range into consecutive sub-ranges of at most interval.
+// Sub-ranges end a millisecond before the next starts, since $__timeFilter is inclusive.
+func splitTimeRange(tr backend.TimeRange, interval time.Duration) []backend.TimeRange {
+	var ranges []backend.TimeRange
+	for from := tr.From; from.Before(tr.To) || len(ranges) == 0; from = from.Add(interval) {
+		to := from.Add(interval - time.Millisecond)
+		if to.After(tr.To) {
+			to = tr.To
+		}
+		ranges = append(ranges, backend.TimeRange{From: from, To: to})
+		if len(ranges) > maxSplits {
+			break
+		}
+	}
+	return ranges
+}
+
+// usesTimeRange reports whether the query depends on the dashboard range,
+// otherwise every sub-range would return the same rows
+func usesTimeRange(rawQuery string) bool {
+	for _, macro := range []string{"$__timeFilter", "$__timeFrom", "$__timeTo", shardsMacro} {
+		if strings.Contains(rawQuery, macro) {
+			return true
+		}
+	}
+	return false
+}
+
+// mergeSplitResponses appends the rows of frames with the same name and fields, in
+// the order of the sub-ranges. The metadata of the first response is kept with the
+// bytes scanned summed up.
+func mergeSplitResponses(responses []backend.DataResponse) backend.DataResponse {
+	merged, failed := concatResponses(responses)
+	if merged == nil {
+		return responses[0]
+	}
+	if meta, ok := customMeta(merged.Frames[0]); ok {
+		meta.SplitQueries = len(responses)
+	}
+	if len(failed) > 0 {
+		merged.Frames[0].AppendNotices(data.Notice{
+			Severity: data.NoticeSeverityWarning,
+			Text:     fmt.Sprintf("%d of %d sub-range queries failed, results are incomplete: %s", len(failed), len(responses), responses[failed[0]].Error.Error()),
+		})
+	}
+	return *merged
+}
+
+// concatResponses appends the rows of frames with the same name and fields to the
+// first successful response, whose metadata is kept with the bytes scanned of all
+// responses summed up. It returns the indexes of the failed responses, and a nil
+// response when all of them failed.
+func concatResponses(responses []backend.DataResponse) (*backend.DataResponse, []int) {
+	var merged *backend.DataResponse
+	var failed []int
+	index := map[string]*data.Frame{}
+	var scanned, metered int64
+
+	for i := range responses {
+		dr := responses[i]
+		if dr.Error != nil {
+			failed = append(failed, i)
+			continue
+		}
+		for _, frame := range dr.Frames {
+			if meta, ok := customMeta(frame); ok && meta.Status != nil {
+				scanned += meta.Status.CumulativeBytesScanned
+				metered += meta.Status.CumulativeBytesMetered
+			}
+		}
+		if merged == nil {
+			merged = &responses[i]
+			for _, frame := range dr.Frames {
+				index[frameKey(frame)] = frame
+			}
+			continue
+		}
+		for _, frame := range dr.Frames {
+			if dst, ok := index[frameKey(frame)]; ok {
+				appendFrameRows(dst, frame)
+				continue
+			}
+			index[frameKey(frame)] = frame
+			merged.Frames = append(merged.Frames, frame)
+		}
+	}
+	if merged == nil {
+		return nil, failed
+	}
+
+	if meta, ok := customMeta(merged.Frames[0]); ok && meta.Status != nil {
+		status := *meta.Status
+		status.CumulativeBytesScanned = scanned
+		status.CumulativeBytesMetered = metered
+		meta.Status = &status
+	}
+	return merged, failed
+}
+
+func customMeta(frame *data.Frame) (*models.TimestreamCustomMeta, bool) {
+	if frame.Meta == nil {
+		return nil, false
+	}
+	meta, ok := frame.Meta.Custom.(*models.TimestreamCustomMeta)
+	return meta, ok
+}
+
+// frameKey identifies the series of a frame across sub-range responses
+func frameKey(frame *data.Frame) string {
+	var sb strings.Builder
+	sb.WriteString(frame.Name)
+	for _, field := range frame.Fields {
+		fmt.Fprintf(&sb, "|%s:%s:%s", field.Name, field.Type(), field.Labels)
+	}
+	return sb.String()
+}
+
+func appendFrameRows(dst, src *data.Frame) {
+	for i := 0; i < src.Rows(); i++ {
+		for j, field := range src.Fields {
+			dst.Fields[j].Append(field.At(i))
+		}
+	}
+}
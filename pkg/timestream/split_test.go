@@ -0,0 +1,117 @@
+package timestream
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/timestreamquery"
+	timestreamquerytypes "github.com/aws/aws-sdk-go-v2/service/timestreamquery/types"
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/grafana/timestream-datasource/pkg/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSplitTimeRange(t *testing.T) {
+	from := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	ranges := splitTimeRange(backend.TimeRange{From: from, To: from.Add(60 * time.Hour)}, 24*time.Hour)
+	require.Len(t, ranges, 3)
+	assert.Equal(t, from, ranges[0].From)
+	assert.Equal(t, from.Add(24*time.Hour-time.Millisecond), ranges[0].To)
+	assert.Equal(t, from.Add(24*time.Hour), ranges[1].From)
+	assert.Equal(t, from.Add(60*time.Hour), ranges[2].To)
+}
+
+func TestExecuteQuery_SplitInterval(t *testing.T) {
+	client := &fakeClient{output: &timestreamquery.QueryOutput{
+		ColumnInfo: []timestreamquerytypes.ColumnInfo{
+			{Name: aws.String("time"), Type: &timestreamquerytypes.Type{ScalarType: timestreamquerytypes.ScalarTypeTimestamp}},
+			{Name: aws.String("value"), Type: &timestreamquerytypes.Type{ScalarType: timestreamquerytypes.ScalarTypeDouble}},
+		},
+		Rows: []timestreamquerytypes.Row{{Data: []timestreamquerytypes.Datum{
+			{ScalarValue: aws.String("2024-01-01 00:00:00.000000000")},
+			{ScalarValue: aws.String("1.5")},
+		}}},
+		QueryStatus: &timestreamquerytypes.QueryStatus{CumulativeBytesScanned: 10},
+	}}
+	ds := &timestreamDS{Client: client}
+	from := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	query := models.QueryModel{
+		RawQuery:      "SELECT time, value FROM db.tbl WHERE $__timeFilter AND measure_name = 'cpu'",
+		TimeRange:     backend.TimeRange{From: from, To: from.Add(72 * time.Hour)},
+		Format:        models.FormatOptionTable,
+		SplitInterval: "1d",
+	}
+
+	dr := ds.ExecuteQuery(context.Background(), query)
+	require.NoError(t, dr.Error)
+	assert.Len(t, client.calls.runQuery, 3)
+	require.Len(t, dr.Frames, 1)
+	assert.Equal(t, 3, dr.Frames[0].Rows())
+	meta := dr.Frames[0].Meta.Custom.(*models.TimestreamCustomMeta)
+	assert.Equal(t, 3, meta.SplitQueries)
+	assert.Equal(t, int64(30), meta.Status.CumulativeBytesScanned)
+	assert.Equal(t, int64(10), client.output.QueryStatus.CumulativeBytesScanned)
+
+	t.Run("without time macros", func(t *testing.T) {
+		client.calls.runQuery = nil
+		query.RawQuery = "SELECT time, value FROM db.tbl WHERE time > ago(1h) AND measure_name = 'cpu'"
+		dr := ds.ExecuteQuery(context.Background(), query)
+		require.NoError(t, dr.Error)
+		assert.Len(t, client.calls.runQuery, 1)
+	})
+
+	t.Run("refused shapes", func(t *testing.T) {
+		for _, raw := range []string{
+			"SELECT device, avg(measure_value::double) FROM db.tbl WHERE $__timeFilter AND measure_name = 'cpu' GROUP BY device",
+			"SELECT time, value FROM db.tbl WHERE $__timeFilter AND measure_name = 'cpu' ORDER BY value DESC",
+			"SELECT time, value FROM db.tbl WHERE $__timeFilter AND measure_name = 'cpu' ORDER BY time LIMIT 10",
+		} {
+			client.calls.runQuery = nil
+			query.RawQuery = raw
+			dr := ds.ExecuteQuery(context.Background(), query)
+			assert.ErrorContains(t, dr.Error, "can't be split into sub-ranges", raw)
+			assert.Empty(t, client.calls.runQuery, raw)
+		}
+	})
+
+	t.Run("time bins", func(t *testing.T) {
+		client.calls.runQuery = nil
+		query.RawQuery = "SELECT bin(time, 1h) AS t, avg(measure_value::double) FROM db.tbl WHERE $__timeFilter AND measure_name = 'cpu' GROUP BY bin(time, 1h) ORDER BY t"
+		dr := ds.ExecuteQuery(context.Background(), query)
+		require.NoError(t, dr.Error)
+		assert.Len(t, client.calls.runQuery, 3)
+	})
+
+	t.Run("too many sub-ranges", func(t *testing.T) {
+		query.SplitInterval = "1m"
+		query.RawQuery = "SELECT * FROM db.tbl WHERE $__timeFilter"
+		dr := ds.ExecuteQuery(context.Background(), query)
+		assert.Error(t, dr.Error)
+	})
+}
+
+func TestMergeSplitResponses_PartialFailure(t *testing.T) {
+	frame := func(v float64) *data.Frame {
+		f := data.NewFrame("", data.NewField("value", nil, []float64{v}))
+		f.Meta = &data.FrameMeta{Custom: &models.TimestreamCustomMeta{}}
+		return f
+	}
+	dr := mergeSplitResponses([]backend.DataResponse{
+		{Error: errors.New("throttled")},
+		{Frames: data.Frames{frame(1)}},
+		{Frames: data.Frames{frame(2)}},
+	})
+	require.NoError(t, dr.Error)
+	require.Len(t, dr.Frames, 1)
+	assert.Equal(t, 2, dr.Frames[0].Rows())
+	require.Len(t, dr.Frames[0].Meta.Notices, 1)
+	assert.Contains(t, dr.Frames[0].Meta.Notices[0].Text, "1 of 3 sub-range queries failed")
+
+	dr = mergeSplitResponses([]backend.DataResponse{{Error: errors.New("a")}, {Error: errors.New("b")}})
+	assert.EqualError(t, dr.Error, "a")
+}
@@ -0,0 +1,136 @@
+package timestream
+
+import (
+	"fmt"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/grafana/timestream-datasource/pkg/models"
+)
+
+// measureValueVarchar is the value column of varchar measures in single-measure tables
+const measureValueVarchar = "measure_value::varchar"
+
+// stateMappings convert the states of varchar measures to numbers
+type stateMappings []models.StateMapping
+
+// states returns the states of the first mapping matching the measure, nil without one
+func (m stateMappings) states(measure string) map[string]float64 {
+	for _, mapping := range m {
+		if ok, _ := path.Match(mapping.Measure, measure); ok {
+			return mapping.States
+		}
+	}
+	return nil
+}
+
+// applyStateMappings converts the varchar fields of mapped measures to numbers:
+// the fields named like a measure of multi-measure records, and the
+// measure_value::varchar of single-measure tables by the measure_name of each
+// row. It returns the states without a number, which are left empty.
+func applyStateMappings(fields []*data.Field, mappings []models.StateMapping) ([]*data.Field, []string) {
+	if len(mappings) == 0 {
+		return fields, nil
+	}
+	var measureNames *data.Field
+	for _, field := range fields {
+		if field.Name == "measure_name" {
+			measureNames = field
+		}
+	}
+
+	var unmapped []string
+	for i, field := range fields {
+		if field == measureNames || field.Type() != data.FieldTypeNullableString && field.Type() != data.FieldTypeString {
+			continue
+		}
+		measureAt := func(int) string { return field.Name }
+		if field.Name == measureValueVarchar && measureNames != nil {
+			measureAt = func(row int) string {
+				v, _ := measureNames.ConcreteAt(row)
+				name, _ := v.(string)
+				return name
+			}
+		}
+		mapped, missing := mapStates(field, stateMappings(mappings), measureAt)
+		if mapped == nil {
+			continue
+		}
+		fields[i] = mapped
+		unmapped = append(unmapped, missing...)
+	}
+	return fields, unmapped
+}
+
+// mapStates returns the numbers of the states of the field, or nil when no row
+// has a mapped measure. The states of a number are kept as value mappings, so
+// panels still show them.
+func mapStates(field *data.Field, mappings stateMappings, measureAt func(row int) string) (*data.Field, []string) {
+	rows := make([]map[string]float64, field.Len())
+	found := false
+	for row := range field.Len() {
+		rows[row] = mappings.states(measureAt(row))
+		found = found || rows[row] != nil
+	}
+	if !found {
+		return nil, nil
+	}
+
+	out := data.NewFieldFromFieldType(data.FieldTypeNullableFloat64, field.Len())
+	out.Name = field.Name
+	out.Labels = field.Labels
+	texts := map[string][]string{}
+	var missing []string
+	for row, states := range rows {
+		v, ok := field.ConcreteAt(row)
+		if !ok {
+			continue
+		}
+		state, _ := v.(string)
+		n, mapped := states[state]
+		if !mapped {
+			if !slices.Contains(missing, state) {
+				missing = append(missing, state)
+			}
+			continue
+		}
+		out.Set(row, &n)
+		text := strconv.FormatFloat(n, 'f', -1, 64)
+		if !slices.Contains(texts[text], state) {
+			texts[text] = append(texts[text], state)
+		}
+	}
+
+	config := &data.FieldConfig{}
+	if field.Config != nil {
+		copied := *field.Config
+		config = &copied
+	}
+	mapper := data.ValueMapper{}
+	for text, states := range texts {
+		slices.Sort(states)
+		mapper[text] = data.ValueMappingResult{Text: strings.Join(states, ", ")}
+	}
+	config.Mappings = append(slices.Clone(config.Mappings), mapper)
+	out.SetConfig(config)
+	return out, missing
+}
+
+// unmappedStatesNotice names a few of the states left empty by the state mappings
+func unmappedStatesNotice(states []string) data.Notice {
+	const listed = 5
+	names := slices.Clone(states)
+	slices.Sort(names)
+	names = slices.Compact(names)
+	text := strings.Join(names[:min(len(names), listed)], ", ")
+	if len(names) > listed {
+		text += fmt.Sprintf(" and %d more", len(names)-listed)
+	}
+	return data.Notice{
+		Severity: data.NoticeSeverityWarning,
+		Text:     "States without a state mapping are shown as empty values: " + text,
+	}
+}
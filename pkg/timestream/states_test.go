@@ -0,0 +1,114 @@
+package timestream
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/timestreamquery"
+	timestreamquerytypes "github.com/aws/aws-sdk-go-v2/service/timestreamquery/types"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/grafana/timestream-datasource/pkg/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var connectivityStates = []models.StateMapping{
+	{Measure: "connectivity", States: map[string]float64{"online": 1, "offline": 0}},
+	{Measure: "*_mode", States: map[string]float64{"auto": 1, "manual": 2, "override": 2}},
+}
+
+func TestApplyStateMappings(t *testing.T) {
+	fields := []*data.Field{
+		data.NewField("device", nil, []*string{strPtr("d1"), strPtr("d2"), strPtr("d3")}),
+		data.NewField("connectivity", nil, []*string{strPtr("online"), strPtr("offline"), nil}),
+		data.NewField("charging_mode", nil, []string{"manual", "override", "eco"}),
+	}
+
+	out, unmapped := applyStateMappings(fields, connectivityStates)
+	require.Len(t, out, 3)
+	assert.Equal(t, data.FieldTypeNullableString, out[0].Type())
+
+	assert.Equal(t, data.FieldTypeNullableFloat64, out[1].Type())
+	assert.Equal(t, 1.0, *out[1].At(0).(*float64))
+	assert.Equal(t, 0.0, *out[1].At(1).(*float64))
+	assert.Nil(t, out[1].At(2))
+	assert.Equal(t, data.ValueMappings{data.ValueMapper{
+		"0": {Text: "offline"},
+		"1": {Text: "online"},
+	}}, out[1].Config.Mappings)
+
+	// states sharing a number are shown together, unmapped states are empty
+	assert.Equal(t, 2.0, *out[2].At(0).(*float64))
+	assert.Nil(t, out[2].At(2))
+	assert.Equal(t, data.ValueMapper{"2": {Text: "manual, override"}}, out[2].Config.Mappings[0])
+	assert.Equal(t, []string{"eco"}, unmapped)
+}
+
+func TestApplyStateMappings_MeasureValue(t *testing.T) {
+	fields := []*data.Field{
+		data.NewField("measure_name", nil, []*string{strPtr("connectivity"), strPtr("firmware")}),
+		data.NewField(measureValueVarchar, nil, []*string{strPtr("offline"), strPtr("1.2.3")}),
+	}
+
+	out, unmapped := applyStateMappings(fields, connectivityStates)
+	assert.Equal(t, data.FieldTypeNullableString, out[0].Type())
+	assert.Equal(t, data.FieldTypeNullableFloat64, out[1].Type())
+	assert.Equal(t, 0.0, *out[1].At(0).(*float64))
+	// a measure without a mapping in the same column
+	assert.Nil(t, out[1].At(1))
+	assert.Equal(t, []string{"1.2.3"}, unmapped)
+
+	// nothing to map
+	fields = []*data.Field{data.NewField("measure_name", nil, []string{"firmware"}), data.NewField(measureValueVarchar, nil, []string{"1.2.3"})}
+	out, unmapped = applyStateMappings(fields, connectivityStates)
+	assert.Equal(t, data.FieldTypeString, out[1].Type())
+	assert.Empty(t, unmapped)
+}
+
+func TestExecuteQuery_StateMappings(t *testing.T) {
+	varchar := &timestreamquerytypes.Type{ScalarType: timestreamquerytypes.ScalarTypeVarchar}
+	row := func(ts, device, state string) timestreamquerytypes.Row {
+		return timestreamquerytypes.Row{Data: []timestreamquerytypes.Datum{
+			{ScalarValue: aws.String(ts)}, {ScalarValue: aws.String(device)}, {ScalarValue: aws.String("connectivity")}, {ScalarValue: aws.String(state)},
+		}}
+	}
+	input := &timestreamquery.QueryOutput{
+		ColumnInfo: []timestreamquerytypes.ColumnInfo{
+			{Name: aws.String("time"), Type: &timestreamquerytypes.Type{ScalarType: timestreamquerytypes.ScalarTypeTimestamp}},
+			{Name: aws.String("device"), Type: varchar},
+			{Name: aws.String("measure_name"), Type: varchar},
+			{Name: aws.String(measureValueVarchar), Type: varchar},
+		},
+		Rows: []timestreamquerytypes.Row{
+			row("2024-01-01 00:00:00.000000000", "d1", "online"),
+			row("2024-01-01 00:01:00.000000000", "d1", "unknown"),
+		},
+	}
+
+	// the mappings of the datasource settings
+	ds := &timestreamDS{
+		Client:   &tableClient{outputs: map[string]*timestreamquery.QueryOutput{"connectivity": input}},
+		Settings: models.DatasourceSettings{StateMappings: connectivityStates},
+	}
+	res := ds.ExecuteQuery(context.Background(), models.QueryModel{
+		Format:   models.FormatOptionTimeSeries,
+		RawQuery: `SELECT * FROM db.states WHERE time > ago(1h) AND measure_name = 'connectivity'`,
+	})
+	require.NoError(t, res.Error)
+	require.Len(t, res.Frames, 1)
+	frame := res.Frames[0]
+	require.Len(t, frame.Fields, 2)
+	value := frame.Fields[1]
+	assert.Equal(t, data.FieldTypeNullableFloat64, value.Type())
+	assert.Equal(t, data.Labels{"device": "d1", "measure_name": "connectivity"}, value.Labels)
+	assert.Equal(t, 1.0, *value.At(0).(*float64))
+	assert.Nil(t, value.At(1))
+	require.Len(t, frame.Meta.Notices, 1)
+	assert.Equal(t, "States without a state mapping are shown as empty values: unknown", frame.Meta.Notices[0].Text)
+}
+
+func TestUnmappedStatesNotice(t *testing.T) {
+	notice := unmappedStatesNotice([]string{"g", "f", "e", "d", "c", "b", "a", "a"})
+	assert.Equal(t, "States without a state mapping are shown as empty values: a, b, c, d, e and 2 more", notice.Text)
+}
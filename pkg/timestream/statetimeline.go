@@ -0,0 +1,101 @@
+package timestream
+
+import (
+	"reflect"
+	"sort"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+// stateTimelineFrames converts each series of the frames to a frame of the
+// ranges where its value doesn't change: the start of a range in "time", its
+// end in "timeEnd" and the value. A state lasts until the next one starts, the
+// last one until the last point of its series. Empty values are states too, so
+// gaps stay gaps.
+func stateTimelineFrames(frames data.Frames) data.Frames {
+	out := make(data.Frames, 0, len(frames))
+	for _, frame := range frames {
+		timeIdx := -1
+		for i, field := range frame.Fields {
+			if field.Type().Time() {
+				timeIdx = i
+				break
+			}
+		}
+		if timeIdx < 0 || frame.Rows() == 0 {
+			out = append(out, frame)
+			continue
+		}
+
+		times := frame.Fields[timeIdx]
+		rows := make([]int, frame.Rows())
+		for i := range rows {
+			rows[i] = i
+		}
+		sort.SliceStable(rows, func(a, b int) bool {
+			ta, _ := times.ConcreteAt(rows[a])
+			tb, _ := times.ConcreteAt(rows[b])
+			return timeBefore(ta, tb)
+		})
+
+		for i, field := range frame.Fields {
+			if i == timeIdx || field.Type().Time() {
+				continue
+			}
+			out = append(out, stateRanges(frame.Name, times, field, rows))
+		}
+	}
+	return out
+}
+
+// stateRanges merges the consecutive equal values of the field, visited in the
+// order of rows
+func stateRanges(name string, times, field *data.Field, rows []int) *data.Frame {
+	var starts []int
+	for i, row := range rows {
+		if i == 0 || !sameState(field, rows[i-1], row) {
+			starts = append(starts, row)
+		}
+	}
+
+	start := data.NewFieldFromFieldType(times.Type(), len(starts))
+	start.Name = "time"
+	end := data.NewFieldFromFieldType(times.Type(), len(starts))
+	end.Name = "timeEnd"
+	value := data.NewFieldFromFieldType(field.Type(), len(starts))
+	value.Name = field.Name
+	value.Labels = field.Labels
+	value.Config = field.Config
+
+	for i, row := range starts {
+		start.Set(i, times.At(row))
+		value.Set(i, field.At(row))
+		if i+1 < len(starts) {
+			end.Set(i, times.At(starts[i+1]))
+			continue
+		}
+		end.Set(i, times.At(rows[len(rows)-1]))
+	}
+	return data.NewFrame(name, start, end, value)
+}
+
+// sameState compares the values of two rows, empty values are equal
+func sameState(field *data.Field, a, b int) bool {
+	va, okA := field.ConcreteAt(a)
+	vb, okB := field.ConcreteAt(b)
+	if !okA || !okB {
+		return okA == okB
+	}
+	return reflect.DeepEqual(va, vb)
+}
+
+// timeBefore orders times, empty ones first
+func timeBefore(a, b any) bool {
+	ta, okA := a.(time.Time)
+	tb, okB := b.(time.Time)
+	if !okA || !okB {
+		return !okA && okB
+	}
+	return ta.Before(tb)
+}
@@ -0,0 +1,103 @@
+package timestream
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/timestreamquery"
+	timestreamquerytypes "github.com/aws/aws-sdk-go-v2/service/timestreamquery/types"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/grafana/timestream-datasource/pkg/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStateTimelineFrames(t *testing.T) {
+	at := func(minute int) time.Time { return time.Date(2024, 1, 1, 0, minute, 0, 0, time.UTC) }
+	boolPtr := func(b bool) *bool { return &b }
+	frame := data.NewFrame("states",
+		data.NewField("time", nil, []time.Time{at(3), at(0), at(1), at(2), at(4), at(5)}),
+		data.NewField("online", data.Labels{"device": "d1"}, []*bool{boolPtr(true), boolPtr(true), boolPtr(true), nil, boolPtr(true), boolPtr(false)}),
+		data.NewField("mode", nil, []string{"auto", "auto", "auto", "auto", "auto", "auto"}),
+	)
+
+	out := stateTimelineFrames(data.Frames{frame, data.NewFrame("")})
+	require.Len(t, out, 3)
+
+	// the rows are ordered by time, the gap at 2 is a state of its own
+	online := out[0]
+	assert.Equal(t, "states", online.Name)
+	require.Len(t, online.Fields, 3)
+	assert.Equal(t, []string{"time", "timeEnd", "online"}, []string{online.Fields[0].Name, online.Fields[1].Name, online.Fields[2].Name})
+	assert.Equal(t, data.Labels{"device": "d1"}, online.Fields[2].Labels)
+	require.Equal(t, 4, online.Rows())
+	for i, want := range [][2]int{{0, 2}, {2, 3}, {3, 5}, {5, 5}} {
+		assert.Equal(t, at(want[0]), online.Fields[0].At(i))
+		assert.Equal(t, at(want[1]), online.Fields[1].At(i))
+	}
+	assert.Equal(t, true, *online.Fields[2].At(0).(*bool))
+	assert.Nil(t, online.Fields[2].At(1))
+	assert.Equal(t, false, *online.Fields[2].At(3).(*bool))
+
+	mode := out[1]
+	require.Equal(t, 1, mode.Rows())
+	assert.Equal(t, at(0), mode.Fields[0].At(0))
+	assert.Equal(t, at(5), mode.Fields[1].At(0))
+	assert.Equal(t, "auto", mode.Fields[2].At(0))
+
+	// frames without times are kept
+	assert.Equal(t, 0, out[2].Rows())
+}
+
+func TestExecuteQuery_StateTimeline(t *testing.T) {
+	varchar := &timestreamquerytypes.Type{ScalarType: timestreamquerytypes.ScalarTypeVarchar}
+	row := func(ts, device, status string) timestreamquerytypes.Row {
+		return timestreamquerytypes.Row{Data: []timestreamquerytypes.Datum{
+			{ScalarValue: aws.String(ts)}, {ScalarValue: aws.String(device)}, {ScalarValue: aws.String(status)},
+		}}
+	}
+	input := &timestreamquery.QueryOutput{
+		ColumnInfo: []timestreamquerytypes.ColumnInfo{
+			{Name: aws.String("time"), Type: &timestreamquerytypes.Type{ScalarType: timestreamquerytypes.ScalarTypeTimestamp}},
+			{Name: aws.String("device"), Type: varchar},
+			{Name: aws.String("status"), Type: &timestreamquerytypes.Type{ScalarType: timestreamquerytypes.ScalarTypeBigint}},
+		},
+		Rows: []timestreamquerytypes.Row{
+			row("2024-01-01 00:00:00.000000000", "d1", "1"),
+			row("2024-01-01 00:00:00.000000000", "d2", "0"),
+			row("2024-01-01 00:01:00.000000000", "d1", "1"),
+			row("2024-01-01 00:01:00.000000000", "d2", "0"),
+			row("2024-01-01 00:02:00.000000000", "d1", "0"),
+			row("2024-01-01 00:02:00.000000000", "d2", "0"),
+		},
+	}
+
+	tables := tableClient{outputs: map[string]*timestreamquery.QueryOutput{"status": input}}
+	// ranges span pages
+	for _, client := range []QueryClient{&tables, &pagedTableClient{tables}} {
+		ds := &timestreamDS{Client: client}
+		res := ds.ExecuteQuery(context.Background(), models.QueryModel{
+			Format:   models.FormatOptionStateTimeline,
+			RawQuery: `SELECT time, device, status FROM db.states WHERE time > ago(1h) AND measure_name = 'status' ORDER BY time`,
+		})
+		require.NoError(t, res.Error)
+		require.Len(t, res.Frames, 2)
+
+		d1 := res.Frames[0]
+		assert.Equal(t, data.Labels{"device": "d1"}, d1.Fields[2].Labels)
+		require.Equal(t, 2, d1.Rows())
+		assert.Equal(t, int64(1), *d1.Fields[2].At(0).(*int64))
+		assert.Equal(t, int64(0), *d1.Fields[2].At(1).(*int64))
+		assert.Equal(t, time.Date(2024, 1, 1, 0, 2, 0, 0, time.UTC), d1.Fields[1].At(0))
+		require.NotNil(t, d1.Meta)
+		assert.NotNil(t, d1.Meta.Custom)
+
+		d2 := res.Frames[1]
+		assert.Equal(t, data.Labels{"device": "d2"}, d2.Fields[2].Labels)
+		assert.Equal(t, 1, d2.Rows())
+		require.NotNil(t, d2.Meta)
+		assert.Contains(t, d2.Meta.ExecutedQueryString, "db.states")
+	}
+}
@@ -0,0 +1,215 @@
+package timestream
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"regexp"
+	"runtime"
+	"runtime/debug"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/timestream-datasource/pkg/models"
+	"github.com/grafana/timestream-datasource/pkg/timestream/validator"
+)
+
+// Entries kept for the support bundle
+const (
+	supportQueries = 50
+	supportErrors  = 20
+)
+
+const redacted = "[redacted]"
+
+// SupportBundle collects what the plugin maintainers need for a bug report. Queries
+// are de-parameterized and secrets removed, so it can be shared outside the organization.
+type SupportBundle struct {
+	GeneratedAt   time.Time         `json:"generatedAt"`
+	Versions      map[string]string `json:"versions"`
+	Settings      json.RawMessage   `json:"settings"`
+	Health        SupportHealth     `json:"health"`
+	RecentQueries []SupportQuery    `json:"recentQueries"`
+	RecentErrors  []SupportQuery    `json:"recentErrors"`
+}
+
+// SupportHealth is the outcome of the health check run for the bundle
+type SupportHealth struct {
+	Status  string `json:"status"`
+	Message string `json:"message"`
+}
+
+// SupportQuery is a recent query with its literals masked
+type SupportQuery struct {
+	Time       time.Time `json:"time"`
+	Query      string    `json:"query"`
+	DurationMs int64     `json:"durationMs,omitempty"`
+	Error      string    `json:"error,omitempty"`
+}
+
+// supportRecorder keeps the recent queries and errors of the datasource. A nil
+// recorder keeps nothing.
+type supportRecorder struct {
+	mu      sync.Mutex
+	queries []SupportQuery
+	errors  []SupportQuery
+}
+
+func newSupportRecorder() *supportRecorder {
+	return &supportRecorder{}
+}
+
+// quotedLiteral matches the literals Timestream echoes in error messages
+var quotedLiteral = regexp.MustCompile(`'(?:[^']|'')*'`)
+
+func (r *supportRecorder) record(query models.QueryModel, dr backend.DataResponse, now time.Time) {
+	if r == nil {
+		return
+	}
+	q := SupportQuery{Time: now.UTC(), Query: validator.Deparameterize(query.RawQuery)}
+	if len(dr.Frames) > 0 && dr.Frames[0].Meta != nil {
+		if meta, ok := dr.Frames[0].Meta.Custom.(*models.TimestreamCustomMeta); ok && meta.FinishTime > 0 {
+			q.DurationMs = meta.FinishTime - meta.StartTime
+		}
+	}
+	if dr.Error != nil {
+		q.Error = quotedLiteral.ReplaceAllString(dr.Error.Error(), "?")
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.queries = appendBounded(r.queries, q, supportQueries)
+	if q.Error != "" {
+		r.errors = appendBounded(r.errors, q, supportErrors)
+	}
+}
+
+func (r *supportRecorder) snapshot() ([]SupportQuery, []SupportQuery) {
+	if r == nil {
+		return []SupportQuery{}, []SupportQuery{}
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]SupportQuery{}, r.queries...), append([]SupportQuery{}, r.errors...)
+}
+
+// appendBounded appends q, dropping the oldest entries beyond n
+func appendBounded(entries []SupportQuery, q SupportQuery, n int) []SupportQuery {
+	entries = append(entries, q)
+	if len(entries) > n {
+		entries = append(entries[:0], entries[len(entries)-n:]...)
+	}
+	return entries
+}
+
+// supportBundle runs the health check and collects the bundle
+func (ds *timestreamDS) supportBundle(ctx context.Context) (SupportBundle, error) {
+	settings, err := json.Marshal(redactSettings(ds.Settings))
+	if err != nil {
+		return SupportBundle{}, err
+	}
+	bundle := SupportBundle{
+		GeneratedAt: time.Now().UTC(),
+		Versions:    supportVersions(ctx),
+		Settings:    settings,
+	}
+	health, err := ds.CheckHealth(ctx, &backend.CheckHealthRequest{})
+	if err != nil {
+		bundle.Health = SupportHealth{Status: backend.HealthStatusError.String(), Message: err.Error()}
+	} else {
+		bundle.Health = SupportHealth{Status: health.Status.String(), Message: health.Message}
+	}
+	bundle.RecentQueries, bundle.RecentErrors = ds.support.snapshot()
+	return bundle, nil
+}
+
+// redactSettings removes the credentials and the instance settings, which carry
+// the decrypted secure fields
+func redactSettings(settings models.DatasourceSettings) models.DatasourceSettings {
+	settings.Config = backend.DataSourceInstanceSettings{}
+	settings.AccessKey, settings.SecretKey, settings.SessionToken = "", "", ""
+	if settings.ExternalID != "" {
+		settings.ExternalID = redacted
+	}
+	if settings.Fallback != nil {
+		fallback := *settings.Fallback
+		if fallback.ExternalID != "" {
+			fallback.ExternalID = redacted
+		}
+		settings.Fallback = &fallback
+	}
+	// the accounts are copied, the datasource settings share their array
+	settings.Accounts = slices.Clone(settings.Accounts)
+	for i := range settings.Accounts {
+		if settings.Accounts[i].ExternalID != "" {
+			settings.Accounts[i].ExternalID = redacted
+		}
+	}
+	// queries keep their shape, without the literals naming tenants or customers
+	settings.KeepWarm = slices.Clone(settings.KeepWarm)
+	for i := range settings.KeepWarm {
+		settings.KeepWarm[i].Query = redactQuery(settings.KeepWarm[i].Query)
+	}
+	settings.Lookups = slices.Clone(settings.Lookups)
+	for i := range settings.Lookups {
+		if settings.Lookups[i].Query != "" {
+			settings.Lookups[i].Query = validator.Deparameterize(settings.Lookups[i].Query)
+		}
+	}
+	return settings
+}
+
+// redactQuery keeps only the deparameterized SQL of a panel query, its other
+// options like ad-hoc filters may carry literals too
+func redactQuery(query json.RawMessage) json.RawMessage {
+	var model struct {
+		RawQuery string `json:"rawQuery,omitempty"`
+	}
+	if json.Unmarshal(query, &model) != nil {
+		return nil
+	}
+	model.RawQuery = validator.Deparameterize(model.RawQuery)
+	out, _ := json.Marshal(model)
+	return out
+}
+
+// supportVersions reports the versions of the plugin, the plugin SDK and Go
+func supportVersions(ctx context.Context) map[string]string {
+	versions := map[string]string{
+		"plugin": backend.PluginConfigFromContext(ctx).PluginVersion,
+		"go":     runtime.Version(),
+	}
+	if info, ok := debug.ReadBuildInfo(); ok {
+		for _, dep := range info.Deps {
+			switch dep.Path {
+			case "github.com/grafana/grafana-plugin-sdk-go":
+				versions["pluginSDK"] = dep.Version
+			case "github.com/grafana/grafana-aws-sdk":
+				versions["awsSDK"] = dep.Version
+			}
+		}
+	}
+	return versions
+}
+
+// sendSupportBundle sends the bundle as a JSON download
+func (ds *timestreamDS) sendSupportBundle(ctx context.Context, sender backend.CallResourceResponseSender) error {
+	bundle, err := ds.supportBundle(ctx)
+	if err != nil {
+		return err
+	}
+	body, err := json.MarshalIndent(bundle, "", "  ")
+	if err != nil {
+		return err
+	}
+	return sender.Send(&backend.CallResourceResponse{
+		Status: http.StatusOK,
+		Headers: map[string][]string{
+			"Content-Type":        {"application/json"},
+			"Content-Disposition": {`attachment; filename="timestream-support-bundle.json"`},
+		},
+		Body: body,
+	})
+}
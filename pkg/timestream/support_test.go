@@ -0,0 +1,94 @@
+package timestream
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/timestreamquery"
+	timestreamquerytypes "github.com/aws/aws-sdk-go-v2/service/timestreamquery/types"
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/timestream-datasource/pkg/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSupportRecorder(t *testing.T) {
+	now := time.Now()
+	r := newSupportRecorder()
+	for i := 0; i < supportQueries+5; i++ {
+		r.record(models.QueryModel{RawQuery: "SELECT * FROM db.tbl WHERE device = 'a'"}, backend.DataResponse{}, now)
+	}
+	r.record(models.QueryModel{RawQuery: "SELECT * FROM db.tbl WHERE device = 'b'"}, backend.DataResponse{
+		Error: errors.New("column 'secret' does not exist"),
+	}, now)
+
+	queries, errs := r.snapshot()
+	assert.Len(t, queries, supportQueries)
+	assert.Equal(t, "SELECT * FROM db.tbl WHERE device = ?", queries[0].Query)
+	require.Len(t, errs, 1)
+	assert.Equal(t, "column ? does not exist", errs[0].Error)
+
+	var nilRecorder *supportRecorder
+	nilRecorder.record(models.QueryModel{RawQuery: "SELECT 1"}, backend.DataResponse{}, now)
+	queries, errs = nilRecorder.snapshot()
+	assert.Empty(t, queries)
+	assert.Empty(t, errs)
+}
+
+func TestRedactSettings(t *testing.T) {
+	settings := models.DatasourceSettings{
+		Config:   backend.DataSourceInstanceSettings{DecryptedSecureJSONData: map[string]string{"secretKey": "s3cr3t"}},
+		Fallback: &models.FallbackSettings{Region: "eu-central-1", ExternalID: "fallback-id"},
+		Accounts: []models.AccountTarget{{Name: "prod", ExternalID: "account-id"}},
+		KeepWarm: []models.KeepWarmQuery{
+			{Query: json.RawMessage(`{"rawQuery":"SELECT * FROM db.tbl WHERE tenant = 'acme-corp' AND time > ago(1h)","adhocFilters":[{"key":"customer","operator":"=","value":"globex"}]}`), Range: "6h"},
+			{Query: json.RawMessage(`not json`)},
+		},
+		Lookups: []models.LookupSource{{Name: "hosts", Query: "SELECT host, name FROM db.hosts WHERE customer_id = 4711 AND owner = 'initech'"}},
+	}
+	settings.AccessKey = "AKIA"
+	settings.SecretKey = "s3cr3t"
+	settings.ExternalID = "external-id"
+	settings.Region = "eu-west-1"
+
+	redactedSettings := redactSettings(settings)
+	body, err := json.Marshal(redactedSettings)
+	require.NoError(t, err)
+	for _, secret := range []string{"AKIA", "s3cr3t", "external-id", "fallback-id", "account-id", "acme-corp", "globex", "4711", "initech", "not json"} {
+		assert.NotContains(t, string(body), secret)
+	}
+	assert.Contains(t, string(body), "eu-west-1")
+	assert.Equal(t, "fallback-id", settings.Fallback.ExternalID, "the datasource settings are not modified")
+	assert.Equal(t, "account-id", settings.Accounts[0].ExternalID, "the datasource settings are not modified")
+	assert.JSONEq(t, `{"rawQuery":"SELECT * FROM db.tbl WHERE tenant = ? AND time > ago(?h)"}`, string(redactedSettings.KeepWarm[0].Query))
+	assert.Equal(t, "6h", redactedSettings.KeepWarm[0].Range)
+	assert.Equal(t, "SELECT host, name FROM db.hosts WHERE customer_id = ? AND owner = ?", redactedSettings.Lookups[0].Query)
+	assert.Contains(t, string(settings.KeepWarm[0].Query), "acme-corp", "the datasource settings are not modified")
+	assert.Contains(t, settings.Lookups[0].Query, "initech", "the datasource settings are not modified")
+}
+
+func TestCallResource_SupportBundle(t *testing.T) {
+	client := &fakeClient{output: &timestreamquery.QueryOutput{
+		Rows: []timestreamquerytypes.Row{{Data: []timestreamquerytypes.Datum{{ScalarValue: aws.String("1")}}}},
+	}}
+	ds := &timestreamDS{Client: client, support: newSupportRecorder()}
+	ds.support.record(models.QueryModel{RawQuery: "SELECT * FROM db.tbl WHERE time > ago(1h) AND host = 'web-1'"}, backend.DataResponse{}, time.Now())
+
+	sender := &fakeSender{}
+	err := ds.CallResource(context.Background(), &backend.CallResourceRequest{Path: "support-bundle", PluginContext: backend.PluginContext{User: &backend.User{Role: "Editor"}}}, sender)
+	require.ErrorContains(t, err, "requires the Admin role")
+	require.NoError(t, ds.CallResource(context.Background(), &backend.CallResourceRequest{Path: "support-bundle", PluginContext: backend.PluginContext{User: &backend.User{Role: "Admin"}}}, sender))
+	assert.Contains(t, sender.res.Headers["Content-Disposition"][0], "attachment")
+
+	bundle := SupportBundle{}
+	require.NoError(t, json.Unmarshal(sender.res.Body, &bundle))
+	assert.Equal(t, "OK", bundle.Health.Status)
+	assert.NotEmpty(t, bundle.Versions["go"])
+	require.Len(t, bundle.RecentQueries, 1)
+	assert.Equal(t, "SELECT * FROM db.tbl WHERE time > ago(?h) AND host = ?", bundle.RecentQueries[0].Query)
+	assert.Empty(t, bundle.RecentErrors)
+}
@@ -0,0 +1,177 @@
+package timestream
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/grafana/timestream-datasource/pkg/models"
+)
+
+// compareTables runs the query against both tables and compares the numeric
+// series of the results
+func (ds *timestreamDS) compareTables(ctx context.Context, req models.CompareTablesRequest) (*models.TableComparison, error) {
+	for _, ref := range []models.TableRef{req.Baseline, req.Candidate} {
+		if ref.Database == "" || ref.Table == "" {
+			return nil, fmt.Errorf("compare requires a database and a table for baseline and candidate")
+		}
+	}
+	query, err := ds.queryModel(backend.DataQuery{
+		JSON:      req.Query,
+		TimeRange: backend.TimeRange{From: req.From, To: req.To},
+	}, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	query.WaitForResult = true
+
+	run := func(ref models.TableRef) (models.TableResult, map[string]*comparedSeries, error) {
+		q := *query
+		q.Database, q.Table = ref.Database, ref.Table
+		dr := ds.ExecuteQuery(ctx, q)
+		if dr.Error != nil {
+			return models.TableResult{}, nil, fmt.Errorf("%s.%s: %w", ref.Database, ref.Table, dr.Error)
+		}
+		result := models.TableResult{TableRef: ref}
+		for _, frame := range dr.Frames {
+			if frame.Meta != nil && result.ExecutedQuery == "" {
+				result.ExecutedQuery = frame.Meta.ExecutedQueryString
+			}
+			if rows, err := frame.RowLen(); err == nil {
+				result.Rows += rows
+			}
+		}
+		return result, seriesOf(dr.Frames), nil
+	}
+
+	baseline, baseSeries, err := run(req.Baseline)
+	if err != nil {
+		return nil, err
+	}
+	candidate, candSeries, err := run(req.Candidate)
+	if err != nil {
+		return nil, err
+	}
+	return &models.TableComparison{
+		Baseline:  baseline,
+		Candidate: candidate,
+		Series:    diffSeries(baseSeries, candSeries),
+	}, nil
+}
+
+// comparedSeries holds the values of a numeric field by point key
+type comparedSeries struct {
+	name   string
+	labels data.Labels
+	values map[string]float64
+}
+
+// seriesOf collects the numeric fields of the frames, keyed by name and labels
+func seriesOf(frames data.Frames) map[string]*comparedSeries {
+	out := map[string]*comparedSeries{}
+	for _, frame := range frames {
+		keys := pointKeys(frame)
+		for _, field := range frame.Fields {
+			if !field.Type().Numeric() {
+				continue
+			}
+			id := field.Name + field.Labels.String()
+			s, ok := out[id]
+			if !ok {
+				s = &comparedSeries{name: field.Name, labels: field.Labels, values: map[string]float64{}}
+				out[id] = s
+			}
+			for i := 0; i < field.Len(); i++ {
+				v, err := field.NullableFloatAt(i)
+				if err != nil || v == nil {
+					continue
+				}
+				s.values[keys[i]] = *v
+			}
+		}
+	}
+	return out
+}
+
+// pointKeys identifies the rows of a frame by its time field, or by its string
+// fields for table results, falling back to the row number
+func pointKeys(frame *data.Frame) []string {
+	rows, _ := frame.RowLen()
+	keys := make([]string, rows)
+	var keyFields []*data.Field
+	for _, field := range frame.Fields {
+		if field.Type().Time() {
+			keyFields = []*data.Field{field}
+			break
+		}
+		if field.Type() == data.FieldTypeString || field.Type() == data.FieldTypeNullableString {
+			keyFields = append(keyFields, field)
+		}
+	}
+	for i := range keys {
+		if len(keyFields) == 0 {
+			keys[i] = strconv.Itoa(i)
+			continue
+		}
+		parts := make([]string, len(keyFields))
+		for j, field := range keyFields {
+			v, _ := field.ConcreteAt(i)
+			if t, ok := v.(time.Time); ok {
+				v = t.UnixMilli()
+			}
+			parts[j] = fmt.Sprint(v)
+		}
+		keys[i] = strings.Join(parts, "\x00")
+	}
+	return keys
+}
+
+// diffSeries compares the series of both results, ordered by name
+func diffSeries(baseline, candidate map[string]*comparedSeries) []models.SeriesDiff {
+	ids := map[string]bool{}
+	for id := range baseline {
+		ids[id] = true
+	}
+	for id := range candidate {
+		ids[id] = true
+	}
+	out := make([]models.SeriesDiff, 0, len(ids))
+	for id := range ids {
+		base, cand := baseline[id], candidate[id]
+		if base == nil {
+			base = &comparedSeries{name: cand.name, labels: cand.labels}
+		}
+		if cand == nil {
+			cand = &comparedSeries{name: base.name, labels: base.labels}
+		}
+		diff := models.SeriesDiff{Name: base.name, Labels: base.labels}
+		for key, b := range base.values {
+			c, ok := cand.values[key]
+			if !ok {
+				diff.MissingInCandidate++
+				continue
+			}
+			diff.Matched++
+			diff.MaxAbsDelta = math.Max(diff.MaxAbsDelta, math.Abs(b-c))
+		}
+		for key := range cand.values {
+			if _, ok := base.values[key]; !ok {
+				diff.MissingInBaseline++
+			}
+		}
+		out = append(out, diff)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Name != out[j].Name {
+			return out[i].Name < out[j].Name
+		}
+		return data.Labels(out[i].Labels).String() < data.Labels(out[j].Labels).String()
+	})
+	return out
+}
@@ -0,0 +1,94 @@
+package timestream
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/timestreamquery"
+	timestreamquerytypes "github.com/aws/aws-sdk-go-v2/service/timestreamquery/types"
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/grafana/timestream-datasource/pkg/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// tableClient answers queries with the output of the first table they mention
+type tableClient struct {
+	outputs map[string]*timestreamquery.QueryOutput
+}
+
+func (c *tableClient) Query(_ context.Context, input *timestreamquery.QueryInput, _ ...func(*timestreamquery.Options)) (*timestreamquery.QueryOutput, error) {
+	for table, output := range c.outputs {
+		if strings.Contains(*input.QueryString, table) {
+			return output, nil
+		}
+	}
+	return &timestreamquery.QueryOutput{}, nil
+}
+
+func (c *tableClient) CancelQuery(context.Context, *timestreamquery.CancelQueryInput, ...func(*timestreamquery.Options)) (*timestreamquery.CancelQueryOutput, error) {
+	return nil, nil
+}
+
+func deviceValues(rows ...[2]string) *timestreamquery.QueryOutput {
+	output := &timestreamquery.QueryOutput{ColumnInfo: []timestreamquerytypes.ColumnInfo{
+		{Name: aws.String("device"), Type: &timestreamquerytypes.Type{ScalarType: timestreamquerytypes.ScalarTypeVarchar}},
+		{Name: aws.String("value"), Type: &timestreamquerytypes.Type{ScalarType: timestreamquerytypes.ScalarTypeDouble}},
+	}}
+	for _, row := range rows {
+		output.Rows = append(output.Rows, timestreamquerytypes.Row{Data: []timestreamquerytypes.Datum{{ScalarValue: aws.String(row[0])}, {ScalarValue: aws.String(row[1])}}})
+	}
+	return output
+}
+
+func TestCompareTables(t *testing.T) {
+	ds := &timestreamDS{Client: &tableClient{outputs: map[string]*timestreamquery.QueryOutput{
+		"db.raw":    deviceValues([2]string{"a", "1.5"}, [2]string{"b", "2"}, [2]string{"c", "3"}),
+		"db.rollup": deviceValues([2]string{"a", "1.25"}, [2]string{"b", "2"}, [2]string{"d", "4"}),
+	}}}
+	comparison, err := ds.compareTables(context.Background(), models.CompareTablesRequest{
+		Query:     []byte(`{"rawQuery":"SELECT device, avg(value) AS value FROM $__database.$__table WHERE time > ago(1h) AND measure_name = 'cpu' GROUP BY device"}`),
+		From:      time.Now().Add(-time.Hour),
+		To:        time.Now(),
+		Baseline:  models.TableRef{Database: "db", Table: "raw"},
+		Candidate: models.TableRef{Database: "db", Table: "rollup"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 3, comparison.Baseline.Rows)
+	assert.Contains(t, comparison.Baseline.ExecutedQuery, "FROM db.raw")
+	assert.Contains(t, comparison.Candidate.ExecutedQuery, "FROM db.rollup")
+	require.Len(t, comparison.Series, 1)
+	assert.Equal(t, models.SeriesDiff{Name: "value", Matched: 2, MissingInBaseline: 1, MissingInCandidate: 1, MaxAbsDelta: 0.25}, comparison.Series[0])
+
+	_, err = ds.compareTables(context.Background(), models.CompareTablesRequest{Baseline: models.TableRef{Database: "db", Table: "raw"}})
+	assert.Error(t, err)
+}
+
+func TestSeriesOf_TimeSeries(t *testing.T) {
+	now := time.UnixMilli(1700000000000)
+	frame := func(values ...float64) data.Frames {
+		return data.Frames{data.NewFrame("",
+			data.NewField("time", nil, []time.Time{now, now.Add(time.Minute)}[:len(values)]),
+			data.NewField("cpu", data.Labels{"host": "a"}, values),
+		)}
+	}
+	diffs := diffSeries(seriesOf(frame(1, 2)), seriesOf(frame(1.5)))
+	require.Len(t, diffs, 1)
+	assert.Equal(t, models.SeriesDiff{Name: "cpu", Labels: map[string]string{"host": "a"}, Matched: 1, MissingInCandidate: 1, MaxAbsDelta: 0.5}, diffs[0])
+}
+
+func TestCallResource_Compare(t *testing.T) {
+	ds := &timestreamDS{Client: &tableClient{}}
+	sender := &fakeSender{}
+	err := ds.CallResource(context.Background(), &backend.CallResourceRequest{
+		Method: "POST",
+		Path:   "compare",
+		Body:   []byte(`{"query":{"rawQuery":"SELECT 1"},"baseline":{"database":"db","table":"a"},"candidate":{"database":"db","table":"b"}}`),
+	}, sender)
+	require.NoError(t, err)
+	assert.Contains(t, string(sender.res.Body), `"series":[]`)
+}
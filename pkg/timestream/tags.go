@@ -0,0 +1,116 @@
+package timestream
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	timestreamquerytypes "github.com/aws/aws-sdk-go-v2/service/timestreamquery/types"
+	"github.com/grafana/timestream-datasource/pkg/models"
+)
+
+const (
+	// Tag values are only read from this far back, so the scan stays bounded
+	tagValuesLookback = 24 * time.Hour
+	// At most this many values are offered for a key
+	maxTagValues = 1000
+	// How long the values of a key are answered from the cache
+	tagValuesTTL = 5 * time.Minute
+)
+
+// tagTable resolves the table of a tag request to the defaults of the datasource,
+// other tables have to be listed in adhocTables
+func (ds *timestreamDS) tagTable(database, table string) (string, string, error) {
+	database = valueOrDefault(database, ds.Settings.DefaultDatabase)
+	table = valueOrDefault(table, ds.Settings.DefaultTable)
+	if database == "" || table == "" {
+		return "", "", fmt.Errorf("ad-hoc filters require a database and a table")
+	}
+	if !ds.adhocTable(database, table) {
+		return "", "", fmt.Errorf("ad-hoc filters can't read %s.%s, it is neither the default table nor listed in adhocTables", database, table)
+	}
+	return database, table, nil
+}
+
+// adhocTable reports whether the table is the default table or listed as
+// "db.table" or "table" in adhocTables, names are compared without quotes
+func (ds *timestreamDS) adhocTable(database, table string) bool {
+	database, table = strings.Trim(database, `"`), strings.Trim(table, `"`)
+	if database == strings.Trim(ds.Settings.DefaultDatabase, `"`) && table == strings.Trim(ds.Settings.DefaultTable, `"`) {
+		return true
+	}
+	for _, name := range ds.Settings.AdhocTables {
+		if name == database+"."+table || name == table {
+			return true
+		}
+	}
+	return false
+}
+
+// tagKeys returns the dimensions of all measures of the table, ordered by name
+func (ds *timestreamDS) tagKeys(ctx context.Context, req models.TagKeysRequest) ([]string, error) {
+	database, table, err := ds.tagTable(req.Database, req.Table)
+	if err != nil {
+		return nil, err
+	}
+	v, err := ds.showMeasures(ctx, database, table)
+	if err != nil {
+		return nil, err
+	}
+	seen := map[string]bool{}
+	keys := []string{}
+	for _, row := range v.Rows {
+		for _, key := range dimensionsFromRows([]timestreamquerytypes.Row{row}) {
+			if !seen[key] {
+				seen[key] = true
+				keys = append(keys, key)
+			}
+		}
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+// tagValuesSQL selects the distinct values of the key within the lookback
+func tagValuesSQL(database, table, key string, filters []models.AdhocFilter) (string, error) {
+	column := quoteIdentifier(key)
+	sql := fmt.Sprintf("SELECT DISTINCT %s FROM %s.%s WHERE time > ago(%dh) AND %s IS NOT NULL",
+		column, quoteIdentifier(database), quoteIdentifier(table), int(tagValuesLookback.Hours()), column)
+	others := []models.AdhocFilter{}
+	for _, f := range filters {
+		if f.Key != key {
+			others = append(others, f)
+		}
+	}
+	if len(others) > 0 {
+		predicate, err := adhocPredicate(others)
+		if err != nil {
+			return "", err
+		}
+		sql += " AND " + predicate
+	}
+	return fmt.Sprintf("%s ORDER BY %s LIMIT %d", sql, column, maxTagValues), nil
+}
+
+// tagValues returns the values of a dimension of the table, at most maxTagValues.
+// The lookup is checked like panel queries, see metadataQuery.
+func (ds *timestreamDS) tagValues(ctx context.Context, req models.TagValuesRequest, now time.Time) ([]string, error) {
+	if req.Key == "" {
+		return nil, fmt.Errorf("tag-values requires a key")
+	}
+	database, table, err := ds.tagTable(req.Database, req.Table)
+	if err != nil {
+		return nil, err
+	}
+	sql, err := tagValuesSQL(database, table, req.Key, req.Filters)
+	if err != nil {
+		return nil, err
+	}
+	output, err := ds.metadataQuery(ctx, ds.tagValuesCache, "tag-values", models.QueryModel{RawQuery: sql}, maxTagValues, now)
+	if err != nil {
+		return nil, err
+	}
+	return sliceFromRows(output.Rows, false), nil
+}
@@ -0,0 +1,130 @@
+package timestream
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/timestreamquery"
+	timestreamquerytypes "github.com/aws/aws-sdk-go-v2/service/timestreamquery/types"
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/timestream-datasource/pkg/models"
+	"github.com/grafana/timestream-datasource/pkg/timestream/validator"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func measureRow(measure string, dimensions ...string) timestreamquerytypes.Row {
+	dims := []timestreamquerytypes.Datum{}
+	for _, d := range dimensions {
+		dims = append(dims, timestreamquerytypes.Datum{RowValue: &timestreamquerytypes.Row{Data: []timestreamquerytypes.Datum{{ScalarValue: aws.String(d)}}}})
+	}
+	return timestreamquerytypes.Row{Data: []timestreamquerytypes.Datum{{ScalarValue: aws.String(measure)}, {ScalarValue: aws.String("double")}, {ArrayValue: dims}}}
+}
+
+func TestTagKeys(t *testing.T) {
+	client := &fakeClient{output: &timestreamquery.QueryOutput{Rows: []timestreamquerytypes.Row{
+		measureRow("cpu", "host", "region"),
+		measureRow("temperature", "site", "host"),
+	}}}
+	ds := &timestreamDS{Client: client, Settings: models.DatasourceSettings{DefaultDatabase: "db", DefaultTable: "metrics"}}
+
+	keys, err := ds.tagKeys(context.Background(), models.TagKeysRequest{})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"host", "region", "site"}, keys)
+	assert.Equal(t, `SHOW MEASURES FROM "db"."metrics"`, *client.calls.runQuery[0].QueryString)
+
+	_, err = (&timestreamDS{Client: client}).tagKeys(context.Background(), models.TagKeysRequest{Table: "metrics"})
+	assert.Error(t, err)
+}
+
+func TestTagValuesSQL(t *testing.T) {
+	sql, err := tagValuesSQL("db", "metrics", "host", []models.AdhocFilter{
+		{Key: "host", Operator: "=", Value: "a"},
+		{Key: "region", Operator: "=~", Value: "eu-.*"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, `SELECT DISTINCT "host" FROM "db"."metrics" WHERE time > ago(24h) AND "host" IS NOT NULL AND regexp_like("region", 'eu-.*') ORDER BY "host" LIMIT 1000`, sql)
+
+	_, err = tagValuesSQL("db", "metrics", "host", []models.AdhocFilter{{Key: "region", Operator: "~"}})
+	assert.Error(t, err)
+}
+
+func TestTagValues(t *testing.T) {
+	now := time.Now()
+	client := &fakeClient{output: &timestreamquery.QueryOutput{Rows: []timestreamquerytypes.Row{
+		{Data: []timestreamquerytypes.Datum{{ScalarValue: aws.String("a")}}},
+		{Data: []timestreamquerytypes.Datum{{ScalarValue: aws.String("b")}}},
+	}}}
+	sink := &fakeAuditSink{}
+	ds := &timestreamDS{
+		Client:         client,
+		Settings:       models.DatasourceSettings{DefaultDatabase: "db", DefaultTable: "metrics"},
+		tagValuesCache: newResultCache(time.Minute),
+		audit:          newAuditLogger(sink, 100, time.Hour),
+	}
+	req := models.TagValuesRequest{Key: "host", Filters: []models.AdhocFilter{{Key: "measure_name", Operator: "=", Value: "cpu"}}}
+
+	values, err := ds.tagValues(context.Background(), req, now)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a", "b"}, values)
+	_, err = ds.tagValues(context.Background(), req, now.Add(30*time.Second))
+	require.NoError(t, err)
+	assert.Len(t, client.calls.runQuery, 1)
+
+	// checked like panel queries
+	_, err = ds.tagValues(context.Background(), models.TagValuesRequest{Key: "host"}, now)
+	assert.ErrorContains(t, err, "measure_name")
+	_, err = ds.tagValues(context.Background(), models.TagValuesRequest{Key: "host", Table: "secrets"}, now)
+	assert.ErrorContains(t, err, "adhocTables")
+	assert.Len(t, client.calls.runQuery, 1)
+
+	_, err = ds.tagValues(context.Background(), models.TagValuesRequest{}, now)
+	assert.ErrorContains(t, err, "requires a key")
+
+	ds.audit.close()
+	assert.Equal(t, 3, sink.count())
+}
+
+func TestTagValues_Budget(t *testing.T) {
+	client := &fakeClient{output: &timestreamquery.QueryOutput{}}
+	ds := &timestreamDS{
+		Client:   client,
+		Settings: models.DatasourceSettings{DefaultDatabase: "db", DefaultTable: "metrics", Validator: &validator.Options{AllowMissingMeasure: true}},
+		budget:   newQueryBudget(1),
+	}
+	now := time.Now()
+	_, err := ds.tagValues(context.Background(), models.TagValuesRequest{Key: "host"}, now)
+	require.NoError(t, err)
+	_, err = ds.tagValues(context.Background(), models.TagValuesRequest{Key: "site"}, now)
+	assert.ErrorContains(t, err, "budget")
+	assert.Len(t, client.calls.runQuery, 1)
+}
+
+func TestTagTable(t *testing.T) {
+	ds := &timestreamDS{Settings: models.DatasourceSettings{DefaultDatabase: "db", DefaultTable: "metrics", AdhocTables: []string{"db.events", "logs"}}}
+	for _, table := range [][2]string{{"", ""}, {`"db"`, `"metrics"`}, {"db", "events"}, {"other", "logs"}} {
+		_, _, err := ds.tagTable(table[0], table[1])
+		assert.NoError(t, err, table)
+	}
+	for _, table := range [][2]string{{"other", "metrics"}, {"db", "secrets"}, {"other", "events"}} {
+		_, _, err := ds.tagTable(table[0], table[1])
+		assert.Error(t, err, table)
+	}
+}
+
+func TestCallResource_TagValues(t *testing.T) {
+	client := &fakeClient{output: &timestreamquery.QueryOutput{Rows: []timestreamquerytypes.Row{
+		{Data: []timestreamquerytypes.Datum{{ScalarValue: aws.String("a")}}},
+	}}}
+	ds := &timestreamDS{Client: client, Settings: models.DatasourceSettings{AdhocTables: []string{"db.metrics"}}}
+	sender := &fakeSender{}
+	err := ds.CallResource(context.Background(), &backend.CallResourceRequest{
+		Method: "POST",
+		Path:   "tag-values",
+		Body:   []byte(`{"database":"db","table":"metrics","key":"host","filters":[{"key":"measure_name","operator":"=","value":"cpu"}]}`),
+	}, sender)
+	require.NoError(t, err)
+	assert.Equal(t, `["a"]`, string(sender.res.Body))
+}
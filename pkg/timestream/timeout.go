@@ -0,0 +1,31 @@
+package timestream
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/grafana/timestream-datasource/pkg/models"
+)
+
+// queryTimeout returns the request timeout of the query, zero for none. Queries may
+// set a longer timeout than the datasource default, up to the datasource maximum.
+func queryTimeout(query models.QueryModel, settings models.DatasourceSettings) (time.Duration, error) {
+	if query.TimeoutSeconds < 0 {
+		return 0, fmt.Errorf("invalid timeout: %ds", query.TimeoutSeconds)
+	}
+	if query.TimeoutSeconds == 0 {
+		return time.Duration(settings.QueryTimeoutSeconds) * time.Second, nil
+	}
+	if limit := settings.MaxQueryTimeoutSeconds; limit > 0 && query.TimeoutSeconds > limit {
+		return 0, fmt.Errorf("timeout of %ds exceeds the datasource maximum of %ds", query.TimeoutSeconds, limit)
+	}
+	return time.Duration(query.TimeoutSeconds) * time.Second, nil
+}
+
+// deadlineNear reports whether the context ends before another page, taking as
+// long as the slowest page so far, would be read
+func deadlineNear(ctx context.Context, page time.Duration, now time.Time) bool {
+	deadline, ok := ctx.Deadline()
+	return ok && deadline.Sub(now) < page
+}
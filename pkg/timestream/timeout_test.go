@@ -0,0 +1,123 @@
+package timestream
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/timestreamquery"
+	timestreamquerytypes "github.com/aws/aws-sdk-go-v2/service/timestreamquery/types"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/grafana/timestream-datasource/pkg/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQueryTimeout(t *testing.T) {
+	settings := models.DatasourceSettings{QueryTimeoutSeconds: 30, MaxQueryTimeoutSeconds: 300}
+	tests := []struct {
+		name     string
+		query    int
+		settings models.DatasourceSettings
+		want     time.Duration
+		err      string
+	}{
+		{name: "datasource default", settings: settings, want: 30 * time.Second},
+		{name: "longer panel timeout", query: 120, settings: settings, want: 120 * time.Second},
+		{name: "above the maximum", query: 600, settings: settings, err: "exceeds the datasource maximum of 300s"},
+		{name: "negative", query: -1, settings: settings, err: "invalid timeout"},
+		{name: "no limits", query: 600, want: 600 * time.Second},
+		{name: "none"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := queryTimeout(models.QueryModel{TimeoutSeconds: tt.query}, tt.settings)
+			if tt.err != "" {
+				assert.ErrorContains(t, err, tt.err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+// blockingClient answers when the request context is done
+type blockingClient struct {
+	fakeClient
+}
+
+func (c *blockingClient) Query(ctx context.Context, _ *timestreamquery.QueryInput, _ ...func(*timestreamquery.Options)) (*timestreamquery.QueryOutput, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func TestExecuteQuery_Timeout(t *testing.T) {
+	ds := &timestreamDS{Client: &blockingClient{}, Settings: models.DatasourceSettings{MaxQueryTimeoutSeconds: 5}}
+	query := models.QueryModel{RawQuery: "SELECT * FROM db.tbl WHERE time > ago(1h) AND measure_name = 'cpu'", TimeoutSeconds: 1}
+
+	dr := ds.ExecuteQuery(context.Background(), query)
+	require.Error(t, dr.Error)
+	assert.Contains(t, dr.Error.Error(), "query timed out after 1s")
+
+	query.TimeoutSeconds = 10
+	dr = ds.ExecuteQuery(context.Background(), query)
+	require.Error(t, dr.Error)
+	assert.Contains(t, dr.Error.Error(), "exceeds the datasource maximum")
+}
+
+// slowPagesClient answers the first page with a row and blocks on the next ones
+type slowPagesClient struct {
+	fakeClient
+}
+
+func (c *slowPagesClient) Query(ctx context.Context, input *timestreamquery.QueryInput, _ ...func(*timestreamquery.Options)) (*timestreamquery.QueryOutput, error) {
+	if input.NextToken == nil {
+		return &timestreamquery.QueryOutput{
+			QueryId:    aws.String("q1"),
+			NextToken:  aws.String("page-2"),
+			ColumnInfo: []timestreamquerytypes.ColumnInfo{{Name: aws.String("host"), Type: &timestreamquerytypes.Type{ScalarType: "VARCHAR"}}},
+			Rows:       []timestreamquerytypes.Row{{Data: []timestreamquerytypes.Datum{{ScalarValue: aws.String("a")}}}},
+		}, nil
+	}
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func TestExecuteQuery_TruncatedAtDeadline(t *testing.T) {
+	ds := &timestreamDS{Client: &slowPagesClient{}}
+	query := models.QueryModel{RawQuery: "SELECT host FROM db.tbl WHERE time > ago(1h) AND measure_name = 'cpu'", WaitForResult: true}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	dr := ds.ExecuteQuery(ctx, query)
+	require.NoError(t, dr.Error)
+	require.Len(t, dr.Frames, 1)
+	assert.Equal(t, 1, dr.Frames[0].Rows())
+	assert.Contains(t, dr.Frames[0].Meta.Notices, data.Notice{
+		Severity: data.NoticeSeverityWarning,
+		Text:     "Results truncated due to timeout after 1 rows",
+	})
+	custom := dr.Frames[0].Meta.Custom.(*models.TimestreamCustomMeta)
+	assert.Empty(t, custom.NextToken)
+	assert.True(t, custom.TruncatedByTimeout)
+	assert.False(t, cacheable(query, dr), "partial results are not cached")
+
+	// without pages read there is nothing to show
+	ds = &timestreamDS{Client: &blockingClient{}}
+	ctx, cancel = context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	require.Error(t, ds.ExecuteQuery(ctx, query).Error)
+}
+
+func TestDeadlineNear(t *testing.T) {
+	now := time.Now()
+	assert.False(t, deadlineNear(context.Background(), time.Hour, now))
+
+	ctx, cancel := context.WithDeadline(context.Background(), now.Add(10*time.Second))
+	defer cancel()
+	assert.False(t, deadlineNear(ctx, 5*time.Second, now))
+	assert.True(t, deadlineNear(ctx, 15*time.Second, now))
+	assert.True(t, deadlineNear(ctx, time.Second, now.Add(10*time.Second)))
+}
@@ -0,0 +1,86 @@
+package validator
+
+import "strings"
+
+// selectListEnd are the keywords ending the select list of a SELECT
+var selectListEnd = map[string]bool{"from": true, "where": true, "group": true, "order": true, "having": true, "union": true}
+
+// measureAliases returns the names measure_name is projected under, e.g. m for
+// WITH c AS (SELECT measure_name AS m ...), with the name of the CTE projecting
+// it, or "" for subqueries
+func measureAliases(toks []token) map[string]string {
+	var aliases map[string]string
+	for i := 0; i+2 < len(toks); i++ {
+		if toks[i].kind != tkIdent || toks[i].val != "measure_name" ||
+			toks[i+1].kind != tkKeyword || toks[i+1].val != "as" || toks[i+2].kind != tkIdent {
+			continue
+		}
+		sel := enclosingSelect(toks, i)
+		if sel == -1 {
+			continue
+		}
+		source := ""
+		if sel >= 3 && toks[sel-1].val == "(" && toks[sel-2].kind == tkKeyword && toks[sel-2].val == "as" && toks[sel-3].kind == tkIdent {
+			source = stripQuotes(toks[sel-3].val)
+		}
+		if aliases == nil {
+			aliases = map[string]string{}
+		}
+		aliases[stripQuotes(toks[i+2].val)] = source
+	}
+	return aliases
+}
+
+// enclosingSelect returns the index of the SELECT whose select list holds the
+// token at i, or -1 when the token is in another clause
+func enclosingSelect(toks []token, i int) int {
+	depth := toks[i].depth
+	for j := i - 1; j >= 0 && toks[j].depth >= depth; j-- {
+		if toks[j].depth != depth || toks[j].kind != tkKeyword {
+			continue
+		}
+		if toks[j].val == "select" {
+			return j
+		}
+		if selectListEnd[toks[j].val] {
+			return -1
+		}
+	}
+	return -1
+}
+
+// aliasSpans returns the spans of the predicates of the range on measure_name
+// aliases, which filter rows after the table was read
+func aliasSpans(toks []token, start, stop int, aliases map[string]string) []Span {
+	var spans []Span
+	for i := start; i+1 < stop && i+1 < len(toks); i++ {
+		if toks[i].kind != tkIdent || toks[i].caseDepth > 0 {
+			continue
+		}
+		name := stripQuotes(toks[i].val)
+		if dot := strings.LastIndex(name, "."); dot != -1 {
+			name = name[dot+1:]
+		}
+		source, ok := aliases[name]
+		if !ok {
+			continue
+		}
+		next := toks[i+1]
+		if !(next.kind == tkSymbol && isCompareOp(next.val)) && !(next.kind == tkKeyword && (next.val == "in" || next.val == "not")) && next.val != "like" {
+			continue
+		}
+		where := "a subquery"
+		if source != "" {
+			where = source
+		}
+		end := predicateEnd(toks, i, stop)
+		spans = append(spans, Span{
+			Start: toks[i].pos,
+			End:   toks[end-1].end,
+			Kind:  SpanAlias,
+			Note:  name + " is measure_name as projected by " + where + ", filter measure_name inside " + where + " to limit what it reads",
+		})
+		i = end - 1
+	}
+	return spans
+}
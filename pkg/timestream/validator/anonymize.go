@@ -0,0 +1,46 @@
+package validator
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strconv"
+	"strings"
+)
+
+// Anonymize replaces every string and number literal of sql with a numbered
+// placeholder, keeping identifiers, keywords and layout. Repeated literals get
+// the same placeholder and strings keep their quotes, so
+// device = 'a' OR device = 'a' AND value > 10 becomes
+// device = '$1' OR device = '$1' AND value > $2. Comments are removed.
+func Anonymize(sql string) string {
+	src := stripComments(sql)
+	placeholders := map[string]string{}
+	var b strings.Builder
+	b.Grow(len(src))
+	last := 0
+	for tok := range tokens(src) {
+		if tok.kind != tkString && tok.kind != tkNumber {
+			continue
+		}
+		placeholder, ok := placeholders[tok.val]
+		if !ok {
+			placeholder = "$" + strconv.Itoa(len(placeholders)+1)
+			if tok.kind == tkString {
+				placeholder = "'" + placeholder + "'"
+			}
+			placeholders[tok.val] = placeholder
+		}
+		b.WriteString(src[last:tok.pos])
+		b.WriteString(placeholder)
+		last = tok.end
+	}
+	b.WriteString(src[last:])
+	return strings.TrimSpace(b.String())
+}
+
+// Fingerprint identifies the shape of a query: queries differing only in their
+// literals, comments or formatting share a fingerprint
+func Fingerprint(sql string) string {
+	sum := sha256.Sum256([]byte(Deparameterize(sql)))
+	return hex.EncodeToString(sum[:8])
+}
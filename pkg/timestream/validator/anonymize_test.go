@@ -0,0 +1,50 @@
+package validator
+
+import "testing"
+
+func TestAnonymize(t *testing.T) {
+	t.Parallel()
+
+	testcases := []struct {
+		desc  string
+		input string
+		want  string
+	}{
+		{
+			desc:  "repeated literals",
+			input: `SELECT * FROM db.tbl WHERE device = 'a' OR device = 'a' AND value > 10`,
+			want:  `SELECT * FROM db.tbl WHERE device = '$1' OR device = '$1' AND value > $2`,
+		},
+		{
+			desc:  "layout kept, comments removed",
+			input: "SELECT *\nFROM db.tbl -- customer 'acme'\nWHERE time > ago(15m)\n  AND name = 'O''Brien'",
+			want:  "SELECT *\nFROM db.tbl                   \nWHERE time > ago($1m)\n  AND name = '$2'",
+		},
+		{
+			desc:  "identifiers untouched",
+			input: `SELECT "device 1" FROM "db"."tbl" WHERE measure_name = 'cpu' LIMIT 10`,
+			want:  `SELECT "device 1" FROM "db"."tbl" WHERE measure_name = '$1' LIMIT $2`,
+		},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.desc, func(t *testing.T) {
+			t.Parallel()
+			if got := Anonymize(tc.input); got != tc.want {
+				t.Errorf("Anonymize() =\n%q\nwant\n%q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestFingerprint(t *testing.T) {
+	t.Parallel()
+
+	a := Fingerprint("SELECT * FROM db.tbl WHERE device = 'a' AND time > ago(1h)")
+	if b := Fingerprint("SELECT *\n  FROM db.tbl -- dashboard\n WHERE device = 'b' AND time > ago(6h)"); a != b {
+		t.Errorf("Fingerprint() = %s and %s, want equal for queries differing in literals and layout", a, b)
+	}
+	if c := Fingerprint("SELECT * FROM db.other WHERE device = 'a' AND time > ago(1h)"); a == c {
+		t.Errorf("Fingerprint() = %s for queries of different tables", a)
+	}
+}
@@ -0,0 +1,52 @@
+package validator
+
+import (
+	"runtime"
+	"sync"
+)
+
+// Result is the outcome of validating the query at Index of a batch.
+type Result struct {
+	Index  int     `json:"index"`
+	Valid  bool    `json:"valid"`
+	Issues []Issue `json:"issues,omitempty"`
+}
+
+// ValidateAll validates the queries concurrently with the same options. The
+// results are in the order of the queries.
+func ValidateAll(queries []string, opts *Options) []Result {
+	c, err := opts.Compile()
+	if err != nil {
+		results := make([]Result, len(queries))
+		for i := range results {
+			results[i] = Result{Index: i, Issues: []Issue{{Reason: err.Error(), Severity: SeverityError, Code: CodeInvalidOptions}}}
+		}
+		return results
+	}
+	return c.ValidateAll(queries)
+}
+
+// ValidateAll validates the queries concurrently, see the package level ValidateAll.
+func (c *Compiled) ValidateAll(queries []string) []Result {
+	results := make([]Result, len(queries))
+	workers := min(runtime.GOMAXPROCS(0), len(queries))
+
+	next := make(chan int)
+	var wg sync.WaitGroup
+	wg.Add(workers)
+	for w := 0; w < workers; w++ {
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				valid, issues := c.Validate(queries[i])
+				results[i] = Result{Index: i, Valid: valid, Issues: issues}
+			}
+		}()
+	}
+	for i := range queries {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+	return results
+}
@@ -0,0 +1,50 @@
+package validator
+
+import "testing"
+
+func TestValidateAll(t *testing.T) {
+	t.Parallel()
+
+	valid := `SELECT * FROM db.tbl WHERE time > ago(1h) AND measure_name = 'cpu'`
+	noMeasure := `SELECT * FROM db.tbl WHERE time > ago(1h)`
+
+	var queries []string
+	for i := 0; i < 50; i++ {
+		if i%3 == 0 {
+			queries = append(queries, noMeasure)
+		} else {
+			queries = append(queries, valid)
+		}
+	}
+
+	results := ValidateAll(queries, nil)
+	if len(results) != len(queries) {
+		t.Fatalf("got %d results, want %d", len(results), len(queries))
+	}
+	for i, r := range results {
+		if r.Index != i {
+			t.Errorf("result %d has index %d", i, r.Index)
+		}
+		if want := i%3 != 0; r.Valid != want {
+			t.Errorf("result %d valid = %v, want %v", i, r.Valid, want)
+		}
+		if !r.Valid && len(r.Issues) == 0 {
+			t.Errorf("result %d is invalid without issues", i)
+		}
+	}
+
+	relaxed := ValidateAll(queries, &Options{AllowMissingMeasure: true})
+	for i, r := range relaxed {
+		if !r.Valid {
+			t.Errorf("result %d invalid with relaxed options: %v", i, r.Issues)
+		}
+	}
+}
+
+func TestValidateAll_Empty(t *testing.T) {
+	t.Parallel()
+
+	if results := ValidateAll(nil, nil); len(results) != 0 {
+		t.Errorf("got %d results, want none", len(results))
+	}
+}
@@ -0,0 +1,127 @@
+package validator
+
+import "slices"
+
+// boolOp is the operator of a boolean expression node.
+type boolOp int
+
+const (
+	boolLeaf boolOp = iota
+	boolAnd
+	boolOr
+	boolNot
+)
+
+// boolNode is a node of the boolean expression tree of a WHERE clause. Leaves
+// are predicates; redundant parentheses around a node are not part of its
+// token range.
+type boolNode struct {
+	op          boolOp
+	start, stop int // token range [start, stop)
+	children    []*boolNode
+}
+
+// parseBoolExpr builds the boolean expression tree of the token range, with
+// the usual precedence NOT > AND > OR. The AND of BETWEEN x AND y and any
+// operator within CASE ... END are not part of the tree.
+func parseBoolExpr(toks []token, start, stop int) *boolNode {
+	start, stop = trimParens(toks, start, stop)
+	if start >= stop {
+		return &boolNode{op: boolLeaf, start: start, stop: stop}
+	}
+	depth := toks[start].depth
+	for i := start; i < stop; i++ {
+		depth = min(depth, toks[i].depth)
+	}
+
+	if parts := splitAtKeyword(toks, start, stop, depth, "or"); len(parts) > 1 {
+		return parentNode(boolOr, toks, start, stop, parts)
+	}
+	if parts := splitAtKeyword(toks, start, stop, depth, "and"); len(parts) > 1 {
+		return parentNode(boolAnd, toks, start, stop, parts)
+	}
+	if toks[start].kind == tkKeyword && toks[start].val == "not" && toks[start].depth == depth {
+		return &boolNode{op: boolNot, start: start, stop: stop, children: []*boolNode{parseBoolExpr(toks, start+1, stop)}}
+	}
+	return &boolNode{op: boolLeaf, start: start, stop: stop}
+}
+
+func parentNode(op boolOp, toks []token, start, stop int, parts [][2]int) *boolNode {
+	n := &boolNode{op: op, start: start, stop: stop}
+	for _, part := range parts {
+		n.children = append(n.children, parseBoolExpr(toks, part[0], part[1]))
+	}
+	return n
+}
+
+// trimParens strips parentheses enclosing the whole range.
+func trimParens(toks []token, start, stop int) (int, int) {
+	for start < stop && toks[start].kind == tkSymbol && toks[start].val == "(" && matchingParen(toks, start) == stop-1 {
+		start, stop = start+1, stop-1
+	}
+	return start, stop
+}
+
+// splitAtKeyword splits the range at the keyword on the given depth.
+func splitAtKeyword(toks []token, start, stop, depth int, word string) [][2]int {
+	var parts [][2]int
+	partStart := start
+	inBetween := false
+	for i := start; i < stop; i++ {
+		if toks[i].depth != depth || toks[i].kind != tkKeyword || toks[i].caseDepth > 0 {
+			continue
+		}
+		switch {
+		case toks[i].val == "between":
+			inBetween = true
+		case toks[i].val == "and" && inBetween:
+			inBetween = false
+		case toks[i].val == word:
+			parts = append(parts, [2]int{partStart, i})
+			partStart = i + 1
+		}
+	}
+	return append(parts, [2]int{partStart, stop})
+}
+
+// maxBranches caps the OR branches an expression expands to. An AND that would
+// expand past it keeps its operands with an OR as single predicates, and the
+// expansion is reported as incomplete.
+const maxBranches = 64
+
+// branches returns the OR branches of the expression at every depth, each as
+// the token ranges of the predicates it ANDs: (a OR b) AND c has the branches
+// [a c] and [b c]. A NOT applies to its whole operand, which stays a single
+// predicate. It reports false when maxBranches cut the expansion short, the
+// branches then hold ORs which can't be checked as predicates.
+func (n *boolNode) branches() ([][][2]int, bool) {
+	switch n.op {
+	case boolOr:
+		var out [][][2]int
+		complete := true
+		for _, child := range n.children {
+			alternatives, ok := child.branches()
+			out, complete = append(out, alternatives...), complete && ok
+		}
+		return out, complete
+	case boolAnd:
+		out := [][][2]int{nil}
+		complete := true
+		for _, child := range n.children {
+			alternatives, ok := child.branches()
+			complete = complete && ok
+			if len(out)*len(alternatives) > maxBranches {
+				alternatives, complete = [][][2]int{{{child.start, child.stop}}}, false
+			}
+			next := make([][][2]int, 0, len(out)*len(alternatives))
+			for _, branch := range out {
+				for _, alt := range alternatives {
+					next = append(next, append(slices.Clone(branch), alt...))
+				}
+			}
+			out = next
+		}
+		return out, complete
+	}
+	return [][][2]int{{{n.start, n.stop}}}, true
+}
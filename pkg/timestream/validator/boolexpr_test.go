@@ -0,0 +1,118 @@
+package validator
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestParseBoolExpr(t *testing.T) {
+	t.Parallel()
+
+	testcases := []struct {
+		desc  string
+		where string
+		want  string
+	}{
+		{desc: "single predicate", where: "time > ago(1h)", want: "time > ago ( 1 h )"},
+		{desc: "precedence", where: "a = 1 OR b = 2 AND c = 3", want: "OR(a = 1, AND(b = 2, c = 3))"},
+		{desc: "redundant parentheses", where: "((a = 1 OR b = 2))", want: "OR(a = 1, b = 2)"},
+		{desc: "between", where: "time BETWEEN 1 AND 2 AND m = 'x'", want: "AND(time between 1 and 2, m = 'x')"},
+		{desc: "nested", where: "(a = 1 OR b = 2) AND NOT (c = 3)", want: "AND(OR(a = 1, b = 2), NOT(c = 3))"},
+	}
+
+	for _, tc := range testcases {
+		tc := tc
+		t.Run(tc.desc, func(t *testing.T) {
+			t.Parallel()
+			toks := lex(tc.where)
+			if got := formatBoolExpr(toks, parseBoolExpr(toks, 0, len(toks))); got != tc.want {
+				t.Errorf("want %s, got %s", tc.want, got)
+			}
+		})
+	}
+}
+
+func formatBoolExpr(toks []token, n *boolNode) string {
+	if n.op == boolLeaf {
+		var vals []string
+		for _, tok := range toks[n.start:n.stop] {
+			vals = append(vals, tok.val)
+		}
+		return strings.Join(vals, " ")
+	}
+	var children []string
+	for _, child := range n.children {
+		children = append(children, formatBoolExpr(toks, child))
+	}
+	return map[boolOp]string{boolAnd: "AND", boolOr: "OR", boolNot: "NOT"}[n.op] + "(" + strings.Join(children, ", ") + ")"
+}
+
+func TestBoolExprBranches(t *testing.T) {
+	t.Parallel()
+
+	testcases := []struct {
+		desc  string
+		where string
+		want  []string
+	}{
+		{desc: "single predicate", where: "a = 1", want: []string{"a = 1"}},
+		{desc: "top-level OR", where: "a = 1 OR b = 2 AND c = 3", want: []string{"a = 1", "b = 2 & c = 3"}},
+		{desc: "nested OR", where: "(a = 1 OR b = 2) AND c = 3", want: []string{"a = 1 & c = 3", "b = 2 & c = 3"}},
+		{desc: "two nested ORs", where: "(a = 1 OR b = 2) AND (c = 3 OR d = 4)", want: []string{"a = 1 & c = 3", "a = 1 & d = 4", "b = 2 & c = 3", "b = 2 & d = 4"}},
+		{desc: "deeply nested", where: "a = 1 AND (b = 2 AND (c = 3 OR d = 4))", want: []string{"a = 1 & b = 2 & c = 3", "a = 1 & b = 2 & d = 4"}},
+		{desc: "NOT stays a predicate", where: "NOT (a = 1 OR b = 2) AND c = 3", want: []string{"not ( a = 1 or b = 2 ) & c = 3"}},
+	}
+
+	for _, tc := range testcases {
+		tc := tc
+		t.Run(tc.desc, func(t *testing.T) {
+			t.Parallel()
+			toks := lex(tc.where)
+			var got []string
+			branches, complete := parseBoolExpr(toks, 0, len(toks)).branches()
+			if !complete {
+				t.Errorf("want all branches")
+			}
+			for _, branch := range branches {
+				var preds []string
+				for _, p := range branch {
+					preds = append(preds, formatBoolExpr(toks, &boolNode{op: boolLeaf, start: p[0], stop: p[1]}))
+				}
+				got = append(got, strings.Join(preds, " & "))
+			}
+			if strings.Join(got, "; ") != strings.Join(tc.want, "; ") {
+				t.Errorf("want %q, got %q", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestBoolExprBranches_Limit(t *testing.T) {
+	t.Parallel()
+
+	// 2^10 branches, the ORs past the limit are kept as single predicates
+	where := strings.Repeat("(a = 1 OR b = 2) AND ", 9) + "(a = 1 OR b = 2)"
+	toks := lex(where)
+	branches, complete := parseBoolExpr(toks, 0, len(toks)).branches()
+	if len(branches) > maxBranches || complete {
+		t.Errorf("want at most %d branches reported incomplete, got %d %v", maxBranches, len(branches), complete)
+	}
+}
+
+func TestValidate_TooManyBranches(t *testing.T) {
+	t.Parallel()
+
+	// the padding ORs expand to 64 branches, the time filter OR would be kept
+	// as a single predicate satisfying the time rule
+	where := strings.Repeat("(host = 'a' OR host = 'b') AND ", 6) + "(time > ago(1h) OR device = 'x') AND measure_name = 'cpu'"
+	for _, opts := range []*Options{{}, {Parser: ParserAST}} {
+		valid, issues := Validate("SELECT * FROM db.t WHERE "+where, opts)
+		if valid || !slices.ContainsFunc(issues, func(i Issue) bool { return i.Code == CodeWhereTooComplex }) {
+			t.Errorf("%s: want the query rejected as too complex, got %v %+v", opts.Parser, valid, issues)
+		}
+	}
+	if valid, issues := Validate("SELECT * FROM db.t WHERE "+strings.Repeat("(host = 'a' OR host = 'b') AND ", 5)+"time > ago(1h) AND measure_name = 'cpu'", nil); !valid {
+		t.Errorf("want 32 branches accepted, got %+v", issues)
+	}
+}
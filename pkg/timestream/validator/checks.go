@@ -0,0 +1,369 @@
+package validator
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Check is a rule of the validator. Checks run for every SELECT reading from
+// tables; except the where check, only for SELECTs with a WHERE clause. Custom
+// checks are added with Options.Checks, e.g. for a company-specific filter.
+type Check interface {
+	// Rule names the check for Options.WarningRules and Options.RuleLevels
+	Rule() Rule
+	// CheckSelect returns the issues of a SELECT. Issues without a position
+	// are placed at the WHERE clause, and get the rule of the check and, as
+	// their code, its name when they don't set them.
+	CheckSelect(s *Select) []Issue
+}
+
+// Select is a SELECT reading from tables, as seen by checks
+type Select struct {
+	c     *Compiled
+	sql   string
+	toks  []token
+	scope selectScope
+}
+
+// Tables returns the "db.table" names the SELECT reads
+func (s *Select) Tables() []string {
+	return slices.Clone(s.scope.tables)
+}
+
+// HasWhere reports whether the SELECT has a WHERE clause
+func (s *Select) HasWhere() bool {
+	return s.scope.whereIdx != -1
+}
+
+// Branches returns the OR branches of the WHERE clause, each a conjunction of
+// predicates: (a OR b) AND c has the branches a AND c and b AND c.
+func (s *Select) Branches() []Branch {
+	branches := make([]Branch, 0, len(s.scope.branches))
+	for _, branch := range s.scope.branches {
+		b := make(Branch, 0, len(branch))
+		for _, p := range branch {
+			b = append(b, Predicate{s: s, start: p[0], stop: p[1]})
+		}
+		branches = append(branches, b)
+	}
+	return branches
+}
+
+// Branch is an OR branch of a WHERE clause, the predicates all hold
+type Branch []Predicate
+
+// Values returns the literals the predicates of the branch filter the column
+// by, false when none filters it with = or IN
+func (b Branch) Values(column string) ([]string, bool) {
+	var values []string
+	found := false
+	for _, p := range b {
+		if v, ok := p.Values(column); ok {
+			values, found = append(values, v...), true
+		}
+	}
+	return values, found
+}
+
+// Predicate is a predicate of a WHERE clause
+type Predicate struct {
+	s           *Select
+	start, stop int
+}
+
+// Text returns the predicate as written in the query
+func (p Predicate) Text() string {
+	return p.s.sql[startOffset(p.s.toks, p.start):endOffset(p.s.toks, p.stop)]
+}
+
+// Values returns the unquoted literals the predicate filters the column by,
+// with = 'literal' or IN ('literal', ...), false when it doesn't filter it so,
+// e.g. under a NOT.
+// Column names are matched case insensitively, without quotes and qualifiers.
+func (p Predicate) Values(column string) ([]string, bool) {
+	column = strings.ToLower(columnName(column))
+	toks := p.s.toks
+	var values []string
+	found := false
+	for i := p.start; i+2 < p.stop && i+2 < len(toks); i++ {
+		if toks[i].kind != tkIdent || toks[i].caseDepth > 0 || columnName(toks[i].val) != column || negatedAt(toks, p.start, i) {
+			continue
+		}
+		var literals []string
+		switch next := toks[i+1]; {
+		case next.kind == tkSymbol && next.val == "=" && toks[i+2].kind == tkString:
+			literals = []string{toks[i+2].val}
+		case next.kind == tkKeyword && next.val == "in" && toks[i+2].val == "(":
+			literals = inListLiterals(toks, i+3, p.stop)
+		}
+		for _, lit := range literals {
+			values, found = append(values, unquoteString(lit)), true
+		}
+	}
+	return values, found
+}
+
+// builtinChecks returns the checks of the options in the order their issues
+// are reported
+func (c *Compiled) builtinChecks() []Check {
+	return []Check{whereCheck{}, timeCheck{c}, timeWindowCheck{c}, measureCheck{c}, measurePatternCheck{c}, requiredColumnCheck{c}, tenantCheck{c}, negatedDimensionCheck{c}}
+}
+
+// whereCheck requires a WHERE clause
+type whereCheck struct{}
+
+func (whereCheck) Rule() Rule { return RuleWhere }
+
+func (whereCheck) CheckSelect(s *Select) []Issue {
+	if s.scope.tooComplex {
+		return []Issue{{
+			Reason: fmt.Sprintf("predicate too complex to validate, WHERE clause expands to more than %d OR branches", maxBranches),
+			Code:   CodeWhereTooComplex,
+		}}
+	}
+	if s.HasWhere() {
+		return nil
+	}
+	return []Issue{{
+		Snippet: snippetAroundTokens(s.sql, s.toks, s.scope.selIdx, s.scope.fromIdx, s.scope.stopIdx),
+		Start:   startOffset(s.toks, s.scope.selIdx),
+		End:     endOffset(s.toks, s.scope.stopIdx),
+		Reason:  "missing WHERE clause",
+		Code:    CodeMissingWhere,
+	}}
+}
+
+// timeCheck requires a time filter in every OR branch, bounded on both sides
+// for the tables of Options.BoundedTimeTables
+type timeCheck struct{ c *Compiled }
+
+func (timeCheck) Rule() Rule { return RuleTime }
+
+func (ch timeCheck) CheckSelect(s *Select) []Issue {
+	c, toks, branches := ch.c, s.toks, s.scope.branches
+	hasInvalidOr := len(branches) > 1
+	// the rule applies when one of the tables requires it, its reason names it
+	table, checkBounded := "", false
+	if i := slices.IndexFunc(s.scope.tables, c.requiresBoundedTime); i >= 0 {
+		table, checkBounded = s.scope.tables[i], true
+	}
+
+	hasMissingTime := false
+	// tautology is a time predicate restricting nothing, of a branch without another one
+	tautology := ""
+	now := time.Now()
+	earliest := c.earliestTime(now)
+	weakestBound := TimeBounded
+	for _, branch := range branches {
+		hasTime, restricted, vacuous := false, false, ""
+		for _, p := range branch {
+			if !whereHasTimePredicate(toks, p[0], p[1], c.timeColumns) {
+				continue
+			}
+			hasTime = true
+			if !tautologicalTimePredicate(toks, p[0], p[1], c.timeColumns, now, earliest) {
+				restricted = true
+			} else if vacuous == "" {
+				vacuous = s.sql[startOffset(toks, p[0]):endOffset(toks, p[1])]
+			}
+		}
+		if !hasTime {
+			hasMissingTime = true
+		} else if !restricted && tautology == "" {
+			tautology = vacuous
+		}
+		if checkBounded {
+			bound := TimeUnbounded
+			for _, p := range branch {
+				bound = bound.with(whereTimeBound(toks, p[0], p[1], c.timeColumns))
+			}
+			if bound == TimeUnbounded || weakestBound == TimeBounded {
+				weakestBound = bound
+			}
+		}
+	}
+
+	if hasMissingTime {
+		reason, code := "WHERE clause lacks a time predicate", CodeMissingTimePredicate
+		if hasInvalidOr {
+			reason, code = "an OR branch in WHERE clause lacks a time predicate", CodeOrBranchUnfiltered
+		}
+		fix := ""
+		// The most common mistake: binning time for a graph without limiting it
+		if groupsByTimeBins(toks, s.scope.selIdx, s.scope.whereStop, s.scope.depth, c.timeColumns) {
+			reason = "GROUP BY bins time but WHERE doesn't restrict it"
+			fix = "add AND $__timeFilter to the WHERE clause, so the bins only cover the time range of the dashboard"
+			if hasInvalidOr {
+				reason = "GROUP BY bins time but an OR branch in WHERE doesn't restrict it"
+				fix = "add AND $__timeFilter to every OR branch of the WHERE clause, so the bins only cover the time range of the dashboard"
+			}
+		}
+		return []Issue{{Reason: reason, Code: code, TimeBound: TimeUnbounded, Fix: fix}}
+	}
+	if tautology != "" {
+		reason := "time filter " + tautology + " doesn't restrict time"
+		if hasInvalidOr {
+			reason = "time filter " + tautology + " of an OR branch doesn't restrict time"
+		}
+		return []Issue{{Reason: reason, Code: CodeTautologicalTimePredicate, TimeBound: TimeUnbounded, Fix: "filter the time range of the dashboard with $__timeFilter, or a range like time > ago(1h)"}}
+	}
+	if weakestBound != TimeBounded {
+		reason, code := "WHERE clause lacks "+missingBoundText(weakestBound)+" (required for "+table+")", CodeUnboundedTime
+		if hasInvalidOr {
+			reason, code = "an OR branch in WHERE clause lacks "+missingBoundText(weakestBound)+" (required for "+table+")", CodeOrBranchUnfiltered
+		}
+		return []Issue{{Reason: reason, Rule: RuleBoundedTime, Code: code, TimeBound: weakestBound}}
+	}
+	return nil
+}
+
+// measureCheck requires a measure_name filter in every OR branch
+type measureCheck struct{ c *Compiled }
+
+func (measureCheck) Rule() Rule { return RuleMeasure }
+
+func (ch measureCheck) CheckSelect(s *Select) []Issue {
+	opts, toks := &ch.c.opts, s.toks
+	if opts.AllowMissingMeasure {
+		return nil
+	}
+	hasMissingMeasure, negatedMeasureLike := false, false
+	for _, branch := range s.scope.branches {
+		if !whereHasMeasureNamePredicate(toks, branch, opts.AllowComputedMeasure, opts.AllowMeasureLike, ch.c.measureWrappers) {
+			hasMissingMeasure = true
+			negatedMeasureLike = negatedMeasureLike || slices.ContainsFunc(branch, func(p [2]int) bool { return whereHasNegatedMeasureLike(toks, p[0], p[1]) })
+		}
+	}
+	if !hasMissingMeasure {
+		return nil
+	}
+
+	accepted := "= '...', IN ('...') or regexp_like"
+	if opts.AllowMeasureLike {
+		accepted = "= '...', IN ('...'), LIKE '...' or regexp_like"
+	}
+	reason, code := "WHERE clause lacks a valid measure_name predicate (requires "+accepted+")", CodeInvalidMeasurePredicate
+	if len(s.scope.branches) > 1 {
+		reason, code = "an OR branch in WHERE clause lacks a valid measure_name predicate (requires "+accepted+")", CodeOrBranchUnfiltered
+	}
+	if negatedMeasureLike {
+		reason, code = "measure_name NOT LIKE excludes measures but still reads all others (requires "+accepted+")", CodeNegatedMeasureLike
+	}
+	return []Issue{{Reason: reason, Code: code}}
+}
+
+// measurePatternCheck rejects measure patterns matching too much
+type measurePatternCheck struct{ c *Compiled }
+
+func (measurePatternCheck) Rule() Rule { return RuleMeasurePattern }
+
+func (ch measurePatternCheck) CheckSelect(s *Select) []Issue {
+	if ch.c.opts.AllowAnyMeasurePattern {
+		return nil
+	}
+	for _, branch := range s.scope.branches {
+		for _, p := range branch {
+			if reason, code := measurePatternIssue(s.toks, p[0], p[1], ch.c.opts.AllowMeasureLike); reason != "" {
+				return []Issue{{Reason: reason, Code: code}}
+			}
+		}
+	}
+	return nil
+}
+
+// requiredColumnCheck requires the Options.RequiredColumns of the tables in
+// every OR branch
+type requiredColumnCheck struct{ c *Compiled }
+
+func (requiredColumnCheck) Rule() Rule { return RuleRequiredColumn }
+
+func (ch requiredColumnCheck) CheckSelect(s *Select) []Issue {
+	var required []requiredColumn
+	for _, rc := range ch.c.requiredColumns {
+		if slices.ContainsFunc(s.scope.tables, rc.appliesTo) {
+			required = append(required, rc)
+		}
+	}
+
+	hasInvalidOr := len(s.scope.branches) > 1
+	requiredIssues := map[string]Issue{}
+	for _, branch := range s.scope.branches {
+		for _, rc := range required {
+			if _, reported := requiredIssues[rc.column]; reported {
+				continue
+			}
+			found, rejected, column := false, "", ""
+			for _, p := range branch {
+				ok, r, col := rc.check(s.toks, p[0], p[1])
+				found = found || ok
+				if rejected == "" {
+					rejected, column = r, col
+				}
+			}
+			switch {
+			case rejected != "":
+				requiredIssues[rc.column] = Issue{Reason: column + " value '" + rejected + "' is not accepted", Code: CodeRejectedRequiredValue}
+			case !found && hasInvalidOr:
+				requiredIssues[rc.column] = Issue{Reason: "an OR branch in WHERE clause lacks a predicate on required column " + rc.columnText() + " (" + rc.operatorText() + ")", Code: CodeOrBranchUnfiltered}
+			case !found:
+				requiredIssues[rc.column] = Issue{Reason: "WHERE clause lacks a predicate on required column " + rc.columnText() + " (" + rc.operatorText() + ")", Code: CodeMissingRequiredColumn}
+			}
+		}
+	}
+
+	var issues []Issue
+	for _, rc := range required {
+		if issue, ok := requiredIssues[rc.column]; ok {
+			issues = append(issues, issue)
+		}
+	}
+	return issues
+}
+
+// tenantCheck requires an equality filter on Options.TenantDimension in every
+// OR branch of the tenant tables
+type tenantCheck struct{ c *Compiled }
+
+func (tenantCheck) Rule() Rule { return RuleTenant }
+
+func (ch tenantCheck) CheckSelect(s *Select) []Issue {
+	dimension := ch.c.opts.TenantDimension
+	if !slices.ContainsFunc(s.scope.tables, ch.c.requiresTenant) {
+		return nil
+	}
+	for _, branch := range s.scope.branches {
+		if slices.ContainsFunc(branch, func(p [2]int) bool { return whereHasEqualityPredicate(s.toks, p[0], p[1], dimension) }) {
+			continue
+		}
+		reason, code := "WHERE clause lacks an equality predicate on tenant dimension "+dimension, CodeMissingTenant
+		if len(s.scope.branches) > 1 {
+			reason, code = "an OR branch in WHERE clause lacks an equality predicate on tenant dimension "+dimension, CodeOrBranchUnfiltered
+		}
+		return []Issue{{Reason: reason, Code: code}}
+	}
+	return nil
+}
+
+// negatedDimensionCheck rejects branches filtering dimensions only by negation
+// when Options.RequirePositiveDimensionFilter is set
+type negatedDimensionCheck struct{ c *Compiled }
+
+func (negatedDimensionCheck) Rule() Rule { return RuleNegatedDimensionFilter }
+
+func (ch negatedDimensionCheck) CheckSelect(s *Select) []Issue {
+	if !ch.c.opts.RequirePositiveDimensionFilter {
+		return nil
+	}
+	for _, branch := range s.scope.branches {
+		if whereHasOnlyNegatedDimensionFilters(s.toks, branch) {
+			reason := "WHERE clause filters dimensions only by negation (requires =, IN or LIKE 'prefix%')"
+			if len(s.scope.branches) > 1 {
+				reason = "an OR branch in WHERE clause filters dimensions only by negation (requires =, IN or LIKE 'prefix%')"
+			}
+			return []Issue{{Reason: reason, Code: CodeNegatedDimensionFilter}}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,158 @@
+package validator
+
+import (
+	"errors"
+	"reflect"
+	"slices"
+	"testing"
+)
+
+// releaseGroupCheck requires releasegroup to be filtered by one of stable or
+// canary in every OR branch
+type releaseGroupCheck struct{}
+
+func (releaseGroupCheck) Rule() Rule { return "releasegroup" }
+
+func (releaseGroupCheck) CheckSelect(s *Select) []Issue {
+	for _, branch := range s.Branches() {
+		values, ok := branch.Values("releasegroup")
+		if !ok {
+			return []Issue{{Reason: "WHERE clause lacks a releasegroup filter"}}
+		}
+		for _, v := range values {
+			if v != "stable" && v != "canary" {
+				return []Issue{{Reason: "releasegroup " + v + " is not released", Code: "unreleased-group"}}
+			}
+		}
+	}
+	return nil
+}
+
+func TestValidate_CustomCheck(t *testing.T) {
+	t.Parallel()
+
+	opts := &Options{Checks: []Check{releaseGroupCheck{}}}
+	testcases := []struct {
+		desc   string
+		input  string
+		want   bool
+		reason string
+		code   IssueCode
+	}{
+		{
+			desc:  "filtered",
+			input: `SELECT * FROM db.t WHERE time > ago(1h) AND measure_name = 'cpu' AND "releasegroup" IN ('stable', 'canary')`,
+			want:  true,
+		},
+		{
+			desc:   "missing in an OR branch",
+			input:  `SELECT * FROM db.t WHERE time > ago(1h) AND measure_name = 'cpu' AND (t.releasegroup = 'stable' OR host = 'a')`,
+			reason: "WHERE clause lacks a releasegroup filter",
+			code:   "releasegroup",
+		},
+		{
+			desc:   "rejected value",
+			input:  `SELECT * FROM db.t WHERE time > ago(1h) AND measure_name = 'cpu' AND releasegroup = 'alpha'`,
+			reason: "releasegroup alpha is not released",
+			code:   "unreleased-group",
+		},
+		{
+			desc:   "not run without WHERE",
+			input:  `SELECT * FROM db.t`,
+			reason: "missing WHERE clause",
+			code:   CodeMissingWhere,
+		},
+	}
+
+	for _, tc := range testcases {
+		tc := tc
+		t.Run(tc.desc, func(t *testing.T) {
+			t.Parallel()
+			got, issues := Validate(tc.input, opts)
+			if got != tc.want {
+				t.Fatalf("want %v, got %v, issues: %+v", tc.want, got, issues)
+			}
+			if tc.want {
+				return
+			}
+			if len(issues) != 1 || issues[0].Reason != tc.reason || issues[0].Code != tc.code {
+				t.Fatalf("want %q (%s), got %+v", tc.reason, tc.code, issues)
+			}
+			if issues[0].Rule != RuleWhere && (issues[0].Rule != "releasegroup" || issues[0].Start != 0 || issues[0].End != len(tc.input) || issues[0].Snippet == "") {
+				t.Errorf("issue without the rule and position of the check: %+v", issues[0])
+			}
+		})
+	}
+
+	// custom rules have levels like the built-in ones
+	warned := &Options{Checks: []Check{releaseGroupCheck{}}, RuleLevels: map[Rule]RuleLevel{"releasegroup": LevelWarn}}
+	if valid, issues := Validate(`SELECT * FROM db.t WHERE time > ago(1h) AND measure_name = 'cpu'`, warned); !valid || len(Warnings(issues)) != 1 {
+		t.Errorf("want a warning, got %v %+v", valid, issues)
+	}
+}
+
+func TestSelect(t *testing.T) {
+	t.Parallel()
+
+	sql := `SELECT * FROM db.t WHERE time > ago(1h) AND (host IN ('a', 'b') OR host = 'c') AND CASE WHEN host = 'd' THEN 1 END = 1`
+	var tables []string
+	var texts [][]string
+	var hosts [][]string
+	check := funcCheck{rule: "inspect", check: func(s *Select) []Issue {
+		tables = s.Tables()
+		for _, branch := range s.Branches() {
+			var text []string
+			for _, p := range branch {
+				text = append(text, p.Text())
+			}
+			texts = append(texts, text)
+			values, _ := branch.Values("HOST")
+			hosts = append(hosts, values)
+		}
+		return nil
+	}}
+	if valid, issues := Validate(sql, &Options{AllowMissingMeasure: true, Checks: []Check{check}}); !valid {
+		t.Fatalf("unexpected issues %+v", issues)
+	}
+	if !slices.Equal(tables, []string{"db.t"}) {
+		t.Errorf("unexpected tables %v", tables)
+	}
+	want := [][]string{
+		{"time > ago(1h)", "host IN ('a', 'b')", "CASE WHEN host = 'd' THEN 1 END = 1"},
+		{"time > ago(1h)", "host = 'c'", "CASE WHEN host = 'd' THEN 1 END = 1"},
+	}
+	if !reflect.DeepEqual(texts, want) {
+		t.Errorf("want predicates %q, got %q", want, texts)
+	}
+	// values compared in CASE don't filter
+	if want := [][]string{{"a", "b"}, {"c"}}; !reflect.DeepEqual(hosts, want) {
+		t.Errorf("want values %q, got %q", want, hosts)
+	}
+}
+
+func TestCompile_Checks(t *testing.T) {
+	t.Parallel()
+
+	for _, checks := range [][]Check{
+		{funcCheck{}},
+		{releaseGroupCheck{}, releaseGroupCheck{}},
+		{funcCheck{rule: RuleTime}},
+	} {
+		var configErr *ConfigError
+		if _, err := (&Options{Checks: checks}).Compile(); !errors.As(err, &configErr) || configErr.Field != "checks" {
+			t.Errorf("want an error of checks, got %v", err)
+		}
+	}
+	if _, err := (&Options{WarningRules: []Rule{"releasegroup"}, Checks: []Check{releaseGroupCheck{}}}).Compile(); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+// funcCheck runs a function as a check
+type funcCheck struct {
+	rule  Rule
+	check func(s *Select) []Issue
+}
+
+func (c funcCheck) Rule() Rule                    { return c.rule }
+func (c funcCheck) CheckSelect(s *Select) []Issue { return c.check(s) }
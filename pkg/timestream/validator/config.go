@@ -0,0 +1,268 @@
+package validator
+
+import (
+	"fmt"
+	"maps"
+	"path"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+)
+
+// ConfigError reports an invalid Options field.
+type ConfigError struct {
+	Field string
+	Value string
+	Err   error
+}
+
+func (e *ConfigError) Error() string {
+	return fmt.Sprintf("invalid validator option %s %q: %s", e.Field, e.Value, e.Err)
+}
+
+func (e *ConfigError) Unwrap() error {
+	return e.Err
+}
+
+// Compiled holds checked Options with their lookup structures precomputed,
+// so validating as-you-type doesn't re-parse the configuration.
+type Compiled struct {
+	opts Options
+
+	tenantTables  *tableSet
+	boundedTables *tableSet
+	warnings      map[Rule]bool
+	off           map[Rule]bool
+	// checks are the built-in checks followed by Options.Checks
+	checks          []Check
+	requiredColumns []requiredColumn
+	// measureWrappers are the functions measure_name may be wrapped in
+	measureWrappers map[string]bool
+	// timeColumns are the columns accepted as the time filter, timeColumn is
+	// the first of them
+	timeColumns map[string]bool
+	timeColumn  string
+	// maxTimeWindow is Options.MaxTimeWindow, zero without a maximum
+	maxTimeWindow time.Duration
+	// timeLookback is Options.TimeLookback, zero for earliestTimeBound
+	timeLookback time.Duration
+}
+
+var (
+	defaultMeasureWrappers = map[string]bool{"lower": true, "upper": true}
+	defaultTimeColumns     = map[string]bool{"time": true}
+)
+
+// earliestTime is the start of the data of the tables, filters starting before
+// it restrict nothing
+func (c *Compiled) earliestTime(now time.Time) time.Time {
+	if c.timeLookback > 0 {
+		return now.Add(-c.timeLookback)
+	}
+	return earliestTimeBound
+}
+
+var functionName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// Compile checks the options and precomputes their lookups. A nil *Options
+// compiles to the defaults.
+func (o *Options) Compile() (*Compiled, error) {
+	c := &Compiled{measureWrappers: defaultMeasureWrappers, timeColumns: defaultTimeColumns, timeColumn: "time"}
+	c.checks = c.builtinChecks()
+	if o == nil {
+		return c, nil
+	}
+	c.opts = *o
+
+	if len(o.MeasureWrappers) > 0 {
+		c.measureWrappers = map[string]bool{}
+		for _, name := range o.MeasureWrappers {
+			if !functionName.MatchString(name) {
+				return nil, &ConfigError{Field: "measureWrappers", Value: name, Err: fmt.Errorf("not a function name")}
+			}
+			c.measureWrappers[strings.ToLower(name)] = true
+		}
+	}
+
+	if len(o.TimeColumns) > 0 {
+		c.timeColumns = map[string]bool{}
+		for i, column := range o.TimeColumns {
+			name := strings.ToLower(strings.TrimSpace(strings.ReplaceAll(column, `"`, "")))
+			if name == "" || strings.ContainsAny(name, " \t\n'(),=") {
+				return nil, &ConfigError{Field: "timeColumns", Value: column, Err: fmt.Errorf("not a column name")}
+			}
+			c.timeColumns[name] = true
+			if i == 0 {
+				c.timeColumn = name
+			}
+		}
+	}
+
+	if o.MaxTimeWindow != "" {
+		d, err := parseInterval(o.MaxTimeWindow)
+		if err != nil || d <= 0 {
+			if err == nil {
+				err = fmt.Errorf("must be positive")
+			}
+			return nil, &ConfigError{Field: "maxTimeWindow", Value: o.MaxTimeWindow, Err: err}
+		}
+		c.maxTimeWindow = d
+	}
+
+	if o.TimeLookback != "" {
+		d, err := parseInterval(o.TimeLookback)
+		if err != nil || d <= 0 {
+			if err == nil {
+				err = fmt.Errorf("must be positive")
+			}
+			return nil, &ConfigError{Field: "timeLookback", Value: o.TimeLookback, Err: err}
+		}
+		c.timeLookback = d
+	}
+
+	dimension := strings.ReplaceAll(o.TenantDimension, `"`, "")
+	if strings.ContainsAny(dimension, " \t\n'(),=") {
+		return nil, &ConfigError{Field: "tenantDimension", Value: o.TenantDimension, Err: fmt.Errorf("not a column name")}
+	}
+	c.opts.TenantDimension = strings.ToLower(dimension)
+
+	var err error
+	if c.tenantTables, err = compileTableSet("tenantTables", o.TenantTables); err != nil {
+		return nil, err
+	}
+	if c.boundedTables, err = compileTableSet("boundedTimeTables", o.BoundedTimeTables); err != nil {
+		return nil, err
+	}
+	if c.requiredColumns, err = compileRequiredColumns(o.RequiredColumns); err != nil {
+		return nil, err
+	}
+	if o.Parser != "" && o.Parser != ParserHeuristic && o.Parser != ParserAST {
+		return nil, &ConfigError{Field: "parser", Value: o.Parser, Err: fmt.Errorf("unknown parser")}
+	}
+	known := maps.Clone(rules)
+	for _, check := range o.Checks {
+		rule := check.Rule()
+		if rule == "" || known[rule] {
+			return nil, &ConfigError{Field: "checks", Value: string(rule), Err: fmt.Errorf("rule names must be unique")}
+		}
+		known[rule] = true
+		c.checks = append(c.checks, check)
+	}
+	for _, rule := range o.WarningRules {
+		if !known[rule] {
+			return nil, &ConfigError{Field: "warningRules", Value: string(rule), Err: fmt.Errorf("unknown rule")}
+		}
+	}
+	for _, rule := range o.DirectiveRules {
+		if !known[rule] {
+			return nil, &ConfigError{Field: "directiveRules", Value: string(rule), Err: fmt.Errorf("unknown rule")}
+		}
+	}
+	for _, rule := range slices.Sorted(maps.Keys(o.RuleLevels)) {
+		if !known[rule] {
+			return nil, &ConfigError{Field: "ruleLevels", Value: string(rule), Err: fmt.Errorf("unknown rule")}
+		}
+		if level := o.RuleLevels[rule]; level != LevelError && level != LevelWarn && level != LevelOff {
+			return nil, &ConfigError{Field: "ruleLevels", Value: string(level), Err: fmt.Errorf("unknown level of rule %s", rule)}
+		}
+	}
+	for rule := range known {
+		switch o.Level(rule) {
+		case LevelWarn:
+			if c.warnings == nil {
+				c.warnings = map[Rule]bool{}
+			}
+			c.warnings[rule] = true
+		case LevelOff:
+			if c.off == nil {
+				c.off = map[Rule]bool{}
+			}
+			c.off[rule] = true
+		}
+	}
+	return c, nil
+}
+
+// Level returns the level configured for the rule, LevelError by default. A
+// nil *Options has the defaults.
+func (o *Options) Level(rule Rule) RuleLevel {
+	if o == nil {
+		return LevelError
+	}
+	if level, ok := o.RuleLevels[rule]; ok {
+		return level
+	}
+	if slices.Contains(o.WarningRules, rule) {
+		return LevelWarn
+	}
+	return LevelError
+}
+
+// requiresTenant reports whether the tenant rule applies to the given "db.table".
+func (c *Compiled) requiresTenant(table string) bool {
+	if c.opts.TenantDimension == "" {
+		return false
+	}
+	return c.tenantTables == nil || c.tenantTables.contains(table)
+}
+
+// requiresBoundedTime reports whether queries of the given "db.table" must bound time on both sides.
+func (c *Compiled) requiresBoundedTime(table string) bool {
+	return c.boundedTables != nil && c.boundedTables.contains(table)
+}
+
+// tableSet matches "db.table" names against table specs given by name, by
+// qualified name or as glob patterns.
+type tableSet struct {
+	qualified map[string]bool
+	names     map[string]bool
+	patterns  []string
+}
+
+// compileTableSet returns nil for an empty list of specs.
+func compileTableSet(field string, specs []string) (*tableSet, error) {
+	if len(specs) == 0 {
+		return nil, nil
+	}
+	set := &tableSet{qualified: map[string]bool{}, names: map[string]bool{}}
+	for _, spec := range specs {
+		name := strings.ToLower(strings.TrimSpace(strings.ReplaceAll(spec, `"`, "")))
+		if name == "" || strings.Count(name, ".") > 1 {
+			return nil, &ConfigError{Field: field, Value: spec, Err: fmt.Errorf(`expected "table" or "db.table"`)}
+		}
+		if strings.ContainsAny(name, "*?[") {
+			if _, err := path.Match(name, ""); err != nil {
+				return nil, &ConfigError{Field: field, Value: spec, Err: err}
+			}
+			set.patterns = append(set.patterns, name)
+			continue
+		}
+		if strings.Contains(name, ".") {
+			set.qualified[name] = true
+		} else {
+			set.names[name] = true
+		}
+	}
+	return set, nil
+}
+
+func (s *tableSet) contains(table string) bool {
+	if s.qualified[table] {
+		return true
+	}
+	name := table[strings.LastIndex(table, ".")+1:]
+	if s.names[name] {
+		return true
+	}
+	for _, pattern := range s.patterns {
+		subject := name
+		if strings.Contains(pattern, ".") {
+			subject = table
+		}
+		if ok, _ := path.Match(pattern, subject); ok {
+			return true
+		}
+	}
+	return false
+}
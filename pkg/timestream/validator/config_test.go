@@ -0,0 +1,91 @@
+package validator
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestCompile(t *testing.T) {
+	t.Parallel()
+
+	testcases := []struct {
+		desc  string
+		opts  *Options
+		field string
+	}{
+		{desc: "nil options", opts: nil},
+		{desc: "defaults", opts: &Options{}},
+		{desc: "tenant tables", opts: &Options{TenantDimension: `"ds_account"`, TenantTables: []string{"metrics", `"db"."other"`, "metrics_*"}}},
+		{desc: "bad glob", opts: &Options{TenantDimension: "ds_account", TenantTables: []string{"metrics_[0-9"}}, field: "tenantTables"},
+		{desc: "empty table", opts: &Options{TenantDimension: "ds_account", TenantTables: []string{" "}}, field: "tenantTables"},
+		{desc: "too many parts", opts: &Options{TenantDimension: "ds_account", TenantTables: []string{"a.b.c"}}, field: "tenantTables"},
+		{desc: "bad tenant dimension", opts: &Options{TenantDimension: "ds_account = 'x'"}, field: "tenantDimension"},
+		{desc: "warning rules", opts: &Options{WarningRules: []Rule{RuleMeasure, RuleTenant}}},
+		{desc: "measure wrappers", opts: &Options{MeasureWrappers: []string{"lower", "trim"}}},
+		{desc: "bad measure wrapper", opts: &Options{MeasureWrappers: []string{"lower("}}, field: "measureWrappers"},
+		{desc: "time columns", opts: &Options{TimeColumns: []string{"time", `"measure_time"`}}},
+		{desc: "bad time column", opts: &Options{TimeColumns: []string{"time > 0"}}, field: "timeColumns"},
+		{desc: "required columns", opts: &Options{RequiredColumns: []RequiredColumn{{Column: "releasegroup", Operators: []string{"IN"}, ValuePattern: "v[0-9]+"}}}},
+		{desc: "bad required column", opts: &Options{RequiredColumns: []RequiredColumn{{Column: "a = 'b'"}}}, field: "requiredColumns"},
+		{desc: "bad required alternative", opts: &Options{RequiredColumns: []RequiredColumn{{Column: "device", Alternatives: []string{"ds account"}}}}, field: "requiredColumns"},
+		{desc: "bad required operator", opts: &Options{RequiredColumns: []RequiredColumn{{Column: "a", Operators: []string{">"}}}}, field: "requiredColumns"},
+		{desc: "bad required value pattern", opts: &Options{RequiredColumns: []RequiredColumn{{Column: "a", ValuePattern: "("}}}, field: "requiredColumns"},
+		{desc: "ast parser", opts: &Options{Parser: ParserAST}},
+		{desc: "unknown parser", opts: &Options{Parser: "sqlite"}, field: "parser"},
+		{desc: "unknown warning rule", opts: &Options{WarningRules: []Rule{"limit"}}, field: "warningRules"},
+		{desc: "rule levels", opts: &Options{RuleLevels: map[Rule]RuleLevel{RuleMeasure: LevelOff, RuleTenant: LevelWarn, RuleTime: LevelError}}},
+		{desc: "unknown rule of a level", opts: &Options{RuleLevels: map[Rule]RuleLevel{"limit": LevelOff}}, field: "ruleLevels"},
+		{desc: "unknown level", opts: &Options{RuleLevels: map[Rule]RuleLevel{RuleMeasure: "info"}}, field: "ruleLevels"},
+	}
+
+	for _, tc := range testcases {
+		tc := tc
+		t.Run(tc.desc, func(t *testing.T) {
+			t.Parallel()
+			_, err := tc.opts.Compile()
+			if tc.field == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			var configErr *ConfigError
+			if !errors.As(err, &configErr) {
+				t.Fatalf("want *ConfigError, got %v", err)
+			}
+			if configErr.Field != tc.field {
+				t.Errorf("want field %s, got %s", tc.field, configErr.Field)
+			}
+		})
+	}
+}
+
+func TestCompiled_TenantPatterns(t *testing.T) {
+	t.Parallel()
+
+	c, err := (&Options{TenantDimension: "ds_account", TenantTables: []string{"metrics_*", "db2.events_?"}}).Compile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	testcases := map[string]bool{
+		`SELECT * FROM db.metrics_2024_01 WHERE time > ago(1h) AND measure_name = 'a'`:                      false,
+		`SELECT * FROM db.metrics_2024_01 WHERE time > ago(1h) AND measure_name = 'a' AND ds_account = 'x'`: true,
+		`SELECT * FROM db.metrics WHERE time > ago(1h) AND measure_name = 'a'`:                              true,
+		`SELECT * FROM db2.events_a WHERE time > ago(1h) AND measure_name = 'a'`:                            false,
+		`SELECT * FROM db1.events_a WHERE time > ago(1h) AND measure_name = 'a'`:                            true,
+	}
+	for sql, want := range testcases {
+		if got, issues := c.Validate(sql); got != want {
+			t.Errorf("%s: want %v, got %v, issues: %+v", sql, want, got, issues)
+		}
+	}
+}
+
+func TestValidate_InvalidOptions(t *testing.T) {
+	t.Parallel()
+
+	valid, issues := Validate(`SELECT * FROM db.t WHERE time > ago(1h) AND measure_name = 'a'`, &Options{TenantDimension: "x", TenantTables: []string{"["}})
+	if valid || len(issues) != 1 {
+		t.Fatalf("want a single configuration issue, got %v %+v", valid, issues)
+	}
+}
@@ -0,0 +1,131 @@
+package validator
+
+// columnWords are the identifiers of WHERE and GROUP BY clauses that aren't columns
+var columnWords = map[string]bool{
+	"like": true, "is": true, "null": true, "true": true, "false": true, "escape": true,
+	"case": true, "when": true, "then": true, "else": true, "end": true,
+	"interval": true, "at": true, "zone": true, "asc": true, "desc": true, "distinct": true,
+}
+
+// UnknownDimensions reports the WHERE and GROUP BY references to columns the
+// table doesn't have, e.g. a typo like relasegroup, as warnings of
+// RuleUnknownDimension. Only SELECTs reading a single base table are checked.
+// columns returns the lower case column names of a table, or false when they
+// are unknown and the table isn't checked.
+func UnknownDimensions(sql string, columns func(database, table string) (map[string]bool, bool)) []Issue {
+	if !containsKeyword(sql, "select") {
+		return nil
+	}
+	src := stripComments(sql)
+	toks := lex(src)
+	var issues []Issue
+	for i := range toks {
+		if toks[i].kind != tkKeyword || toks[i].val != "select" {
+			continue
+		}
+		depth := toks[i].depth
+		fromIdx := findNextKeywordAtDepth(toks, i+1, depth, "from")
+		if fromIdx == -1 {
+			continue
+		}
+		stopIdx := findNextTerminatorAtDepth(toks, fromIdx+1, depth)
+		if !fromStartsWithBaseTable(toks, fromIdx+1, stopIdx, depth) {
+			continue
+		}
+		whereIdx := findNextKeywordBetweenAtDepth(toks, fromIdx+1, stopIdx, depth, "where")
+		sourcesEnd := stopIdx
+		if whereIdx != -1 {
+			sourcesEnd = whereIdx
+		}
+		if readsSeveralSources(toks, fromIdx+1, sourcesEnd, depth) {
+			continue
+		}
+		database, table, ok := tableNameAt(src, toks, fromIdx+1, stopIdx, depth)
+		if !ok {
+			continue
+		}
+		known, ok := columns(database, table)
+		if !ok {
+			continue
+		}
+
+		var refs []int
+		if whereIdx != -1 {
+			refs = columnReferences(toks, whereIdx+1, stopIdx, nil)
+		}
+		if groupIdx := stopIdx; groupIdx < len(toks) && toks[groupIdx].depth == depth && toks[groupIdx].val == "group" {
+			groupStop := findNextTerminatorAtDepth(toks, groupIdx+1, depth)
+			refs = append(refs, columnReferences(toks, groupIdx+2, groupStop, selectAliases(toks, i+1, fromIdx, depth))...)
+		}
+		reported := map[string]bool{}
+		for _, ref := range refs {
+			name := columnName(toks[ref].val)
+			if known[name] || reported[name] {
+				continue
+			}
+			reported[name] = true
+			issues = append(issues, Issue{
+				Snippet:  snippetAroundTokens(sql, toks, i, ref, len(toks)),
+				Start:    startOffset(toks, i),
+				End:      endOffset(toks, stopIdx),
+				Reason:   "column '" + name + "' does not exist in " + database + "." + table,
+				AtDepth:  depth,
+				Rule:     RuleUnknownDimension,
+				Code:     CodeUnknownDimension,
+				Severity: SeverityWarning,
+			})
+		}
+	}
+	return issues
+}
+
+// readsSeveralSources reports whether the FROM range joins or lists more than one
+// source, their columns can't be told apart
+func readsSeveralSources(toks []token, start, stop, depth int) bool {
+	for i := start; i < stop && i < len(toks); i++ {
+		if toks[i].depth == depth && (toks[i].val == "join" || toks[i].val == ",") {
+			return true
+		}
+	}
+	return false
+}
+
+// selectAliases returns the names the select list in the range projects with AS
+func selectAliases(toks []token, start, stop, depth int) map[string]bool {
+	aliases := map[string]bool{}
+	for i := start; i+1 < stop && i+1 < len(toks); i++ {
+		if toks[i].depth == depth && toks[i].kind == tkKeyword && toks[i].val == "as" && toks[i+1].kind == tkIdent {
+			aliases[stripQuotes(toks[i+1].val)] = true
+		}
+	}
+	return aliases
+}
+
+// columnReferences returns the indexes of the column identifiers in the range,
+// outside of subqueries and other than the time and measure columns, function
+// names, literal type names like date '...' and interval units
+func columnReferences(toks []token, start, stop int, aliases map[string]bool) []int {
+	var refs []int
+	for i := start; i < stop && i < len(toks); i++ {
+		if toks[i].val == "(" && i+1 < len(toks) && toks[i+1].kind == tkKeyword && toks[i+1].val == "select" {
+			if end := matchingParen(toks, i); end != -1 {
+				i = end
+			}
+			continue
+		}
+		if toks[i].kind != tkIdent || !isDimensionIdentifierAt(toks, i) || columnWords[toks[i].val] {
+			continue
+		}
+		if i > 0 && (toks[i-1].kind == tkNumber || toks[i-1].kind == tkString) {
+			continue
+		}
+		if i+1 < len(toks) && toks[i+1].kind == tkString {
+			continue
+		}
+		if aliases[columnName(toks[i].val)] {
+			continue
+		}
+		refs = append(refs, i)
+	}
+	return refs
+}
@@ -0,0 +1,70 @@
+package validator
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestUnknownDimensions(t *testing.T) {
+	t.Parallel()
+
+	columns := func(database, table string) (map[string]bool, bool) {
+		if database != "db" || table != "fleet" {
+			return nil, false
+		}
+		return map[string]bool{"time": true, "measure_name": true, "device": true, "releasegroup": true, "region": true}, true
+	}
+
+	testcases := []struct {
+		desc string
+		sql  string
+		want []string
+	}{
+		{
+			desc: "known dimensions",
+			sql:  `SELECT device, avg(measure_value::double) AS v FROM db.fleet WHERE time > ago(1h) AND measure_name = 'cpu' AND releasegroup IN ('stable') GROUP BY device, bin(time, 5m)`,
+		},
+		{
+			desc: "typo in WHERE",
+			sql:  `SELECT * FROM "db"."fleet" WHERE time > ago(1h) AND measure_name = 'cpu' AND relasegroup = 'stable' AND "relasegroup" <> 'x'`,
+			want: []string{"column 'relasegroup' does not exist in db.fleet"},
+		},
+		{
+			desc: "typo in GROUP BY, aliases are fine",
+			sql:  `SELECT regoin AS r, count(*) FROM db.fleet WHERE time BETWEEN ago(1d) AND now() AND measure_name = 'cpu' GROUP BY regoin, r ORDER BY 1`,
+			want: []string{"column 'regoin' does not exist in db.fleet"},
+		},
+		{
+			desc: "literals, keywords and functions",
+			sql:  `SELECT * FROM db.fleet WHERE time > from_iso8601_timestamp('2024-01-01') - interval '1' hour AND measure_name = 'cpu' AND region IS NOT NULL AND device LIKE 'a%' AND CASE WHEN t.region = 'eu' THEN true ELSE false END`,
+		},
+		{
+			desc: "subqueries are checked on their own",
+			sql:  `SELECT * FROM db.fleet WHERE time > ago(1h) AND measure_name = 'cpu' AND device IN (SELECT id FROM db.assets WHERE typo = 'x')`,
+		},
+		{
+			desc: "joins are skipped",
+			sql:  `SELECT * FROM db.fleet f JOIN db.assets a ON f.device = a.id WHERE f.time > ago(1h) AND a.owner = 'x'`,
+		},
+		{
+			desc: "unknown table",
+			sql:  `SELECT * FROM db.other WHERE typo = 'x'`,
+		},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.desc, func(t *testing.T) {
+			t.Parallel()
+			var reasons []string
+			for _, issue := range UnknownDimensions(tc.sql, columns) {
+				if issue.Rule != RuleUnknownDimension || issue.Severity != SeverityWarning {
+					t.Errorf("issue %+v is not an unknown-dimension warning", issue)
+				}
+				reasons = append(reasons, issue.Reason)
+			}
+			if !reflect.DeepEqual(reasons, tc.want) {
+				t.Errorf("UnknownDimensions() = %q, want %q", reasons, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,119 @@
+package validator
+
+import (
+	"sort"
+	"strings"
+)
+
+// directivePrefix starts the comments read as directives
+const directivePrefix = "ts:"
+
+// directiveRules are the directive names reading better than allow-<rule>
+var directiveRules = map[string]Rule{
+	"allow-missing-where":   RuleWhere,
+	"allow-missing-time":    RuleTime,
+	"allow-unbounded-time":  RuleBoundedTime,
+	"allow-missing-measure": RuleMeasure,
+	"allow-missing-tenant":  RuleTenant,
+	"allow-missing-column":  RuleRequiredColumn,
+}
+
+// Directive is a comment relaxing a rule for the statement it is in, e.g.
+// -- ts:allow-missing-measure reason="aggregated rollup"
+type Directive struct {
+	Rule   Rule   `json:"rule"`
+	Reason string `json:"reason"`
+	// Start and End are the byte offsets of the comment in the SQL
+	Start int `json:"start"`
+	End   int `json:"end"`
+}
+
+// Directives returns the directives in the comments of sql. A directive names
+// the rule it relaxes as allow-<rule>, e.g. allow-measure-pattern, or by one
+// of the names of the built-in rules like allow-missing-measure. Directives
+// without a reason are ignored.
+func Directives(sql string) []Directive {
+	var out []Directive
+	for start, end := range comments(sql) {
+		text := strings.TrimSpace(strings.TrimSuffix(strings.TrimPrefix(sql[start:end], "--"), "*/"))
+		text = strings.TrimSpace(strings.TrimPrefix(text, "/*"))
+		if !strings.HasPrefix(text, directivePrefix) {
+			continue
+		}
+		name, attrs, _ := strings.Cut(text[len(directivePrefix):], " ")
+		rule, ok := directiveRules[name]
+		if !ok {
+			after, found := strings.CutPrefix(name, "allow-")
+			if !found || after == "" {
+				continue
+			}
+			rule = Rule(after)
+		}
+		if reason := directiveReason(attrs); reason != "" {
+			out = append(out, Directive{Rule: rule, Reason: reason, Start: start, End: end})
+		}
+	}
+	return out
+}
+
+// directiveReason reads the quoted value of reason="..."
+func directiveReason(attrs string) string {
+	_, value, ok := strings.Cut(attrs, `reason="`)
+	if !ok {
+		return ""
+	}
+	reason, _, ok := strings.Cut(value, `"`)
+	if !ok {
+		return ""
+	}
+	return strings.TrimSpace(reason)
+}
+
+// Waivers returns the directives of sql relaxing the rules listed in
+// DirectiveRules, the ones honored by Validate. A nil *Options honors none.
+func (o *Options) Waivers(sql string) []Directive {
+	if o == nil || len(o.DirectiveRules) == 0 {
+		return nil
+	}
+	var out []Directive
+	for _, d := range Directives(sql) {
+		for _, rule := range o.DirectiveRules {
+			if d.Rule == rule {
+				out = append(out, d)
+				break
+			}
+		}
+	}
+	return out
+}
+
+// waive sets the Waiver of the issues of rules relaxed by a directive in
+// their statement, they are reported as warnings.
+func (c *Compiled) waive(sql string, toks []token, issues []Issue) []Issue {
+	if len(c.opts.DirectiveRules) == 0 || len(issues) == 0 {
+		return issues
+	}
+	waivers := c.opts.Waivers(sql)
+	if len(waivers) == 0 {
+		return issues
+	}
+	// statements end after their ';'
+	var ends []int
+	for _, tok := range toks {
+		if tok.depth == 0 && tok.kind == tkSymbol && tok.val == ";" {
+			ends = append(ends, tok.end)
+		}
+	}
+	statement := func(offset int) int {
+		return sort.Search(len(ends), func(i int) bool { return ends[i] > offset })
+	}
+	for i := range issues {
+		for _, w := range waivers {
+			if w.Rule == issues[i].Rule && statement(w.Start) == statement(issues[i].Start) {
+				issues[i].Waiver = w.Reason
+				break
+			}
+		}
+	}
+	return issues
+}
@@ -0,0 +1,98 @@
+package validator
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestDirectives(t *testing.T) {
+	t.Parallel()
+
+	sql := `-- ts:allow-missing-measure reason="aggregated rollup"
+SELECT * FROM db.t /* ts:allow-releasegroup reason="backfill" */ WHERE time > ago(1h)
+-- ts:allow-missing-time
+-- ts:allow-time reason=""
+-- ts:other reason="x"
+-- allow-measure reason="not a directive"
+AND name = '-- ts:allow-tenant reason="in a literal"'`
+	want := []Directive{
+		{Rule: RuleMeasure, Reason: "aggregated rollup", Start: 0, End: 54},
+		{Rule: "releasegroup", Reason: "backfill", Start: 74, End: 119},
+	}
+	if got := Directives(sql); !reflect.DeepEqual(got, want) {
+		t.Errorf("want %+v, got %+v", want, got)
+	}
+}
+
+func TestValidate_Directives(t *testing.T) {
+	t.Parallel()
+
+	opts := &Options{DirectiveRules: []Rule{RuleMeasure}}
+	testcases := []struct {
+		desc   string
+		input  string
+		opts   *Options
+		valid  bool
+		waiver string
+	}{
+		{
+			desc:   "relaxed",
+			input:  "-- ts:allow-missing-measure reason=\"aggregated rollup\"\nSELECT * FROM db.rollup WHERE time > ago(1h)",
+			opts:   opts,
+			valid:  true,
+			waiver: "aggregated rollup",
+		},
+		{
+			desc:  "rule not configured",
+			input: "-- ts:allow-missing-measure reason=\"aggregated rollup\"\nSELECT * FROM db.rollup WHERE time > ago(1h)",
+		},
+		{
+			desc:  "other rule",
+			input: "-- ts:allow-missing-time reason=\"aggregated rollup\"\nSELECT * FROM db.rollup WHERE time > ago(1h)",
+			opts:  opts,
+		},
+		{
+			desc:  "without a reason",
+			input: "-- ts:allow-missing-measure\nSELECT * FROM db.rollup WHERE time > ago(1h)",
+			opts:  opts,
+		},
+		{
+			desc:  "other statement",
+			input: "-- ts:allow-missing-measure reason=\"aggregated rollup\"\nSELECT * FROM db.t WHERE time > ago(1h) AND measure_name = 'cpu';\nSELECT * FROM db.rollup WHERE time > ago(1h)",
+			opts:  opts,
+		},
+	}
+
+	for _, tc := range testcases {
+		tc := tc
+		t.Run(tc.desc, func(t *testing.T) {
+			t.Parallel()
+			valid, issues := Validate(tc.input, tc.opts)
+			if valid != tc.valid || len(issues) != 1 {
+				t.Fatalf("want %v with an issue, got %v %+v", tc.valid, valid, issues)
+			}
+			if issues[0].Waiver != tc.waiver || (tc.waiver != "") != (issues[0].Severity == SeverityWarning) {
+				t.Errorf("want waiver %q, got %+v", tc.waiver, issues[0])
+			}
+		})
+	}
+
+	// only the statement of the directive is relaxed
+	sql := "SELECT * FROM db.a WHERE time > ago(1h);\n-- ts:allow-missing-measure reason=\"rollup\"\nSELECT * FROM db.b WHERE time > ago(1h)"
+	if valid, issues := Validate(sql, opts); valid || len(Errors(issues)) != 1 || len(Warnings(issues)) != 1 || Warnings(issues)[0].Snippet != "SELECT * FROM db.b WHERE time > ago(1h)" {
+		t.Errorf("want the second statement relaxed, got %v %+v", valid, issues)
+	}
+}
+
+func TestCompile_DirectiveRules(t *testing.T) {
+	t.Parallel()
+
+	var configErr *ConfigError
+	if _, err := (&Options{DirectiveRules: []Rule{"nope"}}).Compile(); !errors.As(err, &configErr) || configErr.Field != "directiveRules" {
+		t.Errorf("want an error of directiveRules, got %v", err)
+	}
+	if _, err := (&Options{DirectiveRules: []Rule{"releasegroup"}, Checks: []Check{releaseGroupCheck{}}}).Compile(); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,198 @@
+package validator
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+)
+
+// Document is the text of an editor validated as it is edited. An edit re-lexes
+// the text from the token before it until the tokens line up with the previous
+// ones again, and re-validates only the top-level parenthesized SELECTs it
+// touches, e.g. the CTE bodies of a large WITH query, and the statements around
+// them. The issues of the other SELECTs are kept, shifted by the edit.
+//
+// With ParserAST every edit validates the whole text, the syntax tree isn't
+// built incrementally.
+type Document struct {
+	c    *Compiled
+	sql  string
+	toks []token
+	// blocks are the top-level parenthesized SELECTs with their issues
+	blocks []docBlock
+	// outer are the issues of the SELECTs outside the blocks
+	outer []scopeIssues
+}
+
+// docBlock is a parenthesized SELECT at depth 0, its checks read no token
+// outside the parentheses
+type docBlock struct {
+	open, close int
+	issues      []scopeIssues
+}
+
+// scopeIssues are the issues of the SELECT at selIdx, before their severity is set
+type scopeIssues struct {
+	selIdx int
+	issues []Issue
+}
+
+// Open validates sql as the text of a Document.
+func (c *Compiled) Open(sql string) *Document {
+	d := &Document{c: c, sql: sql, toks: lex(sql)}
+	d.revalidate(0, 0, 0, 0)
+	return d
+}
+
+// SQL returns the current text of the document.
+func (d *Document) SQL() string {
+	return d.sql
+}
+
+// Edit replaces the bytes [start, end) of the text with text and re-validates
+// the SELECTs the edit touches.
+func (d *Document) Edit(start, end int, text string) error {
+	if start < 0 || end < start || end > len(d.sql) {
+		return fmt.Errorf("invalid edit [%d, %d) of text of length %d", start, end, len(d.sql))
+	}
+	sql := d.sql[:start] + text + d.sql[end:]
+	delta := len(text) - (end - start)
+
+	// tokens ending before the edit are unchanged, the lexer resumes after them
+	keep := sort.Search(len(d.toks), func(i int) bool { return d.toks[i].end >= start })
+	from, depth, caseDepth := 0, 0, 0
+	if keep > 0 {
+		from, depth, caseDepth = stateAfter(d.toks[keep-1])
+	}
+	toks := slices.Clone(d.toks[:keep])
+
+	// once a token after the edit equals a previous one moved by the edit, the
+	// lexer is in the same state and the remaining tokens are the previous ones
+	next := sort.Search(len(d.toks), func(i int) bool { return d.toks[i].pos >= end })
+	resumed := -1
+	for tok := range tokensFrom(sql, from, depth, caseDepth) {
+		for next < len(d.toks) && d.toks[next].pos+delta < tok.pos {
+			next++
+		}
+		if tok.pos >= start+len(text) && next < len(d.toks) && moved(d.toks[next], delta) == tok {
+			resumed = next
+			break
+		}
+		toks = append(toks, tok)
+	}
+	changed := len(toks)
+	if resumed != -1 {
+		for _, tok := range d.toks[resumed:] {
+			toks = append(toks, moved(tok, delta))
+		}
+	} else {
+		resumed = len(d.toks)
+	}
+
+	d.sql, d.toks = sql, toks
+	d.revalidate(keep, changed, changed-resumed, delta)
+	return nil
+}
+
+// Validate returns the verdict and issues of the current text, like Validate
+// of the whole text.
+func (d *Document) Validate() (bool, []Issue) {
+	if d.c.opts.Parser == ParserAST {
+		return d.c.Validate(d.sql)
+	}
+	scopes := slices.Clone(d.outer)
+	for _, b := range d.blocks {
+		scopes = append(scopes, b.issues...)
+	}
+	slices.SortFunc(scopes, func(a, b scopeIssues) int { return a.selIdx - b.selIdx })
+	var issues []Issue
+	for _, s := range scopes {
+		issues = append(issues, s.issues...)
+	}
+	return d.c.verdict(d.c.waive(d.sql, d.toks, issues))
+}
+
+// revalidate checks the SELECTs of the blocks overlapping the tokens
+// [keep, changed), the blocks before keep are unchanged and the ones after are
+// moved by shift tokens and delta bytes.
+func (d *Document) revalidate(keep, changed, shift, delta int) {
+	if d.c.opts.Parser == ParserAST {
+		// Validate runs on the whole text
+		return
+	}
+	previous := map[int]docBlock{}
+	for _, b := range d.blocks {
+		previous[b.open] = b
+	}
+
+	var blocks []docBlock
+	var outer []scopeIssues
+	for i := 0; i < len(d.toks); i++ {
+		open := i
+		if !startsBlock(d.toks, open) {
+			outer = append(outer, d.checkScope(i)...)
+			continue
+		}
+		closeIdx := matchingParen(d.toks, open)
+		if closeIdx == -1 {
+			outer = append(outer, d.checkScope(i)...)
+			continue
+		}
+		i = closeIdx
+
+		switch {
+		case closeIdx < keep:
+			if b, ok := previous[open]; ok && b.close == closeIdx {
+				blocks = append(blocks, b)
+				continue
+			}
+		case open >= changed:
+			if b, ok := previous[open-shift]; ok && b.close == closeIdx-shift {
+				blocks = append(blocks, b.moved(shift, delta))
+				continue
+			}
+		}
+		b := docBlock{open: open, close: closeIdx}
+		for j := open + 1; j < closeIdx; j++ {
+			b.issues = append(b.issues, d.checkScope(j)...)
+		}
+		blocks = append(blocks, b)
+	}
+	d.blocks, d.outer = blocks, outer
+}
+
+// checkScope checks the SELECT at the token i, if it reads from a table
+func (d *Document) checkScope(i int) []scopeIssues {
+	s, ok := heuristicScope(d.toks, i)
+	if !ok {
+		return nil
+	}
+	return []scopeIssues{{selIdx: i, issues: d.c.checkSelect(d.sql, d.toks, s)}}
+}
+
+// moved returns the block with its tokens and issues moved by an edit before it
+func (b docBlock) moved(shift, delta int) docBlock {
+	out := docBlock{open: b.open + shift, close: b.close + shift}
+	for _, s := range b.issues {
+		issues := slices.Clone(s.issues)
+		for i := range issues {
+			issues[i].Start += delta
+			issues[i].End += delta
+		}
+		out.issues = append(out.issues, scopeIssues{selIdx: s.selIdx + shift, issues: issues})
+	}
+	return out
+}
+
+// startsBlock reports whether the token at i opens a parenthesized SELECT at depth 0
+func startsBlock(toks []token, i int) bool {
+	return toks[i].depth == 0 && toks[i].kind == tkSymbol && toks[i].val == "(" &&
+		i+1 < len(toks) && toks[i+1].kind == tkKeyword && (toks[i+1].val == "select" || toks[i+1].val == "with")
+}
+
+// moved returns the token moved by delta bytes
+func moved(tok token, delta int) token {
+	tok.pos += delta
+	tok.end += delta
+	return tok
+}
@@ -0,0 +1,162 @@
+package validator
+
+import (
+	"fmt"
+	"math/rand"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// withQuery has a CTE per device, the second one without a time filter
+func withQuery(devices int) string {
+	var b strings.Builder
+	b.WriteString("WITH ")
+	for i := range devices {
+		if i > 0 {
+			b.WriteString(",\n")
+		}
+		filter := "time > ago(1h) AND "
+		if i == 1 {
+			filter = ""
+		}
+		fmt.Fprintf(&b, "d%d AS (SELECT time, measure_value::double AS v FROM db.tbl WHERE %smeasure_name = 'cpu' AND device = 'd%d' /* (d%d) */)", i, filter, i, i)
+	}
+	b.WriteString("\nSELECT * FROM d0 JOIN d1 ON d0.time = d1.time")
+	return b.String()
+}
+
+func TestDocument_Edit(t *testing.T) {
+	t.Parallel()
+
+	sql := withQuery(5)
+	testcases := []struct {
+		desc       string
+		start, end int
+		text       string
+	}{
+		{desc: "add the time filter", start: strings.Index(sql, "WHERE measure_name") + len("WHERE "), text: "time > ago(1h) AND "},
+		{desc: "remove a time filter", start: strings.Index(sql, "time > ago(1h)"), end: strings.Index(sql, "time > ago(1h)") + len("time > ago(1h) AND ")},
+		{desc: "extend an identifier", start: strings.Index(sql, "device"), text: "x"},
+		{desc: "open a comment", start: strings.Index(sql, "d2 AS"), text: "/* "},
+		{desc: "open a string", start: strings.Index(sql, "'cpu'"), text: "'"},
+		{desc: "close a parenthesis", start: strings.Index(sql, "d3 AS (") + len("d3 AS ("), text: ")"},
+		{desc: "remove a CTE", start: strings.Index(sql, ",\nd3"), end: strings.Index(sql, ",\nd4")},
+		{desc: "add a CTE", start: strings.Index(sql, "\nSELECT"), text: ", d9 AS (SELECT * FROM db.tbl)"},
+		{desc: "add a statement", start: len(sql), text: "; SELECT * FROM db.tbl WHERE measure_name = 'cpu'"},
+		{desc: "replace everything", end: len(sql), text: "SHOW TABLES"},
+	}
+
+	c, err := (&Options{}).Compile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range testcases {
+		tc := tc
+		t.Run(tc.desc, func(t *testing.T) {
+			t.Parallel()
+			// cases without an end insert the text
+			end := max(tc.start, tc.end)
+			d := c.Open(sql)
+			if err := d.Edit(tc.start, end, tc.text); err != nil {
+				t.Fatal(err)
+			}
+			want := sql[:tc.start] + tc.text + sql[end:]
+			if d.SQL() != want {
+				t.Fatalf("want text %q, got %q", want, d.SQL())
+			}
+			assertValidateEqual(t, c, d)
+		})
+	}
+
+	if err := c.Open(sql).Edit(10, 5, ""); err == nil {
+		t.Errorf("want an error of an invalid edit")
+	}
+}
+
+func TestDocument_RandomEdits(t *testing.T) {
+	t.Parallel()
+
+	c, err := (&Options{}).Compile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	pieces := []string{"", " ", "(", ")", "'", "--", "\n", "/*", "*/", "SELECT", " time > ago(1h) AND ", "measure_name = 'x'", ",", "CASE", "END", "db.tbl", "WHERE"}
+	rng := rand.New(rand.NewSource(1))
+	d := c.Open(withQuery(4))
+	for range 500 {
+		start := rng.Intn(len(d.SQL()) + 1)
+		end := min(len(d.SQL()), start+rng.Intn(8))
+		if err := d.Edit(start, end, pieces[rng.Intn(len(pieces))]); err != nil {
+			t.Fatal(err)
+		}
+		if !assertValidateEqual(t, c, d) {
+			return
+		}
+		if !reflect.DeepEqual(d.toks, lex(d.SQL())) {
+			t.Fatalf("tokens differ from lexing %q", d.SQL())
+		}
+	}
+}
+
+func TestDocument_ChecksTouchedBlocks(t *testing.T) {
+	t.Parallel()
+
+	runs := 0
+	check := funcCheck{rule: "count", check: func(*Select) []Issue {
+		runs++
+		return nil
+	}}
+	c, err := (&Options{Checks: []Check{check}}).Compile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sql := withQuery(20)
+	d := c.Open(sql)
+	if runs != 20 {
+		t.Fatalf("want 20 checked SELECTs, got %d", runs)
+	}
+
+	runs = 0
+	at := strings.Index(sql, "d7'")
+	if err := d.Edit(at, at+2, "d77"); err != nil {
+		t.Fatal(err)
+	}
+	if runs != 1 {
+		t.Errorf("want the edited CTE checked, got %d checked SELECTs", runs)
+	}
+	if valid, issues := d.Validate(); valid || len(issues) != 1 || !strings.Contains(issues[0].Snippet, "device = 'd1'") {
+		t.Errorf("want the issue of the CTE without a time filter, got %v %+v", valid, issues)
+	}
+}
+
+func TestDocument_AST(t *testing.T) {
+	t.Parallel()
+
+	c, err := (&Options{Parser: ParserAST}).Compile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sql := withQuery(3)
+	d := c.Open(sql)
+	at := strings.Index(sql, "WHERE measure_name") + len("WHERE ")
+	if err := d.Edit(at, at, "time > ago(1h) AND "); err != nil {
+		t.Fatal(err)
+	}
+	if valid, issues := d.Validate(); !valid {
+		t.Errorf("unexpected issues %+v", issues)
+	}
+}
+
+// assertValidateEqual compares the issues of the document with validating its
+// whole text
+func assertValidateEqual(t *testing.T, c *Compiled, d *Document) bool {
+	t.Helper()
+	wantValid, wantIssues := c.Validate(d.SQL())
+	valid, issues := d.Validate()
+	if valid != wantValid || !reflect.DeepEqual(issues, wantIssues) {
+		t.Errorf("text %q\nwant %v %+v\ngot %v %+v", d.SQL(), wantValid, wantIssues, valid, issues)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,167 @@
+package validator
+
+import "sort"
+
+// SpanKind names what the validator recognized in a part of the SQL
+type SpanKind string
+
+const (
+	SpanTable   SpanKind = "table"
+	SpanTime    SpanKind = "time"
+	SpanMeasure SpanKind = "measure"
+	SpanIssue   SpanKind = "issue"
+	// SpanAlias is a filter on a name measure_name was projected under
+	SpanAlias SpanKind = "alias"
+)
+
+// Span is a byte range of the SQL, issue spans cover the offending SELECT
+type Span struct {
+	Start int
+	End   int
+	Kind  SpanKind
+	// Note is the issue reason for issue spans and the hint of alias spans
+	Note string
+}
+
+// Explain validates sql like Validate and also returns the spans the checks are
+// based on: the base tables read, the time predicates and the measure_name
+// predicates of their WHERE clauses, and the issues. Filters on a name measure_name
+// was projected under by a CTE or subquery are returned as alias spans, pointing
+// to where the measure filter has to be. Spans are ordered by start.
+func Explain(sql string, opts *Options) ([]Span, []Issue) {
+	c, err := opts.Compile()
+	if err != nil {
+		return nil, []Issue{{Reason: err.Error(), Severity: SeverityError, Code: CodeInvalidOptions}}
+	}
+	return c.Explain(sql)
+}
+
+// Explain explains sql with the compiled options, see the package level Explain.
+func (c *Compiled) Explain(sql string) ([]Span, []Issue) {
+	_, issues := c.Validate(sql)
+	toks := lex(stripComments(sql))
+
+	aliases := measureAliases(toks)
+	var spans []Span
+	for i := range toks {
+		if toks[i].kind != tkKeyword || toks[i].val != "select" {
+			continue
+		}
+		depth := toks[i].depth
+		fromIdx := findNextKeywordAtDepth(toks, i+1, depth, "from")
+		if fromIdx == -1 {
+			continue
+		}
+		stopIdx := findNextTerminatorAtDepth(toks, fromIdx+1, depth)
+		if !fromStartsWithBaseTable(toks, fromIdx+1, stopIdx, depth) {
+			if whereIdx := findNextKeywordBetweenAtDepth(toks, fromIdx+1, stopIdx, depth, "where"); whereIdx != -1 && aliases != nil {
+				spans = append(spans, aliasSpans(toks, whereIdx+1, findNextTerminatorAtDepth(toks, whereIdx+1, depth), aliases)...)
+			}
+			continue
+		}
+		if start, end := baseTableTokens(toks, fromIdx+1, stopIdx, depth); start != -1 {
+			spans = append(spans, Span{Start: toks[start].pos, End: toks[end-1].end, Kind: SpanTable})
+		}
+		whereIdx := findNextKeywordBetweenAtDepth(toks, fromIdx+1, stopIdx, depth, "where")
+		if whereIdx == -1 {
+			continue
+		}
+		whereStop := findNextTerminatorAtDepth(toks, whereIdx+1, depth)
+		spans = append(spans, predicateSpans(toks, whereIdx+1, whereStop, c.measureWrappers, c.timeColumns, c.opts.AllowMeasureLike)...)
+	}
+	for _, issue := range issues {
+		if issue.End > issue.Start {
+			spans = append(spans, Span{Start: issue.Start, End: issue.End, Kind: SpanIssue, Note: issue.Reason})
+		}
+	}
+	sort.SliceStable(spans, func(i, j int) bool { return spans[i].Start < spans[j].Start })
+	return spans, issues
+}
+
+// baseTableTokens returns the token range of the first FROM source at this depth
+func baseTableTokens(toks []token, start, stop, depth int) (int, int) {
+	first, last := -1, -1
+	expectIdent := true
+	for i := start; i < stop && i < len(toks); i++ {
+		if toks[i].depth != depth {
+			continue
+		}
+		switch {
+		case expectIdent && toks[i].kind == tkIdent:
+			if first == -1 {
+				first = i
+			}
+			last = i
+			expectIdent = false
+		case !expectIdent && toks[i].kind == tkSymbol && toks[i].val == ".":
+			expectIdent = true
+		case first != -1:
+			return first, last + 1
+		}
+	}
+	if first == -1 {
+		return -1, -1
+	}
+	return first, last + 1
+}
+
+// predicateSpans returns the spans of the time and measure_name predicates in the range
+func predicateSpans(toks []token, start, stop int, wrappers, timeColumns map[string]bool, like bool) []Span {
+	var spans []Span
+	for i := start; i < stop && i < len(toks); i++ {
+		switch {
+		case isTimeColumnAt(toks, i, timeColumns) && i+1 < stop &&
+			((toks[i+1].kind == tkKeyword && (toks[i+1].val == "between" || toks[i+1].val == "not")) ||
+				(toks[i+1].kind == tkSymbol && isCompareOp(toks[i+1].val))):
+			end := predicateEnd(toks, i, stop)
+			spans = append(spans, Span{Start: toks[i].pos, End: toks[end-1].end, Kind: SpanTime})
+			i = end - 1
+		case toks[i].kind == tkIdent && toks[i].val == "regexp_like" && i+5 < stop &&
+			toks[i+2].val == "measure_name" && toks[i+5].val == ")":
+			spans = append(spans, Span{Start: toks[i].pos, End: toks[i+5].end, Kind: SpanMeasure})
+			i += 5
+		case toks[i].caseDepth == 0 && wrappedMeasureEnd(toks, i, stop, wrappers) != -1:
+			end := predicateEnd(toks, i, stop)
+			spans = append(spans, Span{Start: toks[i].pos, End: toks[end-1].end, Kind: SpanMeasure})
+			i = end - 1
+		case toks[i].caseDepth == 0 && measureInListEnd(toks, i, stop) != -1:
+			end := measureInListEnd(toks, i, stop)
+			spans = append(spans, Span{Start: toks[i].pos, End: toks[end-1].end, Kind: SpanMeasure})
+			i = end - 1
+		case toks[i].kind == tkIdent && toks[i].val == "measure_name" && toks[i].caseDepth == 0 &&
+			i+2 < stop && (toks[i+1].val == "=" || (like && toks[i+1].kind == tkIdent && toks[i+1].val == "like")):
+			end := predicateEnd(toks, i, stop)
+			spans = append(spans, Span{Start: toks[i].pos, End: toks[end-1].end, Kind: SpanMeasure})
+			i = end - 1
+		}
+	}
+	return spans
+}
+
+// predicateEnd returns the index after the predicate starting at i, which ends at
+// the next AND or OR at the same depth, the AND of a BETWEEN excluded.
+func predicateEnd(toks []token, i, stop int) int {
+	depth := toks[i].depth
+	between := false
+	for j := i + 1; j < stop && j < len(toks); j++ {
+		if toks[j].depth < depth {
+			return j
+		}
+		if toks[j].depth != depth || toks[j].kind != tkKeyword {
+			continue
+		}
+		switch toks[j].val {
+		case "between":
+			between = true
+		case "and":
+			if between {
+				between = false
+				continue
+			}
+			return j
+		case "or":
+			return j
+		}
+	}
+	return min(stop, len(toks))
+}
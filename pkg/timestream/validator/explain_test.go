@@ -0,0 +1,143 @@
+package validator
+
+import "testing"
+
+func TestExplain(t *testing.T) {
+	t.Parallel()
+
+	type span struct {
+		kind SpanKind
+		text string
+	}
+	testcases := []struct {
+		desc  string
+		input string
+		opts  *Options
+		want  []span
+	}{
+		{
+			desc:  "valid query",
+			input: `SELECT * FROM "db"."tbl" WHERE time BETWEEN ago(1h) AND now() AND measure_name = 'cpu' AND device = 'a'`,
+			want: []span{
+				{SpanTable, `"db"."tbl"`},
+				{SpanTime, "time BETWEEN ago(1h) AND now()"},
+				{SpanMeasure, "measure_name = 'cpu'"},
+			},
+		},
+		{
+			desc:  "measure IN list",
+			input: `SELECT * FROM db.tbl WHERE time > ago(1h) AND measure_name IN ('cpu', 'mem')`,
+			want: []span{
+				{SpanTable, "db.tbl"},
+				{SpanTime, "time > ago(1h)"},
+				{SpanMeasure, "measure_name IN ('cpu', 'mem')"},
+			},
+		},
+		{
+			desc:  "measure LIKE",
+			input: `SELECT * FROM db.tbl WHERE time > ago(1h) AND measure_name LIKE 'cpu_%'`,
+			opts:  &Options{AllowMeasureLike: true},
+			want: []span{
+				{SpanTable, "db.tbl"},
+				{SpanTime, "time > ago(1h)"},
+				{SpanMeasure, "measure_name LIKE 'cpu_%'"},
+			},
+		},
+		{
+			desc:  "wrapped measure",
+			input: `SELECT * FROM db.tbl WHERE time > ago(1h) AND lower(measure_name) = 'cpu'`,
+			want: []span{
+				{SpanTable, "db.tbl"},
+				{SpanTime, "time > ago(1h)"},
+				{SpanMeasure, "lower(measure_name) = 'cpu'"},
+			},
+		},
+		{
+			desc:  "regexp_like measure",
+			input: `SELECT * FROM db.tbl WHERE (time > ago(1h)) AND regexp_like(measure_name, '^cpu')`,
+			want: []span{
+				{SpanTable, "db.tbl"},
+				{SpanTime, "time > ago(1h)"},
+				{SpanMeasure, "regexp_like(measure_name, '^cpu')"},
+			},
+		},
+		{
+			desc:  "issue",
+			input: `WITH a AS (SELECT * FROM db.tbl WHERE measure_name = 'cpu') SELECT * FROM a`,
+			want: []span{
+				{SpanIssue, "SELECT * FROM db.tbl WHERE measure_name = 'cpu'"},
+				{SpanTable, "db.tbl"},
+				{SpanMeasure, "measure_name = 'cpu'"},
+			},
+		},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.desc, func(t *testing.T) {
+			t.Parallel()
+			spans, _ := Explain(tc.input, tc.opts)
+			if len(spans) != len(tc.want) {
+				t.Fatalf("Explain() returned %d spans %+v, want %d", len(spans), spans, len(tc.want))
+			}
+			for i, s := range spans {
+				if got := (span{s.Kind, tc.input[s.Start:s.End]}); got != tc.want[i] {
+					t.Errorf("span %d = %+v, want %+v", i, got, tc.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestExplain_MeasureAlias(t *testing.T) {
+	t.Parallel()
+
+	testcases := []struct {
+		desc  string
+		input string
+		want  string
+		note  string
+	}{
+		{
+			desc:  "CTE",
+			input: `WITH c AS (SELECT time, measure_name AS m FROM db.tbl WHERE time > ago(1h) AND measure_name = 'cpu') SELECT * FROM c WHERE m = 'cpu'`,
+			want:  "m = 'cpu'",
+			note:  "m is measure_name as projected by c, filter measure_name inside c to limit what it reads",
+		},
+		{
+			desc:  "subquery",
+			input: `SELECT * FROM (SELECT measure_name AS m FROM db.tbl WHERE time > ago(1h) AND measure_name = 'cpu') t WHERE t.m IN ('cpu', 'mem')`,
+			want:  "t.m IN ('cpu', 'mem')",
+			note:  "m is measure_name as projected by a subquery, filter measure_name inside a subquery to limit what it reads",
+		},
+		{
+			desc:  "alias only in the base query",
+			input: `SELECT measure_name AS m FROM db.tbl WHERE time > ago(1h) AND measure_name = 'cpu' ORDER BY m`,
+		},
+	}
+
+	for _, tc := range testcases {
+		tc := tc
+		t.Run(tc.desc, func(t *testing.T) {
+			t.Parallel()
+			spans, _ := Explain(tc.input, nil)
+			var aliases []Span
+			for _, s := range spans {
+				if s.Kind == SpanAlias {
+					aliases = append(aliases, s)
+				}
+			}
+			if tc.want == "" {
+				if len(aliases) != 0 {
+					t.Errorf("Explain() returned alias spans %+v, want none", aliases)
+				}
+				return
+			}
+			if len(aliases) != 1 {
+				t.Fatalf("Explain() returned alias spans %+v, want one", aliases)
+			}
+			if got := tc.input[aliases[0].Start:aliases[0].End]; got != tc.want || aliases[0].Note != tc.note {
+				t.Errorf("alias span = %q, %q, want %q, %q", got, aliases[0].Note, tc.want, tc.note)
+			}
+		})
+	}
+}
@@ -0,0 +1,31 @@
+package validator_test
+
+import (
+	"testing"
+
+	"github.com/grafana/timestream-datasource/pkg/timestream"
+	"github.com/grafana/timestream-datasource/pkg/timestream/validator"
+)
+
+// FuzzValidate checks the validator doesn't panic and reports issues within the
+// query, seeded with the queries of the query builder:
+//
+//	go test ./pkg/timestream/validator -fuzz FuzzValidate
+func FuzzValidate(f *testing.F) {
+	for _, sql := range timestream.BuilderCorpus() {
+		f.Add(sql)
+	}
+	f.Fuzz(func(t *testing.T, sql string) {
+		valid, issues := validator.Validate(sql, nil)
+		if valid != (len(validator.Errors(issues)) == 0) {
+			t.Fatalf("valid = %v with issues %+v", valid, issues)
+		}
+		for _, issue := range issues {
+			if issue.Start < 0 || issue.Start > issue.End || issue.End > len(sql) {
+				t.Fatalf("issue %q spans %d-%d of %d bytes", issue.Reason, issue.Start, issue.End, len(sql))
+			}
+		}
+		validator.Deparameterize(sql)
+		validator.DeterministicOrder(sql)
+	})
+}
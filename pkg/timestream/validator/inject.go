@@ -0,0 +1,111 @@
+package validator
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// InjectPredicate ANDs predicate into the WHERE clause of every SELECT of sql that
+// reads table, given as "db.table" or "table", adding a WHERE clause when there is
+// none. The existing condition is parenthesized so the predicate applies to each of
+// its OR branches. It returns the rewritten sql and the number of SELECTs changed.
+func InjectPredicate(sql, table, predicate string) (string, int, error) {
+	if err := checkPredicate(predicate); err != nil {
+		return sql, 0, err
+	}
+	table = strings.ToLower(strings.ReplaceAll(table, `"`, ""))
+	src := stripComments(sql)
+	toks := lex(src)
+
+	type edit struct {
+		pos  int
+		text string
+	}
+	var edits []edit
+	changed := 0
+	for i, tok := range toks {
+		if tok.kind != tkKeyword || tok.val != "select" {
+			continue
+		}
+		fromIdx := findNextKeywordAtDepth(toks, i+1, tok.depth, "from")
+		if fromIdx == -1 {
+			continue
+		}
+		stopIdx := clauseEnd(toks, fromIdx+1, tok.depth)
+		if !fromStartsWithBaseTable(toks, fromIdx+1, stopIdx, tok.depth) || !sameTable(baseTableName(toks, fromIdx+1, stopIdx, tok.depth), table) {
+			continue
+		}
+		whereIdx := findNextKeywordBetweenAtDepth(toks, fromIdx+1, stopIdx, tok.depth, "where")
+		changed++
+		switch {
+		case whereIdx == -1:
+			edits = append(edits, edit{pos: toks[stopIdx-1].end, text: " WHERE " + predicate})
+		case whereIdx+1 < stopIdx:
+			edits = append(edits, edit{pos: toks[whereIdx+1].pos, text: "("}, edit{pos: toks[stopIdx-1].end, text: ") AND " + predicate})
+		default:
+			return sql, 0, fmt.Errorf("empty WHERE clause")
+		}
+	}
+	if len(edits) == 0 {
+		return sql, 0, nil
+	}
+
+	// apply from the back so the offsets stay valid
+	sort.SliceStable(edits, func(i, j int) bool { return edits[i].pos > edits[j].pos })
+	out := src
+	for _, e := range edits {
+		out = out[:e.pos] + e.text + out[e.pos:]
+	}
+	return strings.TrimSpace(out), changed, nil
+}
+
+// clauseEnd returns the index just past the FROM and WHERE clauses of a SELECT,
+// which also end at LIMIT and at the end of the statement.
+func clauseEnd(toks []token, start, depth int) int {
+	stop := findNextTerminatorAtDepth(toks, start, depth)
+	for i := start; i < stop; i++ {
+		if toks[i].depth == depth && ((toks[i].kind == tkIdent && toks[i].val == "limit") || (toks[i].kind == tkSymbol && toks[i].val == ";")) {
+			return i
+		}
+	}
+	return stop
+}
+
+// sameTable compares a "db.table" name to a "db.table" or "table" name
+func sameTable(name, table string) bool {
+	if strings.Contains(table, ".") {
+		return name == table
+	}
+	return name[strings.LastIndex(name, ".")+1:] == table
+}
+
+// checkPredicate makes sure the predicate is a single expression that can't end
+// the WHERE clause it is added to
+func checkPredicate(predicate string) error {
+	if strings.TrimSpace(predicate) == "" {
+		return fmt.Errorf("empty predicate")
+	}
+	if stripComments(predicate) != predicate {
+		return fmt.Errorf("predicate contains a comment")
+	}
+	depth := 0
+	for tok := range tokens(predicate) {
+		switch {
+		case tok.kind == tkSymbol && tok.val == "(":
+			depth++
+		case tok.kind == tkSymbol && tok.val == ")":
+			if depth--; depth < 0 {
+				return fmt.Errorf("predicate has unbalanced parentheses")
+			}
+		case tok.kind == tkSymbol && tok.val == ";":
+			return fmt.Errorf("predicate contains ;")
+		case tok.kind == tkKeyword && tok.val != "and" && tok.val != "or" && tok.val != "not" && tok.val != "in" && tok.val != "between":
+			return fmt.Errorf("predicate contains %s", strings.ToUpper(tok.val))
+		}
+	}
+	if depth != 0 {
+		return fmt.Errorf("predicate has unbalanced parentheses")
+	}
+	return nil
+}
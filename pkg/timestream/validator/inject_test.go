@@ -0,0 +1,95 @@
+package validator
+
+import "testing"
+
+func TestInjectPredicate(t *testing.T) {
+	t.Parallel()
+
+	testcases := []struct {
+		desc    string
+		input   string
+		table   string
+		want    string
+		changed int
+	}{
+		{
+			desc:    "OR branches",
+			input:   `SELECT * FROM db.tbl WHERE time > ago(1h) AND measure_name = 'a' OR time > ago(1h) AND measure_name = 'b'`,
+			table:   "db.tbl",
+			want:    `SELECT * FROM db.tbl WHERE (time > ago(1h) AND measure_name = 'a' OR time > ago(1h) AND measure_name = 'b') AND "site" = 'x'`,
+			changed: 1,
+		},
+		{
+			desc:    "before group by and limit",
+			input:   `SELECT device, count(*) FROM "db"."tbl" WHERE time > ago(1h) GROUP BY device LIMIT 10`,
+			table:   "db.tbl",
+			want:    `SELECT device, count(*) FROM "db"."tbl" WHERE (time > ago(1h)) AND "site" = 'x' GROUP BY device LIMIT 10`,
+			changed: 1,
+		},
+		{
+			desc:    "limit without group by",
+			input:   `SELECT * FROM db.tbl t WHERE time > ago(1h) LIMIT 10;`,
+			table:   "tbl",
+			want:    `SELECT * FROM db.tbl t WHERE (time > ago(1h)) AND "site" = 'x' LIMIT 10;`,
+			changed: 1,
+		},
+		{
+			desc:    "missing WHERE",
+			input:   `SELECT * FROM db.tbl ORDER BY time`,
+			table:   "db.tbl",
+			want:    `SELECT * FROM db.tbl WHERE "site" = 'x' ORDER BY time`,
+			changed: 1,
+		},
+		{
+			desc:    "CTE and other tables",
+			input:   `WITH a AS (SELECT * FROM db.tbl WHERE time > ago(1h)), b AS (SELECT * FROM db.other WHERE time > ago(1h)) SELECT * FROM a JOIN b ON a.device = b.device`,
+			table:   "db.tbl",
+			want:    `WITH a AS (SELECT * FROM db.tbl WHERE (time > ago(1h)) AND "site" = 'x'), b AS (SELECT * FROM db.other WHERE time > ago(1h)) SELECT * FROM a JOIN b ON a.device = b.device`,
+			changed: 1,
+		},
+		{
+			desc:    "every SELECT of the table",
+			input:   `SELECT * FROM db.tbl WHERE time > ago(1h) UNION SELECT * FROM db.tbl WHERE time > ago(2h)`,
+			table:   "db.tbl",
+			want:    `SELECT * FROM db.tbl WHERE (time > ago(1h)) AND "site" = 'x' UNION SELECT * FROM db.tbl WHERE (time > ago(2h)) AND "site" = 'x'`,
+			changed: 2,
+		},
+		{
+			desc:  "other database",
+			input: `SELECT * FROM other.tbl WHERE time > ago(1h)`,
+			table: "db.tbl",
+			want:  `SELECT * FROM other.tbl WHERE time > ago(1h)`,
+		},
+	}
+
+	for _, tc := range testcases {
+		tc := tc
+		t.Run(tc.desc, func(t *testing.T) {
+			t.Parallel()
+			got, changed, err := InjectPredicate(tc.input, tc.table, `"site" = 'x'`)
+			if err != nil {
+				t.Fatalf("InjectPredicate() error = %v", err)
+			}
+			if got != tc.want || changed != tc.changed {
+				t.Errorf("InjectPredicate() =\n%q, %d\nwant\n%q, %d", got, changed, tc.want, tc.changed)
+			}
+		})
+	}
+}
+
+func TestInjectPredicate_Invalid(t *testing.T) {
+	t.Parallel()
+
+	for _, predicate := range []string{
+		``,
+		`a = 'x') OR (1 = 1`,
+		`a = 'x' GROUP BY a`,
+		`a = 'x'; DROP TABLE b`,
+		`a = 'x' -- comment`,
+		`a IN (SELECT a FROM db.tbl)`,
+	} {
+		if _, _, err := InjectPredicate(`SELECT * FROM db.tbl WHERE time > ago(1h)`, "db.tbl", predicate); err == nil {
+			t.Errorf("InjectPredicate(%q) expected an error", predicate)
+		}
+	}
+}
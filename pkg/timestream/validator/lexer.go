@@ -0,0 +1,185 @@
+package validator
+
+import (
+	"iter"
+	"strings"
+	"unicode"
+)
+
+// keywordsUpper maps upper case keywords to their lower case form, so queries
+// written in upper case don't allocate a lowered copy per keyword
+var keywordsUpper = map[string]string{}
+
+func init() {
+	for word := range keywords {
+		keywordsUpper[strings.ToUpper(word)] = word
+	}
+}
+
+// lex returns the tokens of s, see tokens
+func lex(s string) []token {
+	// about one token per 6 bytes of SQL
+	out := make([]token, 0, len(s)/6+1)
+	for tok := range tokens(s) {
+		out = append(out, tok)
+	}
+	return out
+}
+
+// tokens yields the tokens of s one at a time, so scans that only read forward
+// don't hold the tokens of a large query in memory. Comments are skipped,
+// identifiers and keywords lowered, and depth and caseDepth tracked as the
+// tokens are read.
+func tokens(s string) iter.Seq[token] {
+	return tokensFrom(s, 0, 0, 0)
+}
+
+// tokensFrom yields the tokens of s from the byte offset i on, with the depth
+// and caseDepth of the lexer at that offset, so edits re-lex only the text
+// after the tokens they leave unchanged.
+func tokensFrom(s string, i, depth, caseDepth int) iter.Seq[token] {
+	return func(yield func(token) bool) {
+		// generated queries repeat the same upper case names, lower each once
+		lowered := map[string]string{}
+		lower := func(word string) string {
+			if l, ok := lowered[word]; ok {
+				return l
+			}
+			l := strings.ToLower(word)
+			if l != word {
+				lowered[word] = l
+			}
+			return l
+		}
+		emit := func(tok token) bool {
+			if tok.kind == tkIdent && tok.val == "case" {
+				caseDepth++
+			}
+			tok.caseDepth = caseDepth
+			if tok.kind == tkIdent && tok.val == "end" && caseDepth > 0 {
+				caseDepth--
+			}
+			return yield(tok)
+		}
+
+		readString := func(i int, quote byte) (string, int) {
+			j := i + 1
+			for j < len(s) {
+				if s[j] == quote {
+					// handle escaped '' or "" inside literals/quoted idents
+					if j+1 < len(s) && s[j+1] == quote {
+						j += 2
+						continue
+					}
+					return s[i : j+1], j + 1
+				}
+				j++
+			}
+			return s[i:], len(s)
+		}
+
+		for i < len(s) {
+			r := s[i]
+			// whitespace
+			if unicode.IsSpace(rune(r)) {
+				i++
+				continue
+			}
+			// comments
+			if r == '-' && i+1 < len(s) && s[i+1] == '-' {
+				if nl := strings.IndexByte(s[i:], '\n'); nl != -1 {
+					i += nl + 1
+				} else {
+					i = len(s)
+				}
+				continue
+			}
+			if r == '/' && i+1 < len(s) && s[i+1] == '*' {
+				if end := strings.Index(s[i+2:], "*/"); end != -1 {
+					i += end + 4
+				} else {
+					i = len(s)
+				}
+				continue
+			}
+			var tok token
+			switch {
+			// parentheses adjust depth
+			case r == '(':
+				tok = token{val: "(", kind: tkSymbol, depth: depth, pos: i, end: i + 1}
+				depth++
+			case r == ')':
+				depth--
+				if depth < 0 {
+					depth = 0
+				}
+				tok = token{val: ")", kind: tkSymbol, depth: depth, pos: i, end: i + 1}
+			// strings / quoted identifiers
+			case r == '\'' || r == '"':
+				str, nx := readString(i, r)
+				if r == '"' {
+					// treat "ident" as identifier (lowercased, quotes kept for context)
+					tok = token{val: lower(str), kind: tkIdent, depth: depth, pos: i, end: nx}
+				} else {
+					tok = token{val: str, kind: tkString, depth: depth, pos: i, end: nx}
+				}
+			// numbers
+			case isNumStart(r):
+				j := i + 1
+				for j < len(s) && (isNum(s[j]) || s[j] == '.') {
+					j++
+				}
+				tok = token{val: s[i:j], kind: tkNumber, depth: depth, pos: i, end: j}
+			// identifiers / keywords
+			case isIdentStart(r):
+				j := i + 1
+				for j < len(s) && isIdentPart(s[j]) {
+					j++
+				}
+				word, ok := keywordsUpper[s[i:j]]
+				if !ok {
+					word = lower(s[i:j])
+					_, ok = keywords[word]
+				}
+				if ok {
+					tok = token{val: word, kind: tkKeyword, depth: depth, pos: i, end: j}
+				} else {
+					tok = token{val: word, kind: tkIdent, depth: depth, pos: i, end: j}
+				}
+			// multi-char operators (>=, <=, <>, !=)
+			case (r == '>' || r == '<' || r == '!') && i+1 < len(s) &&
+				((r == '>' && s[i+1] == '=') || (r == '<' && (s[i+1] == '=' || s[i+1] == '>')) || (r == '!' && s[i+1] == '=')):
+				tok = token{val: s[i : i+2], kind: tkSymbol, depth: depth, pos: i, end: i + 2}
+			// single-char symbols
+			default:
+				tok = token{val: s[i : i+1], kind: tkSymbol, depth: depth, pos: i, end: i + 1}
+			}
+			if !emit(tok) {
+				return
+			}
+			i = tok.end
+		}
+	}
+}
+
+// stateAfter returns the offset, depth and caseDepth of the lexer after tok
+func stateAfter(tok token) (int, int, int) {
+	depth, caseDepth := tok.depth, tok.caseDepth
+	if tok.kind == tkSymbol && tok.val == "(" {
+		depth++
+	}
+	if tok.kind == tkIdent && tok.val == "end" && caseDepth > 0 {
+		caseDepth--
+	}
+	return tok.end, depth, caseDepth
+}
+
+// containsKeyword reports whether s has the keyword, without collecting its tokens
+func containsKeyword(s, word string) bool {
+	for tok := range tokens(s) {
+		if tok.kind == tkKeyword && tok.val == word {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,78 @@
+package validator
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestTokens(t *testing.T) {
+	t.Parallel()
+
+	sql := "SELECT CASE WHEN a >= 1 THEN 'x' END -- note\nFROM \"DB\".t /* block */ WHERE Time > ago(1h)"
+	var got []string
+	for tok := range tokens(sql) {
+		got = append(got, tok.val)
+		if sql[tok.pos:tok.end] == "" {
+			t.Errorf("token %q has an empty span", tok.val)
+		}
+	}
+	want := []string{"select", "case", "when", "a", ">=", "1", "then", "'x'", "end", "from", `"db"`, ".", "t", "where", "time", ">", "ago", "(", "1", "h", ")"}
+	if strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Errorf("tokens() =\n%q\nwant\n%q", got, want)
+	}
+
+	toks := lex(sql)
+	if toks[1].caseDepth != 1 || toks[8].caseDepth != 1 || toks[9].caseDepth != 0 {
+		t.Errorf("caseDepth of CASE, END, FROM = %d, %d, %d, want 1, 1, 0", toks[1].caseDepth, toks[8].caseDepth, toks[9].caseDepth)
+	}
+	if toks[17].depth != 0 || toks[18].depth != 1 || toks[20].depth != 0 {
+		t.Errorf("depth of ( 1 ) = %d %d %d, want 0 1 0", toks[17].depth, toks[18].depth, toks[20].depth)
+	}
+
+	n := 0
+	for range tokens(sql) {
+		if n++; n == 3 {
+			break
+		}
+	}
+	if !containsKeyword(sql, "where") || containsKeyword("SHOW TABLES FROM db", "select") {
+		t.Errorf("containsKeyword() mismatch")
+	}
+}
+
+// a generated query of a BI tool, hundreds of KB long
+func largeQuery() string {
+	var b strings.Builder
+	b.WriteString("SELECT time, device")
+	for i := 0; i < 5000; i++ {
+		b.WriteString(", CASE WHEN \"Device\" = 'device-")
+		b.WriteString(strings.Repeat("x", i%10))
+		b.WriteString("' THEN MEASURE_VALUE::DOUBLE ELSE NULL END AS \"C\"")
+	}
+	b.WriteString(" FROM \"db\".\"metrics\" WHERE TIME > AGO(1H) AND MEASURE_NAME = 'cpu'")
+	return b.String()
+}
+
+func BenchmarkValidate_Large(b *testing.B) {
+	sql := largeQuery()
+	c, err := (*Options)(nil).Compile()
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.SetBytes(int64(len(sql)))
+	b.ReportAllocs()
+	for b.Loop() {
+		if valid, issues := c.Validate(sql); !valid {
+			b.Fatal(issues)
+		}
+	}
+}
+
+func BenchmarkDeparameterize_Large(b *testing.B) {
+	sql := largeQuery()
+	b.SetBytes(int64(len(sql)))
+	b.ReportAllocs()
+	for b.Loop() {
+		Deparameterize(sql)
+	}
+}
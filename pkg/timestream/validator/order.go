@@ -0,0 +1,125 @@
+package validator
+
+import (
+	"strings"
+)
+
+// DeterministicOrder appends an ORDER BY to the outermost SELECT of sql when it
+// has none, so the row order is stable across executions. It orders by the
+// GROUP BY expressions, or by the plain columns of the SELECT list when the
+// query isn't grouped, with time columns first. sql is returned unchanged with
+// false when no stable order can be derived, e.g. for UNIONs.
+func DeterministicOrder(sql string) (string, bool) {
+	src := stripComments(sql)
+	toks := lex(src)
+	for len(toks) > 0 && toks[len(toks)-1].val == ";" {
+		toks = toks[:len(toks)-1]
+	}
+	if len(toks) == 0 || toks[0].kind != tkKeyword || (toks[0].val != "select" && toks[0].val != "with") {
+		return sql, false
+	}
+
+	selIdx, limitIdx := -1, -1
+	for i, tok := range toks {
+		if tok.depth != 0 {
+			continue
+		}
+		switch {
+		case tok.kind == tkKeyword && tok.val == "select":
+			selIdx = i
+		case tok.kind == tkKeyword && (tok.val == "order" || tok.val == "union" || tok.val == "intersect" || tok.val == "except"):
+			return sql, false
+		case tok.kind == tkIdent && tok.val == "limit":
+			limitIdx = i
+		}
+	}
+	if selIdx == -1 {
+		return sql, false
+	}
+	end := len(toks)
+	if limitIdx > selIdx {
+		end = limitIdx
+	}
+
+	var keys []string
+	if groupIdx := findNextKeywordBetweenAtDepth(toks, selIdx+1, end, 0, "group"); groupIdx != -1 && groupIdx+1 < end {
+		groupStop := findNextTerminatorAtDepth(toks, groupIdx+2, 0)
+		for _, item := range splitAtComma(toks, groupIdx+2, min(groupStop, end)) {
+			keys = append(keys, src[toks[item[0]].pos:toks[item[1]-1].end])
+		}
+	} else if fromIdx := findNextKeywordAtDepth(toks, selIdx+1, 0, "from"); fromIdx != -1 {
+		for _, item := range splitAtComma(toks, selIdx+1, fromIdx) {
+			if column := plainColumn(toks, item[0], item[1]); column != "" {
+				keys = append(keys, column)
+			}
+		}
+	}
+	if len(keys) == 0 {
+		return sql, false
+	}
+
+	// time first, the series keys after
+	ordered := make([]string, 0, len(keys))
+	for _, key := range keys {
+		if isTimeExpression(key) {
+			ordered = append(ordered, key)
+		}
+	}
+	for _, key := range keys {
+		if !isTimeExpression(key) {
+			ordered = append(ordered, key)
+		}
+	}
+
+	orderBy := " ORDER BY " + strings.Join(ordered, ", ")
+	if end < len(toks) {
+		insertAt := toks[end].pos
+		return strings.TrimRight(src[:insertAt], " \t\n") + orderBy + " " + strings.TrimSpace(src[insertAt:toks[len(toks)-1].end]), true
+	}
+	return strings.TrimSpace(src[:toks[len(toks)-1].end]) + orderBy, true
+}
+
+// splitAtComma splits the range at the commas of its outermost depth.
+func splitAtComma(toks []token, start, stop int) [][2]int {
+	if start >= stop {
+		return nil
+	}
+	var parts [][2]int
+	depth := toks[start].depth
+	partStart := start
+	for i := start; i < stop; i++ {
+		if toks[i].depth == depth && toks[i].kind == tkSymbol && toks[i].val == "," {
+			if i > partStart {
+				parts = append(parts, [2]int{partStart, i})
+			}
+			partStart = i + 1
+		}
+	}
+	if stop > partStart {
+		parts = append(parts, [2]int{partStart, stop})
+	}
+	return parts
+}
+
+// plainColumn returns the output name of a SELECT item that is a column
+// reference ("device", "t.device" or "device AS d"), or "" otherwise.
+func plainColumn(toks []token, start, stop int) string {
+	switch {
+	case stop-start == 1 && toks[start].kind == tkIdent:
+		return toks[start].val
+	case stop-start == 3 && toks[start].kind == tkIdent && toks[start+1].val == "as" && toks[start+2].kind == tkIdent:
+		return toks[start+2].val
+	case stop-start == 2 && toks[start].kind == tkIdent && toks[start+1].kind == tkIdent:
+		return toks[start+1].val
+	}
+	return ""
+}
+
+func isTimeExpression(expr string) bool {
+	for tok := range tokens(expr) {
+		if tok.kind == tkIdent && (tok.val == "time" || tok.val == `"time"` || strings.HasSuffix(tok.val, ".time")) {
+			return true
+		}
+	}
+	return false
+}
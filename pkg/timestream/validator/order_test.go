@@ -0,0 +1,70 @@
+package validator
+
+import "testing"
+
+func TestDeterministicOrder(t *testing.T) {
+	t.Parallel()
+
+	testcases := []struct {
+		desc    string
+		input   string
+		want    string
+		changed bool
+	}{
+		{
+			desc:    "group by, time first",
+			input:   `SELECT device, bin(time, 1m) AS t, avg(measure_value::double) FROM db.tbl WHERE time > ago(1h) GROUP BY device, bin(time, 1m)`,
+			want:    `SELECT device, bin(time, 1m) AS t, avg(measure_value::double) FROM db.tbl WHERE time > ago(1h) GROUP BY device, bin(time, 1m) ORDER BY bin(time, 1m), device`,
+			changed: true,
+		},
+		{
+			desc:    "before a trailing limit",
+			input:   "SELECT device, max(time) FROM db.tbl WHERE time > ago(1h) GROUP BY device\nLIMIT 10;",
+			want:    "SELECT device, max(time) FROM db.tbl WHERE time > ago(1h) GROUP BY device ORDER BY device LIMIT 10",
+			changed: true,
+		},
+		{
+			desc:    "ungrouped columns",
+			input:   `SELECT device, d.region AS r, time, measure_value::double AS v FROM db.tbl d WHERE time > ago(1h)`,
+			want:    `SELECT device, d.region AS r, time, measure_value::double AS v FROM db.tbl d WHERE time > ago(1h) ORDER BY time, device, r`,
+			changed: true,
+		},
+		{
+			desc:    "CTE",
+			input:   `WITH x AS (SELECT * FROM db.tbl WHERE time > ago(1h) ORDER BY device) SELECT time, device FROM x`,
+			want:    `WITH x AS (SELECT * FROM db.tbl WHERE time > ago(1h) ORDER BY device) SELECT time, device FROM x ORDER BY time, device`,
+			changed: true,
+		},
+		{
+			desc:  "already ordered",
+			input: `SELECT time, device FROM db.tbl WHERE time > ago(1h) ORDER BY device`,
+			want:  `SELECT time, device FROM db.tbl WHERE time > ago(1h) ORDER BY device`,
+		},
+		{
+			desc:  "union",
+			input: `SELECT time FROM db.a UNION ALL SELECT time FROM db.b`,
+			want:  `SELECT time FROM db.a UNION ALL SELECT time FROM db.b`,
+		},
+		{
+			desc:  "single aggregate row",
+			input: `SELECT count(*) FROM db.tbl WHERE time > ago(1h)`,
+			want:  `SELECT count(*) FROM db.tbl WHERE time > ago(1h)`,
+		},
+		{
+			desc:  "not a query",
+			input: `SHOW TABLES FROM db`,
+			want:  `SHOW TABLES FROM db`,
+		},
+	}
+
+	for _, tc := range testcases {
+		tc := tc
+		t.Run(tc.desc, func(t *testing.T) {
+			t.Parallel()
+			got, changed := DeterministicOrder(tc.input)
+			if got != tc.want || changed != tc.changed {
+				t.Errorf("DeterministicOrder() =\n%q, %v\nwant\n%q, %v", got, changed, tc.want, tc.changed)
+			}
+		})
+	}
+}
@@ -0,0 +1,995 @@
+package validator
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// The AST mode parses queries with a recursive-descent parser for the
+// Timestream SQL dialect instead of scanning tokens, see Options.Parser. It
+// reads the tokens of the lexer, so both modes agree on literals, identifiers
+// and comments. Queries it can't parse are validated by the heuristics.
+
+// exprKind is the kind of an expression node.
+type exprKind int
+
+const (
+	exprAnd exprKind = iota
+	exprOr
+	exprNot
+	// exprPredicate is a comparison, BETWEEN, IN, LIKE or IS test
+	exprPredicate
+	// exprValue is any other expression: columns, literals, calls, CASE,
+	// arithmetic and subqueries
+	exprValue
+)
+
+// astExpr is an expression with the token range [start, stop) it was parsed
+// from. Boolean operators keep their operands as children; predicates and
+// values keep the subqueries they contain.
+type astExpr struct {
+	kind        exprKind
+	start, stop int
+	children    []*astExpr
+}
+
+// astSource is a FROM source: a table, a subquery or a function like UNNEST.
+type astSource struct {
+	start, stop int
+	// table is the lowercased, unquoted "db.table" of a qualified table name,
+	// empty for other sources
+	table string
+}
+
+// astSelect is a SELECT block with the token indexes of its clauses, -1 for
+// clauses it doesn't have.
+type astSelect struct {
+	selIdx, fromIdx, whereIdx int
+	// fromStop ends the FROM clause including WHERE, whereStop the WHERE
+	// expression
+	fromStop, whereStop int
+	sources             []astSource
+	where               *astExpr
+}
+
+// parser reads the tokens of a query and collects its SELECT blocks.
+type parser struct {
+	toks    []token
+	i       int
+	selects []*astSelect
+}
+
+// parseQueries parses the statement and returns its SELECT blocks, outer and
+// nested, ordered by their position.
+func parseQueries(toks []token) ([]*astSelect, error) {
+	p := &parser{toks: toks}
+	if err := p.query(); err != nil {
+		return nil, err
+	}
+	p.acceptSymbol(";")
+	if p.i < len(p.toks) {
+		return nil, p.errorf("unexpected %q", p.toks[p.i].val)
+	}
+	slices.SortFunc(p.selects, func(a, b *astSelect) int { return a.selIdx - b.selIdx })
+	return p.selects, nil
+}
+
+func (p *parser) errorf(format string, args ...any) error {
+	pos := len(p.toks)
+	if p.i < len(p.toks) {
+		pos = p.i
+	}
+	return fmt.Errorf("token %d: %s", pos, fmt.Sprintf(format, args...))
+}
+
+func (p *parser) peek(offset int) token {
+	if p.i+offset < len(p.toks) {
+		return p.toks[p.i+offset]
+	}
+	return token{}
+}
+
+// isWord reports whether the token at the offset is the keyword or
+// identifier word
+func (p *parser) isWord(offset int, word string) bool {
+	tok := p.peek(offset)
+	return (tok.kind == tkKeyword || tok.kind == tkIdent) && tok.val == word
+}
+
+func (p *parser) isSymbol(offset int, sym string) bool {
+	tok := p.peek(offset)
+	return tok.kind == tkSymbol && tok.val == sym
+}
+
+func (p *parser) acceptWord(word string) bool {
+	if p.i < len(p.toks) && p.isWord(0, word) {
+		p.i++
+		return true
+	}
+	return false
+}
+
+func (p *parser) acceptSymbol(sym string) bool {
+	if p.i < len(p.toks) && p.isSymbol(0, sym) {
+		p.i++
+		return true
+	}
+	return false
+}
+
+func (p *parser) expectWord(word string) error {
+	if !p.acceptWord(word) {
+		return p.errorf("expected %s", strings.ToUpper(word))
+	}
+	return nil
+}
+
+func (p *parser) expectSymbol(sym string) error {
+	if !p.acceptSymbol(sym) {
+		return p.errorf("expected %q", sym)
+	}
+	return nil
+}
+
+// identifier reads a name, quoted or not. Keywords are accepted where only a
+// name can follow, e.g. a CTE named inner.
+func (p *parser) identifier() (string, error) {
+	if p.i < len(p.toks) && (p.toks[p.i].kind == tkIdent || p.toks[p.i].kind == tkKeyword) {
+		p.i++
+		return p.toks[p.i-1].val, nil
+	}
+	return "", p.errorf("expected a name")
+}
+
+// skipParens skips the tokens up to and including the parenthesis closing the
+// one just read
+func (p *parser) skipParens() error {
+	for open := 1; p.i < len(p.toks); p.i++ {
+		switch {
+		case p.isSymbol(0, "("):
+			open++
+		case p.isSymbol(0, ")"):
+			if open--; open == 0 {
+				p.i++
+				return nil
+			}
+		}
+	}
+	return p.errorf("unbalanced parentheses")
+}
+
+// query reads [WITH ...] a set of SELECTs [ORDER BY ...] [LIMIT ...] [OFFSET ...]
+func (p *parser) query() error {
+	if p.acceptWord("with") {
+		p.acceptWord("recursive")
+		for {
+			if _, err := p.identifier(); err != nil {
+				return err
+			}
+			if p.acceptSymbol("(") {
+				if err := p.skipParens(); err != nil {
+					return err
+				}
+			}
+			if err := p.expectWord("as"); err != nil {
+				return err
+			}
+			if err := p.expectSymbol("("); err != nil {
+				return err
+			}
+			if err := p.query(); err != nil {
+				return err
+			}
+			if err := p.expectSymbol(")"); err != nil {
+				return err
+			}
+			if !p.acceptSymbol(",") {
+				break
+			}
+		}
+	}
+
+	if err := p.queryTerm(); err != nil {
+		return err
+	}
+	for p.isWord(0, "union") || p.isWord(0, "intersect") || p.isWord(0, "except") {
+		p.i++
+		if !p.acceptWord("all") {
+			p.acceptWord("distinct")
+		}
+		if err := p.queryTerm(); err != nil {
+			return err
+		}
+	}
+
+	if p.isWord(0, "order") && p.isWord(1, "by") {
+		p.i += 2
+		if err := p.orderItems(); err != nil {
+			return err
+		}
+	}
+	if p.acceptWord("offset") {
+		if _, err := p.expr(); err != nil {
+			return err
+		}
+		if !p.acceptWord("rows") {
+			p.acceptWord("row")
+		}
+	}
+	if p.acceptWord("limit") {
+		if !p.acceptWord("all") {
+			if _, err := p.expr(); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// queryTerm reads a SELECT or a parenthesized query
+func (p *parser) queryTerm() error {
+	if p.acceptSymbol("(") {
+		if err := p.query(); err != nil {
+			return err
+		}
+		return p.expectSymbol(")")
+	}
+	if !p.isWord(0, "select") {
+		return p.errorf("expected SELECT")
+	}
+	return p.selectBlock()
+}
+
+func (p *parser) orderItems() error {
+	for {
+		if _, err := p.expr(); err != nil {
+			return err
+		}
+		if !p.acceptWord("asc") {
+			p.acceptWord("desc")
+		}
+		if p.acceptWord("nulls") && !p.acceptWord("first") && !p.acceptWord("last") {
+			return p.errorf("expected FIRST or LAST")
+		}
+		if !p.acceptSymbol(",") {
+			return nil
+		}
+	}
+}
+
+// selectBlock reads SELECT ... [FROM ...] [WHERE ...] [GROUP BY ...] [HAVING ...]
+func (p *parser) selectBlock() error {
+	s := &astSelect{selIdx: p.i, fromIdx: -1, whereIdx: -1}
+	p.selects = append(p.selects, s)
+	p.i++
+	if !p.acceptWord("distinct") {
+		p.acceptWord("all")
+	}
+	for {
+		if err := p.selectItem(); err != nil {
+			return err
+		}
+		if !p.acceptSymbol(",") {
+			break
+		}
+	}
+
+	if p.isWord(0, "from") {
+		s.fromIdx = p.i
+		p.i++
+		if err := p.sources(s); err != nil {
+			return err
+		}
+	}
+	if p.isWord(0, "where") {
+		s.whereIdx = p.i
+		p.i++
+		where, err := p.expr()
+		if err != nil {
+			return err
+		}
+		s.where = where
+	}
+	s.fromStop, s.whereStop = p.i, p.i
+
+	if p.isWord(0, "group") && p.isWord(1, "by") {
+		p.i += 2
+		if !p.acceptWord("all") {
+			p.acceptWord("distinct")
+		}
+		for {
+			if err := p.groupingElement(); err != nil {
+				return err
+			}
+			if !p.acceptSymbol(",") {
+				break
+			}
+		}
+	}
+	if p.acceptWord("having") {
+		if _, err := p.expr(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// groupingElement reads an expression or ROLLUP, CUBE or GROUPING SETS
+func (p *parser) groupingElement() error {
+	if (p.isWord(0, "rollup") || p.isWord(0, "cube")) && p.isSymbol(1, "(") ||
+		p.isWord(0, "grouping") && p.isWord(1, "sets") {
+		for p.i < len(p.toks) && !p.isSymbol(0, "(") {
+			p.i++
+		}
+		if err := p.expectSymbol("("); err != nil {
+			return err
+		}
+		return p.skipParens()
+	}
+	_, err := p.expr()
+	return err
+}
+
+// selectItem reads *, t.* or an expression with an optional alias
+func (p *parser) selectItem() error {
+	if p.acceptSymbol("*") {
+		return nil
+	}
+	// t.* lexes as the identifier "t." and *
+	if tok := p.peek(0); tok.kind == tkIdent && strings.HasSuffix(tok.val, ".") && p.isSymbol(1, "*") {
+		p.i += 2
+		return nil
+	}
+	if _, err := p.expr(); err != nil {
+		return err
+	}
+	return p.alias()
+}
+
+// alias reads an optional [AS] name
+func (p *parser) alias() error {
+	if p.acceptWord("as") {
+		_, err := p.identifier()
+		return err
+	}
+	if tok := p.peek(0); p.i < len(p.toks) && tok.kind == tkIdent && !clauseWords[tok.val] {
+		p.i++
+	}
+	return nil
+}
+
+// clauseWords are the identifiers that continue a query after an expression,
+// they aren't aliases
+var clauseWords = map[string]bool{
+	"limit": true, "offset": true, "window": true, "asc": true, "desc": true, "nulls": true,
+	"fetch": true, "tablesample": true, "for": true,
+}
+
+// sources reads the FROM sources with their joins
+func (p *parser) sources(s *astSelect) error {
+	for {
+		if err := p.source(s); err != nil {
+			return err
+		}
+		for p.join() {
+			if err := p.source(s); err != nil {
+				return err
+			}
+			if p.acceptWord("on") {
+				if _, err := p.expr(); err != nil {
+					return err
+				}
+			} else if p.acceptWord("using") {
+				if err := p.expectSymbol("("); err != nil {
+					return err
+				}
+				if err := p.skipParens(); err != nil {
+					return err
+				}
+			}
+		}
+		if !p.acceptSymbol(",") {
+			return nil
+		}
+	}
+}
+
+// join reads the join type and JOIN, it reports false when no join follows
+func (p *parser) join() bool {
+	start := p.i
+	switch {
+	case p.acceptWord("natural"):
+		return p.join() || p.reset(start)
+	case p.acceptWord("inner"), p.acceptWord("cross"):
+	case p.acceptWord("left"), p.acceptWord("right"), p.acceptWord("full"):
+		p.acceptWord("outer")
+	}
+	if p.acceptWord("join") {
+		return true
+	}
+	return p.reset(start)
+}
+
+// reset moves back to the token and reports false
+func (p *parser) reset(i int) bool {
+	p.i = i
+	return false
+}
+
+// source reads a table, a subquery, UNNEST(...) or LATERAL (...) with an
+// optional alias and column names
+func (p *parser) source(s *astSelect) error {
+	src := astSource{start: p.i}
+	switch {
+	case p.isSymbol(0, "("):
+		p.i++
+		if p.isWord(0, "select") || p.isWord(0, "with") || p.isSymbol(0, "(") {
+			if err := p.query(); err != nil {
+				return err
+			}
+		} else if err := p.sources(s); err != nil {
+			return err
+		}
+		if err := p.expectSymbol(")"); err != nil {
+			return err
+		}
+	case (p.isWord(0, "unnest") || p.isWord(0, "lateral")) && p.isSymbol(1, "("):
+		lateral := p.isWord(0, "lateral")
+		p.i += 2
+		if lateral {
+			if err := p.query(); err != nil {
+				return err
+			}
+		} else if _, err := p.exprList(); err != nil {
+			return err
+		}
+		if err := p.expectSymbol(")"); err != nil {
+			return err
+		}
+		if p.isWord(0, "with") && p.isWord(1, "ordinality") {
+			p.i += 2
+		}
+	default:
+		name, err := p.tableName()
+		if err != nil {
+			return err
+		}
+		if strings.Contains(name, ".") {
+			src.table = name
+		}
+	}
+	src.stop = p.i
+	s.sources = append(s.sources, src)
+
+	if p.isWord(0, "as") || p.peek(0).kind == tkIdent && !clauseWords[p.peek(0).val] && p.i < len(p.toks) {
+		if err := p.alias(); err != nil {
+			return err
+		}
+		if p.acceptSymbol("(") {
+			return p.skipParens()
+		}
+	}
+	return nil
+}
+
+// tableName reads db.table, "db"."table" or a single name like a CTE
+func (p *parser) tableName() (string, error) {
+	name, err := p.identifier()
+	if err != nil {
+		return "", err
+	}
+	parts := []string{strings.ReplaceAll(name, `"`, "")}
+	for strings.HasSuffix(name, ".") || p.isSymbol(0, ".") {
+		p.acceptSymbol(".")
+		if name, err = p.identifier(); err != nil {
+			return "", err
+		}
+		parts = append(parts, strings.ReplaceAll(name, `"`, ""))
+	}
+	return strings.ReplaceAll(strings.Join(parts, "."), "..", "."), nil
+}
+
+// exprList reads comma separated expressions
+func (p *parser) exprList() ([]*astExpr, error) {
+	var list []*astExpr
+	for {
+		e, err := p.expr()
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, e)
+		if !p.acceptSymbol(",") {
+			return list, nil
+		}
+	}
+}
+
+// expr reads an expression: OR binds weaker than AND, AND weaker than NOT
+func (p *parser) expr() (*astExpr, error) {
+	return p.boolean(exprOr)
+}
+
+func (p *parser) boolean(kind exprKind) (*astExpr, error) {
+	word, operand := "or", func() (*astExpr, error) { return p.boolean(exprAnd) }
+	if kind == exprAnd {
+		word, operand = "and", p.not
+	}
+	start := p.i
+	first, err := operand()
+	if err != nil {
+		return nil, err
+	}
+	children := []*astExpr{first}
+	for p.acceptWord(word) {
+		next, err := operand()
+		if err != nil {
+			return nil, err
+		}
+		children = append(children, next)
+	}
+	if len(children) == 1 {
+		return first, nil
+	}
+	return &astExpr{kind: kind, start: start, stop: p.i, children: children}, nil
+}
+
+func (p *parser) not() (*astExpr, error) {
+	start := p.i
+	if p.acceptWord("not") {
+		operand, err := p.not()
+		if err != nil {
+			return nil, err
+		}
+		return &astExpr{kind: exprNot, start: start, stop: p.i, children: []*astExpr{operand}}, nil
+	}
+	return p.predicate()
+}
+
+var compareOps = map[string]bool{"=": true, "<>": true, "!=": true, "<": true, "<=": true, ">": true, ">=": true}
+
+// predicate reads a value with an optional comparison, BETWEEN, IN, LIKE or
+// IS test
+func (p *parser) predicate() (*astExpr, error) {
+	start := p.i
+	left, err := p.value()
+	if err != nil {
+		return nil, err
+	}
+	e := &astExpr{kind: exprPredicate, start: start, children: []*astExpr{left}}
+	operands := func(list ...*astExpr) *astExpr {
+		e.children = append(e.children, list...)
+		e.stop = p.i
+		return e
+	}
+
+	negated := p.isWord(0, "not") && (p.isWord(1, "between") || p.isWord(1, "in") || p.isWord(1, "like"))
+	if negated {
+		p.i++
+	}
+	switch {
+	case p.peek(0).kind == tkSymbol && compareOps[p.peek(0).val] && p.i < len(p.toks):
+		p.i++
+		// x = ANY (SELECT ...)
+		if (p.isWord(0, "any") || p.isWord(0, "some") || p.isWord(0, "all")) && p.isSymbol(1, "(") {
+			p.i++
+		}
+		right, err := p.value()
+		if err != nil {
+			return nil, err
+		}
+		return operands(right), nil
+	case p.acceptWord("between"):
+		low, err := p.value()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expectWord("and"); err != nil {
+			return nil, err
+		}
+		high, err := p.value()
+		if err != nil {
+			return nil, err
+		}
+		return operands(low, high), nil
+	case p.acceptWord("in"):
+		if err := p.expectSymbol("("); err != nil {
+			return nil, err
+		}
+		var list []*astExpr
+		if p.isWord(0, "select") || p.isWord(0, "with") {
+			qStart := p.i
+			if err := p.query(); err != nil {
+				return nil, err
+			}
+			list = []*astExpr{{kind: exprValue, start: qStart, stop: p.i}}
+		} else if list, err = p.exprList(); err != nil {
+			return nil, err
+		}
+		if err := p.expectSymbol(")"); err != nil {
+			return nil, err
+		}
+		return operands(list...), nil
+	case p.acceptWord("like"):
+		pattern, err := p.value()
+		if err != nil {
+			return nil, err
+		}
+		if p.acceptWord("escape") {
+			if _, err := p.value(); err != nil {
+				return nil, err
+			}
+		}
+		return operands(pattern), nil
+	case negated:
+		return nil, p.errorf("expected BETWEEN, IN or LIKE")
+	case p.acceptWord("is"):
+		p.acceptWord("not")
+		switch {
+		case p.acceptWord("null"), p.acceptWord("true"), p.acceptWord("false"), p.acceptWord("unknown"):
+			return operands(), nil
+		case p.acceptWord("distinct"):
+			if err := p.expectWord("from"); err != nil {
+				return nil, err
+			}
+			right, err := p.value()
+			if err != nil {
+				return nil, err
+			}
+			return operands(right), nil
+		}
+		return nil, p.errorf("expected NULL, TRUE, FALSE or DISTINCT FROM")
+	}
+	return left, nil
+}
+
+// value reads arithmetic and concatenation of operands
+func (p *parser) value() (*astExpr, error) {
+	start := p.i
+	e, err := p.unary()
+	if err != nil {
+		return nil, err
+	}
+	children := []*astExpr{e}
+	for p.i < len(p.toks) {
+		tok := p.peek(0)
+		switch {
+		case tok.kind == tkSymbol && tok.val == "|" && p.isSymbol(1, "|"):
+			p.i += 2
+		case tok.kind == tkSymbol && strings.Contains("+-*/%", tok.val) && !p.isLambdaArrow():
+			p.i++
+		default:
+			if len(children) == 1 {
+				return e, nil
+			}
+			return &astExpr{kind: exprValue, start: start, stop: p.i, children: children}, nil
+		}
+		next, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		children = append(children, next)
+	}
+	if len(children) == 1 {
+		return e, nil
+	}
+	return &astExpr{kind: exprValue, start: start, stop: p.i, children: children}, nil
+}
+
+// isLambdaArrow reports whether -> follows, as in transform(a, x -> x + 1)
+func (p *parser) isLambdaArrow() bool {
+	return p.isSymbol(0, "-") && p.isSymbol(1, ">") && p.peek(0).end == p.peek(1).pos
+}
+
+func (p *parser) unary() (*astExpr, error) {
+	start := p.i
+	if p.acceptSymbol("-") || p.acceptSymbol("+") {
+		operand, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return &astExpr{kind: exprValue, start: start, stop: p.i, children: []*astExpr{operand}}, nil
+	}
+	e, err := p.primary()
+	if err != nil {
+		return nil, err
+	}
+	// postfix casts x::double, subscripts a[1] and field access r.field
+	for {
+		switch {
+		case p.isSymbol(0, ":") && p.isSymbol(1, ":"):
+			p.i += 2
+			if err := p.typeName(); err != nil {
+				return nil, err
+			}
+		case p.acceptSymbol("["):
+			if _, err := p.expr(); err != nil {
+				return nil, err
+			}
+			if err := p.expectSymbol("]"); err != nil {
+				return nil, err
+			}
+		case p.isSymbol(0, ".") && p.peek(1).kind == tkIdent:
+			p.i += 2
+		default:
+			e.start, e.stop = start, p.i
+			return e, nil
+		}
+	}
+}
+
+// typeName reads a type like double, varchar(10), array(bigint) or
+// interval day to second
+func (p *parser) typeName() error {
+	if _, err := p.identifier(); err != nil {
+		return err
+	}
+	if p.acceptSymbol("(") {
+		return p.skipParens()
+	}
+	if p.acceptWord("to") {
+		_, err := p.identifier()
+		return err
+	}
+	return nil
+}
+
+// literalTypes prefix typed literals like TIMESTAMP '2024-01-01 00:00:00'
+var literalTypes = map[string]bool{"timestamp": true, "date": true, "time": true, "interval": true, "decimal": true, "varchar": true}
+
+// primary reads a literal, column, parameter, function call, CASE, CAST,
+// EXISTS, ARRAY, lambda or parenthesized expression or subquery
+func (p *parser) primary() (*astExpr, error) {
+	start := p.i
+	value := func(children ...*astExpr) *astExpr {
+		return &astExpr{kind: exprValue, start: start, stop: p.i, children: children}
+	}
+	if p.i >= len(p.toks) {
+		return nil, p.errorf("unexpected end of query")
+	}
+	tok := p.toks[p.i]
+	switch {
+	case tok.kind == tkString:
+		p.i++
+		return value(), nil
+	case tok.kind == tkNumber:
+		p.i++
+		// interval literals like 1h or 15m
+		if next := p.peek(0); next.kind == tkIdent && next.pos == tok.end {
+			p.i++
+		}
+		return value(), nil
+	case p.acceptSymbol("?"):
+		return value(), nil
+	case p.isSymbol(0, "("):
+		p.i++
+		if p.isWord(0, "select") || p.isWord(0, "with") {
+			if err := p.query(); err != nil {
+				return nil, err
+			}
+			if err := p.expectSymbol(")"); err != nil {
+				return nil, err
+			}
+			return value(), nil
+		}
+		list, err := p.exprList()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expectSymbol(")"); err != nil {
+			return nil, err
+		}
+		// (x, y) -> x + y
+		if p.isLambdaArrow() {
+			p.i += 2
+			body, err := p.expr()
+			if err != nil {
+				return nil, err
+			}
+			return value(body), nil
+		}
+		if len(list) == 1 {
+			// keep the parentheses in the range of the expression
+			inner := *list[0]
+			inner.start, inner.stop = start, p.i
+			return &inner, nil
+		}
+		return value(list...), nil
+	case p.isWord(0, "exists") && p.isSymbol(1, "("):
+		p.i += 2
+		if err := p.query(); err != nil {
+			return nil, err
+		}
+		if err := p.expectSymbol(")"); err != nil {
+			return nil, err
+		}
+		return &astExpr{kind: exprPredicate, start: start, stop: p.i}, nil
+	case p.isWord(0, "case"):
+		return p.caseExpr()
+	case (p.isWord(0, "cast") || p.isWord(0, "try_cast")) && p.isSymbol(1, "("):
+		p.i += 2
+		operand, err := p.expr()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expectWord("as"); err != nil {
+			return nil, err
+		}
+		if err := p.typeName(); err != nil {
+			return nil, err
+		}
+		if err := p.expectSymbol(")"); err != nil {
+			return nil, err
+		}
+		return value(operand), nil
+	case p.isWord(0, "array") && p.isSymbol(1, "["):
+		p.i += 2
+		var list []*astExpr
+		if !p.isSymbol(0, "]") {
+			var err error
+			if list, err = p.exprList(); err != nil {
+				return nil, err
+			}
+		}
+		if err := p.expectSymbol("]"); err != nil {
+			return nil, err
+		}
+		return value(list...), nil
+	case tok.kind == tkIdent && literalTypes[tok.val] && p.peek(1).kind == tkString:
+		p.i += 2
+		// INTERVAL '1' DAY [TO SECOND]
+		if tok.val == "interval" && p.peek(0).kind == tkIdent && !clauseWords[p.peek(0).val] {
+			p.i++
+			if p.acceptWord("to") {
+				if _, err := p.identifier(); err != nil {
+					return nil, err
+				}
+			}
+		}
+		return value(), nil
+	case (tok.kind == tkIdent || tok.kind == tkKeyword && (tok.val == "left" || tok.val == "right")) && p.isSymbol(1, "("):
+		return p.call()
+	case tok.kind == tkIdent:
+		p.i++
+		// x -> x + 1
+		if p.isLambdaArrow() {
+			p.i += 2
+			body, err := p.expr()
+			if err != nil {
+				return nil, err
+			}
+			return value(body), nil
+		}
+		return value(), nil
+	}
+	return nil, p.errorf("unexpected %q", tok.val)
+}
+
+// call reads a function call with optional FILTER and OVER clauses
+func (p *parser) call() (*astExpr, error) {
+	start := p.i
+	p.i += 2
+	var args []*astExpr
+	switch {
+	case p.acceptSymbol("*"):
+	case p.isSymbol(0, ")"):
+	default:
+		if !p.acceptWord("distinct") {
+			p.acceptWord("all")
+		}
+		var err error
+		if args, err = p.exprList(); err != nil {
+			return nil, err
+		}
+		if p.isWord(0, "order") && p.isWord(1, "by") {
+			p.i += 2
+			if err := p.orderItems(); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if err := p.expectSymbol(")"); err != nil {
+		return nil, err
+	}
+	if p.isWord(0, "filter") && p.isSymbol(1, "(") {
+		p.i += 2
+		if err := p.expectWord("where"); err != nil {
+			return nil, err
+		}
+		if _, err := p.expr(); err != nil {
+			return nil, err
+		}
+		if err := p.expectSymbol(")"); err != nil {
+			return nil, err
+		}
+	}
+	if p.acceptWord("over") {
+		if err := p.window(); err != nil {
+			return nil, err
+		}
+	}
+	return &astExpr{kind: exprValue, start: start, stop: p.i, children: args}, nil
+}
+
+// window reads the window of OVER: a name or ([PARTITION BY ...] [ORDER BY ...] [frame])
+func (p *parser) window() error {
+	if !p.acceptSymbol("(") {
+		_, err := p.identifier()
+		return err
+	}
+	if p.isWord(0, "partition") && p.isWord(1, "by") {
+		p.i += 2
+		if _, err := p.exprList(); err != nil {
+			return err
+		}
+	}
+	if p.isWord(0, "order") && p.isWord(1, "by") {
+		p.i += 2
+		if err := p.orderItems(); err != nil {
+			return err
+		}
+	}
+	// the frame, like ROWS BETWEEN 1 PRECEDING AND CURRENT ROW, filters no rows
+	return p.skipParens()
+}
+
+// caseExpr reads CASE [operand] WHEN ... THEN ... [ELSE ...] END
+func (p *parser) caseExpr() (*astExpr, error) {
+	start := p.i
+	p.i++
+	var children []*astExpr
+	if !p.isWord(0, "when") {
+		operand, err := p.expr()
+		if err != nil {
+			return nil, err
+		}
+		children = append(children, operand)
+	}
+	for p.acceptWord("when") {
+		cond, err := p.expr()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expectWord("then"); err != nil {
+			return nil, err
+		}
+		result, err := p.expr()
+		if err != nil {
+			return nil, err
+		}
+		children = append(children, cond, result)
+	}
+	if p.acceptWord("else") {
+		result, err := p.expr()
+		if err != nil {
+			return nil, err
+		}
+		children = append(children, result)
+	}
+	if err := p.expectWord("end"); err != nil {
+		return nil, err
+	}
+	return &astExpr{kind: exprValue, start: start, stop: p.i, children: children}, nil
+}
+
+// boolTree converts the boolean operators of the expression to the tree the
+// checks of the WHERE branches read. Like parseBoolExpr, redundant parentheses
+// are not part of the ranges.
+func (e *astExpr) boolTree(toks []token) *boolNode {
+	start, stop := trimParens(toks, e.start, e.stop)
+	n := &boolNode{op: boolLeaf, start: start, stop: stop}
+	switch e.kind {
+	case exprAnd:
+		n.op = boolAnd
+	case exprOr:
+		n.op = boolOr
+	case exprNot:
+		n.op = boolNot
+	default:
+		return n
+	}
+	for _, child := range e.children {
+		n.children = append(n.children, child.boolTree(toks))
+	}
+	return n
+}
@@ -0,0 +1,104 @@
+package validator
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseQueries(t *testing.T) {
+	t.Parallel()
+
+	testcases := []struct {
+		desc   string
+		input  string
+		tables [][]string
+		where  []string
+	}{
+		{
+			desc:   "single select",
+			input:  `SELECT * FROM db.tbl WHERE time > ago(1h) AND measure_name = 'cpu' ORDER BY time LIMIT 10`,
+			tables: [][]string{{"db.tbl"}},
+			where:  []string{"AND(time > ago ( 1 h ), measure_name = 'cpu')"},
+		},
+		{
+			desc:   "quoted names and alias",
+			input:  `SELECT t.* FROM "db"."tbl" AS t WHERE (time > ago(1h))`,
+			tables: [][]string{{"db.tbl"}},
+			where:  []string{"time > ago ( 1 h )"},
+		},
+		{
+			desc:   "join after a CTE",
+			input:  `WITH a AS (SELECT 1 AS x) SELECT * FROM a JOIN db.tbl t ON a.x = t.x WHERE time > ago(1h)`,
+			tables: [][]string{nil, {"db.tbl"}},
+			where:  []string{"", "time > ago ( 1 h )"},
+		},
+		{
+			desc:   "subqueries in FROM and WHERE",
+			input:  `SELECT * FROM (SELECT * FROM db.a) s WHERE x IN (SELECT y FROM db.b WHERE time > ago(1h)) OR NOT EXISTS (SELECT 1)`,
+			tables: [][]string{nil, {"db.a"}, {"db.b"}, nil},
+			where:  []string{"OR(x in ( select y from db.b where time > ago ( 1 h ) ), NOT(exists ( select 1 )))", "", "time > ago ( 1 h )", ""},
+		},
+		{
+			desc:   "expressions",
+			input:  `SELECT CASE WHEN a OR b THEN 1 END, CAST(x AS double), transform(arr, v -> v * 2), count(*) OVER (PARTITION BY d ORDER BY time ROWS BETWEEN 1 PRECEDING AND CURRENT ROW) FROM db.tbl CROSS JOIN UNNEST(arr) AS u(v) WHERE time BETWEEN ago(1d) AND now() AND v::double >= 1`,
+			tables: [][]string{{"db.tbl"}},
+			where:  []string{"AND(time between ago ( 1 d ) and now ( ), v : : double >= 1)"},
+		},
+		{
+			desc:   "union with grouping",
+			input:  `(SELECT a FROM db.x WHERE time > ago(1h) GROUP BY a HAVING count(*) > 1) UNION ALL SELECT a FROM db.y, db.z WHERE time > ago(1h)`,
+			tables: [][]string{{"db.x"}, {"db.y", "db.z"}},
+			where:  []string{"time > ago ( 1 h )", "time > ago ( 1 h )"},
+		},
+	}
+
+	for _, tc := range testcases {
+		tc := tc
+		t.Run(tc.desc, func(t *testing.T) {
+			t.Parallel()
+			toks := lex(tc.input)
+			selects, err := parseQueries(toks)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			var tables [][]string
+			var where []string
+			for _, s := range selects {
+				var names []string
+				for _, src := range s.sources {
+					if src.table != "" {
+						names = append(names, src.table)
+					}
+				}
+				tables = append(tables, names)
+				if s.where == nil {
+					where = append(where, "")
+					continue
+				}
+				where = append(where, formatBoolExpr(toks, s.where.boolTree(toks)))
+			}
+			if !reflect.DeepEqual(tables, tc.tables) {
+				t.Errorf("want tables %q, got %q", tc.tables, tables)
+			}
+			if !reflect.DeepEqual(where, tc.where) {
+				t.Errorf("want where %q, got %q", tc.where, where)
+			}
+		})
+	}
+}
+
+func TestParseQueries_Errors(t *testing.T) {
+	t.Parallel()
+
+	for _, input := range []string{
+		`SELECT * FROM db.tbl WHERE AND time > ago(1h)`,
+		`SELECT * FROM db.tbl WHERE (time > ago(1h)`,
+		`SELECT a FROM db.tbl GROUP BY GROUPING SETS`,
+		`SELECT CASE WHEN a THEN 1 FROM db.tbl`,
+		`SELECT * FROM db.tbl WHERE time > ago(1h) garbage here`,
+	} {
+		if _, err := parseQueries(lex(input)); err == nil {
+			t.Errorf("want an error for %s", input)
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package validator
+
+import (
+	"regexp"
+	"regexp/syntax"
+	"strings"
+)
+
+// measurePatternIssue returns why a regexp_like(measure_name, '...') pattern of the
+// range doesn't narrow down the measures with the code of the issue, or "" when
+// every pattern does. A pattern
+// needs to compile, to be anchored with ^ or start with a literal, to require a
+// literal in every match and must not match the empty string, which regexp_like
+// finds in every measure name.
+// Patterns are compiled as RE2, Java only syntax like lookarounds is rejected.
+// With like, measure_name LIKE '...' patterns need a literal prefix as well.
+func measurePatternIssue(toks []token, start, stop int, like bool) (string, IssueCode) {
+	for i := start; like && i+2 < stop && i+2 < len(toks); i++ {
+		if toks[i].kind != tkIdent || toks[i].val != "measure_name" || toks[i].caseDepth > 0 ||
+			toks[i+1].kind != tkIdent || toks[i+1].val != "like" || toks[i+2].kind != tkString {
+			continue
+		}
+		if reason := checkMeasureLike(unquoteString(toks[i+2].val)); reason != "" {
+			return reason, CodeBroadMeasurePattern
+		}
+	}
+	for i := start; i+5 < stop && i+5 < len(toks); i++ {
+		if toks[i].kind != tkIdent || toks[i].val != "regexp_like" || toks[i].caseDepth > 0 ||
+			toks[i+1].val != "(" || toks[i+2].val != "measure_name" || toks[i+3].val != "," ||
+			toks[i+4].kind != tkString || toks[i+5].val != ")" {
+			continue
+		}
+		if reason, code := checkMeasurePattern(unquoteString(toks[i+4].val)); reason != "" {
+			return reason, code
+		}
+	}
+	return "", ""
+}
+
+func checkMeasurePattern(pattern string) (string, IssueCode) {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return "measure_name pattern '" + pattern + "' doesn't compile", CodeInvalidMeasurePattern
+	}
+	if re.MatchString("") {
+		return "measure_name pattern '" + pattern + "' matches every measure", CodeBroadMeasurePattern
+	}
+	if prefix, _ := re.LiteralPrefix(); prefix == "" && !strings.HasPrefix(pattern, "^") {
+		return "measure_name pattern '" + pattern + "' needs a ^ anchor or a literal prefix", CodeBroadMeasurePattern
+	}
+	if parsed, err := syntax.Parse(pattern, syntax.Perl); err == nil && !requiresLiteral(parsed.Simplify()) {
+		return "measure_name pattern '" + pattern + "' matches every measure, it needs a literal", CodeBroadMeasurePattern
+	}
+	return "", ""
+}
+
+// requiresLiteral reports whether every match of re contains a literal, e.g. not
+// for ^.+ or ^[a-z]\w*
+func requiresLiteral(re *syntax.Regexp) bool {
+	switch re.Op {
+	case syntax.OpLiteral:
+		return true
+	case syntax.OpCapture:
+		return requiresLiteral(re.Sub[0])
+	case syntax.OpPlus:
+		return requiresLiteral(re.Sub[0])
+	case syntax.OpRepeat:
+		return re.Min > 0 && requiresLiteral(re.Sub[0])
+	case syntax.OpConcat:
+		for _, sub := range re.Sub {
+			if requiresLiteral(sub) {
+				return true
+			}
+		}
+		return false
+	case syntax.OpAlternate:
+		for _, sub := range re.Sub {
+			if !requiresLiteral(sub) {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+func checkMeasureLike(pattern string) string {
+	if strings.Trim(pattern, "%") == "" {
+		return "measure_name pattern '" + pattern + "' matches every measure"
+	}
+	if strings.HasPrefix(pattern, "%") || strings.HasPrefix(pattern, "_") {
+		return "measure_name pattern '" + pattern + "' needs a literal prefix"
+	}
+	return ""
+}
+
+// unquoteString returns the value of a '...' literal
+func unquoteString(lit string) string {
+	lit = strings.TrimPrefix(lit, "'")
+	lit = strings.TrimSuffix(lit, "'")
+	return strings.ReplaceAll(lit, "''", "'")
+}
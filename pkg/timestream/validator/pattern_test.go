@@ -0,0 +1,152 @@
+package validator
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidate_MeasurePattern(t *testing.T) {
+	t.Parallel()
+
+	testcases := []struct {
+		desc    string
+		pattern string
+		opts    *Options
+		want    string
+	}{
+		{desc: "anchored", pattern: `^cpu_(user|system)$`},
+		{desc: "literal prefix", pattern: `cpu_.*`},
+		{desc: "anchored alternation", pattern: `^(cpu|mem)`},
+		{desc: "escaped quote", pattern: `^it''s`},
+		{desc: "match all", pattern: `.*`, want: "matches every measure"},
+		{desc: "anchored match all", pattern: `^.*`, want: "matches every measure"},
+		{desc: "empty alternative", pattern: `^cpu|`, want: "matches every measure"},
+		{desc: "unanchored", pattern: `.*cpu`, want: "needs a ^ anchor or a literal prefix"},
+		{desc: "anchored any name", pattern: `^.+`, want: "matches every measure"},
+		{desc: "anchored class", pattern: `^[a-z]\w*$`, want: "matches every measure"},
+		{desc: "alternative without literal", pattern: `^(cpu|.+)`, want: "matches every measure"},
+		{desc: "anchored literal suffix", pattern: `^.+_cpu$`},
+		{desc: "case insensitive", pattern: `^(?i)cpu`},
+		{desc: "invalid", pattern: `^cpu(`, want: "doesn't compile"},
+		{desc: "lookahead", pattern: `^(?!cpu)`, want: "doesn't compile"},
+		{desc: "allowed", pattern: `.*`, opts: &Options{AllowAnyMeasurePattern: true}},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.desc, func(t *testing.T) {
+			t.Parallel()
+			sql := `SELECT * FROM db.tbl WHERE time > ago(1h) AND regexp_like(measure_name, '` + tc.pattern + `')`
+			valid, issues := Validate(sql, tc.opts)
+			if tc.want == "" {
+				if !valid {
+					t.Errorf("Validate(%q) = %v, want valid", sql, issues)
+				}
+				return
+			}
+			if valid || len(issues) != 1 || issues[0].Rule != RuleMeasurePattern || !strings.Contains(issues[0].Reason, tc.want) {
+				t.Errorf("Validate(%q) = %v, %v, want a %s issue containing %q", sql, valid, issues, RuleMeasurePattern, tc.want)
+			}
+		})
+	}
+}
+
+func TestValidate_MeasurePatternInOrBranch(t *testing.T) {
+	t.Parallel()
+
+	sql := `SELECT * FROM db.tbl WHERE time > ago(1h) AND (regexp_like(measure_name, '^cpu') OR regexp_like(measure_name, '.*'))`
+	if valid, issues := Validate(sql, nil); valid || issues[0].Rule != RuleMeasurePattern {
+		t.Errorf("Validate(%q) = %v, %v, want a %s issue", sql, valid, issues, RuleMeasurePattern)
+	}
+}
+
+func TestValidate_MeasureLike(t *testing.T) {
+	t.Parallel()
+
+	like := &Options{AllowMeasureLike: true}
+	testcases := []struct {
+		desc  string
+		input string
+		opts  *Options
+		rule  Rule
+		want  string
+	}{
+		{
+			desc:  "not allowed by default",
+			input: `SELECT * FROM db.tbl WHERE time > ago(1h) AND measure_name LIKE 'gridx.ds.system.%'`,
+			rule:  RuleMeasure,
+			want:  "WHERE clause lacks a valid measure_name predicate (requires = '...', IN ('...') or regexp_like)",
+		},
+		{
+			desc:  "prefix",
+			input: `SELECT * FROM db.tbl WHERE time > ago(1h) AND measure_name LIKE 'gridx.ds.system.%'`,
+			opts:  like,
+		},
+		{
+			desc:  "prefix in every OR branch",
+			input: `SELECT * FROM db.tbl WHERE time > ago(1h) AND (measure_name LIKE 'cpu_%' OR measure_name = 'mem')`,
+			opts:  like,
+		},
+		{
+			desc:  "no literal prefix",
+			input: `SELECT * FROM db.tbl WHERE time > ago(1h) AND measure_name LIKE '%.system.%'`,
+			opts:  like,
+			rule:  RuleMeasurePattern,
+			want:  "measure_name pattern '%.system.%' needs a literal prefix",
+		},
+		{
+			desc:  "every measure",
+			input: `SELECT * FROM db.tbl WHERE time > ago(1h) AND measure_name LIKE '%%'`,
+			opts:  like,
+			rule:  RuleMeasurePattern,
+			want:  "measure_name pattern '%%' matches every measure",
+		},
+		{
+			desc:  "any pattern allowed",
+			input: `SELECT * FROM db.tbl WHERE time > ago(1h) AND measure_name LIKE '%.system.%'`,
+			opts:  &Options{AllowMeasureLike: true, AllowAnyMeasurePattern: true},
+		},
+		{
+			desc:  "NOT LIKE",
+			input: `SELECT * FROM db.tbl WHERE time > ago(1h) AND measure_name NOT LIKE 'gridx.%'`,
+			opts:  like,
+			rule:  RuleMeasure,
+			want:  "measure_name NOT LIKE excludes measures but still reads all others (requires = '...', IN ('...'), LIKE '...' or regexp_like)",
+		},
+		{
+			desc:  "NOT before LIKE",
+			input: `SELECT * FROM db.tbl WHERE time > ago(1h) AND NOT measure_name LIKE 'gridx.%'`,
+			opts:  like,
+			rule:  RuleMeasure,
+			want:  "measure_name NOT LIKE excludes measures but still reads all others",
+		},
+		{
+			desc:  "NOT before LIKE in parentheses",
+			input: `SELECT * FROM db.tbl WHERE time > ago(1h) AND NOT (measure_name LIKE 'gridx.%')`,
+			opts:  like,
+			rule:  RuleMeasure,
+			want:  "measure_name NOT LIKE excludes measures but still reads all others",
+		},
+		{
+			desc:  "NOT LIKE besides an accepted filter",
+			input: `SELECT * FROM db.tbl WHERE time > ago(1h) AND measure_name LIKE 'gridx.%' AND measure_name NOT LIKE 'gridx.test.%'`,
+			opts:  like,
+			rule:  RuleMeasure,
+			want:  "measure_name NOT LIKE excludes measures but still reads all others",
+		},
+	}
+	for _, tc := range testcases {
+		tc := tc
+		t.Run(tc.desc, func(t *testing.T) {
+			t.Parallel()
+			valid, issues := Validate(tc.input, tc.opts)
+			if tc.want == "" {
+				if !valid {
+					t.Errorf("%s: want valid, got issues: %+v", tc.desc, issues)
+				}
+				return
+			}
+			if valid || len(issues) != 1 || issues[0].Rule != tc.rule || !strings.HasPrefix(issues[0].Reason, tc.want) {
+				t.Errorf("%s: want a %s issue %q, got %v, %+v", tc.desc, tc.rule, tc.want, valid, issues)
+			}
+		})
+	}
+}
@@ -0,0 +1,115 @@
+package validator
+
+import (
+	"slices"
+	"strings"
+)
+
+// TableReference is a base table read by a query and the measures it selects
+type TableReference struct {
+	Database string
+	Table    string
+	// Measures are the literals of the measure_name = '...' and IN predicates
+	Measures []string
+}
+
+// References returns the base tables the SELECTs of sql read, in the order they
+// appear, with the measures their WHERE clauses select by name. Measures matched
+// by LIKE or a pattern are not listed.
+func References(sql string) []TableReference {
+	src := stripComments(sql)
+	toks := lex(src)
+	var refs []TableReference
+	index := map[string]int{}
+	for i := range toks {
+		if toks[i].kind != tkKeyword || toks[i].val != "select" {
+			continue
+		}
+		depth := toks[i].depth
+		fromIdx := findNextKeywordAtDepth(toks, i+1, depth, "from")
+		if fromIdx == -1 {
+			continue
+		}
+		stopIdx := findNextTerminatorAtDepth(toks, fromIdx+1, depth)
+		if !fromStartsWithBaseTable(toks, fromIdx+1, stopIdx, depth) {
+			continue
+		}
+		database, table, ok := tableNameAt(src, toks, fromIdx+1, stopIdx, depth)
+		if !ok {
+			continue
+		}
+		key := database + "." + table
+		n, seen := index[key]
+		if !seen {
+			n = len(refs)
+			index[key] = n
+			refs = append(refs, TableReference{Database: database, Table: table})
+		}
+		whereIdx := findNextKeywordBetweenAtDepth(toks, fromIdx+1, stopIdx, depth, "where")
+		if whereIdx == -1 {
+			continue
+		}
+		whereStop := findNextTerminatorAtDepth(toks, whereIdx+1, depth)
+		for _, measure := range measureLiterals(toks, whereIdx+1, whereStop) {
+			if !slices.Contains(refs[n].Measures, measure) {
+				refs[n].Measures = append(refs[n].Measures, measure)
+			}
+		}
+	}
+	return refs
+}
+
+// tableNameAt returns the database and table of the first FROM source at this
+// depth as written, identifiers are lowered by the lexer but table names are case
+// sensitive. An unquoted db.table is a single token.
+func tableNameAt(src string, toks []token, start, stop, depth int) (string, string, bool) {
+	first, end := baseTableTokens(toks, start, stop, depth)
+	if first == -1 {
+		return "", "", false
+	}
+	var parts []string
+	for i := first; i < end; i++ {
+		if toks[i].depth == depth && toks[i].kind == tkIdent {
+			parts = append(parts, strings.ReplaceAll(src[toks[i].pos:toks[i].end], `"`, ""))
+		}
+	}
+	switch len(parts) {
+	case 1:
+		return strings.Cut(parts[0], ".")
+	case 2:
+		return parts[0], parts[1], true
+	}
+	return "", "", false
+}
+
+// measureLiterals returns the values of the measure_name = '...' and
+// measure_name IN ('...') predicates in the range, outside of subqueries
+func measureLiterals(toks []token, start, stop int) []string {
+	var measures []string
+	for i := start; i+2 < stop && i+2 < len(toks); i++ {
+		if toks[i].val == "(" && toks[i+1].kind == tkKeyword && toks[i+1].val == "select" {
+			if end := matchingParen(toks, i); end != -1 {
+				i = end
+			}
+			continue
+		}
+		if toks[i].kind != tkIdent || toks[i].caseDepth > 0 {
+			continue
+		}
+		name := strings.ReplaceAll(toks[i].val, `"`, "")
+		if name != "measure_name" && !strings.HasSuffix(name, ".measure_name") {
+			continue
+		}
+		var literals []string
+		switch next := toks[i+1]; {
+		case next.kind == tkSymbol && next.val == "=" && toks[i+2].kind == tkString:
+			literals = []string{toks[i+2].val}
+		case next.kind == tkKeyword && next.val == "in" && toks[i+2].val == "(":
+			literals = inListLiterals(toks, i+3, stop)
+		}
+		for _, lit := range literals {
+			measures = append(measures, unquoteString(lit))
+		}
+	}
+	return measures
+}
@@ -0,0 +1,57 @@
+package validator
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestReferences(t *testing.T) {
+	t.Parallel()
+
+	testcases := []struct {
+		desc string
+		sql  string
+		want []TableReference
+	}{
+		{
+			desc: "equality",
+			sql:  `SELECT * FROM db.tbl WHERE time > ago(1h) AND measure_name = 'cpu'`,
+			want: []TableReference{{Database: "db", Table: "tbl", Measures: []string{"cpu"}}},
+		},
+		{
+			desc: "quoted names and IN list",
+			sql:  `SELECT * FROM "my-db"."Tbl" WHERE measure_name IN ('cpu', 'it''s')`,
+			want: []TableReference{{Database: "my-db", Table: "Tbl", Measures: []string{"cpu", "it's"}}},
+		},
+		{
+			desc: "patterns are not listed",
+			sql:  `SELECT * FROM db.tbl WHERE measure_name LIKE 'cpu%'`,
+			want: []TableReference{{Database: "db", Table: "tbl"}},
+		},
+		{
+			desc: "same table in CTEs is merged",
+			sql: `WITH a AS (SELECT * FROM db.tbl WHERE t.measure_name = 'a'),
+b AS (SELECT * FROM db.tbl WHERE measure_name IN ('a', 'b'))
+SELECT * FROM a JOIN b ON a.device = b.device`,
+			want: []TableReference{{Database: "db", Table: "tbl", Measures: []string{"a", "b"}}},
+		},
+		{
+			desc: "subquery table",
+			sql:  `SELECT * FROM db.a WHERE device IN (SELECT device FROM db.b WHERE measure_name = 'x')`,
+			want: []TableReference{{Database: "db", Table: "a"}, {Database: "db", Table: "b", Measures: []string{"x"}}},
+		},
+		{
+			desc: "unqualified table",
+			sql:  `SELECT * FROM tbl WHERE measure_name = 'x'`,
+		},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.desc, func(t *testing.T) {
+			t.Parallel()
+			if got := References(tc.sql); !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("References() = %+v, want %+v", got, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,117 @@
+package validator
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// Verdict is the overall outcome of a report
+type Verdict string
+
+const (
+	VerdictAccepted Verdict = "accepted"
+	// VerdictWarned accepts a query with issues of warning rules
+	VerdictWarned   Verdict = "warned"
+	VerdictRejected Verdict = "rejected"
+)
+
+// Report is the outcome of validating a query for consumers of JSON, e.g.
+// resource handlers and external tools. Issues is empty, not null, for valid
+// queries.
+type Report struct {
+	Valid    bool          `json:"valid"`
+	Verdict  Verdict       `json:"verdict"`
+	Errors   int           `json:"errors"`
+	Warnings int           `json:"warnings"`
+	Issues   []ReportIssue `json:"issues"`
+}
+
+// ReportIssue is an Issue of a report
+type ReportIssue struct {
+	Rule     Rule      `json:"rule,omitempty"`
+	Code     IssueCode `json:"code"`
+	Severity Severity  `json:"severity"`
+	Reason   string    `json:"reason"`
+	Snippet  string    `json:"snippet,omitempty"`
+	// Depth is the parenthesis depth of the offending SELECT
+	Depth     int       `json:"depth"`
+	Position  *Position `json:"position,omitempty"`
+	TimeBound TimeBound `json:"timeBound,omitempty"`
+	Fix       string    `json:"fix,omitempty"`
+	Waiver    string    `json:"waiver,omitempty"`
+}
+
+// Position locates an issue in the query: byte offsets, and 1-based lines and
+// columns counted in characters for editors
+type Position struct {
+	Start     int `json:"start"`
+	End       int `json:"end"`
+	Line      int `json:"line"`
+	Column    int `json:"column"`
+	EndLine   int `json:"endLine"`
+	EndColumn int `json:"endColumn"`
+}
+
+// ValidateReport validates the query like Validate and returns the result as
+// a report.
+func ValidateReport(sql string, opts *Options) Report {
+	valid, issues := Validate(sql, opts)
+	return newReport(sql, valid, issues)
+}
+
+// ValidateReport validates sql against the compiled options, see the package
+// level ValidateReport.
+func (c *Compiled) ValidateReport(sql string) Report {
+	valid, issues := c.Validate(sql)
+	return newReport(sql, valid, issues)
+}
+
+func newReport(sql string, valid bool, issues []Issue) Report {
+	r := Report{Valid: valid, Verdict: VerdictAccepted, Issues: make([]ReportIssue, 0, len(issues))}
+	for _, issue := range issues {
+		if issue.Severity == SeverityWarning {
+			r.Warnings++
+		} else {
+			r.Errors++
+		}
+		ri := ReportIssue{
+			Rule:      issue.Rule,
+			Code:      issue.Code,
+			Severity:  issue.Severity,
+			Reason:    issue.Reason,
+			Snippet:   issue.Snippet,
+			Depth:     issue.AtDepth,
+			TimeBound: issue.TimeBound,
+			Fix:       issue.Fix,
+			Waiver:    issue.Waiver,
+		}
+		// issues of invalid options have no position
+		if issue.End > issue.Start {
+			ri.Position = position(sql, issue.Start, issue.End)
+		}
+		r.Issues = append(r.Issues, ri)
+	}
+	switch {
+	case !valid:
+		r.Verdict = VerdictRejected
+	case r.Warnings > 0:
+		r.Verdict = VerdictWarned
+	}
+	return r
+}
+
+func position(sql string, start, end int) *Position {
+	start, end = min(max(start, 0), len(sql)), min(max(end, 0), len(sql))
+	p := &Position{Start: start, End: end}
+	p.Line, p.Column = lineColumn(sql, start)
+	p.EndLine, p.EndColumn = lineColumn(sql, end)
+	return p
+}
+
+// lineColumn returns the 1-based line and column of a byte offset
+func lineColumn(sql string, offset int) (int, int) {
+	before := sql[:offset]
+	line := strings.Count(before, "\n") + 1
+	column := utf8.RuneCountInString(before[strings.LastIndexByte(before, '\n')+1:]) + 1
+	return line, column
+}
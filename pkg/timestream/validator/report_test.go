@@ -0,0 +1,62 @@
+package validator
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestValidateReport(t *testing.T) {
+	t.Parallel()
+
+	sql := "SELECT *\nFROM db.tbl\nWHERE measure_name = 'ö'"
+	report := ValidateReport(sql, nil)
+	if report.Valid || report.Verdict != VerdictRejected || report.Errors != 1 || report.Warnings != 0 {
+		t.Fatalf("unexpected report %+v", report)
+	}
+	issue := report.Issues[0]
+	if issue.Rule != RuleTime || issue.Code != CodeMissingTimePredicate || issue.Severity != SeverityError {
+		t.Errorf("unexpected issue %+v", issue)
+	}
+	// columns count characters, not bytes
+	want := Position{Start: 0, End: len(sql), Line: 1, Column: 1, EndLine: 3, EndColumn: 25}
+	if issue.Position == nil || *issue.Position != want {
+		t.Errorf("want position %+v, got %+v", want, issue.Position)
+	}
+
+	warned := ValidateReport(sql, &Options{WarningRules: []Rule{RuleTime}})
+	if !warned.Valid || warned.Verdict != VerdictWarned || warned.Warnings != 1 {
+		t.Errorf("unexpected report %+v", warned)
+	}
+
+	invalid := ValidateReport(sql, &Options{Parser: "yacc"})
+	if invalid.Verdict != VerdictRejected || invalid.Issues[0].Code != CodeInvalidOptions || invalid.Issues[0].Position != nil {
+		t.Errorf("unexpected report %+v", invalid)
+	}
+}
+
+func TestValidateReport_JSON(t *testing.T) {
+	t.Parallel()
+
+	c, err := (&Options{}).Compile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := json.Marshal(c.ValidateReport(`SELECT * FROM db.tbl WHERE time > ago(1h) AND measure_name = 'cpu'`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `{"valid":true,"verdict":"accepted","errors":0,"warnings":0,"issues":[]}`; string(b) != want {
+		t.Errorf("want %s, got %s", want, b)
+	}
+
+	b, err = json.Marshal(c.ValidateReport(`SELECT * FROM db.tbl`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{`"verdict":"rejected"`, `"rule":"where"`, `"code":"missing-where"`, `"severity":"error"`, `"position":{"start":0,"end":20,"line":1,"column":1,"endLine":1,"endColumn":21}`} {
+		if !strings.Contains(string(b), want) {
+			t.Errorf("want %s in %s", want, b)
+		}
+	}
+}
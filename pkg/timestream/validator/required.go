@@ -0,0 +1,161 @@
+package validator
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// RequiredColumn is a column every WHERE branch has to filter, like the
+// measure_name rule does for measures
+type RequiredColumn struct {
+	Column string `json:"column"`
+	// Operators accepted for the predicate: "=", "in" and "like". Defaults to "=" and "in".
+	Operators []string `json:"operators,omitempty"`
+	// Values accepted as literals of the predicate, any value when empty
+	Values []string `json:"values,omitempty"`
+	// ValuePattern is a regular expression literals have to match in full,
+	// accepted besides Values
+	ValuePattern string `json:"valuePattern,omitempty"`
+	// Tables limits the column to these tables, in the format of TenantTables
+	Tables []string `json:"tables,omitempty"`
+	// Alternatives are columns whose predicate satisfies the requirement instead,
+	// e.g. device for a ds_account column when either of them has to be filtered
+	Alternatives []string `json:"alternatives,omitempty"`
+}
+
+var requiredOperators = map[string]bool{"=": true, "in": true, "like": true}
+
+type requiredColumn struct {
+	column string
+	// columns are the column followed by its alternatives
+	columns   []string
+	operators map[string]bool
+	values    map[string]bool
+	pattern   *regexp.Regexp
+	tables    *tableSet
+}
+
+func compileRequiredColumns(columns []RequiredColumn) ([]requiredColumn, error) {
+	var out []requiredColumn
+	for _, rc := range columns {
+		compiled := requiredColumn{operators: map[string]bool{"=": true, "in": true}}
+		for _, name := range append([]string{rc.Column}, rc.Alternatives...) {
+			column := strings.ToLower(strings.ReplaceAll(name, `"`, ""))
+			if column == "" || strings.ContainsAny(column, " \t\n'(),=") {
+				return nil, &ConfigError{Field: "requiredColumns", Value: name, Err: fmt.Errorf("not a column name")}
+			}
+			compiled.columns = append(compiled.columns, column)
+		}
+		compiled.column = compiled.columns[0]
+		if len(rc.Operators) > 0 {
+			compiled.operators = map[string]bool{}
+			for _, op := range rc.Operators {
+				if !requiredOperators[strings.ToLower(op)] {
+					return nil, &ConfigError{Field: "requiredColumns", Value: op, Err: fmt.Errorf("unsupported operator of %s", rc.Column)}
+				}
+				compiled.operators[strings.ToLower(op)] = true
+			}
+		}
+		if len(rc.Values) > 0 {
+			compiled.values = map[string]bool{}
+			for _, v := range rc.Values {
+				compiled.values[v] = true
+			}
+		}
+		if rc.ValuePattern != "" {
+			re, err := regexp.Compile("^(?:" + rc.ValuePattern + ")$")
+			if err != nil {
+				return nil, &ConfigError{Field: "requiredColumns", Value: rc.ValuePattern, Err: err}
+			}
+			compiled.pattern = re
+		}
+		var err error
+		if compiled.tables, err = compileTableSet("requiredColumns", rc.Tables); err != nil {
+			return nil, err
+		}
+		out = append(out, compiled)
+	}
+	return out, nil
+}
+
+func (rc requiredColumn) appliesTo(table string) bool {
+	return rc.tables == nil || rc.tables.contains(table)
+}
+
+func (rc requiredColumn) accepts(value string) bool {
+	if rc.values == nil && rc.pattern == nil {
+		return true
+	}
+	return rc.values[value] || (rc.pattern != nil && rc.pattern.MatchString(value))
+}
+
+// columnText names the column and its alternatives for issue reasons
+func (rc requiredColumn) columnText() string {
+	return strings.Join(rc.columns, " or ")
+}
+
+// operatorText lists the accepted operators for issue reasons
+func (rc requiredColumn) operatorText() string {
+	var ops []string
+	for op := range rc.operators {
+		ops = append(ops, strings.ToUpper(op))
+	}
+	slices.Sort(ops)
+	return strings.Join(ops, ", ")
+}
+
+// check returns whether the range has a predicate on the column or one of its
+// alternatives with an accepted operator, and the first literal that isn't an
+// accepted value with its column. Negated predicates don't count.
+func (rc requiredColumn) check(toks []token, start, stop int) (bool, string, string) {
+	found := false
+	for i := start; i+2 < stop && i+2 < len(toks); i++ {
+		if toks[i].kind != tkIdent || toks[i].caseDepth > 0 {
+			continue
+		}
+		column := columnName(toks[i].val)
+		// NOT column = 'a' excludes values like column != 'a'
+		if !slices.Contains(rc.columns, column) || negatedAt(toks, start, i) {
+			continue
+		}
+		var literals []string
+		switch next := toks[i+1]; {
+		case next.kind == tkSymbol && next.val == "=" && rc.operators["="] && toks[i+2].kind == tkString:
+			literals = []string{toks[i+2].val}
+		case next.kind == tkIdent && next.val == "like" && rc.operators["like"] && toks[i+2].kind == tkString:
+			literals = []string{toks[i+2].val}
+		case next.kind == tkKeyword && next.val == "in" && rc.operators["in"] && toks[i+2].val == "(":
+			literals = inListLiterals(toks, i+3, stop)
+		}
+		for _, lit := range literals {
+			if value := unquoteString(lit); !rc.accepts(value) {
+				return false, value, column
+			}
+		}
+		if len(literals) > 0 {
+			found = true
+		}
+	}
+	return found, "", ""
+}
+
+// inListLiterals returns the string literals of an IN list starting at i, or nil
+// when the list has other expressions
+func inListLiterals(toks []token, i, stop int) []string {
+	var literals []string
+	for ; i+1 < stop && i+1 < len(toks); i += 2 {
+		if toks[i].kind != tkString {
+			return nil
+		}
+		literals = append(literals, toks[i].val)
+		if toks[i+1].val == ")" {
+			return literals
+		}
+		if toks[i+1].val != "," {
+			return nil
+		}
+	}
+	return nil
+}
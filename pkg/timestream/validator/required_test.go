@@ -0,0 +1,147 @@
+package validator
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidate_RequiredColumns(t *testing.T) {
+	t.Parallel()
+
+	opts := &Options{RequiredColumns: []RequiredColumn{
+		{Column: "releasegroup", Values: []string{"stable", "canary", "alpha"}},
+		{Column: "region", Operators: []string{"like"}, ValuePattern: `eu-.*`, Tables: []string{"regional_*"}},
+	}}
+	testcases := []struct {
+		desc  string
+		input string
+		want  string
+	}{
+		{
+			desc:  "accepted value",
+			input: `SELECT * FROM db.tbl WHERE time > ago(1h) AND measure_name = 'cpu' AND releasegroup = 'canary'`,
+		},
+		{
+			desc:  "accepted IN list",
+			input: `SELECT * FROM db.tbl WHERE time > ago(1h) AND measure_name = 'cpu' AND t.releasegroup IN ('stable', 'alpha')`,
+		},
+		{
+			desc:  "missing",
+			input: `SELECT * FROM db.tbl WHERE time > ago(1h) AND measure_name = 'cpu'`,
+			want:  "lacks a predicate on required column releasegroup (=, IN)",
+		},
+		{
+			desc:  "value not accepted",
+			input: `SELECT * FROM db.tbl WHERE time > ago(1h) AND measure_name = 'cpu' AND releasegroup IN ('stable', 'beta')`,
+			want:  "releasegroup value 'beta' is not accepted",
+		},
+		{
+			desc:  "operator not accepted",
+			input: `SELECT * FROM db.tbl WHERE time > ago(1h) AND measure_name = 'cpu' AND releasegroup LIKE 'stable%'`,
+			want:  "lacks a predicate on required column releasegroup",
+		},
+		{
+			desc:  "negated",
+			input: `SELECT * FROM db.tbl WHERE time > ago(1h) AND measure_name = 'cpu' AND NOT releasegroup = 'stable'`,
+			want:  "lacks a predicate on required column releasegroup",
+		},
+		{
+			desc:  "negated in parentheses",
+			input: `SELECT * FROM db.tbl WHERE time > ago(1h) AND measure_name = 'cpu' AND NOT (releasegroup IN ('stable') AND device = 'd1')`,
+			want:  "lacks a predicate on required column releasegroup",
+		},
+		{
+			desc:  "NOT of another predicate",
+			input: `SELECT * FROM db.tbl WHERE time > ago(1h) AND measure_name = 'cpu' AND NOT (region = 'eu') AND releasegroup = 'stable' AND device IS NOT NULL`,
+		},
+		{
+			desc:  "OR branch",
+			input: `SELECT * FROM db.tbl WHERE time > ago(1h) AND measure_name = 'cpu' AND releasegroup = 'stable' OR time > ago(1h) AND measure_name = 'mem'`,
+			want:  "an OR branch in WHERE clause lacks a predicate on required column releasegroup",
+		},
+		{
+			desc:  "table scoped column",
+			input: `SELECT * FROM db.regional_2024 WHERE time > ago(1h) AND measure_name = 'cpu' AND releasegroup = 'stable' AND region LIKE 'eu-west-1'`,
+		},
+		{
+			desc:  "table scoped value pattern",
+			input: `SELECT * FROM db.regional_2024 WHERE time > ago(1h) AND measure_name = 'cpu' AND releasegroup = 'stable' AND region LIKE 'us-east-1'`,
+			want:  "region value 'us-east-1' is not accepted",
+		},
+	}
+
+	for _, tc := range testcases {
+		tc := tc
+		t.Run(tc.desc, func(t *testing.T) {
+			t.Parallel()
+			valid, issues := Validate(tc.input, opts)
+			if tc.want == "" {
+				if !valid {
+					t.Errorf("%s: want valid, got issues: %+v", tc.desc, issues)
+				}
+				return
+			}
+			if valid || len(issues) != 1 || issues[0].Rule != RuleRequiredColumn || !strings.Contains(issues[0].Reason, tc.want) {
+				t.Errorf("%s: want a %s issue containing %q, got %v, %+v", tc.desc, RuleRequiredColumn, tc.want, valid, issues)
+			}
+		})
+	}
+}
+
+func TestValidate_RequiredColumnAlternatives(t *testing.T) {
+	t.Parallel()
+
+	opts := &Options{RequiredColumns: []RequiredColumn{
+		{Column: "device", Alternatives: []string{"ds_account"}, Operators: []string{"=", "in", "like"}, ValuePattern: `[a-z0-9-]+%?`},
+	}}
+	testcases := []struct {
+		desc  string
+		input string
+		want  string
+	}{
+		{
+			desc:  "column",
+			input: `SELECT * FROM db.tbl WHERE time > ago(1h) AND measure_name = 'cpu' AND device = 'dev-1'`,
+		},
+		{
+			desc:  "alternative",
+			input: `SELECT * FROM db.tbl WHERE time > ago(1h) AND measure_name = 'cpu' AND "ds_account" LIKE 'acme%'`,
+		},
+		{
+			desc:  "a column in each OR branch",
+			input: `SELECT * FROM db.tbl WHERE time > ago(1h) AND measure_name = 'cpu' AND device = 'dev-1' OR time > ago(1h) AND measure_name = 'cpu' AND ds_account = 'acme'`,
+		},
+		{
+			desc:  "neither",
+			input: `SELECT * FROM db.tbl WHERE time > ago(1h) AND measure_name = 'cpu' AND region = 'eu'`,
+			want:  "WHERE clause lacks a predicate on required column device or ds_account (=, IN, LIKE)",
+		},
+		{
+			desc:  "negated alternative",
+			input: `SELECT * FROM db.tbl WHERE time > ago(1h) AND measure_name = 'cpu' AND NOT ds_account LIKE 'acme%'`,
+			want:  "WHERE clause lacks a predicate on required column device or ds_account (=, IN, LIKE)",
+		},
+		{
+			desc:  "alternative value not accepted",
+			input: `SELECT * FROM db.tbl WHERE time > ago(1h) AND measure_name = 'cpu' AND ds_account = 'ACME'`,
+			want:  "ds_account value 'ACME' is not accepted",
+		},
+	}
+
+	for _, tc := range testcases {
+		tc := tc
+		t.Run(tc.desc, func(t *testing.T) {
+			t.Parallel()
+			valid, issues := Validate(tc.input, opts)
+			if tc.want == "" {
+				if !valid {
+					t.Errorf("%s: want valid, got issues: %+v", tc.desc, issues)
+				}
+				return
+			}
+			if valid || len(issues) != 1 || issues[0].Reason != tc.want {
+				t.Errorf("%s: want issue %q, got %v, %+v", tc.desc, tc.want, valid, issues)
+			}
+		})
+	}
+}
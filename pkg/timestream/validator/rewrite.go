@@ -0,0 +1,84 @@
+package validator
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// TimeRange is the time range Rewrite restricts queries to, e.g. the one of the
+// dashboard
+type TimeRange struct {
+	From, To time.Time
+}
+
+// repairedRules are the rules whose issues a time predicate resolves
+var repairedRules = map[Rule]bool{RuleWhere: true, RuleTime: true, RuleBoundedTime: true, RuleTimeWindow: true}
+
+// Rewrite adds a time BETWEEN predicate for the time range to the WHERE clause
+// of every SELECT rejected for its time filter, adding a WHERE clause when there
+// is none. It returns the rewritten sql and the number of SELECTs changed.
+func Rewrite(sql string, timeRange TimeRange, opts *Options) (string, int, error) {
+	c, err := opts.Compile()
+	if err != nil {
+		return sql, 0, err
+	}
+	out, changed := c.Rewrite(sql, timeRange)
+	return out, changed, nil
+}
+
+// Rewrite repairs the time filters of sql, see the package level Rewrite. The
+// existing condition is parenthesized so the predicate applies to each of its OR
+// branches. SELECTs joining several tables are left unchanged, the time column
+// would be ambiguous. Comments are kept.
+func (c *Compiled) Rewrite(sql string, timeRange TimeRange) (string, int) {
+	valid, issues := c.Validate(sql)
+	if valid {
+		return sql, 0
+	}
+	offending := map[int]bool{}
+	for _, issue := range Errors(issues) {
+		if repairedRules[issue.Rule] {
+			offending[issue.Start] = true
+		}
+	}
+	if len(offending) == 0 {
+		return sql, 0
+	}
+
+	predicate := fmt.Sprintf("%s BETWEEN from_milliseconds(%d) AND from_milliseconds(%d)",
+		c.timeColumn, timeRange.From.UnixMilli(), timeRange.To.UnixMilli())
+	type edit struct {
+		pos  int
+		text string
+	}
+	var edits []edit
+	changed := 0
+	toks := lex(sql)
+	for _, s := range c.scopes(toks) {
+		if !offending[startOffset(toks, s.selIdx)] || len(s.tables) != 1 {
+			continue
+		}
+		changed++
+		if s.whereIdx == -1 {
+			stop := clauseEnd(toks, s.fromIdx+1, s.depth)
+			edits = append(edits, edit{pos: toks[stop-1].end, text: " WHERE " + predicate})
+			continue
+		}
+		stop := clauseEnd(toks, s.whereIdx+1, s.depth)
+		if stop == s.whereIdx+1 {
+			// an empty WHERE clause
+			edits = append(edits, edit{pos: toks[s.whereIdx].end, text: " " + predicate})
+			continue
+		}
+		edits = append(edits, edit{pos: toks[s.whereIdx+1].pos, text: "("}, edit{pos: toks[stop-1].end, text: ") AND " + predicate})
+	}
+
+	// apply from the back so the offsets stay valid
+	sort.SliceStable(edits, func(i, j int) bool { return edits[i].pos > edits[j].pos })
+	out := sql
+	for _, e := range edits {
+		out = out[:e.pos] + e.text + out[e.pos:]
+	}
+	return out, changed
+}
@@ -0,0 +1,106 @@
+package validator
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRewrite(t *testing.T) {
+	t.Parallel()
+
+	tr := TimeRange{From: time.UnixMilli(1700000000000), To: time.UnixMilli(1700003600000)}
+	const between = "time BETWEEN from_milliseconds(1700000000000) AND from_milliseconds(1700003600000)"
+	testcases := []struct {
+		desc    string
+		input   string
+		opts    *Options
+		want    string
+		changed int
+	}{
+		{
+			desc:    "missing WHERE",
+			input:   "SELECT * FROM db.t LIMIT 10",
+			opts:    &Options{AllowMissingMeasure: true},
+			want:    "SELECT * FROM db.t WHERE " + between + " LIMIT 10",
+			changed: 1,
+		},
+		{
+			desc:    "missing time filter",
+			input:   "SELECT * FROM db.t WHERE measure_name = 'cpu' OR measure_name = 'mem' GROUP BY host",
+			want:    "SELECT * FROM db.t WHERE (measure_name = 'cpu' OR measure_name = 'mem') AND " + between + " GROUP BY host",
+			changed: 1,
+		},
+		{
+			desc:    "OR branch without a time filter",
+			input:   "SELECT * FROM db.t WHERE (time > ago(1h) AND measure_name = 'a') OR measure_name = 'b'",
+			want:    "SELECT * FROM db.t WHERE ((time > ago(1h) AND measure_name = 'a') OR measure_name = 'b') AND " + between,
+			changed: 1,
+		},
+		{
+			desc:    "unbounded time",
+			input:   "SELECT * FROM db.t WHERE time > ago(1h) AND measure_name = 'cpu'",
+			opts:    &Options{BoundedTimeTables: []string{"t"}},
+			want:    "SELECT * FROM db.t WHERE (time > ago(1h) AND measure_name = 'cpu') AND " + between,
+			changed: 1,
+		},
+		{
+			desc:    "offending CTE",
+			input:   "WITH a AS (SELECT * FROM db.t WHERE measure_name = 'cpu' -- no time\n), b AS (SELECT * FROM db.u WHERE time > ago(1h) AND measure_name = 'cpu')\nSELECT * FROM a JOIN b ON a.time = b.time",
+			want:    "WITH a AS (SELECT * FROM db.t WHERE (measure_name = 'cpu') AND " + between + " -- no time\n), b AS (SELECT * FROM db.u WHERE time > ago(1h) AND measure_name = 'cpu')\nSELECT * FROM a JOIN b ON a.time = b.time",
+			changed: 1,
+		},
+		{
+			desc:    "custom time column",
+			input:   "SELECT * FROM db.t WHERE measure_name = 'cpu'",
+			opts:    &Options{TimeColumns: []string{`"Measure_Time"`, "time"}},
+			want:    "SELECT * FROM db.t WHERE (measure_name = 'cpu') AND measure_time BETWEEN from_milliseconds(1700000000000) AND from_milliseconds(1700003600000)",
+			changed: 1,
+		},
+		{
+			desc:  "valid",
+			input: "SELECT * FROM db.t WHERE time > ago(1h) AND measure_name = 'cpu'",
+			want:  "SELECT * FROM db.t WHERE time > ago(1h) AND measure_name = 'cpu'",
+		},
+		{
+			desc:  "other issues",
+			input: "SELECT * FROM db.t WHERE time > ago(1h)",
+			want:  "SELECT * FROM db.t WHERE time > ago(1h)",
+		},
+		{
+			desc:  "time issues configured as warnings",
+			input: "SELECT * FROM db.t WHERE measure_name = 'cpu'",
+			opts:  &Options{WarningRules: []Rule{RuleTime}},
+			want:  "SELECT * FROM db.t WHERE measure_name = 'cpu'",
+		},
+		{
+			desc:  "join of tables",
+			input: "SELECT * FROM db.t JOIN db.u ON t.host = u.host WHERE measure_name = 'cpu'",
+			opts:  &Options{Parser: ParserAST},
+			want:  "SELECT * FROM db.t JOIN db.u ON t.host = u.host WHERE measure_name = 'cpu'",
+		},
+	}
+
+	for _, tc := range testcases {
+		tc := tc
+		t.Run(tc.desc, func(t *testing.T) {
+			t.Parallel()
+			got, changed, err := Rewrite(tc.input, tr, tc.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tc.want || changed != tc.changed {
+				t.Fatalf("want %d changed\n%s\ngot %d\n%s", tc.changed, tc.want, changed, got)
+			}
+			if changed == 0 {
+				return
+			}
+			if valid, issues := Validate(got, tc.opts); !valid {
+				t.Errorf("rewritten query is rejected: %+v", issues)
+			}
+		})
+	}
+
+	if _, _, err := Rewrite("SELECT 1", tr, &Options{Parser: "yacc"}); err == nil {
+		t.Errorf("want an error of invalid options")
+	}
+}
@@ -0,0 +1,133 @@
+package validator
+
+import (
+	"strings"
+)
+
+// ScrubOptions configures Scrub. A nil *ScrubOptions masks every literal
+// that is not part of a time bound.
+type ScrubOptions struct {
+	// Disabled leaves the SQL untouched.
+	Disabled bool `json:"disabled,omitempty"`
+	// KeepNumbers leaves numeric literals unmasked.
+	KeepNumbers bool `json:"keepNumbers,omitempty"`
+	// KeepColumns lists columns whose compared literals are not sensitive,
+	// e.g. measure_name.
+	KeepColumns []string `json:"keepColumns,omitempty"`
+}
+
+// Placeholder for masked literals
+const scrubMask = "?"
+
+// Functions whose arguments describe the queried time range
+var timeFunctions = map[string]bool{
+	"ago": true, "bin": true, "date_trunc": true, "from_milliseconds": true, "from_nanoseconds": true,
+	"from_unixtime": true, "from_iso8601_timestamp": true, "from_iso8601_date": true, "now": true,
+}
+
+// Scrub masks string and numeric literals in sql, so device identifiers or
+// customer names don't end up in logs. Literals bounding the time column,
+// arguments of time functions, interval and LIMIT values are kept, since
+// they describe the cost of a query rather than its subject. Comments are
+// removed.
+func Scrub(sql string, opts *ScrubOptions) string {
+	if opts == nil {
+		opts = &ScrubOptions{}
+	}
+	if opts.Disabled {
+		return sql
+	}
+	keepColumns := map[string]bool{}
+	for _, c := range opts.KeepColumns {
+		keepColumns[strings.ToLower(strings.ReplaceAll(c, `"`, ""))] = true
+	}
+
+	src := stripComments(sql)
+	toks := lex(src)
+
+	// tokens within the arguments of time functions
+	keep := make([]bool, len(toks))
+	for i := 0; i+1 < len(toks); i++ {
+		if toks[i].kind != tkIdent || !timeFunctions[toks[i].val] || toks[i+1].val != "(" {
+			continue
+		}
+		closeIdx := matchingParen(toks, i+1)
+		if closeIdx == -1 {
+			closeIdx = len(toks)
+		}
+		for k := i + 1; k < closeIdx; k++ {
+			keep[k] = true
+		}
+	}
+
+	var b strings.Builder
+	b.Grow(len(src))
+	last := 0
+	for i, tok := range toks {
+		if tok.kind != tkString && tok.kind != tkNumber {
+			continue
+		}
+		if keep[i] || (tok.kind == tkNumber && opts.KeepNumbers) || keepLiteralAt(toks, i, keepColumns) {
+			continue
+		}
+		b.WriteString(src[last:tok.pos])
+		b.WriteString(scrubMask)
+		last = tok.end
+	}
+	b.WriteString(src[last:])
+	return strings.TrimSpace(b.String())
+}
+
+// keepLiteralAt reports whether the literal at i bounds the time column, is an
+// interval or LIMIT value, or is compared with one of the keep columns.
+func keepLiteralAt(toks []token, i int, keepColumns map[string]bool) bool {
+	prev := func(n int) token {
+		if i-n < 0 {
+			return token{}
+		}
+		return toks[i-n]
+	}
+	if p := prev(1); p.kind == tkIdent && (p.val == "interval" || p.val == "limit") {
+		return true
+	}
+	// time > '...', time BETWEEN '...' AND '...'
+	if (prev(1).kind == tkSymbol && isCompareOp(prev(1).val)) || (prev(1).kind == tkKeyword && prev(1).val == "between") {
+		if isTimeIdentifierAt(toks, i-2) || (prev(2).kind == tkIdent && keepColumns[columnName(prev(2).val)]) {
+			return true
+		}
+	}
+	if prev(1).kind == tkKeyword && prev(1).val == "and" && prev(3).kind == tkKeyword && prev(3).val == "between" {
+		return isTimeIdentifierAt(toks, i-4)
+	}
+	return false
+}
+
+// columnName strips quotes and the table qualifier of an identifier.
+func columnName(ident string) string {
+	name := strings.ReplaceAll(ident, `"`, "")
+	if idx := strings.LastIndex(name, "."); idx >= 0 {
+		name = name[idx+1:]
+	}
+	return name
+}
+
+// Deparameterize masks every literal of sql, time bounds included, leaving the
+// shape of the query, e.g. for sharing it outside the organization. Comments are
+// removed and whitespace between tokens collapsed to a space.
+func Deparameterize(sql string) string {
+	var b strings.Builder
+	b.Grow(len(sql))
+	prevEnd := -1
+	for tok := range tokens(sql) {
+		if prevEnd != -1 && prevEnd < tok.pos {
+			b.WriteByte(' ')
+		}
+		prevEnd = tok.end
+		if tok.kind == tkString || tok.kind == tkNumber {
+			b.WriteString(scrubMask)
+			continue
+		}
+		b.WriteString(sql[tok.pos:tok.end])
+	}
+	return b.String()
+}
@@ -0,0 +1,97 @@
+package validator
+
+import "testing"
+
+func TestScrub(t *testing.T) {
+	t.Parallel()
+
+	testcases := []struct {
+		desc  string
+		input string
+		opts  *ScrubOptions
+		want  string
+	}{
+		{
+			desc:  "masks dimension literals",
+			input: `SELECT * FROM "db"."tbl" WHERE time > ago(1h) AND device_id = 'ACME-123' AND serial IN ('a', 'b')`,
+			want:  `SELECT * FROM "db"."tbl" WHERE time > ago(1h) AND device_id = ? AND serial IN (?, ?)`,
+		},
+		{
+			desc:  "keeps time functions",
+			input: `SELECT bin(time, 5m), avg(measure_value::double) FROM db.tbl WHERE time BETWEEN from_milliseconds(1700000000000) AND from_milliseconds(1700003600000) AND temperature > 30.5`,
+			want:  `SELECT bin(time, 5m), avg(measure_value::double) FROM db.tbl WHERE time BETWEEN from_milliseconds(1700000000000) AND from_milliseconds(1700003600000) AND temperature > ?`,
+		},
+		{
+			desc:  "keeps time literals, interval and limit",
+			input: `SELECT * FROM db.tbl WHERE time BETWEEN '2024-01-01 00:00:00' AND '2024-01-02 00:00:00' AND time > now() - interval '1' day AND customer = 'Jane Doe' LIMIT 100`,
+			want:  `SELECT * FROM db.tbl WHERE time BETWEEN '2024-01-01 00:00:00' AND '2024-01-02 00:00:00' AND time > now() - interval '1' day AND customer = ? LIMIT 100`,
+		},
+		{
+			desc:  "removes comments",
+			input: "SELECT * FROM db.tbl -- device ACME-123\nWHERE device = 'x'",
+			want:  "SELECT * FROM db.tbl                   \nWHERE device = ?",
+		},
+		{
+			desc:  "keep columns",
+			input: `SELECT * FROM db.tbl WHERE measure_name = 'cpu' AND t.region = 'eu-west-1' AND device = 'x'`,
+			opts:  &ScrubOptions{KeepColumns: []string{"measure_name", `"region"`}},
+			want:  `SELECT * FROM db.tbl WHERE measure_name = 'cpu' AND t.region = 'eu-west-1' AND device = ?`,
+		},
+		{
+			desc:  "keep numbers",
+			input: `SELECT * FROM db.tbl WHERE battery < 20 AND device = 'x'`,
+			opts:  &ScrubOptions{KeepNumbers: true},
+			want:  `SELECT * FROM db.tbl WHERE battery < 20 AND device = ?`,
+		},
+		{
+			desc:  "disabled",
+			input: `SELECT * FROM db.tbl WHERE device = 'x' -- note`,
+			opts:  &ScrubOptions{Disabled: true},
+			want:  `SELECT * FROM db.tbl WHERE device = 'x' -- note`,
+		},
+		{
+			desc:  "escaped quotes",
+			input: `SELECT * FROM db.tbl WHERE name = 'O''Brien'`,
+			want:  `SELECT * FROM db.tbl WHERE name = ?`,
+		},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.desc, func(t *testing.T) {
+			t.Parallel()
+			if got := Scrub(tc.input, tc.opts); got != tc.want {
+				t.Errorf("Scrub() =\n%q\nwant\n%q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestDeparameterize(t *testing.T) {
+	t.Parallel()
+
+	testcases := []struct {
+		desc  string
+		input string
+		want  string
+	}{
+		{
+			desc:  "time bounds and measure names",
+			input: `SELECT * FROM db.tbl WHERE time BETWEEN '2024-01-01' AND '2024-01-02' AND measure_name = 'cpu' LIMIT 10`,
+			want:  `SELECT * FROM db.tbl WHERE time BETWEEN ? AND ? AND measure_name = ? LIMIT ?`,
+		},
+		{
+			desc:  "time functions and comments",
+			input: "SELECT bin(time, 5m) FROM db.tbl -- device 'x'\nWHERE time > from_milliseconds(1700000000000) AND device = 'O''Brien'",
+			want:  "SELECT bin(time, ?m) FROM db.tbl WHERE time > from_milliseconds(?) AND device = ?",
+		},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.desc, func(t *testing.T) {
+			t.Parallel()
+			if got := Deparameterize(tc.input); got != tc.want {
+				t.Errorf("Deparameterize() =\n%q\nwant\n%q", got, tc.want)
+			}
+		})
+	}
+}
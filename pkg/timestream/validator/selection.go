@@ -0,0 +1,97 @@
+package validator
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ExtractSelection returns the smallest complete statement enclosing the byte
+// range [start, end) of sql, like "run selection" in SQL IDEs:
+//   - a parenthesized SELECT (subquery or CTE body) if the range lies within one,
+//   - otherwise the ';' separated statement containing the range.
+//
+// A top-level CTE body keeps the CTEs defined before it, so references to
+// them still resolve.
+func ExtractSelection(sql string, start, end int) (string, error) {
+	if start < 0 || end < start || end > len(sql) {
+		return "", fmt.Errorf("invalid selection [%d, %d) for query of length %d", start, end, len(sql))
+	}
+	toks := lex(stripComments(sql))
+
+	// Split into statements on ';' at depth 0.
+	stmtStart := 0
+	for i := 0; i <= len(toks); i++ {
+		last := i == len(toks)
+		if !last && !(toks[i].kind == tkSymbol && toks[i].val == ";" && toks[i].depth == 0) {
+			continue
+		}
+		stmt := toks[stmtStart:i]
+		stmtStart = i + 1
+		if len(stmt) == 0 || (!last && toks[i].end <= start) {
+			continue
+		}
+		if !last && end > toks[i].end {
+			return "", fmt.Errorf("selection spans multiple statements")
+		}
+		// a selection starting in whitespace belongs to the following statement
+		start = max(start, stmt[0].pos)
+		end = max(end, start)
+		return extractFromStatement(sql, stmt, start, end), nil
+	}
+	return "", fmt.Errorf("selection does not contain a statement")
+}
+
+func extractFromStatement(sql string, stmt []token, start, end int) string {
+	// innermost parenthesized query containing the selection
+	bestOpen, bestClose := -1, -1
+	for k := 0; k+1 < len(stmt); k++ {
+		if stmt[k].val != "(" || stmt[k].kind != tkSymbol {
+			continue
+		}
+		if stmt[k+1].kind != tkKeyword || (stmt[k+1].val != "select" && stmt[k+1].val != "with") {
+			continue
+		}
+		closeIdx := matchingParen(stmt, k)
+		if closeIdx == -1 {
+			continue
+		}
+		if stmt[k+1].pos <= start && end <= stmt[closeIdx].pos {
+			if bestOpen == -1 || k > bestOpen {
+				bestOpen, bestClose = k, closeIdx
+			}
+		}
+	}
+	if bestOpen == -1 {
+		return strings.TrimSpace(sql[stmt[0].pos:stmt[len(stmt)-1].end])
+	}
+
+	body := strings.TrimSpace(sql[stmt[bestOpen+1].pos:stmt[bestClose].pos])
+	if stmt[bestOpen].depth != 0 || stmt[0].kind != tkKeyword || stmt[0].val != "with" {
+		return body
+	}
+
+	// Top-level CTE: keep the definitions before it.
+	prevEnd := -1
+	for k := 1; k < bestOpen; k++ {
+		if stmt[k].depth == 0 && stmt[k].kind == tkSymbol && stmt[k].val == "," {
+			prevEnd = k
+		}
+	}
+	if prevEnd == -1 {
+		return body
+	}
+	return "WITH " + strings.TrimSpace(sql[stmt[1].pos:stmt[prevEnd].pos]) + "\n" + body
+}
+
+// matchingParen returns the index of the ')' closing the '(' at open, or -1.
+func matchingParen(toks []token, open int) int {
+	for i := open + 1; i < len(toks); i++ {
+		if toks[i].depth < toks[open].depth {
+			return -1
+		}
+		if toks[i].depth == toks[open].depth && toks[i].kind == tkSymbol && toks[i].val == ")" {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,107 @@
+package validator
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestExtractSelection(t *testing.T) {
+	t.Parallel()
+
+	cte := `WITH a AS (
+  SELECT * FROM db.s1 WHERE time > ago(1h) AND measure_name = 'a'
+),
+b AS (
+  SELECT * FROM db.s2 WHERE time > ago(1h) AND measure_name = 'b'
+)
+SELECT * FROM a JOIN b ON a.device = b.device`
+
+	multi := `SELECT 1; SELECT * FROM db.s1 WHERE (device IN (SELECT device FROM db.s3 WHERE time > ago(1h))) -- trailing
+; SELECT 3`
+
+	testcases := []struct {
+		desc       string
+		sql        string
+		start, end string // selection from the first occurrence of start to the end of the first following occurrence of end
+		want       string
+	}{
+		{
+			desc:  "whole statement",
+			sql:   cte,
+			start: "SELECT * FROM a",
+			end:   "b.device",
+			want:  cte,
+		},
+		{
+			desc:  "first CTE body",
+			sql:   cte,
+			start: "FROM db.s1",
+			end:   "db.s1",
+			want:  `SELECT * FROM db.s1 WHERE time > ago(1h) AND measure_name = 'a'`,
+		},
+		{
+			desc:  "second CTE body keeps earlier CTEs",
+			sql:   cte,
+			start: "measure_name = 'b'",
+			end:   "'b'",
+			want: `WITH a AS (
+  SELECT * FROM db.s1 WHERE time > ago(1h) AND measure_name = 'a'
+)
+SELECT * FROM db.s2 WHERE time > ago(1h) AND measure_name = 'b'`,
+		},
+		{
+			desc:  "statement between semicolons",
+			sql:   multi,
+			start: "FROM db.s1",
+			end:   "db.s1",
+			want:  `SELECT * FROM db.s1 WHERE (device IN (SELECT device FROM db.s3 WHERE time > ago(1h)))`,
+		},
+		{
+			desc:  "subquery",
+			sql:   multi,
+			start: "db.s3",
+			end:   "db.s3",
+			want:  `SELECT device FROM db.s3 WHERE time > ago(1h)`,
+		},
+		{
+			desc:  "last statement",
+			sql:   multi,
+			start: "SELECT 3",
+			end:   "3",
+			want:  `SELECT 3`,
+		},
+	}
+
+	for _, tc := range testcases {
+		tc := tc
+		t.Run(tc.desc, func(t *testing.T) {
+			t.Parallel()
+			start := strings.Index(tc.sql, tc.start)
+			end := start + strings.Index(tc.sql[start:], tc.end) + len(tc.end)
+			got, err := ExtractSelection(tc.sql, start, end)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if got != tc.want {
+				t.Errorf("want:\n%s\ngot:\n%s", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestExtractSelection_Errors(t *testing.T) {
+	t.Parallel()
+
+	if _, err := ExtractSelection("SELECT 1", 5, 2); err == nil {
+		t.Errorf("expected error for inverted selection")
+	}
+	if _, err := ExtractSelection("SELECT 1", 0, 100); err == nil {
+		t.Errorf("expected error for selection out of range")
+	}
+	if _, err := ExtractSelection("SELECT 1; SELECT 2", 0, 17); err == nil {
+		t.Errorf("expected error for selection across statements")
+	}
+	if _, err := ExtractSelection("SELECT 1;  ", 10, 10); err == nil {
+		t.Errorf("expected error for selection without statement")
+	}
+}
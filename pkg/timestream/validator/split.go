@@ -0,0 +1,154 @@
+package validator
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// aggregateFunctions combine the rows of a group into one, so an aggregate over
+// the whole range differs from the aggregates over its parts
+var aggregateFunctions = map[string]bool{
+	"avg": true, "sum": true, "count": true, "count_if": true, "min": true, "max": true,
+	"min_by": true, "max_by": true, "arbitrary": true, "array_agg": true, "map_agg": true,
+	"approx_distinct": true, "approx_percentile": true, "bool_and": true, "bool_or": true,
+	"every": true, "geometric_mean": true, "histogram": true, "stddev": true, "stddev_pop": true,
+	"stddev_samp": true, "variance": true, "var_pop": true, "var_samp": true,
+}
+
+// SplitBlocker returns why running sql once per sub-range of the time range and
+// appending the results in time order differs from running it over the whole
+// range, or "" when it doesn't. Every row must come from a single sub-range and
+// rows must come out in time order: groups bin time, aggregates are grouped, the
+// outermost ORDER BY starts with time ascending and no LIMIT or window function
+// sees only part of the rows.
+func SplitBlocker(sql string) string {
+	src := stripComments(sql)
+	toks := lex(src)
+	for i, tok := range toks {
+		switch {
+		case tok.kind == tkIdent && (tok.val == "limit" || tok.val == "$__limit"):
+			return "LIMIT would apply to each sub-range"
+		case tok.kind == tkIdent && tok.val == "over" && i+1 < len(toks) && toks[i+1].val == "(":
+			return "window functions would restart in each sub-range"
+		case tok.kind == tkKeyword && tok.val == "select":
+			if fn := ungroupedAggregate(toks, i); fn != "" {
+				return fmt.Sprintf("%s() without GROUP BY would aggregate each sub-range", fn)
+			}
+		case tok.kind == tkKeyword && tok.val == "group" && i+1 < len(toks) && toks[i+1].val == "by":
+			if !keyedByTime(src, toks, i, false) {
+				return "GROUP BY doesn't bin time, groups would repeat in each sub-range"
+			}
+		case tok.kind == tkKeyword && tok.val == "order" && tok.depth == 0 && i+1 < len(toks) && toks[i+1].val == "by":
+			if !keyedByTime(src, toks, i, true) {
+				return "ORDER BY doesn't start with time ascending"
+			}
+		}
+	}
+	return ""
+}
+
+// ungroupedAggregate returns the first aggregate function in the SELECT list of
+// the select at toks[selIdx] when the select has no GROUP BY. Nested selects are
+// checked on their own.
+func ungroupedAggregate(toks []token, selIdx int) string {
+	depth := toks[selIdx].depth
+	fn := ""
+	nested := -1
+	i := selIdx + 1
+	for ; i < len(toks) && toks[i].depth >= depth; i++ {
+		tok := toks[i]
+		if nested != -1 {
+			if tok.depth >= nested {
+				continue
+			}
+			nested = -1
+		}
+		if tok.depth == depth && tok.kind == tkKeyword && tok.val == "from" {
+			break
+		}
+		switch {
+		case tok.kind == tkKeyword && tok.val == "select":
+			nested = tok.depth
+		case fn == "" && tok.kind == tkIdent && aggregateFunctions[tok.val] && i+1 < len(toks) && toks[i+1].val == "(":
+			fn = tok.val
+		}
+	}
+	if fn == "" {
+		return ""
+	}
+	for ; i < len(toks) && toks[i].depth >= depth; i++ {
+		if toks[i].depth != depth || toks[i].kind != tkKeyword {
+			continue
+		}
+		switch toks[i].val {
+		case "group":
+			return ""
+		case "union", "intersect", "except":
+			return fn
+		}
+	}
+	return fn
+}
+
+// keyedByTime reports whether the GROUP BY or ORDER BY at toks[idx] has a time
+// key, the first key ascending for ordered. Ordinals and aliases are resolved
+// against the SELECT list of the enclosing select.
+func keyedByTime(src string, toks []token, idx int, ordered bool) bool {
+	depth := toks[idx].depth
+	stop := findNextTerminatorAtDepth(toks, idx+2, depth)
+	keys := splitAtComma(toks, idx+2, stop)
+	if ordered && len(keys) > 1 {
+		keys = keys[:1]
+	}
+	items := enclosingSelectList(toks, idx)
+	for _, key := range keys {
+		start, end := key[0], key[1]
+		if ordered {
+			if toks[end-1].kind == tkIdent && toks[end-1].val == "desc" {
+				return false
+			}
+			if toks[end-1].kind == tkIdent && toks[end-1].val == "asc" && end-1 > start {
+				end--
+			}
+		}
+		expr := src[toks[start].pos:toks[end-1].end]
+		if end-start == 1 {
+			expr = resolveSelectItem(src, toks, items, toks[start])
+		}
+		if isTimeExpression(expr) {
+			return true
+		}
+	}
+	return false
+}
+
+// enclosingSelectList returns the items of the SELECT list of the select the
+// clause at toks[idx] belongs to
+func enclosingSelectList(toks []token, idx int) [][2]int {
+	depth := toks[idx].depth
+	for i := idx - 1; i >= 0 && toks[i].depth >= depth; i-- {
+		if toks[i].depth == depth && toks[i].kind == tkKeyword && toks[i].val == "select" {
+			return splitAtComma(toks, i+1, findNextKeywordBetweenAtDepth(toks, i+1, idx, depth, "from"))
+		}
+	}
+	return nil
+}
+
+// resolveSelectItem returns the expression of the SELECT list item an ordinal or
+// alias key refers to, the key itself otherwise
+func resolveSelectItem(src string, toks []token, items [][2]int, key token) string {
+	text := func(item [2]int) string { return src[toks[item[0]].pos:toks[item[1]-1].end] }
+	switch key.kind {
+	case tkNumber:
+		if n, err := strconv.Atoi(key.val); err == nil && n >= 1 && n <= len(items) {
+			return text(items[n-1])
+		}
+	case tkIdent:
+		for _, item := range items {
+			if item[1]-item[0] >= 3 && toks[item[1]-2].val == "as" && toks[item[1]-1].val == key.val {
+				return text(item)
+			}
+		}
+	}
+	return key.val
+}
@@ -0,0 +1,88 @@
+package validator
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSplitBlocker(t *testing.T) {
+	t.Parallel()
+
+	testcases := []struct {
+		desc  string
+		input string
+		want  string
+	}{
+		{
+			desc:  "raw rows",
+			input: `SELECT time, measure_value::double FROM db.tbl WHERE $__timeFilter AND measure_name = 'cpu'`,
+		},
+		{
+			desc:  "binned groups ordered by time",
+			input: `SELECT device, bin(time, 1m) AS t, avg(measure_value::double) FROM db.tbl WHERE $__timeFilter GROUP BY device, bin(time, 1m) ORDER BY t, device`,
+		},
+		{
+			desc:  "groups by ordinal",
+			input: `SELECT bin(time, 1m), count(*) FROM db.tbl WHERE $__timeFilter GROUP BY 1 ORDER BY 1 ASC`,
+		},
+		{
+			desc:  "aggregate in a binned CTE",
+			input: `WITH x AS (SELECT bin(time, 1h) AS t, max(measure_value::double) AS v FROM db.tbl WHERE $__timeFilter GROUP BY bin(time, 1h)) SELECT t, v FROM x`,
+		},
+		{
+			desc:  "groups without time",
+			input: `SELECT device, avg(measure_value::double) FROM db.tbl WHERE $__timeFilter GROUP BY device`,
+			want:  "GROUP BY doesn't bin time",
+		},
+		{
+			desc:  "groups by an alias of another column",
+			input: `SELECT device AS d, bin(time, 1m) AS t, avg(measure_value::double) FROM db.tbl WHERE $__timeFilter GROUP BY d`,
+			want:  "GROUP BY doesn't bin time",
+		},
+		{
+			desc:  "aggregate without group by",
+			input: `SELECT count(*) FROM db.tbl WHERE $__timeFilter`,
+			want:  "count() without GROUP BY",
+		},
+		{
+			desc:  "nested aggregate without group by",
+			input: `SELECT round(avg(measure_value::double), 2) FROM db.tbl WHERE $__timeFilter`,
+			want:  "avg() without GROUP BY",
+		},
+		{
+			desc:  "descending order",
+			input: `SELECT time, measure_value::double FROM db.tbl WHERE $__timeFilter ORDER BY time DESC`,
+			want:  "ORDER BY doesn't start with time ascending",
+		},
+		{
+			desc:  "order by another column first",
+			input: `SELECT time, device FROM db.tbl WHERE $__timeFilter ORDER BY device, time`,
+			want:  "ORDER BY doesn't start with time ascending",
+		},
+		{
+			desc:  "limit",
+			input: `SELECT time, device FROM db.tbl WHERE $__timeFilter ORDER BY time LIMIT 10`,
+			want:  "LIMIT",
+		},
+		{
+			desc:  "limit macro",
+			input: `SELECT time, device FROM db.tbl WHERE $__timeFilter $__limit`,
+			want:  "LIMIT",
+		},
+		{
+			desc:  "window function",
+			input: `SELECT time, measure_value::double - lag(measure_value::double) OVER (ORDER BY time) FROM db.tbl WHERE $__timeFilter`,
+			want:  "window functions",
+		},
+	}
+
+	for _, tc := range testcases {
+		got := SplitBlocker(tc.input)
+		if tc.want == "" && got != "" {
+			t.Errorf("%s: SplitBlocker() = %q, want none", tc.desc, got)
+		}
+		if tc.want != "" && !strings.Contains(got, tc.want) {
+			t.Errorf("%s: SplitBlocker() = %q, want %q", tc.desc, got, tc.want)
+		}
+	}
+}
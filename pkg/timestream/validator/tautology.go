@@ -0,0 +1,75 @@
+package validator
+
+import (
+	"slices"
+	"time"
+)
+
+// A predicate whose range starts before earliestTimeBound and ends after it is
+// taken to read everything, e.g. time > from_milliseconds(0) or time > ago(36500d),
+// unless Options.TimeLookback moves the start of the data.
+var earliestTimeBound = time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// tautologicalTimePredicate reports whether the predicate compares the time
+// column without restricting it: from before earliest to after it, only with
+// upper bounds, with <> or a NOT of a range, or with itself like
+// time >= time - 1h. Values that can't be evaluated, e.g. a subquery or
+// date_trunc('day', now()), are taken to restrict time.
+func tautologicalTimePredicate(toks []token, start, stop int, columns map[string]bool, now, earliest time.Time) bool {
+	if comparesTimeWithItself(toks, start, stop, columns) {
+		return true
+	}
+	// time <> x compares without a bound
+	values := predicateTimeValues(toks, start, stop, columns, now)
+	if len(values) == 0 || slices.ContainsFunc(values, func(v timeValue) bool { return v.outside }) {
+		return true
+	}
+	if slices.ContainsFunc(values, func(v timeValue) bool { return !v.known }) {
+		return false
+	}
+	var from, to time.Time
+	hasFrom, hasTo := false, false
+	for _, v := range values {
+		if v.bound == TimeLowerBounded || v.bound == TimeBounded {
+			if !hasFrom || v.at.After(from) {
+				from = v.at
+			}
+			hasFrom = true
+		}
+		if v.bound == TimeUpperBounded || v.bound == TimeBounded {
+			if !hasTo || v.at.Before(to) {
+				to = v.at
+			}
+			hasTo = true
+		}
+	}
+	// time < now() reads all of the past
+	if !hasFrom {
+		return true
+	}
+	if !hasTo {
+		to = now
+	}
+	return from.Before(earliest) && to.After(earliest)
+}
+
+// comparesTimeWithItself reports whether the predicate is time = time, time >= time
+// or time <= time, which hold for every row, or compares time with itself plus or
+// minus a value, like time >= time - 1h
+func comparesTimeWithItself(toks []token, start, stop int, columns map[string]bool) bool {
+	if stop-start < 3 || !isTimeColumnAt(toks, start, columns) || !isTimeColumnAt(toks, start+2, columns) {
+		return false
+	}
+	if toks[start].val != toks[start+2].val || toks[start+1].kind != tkSymbol {
+		return false
+	}
+	if stop-start > 3 {
+		next := toks[start+3]
+		return next.kind == tkSymbol && (next.val == "+" || next.val == "-") && compareBound(toks[start+1].val, false) != TimeUnbounded
+	}
+	switch toks[start+1].val {
+	case "=", ">=", "<=":
+		return true
+	}
+	return false
+}
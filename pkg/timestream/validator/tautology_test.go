@@ -0,0 +1,75 @@
+package validator
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidate_TautologicalTime(t *testing.T) {
+	t.Parallel()
+
+	testcases := []struct {
+		desc   string
+		input  string
+		opts   *Options
+		reason string
+	}{
+		{desc: "epoch zero", input: "SELECT * FROM db.t WHERE time > from_milliseconds(0) AND measure_name = 'cpu'", reason: "time filter time > from_milliseconds(0) doesn't restrict time"},
+		{desc: "epoch zero between", input: "SELECT * FROM db.t WHERE time BETWEEN from_milliseconds(0) AND now() AND measure_name = 'cpu'", reason: "time filter time BETWEEN from_milliseconds(0) AND now() doesn't restrict time"},
+		{desc: "absurdly wide", input: "SELECT * FROM db.t WHERE time > ago(36500d) AND measure_name = 'cpu'", reason: "time filter time > ago(36500d)"},
+		{desc: "old iso timestamp", input: "SELECT * FROM db.t WHERE time >= from_iso8601_timestamp('1970-01-01T00:00:00Z') AND measure_name = 'cpu'", reason: "time filter time >= from_iso8601_timestamp"},
+		{desc: "far future", input: "SELECT * FROM db.t WHERE time < from_milliseconds(9999999999999) AND measure_name = 'cpu'", reason: "time filter time < from_milliseconds(9999999999999)"},
+		{desc: "itself", input: "SELECT * FROM db.t WHERE time = time AND measure_name = 'cpu'", reason: "time filter time = time"},
+		{desc: "OR branch", input: "SELECT * FROM db.t WHERE (time > ago(1h) AND measure_name = 'a') OR (time > from_unixtime(0) AND measure_name = 'b')", reason: "time filter time > from_unixtime(0) of an OR branch"},
+		{desc: "with a restricting filter", input: "SELECT * FROM db.t WHERE time > from_milliseconds(0) AND time > ago(1h) AND measure_name = 'cpu'"},
+		{desc: "dashboard range", input: "SELECT * FROM db.t WHERE time BETWEEN from_milliseconds(1700000000000) AND from_milliseconds(1700003600000) AND measure_name = 'cpu'"},
+		{desc: "narrow old range", input: "SELECT * FROM db.t WHERE time BETWEEN from_milliseconds(1) AND from_milliseconds(2) AND measure_name = 'cpu'"},
+		{desc: "until now", input: "SELECT * FROM db.t WHERE time > ago(1h) AND time <= now() + 1h AND measure_name = 'cpu'"},
+		{desc: "computed", input: "SELECT * FROM db.t WHERE time > (SELECT min(time) FROM db.u WHERE time > ago(1h) AND measure_name = 'cpu') AND measure_name = 'cpu'"},
+		{desc: "interval literal", input: "SELECT * FROM db.t WHERE time > now() - interval '1' hour AND measure_name = 'cpu'"},
+		{desc: "date_trunc", input: "SELECT * FROM db.t WHERE time > date_trunc('day', now()) AND measure_name = 'cpu'"},
+		{desc: "binned now", input: "SELECT * FROM db.t WHERE time > bin(now(), 1h) - 1d AND measure_name = 'cpu'"},
+		{desc: "timestamp literal", input: "SELECT * FROM db.t WHERE time > timestamp '2025-01-01 00:00:00' AND measure_name = 'cpu'"},
+		{desc: "parameter", input: "SELECT * FROM db.t WHERE time > ? AND measure_name = 'cpu'"},
+		{desc: "computed before the epoch", input: "SELECT * FROM db.t WHERE time BETWEEN (SELECT min(time) FROM db.u WHERE time > ago(1h) AND measure_name = 'cpu') AND now() AND measure_name = 'cpu'"},
+		{desc: "negated equality", input: "SELECT * FROM db.t WHERE NOT time = ago(1h) AND measure_name = 'cpu'", reason: "time filter NOT time = ago(1h)"},
+		{desc: "upper bound only", input: "SELECT * FROM db.t WHERE time < now() AND measure_name = 'cpu'", reason: "time filter time < now()"},
+		{desc: "not equal", input: "SELECT * FROM db.t WHERE time <> from_milliseconds(0) AND measure_name = 'cpu'", reason: "time filter time <> from_milliseconds(0)"},
+		{desc: "itself minus an interval", input: "SELECT * FROM db.t WHERE time >= time - 1h AND measure_name = 'cpu'", reason: "time filter time >= time - 1h"},
+		{desc: "negative epoch", input: "SELECT * FROM db.t WHERE time > from_milliseconds(-1) AND measure_name = 'cpu'", reason: "time filter time > from_milliseconds(-1)"},
+		{desc: "not between", input: "SELECT * FROM db.t WHERE time NOT BETWEEN ago(1h) AND now() AND measure_name = 'cpu'", reason: "time filter time NOT BETWEEN"},
+		{desc: "overflowing ago", input: "SELECT * FROM db.t WHERE time > ago(110000d) AND measure_name = 'cpu'", reason: "time filter time > ago(110000d)"},
+		{desc: "overflowing now minus hours", input: "SELECT * FROM db.t WHERE time > now() - 3000000h AND measure_name = 'cpu'", reason: "time filter time > now() - 3000000h"},
+		{desc: "overflowing now minus days", input: "SELECT * FROM db.t WHERE time > now() - 110000d AND measure_name = 'cpu'", reason: "time filter time > now() - 110000d"},
+		{desc: "before the lookback", input: "SELECT * FROM db.t WHERE time > ago(9000d) AND measure_name = 'cpu'", opts: &Options{TimeLookback: "365d"}, reason: "time filter time > ago(9000d)"},
+		{desc: "within the lookback", input: "SELECT * FROM db.t WHERE time > ago(30d) AND measure_name = 'cpu'", opts: &Options{TimeLookback: "365d"}},
+		{desc: "negated upper bound", input: "SELECT * FROM db.t WHERE NOT time < ago(1h) AND measure_name = 'cpu'"},
+		{desc: "date_add", input: "SELECT * FROM db.t WHERE time > date_add('hour', -1, now()) AND measure_name = 'cpu'"},
+	}
+
+	for _, tc := range testcases {
+		tc := tc
+		t.Run(tc.desc, func(t *testing.T) {
+			t.Parallel()
+			valid, issues := Validate(tc.input, tc.opts)
+			if tc.reason == "" {
+				if !valid {
+					t.Errorf("unexpected issues %+v", issues)
+				}
+				return
+			}
+			if valid || len(issues) != 1 || issues[0].Rule != RuleTime || issues[0].Code != CodeTautologicalTimePredicate || !strings.HasPrefix(issues[0].Reason, tc.reason) {
+				t.Errorf("want an issue %q, got %v %+v", tc.reason, valid, issues)
+			}
+		})
+	}
+
+	if _, err := (&Options{TimeLookback: "forever"}).Compile(); err == nil {
+		t.Errorf("want an invalid timeLookback rejected")
+	}
+
+	// the issues are the time rule's, configured with its level
+	if valid, issues := Validate("SELECT * FROM db.t WHERE time > from_milliseconds(0) AND measure_name = 'cpu'", &Options{RuleLevels: map[Rule]RuleLevel{RuleTime: LevelWarn}}); !valid || len(issues) != 1 {
+		t.Errorf("want a warning, got %v %+v", valid, issues)
+	}
+}
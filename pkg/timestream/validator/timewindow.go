@@ -0,0 +1,376 @@
+package validator
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// timeWindowCheck rejects time filters spanning more than Options.MaxTimeWindow,
+// e.g. time > ago(30d) where a week is the most dashboards should read
+type timeWindowCheck struct{ c *Compiled }
+
+func (timeWindowCheck) Rule() Rule { return RuleTimeWindow }
+
+func (ch timeWindowCheck) CheckSelect(s *Select) []Issue {
+	limit := ch.c.maxTimeWindow
+	if limit <= 0 {
+		return nil
+	}
+	now := time.Now()
+	var widest time.Duration
+	open, unknown := false, false
+	for _, branch := range s.scope.branches {
+		w := branchTimeWindow(s.toks, branch, ch.c.timeColumns, now)
+		switch {
+		case w.unknown:
+			unknown = true
+		case w.open:
+			open = true
+		case w.to.Sub(w.from) > widest:
+			widest = w.to.Sub(w.from)
+		}
+	}
+	prefix := "WHERE clause"
+	if len(s.scope.branches) > 1 {
+		prefix = "an OR branch in WHERE clause"
+	}
+	if open {
+		return []Issue{{Reason: fmt.Sprintf("%s has no lower time bound, queries may read at most %s", prefix, formatInterval(limit)), Code: CodeTimeWindowTooWide}}
+	}
+	if unknown {
+		return []Issue{{Reason: fmt.Sprintf("%s has a time range that can't be determined, queries may read at most %s", prefix, formatInterval(limit)), Code: CodeTimeWindowTooWide}}
+	}
+	if widest > limit {
+		return []Issue{{Reason: fmt.Sprintf("%s reads %s of time, more than the maximum of %s", prefix, formatInterval(widest), formatInterval(limit)), Code: CodeTimeWindowTooWide}}
+	}
+	return nil
+}
+
+// timeWindow is the range of time a WHERE branch reads
+type timeWindow struct {
+	from, to time.Time
+	// open is a branch without a lower bound, unknown one whose lower bounds
+	// aren't literal times
+	open, unknown bool
+}
+
+// branchTimeWindow reads the time range of the AND-ed predicates of a branch:
+// the latest lower and the earliest upper bound, now without an upper bound.
+// Bounds that aren't literal times only narrow the range of the others.
+func branchTimeWindow(toks []token, branch [][2]int, columns map[string]bool, now time.Time) timeWindow {
+	w := timeWindow{to: now}
+	hasFrom, hasUnknown := false, false
+	for _, p := range branch {
+		for _, b := range predicateTimeValues(toks, p[0], p[1], columns, now) {
+			if !b.known {
+				hasUnknown = true
+				continue
+			}
+			if b.bound == TimeLowerBounded || b.bound == TimeBounded {
+				if !hasFrom || b.at.After(w.from) {
+					w.from = b.at
+				}
+				hasFrom = true
+			}
+			if (b.bound == TimeUpperBounded || b.bound == TimeBounded) && b.at.Before(w.to) {
+				w.to = b.at
+			}
+		}
+	}
+	w.unknown = !hasFrom && hasUnknown
+	w.open = !hasFrom && !hasUnknown
+	return w
+}
+
+// timeValue is a bound of the time column in a predicate
+type timeValue struct {
+	// bound is TimeLowerBounded or TimeUpperBounded, TimeBounded for =
+	bound TimeBound
+	at    time.Time
+	// known is false for values other than literal times and the functions
+	// timeValueAt reads
+	known bool
+	// outside is a negated range or equality, reading everything but the value
+	outside bool
+}
+
+// predicateTimeValues returns the bounds a predicate sets on the time column,
+// e.g. time > ago(1h) or time BETWEEN from_milliseconds(a) AND from_milliseconds(b).
+// A NOT flips the bound of a single comparison, other comparisons under NOT
+// are unknown.
+func predicateTimeValues(toks []token, start, stop int, columns map[string]bool, now time.Time) []timeValue {
+	if start >= stop {
+		return nil
+	}
+	depth := toks[start].depth
+	negated := false
+	for i := start; i < stop; i++ {
+		depth = min(depth, toks[i].depth)
+	}
+	for i := start; i < stop; i++ {
+		if toks[i].depth == depth && toks[i].kind == tkKeyword && toks[i].val == "not" {
+			negated = true
+		}
+	}
+	var values []timeValue
+	for i := start; i < stop; i++ {
+		if toks[i].depth != depth || !isTimeColumnAt(toks, i, columns) {
+			continue
+		}
+		j := i + 1
+		switch {
+		case j < stop && toks[j].kind == tkKeyword && toks[j].val == "between":
+			from, next, ok := timeValueAt(toks, j+1, stop, now)
+			ok = ok && next < stop && toks[next].kind == tkKeyword && toks[next].val == "and"
+			var to time.Time
+			var end int
+			if ok {
+				to, end, ok = timeValueAt(toks, next+1, stop, now)
+				ok = ok && end == stop
+			}
+			values = append(values, timeValue{bound: TimeLowerBounded, at: from, known: ok}, timeValue{bound: TimeUpperBounded, at: to, known: ok})
+		case j < stop && toks[j].kind == tkSymbol && compareBound(toks[j].val, false) != TimeUnbounded:
+			at, end, ok := timeValueAt(toks, j+1, stop, now)
+			values = append(values, timeValue{bound: compareBound(toks[j].val, false), at: at, known: ok && end == stop})
+		case i-1 > start && toks[i-1].kind == tkSymbol && compareBound(toks[i-1].val, true) != TimeUnbounded:
+			// x op time, x starts the predicate
+			at, end, ok := timeValueAt(toks, start, i-1, now)
+			values = append(values, timeValue{bound: compareBound(toks[i-1].val, true), at: at, known: ok && end == i-1})
+		}
+	}
+	// NOT time < x is time >= x, other negations read everything outside a range
+	if negated {
+		for i := range values {
+			values[i].outside = len(values) > 1 || values[i].bound == TimeBounded
+			values[i].known = values[i].known && !values[i].outside
+			if values[i].bound == TimeLowerBounded {
+				values[i].bound = TimeUpperBounded
+			} else if values[i].bound == TimeUpperBounded {
+				values[i].bound = TimeLowerBounded
+			}
+		}
+	}
+	return values
+}
+
+// timeValueAt reads the time at i, ending before stop: ago(1h), now(),
+// current_timestamp, from_milliseconds(n), from_nanoseconds(n),
+// from_unixtime(n), from_iso8601_timestamp('...') and date_add of them, each
+// optionally plus or minus intervals like 1h. It returns the index after the value.
+func timeValueAt(toks []token, i, stop int, now time.Time) (time.Time, int, bool) {
+	if i >= stop {
+		return time.Time{}, i, false
+	}
+	var at time.Time
+	name := toks[i].val
+	if toks[i].kind == tkIdent && name == "current_timestamp" {
+		at, i = now, i+1
+	} else {
+		if toks[i].kind != tkIdent || i+2 >= stop || toks[i+1].val != "(" {
+			return time.Time{}, i, false
+		}
+		argStart := i + 2
+		argEnd := argStart
+		for argEnd < stop && !(toks[argEnd].kind == tkSymbol && toks[argEnd].val == ")" && toks[argEnd].depth == toks[i].depth) {
+			argEnd++
+		}
+		if argEnd == stop {
+			return time.Time{}, i, false
+		}
+		args := toks[argStart:argEnd]
+		var ok bool
+		if at, ok = timeFunction(name, args, now); !ok {
+			return time.Time{}, i, false
+		}
+		i = argEnd + 1
+	}
+	// now() - 1h
+	for i+1 < stop && toks[i].kind == tkSymbol && (toks[i].val == "-" || toks[i].val == "+") {
+		d, next, ok := intervalAt(toks, i+1, stop)
+		if !ok {
+			return time.Time{}, i, false
+		}
+		if toks[i].val == "-" {
+			d = -d
+		}
+		at, i = at.Add(d), next
+	}
+	return at, i, true
+}
+
+// timeFunction evaluates a function returning a time with its arguments
+func timeFunction(name string, args []token, now time.Time) (time.Time, bool) {
+	switch name {
+	case "now":
+		return now, len(args) == 0
+	case "ago":
+		d, next, ok := intervalAt(args, 0, len(args))
+		return now.Add(-d), ok && next == len(args)
+	case "date_add":
+		return dateAdd(args, now)
+	}
+	// from_milliseconds(-1)
+	sign := ""
+	if len(args) == 2 && args[0].kind == tkSymbol && args[0].val == "-" {
+		sign, args = "-", args[1:]
+	}
+	if len(args) != 1 {
+		return time.Time{}, false
+	}
+	arg := args[0]
+	if name == "from_iso8601_timestamp" || name == "from_iso8601_date" {
+		if arg.kind != tkString || sign != "" {
+			return time.Time{}, false
+		}
+		value := unquoteString(arg.val)
+		for _, layout := range []string{time.RFC3339Nano, "2006-01-02T15:04:05", "2006-01-02"} {
+			if t, err := time.Parse(layout, value); err == nil {
+				return t, true
+			}
+		}
+		return time.Time{}, false
+	}
+	if arg.kind != tkNumber {
+		return time.Time{}, false
+	}
+	n, err := strconv.ParseInt(sign+arg.val, 10, 64)
+	if err != nil {
+		return time.Time{}, false
+	}
+	switch name {
+	case "from_milliseconds":
+		return time.UnixMilli(n), true
+	case "from_nanoseconds":
+		return time.Unix(0, n), true
+	case "from_unixtime":
+		return time.Unix(n, 0), true
+	}
+	return time.Time{}, false
+}
+
+// dateAdd evaluates the arguments of date_add('day', -1, now()), the units up
+// to a year are read
+func dateAdd(args []token, now time.Time) (time.Time, bool) {
+	if len(args) < 5 || args[0].kind != tkString || args[1].val != "," {
+		return time.Time{}, false
+	}
+	i, sign := 2, int64(1)
+	if args[i].kind == tkSymbol && (args[i].val == "-" || args[i].val == "+") {
+		if args[i].val == "-" {
+			sign = -1
+		}
+		i++
+	}
+	if i+2 >= len(args) || args[i].kind != tkNumber || args[i+1].val != "," {
+		return time.Time{}, false
+	}
+	n, err := strconv.ParseInt(args[i].val, 10, 64)
+	if err != nil {
+		return time.Time{}, false
+	}
+	at, end, ok := timeValueAt(args, i+2, len(args), now)
+	if !ok || end != len(args) {
+		return time.Time{}, false
+	}
+	n *= sign
+	unit := strings.ToLower(unquoteString(args[0].val))
+	size, ok := dateAddUnits[unit]
+	if !ok {
+		return time.Time{}, false
+	}
+	// amounts past the range of a time.Duration move the time as far as it goes
+	d, err := scaleInterval(n, size)
+	if err != nil {
+		d = longestInterval
+		if n < 0 {
+			d = -d
+		}
+		return at.Add(d), true
+	}
+	switch unit {
+	case "day":
+		return at.AddDate(0, 0, int(n)), true
+	case "week":
+		return at.AddDate(0, 0, 7*int(n)), true
+	case "month":
+		return at.AddDate(0, int(n), 0), true
+	case "quarter":
+		return at.AddDate(0, 3*int(n), 0), true
+	case "year":
+		return at.AddDate(int(n), 0, 0), true
+	}
+	return at.Add(d), true
+}
+
+// dateAddUnits are the units date_add reads, the calendar units by their longest
+// length
+var dateAddUnits = map[string]time.Duration{
+	"millisecond": time.Millisecond, "second": time.Second, "minute": time.Minute, "hour": time.Hour,
+	"day": 24 * time.Hour, "week": 7 * 24 * time.Hour, "month": 31 * 24 * time.Hour, "quarter": 92 * 24 * time.Hour, "year": 366 * 24 * time.Hour,
+}
+
+// intervalAt reads an interval literal like 30d, lexed as a number and a unit
+func intervalAt(toks []token, i, stop int) (time.Duration, int, bool) {
+	if i+1 >= stop || toks[i].kind != tkNumber || toks[i+1].kind != tkIdent || toks[i+1].pos != toks[i].end {
+		return 0, i, false
+	}
+	d, err := parseInterval(toks[i].val + toks[i+1].val)
+	if errors.Is(err, errIntervalOverflow) {
+		// longer than any window, not a bound that can't be read
+		return longestInterval, i + 2, true
+	}
+	return d, i + 2, err == nil
+}
+
+// longestInterval is the longest time.Duration, about 292 years
+const longestInterval = time.Duration(math.MaxInt64)
+
+// errIntervalOverflow is returned for intervals longer than longestInterval
+var errIntervalOverflow = errors.New("interval is longer than 292 years")
+
+// scaleInterval returns n times unit, errIntervalOverflow when it doesn't fit
+// a time.Duration
+func scaleInterval(n int64, unit time.Duration) (time.Duration, error) {
+	if n > math.MaxInt64/int64(unit) || n < math.MinInt64/int64(unit) {
+		return 0, errIntervalOverflow
+	}
+	return time.Duration(n) * unit, nil
+}
+
+var intervalPattern = regexp.MustCompile(`^(\d+)(ns|us|ms|s|m|h|d)$`)
+
+var intervalUnits = map[string]time.Duration{
+	"ns": time.Nanosecond, "us": time.Microsecond, "ms": time.Millisecond,
+	"s": time.Second, "m": time.Minute, "h": time.Hour, "d": 24 * time.Hour,
+}
+
+// parseInterval parses a Timestream interval literal, e.g. 7d or 90m
+func parseInterval(s string) (time.Duration, error) {
+	m := intervalPattern.FindStringSubmatch(strings.ToLower(strings.TrimSpace(s)))
+	if m == nil {
+		return 0, fmt.Errorf("expected an interval like 7d, 12h or 30m")
+	}
+	n, err := strconv.ParseInt(m[1], 10, 64)
+	if errors.Is(err, strconv.ErrRange) {
+		return 0, errIntervalOverflow
+	}
+	if err != nil {
+		return 0, err
+	}
+	return scaleInterval(n, intervalUnits[m[2]])
+}
+
+// formatInterval writes d in the largest unit dividing it, e.g. 30d or 36h
+func formatInterval(d time.Duration) string {
+	for _, unit := range []string{"d", "h", "m", "s"} {
+		if size := intervalUnits[unit]; d >= size && d%size == 0 {
+			return fmt.Sprintf("%d%s", d/size, unit)
+		}
+	}
+	return d.Round(time.Second).String()
+}
@@ -0,0 +1,112 @@
+package validator
+
+import (
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestValidate_TimeWindow(t *testing.T) {
+	t.Parallel()
+
+	opts := &Options{MaxTimeWindow: "7d", AllowMissingMeasure: true}
+	testcases := []struct {
+		desc   string
+		input  string
+		reason string
+	}{
+		{desc: "ago within", input: "SELECT * FROM db.t WHERE time > ago(7d)"},
+		{desc: "ago beyond", input: "SELECT * FROM db.t WHERE time > ago(30d)", reason: "WHERE clause reads 30d of time, more than the maximum of 7d"},
+		{desc: "upper bound", input: "SELECT * FROM db.t WHERE time > ago(30d) AND time < ago(25d)"},
+		{desc: "now minus interval", input: "SELECT * FROM db.t WHERE time >= now() - 36h AND time <= now()"},
+		{desc: "reversed", input: "SELECT * FROM db.t WHERE ago(9d) < time AND time < ago(1d)", reason: "WHERE clause reads 8d of time"},
+		{desc: "milliseconds within", input: "SELECT * FROM db.t WHERE time BETWEEN from_milliseconds(1700000000000) AND from_milliseconds(1700086400000)"},
+		{desc: "milliseconds beyond", input: "SELECT * FROM db.t WHERE time BETWEEN from_milliseconds(1700000000000) AND from_milliseconds(1702592000000)", reason: "WHERE clause reads 30d of time"},
+		{desc: "iso timestamps", input: "SELECT * FROM db.t WHERE time >= from_iso8601_timestamp('2024-01-01T00:00:00Z') AND time < from_iso8601_timestamp('2024-01-09T12:00:00Z')", reason: "WHERE clause reads 204h of time"},
+		{desc: "tightest bounds", input: "SELECT * FROM db.t WHERE time > ago(90d) AND time > ago(1d)"},
+		{desc: "no lower bound", input: "SELECT * FROM db.t WHERE time < ago(1d)", reason: "WHERE clause has no lower time bound, queries may read at most 7d"},
+		{desc: "OR branch", input: "SELECT * FROM db.t WHERE (time > ago(1h) AND host = 'a') OR (time > ago(14d) AND host = 'b')", reason: "an OR branch in WHERE clause reads 14d of time"},
+		{desc: "date_add", input: "SELECT * FROM db.t WHERE time > date_add('day', -30, now())", reason: "WHERE clause reads 30d of time"},
+		{desc: "negated", input: "SELECT * FROM db.t WHERE NOT time < ago(30d)", reason: "WHERE clause reads 30d of time"},
+		{desc: "mixed known and computed", input: "SELECT * FROM db.t WHERE time > ago(1d) AND time < (SELECT max(time) FROM db.u WHERE time > ago(1h))"},
+		{desc: "computed upper bound", input: "SELECT * FROM db.t WHERE time > ago(365d) AND time < (SELECT max(time) FROM db.u WHERE time > ago(1h))", reason: "WHERE clause reads 365d of time"},
+		{desc: "date_add upper bound", input: "SELECT * FROM db.t WHERE time > ago(365d) AND time < date_add('second', 0, now())", reason: "WHERE clause reads 365d of time"},
+		{desc: "computed lower bound", input: "SELECT * FROM db.t WHERE time > (SELECT min(time) FROM db.u WHERE time > ago(1h))", reason: "WHERE clause has a time range that can't be determined"},
+		{desc: "no time filter", input: "SELECT * FROM db.t WHERE host = 'a'", reason: "WHERE clause has no lower time bound"},
+		{desc: "overflowing days", input: "SELECT * FROM db.t WHERE time > ago(110000d)", reason: "WHERE clause reads"},
+		{desc: "overflowing hours", input: "SELECT * FROM db.t WHERE time > now() - 3000000h", reason: "WHERE clause reads"},
+		{desc: "overflowing int64", input: "SELECT * FROM db.t WHERE time > now() - 99999999999999999999d", reason: "WHERE clause reads"},
+		{desc: "overflowing date_add", input: "SELECT * FROM db.t WHERE time > date_add('hour', -3000000, now())", reason: "WHERE clause reads"},
+	}
+
+	for _, tc := range testcases {
+		tc := tc
+		t.Run(tc.desc, func(t *testing.T) {
+			t.Parallel()
+			valid, issues := Validate(tc.input, opts)
+			if tc.reason == "" {
+				if !valid {
+					t.Errorf("unexpected issues %+v", issues)
+				}
+				return
+			}
+			if valid || !slices.ContainsFunc(issues, func(i Issue) bool {
+				return i.Rule == RuleTimeWindow && i.Code == CodeTimeWindowTooWide && strings.HasPrefix(i.Reason, tc.reason)
+			}) {
+				t.Errorf("want an issue %q, got %v %+v", tc.reason, valid, issues)
+			}
+		})
+	}
+
+	if valid, issues := Validate("SELECT * FROM db.t WHERE time > ago(30d)", &Options{AllowMissingMeasure: true}); !valid {
+		t.Errorf("want any range without a maximum, got %+v", issues)
+	}
+}
+
+func TestRewrite_TimeWindow(t *testing.T) {
+	t.Parallel()
+
+	tr := TimeRange{From: time.Now().Add(-time.Hour), To: time.Now()}
+	opts := &Options{MaxTimeWindow: "7d", AllowMissingMeasure: true}
+	got, changed, err := Rewrite("SELECT * FROM db.t WHERE time > ago(30d)", tr, opts)
+	if err != nil || changed != 1 {
+		t.Fatalf("want the range of the query added, got %d %q %v", changed, got, err)
+	}
+	if valid, issues := Validate(got, opts); !valid {
+		t.Errorf("rewritten query is rejected: %+v", issues)
+	}
+}
+
+func TestParseInterval(t *testing.T) {
+	t.Parallel()
+
+	for s, want := range map[string]time.Duration{"7d": 7 * 24 * time.Hour, "12h": 12 * time.Hour, "90m": 90 * time.Minute, "500ms": 500 * time.Millisecond, " 1D ": 24 * time.Hour} {
+		if got, err := parseInterval(s); err != nil || got != want {
+			t.Errorf("%q: want %s, got %s %v", s, want, got, err)
+		}
+	}
+	for _, s := range []string{"", "7", "d", "1.5h", "7 days", "-1d"} {
+		if _, err := parseInterval(s); err == nil {
+			t.Errorf("%q: want an error", s)
+		}
+	}
+	for _, s := range []string{"110000d", "3000000h", "99999999999999999999d"} {
+		if _, err := parseInterval(s); !errors.Is(err, errIntervalOverflow) {
+			t.Errorf("%q: want errIntervalOverflow, got %v", s, err)
+		}
+	}
+	for d, want := range map[time.Duration]string{30 * 24 * time.Hour: "30d", 36 * time.Hour: "36h", 90 * time.Minute: "90m", 1500 * time.Millisecond: "2s"} {
+		if got := formatInterval(d); got != want {
+			t.Errorf("%s: want %s, got %s", d, want, got)
+		}
+	}
+
+	var configErr *ConfigError
+	for _, value := range []string{"a week", "0d", "110000d"} {
+		if _, err := (&Options{MaxTimeWindow: value}).Compile(); !errors.As(err, &configErr) || configErr.Field != "maxTimeWindow" {
+			t.Errorf("%q: want an error of maxTimeWindow, got %v", value, err)
+		}
+	}
+}
@@ -14,14 +14,23 @@ package validator
 //     are validated separately.
 //   - Each such SELECT needs to have both a valid time and a valid measure_name filter.
 //   - A valid time filter is any predicate in WHERE that references one of
-//     the allowed time columns (default: time, measure_time) and uses BETWEEN
+//     the allowed time columns (default: time, see Options.TimeColumns) and uses BETWEEN
 //     (with optional NOT) or comparison operators (=, <, <=, >, >=, <>, !=).
 //   - For measure_name, we are more restrictive: all occurrences of it have to be valid
-//     conditions (e.g., measure_name = 'foo' or regexp_like(measure_name, '...')).
+//     conditions (e.g., measure_name = 'foo', measure_name IN ('foo', 'bar') or
+//     regexp_like(measure_name, '...')).
+//
+// Each rule is a Check over the SELECT; further checks can be added with
+// Options.Checks.
 //
 // Note: This is intentionally heuristic and aims to be practical for Timestream.
+// Options.Parser selects an opt-in parser building a syntax tree instead, which
+// checks every table of a SELECT; the heuristics remain its fallback.
 
 import (
+	"iter"
+	"maps"
+	"slices"
 	"strings"
 	"unicode"
 )
@@ -30,131 +39,453 @@ type Issue struct {
 	Snippet string
 	Reason  string
 	AtDepth int
+	// Start and End are the byte offsets of the offending SELECT in the SQL
+	Start, End int
+	// Rule is the check reporting the issue, empty for invalid options
+	Rule Rule
+	// Code identifies the kind of issue, e.g. for callers branching on it
+	// instead of matching Reason
+	Code IssueCode
+	// Severity is warning for rules configured as warnings
+	Severity Severity
+	// TimeBound is the weakest time filter of the WHERE branches, set for
+	// time filter issues
+	TimeBound TimeBound
+	// Fix suggests how to resolve issues with a common cause
+	Fix string
+	// Waiver is the reason of the comment directive relaxing the issue to a
+	// warning, see Directive
+	Waiver string
 }
 
+// Rule names a check of the validator
+type Rule string
+
+const (
+	RuleWhere                  Rule = "where"
+	RuleTime                   Rule = "time"
+	RuleBoundedTime            Rule = "bounded-time"
+	RuleTimeWindow             Rule = "time-window"
+	RuleMeasure                Rule = "measure"
+	RuleTenant                 Rule = "tenant"
+	RuleNegatedDimensionFilter Rule = "negated-dimension-filter"
+	RuleMeasurePattern         Rule = "measure-pattern"
+	RuleRequiredColumn         Rule = "required-column"
+	RuleUnknownDimension       Rule = "unknown-dimension"
+)
+
+var rules = map[Rule]bool{
+	RuleWhere: true, RuleTime: true, RuleBoundedTime: true, RuleTimeWindow: true, RuleMeasure: true, RuleTenant: true, RuleNegatedDimensionFilter: true, RuleMeasurePattern: true, RuleRequiredColumn: true,
+	RuleUnknownDimension: true,
+}
+
+// Rules returns every rule of the validator, in name order
+func Rules() []Rule {
+	return slices.Sorted(maps.Keys(rules))
+}
+
+// IssueCode identifies the kind of an issue. Unlike Reason, which names the
+// columns and tables involved, codes are stable. A rule reports several kinds
+// of issues, e.g. RuleMeasure reports CodeInvalidMeasurePredicate and
+// CodeNegatedMeasureLike.
+type IssueCode string
+
+const (
+	CodeInvalidOptions IssueCode = "invalid-options"
+	CodeMissingWhere   IssueCode = "missing-where"
+	// CodeWhereTooComplex is a WHERE clause with more OR branches than the
+	// validator expands, its filters can't be checked
+	CodeWhereTooComplex      IssueCode = "where-too-complex"
+	CodeMissingTimePredicate IssueCode = "missing-time-predicate"
+	CodeUnboundedTime        IssueCode = "unbounded-time"
+	CodeTimeWindowTooWide    IssueCode = "time-window-too-wide"
+	// CodeTautologicalTimePredicate is a time filter restricting nothing, e.g.
+	// time > from_milliseconds(0)
+	CodeTautologicalTimePredicate IssueCode = "tautological-time-predicate"
+	CodeInvalidMeasurePredicate   IssueCode = "invalid-measure-predicate"
+	CodeNegatedMeasureLike        IssueCode = "negated-measure-like"
+	CodeInvalidMeasurePattern     IssueCode = "invalid-measure-pattern"
+	CodeBroadMeasurePattern       IssueCode = "broad-measure-pattern"
+	CodeMissingTenant             IssueCode = "missing-tenant"
+	CodeMissingRequiredColumn     IssueCode = "missing-required-column"
+	CodeRejectedRequiredValue     IssueCode = "rejected-required-value"
+	CodeNegatedDimensionFilter    IssueCode = "negated-dimension-filter"
+	// CodeOrBranchUnfiltered is a filter the WHERE clause has, but not in
+	// every OR branch
+	CodeOrBranchUnfiltered IssueCode = "or-branch-unfiltered"
+	CodeUnknownDimension   IssueCode = "unknown-dimension"
+)
+
+// Severity tells whether an issue rejects the query
+type Severity string
+
+const (
+	SeverityError   Severity = "error"
+	SeverityWarning Severity = "warning"
+)
+
+// RuleLevel configures whether the issues of a rule reject queries
+type RuleLevel string
+
+const (
+	LevelError RuleLevel = "error"
+	LevelWarn  RuleLevel = "warn"
+	// LevelOff disables the rule, it reports no issues
+	LevelOff RuleLevel = "off"
+)
+
+// TimeBound classifies how a WHERE clause restricts the time column.
+type TimeBound string
+
+const (
+	TimeUnbounded    TimeBound = "unbounded"
+	TimeLowerBounded TimeBound = "lower"
+	TimeUpperBounded TimeBound = "upper"
+	TimeBounded      TimeBound = "bounded"
+)
+
+// with combines the bounds of two conjunct predicates.
+func (b TimeBound) with(other TimeBound) TimeBound {
+	switch {
+	case b == other || other == TimeUnbounded:
+		return b
+	case b == TimeUnbounded:
+		return other
+	}
+	return TimeBounded
+}
+
+// or combines the bounds of two disjunct predicates, the weaker one holds.
+func (b TimeBound) or(other TimeBound) TimeBound {
+	switch {
+	case b == other || other == TimeBounded:
+		return b
+	case b == TimeBounded:
+		return other
+	}
+	return TimeUnbounded
+}
+
+// negate returns the bound of NOT applied to a predicate with the bound.
+func (b TimeBound) negate() TimeBound {
+	switch b {
+	case TimeLowerBounded:
+		return TimeUpperBounded
+	case TimeUpperBounded:
+		return TimeLowerBounded
+	}
+	return TimeUnbounded
+}
+
+// Options tunes the checks applied by Validate. A nil *Options applies the
+// defaults, which are the strictest settings.
+type Options struct {
+	// AllowMissingMeasure skips the measure_name requirement, e.g. for
+	// tables that only ever hold a single measure.
+	AllowMissingMeasure bool `json:"allowMissingMeasure,omitempty"`
+
+	// TenantDimension, when set, requires an equality predicate on this
+	// column (e.g. ds_account = '...') with the same OR-branch semantics as
+	// the time predicate.
+	TenantDimension string `json:"tenantDimension,omitempty"`
+	// TenantTables limits the tenant rule to these tables ("db.table" or just
+	// "table"), which may be glob patterns like "metrics_*". Empty means every
+	// table.
+	TenantTables []string `json:"tenantTables,omitempty"`
+
+	// RequirePositiveDimensionFilter rejects WHERE branches whose dimension
+	// predicates are only negations (!=, <>, NOT IN, NOT LIKE), since those
+	// still scan nearly everything. At least one equality, IN or LIKE-prefix
+	// condition is required once a dimension is filtered.
+	RequirePositiveDimensionFilter bool `json:"requirePositiveDimensionFilter,omitempty"`
+
+	// AllowComputedMeasure accepts measure_name compared with a function
+	// call of no column, a scalar subquery or a bound parameter (?), e.g. for
+	// dashboards looking up the measure in a CTE.
+	AllowComputedMeasure bool `json:"allowComputedMeasure,omitempty"`
+
+	// AllowMeasureLike accepts measure_name LIKE 'prefix%' as a measure filter.
+	// Patterns need a literal prefix unless AllowAnyMeasurePattern is set.
+	AllowMeasureLike bool `json:"allowMeasureLike,omitempty"`
+
+	// MeasureWrappers lists the functions measure_name may be wrapped in when
+	// compared with a literal, e.g. lower(measure_name) = 'cpu'. Defaults to
+	// lower and upper.
+	MeasureWrappers []string `json:"measureWrappers,omitempty"`
+
+	// AllowAnyMeasurePattern accepts regexp_like(measure_name, '...') patterns
+	// that are unanchored without a literal prefix or match every measure,
+	// like '.*'.
+	AllowAnyMeasurePattern bool `json:"allowAnyMeasurePattern,omitempty"`
+
+	// BoundedTimeTables lists tables (same format as TenantTables) whose
+	// queries must bound time on both sides, e.g. BETWEEN or time >= ... AND
+	// time < .... Other tables accept a lower bound like time >= ago(1h).
+	BoundedTimeTables []string `json:"boundedTimeTables,omitempty"`
+
+	// MaxTimeWindow is the longest time range queries may read, as an interval
+	// like 7d. Ranges are read from bounds like ago(30d) or BETWEEN
+	// from_milliseconds(a) AND from_milliseconds(b), ranges without such a
+	// lower bound are rejected. Empty allows any range.
+	MaxTimeWindow string `json:"maxTimeWindow,omitempty"`
+
+	// TimeLookback is how far back the tables hold data, as an interval like
+	// 365d, e.g. their retention. A time filter starting before it restricts
+	// nothing. Empty counts filters starting before 2000 as restricting nothing.
+	TimeLookback string `json:"timeLookback,omitempty"`
+
+	// TimeColumns lists the columns accepted as the time filter, e.g. a
+	// custom time attribute like measure_time. Defaults to time.
+	TimeColumns []string `json:"timeColumns,omitempty"`
+
+	// RequiredColumns are further columns every WHERE branch of the queries of
+	// their tables has to filter, optionally with a restricted set of values,
+	// e.g. releasegroup being one of stable, canary or alpha.
+	RequiredColumns []RequiredColumn `json:"requiredColumns,omitempty"`
+
+	// WarningRules reports the issues of these rules as warnings, which
+	// don't reject the query, e.g. while rolling out a new rule.
+	WarningRules []Rule `json:"warningRules,omitempty"`
+
+	// RuleLevels sets rules to LevelError, LevelWarn or LevelOff, overriding
+	// WarningRules. Unknown dimensions are found after validation and are
+	// warnings unless turned off.
+	RuleLevels map[Rule]RuleLevel `json:"ruleLevels,omitempty"`
+
+	// Parser selects how queries are read, ParserHeuristic by default.
+	// ParserAST parses them into a syntax tree, which finds every table of
+	// joins and the exact extent of WHERE; queries it can't parse are checked
+	// heuristically.
+	Parser string `json:"parser,omitempty"`
+
+	// DirectiveRules lists the rules comment directives may relax for their
+	// statement, e.g. -- ts:allow-missing-measure reason="aggregated rollup".
+	// Directives of other rules are ignored.
+	DirectiveRules []Rule `json:"directiveRules,omitempty"`
+
+	// Checks are further rules run after the built-in ones, e.g. requiring a
+	// company-specific filter. Their rule names must be unique; they can be
+	// configured in WarningRules and RuleLevels like the built-in rules.
+	Checks []Check `json:"-"`
+}
+
+// The parsers of Options.Parser
+const (
+	ParserHeuristic = "heuristic"
+	ParserAST       = "ast"
+)
+
 // Validate returns true if every SELECT that directly reads from a table
 // has a WHERE time filter; otherwise returns false and the list of issues.
-func Validate(sql string) (bool, []Issue) {
-	src := stripComments(sql)
-	toks := lex(src)
+// Issues of warning rules are returned without rejecting the query, rules
+// turned off report none.
+// Invalid options are reported as an issue; callers validating repeatedly
+// should Compile the options once instead.
+func Validate(sql string, opts *Options) (bool, []Issue) {
+	c, err := opts.Compile()
+	if err != nil {
+		return false, []Issue{{Reason: err.Error(), Severity: SeverityError, Code: CodeInvalidOptions}}
+	}
+	return c.Validate(sql)
+}
 
-	type sel struct {
-		selIdx int
-		depth  int
+// Validate checks sql against the compiled options, see the package level Validate.
+func (c *Compiled) Validate(sql string) (bool, []Issue) {
+	// statements without a SELECT, e.g. SHOW, read no table and need no tokens
+	if !containsKeyword(sql, "select") {
+		return true, nil
 	}
-	var selects []sel
-	for i := 0; i < len(toks); i++ {
-		if toks[i].kind == tkKeyword && toks[i].val == "select" {
-			selects = append(selects, sel{selIdx: i, depth: toks[i].depth})
-		}
+	toks := lex(sql)
+	var issues []Issue
+	for _, s := range c.scopes(toks) {
+		issues = append(issues, c.checkSelect(sql, toks, s)...)
 	}
+	return c.verdict(c.waive(sql, toks, issues))
+}
 
-	var issues []Issue
+// verdict drops the issues of rules turned off and sets the severity of the
+// rest, waived issues are warnings. The query is valid without errors.
+func (c *Compiled) verdict(issues []Issue) (bool, []Issue) {
+	issues = slices.DeleteFunc(issues, func(issue Issue) bool { return c.off[issue.Rule] })
 
-	for _, s := range selects {
-		// Find FROM at same depth after this SELECT.
-		fromIdx := findNextKeywordAtDepth(toks, s.selIdx+1, s.depth, "from")
-		if fromIdx == -1 {
-			// SELECT without FROM (e.g., SELECT 1): ignore (doesn't hit DB).
-			continue
+	valid := true
+	for i := range issues {
+		issues[i].Severity = SeverityError
+		if c.warnings[issues[i].Rule] || issues[i].Waiver != "" {
+			issues[i].Severity = SeverityWarning
+		} else {
+			valid = false
 		}
+	}
+	return valid, issues
+}
 
-		// FROM clause ends at next clause keyword (excluding WHERE) or when depth drops.
-		stopIdx := findNextTerminatorAtDepth(toks, fromIdx+1, s.depth)
-
-		// Decide if this SELECT directly reads from a base table (not subquery or CTE alias).
-		hitsDB := fromStartsWithBaseTable(toks, fromIdx+1, stopIdx, s.depth)
-		if !hitsDB {
-			// Outer SELECT over CTE/derived table — inner SELECTs will be validated separately.
-			continue
+// scopes finds the SELECTs reading from a table with the parser of the options
+func (c *Compiled) scopes(toks []token) []selectScope {
+	if c.opts.Parser == ParserAST {
+		if scopes, parsed := astScopes(toks); parsed {
+			return scopes
 		}
+	}
+	return heuristicScopes(toks)
+}
 
-		// WHERE must be present at same depth between FROM and its terminator.
-		whereIdx := findNextKeywordBetweenAtDepth(toks, fromIdx+1, stopIdx, s.depth, "where")
-		if whereIdx == -1 {
-			issues = append(issues, Issue{
-				Snippet: snippetAroundTokens(toks, s.selIdx, stopIdx),
-				Reason:  "missing WHERE clause",
-				AtDepth: s.depth,
-			})
-			continue
+// selectScope is a SELECT reading from tables, with the token indexes of its
+// clauses as found by the heuristics or the parser.
+type selectScope struct {
+	selIdx, depth int
+	// fromIdx is the FROM of the SELECT, stopIdx ends its clause
+	fromIdx, stopIdx int
+	// whereIdx is the WHERE of the SELECT, -1 without one, whereStop ends it
+	whereIdx, whereStop int
+	// tables are the "db.table" names the SELECT reads
+	tables []string
+	// branches are the OR branches of WHERE, tooComplex is set when they
+	// couldn't all be expanded
+	branches   [][][2]int
+	tooComplex bool
+}
+
+// heuristicScopes finds the SELECTs reading from a table by scanning the tokens.
+func heuristicScopes(toks []token) []selectScope {
+	var scopes []selectScope
+	for selIdx := range toks {
+		if s, ok := heuristicScope(toks, selIdx); ok {
+			scopes = append(scopes, s)
 		}
+	}
+	return scopes
+}
 
-		// WHERE body ends at next clause (group/order/having/union/...) or on depth drop.
-		whereStop := findNextTerminatorAtDepth(toks, whereIdx+1, s.depth)
+// heuristicScope finds the clauses of the SELECT at selIdx, reading only the
+// tokens up to the end of its enclosing parentheses. It reports false for
+// other tokens and SELECTs not reading from a table.
+func heuristicScope(toks []token, selIdx int) (selectScope, bool) {
+	if toks[selIdx].kind != tkKeyword || toks[selIdx].val != "select" {
+		return selectScope{}, false
+	}
+	depth := toks[selIdx].depth
 
-		// Logic to handle top-level ORs
-		branches := findTopLevelOrBranches(toks, whereIdx+1, whereStop, s.depth)
+	// Find FROM at same depth after this SELECT.
+	fromIdx := findNextKeywordAtDepth(toks, selIdx+1, depth, "from")
+	if fromIdx == -1 {
+		// SELECT without FROM (e.g., SELECT 1): ignore (doesn't hit DB).
+		return selectScope{}, false
+	}
 
-		hasMissingTime := false
-		hasMissingMeasure := false
-		hasInvalidOr := len(branches) > 1
+	// FROM clause ends at next clause keyword (excluding WHERE) or when depth drops.
+	stopIdx := findNextTerminatorAtDepth(toks, fromIdx+1, depth)
 
-		for _, branch := range branches {
-			branchStart, branchStop := branch[0], branch[1]
+	// Decide if this SELECT directly reads from a base table (not subquery or CTE alias).
+	hitsDB := fromStartsWithBaseTable(toks, fromIdx+1, stopIdx, depth)
+	if !hitsDB {
+		// Outer SELECT over CTE/derived table — inner SELECTs will be validated separately.
+		return selectScope{}, false
+	}
 
-			// Check for time predicate.
-			if !whereHasTimePredicate(toks, branchStart, branchStop) {
-				hasMissingTime = true
-			}
+	s := selectScope{
+		selIdx:   selIdx,
+		depth:    depth,
+		fromIdx:  fromIdx,
+		stopIdx:  stopIdx,
+		whereIdx: -1,
+		tables:   []string{baseTableName(toks, fromIdx+1, stopIdx, depth)},
+	}
+	// WHERE must be present at same depth between FROM and its terminator.
+	if whereIdx := findNextKeywordBetweenAtDepth(toks, fromIdx+1, stopIdx, depth, "where"); whereIdx != -1 {
+		// WHERE body ends at next clause (group/order/having/union/...) or on depth drop.
+		s.whereIdx, s.whereStop = whereIdx, findNextTerminatorAtDepth(toks, whereIdx+1, depth)
+		// Every OR branch of the WHERE expression must filter on its own, also
+		// an OR nested in parentheses: (a OR b) AND c has the branches a AND c
+		// and b AND c.
+		var complete bool
+		s.branches, complete = parseBoolExpr(toks, whereIdx+1, s.whereStop).branches()
+		s.tooComplex = !complete
+	}
+	return s, true
+}
 
-			// Check for measure_name predicate
-			if !whereHasMeasureNamePredicate(toks, branchStart, branchStop) {
-				hasMissingMeasure = true
-			}
+// astScopes finds the SELECTs reading from a table in the syntax tree of the
+// query. Unlike the heuristics it finds the tables of every join, e.g. after a
+// CTE. It reports false when the query can't be parsed.
+func astScopes(toks []token) ([]selectScope, bool) {
+	selects, err := parseQueries(toks)
+	if err != nil {
+		return nil, false
+	}
+	var scopes []selectScope
+	for _, sel := range selects {
+		s := selectScope{
+			selIdx:    sel.selIdx,
+			depth:     toks[sel.selIdx].depth,
+			fromIdx:   sel.fromIdx,
+			stopIdx:   sel.fromStop,
+			whereIdx:  sel.whereIdx,
+			whereStop: sel.whereStop,
 		}
-
-		// Report issues.
-		if hasMissingTime {
-			reason := "WHERE clause lacks a time predicate"
-			if hasInvalidOr {
-				reason = "an OR branch in WHERE clause lacks a time predicate"
+		for _, src := range sel.sources {
+			if src.table != "" {
+				s.tables = append(s.tables, src.table)
 			}
-			issues = append(issues, Issue{
-				Snippet: snippetAroundTokens(toks, s.selIdx, whereStop),
-				Reason:  reason,
-				AtDepth: s.depth,
-			})
 		}
+		if len(s.tables) == 0 {
+			continue
+		}
+		if sel.where != nil {
+			var complete bool
+			s.branches, complete = sel.where.boolTree(toks).branches()
+			s.tooComplex = !complete
+		}
+		scopes = append(scopes, s)
+	}
+	return scopes, true
+}
 
-		if hasMissingMeasure {
-			reason := "WHERE clause lacks a valid measure_name predicate (requires = '...' or regexp_like)"
-			if hasInvalidOr {
-				reason = "an OR branch in WHERE clause lacks a valid measure_name predicate (requires = '...' or regexp_like)"
+// checkSelect runs the checks for a SELECT reading from tables.
+func (c *Compiled) checkSelect(sql string, toks []token, s selectScope) []Issue {
+	sel := &Select{c: c, sql: sql, toks: toks, scope: s}
+	var issues []Issue
+	for _, check := range c.checks {
+		if _, where := check.(whereCheck); !where && !sel.HasWhere() {
+			continue
+		}
+		for _, issue := range check.CheckSelect(sel) {
+			if issue.End == 0 {
+				issue.Snippet = snippetAroundTokens(sql, toks, s.selIdx, s.whereIdx, s.whereStop)
+				issue.Start = startOffset(toks, s.selIdx)
+				issue.End = endOffset(toks, s.whereStop)
+			}
+			issue.AtDepth = s.depth
+			if issue.Rule == "" {
+				issue.Rule = check.Rule()
 			}
-			issues = append(issues, Issue{
-				Snippet: snippetAroundTokens(toks, s.selIdx, whereStop),
-				Reason:  reason,
-				AtDepth: s.depth,
-			})
+			if issue.Code == "" {
+				issue.Code = IssueCode(check.Rule())
+			}
+			issues = append(issues, issue)
 		}
 	}
-
-	return len(issues) == 0, issues
+	return issues
 }
 
-// NEW FUNCTION: Splits a token range by top-level OR keywords.
-func findTopLevelOrBranches(toks []token, start, stop, depth int) [][2]int {
-	var branches [][2]int
-	currentBranchStart := start
+// Errors returns the issues that reject the query
+func Errors(issues []Issue) []Issue {
+	return filterSeverity(issues, SeverityError)
+}
 
-	if stop < 0 {
-		stop = len(toks)
-	}
+// Warnings returns the issues reported for rules configured as warnings
+func Warnings(issues []Issue) []Issue {
+	return filterSeverity(issues, SeverityWarning)
+}
 
-	for i := start; i < stop && i < len(toks); i++ {
-		// If we find an 'OR' at the same depth, it's a separator.
-		if toks[i].depth == depth && toks[i].kind == tkKeyword && toks[i].val == "or" {
-			// Add the branch ending just before this 'OR'
-			branches = append(branches, [2]int{currentBranchStart, i})
-			// Start the next branch just after this 'OR'
-			currentBranchStart = i + 1
+func filterSeverity(issues []Issue, severity Severity) []Issue {
+	var out []Issue
+	for _, issue := range issues {
+		if issue.Severity == severity {
+			out = append(out, issue)
 		}
 	}
-	// Add the final branch (or the only branch, if no 'OR' was found)
-	branches = append(branches, [2]int{currentBranchStart, stop})
-
-	return branches
+	return out
 }
 
 /* -------------------- internal: lexer & helpers -------------------- */
@@ -173,6 +504,11 @@ type token struct {
 	val   string
 	kind  tokenKind
 	depth int
+	pos   int // byte offset of the token in the source
+	end   int // byte offset just past the token
+	// caseDepth counts the CASE ... END expressions enclosing the token,
+	// predicates within them don't filter rows
+	caseDepth int
 }
 
 var keywords = map[string]struct{}{
@@ -182,134 +518,63 @@ var keywords = map[string]struct{}{
 	"between": {}, "and": {}, "or": {}, "not": {}, "in": {}, "exists": {},
 }
 
+// stripComments blanks out comments with spaces (keeping newlines), so
+// token offsets still point into the original text.
 func stripComments(s string) string {
-	var b strings.Builder
-	b.Grow(len(s))
-	inLine, inBlock := false, false
-	for i := 0; i < len(s); i++ {
-		if inLine {
-			if s[i] == '\n' {
-				inLine = false
-				b.WriteByte(s[i])
-			}
-			continue
+	var b []byte
+	for start, end := range comments(s) {
+		if b == nil {
+			b = []byte(s)
 		}
-		if inBlock {
-			if s[i] == '*' && i+1 < len(s) && s[i+1] == '/' {
-				inBlock = false
-				i++
+		for i := start; i < end; i++ {
+			if b[i] != '\n' {
+				b[i] = ' '
 			}
-			continue
-		}
-		if s[i] == '-' && i+1 < len(s) && s[i+1] == '-' {
-			inLine = true
-			i++
-			continue
 		}
-		if s[i] == '/' && i+1 < len(s) && s[i+1] == '*' {
-			inBlock = true
-			i++
-			continue
-		}
-		b.WriteByte(s[i])
 	}
-	return b.String()
+	if b == nil {
+		return s
+	}
+	return string(b)
 }
 
-func lex(s string) []token {
-	var out []token
-	depth := 0
-
-	readString := func(i int, quote byte) (string, int) {
-		j := i + 1
-		for j < len(s) {
-			if s[j] == quote {
-				// handle escaped '' or "" inside literals/quoted idents
-				if j+1 < len(s) && s[j+1] == quote {
-					j += 2
-					continue
+// comments yields the byte ranges of the comments of s, including their
+// markers. A line comment ends before its newline.
+func comments(s string) iter.Seq2[int, int] {
+	return func(yield func(int, int) bool) {
+		for i := 0; i < len(s); i++ {
+			switch {
+			// comment markers within literals and quoted identifiers are text
+			case s[i] == '\'' || s[i] == '"':
+				j := i + 1
+				for j < len(s) && (s[j] != s[i] || (j+1 < len(s) && s[j+1] == s[i])) {
+					if s[j] == s[i] {
+						j++
+					}
+					j++
 				}
-				return s[i : j+1], j + 1
-			}
-			j++
-		}
-		return s[i:], len(s)
-	}
-
-	for i := 0; i < len(s); {
-		r := s[i]
-		// whitespace
-		if unicode.IsSpace(rune(r)) {
-			i++
-			continue
-		}
-		// parentheses adjust depth
-		if r == '(' {
-			out = append(out, token{val: "(", kind: tkSymbol, depth: depth})
-			depth++
-			i++
-			continue
-		}
-		if r == ')' {
-			depth--
-			if depth < 0 {
-				depth = 0
-			}
-			out = append(out, token{val: ")", kind: tkSymbol, depth: depth})
-			i++
-			continue
-		}
-		// strings / quoted identifiers
-		if r == '\'' || r == '"' {
-			str, nx := readString(i, r)
-			if r == '"' {
-				// treat "ident" as identifier (lowercased, quotes kept for context)
-				out = append(out, token{val: strings.ToLower(str), kind: tkIdent, depth: depth})
-			} else {
-				out = append(out, token{val: str, kind: tkString, depth: depth})
-			}
-			i = nx
-			continue
-		}
-		// numbers
-		if isNumStart(r) {
-			j := i + 1
-			for j < len(s) && (isNum(s[j]) || s[j] == '.') {
-				j++
-			}
-			out = append(out, token{val: s[i:j], kind: tkNumber, depth: depth})
-			i = j
-			continue
-		}
-		// identifiers / keywords
-		if isIdentStart(r) {
-			j := i + 1
-			for j < len(s) && isIdentPart(s[j]) {
-				j++
-			}
-			word := strings.ToLower(s[i:j])
-			if _, ok := keywords[word]; ok {
-				out = append(out, token{val: word, kind: tkKeyword, depth: depth})
-			} else {
-				out = append(out, token{val: word, kind: tkIdent, depth: depth})
-			}
-			i = j
-			continue
-		}
-		// multi-char operators (>=, <=, <>, !=)
-		if (r == '>' || r == '<' || r == '!') && i+1 < len(s) {
-			n := s[i+1]
-			if (r == '>' && n == '=') || (r == '<' && (n == '=' || n == '>')) || (r == '!' && n == '=') {
-				out = append(out, token{val: strings.ToLower(s[i : i+2]), kind: tkSymbol, depth: depth})
-				i += 2
-				continue
+				i = min(j+1, len(s)) - 1
+			case s[i] == '-' && i+1 < len(s) && s[i+1] == '-':
+				end := len(s)
+				if nl := strings.IndexByte(s[i:], '\n'); nl != -1 {
+					end = i + nl
+				}
+				if !yield(i, end) {
+					return
+				}
+				i = end - 1
+			case s[i] == '/' && i+1 < len(s) && s[i+1] == '*':
+				end := len(s)
+				if close := strings.Index(s[i+2:], "*/"); close != -1 {
+					end = i + 2 + close + 2
+				}
+				if !yield(i, end) {
+					return
+				}
+				i = end - 1
 			}
 		}
-		// single-char symbols
-		out = append(out, token{val: strings.ToLower(string(r)), kind: tkSymbol, depth: depth})
-		i++
 	}
-	return out
 }
 
 // identifiers start with letter, '_' or '$' (keeping '$' support harmless)
@@ -366,6 +631,10 @@ func findNextTerminatorAtDepth(toks []token, start, depth int) int {
 				return i
 			}
 		}
+		// LIMIT and OFFSET are lexed as identifiers, ; ends the statement
+		if toks[i].depth == depth && ((toks[i].kind == tkIdent && (toks[i].val == "limit" || toks[i].val == "offset")) || (toks[i].kind == tkSymbol && toks[i].val == ";")) {
+			return i
+		}
 	}
 	return len(toks)
 }
@@ -456,14 +725,148 @@ func fromStartsWithBaseTable(toks []token, start, stop, depth int) bool {
 
 	return false
 }
-func whereHasTimePredicate(toks []token, start, stop int) bool {
+
+// baseTableName returns the lowercased, unquoted "db.table" name of the first
+// FROM source at this depth, or "" if none is found.
+func baseTableName(toks []token, start, stop, depth int) string {
+	var parts []string
+	expectIdent := true
+	for i := start; i < stop && i < len(toks); i++ {
+		if toks[i].depth != depth {
+			continue
+		}
+		switch {
+		case expectIdent && toks[i].kind == tkIdent:
+			parts = append(parts, strings.ReplaceAll(toks[i].val, `"`, ""))
+			expectIdent = false
+		case !expectIdent && toks[i].kind == tkSymbol && toks[i].val == ".":
+			expectIdent = true
+		case len(parts) > 0:
+			return strings.Join(parts, ".")
+		}
+	}
+	return strings.Join(parts, ".")
+}
+
+// whereHasEqualityPredicate reports whether column = 'literal' appears in the
+// range, not under a NOT.
+func whereHasEqualityPredicate(toks []token, start, stop int, column string) bool {
+	if stop < 0 {
+		stop = len(toks)
+	}
+	column = strings.ToLower(column)
+	for i := start; i+2 < stop && i+2 < len(toks); i++ {
+		if toks[i].kind != tkIdent || toks[i].caseDepth > 0 {
+			continue
+		}
+		name := strings.ReplaceAll(toks[i].val, `"`, "")
+		if name != column && !strings.HasSuffix(name, "."+column) {
+			continue
+		}
+		if toks[i+1].kind == tkSymbol && toks[i+1].val == "=" && toks[i+2].kind == tkString && !negatedAt(toks, start, i) {
+			return true
+		}
+	}
+	return false
+}
+
+// whereHasOnlyNegatedDimensionFilters reports whether the predicates of an OR
+// branch filter dimension columns, but only through negated conditions.
+func whereHasOnlyNegatedDimensionFilters(toks []token, branch [][2]int) bool {
+	hasPositive, hasNegative := false, false
+	for _, p := range branch {
+		positive, negative := dimensionFilters(toks, p[0], p[1])
+		hasPositive, hasNegative = hasPositive || positive, hasNegative || negative
+	}
+	return hasNegative && !hasPositive
+}
+
+// dimensionFilters reports whether the range filters dimension columns by
+// including values and by excluding values.
+func dimensionFilters(toks []token, start, stop int) (bool, bool) {
+	if stop < 0 {
+		stop = len(toks)
+	}
+	hasPositive, hasNegative := false, false
+	for i := start; i+1 < stop && i+1 < len(toks); i++ {
+		if toks[i].kind != tkIdent || toks[i].caseDepth > 0 || !isDimensionIdentifierAt(toks, i) {
+			continue
+		}
+		next := toks[i+1]
+		switch {
+		case next.kind == tkSymbol && next.val == "=":
+			hasPositive = true
+		case next.kind == tkSymbol && (next.val == "!=" || next.val == "<>"):
+			hasNegative = true
+		case next.kind == tkKeyword && next.val == "in":
+			hasPositive = true
+		case next.kind == tkIdent && next.val == "like":
+			if i+2 < stop && i+2 < len(toks) && toks[i+2].kind == tkString && !strings.HasPrefix(toks[i+2].val, "'%") {
+				hasPositive = true
+			}
+		case next.kind == tkKeyword && next.val == "not":
+			if i+2 < stop && i+2 < len(toks) && (toks[i+2].val == "in" || toks[i+2].val == "like") {
+				hasNegative = true
+			}
+		}
+	}
+	return hasPositive, hasNegative
+}
+
+// isDimensionIdentifierAt reports whether the identifier at i is a plain
+// column reference other than time, measure_name and measure_value.
+func isDimensionIdentifierAt(toks []token, i int) bool {
+	if isTimeIdentifierAt(toks, i) {
+		return false
+	}
+	if i+1 < len(toks) && toks[i+1].kind == tkSymbol && toks[i+1].val == "(" {
+		return false
+	}
+	// type name of a cast such as measure_value::double
+	if i > 0 && toks[i-1].kind == tkSymbol && toks[i-1].val == ":" {
+		return false
+	}
+	name := strings.ReplaceAll(toks[i].val, `"`, "")
+	if idx := strings.LastIndex(name, "."); idx >= 0 {
+		name = name[idx+1:]
+	}
+	return name != "measure_name" && !strings.HasPrefix(name, "measure_value") && name != "like"
+}
+
+// negatedAt reports whether the token at i is under a NOT of the predicate
+// starting at start, like a in NOT a = 'x' or NOT (a = 'x' AND b = 'y'). Such a
+// predicate excludes values, like a != 'x' does. The NOT of IS NOT and of
+// NOT IN, NOT LIKE and NOT BETWEEN belongs to the operator instead.
+func negatedAt(toks []token, start, i int) bool {
+	for k := start; k < i; k++ {
+		if toks[k].kind != tkKeyword || toks[k].val != "not" || toks[k].depth > toks[i].depth {
+			continue
+		}
+		if k > start && toks[k-1].val == "is" {
+			continue
+		}
+		if next := toks[k+1].val; next == "in" || next == "like" || next == "between" {
+			continue
+		}
+		closed := false
+		for j := k + 1; j < i && !closed; j++ {
+			closed = toks[j].depth < toks[k].depth
+		}
+		if !closed {
+			return true
+		}
+	}
+	return false
+}
+
+func whereHasTimePredicate(toks []token, start, stop int, columns map[string]bool) bool {
 	if stop < 0 {
 		stop = len(toks)
 	}
 
 	for i := start; i < stop && i < len(toks); i++ {
 		// Simple comparisons: time [op] ...
-		if isTimeIdentifierAt(toks, i) {
+		if isTimeColumnAt(toks, i, columns) {
 			// Look ahead for operator at same depth (optionally allow NOT before BETWEEN).
 			depth := toks[i].depth
 			j := i + 1
@@ -488,6 +891,10 @@ func whereHasTimePredicate(toks []token, start, stop int) bool {
 			if j < stop && j < len(toks) && toks[j].kind == tkSymbol && isCompareOp(toks[j].val) {
 				return true
 			}
+			// Reversed comparison: ago(1h) < time
+			if i-1 >= start && toks[i-1].depth == depth && toks[i-1].kind == tkSymbol && isCompareOp(toks[i-1].val) {
+				return true
+			}
 		}
 
 		// Also handle encountering BETWEEN first, then look back for time column within a small window.
@@ -497,7 +904,7 @@ func whereHasTimePredicate(toks []token, start, stop int) bool {
 				if toks[k].kind == tkKeyword && toks[k].val == "not" {
 					continue
 				}
-				if isTimeIdentifierAt(toks, k) && toks[k].depth == depth {
+				if isTimeColumnAt(toks, k, columns) && toks[k].depth == depth {
 					return true
 				}
 			}
@@ -506,8 +913,127 @@ func whereHasTimePredicate(toks []token, start, stop int) bool {
 	return false
 }
 
-// MODIFIED FUNCTION
-func whereHasMeasureNamePredicate(toks []token, start, stop int) bool {
+// groupsByTimeBins reports whether the SELECT at selIdx has a GROUP BY clause at
+// groupIdx and bins a time column, e.g. bin(time, $__interval), before its end
+func groupsByTimeBins(toks []token, selIdx, groupIdx, depth int, columns map[string]bool) bool {
+	if groupIdx >= len(toks) || toks[groupIdx].kind != tkKeyword || toks[groupIdx].val != "group" {
+		return false
+	}
+	groupEnd := findNextTerminatorAtDepth(toks, groupIdx+1, depth)
+	for i := selIdx; i+2 < groupEnd; i++ {
+		if toks[i].kind == tkIdent && toks[i].val == "bin" && toks[i+1].val == "(" && isTimeColumnAt(toks, i+2, columns) {
+			return true
+		}
+	}
+	return false
+}
+
+// whereTimeBound classifies how the range restricts the time column, over its
+// whole boolean expression: bounds of AND-ed predicates add up, also when they
+// are written in separate parentheses, an OR is only as bounded as its weakest
+// branch and NOT turns a lower bound into an upper bound. A NOT of an AND or OR
+// applies to its operands, NOT (a AND b) is NOT a OR NOT b.
+func whereTimeBound(toks []token, start, stop int, columns map[string]bool) TimeBound {
+	if stop < 0 {
+		stop = len(toks)
+	}
+	return exprTimeBound(toks, parseBoolExpr(toks, start, min(stop, len(toks))), columns, false)
+}
+
+func exprTimeBound(toks []token, n *boolNode, columns map[string]bool, negated bool) TimeBound {
+	op := n.op
+	switch {
+	case negated && op == boolAnd:
+		op = boolOr
+	case negated && op == boolOr:
+		op = boolAnd
+	}
+	switch op {
+	case boolAnd:
+		bound := TimeUnbounded
+		for _, child := range n.children {
+			bound = bound.with(exprTimeBound(toks, child, columns, negated))
+		}
+		return bound
+	case boolOr:
+		bound := TimeBounded
+		for _, child := range n.children {
+			bound = bound.or(exprTimeBound(toks, child, columns, negated))
+		}
+		return bound
+	case boolNot:
+		return exprTimeBound(toks, n.children[0], columns, !negated)
+	}
+	if negated {
+		return predicateTimeBound(toks, n.start, n.stop, columns).negate()
+	}
+	return predicateTimeBound(toks, n.start, n.stop, columns)
+}
+
+// predicateTimeBound classifies the comparisons of the time column in a single
+// predicate: time > x is a lower bound, time < x an upper bound, BETWEEN and =
+// bound both sides. Reversed comparisons (x < time) are recognized as well, the
+// time column of a subquery or function call is not.
+func predicateTimeBound(toks []token, start, stop int, columns map[string]bool) TimeBound {
+	if start >= stop {
+		return TimeUnbounded
+	}
+	depth := toks[start].depth
+	for i := start; i < stop; i++ {
+		depth = min(depth, toks[i].depth)
+	}
+	bound := TimeUnbounded
+	for i := start; i < stop; i++ {
+		if toks[i].depth != depth || !isTimeColumnAt(toks, i, columns) {
+			continue
+		}
+		if j := i + 1; j < stop {
+			switch {
+			case toks[j].kind == tkKeyword && toks[j].val == "between":
+				bound = bound.with(TimeBounded)
+			case toks[j].kind == tkSymbol:
+				bound = bound.with(compareBound(toks[j].val, false))
+			}
+		}
+		if k := i - 1; k >= start && toks[k].kind == tkSymbol {
+			bound = bound.with(compareBound(toks[k].val, true))
+		}
+	}
+	return bound
+}
+
+// compareBound returns the bound set by comparing time with op, reversed for x op time.
+func compareBound(op string, reversed bool) TimeBound {
+	switch op {
+	case "=":
+		return TimeBounded
+	case ">", ">=":
+		if reversed {
+			return TimeUpperBounded
+		}
+		return TimeLowerBounded
+	case "<", "<=":
+		if reversed {
+			return TimeLowerBounded
+		}
+		return TimeUpperBounded
+	}
+	return TimeUnbounded
+}
+
+func missingBoundText(bound TimeBound) string {
+	switch bound {
+	case TimeLowerBounded:
+		return "an upper time bound"
+	case TimeUpperBounded:
+		return "a lower time bound"
+	}
+	return "a bounded time range"
+}
+
+// measureNamePredicates reports whether the range filters measure_name in an
+// accepted way and whether it uses measure_name in any other way.
+func measureNamePredicates(toks []token, start, stop int, allowComputed, allowLike bool, wrappers map[string]bool) (bool, bool) {
 	if stop < 0 {
 		stop = len(toks)
 	}
@@ -517,13 +1043,18 @@ func whereHasMeasureNamePredicate(toks []token, start, stop int) bool {
 
 	i := start
 	for i < stop && i < len(toks) {
+		// measure_name within CASE doesn't filter rows
+		if toks[i].caseDepth > 0 {
+			i++
+			continue
+		}
 
 		// Check for Pattern 1: regexp_like(measure_name, 'string')
 		// We check this *first* because it contains 'measure_name' and
 		// we need to consume the whole block at once.
 		if toks[i].kind == tkIdent && toks[i].val == "regexp_like" {
-			// Check for regexp_like(measure_name, 'string')
-			if i+5 < stop && i+5 < len(toks) &&
+			// Check for regexp_like(measure_name, 'string'), not under a NOT
+			if !negatedAt(toks, start, i) && i+5 < stop && i+5 < len(toks) &&
 				toks[i+1].kind == tkSymbol && toks[i+1].val == "(" &&
 				toks[i+2].kind == tkIdent && toks[i+2].val == "measure_name" &&
 				toks[i+3].kind == tkSymbol && toks[i+3].val == "," &&
@@ -539,10 +1070,25 @@ func whereHasMeasureNamePredicate(toks []token, start, stop int) bool {
 			// 'measure_name' check below catch it if it's used inside.
 		}
 
-		// Check for Pattern 2: measure_name = 'string'
+		// Check for Pattern 3: lower(measure_name) = 'string', with an allowed wrapper
+		if end := wrappedMeasureEnd(toks, i, stop, wrappers); end != -1 && !negatedAt(toks, start, i) {
+			if end+1 < stop && end+1 < len(toks) &&
+				toks[end].kind == tkSymbol && toks[end].val == "=" &&
+				toks[end+1].kind == tkString {
+
+				foundValid = true
+				i = end + 2
+				continue
+			}
+		}
+
+		// Check for Pattern 2: measure_name = 'string' or measure_name IN ('a', 'b')
 		if toks[i].kind == tkIdent && toks[i].val == "measure_name" {
+			// NOT measure_name = 'string' excludes a measure, like measure_name != 'string'
+			negated := negatedAt(toks, start, i)
+
 			// Check for valid: measure_name = 'string'
-			if i+2 < stop && i+2 < len(toks) &&
+			if !negated && i+2 < stop && i+2 < len(toks) &&
 				toks[i+1].kind == tkSymbol && toks[i+1].val == "=" &&
 				toks[i+2].kind == tkString {
 
@@ -550,6 +1096,29 @@ func whereHasMeasureNamePredicate(toks []token, start, stop int) bool {
 				i += 3   // Skip past the string
 				continue // Continue to next token
 
+			} else if !negated && allowLike && i+2 < stop && i+2 < len(toks) &&
+				toks[i+1].kind == tkIdent && toks[i+1].val == "like" &&
+				toks[i+2].kind == tkString {
+
+				// Check for valid: measure_name LIKE 'string', when allowed
+				foundValid = true
+				i += 3
+				continue
+
+			} else if end := measureInListEnd(toks, i, stop); !negated && end != -1 {
+
+				// Check for valid: measure_name IN ('a', 'b'), string literals only
+				foundValid = true
+				i = end // Skip past the ')'
+				continue
+
+			} else if next := computedExpressionEnd(toks, i+2, stop); !negated && allowComputed && next != -1 &&
+				toks[i+1].kind == tkSymbol && toks[i+1].val == "=" {
+
+				foundValid = true
+				i = next
+				continue
+
 			} else {
 				// We found 'measure_name' but it was NOT part of
 				// measure_name = 'string'.
@@ -563,10 +1132,118 @@ func whereHasMeasureNamePredicate(toks []token, start, stop int) bool {
 		// Move to the next token
 		i++
 	}
+	return foundValid, foundInvalid
+}
+
+// whereHasMeasureNamePredicate reports whether the predicates of an OR branch
+// filter measure_name in an accepted way, and don't use it in any other way.
+func whereHasMeasureNamePredicate(toks []token, branch [][2]int, allowComputed, allowLike bool, wrappers map[string]bool) bool {
+	foundValid, foundInvalid := false, false
+	for _, p := range branch {
+		valid, invalid := measureNamePredicates(toks, p[0], p[1], allowComputed, allowLike, wrappers)
+		foundValid, foundInvalid = foundValid || valid, foundInvalid || invalid
+	}
 	// Must have at least one valid condition and NO invalid conditions.
 	return foundValid && !foundInvalid
 }
 
+// wrappedMeasureEnd returns the index after a call of an allowed wrapper on
+// measure_name starting at i, like lower(measure_name), or -1.
+func wrappedMeasureEnd(toks []token, i, stop int, wrappers map[string]bool) int {
+	if i+3 >= stop || i+3 >= len(toks) || toks[i].kind != tkIdent || !wrappers[toks[i].val] {
+		return -1
+	}
+	if toks[i+1].val != "(" || toks[i+2].kind != tkIdent || toks[i+2].val != "measure_name" || toks[i+3].val != ")" {
+		return -1
+	}
+	return i + 4
+}
+
+// whereHasNegatedMeasureLike reports whether the range filters measure_name with
+// NOT LIKE, also written NOT measure_name LIKE
+func whereHasNegatedMeasureLike(toks []token, start, stop int) bool {
+	for i := start; i+2 < stop && i+2 < len(toks); i++ {
+		if toks[i].kind != tkIdent || toks[i].val != "measure_name" || toks[i].caseDepth > 0 {
+			continue
+		}
+		if toks[i+1].kind == tkKeyword && toks[i+1].val == "not" && toks[i+2].val == "like" {
+			return true
+		}
+		if toks[i+1].kind == tkIdent && toks[i+1].val == "like" && negatedAt(toks, start, i) {
+			return true
+		}
+	}
+	return false
+}
+
+// measureInListEnd returns the index after measure_name IN ('a', 'b') starting
+// at i, or -1. The list may only hold string literals.
+func measureInListEnd(toks []token, i, stop int) int {
+	if i+2 >= stop || i+2 >= len(toks) || toks[i].kind != tkIdent || toks[i].val != "measure_name" {
+		return -1
+	}
+	if toks[i+1].kind != tkKeyword || toks[i+1].val != "in" || toks[i+2].val != "(" {
+		return -1
+	}
+	literals := inListLiterals(toks, i+3, stop)
+	if len(literals) == 0 {
+		return -1
+	}
+	return i + 3 + 2*len(literals)
+}
+
+// computedExpressionEnd returns the index after a function call, scalar
+// subquery or bound parameter starting at i, or -1. Function calls referencing
+// a column, e.g. coalesce(measure_name, 'x') matching every measure, aren't
+// computed values.
+func computedExpressionEnd(toks []token, i, stop int) int {
+	if i >= stop || i >= len(toks) {
+		return -1
+	}
+	if toks[i].kind == tkSymbol && toks[i].val == "?" {
+		return i + 1
+	}
+	open := -1
+	switch {
+	case toks[i].kind == tkIdent && i+1 < stop && i+1 < len(toks) && toks[i+1].val == "(":
+		open = i + 1
+	case toks[i].kind == tkSymbol && toks[i].val == "(" && i+1 < stop && i+1 < len(toks) && toks[i+1].val == "select":
+		open = i
+	default:
+		return -1
+	}
+	closeIdx := matchingParen(toks, open)
+	if closeIdx == -1 || closeIdx >= stop {
+		return -1
+	}
+	if open != i && referencesColumn(toks, open+1, closeIdx) {
+		return -1
+	}
+	return closeIdx + 1
+}
+
+// referencesColumn reports whether the tokens between start and stop reference
+// a column outside of scalar subqueries, which read their own tables
+func referencesColumn(toks []token, start, stop int) bool {
+	for k := start; k < stop; k++ {
+		tok := toks[k]
+		switch {
+		case tok.kind == tkSymbol && tok.val == "(" && k+1 < stop && toks[k+1].val == "select":
+			if end := matchingParen(toks, k); end != -1 {
+				k = end
+			}
+		case tok.kind != tkIdent || columnWords[tok.val]:
+		case k+1 < stop && toks[k+1].val == "(":
+			// a function name
+		case k > start && toks[k-1].val == "as":
+			// the type of a CAST
+		default:
+			return true
+		}
+	}
+	return false
+}
+
 func isCompareOp(s string) bool {
 	switch s {
 	case "=", "<", ">", "<=", ">=", "<>", "!=":
@@ -583,34 +1260,100 @@ func stripQuotes(s string) string {
 }
 
 func isTimeIdentifierAt(toks []token, i int) bool {
+	return isTimeColumnAt(toks, i, defaultTimeColumns)
+}
+
+// isTimeColumnAt reports whether the token at i references one of the time columns
+func isTimeColumnAt(toks []token, i int, columns map[string]bool) bool {
 	if i < 0 || i >= len(toks) {
 		return false
 	}
-	if toks[i].kind != tkIdent {
+	if toks[i].kind != tkIdent || toks[i].caseDepth > 0 {
 		return false
 	}
 
-	return toks[i].val == "time"
+	return columns[strings.Trim(toks[i].val, `"`)]
+}
+
+// startOffset returns the byte offset of the token at start
+func startOffset(toks []token, start int) int {
+	if start < 0 || len(toks) == 0 {
+		return 0
+	}
+	return toks[min(start, len(toks)-1)].pos
+}
+
+// endOffset returns the byte offset just past the token before stop
+func endOffset(toks []token, stop int) int {
+	if stop < 0 || stop > len(toks) {
+		stop = len(toks)
+	}
+	if stop == 0 {
+		return 0
+	}
+	return toks[stop-1].end
 }
 
-func snippetAroundTokens(toks []token, start, stop int) string {
+// snippetLimit is the length snippets are truncated to
+const snippetLimit = 220
+
+// snippetAroundTokens renders the tokens [start, stop) as written in src, with
+// whitespace runs between tokens collapsed to a space. Long snippets are cut at
+// token boundaries and keep the clause starting at focus, with as much of the
+// statement before it as fits.
+func snippetAroundTokens(src string, toks []token, start, focus, stop int) string {
 	if start < 0 {
 		start = 0
 	}
 	if stop < 0 || stop > len(toks) {
 		stop = len(toks)
 	}
-	var b strings.Builder
-	limit := 220
-	for i := start; i < stop; i++ {
-		if b.Len() > limit {
-			b.WriteString(" ...")
+	if start >= stop {
+		return ""
+	}
+	if focus < start || focus >= stop {
+		focus = start
+	}
+	// piece returns the token text with the separator to the previous token
+	piece := func(i int) string {
+		text := src[toks[i].pos:toks[i].end]
+		if i > start && toks[i-1].end < toks[i].pos {
+			return " " + text
+		}
+		return text
+	}
+
+	// the clause from focus up to the limit, then the tokens before it that still fit
+	length, last := 0, focus
+	for ; last < stop; last++ {
+		n := len(piece(last))
+		if last > focus && length+n > snippetLimit {
 			break
 		}
-		b.WriteString(toks[i].val)
-		if i+1 < stop {
-			b.WriteByte(' ')
+		length += n
+	}
+	first := focus
+	for last == stop && first > start && length+len(piece(first-1)) <= snippetLimit {
+		first--
+		length += len(piece(first))
+	}
+	if first > start && toks[first].val == "," {
+		first++
+	}
+
+	var b strings.Builder
+	if first > start {
+		b.WriteString("... ")
+	}
+	for i := first; i < last; i++ {
+		p := piece(i)
+		if i == first {
+			p = strings.TrimLeft(p, " ")
 		}
+		b.WriteString(p)
 	}
-	return strings.TrimSpace(b.String())
+	if last < stop {
+		b.WriteString(" ...")
+	}
+	return b.String()
 }
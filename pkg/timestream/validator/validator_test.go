@@ -1,6 +1,11 @@
 package validator
 
-import "testing"
+import (
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+)
 
 func TestValidate_MoreCases(t *testing.T) {
 	t.Parallel()
@@ -173,7 +178,8 @@ WHERE time >= from_iso8601_timestamp('2025-01-01T00:00:00Z') AND measure_name =
 SELECT *
 FROM mydb.s1
 WHERE NOT time BETWEEN ago(1h) AND now() AND measure_name = 'foo'`,
-			want: true,
+			// reads everything but the last hour
+			want: false,
 		},
 		{
 			desc: "nested CTEs with inner-filtered source",
@@ -294,6 +300,51 @@ FROM mydb.sensors
 WHERE time BETWEEN ago(1d) AND now() AND (measure_name = 'foo')`,
 			want: true,
 		},
+		{
+			desc:  "measure_name IN list",
+			input: `SELECT * FROM mydb.sensors WHERE time > ago(1h) AND measure_name IN ('cpu', 'mem', 'disk')`,
+			want:  true,
+		},
+		{
+			desc:  "measure_name IN list of a single measure",
+			input: `SELECT * FROM mydb.sensors WHERE time > ago(1h) AND measure_name IN ('cpu')`,
+			want:  true,
+		},
+		{
+			desc:  "measure_name IN list with a column",
+			input: `SELECT * FROM mydb.sensors WHERE time > ago(1h) AND measure_name IN ('cpu', device)`,
+			want:  false,
+		},
+		{
+			desc:  "measure_name IN subquery",
+			input: `SELECT * FROM mydb.sensors WHERE time > ago(1h) AND measure_name IN (SELECT m FROM mydb.measures WHERE time > ago(1h) AND measure_name = 'x')`,
+			want:  false,
+		},
+		{
+			desc:  "measure_name NOT IN list",
+			input: `SELECT * FROM mydb.sensors WHERE time > ago(1h) AND measure_name NOT IN ('cpu', 'mem')`,
+			want:  false,
+		},
+		{
+			desc:  "NOT measure_name IN list",
+			input: `SELECT * FROM mydb.sensors WHERE time > ago(1h) AND NOT measure_name IN ('cpu', 'mem')`,
+			want:  false,
+		},
+		{
+			desc:  "NOT measure_name equals",
+			input: `SELECT * FROM mydb.sensors WHERE time > ago(1h) AND NOT (measure_name = 'cpu')`,
+			want:  false,
+		},
+		{
+			desc:  "NOT regexp_like measure_name",
+			input: `SELECT * FROM mydb.sensors WHERE time > ago(1h) AND NOT regexp_like(measure_name, '^cpu')`,
+			want:  false,
+		},
+		{
+			desc:  "NOT of another predicate",
+			input: `SELECT * FROM mydb.sensors WHERE time > ago(1h) AND NOT (device = 'd1') AND measure_name IN ('cpu')`,
+			want:  true,
+		},
 		{
 			desc: "time in parantheses",
 			input: `
@@ -305,7 +356,7 @@ WHERE (time BETWEEN ago(1d) AND now()) AND measure_name = 'foo'`,
 		{
 			desc: "invalid measure_name (mixed equality and inequality)",
 			input: `SELECT * FROM "db"."tbl"
-                    WHERE time > 10
+                    WHERE time > ago(10m)
                     AND measure_name = 'foo'
                     AND measure_name != 'bar'`,
 			want: false, // Fails due to measure_name check
@@ -331,45 +382,74 @@ WHERE (time BETWEEN ago(1d) AND now()) AND measure_name = 'foo'`,
 		{
 			desc: "valid top-level OR with filters in each branch",
 			input: `SELECT * FROM "db"."tbl"
-                    WHERE (time > 10 AND measure_name = 'a')
-                    OR (time < 5 AND measure_name = 'b')`,
+                    WHERE (time > ago(10m) AND measure_name = 'a')
+                    OR (time > ago(5m) AND measure_name = 'b')`,
 			want: true,
 		},
 		{
 			desc: "valid parenthesized OR with top-level filters",
 			input: `SELECT * FROM "db"."tbl"
-                    WHERE time > 10 AND measure_name = 'a'
+                    WHERE time > ago(10m) AND measure_name = 'a'
                     AND (device = 'd1' OR device = 'd2')`,
 			want: true,
 		},
 		{
 			desc: "valid parenthesized OR with top-level filters",
 			input: `SELECT * FROM "db"."tbl"
-                    WHERE time > 10 AND measure_name = 'a'
+                    WHERE time > ago(10m) AND measure_name = 'a'
                     AND (device = 'd1' OR device = 'd2')`,
 			want: true,
 		},
 		{
 			desc: "valid top-level OR with nested (parenthesized) ORs",
 			input: `SELECT * FROM "db"."tbl"
-                    WHERE (time > 10 AND measure_name = 'a' AND (device = 'd1' OR device = 'd2'))
-                    OR (time < 5 AND measure_name = 'b' AND (device = 'd3' OR device = 'd4'))`,
+                    WHERE (time > ago(10m) AND measure_name = 'a' AND (device = 'd1' OR device = 'd2'))
+                    OR (time > ago(5m) AND measure_name = 'b' AND (device = 'd3' OR device = 'd4'))`,
 			want: true,
 		},
 		{
 			desc: "invalid top-level OR, one branch has nested OR but no time filter",
 			input: `SELECT * FROM "db"."tbl"
-                    WHERE (time > 10 AND measure_name = 'a')
+                    WHERE (time > ago(10m) AND measure_name = 'a')
                     OR (measure_name = 'b' AND (device = 'd1' OR device = 'd2'))`,
 			want: false,
 		},
 		{
-			desc: "FALSE POSITIVE: invalid top-level OR, one branch has nested OR but no time filter",
+			desc: "parenthesized OR as the whole WHERE, one branch without time filter",
+			input: `SELECT * FROM "db"."tbl"
+					WHERE (time > ago(1h) OR device = 'd1' AND measure_name = 'foo')`,
+			want: false,
+		},
+		{
+			desc:  "OR with a non-time condition as the whole WHERE",
+			input: `SELECT * FROM "db"."tbl" WHERE ((time > ago(1h) AND measure_name = 'foo') OR (device = 'd1' AND measure_name = 'foo'))`,
+			want:  false,
+		},
+		{
+			desc:  "parenthesized OR as the whole WHERE, every branch with time filter",
+			input: `SELECT * FROM "db"."tbl" WHERE ((time > ago(1h) AND measure_name = 'a') OR (time > ago(2h) AND measure_name = 'b'))`,
+			want:  true,
+		},
+		{
+			desc: "nested OR, one branch without time filter",
 			input: `SELECT * FROM "db"."tbl"
 					WHERE
   					(time > ago(1h) OR device = 'd1')
   					AND measure_name = 'foo'`,
-			want: true, // This is a false positive as the current implementation only checks for OR clauses at the Top-Level
+			want: false,
+		},
+		{
+			desc: "nested OR, every branch with time filter",
+			input: `SELECT * FROM "db"."tbl"
+					WHERE
+  					(time > ago(1h) AND device = 'd1' OR time > ago(2h) AND device = 'd2')
+  					AND measure_name = 'foo'`,
+			want: true,
+		},
+		{
+			desc:  "OR nested two levels deep without measure filter",
+			input: `SELECT * FROM "db"."tbl" WHERE time > ago(1h) AND (device = 'd1' AND (measure_name = 'a' OR region = 'eu'))`,
+			want:  false,
 		},
 		{
 			desc: "ORed conditions with ANDed timeFilter",
@@ -408,10 +488,850 @@ WHERE (time BETWEEN ago(1d) AND now()) AND measure_name = 'foo'`,
 		tc := tc
 		t.Run(tc.desc, func(t *testing.T) {
 			t.Parallel()
-			got, issues := Validate(tc.input)
+			got, issues := Validate(tc.input, nil)
+			if got != tc.want {
+				t.Errorf("%s: want %v, got %v, issues: %+v", tc.desc, tc.want, got, issues)
+			}
+			if got, issues := Validate(tc.input, &Options{Parser: ParserAST}); got != tc.want {
+				t.Errorf("%s (ast): want %v, got %v, issues: %+v", tc.desc, tc.want, got, issues)
+			}
+		})
+	}
+}
+
+func TestValidate_ASTParser(t *testing.T) {
+	t.Parallel()
+
+	testcases := []struct {
+		desc      string
+		input     string
+		opts      Options
+		heuristic bool
+		ast       bool
+	}{
+		{
+			desc:      "join of a CTE with a table",
+			input:     `WITH devices AS (SELECT 'a' AS device) SELECT * FROM devices d JOIN db.metrics m ON d.device = m.device`,
+			heuristic: true,
+			ast:       false,
+		},
+		{
+			desc:      "join of a CTE with a filtered table",
+			input:     `WITH devices AS (SELECT 'a' AS device) SELECT * FROM devices d JOIN db.metrics m ON d.device = m.device WHERE time > ago(1h) AND measure_name = 'cpu'`,
+			heuristic: true,
+			ast:       true,
+		},
+		{
+			desc:      "rules of a joined table",
+			input:     `SELECT * FROM db.devices d, db.metrics m WHERE time > ago(1h) AND measure_name = 'cpu'`,
+			opts:      Options{BoundedTimeTables: []string{"metrics"}},
+			heuristic: true,
+			ast:       false,
+		},
+		{
+			desc:      "unparsable query falls back to the heuristics",
+			input:     `SELECT * FROM db.metrics WHERE time > ago(1h) AND measure_name = 'cpu' ${__dashboard_filter}`,
+			heuristic: true,
+			ast:       true,
+		},
+	}
+
+	for _, tc := range testcases {
+		tc := tc
+		t.Run(tc.desc, func(t *testing.T) {
+			t.Parallel()
+			if got, issues := Validate(tc.input, &tc.opts); got != tc.heuristic {
+				t.Errorf("heuristic: want %v, got %v, issues: %+v", tc.heuristic, got, issues)
+			}
+			tc.opts.Parser = ParserAST
+			if got, issues := Validate(tc.input, &tc.opts); got != tc.ast {
+				t.Errorf("ast: want %v, got %v, issues: %+v", tc.ast, got, issues)
+			}
+		})
+	}
+}
+
+func TestValidate_AllowMissingMeasure(t *testing.T) {
+	query := `SELECT * FROM "db"."tbl" WHERE time > ago(1h)`
+
+	if ok, _ := Validate(query, nil); ok {
+		t.Fatalf("expected default options to require measure_name")
+	}
+	if ok, issues := Validate(query, &Options{AllowMissingMeasure: true}); !ok {
+		t.Fatalf("expected query to pass without measure_name, issues: %+v", issues)
+	}
+	if ok, _ := Validate(`SELECT * FROM "db"."tbl" WHERE measure_name = 'a'`, &Options{AllowMissingMeasure: true}); ok {
+		t.Fatalf("expected time predicate to stay required")
+	}
+}
+
+func TestValidate_TenantDimension(t *testing.T) {
+	t.Parallel()
+
+	opts := &Options{TenantDimension: "ds_account", TenantTables: []string{"metrics", "other.scoped"}}
+	testcases := []struct {
+		desc  string
+		input string
+		want  bool
+	}{
+		{
+			desc:  "tenant equality present",
+			input: `SELECT * FROM "db"."metrics" WHERE time > ago(1h) AND measure_name = 'a' AND ds_account = 'acme'`,
+			want:  true,
+		},
+		{
+			desc:  "tenant missing",
+			input: `SELECT * FROM "db"."metrics" WHERE time > ago(1h) AND measure_name = 'a'`,
+			want:  false,
+		},
+		{
+			desc:  "tenant inequality does not count",
+			input: `SELECT * FROM "db"."metrics" WHERE time > ago(1h) AND measure_name = 'a' AND ds_account != 'acme'`,
+			want:  false,
+		},
+		{
+			desc:  "negated tenant equality does not count",
+			input: `SELECT * FROM "db"."metrics" WHERE time > ago(1h) AND measure_name = 'a' AND NOT ds_account = 'acme'`,
+			want:  false,
+		},
+		{
+			desc:  "negated parenthesized tenant equality does not count",
+			input: `SELECT * FROM "db"."metrics" WHERE time > ago(1h) AND measure_name = 'a' AND NOT (ds_account = 'acme')`,
+			want:  false,
+		},
+		{
+			desc:  "tenant equality after a closed NOT",
+			input: `SELECT * FROM "db"."metrics" WHERE time > ago(1h) AND measure_name = 'a' AND NOT (host = 'x') AND ds_account = 'acme'`,
+			want:  true,
+		},
+		{
+			desc:  "qualified tenant column",
+			input: `SELECT * FROM db.metrics m WHERE time > ago(1h) AND measure_name = 'a' AND m.ds_account = 'acme'`,
+			want:  true,
+		},
+		{
+			desc:  "aliased table missing tenant",
+			input: `SELECT * FROM db.metrics m WHERE time > ago(1h) AND measure_name = 'a'`,
+			want:  false,
+		},
+		{
+			desc: "OR branch missing tenant",
+			input: `SELECT * FROM "db"."metrics"
+					WHERE (time > ago(10m) AND measure_name = 'a' AND ds_account = 'acme')
+					OR (time > ago(5m) AND measure_name = 'b')`,
+			want: false,
+		},
+		{
+			desc:  "table outside of the tenant rule",
+			input: `SELECT * FROM "db"."unscoped" WHERE time > ago(1h) AND measure_name = 'a'`,
+			want:  true,
+		},
+		{
+			desc:  "fully qualified table spec",
+			input: `SELECT * FROM "other"."scoped" WHERE time > ago(1h) AND measure_name = 'a'`,
+			want:  false,
+		},
+		{
+			desc:  "fully qualified table spec does not match other databases",
+			input: `SELECT * FROM "db"."scoped" WHERE time > ago(1h) AND measure_name = 'a'`,
+			want:  true,
+		},
+	}
+
+	for _, tc := range testcases {
+		tc := tc
+		t.Run(tc.desc, func(t *testing.T) {
+			t.Parallel()
+			got, issues := Validate(tc.input, opts)
+			if got != tc.want {
+				t.Errorf("%s: want %v, got %v, issues: %+v", tc.desc, tc.want, got, issues)
+			}
+		})
+	}
+}
+
+func TestValidate_RequirePositiveDimensionFilter(t *testing.T) {
+	t.Parallel()
+
+	opts := &Options{RequirePositiveDimensionFilter: true}
+	testcases := []struct {
+		desc  string
+		input string
+		want  bool
+	}{
+		{
+			desc:  "no dimension filter",
+			input: `SELECT * FROM "db"."tbl" WHERE time > ago(1h) AND measure_name = 'a'`,
+			want:  true,
+		},
+		{
+			desc:  "only inequality",
+			input: `SELECT * FROM "db"."tbl" WHERE time > ago(1h) AND measure_name = 'a' AND ds_account != 'provisioning'`,
+			want:  false,
+		},
+		{
+			desc:  "only NOT IN",
+			input: `SELECT * FROM "db"."tbl" WHERE time > ago(1h) AND measure_name = 'a' AND ds_account NOT IN ('a', 'b')`,
+			want:  false,
+		},
+		{
+			desc:  "inequality alongside equality",
+			input: `SELECT * FROM "db"."tbl" WHERE time > ago(1h) AND measure_name = 'a' AND ds_account != 'provisioning' AND device = 'd1'`,
+			want:  true,
+		},
+		{
+			desc:  "inequality alongside IN",
+			input: `SELECT * FROM "db"."tbl" WHERE time > ago(1h) AND measure_name = 'a' AND ds_account <> 'x' AND releasegroup IN ('stable')`,
+			want:  true,
+		},
+		{
+			desc:  "LIKE prefix is positive",
+			input: `SELECT * FROM "db"."tbl" WHERE time > ago(1h) AND measure_name = 'a' AND ds_account != 'x' AND device LIKE 'gw-%'`,
+			want:  true,
+		},
+		{
+			desc:  "LIKE suffix is not positive",
+			input: `SELECT * FROM "db"."tbl" WHERE time > ago(1h) AND measure_name = 'a' AND ds_account != 'x' AND device LIKE '%-01'`,
+			want:  false,
+		},
+		{
+			desc:  "measure value comparisons are not dimensions",
+			input: `SELECT * FROM "db"."tbl" WHERE time > ago(1h) AND measure_name = 'a' AND measure_value::double != 0`,
+			want:  true,
+		},
+	}
+
+	for _, tc := range testcases {
+		tc := tc
+		t.Run(tc.desc, func(t *testing.T) {
+			t.Parallel()
+			got, issues := Validate(tc.input, opts)
 			if got != tc.want {
 				t.Errorf("%s: want %v, got %v, issues: %+v", tc.desc, tc.want, got, issues)
 			}
 		})
 	}
+
+	if ok, _ := Validate(testcases[1].input, nil); !ok {
+		t.Errorf("negated-only filters must be accepted unless the rule is enabled")
+	}
+}
+
+func TestValidate_BoundedTimeTables(t *testing.T) {
+	t.Parallel()
+
+	opts := &Options{BoundedTimeTables: []string{"big_*"}}
+	testcases := []struct {
+		desc  string
+		input string
+		want  bool
+		bound TimeBound
+	}{
+		{
+			desc:  "lower bound on a small table",
+			input: `SELECT * FROM db.small WHERE time >= ago(1h) AND measure_name = 'a'`,
+			want:  true,
+		},
+		{
+			desc:  "lower bound on a large table",
+			input: `SELECT * FROM db.big_metrics WHERE time >= ago(1h) AND measure_name = 'a'`,
+			want:  false,
+			bound: TimeLowerBounded,
+		},
+		{
+			desc:  "upper bound on a large table",
+			input: `SELECT * FROM db.big_metrics WHERE time < now() AND measure_name = 'a'`,
+			want:  false,
+			// rejected as restricting nothing, before the bounds are checked
+			bound: TimeUnbounded,
+		},
+		{
+			desc:  "between",
+			input: `SELECT * FROM db.big_metrics WHERE time BETWEEN ago(2h) AND ago(1h) AND measure_name = 'a'`,
+			want:  true,
+		},
+		{
+			desc:  "both comparisons",
+			input: `SELECT * FROM db.big_metrics WHERE time >= ago(2h) AND time < ago(1h) AND measure_name = 'a'`,
+			want:  true,
+		},
+		{
+			desc:  "reversed comparison",
+			input: `SELECT * FROM db.big_metrics WHERE time >= ago(2h) AND now() > time AND measure_name = 'a'`,
+			want:  true,
+		},
+		{
+			desc:  "not between",
+			input: `SELECT * FROM db.big_metrics WHERE time NOT BETWEEN ago(2h) AND ago(1h) AND measure_name = 'a'`,
+			want:  false,
+			bound: TimeUnbounded,
+		},
+		{
+			desc:  "bounds in separate parentheses",
+			input: `SELECT * FROM db.big_metrics WHERE (time >= ago(2h)) AND (time < ago(1h)) AND measure_name = 'a'`,
+			want:  true,
+		},
+		{
+			desc:  "bounds at different depths",
+			input: `SELECT * FROM db.big_metrics WHERE ((time >= ago(2h) AND measure_name = 'a')) AND (time < ago(1h))`,
+			want:  true,
+		},
+		{
+			desc:  "upper bound in only one branch of a nested OR",
+			input: `SELECT * FROM db.big_metrics WHERE time >= ago(2h) AND (time < ago(1h) OR device = 'd1') AND measure_name = 'a'`,
+			want:  false,
+			bound: TimeLowerBounded,
+		},
+		{
+			desc:  "upper bound in every branch of a nested OR",
+			input: `SELECT * FROM db.big_metrics WHERE time >= ago(2h) AND (time < ago(1h) OR time <= now()) AND measure_name = 'a'`,
+			want:  true,
+		},
+		{
+			desc:  "negated bound",
+			input: `SELECT * FROM db.big_metrics WHERE time >= ago(2h) AND NOT (time > ago(1h)) AND measure_name = 'a'`,
+			want:  true,
+		},
+		{
+			desc:  "negated AND",
+			input: `SELECT * FROM db.big_metrics WHERE time >= ago(2h) AND NOT (time > ago(1h) AND device = 'd1') AND measure_name = 'a'`,
+			want:  false,
+			bound: TimeLowerBounded,
+		},
+		{
+			desc:  "negated OR",
+			input: `SELECT * FROM db.big_metrics WHERE time >= ago(2h) AND NOT (time > ago(1h) OR device = 'd1') AND measure_name = 'a'`,
+			want:  true,
+		},
+		{
+			desc:  "bound of a subquery",
+			input: `SELECT * FROM db.big_metrics WHERE time >= ago(2h) AND device IN (SELECT device FROM db.small WHERE time < now()) AND measure_name = 'a'`,
+			want:  false,
+			bound: TimeLowerBounded,
+		},
+		{
+			desc: "OR branch with a lower bound only",
+			input: `SELECT * FROM db.big_metrics
+					WHERE (time BETWEEN ago(2h) AND now() AND measure_name = 'a')
+					OR (time > ago(1h) AND measure_name = 'b')`,
+			want:  false,
+			bound: TimeLowerBounded,
+		},
+	}
+
+	for _, tc := range testcases {
+		tc := tc
+		t.Run(tc.desc, func(t *testing.T) {
+			t.Parallel()
+			got, issues := Validate(tc.input, opts)
+			if got != tc.want {
+				t.Fatalf("%s: want %v, got %v, issues: %+v", tc.desc, tc.want, got, issues)
+			}
+			if !tc.want && !slices.ContainsFunc(issues, func(i Issue) bool { return i.TimeBound == tc.bound }) {
+				t.Errorf("%s: want bound %s, got %+v", tc.desc, tc.bound, issues)
+			}
+		})
+	}
+}
+
+func TestValidate_CaseExpressions(t *testing.T) {
+	t.Parallel()
+
+	testcases := []struct {
+		desc  string
+		input string
+		want  bool
+	}{
+		{
+			desc: "time predicate only inside CASE",
+			input: `SELECT * FROM db.tbl
+					WHERE CASE WHEN time > ago(1h) THEN 1 ELSE 0 END = 1 AND measure_name = 'a'`,
+			want: false,
+		},
+		{
+			desc: "measure predicate only inside CASE",
+			input: `SELECT * FROM db.tbl
+					WHERE time > ago(1h) AND CASE WHEN measure_name = 'a' THEN true END`,
+			want: false,
+		},
+		{
+			desc: "OR inside CASE does not split the WHERE",
+			input: `SELECT * FROM db.tbl
+					WHERE time > ago(1h) AND measure_name = 'a'
+					AND CASE WHEN device = 'd1' OR device = 'd2' THEN true ELSE false END`,
+			want: true,
+		},
+		{
+			desc: "nested CASE followed by real predicates",
+			input: `SELECT * FROM db.tbl
+					WHERE CASE WHEN a = 1 THEN CASE WHEN time > ago(1d) THEN 1 END ELSE 0 END = 1
+					AND time > ago(1h) AND measure_name = 'a'`,
+			want: true,
+		},
+		{
+			desc: "CASE in the SELECT list",
+			input: `SELECT CASE WHEN measure_value::double > 10 THEN 'high' ELSE 'low' END AS level
+					FROM db.tbl WHERE time > ago(1h) AND measure_name = 'a'`,
+			want: true,
+		},
+	}
+
+	for _, tc := range testcases {
+		tc := tc
+		t.Run(tc.desc, func(t *testing.T) {
+			t.Parallel()
+			got, issues := Validate(tc.input, nil)
+			if got != tc.want {
+				t.Errorf("%s: want %v, got %v, issues: %+v", tc.desc, tc.want, got, issues)
+			}
+		})
+	}
+}
+
+func TestValidate_AllowComputedMeasure(t *testing.T) {
+	t.Parallel()
+
+	testcases := []struct {
+		desc  string
+		input string
+		want  bool
+	}{
+		{
+			desc:  "function call",
+			input: `SELECT * FROM db.tbl WHERE time > ago(1h) AND measure_name = concat('cpu.', 'load')`,
+			want:  true,
+		},
+		{
+			desc: "scalar subquery over a lookup CTE",
+			input: `WITH lookup AS (SELECT 'cpu' AS m)
+					SELECT * FROM db.tbl WHERE time > ago(1h) AND measure_name = (SELECT m FROM lookup)`,
+			want: true,
+		},
+		{
+			desc:  "bound parameter",
+			input: `SELECT * FROM db.tbl WHERE time > ago(1h) AND measure_name = ?`,
+			want:  true,
+		},
+		{
+			desc:  "column comparison stays invalid",
+			input: `SELECT * FROM db.tbl WHERE time > ago(1h) AND measure_name = device`,
+			want:  false,
+		},
+		{
+			desc:  "function of measure_name matches every measure",
+			input: `SELECT * FROM db.tbl WHERE time > ago(1h) AND measure_name = coalesce(measure_name, 'x')`,
+			want:  false,
+		},
+		{
+			desc:  "function of another column",
+			input: `SELECT * FROM db.tbl WHERE time > ago(1h) AND measure_name = lower("device")`,
+			want:  false,
+		},
+		{
+			desc:  "nested function of a column",
+			input: `SELECT * FROM db.tbl WHERE time > ago(1h) AND measure_name = concat(trim(measure_name), '')`,
+			want:  false,
+		},
+		{
+			desc:  "cast of a literal",
+			input: `SELECT * FROM db.tbl WHERE time > ago(1h) AND measure_name = cast('cpu' AS varchar)`,
+			want:  true,
+		},
+		{
+			desc: "function of a scalar subquery",
+			input: `WITH lookup AS (SELECT 'cpu' AS m)
+					SELECT * FROM db.tbl WHERE time > ago(1h) AND measure_name = coalesce((SELECT m FROM lookup), 'cpu')`,
+			want: true,
+		},
+	}
+
+	for _, tc := range testcases {
+		tc := tc
+		t.Run(tc.desc, func(t *testing.T) {
+			t.Parallel()
+			if got, issues := Validate(tc.input, &Options{AllowComputedMeasure: true}); got != tc.want {
+				t.Errorf("%s: want %v, got %v, issues: %+v", tc.desc, tc.want, got, issues)
+			}
+			if got, _ := Validate(tc.input, nil); got {
+				t.Errorf("%s: expected rejection without AllowComputedMeasure", tc.desc)
+			}
+		})
+	}
+}
+
+func TestValidate_MeasureWrappers(t *testing.T) {
+	t.Parallel()
+
+	testcases := []struct {
+		desc  string
+		input string
+		opts  *Options
+		want  bool
+	}{
+		{
+			desc:  "lower",
+			input: `SELECT * FROM db.tbl WHERE time > ago(1h) AND lower(measure_name) = 'cpu'`,
+			want:  true,
+		},
+		{
+			desc:  "upper in OR branches",
+			input: `SELECT * FROM db.tbl WHERE time > ago(1h) AND (UPPER(measure_name) = 'CPU' OR measure_name = 'mem')`,
+			want:  true,
+		},
+		{
+			desc:  "wrapped column comparison stays invalid",
+			input: `SELECT * FROM db.tbl WHERE time > ago(1h) AND lower(measure_name) = device`,
+			want:  false,
+		},
+		{
+			desc:  "wrapper not allowed",
+			input: `SELECT * FROM db.tbl WHERE time > ago(1h) AND trim(measure_name) = 'cpu'`,
+			want:  false,
+		},
+		{
+			desc:  "configured wrapper",
+			input: `SELECT * FROM db.tbl WHERE time > ago(1h) AND trim(measure_name) = 'cpu'`,
+			opts:  &Options{MeasureWrappers: []string{"trim"}},
+			want:  true,
+		},
+		{
+			desc:  "configured wrappers replace the defaults",
+			input: `SELECT * FROM db.tbl WHERE time > ago(1h) AND lower(measure_name) = 'cpu'`,
+			opts:  &Options{MeasureWrappers: []string{"trim"}},
+			want:  false,
+		},
+	}
+
+	for _, tc := range testcases {
+		tc := tc
+		t.Run(tc.desc, func(t *testing.T) {
+			t.Parallel()
+			if got, issues := Validate(tc.input, tc.opts); got != tc.want {
+				t.Errorf("%s: want %v, got %v, issues: %+v", tc.desc, tc.want, got, issues)
+			}
+		})
+	}
+}
+
+func TestValidate_TimeColumns(t *testing.T) {
+	t.Parallel()
+
+	testcases := []struct {
+		desc  string
+		input string
+		opts  *Options
+		want  bool
+	}{
+		{
+			desc:  "time by default",
+			input: `SELECT * FROM db.tbl WHERE time > ago(1h) AND measure_name = 'cpu'`,
+			want:  true,
+		},
+		{
+			desc:  "custom time column not accepted by default",
+			input: `SELECT * FROM db.tbl WHERE measure_time > ago(1h) AND measure_name = 'cpu'`,
+			want:  false,
+		},
+		{
+			desc:  "configured time column",
+			input: `SELECT * FROM db.tbl WHERE measure_time > ago(1h) AND measure_name = 'cpu'`,
+			opts:  &Options{TimeColumns: []string{"measure_time"}},
+			want:  true,
+		},
+		{
+			desc:  "quoted configured time column with BETWEEN",
+			input: `SELECT * FROM db.tbl WHERE "Measure_Time" BETWEEN ago(1h) AND now() AND measure_name = 'cpu'`,
+			opts:  &Options{TimeColumns: []string{"measure_time"}},
+			want:  true,
+		},
+		{
+			desc:  "configured time columns replace the defaults",
+			input: `SELECT * FROM db.tbl WHERE time > ago(1h) AND measure_name = 'cpu'`,
+			opts:  &Options{TimeColumns: []string{"measure_time"}},
+			want:  false,
+		},
+		{
+			desc:  "configured time column bounds both sides",
+			input: `SELECT * FROM db.tbl WHERE measure_time > ago(1h) AND measure_name = 'cpu'`,
+			opts:  &Options{TimeColumns: []string{"time", "measure_time"}, BoundedTimeTables: []string{"tbl"}},
+			want:  false,
+		},
+	}
+
+	for _, tc := range testcases {
+		tc := tc
+		t.Run(tc.desc, func(t *testing.T) {
+			t.Parallel()
+			if got, issues := Validate(tc.input, tc.opts); got != tc.want {
+				t.Errorf("%s: want %v, got %v, issues: %+v", tc.desc, tc.want, got, issues)
+			}
+		})
+	}
+}
+
+func TestValidate_TimeBins(t *testing.T) {
+	t.Parallel()
+
+	testcases := []struct {
+		desc   string
+		input  string
+		reason string
+		fix    bool
+	}{
+		{
+			desc:   "binned time",
+			input:  `SELECT bin(time, $__interval) AS t, avg(measure_value::double) FROM db.tbl WHERE measure_name = 'cpu' GROUP BY bin(time, $__interval) ORDER BY t`,
+			reason: "GROUP BY bins time but WHERE doesn't restrict it",
+			fix:    true,
+		},
+		{
+			desc:   "binned time grouped by position",
+			input:  `SELECT BIN(time, 1m) AS t, avg(measure_value::double) FROM db.tbl WHERE measure_name = 'cpu' GROUP BY 1`,
+			reason: "GROUP BY bins time but WHERE doesn't restrict it",
+			fix:    true,
+		},
+		{
+			desc:   "binned time with an unbounded OR branch",
+			input:  `SELECT bin(time, 1m) AS t, count(*) FROM db.tbl WHERE time > ago(1h) AND measure_name = 'cpu' OR measure_name = 'mem' GROUP BY 1`,
+			reason: "GROUP BY bins time but an OR branch in WHERE doesn't restrict it",
+			fix:    true,
+		},
+		{
+			desc:   "grouped without bins",
+			input:  `SELECT device, count(*) FROM db.tbl WHERE measure_name = 'cpu' GROUP BY device`,
+			reason: "WHERE clause lacks a time predicate",
+		},
+		{
+			desc:   "binned without grouping",
+			input:  `SELECT bin(time, 1m) AS t FROM db.tbl WHERE measure_name = 'cpu'`,
+			reason: "WHERE clause lacks a time predicate",
+		},
+	}
+
+	for _, tc := range testcases {
+		tc := tc
+		t.Run(tc.desc, func(t *testing.T) {
+			t.Parallel()
+			valid, issues := Validate(tc.input, nil)
+			if valid || len(issues) != 1 || issues[0].Rule != RuleTime || issues[0].Reason != tc.reason {
+				t.Fatalf("%s: want a %s issue %q, got %v, %+v", tc.desc, RuleTime, tc.reason, valid, issues)
+			}
+			if tc.fix != (issues[0].Fix != "") {
+				t.Errorf("%s: want fix %v, got %q", tc.desc, tc.fix, issues[0].Fix)
+			}
+		})
+	}
+}
+
+func TestValidate_WarningRules(t *testing.T) {
+	t.Parallel()
+
+	opts := &Options{WarningRules: []Rule{RuleMeasure}}
+	testcases := []struct {
+		desc     string
+		input    string
+		want     bool
+		errors   []Rule
+		warnings []Rule
+	}{
+		{
+			desc:     "warning rule only",
+			input:    `SELECT * FROM db.t WHERE time > ago(1h)`,
+			want:     true,
+			warnings: []Rule{RuleMeasure},
+		},
+		{
+			desc:     "warning and error rules",
+			input:    `SELECT * FROM db.t WHERE host = 'a'`,
+			want:     false,
+			errors:   []Rule{RuleTime},
+			warnings: []Rule{RuleMeasure},
+		},
+		{
+			desc:   "error rule",
+			input:  `SELECT * FROM db.t`,
+			want:   false,
+			errors: []Rule{RuleWhere},
+		},
+	}
+
+	rulesOf := func(issues []Issue) []Rule {
+		var out []Rule
+		for _, issue := range issues {
+			out = append(out, issue.Rule)
+		}
+		return out
+	}
+	for _, tc := range testcases {
+		tc := tc
+		t.Run(tc.desc, func(t *testing.T) {
+			t.Parallel()
+			got, issues := Validate(tc.input, opts)
+			if got != tc.want {
+				t.Fatalf("%s: want %v, got %v, issues: %+v", tc.desc, tc.want, got, issues)
+			}
+			if errs := rulesOf(Errors(issues)); !reflect.DeepEqual(errs, tc.errors) {
+				t.Errorf("%s: want errors %v, got %v", tc.desc, tc.errors, errs)
+			}
+			if warnings := rulesOf(Warnings(issues)); !reflect.DeepEqual(warnings, tc.warnings) {
+				t.Errorf("%s: want warnings %v, got %v", tc.desc, tc.warnings, warnings)
+			}
+		})
+	}
+}
+
+func TestValidate_RuleLevels(t *testing.T) {
+	t.Parallel()
+
+	testcases := []struct {
+		desc   string
+		levels map[Rule]RuleLevel
+		want   bool
+		rules  []Rule
+	}{
+		{desc: "defaults", want: false, rules: []Rule{RuleTime, RuleMeasure}},
+		{desc: "off", levels: map[Rule]RuleLevel{RuleMeasure: LevelOff}, want: false, rules: []Rule{RuleTime}},
+		{desc: "off and warn", levels: map[Rule]RuleLevel{RuleMeasure: LevelOff, RuleTime: LevelWarn}, want: true, rules: []Rule{RuleTime}},
+		{desc: "error overrides warning rules", levels: map[Rule]RuleLevel{RuleMeasure: LevelError, RuleTime: LevelOff}, want: false, rules: []Rule{RuleMeasure}},
+	}
+
+	for _, tc := range testcases {
+		tc := tc
+		t.Run(tc.desc, func(t *testing.T) {
+			t.Parallel()
+			opts := &Options{WarningRules: []Rule{RuleMeasure}, RuleLevels: tc.levels}
+			got, issues := Validate(`SELECT * FROM db.t WHERE host = 'a'`, opts)
+			if got != tc.want {
+				t.Errorf("want %v, got %v, issues: %+v", tc.want, got, issues)
+			}
+			var rules []Rule
+			for _, issue := range issues {
+				rules = append(rules, issue.Rule)
+				if want := opts.Level(issue.Rule) == LevelError; (issue.Severity == SeverityError) != want {
+					t.Errorf("issue of %s has severity %s", issue.Rule, issue.Severity)
+				}
+			}
+			if !reflect.DeepEqual(rules, tc.rules) {
+				t.Errorf("want issues of %v, got %v", tc.rules, rules)
+			}
+		})
+	}
+}
+
+func TestValidate_IssueCodes(t *testing.T) {
+	t.Parallel()
+
+	testcases := []struct {
+		desc  string
+		input string
+		opts  *Options
+		want  []IssueCode
+	}{
+		{desc: "missing WHERE", input: `SELECT * FROM db.t`, want: []IssueCode{CodeMissingWhere}},
+		{desc: "missing time", input: `SELECT * FROM db.t WHERE measure_name = 'cpu'`, want: []IssueCode{CodeMissingTimePredicate}},
+		{desc: "missing measure", input: `SELECT * FROM db.t WHERE time > ago(1h) AND measure_name <> 'cpu'`, want: []IssueCode{CodeInvalidMeasurePredicate}},
+		{
+			desc:  "OR branch",
+			input: `SELECT * FROM db.t WHERE (time > ago(1h) AND measure_name = 'cpu') OR (time > ago(1h) AND host = 'a')`,
+			want:  []IssueCode{CodeOrBranchUnfiltered},
+		},
+		{
+			desc:  "negated LIKE",
+			input: `SELECT * FROM db.t WHERE time > ago(1h) AND measure_name NOT LIKE 'debug%'`,
+			want:  []IssueCode{CodeNegatedMeasureLike},
+		},
+		{
+			desc:  "patterns",
+			input: `SELECT * FROM db.t WHERE time > ago(1h) AND regexp_like(measure_name, '(')`,
+			want:  []IssueCode{CodeInvalidMeasurePattern},
+		},
+		{
+			desc:  "upper bound",
+			input: `SELECT * FROM db.t WHERE time > ago(1h) AND measure_name = 'cpu' AND host != 'a'`,
+			opts:  &Options{BoundedTimeTables: []string{"t"}, TenantDimension: "account", RequirePositiveDimensionFilter: true},
+			want:  []IssueCode{CodeUnboundedTime, CodeMissingTenant, CodeNegatedDimensionFilter},
+		},
+		{
+			desc:  "required column",
+			input: `SELECT * FROM db.t WHERE time > ago(1h) AND measure_name = 'cpu'`,
+			opts:  &Options{RequiredColumns: []RequiredColumn{{Column: "releasegroup"}}},
+			want:  []IssueCode{CodeMissingRequiredColumn},
+		},
+		{desc: "invalid options", input: `SELECT 1`, opts: &Options{Parser: "sqlite"}, want: []IssueCode{CodeInvalidOptions}},
+	}
+
+	for _, tc := range testcases {
+		tc := tc
+		t.Run(tc.desc, func(t *testing.T) {
+			t.Parallel()
+			_, issues := Validate(tc.input, tc.opts)
+			var codes []IssueCode
+			for _, issue := range issues {
+				codes = append(codes, issue.Code)
+			}
+			if !reflect.DeepEqual(codes, tc.want) {
+				t.Errorf("%s: want codes %v, got %v, issues: %+v", tc.desc, tc.want, codes, issues)
+			}
+		})
+	}
+}
+
+func TestValidate_Snippet(t *testing.T) {
+	t.Parallel()
+
+	long := strings.Repeat("a_long_column_name, ", 15)
+	testcases := []struct {
+		desc  string
+		input string
+		want  string
+	}{
+		{
+			desc:  "original spacing and case",
+			input: "SELECT   Device,avg(measure_value::double)\n  FROM \"db\".\"tbl\" -- comment\n  WHERE time > ago(1h)",
+			want:  `SELECT Device,avg(measure_value::double) FROM "db"."tbl" WHERE time > ago(1h)`,
+		},
+		{
+			desc:  "long select list",
+			input: "SELECT " + long + "x FROM db.tbl WHERE time > ago(1h)",
+			want:  "... " + strings.Repeat("a_long_column_name, ", 9) + "x FROM db.tbl WHERE time > ago(1h)",
+		},
+		{
+			desc:  "missing WHERE",
+			input: "SELECT " + long + "x FROM db.tbl",
+			want:  "... " + strings.Repeat("a_long_column_name, ", 10) + "x FROM db.tbl",
+		},
+		{
+			desc:  "long WHERE clause",
+			input: "SELECT x FROM db.tbl WHERE host IN (" + strings.Repeat("'host', ", 40) + "'host')",
+			want:  "... WHERE host IN (" + strings.TrimSuffix(strings.Repeat("'host', ", 25), " ") + " ...",
+		},
+	}
+
+	for _, tc := range testcases {
+		tc := tc
+		t.Run(tc.desc, func(t *testing.T) {
+			t.Parallel()
+			_, issues := Validate(tc.input, nil)
+			if len(issues) == 0 {
+				t.Fatalf("%s: want an issue", tc.desc)
+			}
+			if issues[0].Snippet != tc.want {
+				t.Errorf("%s: want snippet\n%s\ngot\n%s", tc.desc, tc.want, issues[0].Snippet)
+			}
+		})
+	}
+}
+
+func TestValidate_CommentMarkersInQuotes(t *testing.T) {
+	t.Parallel()
+
+	for _, sql := range []string{
+		`SELECT * FROM "db"."a--b" WHERE time > ago(1h) AND measure_name = 'cpu'`,
+		`SELECT * FROM db.tbl WHERE time > ago(1h) AND measure_name = '/*cpu*/'`,
+		`SELECT * FROM db.tbl WHERE time > ago(1h) AND measure_name = 'it''s -- cpu'`,
+	} {
+		if valid, issues := Validate(sql, nil); !valid {
+			t.Errorf("Validate(%q) = %+v, want valid", sql, issues)
+		}
+	}
 }
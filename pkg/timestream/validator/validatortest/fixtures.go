@@ -0,0 +1,157 @@
+// Package validatortest runs table-driven validator fixtures written in YAML,
+// so teams maintaining validator configs can keep regression tests for their
+// rules without writing Go. A fixture file holds the validator options, in the
+// format of the datasource settings, and the queries to check:
+//
+//	config:
+//	  tenantDimension: ds_account
+//	cases:
+//	  - name: tenant filter is required
+//	    sql: SELECT * FROM db.tbl WHERE time > ago(1h) AND measure_name = 'cpu'
+//	    valid: false
+//	    issues: ["tenant dimension ds_account"]
+//	    codes: [missing-tenant]
+//
+// Every entry of issues must be contained in the reason of a reported issue,
+// every entry of codes must be the code of one.
+package validatortest
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/grafana/timestream-datasource/pkg/timestream/validator"
+	"gopkg.in/yaml.v3"
+)
+
+// Case is a query and the expected validation result
+type Case struct {
+	Name   string   `yaml:"name"`
+	SQL    string   `yaml:"sql"`
+	Valid  bool     `yaml:"valid"`
+	Issues []string `yaml:"issues,omitempty"`
+	Codes  []string `yaml:"codes,omitempty"`
+}
+
+// Fixture is a validator configuration with its cases
+type Fixture struct {
+	Path  string
+	Rules *validator.Compiled
+	Cases []Case
+}
+
+type fixtureFile struct {
+	Config map[string]any `yaml:"config"`
+	Cases  []Case         `yaml:"cases"`
+}
+
+// LoadFixtures reads the fixture files matching the glob pattern
+func LoadFixtures(pattern string) ([]Fixture, error) {
+	paths, err := filepath.Glob(pattern)
+	if err != nil {
+		return nil, err
+	}
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("no fixtures match %s", pattern)
+	}
+	fixtures := make([]Fixture, 0, len(paths))
+	for _, path := range paths {
+		f, err := loadFixture(path)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		fixtures = append(fixtures, f)
+	}
+	return fixtures, nil
+}
+
+func loadFixture(path string) (Fixture, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return Fixture{}, err
+	}
+	// misspelled keys fail instead of leaving a rule or expectation unset
+	file := fixtureFile{}
+	dec := yaml.NewDecoder(bytes.NewReader(b))
+	dec.KnownFields(true)
+	if err := dec.Decode(&file); err != nil && !errors.Is(err, io.EOF) {
+		return Fixture{}, err
+	}
+	// the options only have JSON names, as stored in the datasource settings
+	config, err := json.Marshal(file.Config)
+	if err != nil {
+		return Fixture{}, err
+	}
+	opts := &validator.Options{}
+	if file.Config != nil {
+		dec := json.NewDecoder(bytes.NewReader(config))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(opts); err != nil {
+			return Fixture{}, fmt.Errorf("invalid config: %w", err)
+		}
+	}
+	rules, err := opts.Compile()
+	if err != nil {
+		return Fixture{}, err
+	}
+	return Fixture{Path: path, Rules: rules, Cases: file.Cases}, nil
+}
+
+// Check validates the query of the case and describes every mismatch with the expectation
+func (f Fixture) Check(c Case) []string {
+	valid, issues := f.Rules.Validate(c.SQL)
+	var failures []string
+	if valid != c.Valid {
+		reasons := make([]string, 0, len(issues))
+		for _, issue := range issues {
+			reasons = append(reasons, issue.Reason)
+		}
+		failures = append(failures, fmt.Sprintf("valid = %t, want %t (issues: %s)", valid, c.Valid, strings.Join(reasons, "; ")))
+	}
+	for _, want := range c.Issues {
+		found := false
+		for _, issue := range issues {
+			found = found || strings.Contains(issue.Reason, want)
+		}
+		if !found {
+			failures = append(failures, fmt.Sprintf("no issue contains %q", want))
+		}
+	}
+	for _, want := range c.Codes {
+		found := false
+		for _, issue := range issues {
+			found = found || string(issue.Code) == want
+		}
+		if !found {
+			failures = append(failures, fmt.Sprintf("no issue has code %s", want))
+		}
+	}
+	return failures
+}
+
+// RunFixtures runs every case of the fixture files matching the glob pattern as a subtest
+func RunFixtures(t *testing.T, pattern string) {
+	t.Helper()
+	fixtures, err := LoadFixtures(pattern)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range fixtures {
+		t.Run(filepath.Base(f.Path), func(t *testing.T) {
+			for _, c := range f.Cases {
+				t.Run(c.Name, func(t *testing.T) {
+					for _, failure := range f.Check(c) {
+						t.Error(failure)
+					}
+				})
+			}
+		})
+	}
+}
@@ -0,0 +1,42 @@
+package validatortest
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunFixtures(t *testing.T) {
+	RunFixtures(t, "testdata/*.yaml")
+}
+
+func TestFixture_Check(t *testing.T) {
+	fixtures, err := LoadFixtures("testdata/defaults.yaml")
+	require.NoError(t, err)
+	require.Len(t, fixtures, 1)
+
+	failures := fixtures[0].Check(Case{SQL: "SELECT * FROM db.tbl", Valid: true, Issues: []string{"tenant"}, Codes: []string{"missing-where", "missing-tenant"}})
+	assert.Equal(t, []string{
+		"valid = false, want true (issues: missing WHERE clause)",
+		`no issue contains "tenant"`,
+		"no issue has code missing-tenant",
+	}, failures)
+}
+
+func TestLoadFixtures_Errors(t *testing.T) {
+	_, err := LoadFixtures("testdata/missing-*.yaml")
+	assert.Error(t, err)
+
+	for name, content := range map[string]string{
+		"unknown option": "config:\n  tenantDimesion: ds_account\ncases: []\n",
+		"unknown field":  "cases:\n  - name: typo\n    sql: SELECT 1\n    vaild: true\n",
+	} {
+		path := filepath.Join(t.TempDir(), "fixture.yaml")
+		require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+		_, err := LoadFixtures(path)
+		assert.Error(t, err, name)
+	}
+}
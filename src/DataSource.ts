@@ -1,9 +1,17 @@
 import {
+  AdHocVariableFilter,
+  CoreApp,
   DataFrame,
   DataQueryRequest,
   DataQueryResponse,
   DataSourceInstanceSettings,
+  DataSourceWithLogsContextSupport,
+  dateTime,
+  FieldType,
   getValueFormat,
+  LogRowContextOptions,
+  LogRowContextQueryDirection,
+  LogRowModel,
   MetricFindValue,
   QueryResultMetaStat,
   ScopedVars,
@@ -15,10 +23,26 @@ import { getRequestLooper, MultiRequestTracker } from 'requestLooper';
 import { lastValueFrom, merge, Observable, of } from 'rxjs';
 import { map } from 'rxjs/operators';
 
-import { TimestreamCustomMeta, TimestreamOptions, TimestreamQuery } from './types';
+import {
+  Materialization,
+  MaterializationRequest,
+  QueryModelVersion,
+  QueryProblem,
+  QueryTypeLogContext,
+  QueryTypeMath,
+  QueryTypeMerge,
+  QueryTypePreview,
+  RunningQuery,
+  TimestreamCustomMeta,
+  TimestreamOptions,
+  TimestreamQuery,
+} from './types';
 
 let requestCounter = 100;
-export class DataSource extends DataSourceWithBackend<TimestreamQuery, TimestreamOptions> {
+export class DataSource
+  extends DataSourceWithBackend<TimestreamQuery, TimestreamOptions>
+  implements DataSourceWithLogsContextSupport<TimestreamQuery>
+{
   // Easy access for QueryEditor
   options: TimestreamOptions;
 
@@ -43,11 +67,149 @@ export class DataSource extends DataSourceWithBackend<TimestreamQuery, Timestrea
       });
   }
 
+  async getTagKeys(): Promise<MetricFindValue[]> {
+    const keys: string[] = await this.postResource('tag-keys', {});
+    return keys.map((k) => ({ text: k }));
+  }
+
+  async getTagValues(options: { key: string; filters?: AdHocVariableFilter[] }): Promise<MetricFindValue[]> {
+    const values: string[] = await this.postResource('tag-values', {
+      key: options.key,
+      filters: options.filters,
+    });
+    return values.map((v) => ({ text: v }));
+  }
+
+  /**
+   * Run the queries of a dashboard ahead of its panels, so they render from the
+   * result cache of the backend
+   */
+  async prefetch(request: DataQueryRequest<TimestreamQuery>): Promise<number> {
+    const queries = request.targets
+      .filter((t) => !t.hide && this.filterQuery(t))
+      .map((t) => this.applyTemplateVariables(t, request.scopedVars, request.filters));
+    if (!queries.length) {
+      return 0;
+    }
+    const res: { queued: number } = await this.postResource('prefetch', {
+      queries,
+      from: request.range.from.toISOString(),
+      to: request.range.to.toISOString(),
+      intervalMs: request.intervalMs,
+      maxDataPoints: request.maxDataPoints,
+    });
+    return res.queued;
+  }
+
+  /**
+   * Queries the backend is paging through, cancel them with cancelQuery. Users
+   * see their own queries, admins every query
+   */
+  async getRunningQueries(): Promise<RunningQuery[]> {
+    return this.getResource('queries/running');
+  }
+
+  async cancelQuery(queryId: string): Promise<string> {
+    return this.postResource('cancel', { queryId });
+  }
+
+  /**
+   * Scheduled queries writing the results of panel queries to tables, admins only
+   */
+  async getMaterializations(): Promise<Materialization[]> {
+    return this.getResource('materializations');
+  }
+
+  /**
+   * Create the scheduled query of a panel query, or only derive it with preview.
+   * Switch the panel to the returned panelQuery to read the materialized table.
+   */
+  async materialize(request: MaterializationRequest, preview = false): Promise<Materialization> {
+    const query = this.applyTemplateVariables(request.query, {});
+    return this.postResource(preview ? 'materializations/preview' : 'materializations/create', { ...request, query });
+  }
+
+  async setMaterializationEnabled(arn: string, enabled: boolean): Promise<Materialization[]> {
+    return this.postResource('materializations/state', { arn, enabled });
+  }
+
+  /**
+   * Delete the scheduled query of a materialization, the table is kept
+   */
+  async deleteMaterialization(arn: string): Promise<Materialization[]> {
+    return this.postResource('materializations/delete', { arn });
+  }
+
+  /**
+   * The rows written before or after a row of a logs query with the same
+   * dimensions, for the "show context" of Explore
+   */
+  async getLogRowContext(
+    row: LogRowModel,
+    options?: LogRowContextOptions,
+    query?: TimestreamQuery
+  ): Promise<DataQueryResponse> {
+    const values: Record<string, string> = {};
+    for (const field of row.dataFrame.fields) {
+      const value = field.values[row.rowIndex];
+      if (field.type === FieldType.string && value != null) {
+        values[field.name] = String(value);
+      }
+    }
+    const forward = options?.direction === LogRowContextQueryDirection.Forward;
+    const hour = 60 * 60 * 1000;
+    const range = {
+      from: dateTime(forward ? row.timeEpochMs : row.timeEpochMs - hour),
+      to: dateTime(forward ? row.timeEpochMs + hour : row.timeEpochMs),
+    };
+    const target: TimestreamQuery = {
+      ...(query ?? { refId: row.dataFrame.refId ?? 'A' }),
+      queryType: QueryTypeLogContext,
+      waitForResult: true,
+      logContext: {
+        time: row.timeEpochMs,
+        values,
+        direction: forward ? 'forward' : 'backward',
+        limit: options?.limit,
+      },
+    };
+    return lastValueFrom(
+      super.query({
+        requestId: `log-context-${requestCounter++}`,
+        targets: [target],
+        range: { ...range, raw: range },
+        interval: '1s',
+        intervalMs: 1000,
+        scopedVars: {},
+        timezone: 'utc',
+        app: 'explore',
+        startTime: Date.now(),
+      })
+    );
+  }
+
+  getDefaultQuery(): Partial<TimestreamQuery> {
+    return { version: QueryModelVersion, ...this.options.queryDefaults };
+  }
+
+  /**
+   * JSON schema of the queries, e.g. for validating provisioned dashboards
+   */
+  async getQuerySchema(): Promise<object> {
+    return this.getResource('query-schema');
+  }
+
   /**
    * Do not execute queries that do not exist yet
    */
   filterQuery(query: TimestreamQuery): boolean {
-    return !!query.rawQuery;
+    return (
+      !!query.rawQuery ||
+      query.queryType === QueryTypePreview ||
+      query.queryType === QueryTypeLogContext ||
+      query.queryType === QueryTypeMerge ||
+      query.queryType === QueryTypeMath
+    );
   }
 
   getQueryDisplayText(query: TimestreamQuery): string {
@@ -73,7 +235,7 @@ export class DataSource extends DataSourceWithBackend<TimestreamQuery, Timestrea
     return "'" + value.replace(/'/g, "''") + "'";
   }
 
-  applyTemplateVariables(query: TimestreamQuery, scopedVars: ScopedVars): TimestreamQuery {
+  applyTemplateVariables(query: TimestreamQuery, scopedVars: ScopedVars, filters?: AdHocVariableFilter[]): TimestreamQuery {
     if (!query.rawQuery) {
       return query;
     }
@@ -97,10 +259,19 @@ export class DataSource extends DataSourceWithBackend<TimestreamQuery, Timestrea
       table: templateSrv.replace(query.table || '', scopedVars),
       measure: templateSrv.replace(query.measure || '', scopedVars),
       rawQuery: templateSrv.replace(query.rawQuery, variables, this.interpolateVariable),
+      validatorProfile: query.validatorProfile ? templateSrv.replace(query.validatorProfile, scopedVars) : undefined,
+      adhocFilters: filters?.length ? filters : undefined,
     };
   }
 
   query(request: DataQueryRequest<TimestreamQuery>): Observable<DataQueryResponse> {
+    const exploreProfile = this.options.exploreValidatorProfile;
+    if (request.app === CoreApp.Explore && exploreProfile) {
+      request = {
+        ...request,
+        targets: request.targets.map((t) => (t.validatorProfile ? t : { ...t, validatorProfile: exploreProfile })),
+      };
+    }
     const targets = request.targets;
     if (!targets.length) {
       return of({ data: [] });
@@ -142,6 +313,7 @@ export class DataSource extends DataSourceWithBackend<TimestreamQuery, Timestrea
                 refId: first.refId,
                 rawQuery: first.meta?.executedQueryString,
                 nextToken: meta.nextToken,
+                validatorProfile: target.validatorProfile,
               } as TimestreamQuery;
             }
           }
@@ -348,3 +520,9 @@ export function getNextTokenMeta(rsp: DataQueryResponse): TimestreamCustomMeta |
   }
   return undefined;
 }
+
+// getQueryProblem returns why the backend rejected the query of the response
+export function getQueryProblem(rsp: DataQueryResponse): QueryProblem | undefined {
+  const first = rsp.data?.[0] as DataFrame | undefined;
+  return (first?.meta?.custom as TimestreamCustomMeta | undefined)?.problem;
+}
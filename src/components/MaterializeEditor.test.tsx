@@ -0,0 +1,37 @@
+import '@testing-library/jest-dom';
+
+import { fireEvent, render, screen, waitFor } from '@testing-library/react';
+import React from 'react';
+
+import { mockDatasource, mockQuery } from '../__mocks__/datasource';
+import { MaterializeEditor } from './MaterializeEditor';
+
+describe('MaterializeEditor', () => {
+  it('should switch the panel to the materialized table', async () => {
+    const onChange = jest.fn();
+    const onRunQuery = jest.fn();
+    mockDatasource.materialize = jest.fn().mockResolvedValue({
+      name: 'host-load',
+      database: 'rollups',
+      table: 'host_load',
+      schedule: 'rate(1 hour)',
+      panelQuery: `SELECT time, "host", "avg_load" FROM "rollups"."host_load" WHERE $__timeFilter AND measure_name = 'host-load' ORDER BY time`,
+    });
+    render(<MaterializeEditor datasource={mockDatasource} query={mockQuery} onChange={onChange} onRunQuery={onRunQuery} />);
+
+    const button = screen.getByText('Materialize and switch panel');
+    expect(button.closest('button')).toBeDisabled();
+    fireEvent.change(screen.getByPlaceholderText('host-load'), { target: { value: 'host-load' } });
+    fireEvent.change(screen.getAllByRole('textbox')[3], { target: { value: 'host_load' } });
+    fireEvent.click(button);
+
+    await waitFor(() => expect(onRunQuery).toHaveBeenCalled());
+    expect(mockDatasource.materialize).toHaveBeenCalledWith(
+      expect.objectContaining({ name: 'host-load', interval: '1h', table: 'host_load' }),
+      false
+    );
+    expect(onChange).toHaveBeenCalledWith(
+      expect.objectContaining({ database: '"rollups"', table: '"host_load"', rawQuery: expect.stringContaining('measure_name') })
+    );
+  });
+});
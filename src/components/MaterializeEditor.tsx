@@ -0,0 +1,89 @@
+import { Alert, Button, Input, Stack } from '@grafana/ui';
+import { EditorField, EditorFieldGroup, EditorRow } from '@grafana/plugin-ui';
+import React, { useState } from 'react';
+
+import { DataSource } from '../DataSource';
+import { Materialization, TimestreamQuery } from '../types';
+
+export interface Props {
+  datasource: DataSource;
+  query: TimestreamQuery;
+  onChange: (query: TimestreamQuery) => void;
+  onRunQuery: () => void;
+}
+
+/**
+ * Creates a scheduled query writing the results of the query to a table and
+ * switches the panel to read them from there
+ */
+export function MaterializeEditor({ datasource, query, onChange, onRunQuery }: Props) {
+  const [name, setName] = useState('');
+  const [every, setEvery] = useState('1h');
+  const [resolution, setResolution] = useState('');
+  const [table, setTable] = useState('');
+  const [preview, setPreview] = useState<Materialization>();
+  const [error, setError] = useState<string>();
+  const [busy, setBusy] = useState(false);
+
+  const run = async (dryRun: boolean) => {
+    setBusy(true);
+    setError(undefined);
+    try {
+      const m = await datasource.materialize(
+        { name, query, interval: every, resolution: resolution || undefined, table },
+        dryRun
+      );
+      setPreview(m);
+      if (!dryRun && m.panelQuery) {
+        onChange({ ...query, rawQuery: m.panelQuery, database: `"${m.database}"`, table: `"${m.table}"` });
+        onRunQuery();
+      }
+    } catch (err: any) {
+      setError(err?.data?.message ?? err?.message ?? String(err));
+    } finally {
+      setBusy(false);
+    }
+  };
+
+  const ready = !!name && !!every && !!table && !busy;
+  return (
+    <>
+      <EditorRow>
+        <EditorFieldGroup>
+          <EditorField label="Materialization" tooltip="Also the measure name of the written records">
+            <Input value={name} onChange={(e) => setName(e.currentTarget.value)} placeholder="host-load" width={20} />
+          </EditorField>
+          <EditorField label="Every" tooltip="How often the scheduled query runs, whole minutes">
+            <Input value={every} onChange={(e) => setEvery(e.currentTarget.value)} width={8} />
+          </EditorField>
+          <EditorField label="Resolution" tooltip="Value of $__interval, the interval when empty">
+            <Input value={resolution} onChange={(e) => setResolution(e.currentTarget.value)} placeholder="1m" width={8} />
+          </EditorField>
+          <EditorField label="Destination table" tooltip="Created unless it exists">
+            <Input value={table} onChange={(e) => setTable(e.currentTarget.value)} width={20} />
+          </EditorField>
+          <EditorField label="">
+            <Stack direction="row" gap={1}>
+              <Button variant="secondary" disabled={!ready} onClick={() => run(true)}>
+                Preview
+              </Button>
+              <Button disabled={!ready} onClick={() => run(false)}>
+                Materialize and switch panel
+              </Button>
+            </Stack>
+          </EditorField>
+        </EditorFieldGroup>
+      </EditorRow>
+      {error && (
+        <Alert severity="error" title="Materialization failed">
+          {error}
+        </Alert>
+      )}
+      {preview && !error && (
+        <Alert severity="info" title={`${preview.schedule}: ${preview.database}.${preview.table}`}>
+          <pre>{preview.scheduledQuery}</pre>
+        </Alert>
+      )}
+    </>
+  );
+}
@@ -1,10 +1,12 @@
 import { ResourceSelector } from '@grafana/aws-sdk';
 import { QueryEditorProps, SelectableValue } from '@grafana/data';
+import { config } from '@grafana/runtime';
 import { Select, Switch, useStyles2 } from '@grafana/ui';
 import React, { useEffect, useState } from 'react';
 
 import { DataSource } from '../DataSource';
 import { FormatOptions, SelectableFormatOptions, TimestreamOptions, TimestreamQuery } from '../types';
+import { MaterializeEditor } from './MaterializeEditor';
 import { sampleQueries } from './samples';
 import { selectors } from './selectors';
 import SQLEditor from './SQLEditor';
@@ -21,6 +23,8 @@ export function QueryEditor(props: Props) {
   const { defaultDatabase, defaultTable, defaultMeasure } = datasource.options;
 
   const styles = useStyles2(getStyles);
+  // admins can turn the query into a scheduled query writing a pre-aggregated table
+  const canMaterialize = !!datasource.options.materialization && config.bootData.user.orgRole === 'Admin';
 
   // pre-populate query with default data
   useEffect(() => {
@@ -211,6 +215,9 @@ export function QueryEditor(props: Props) {
           />
         </div>
       </EditorRow>
+      {canMaterialize && !!query.rawQuery && (
+        <MaterializeEditor datasource={datasource} query={query} onChange={onChange} onRunQuery={onRunQuery} />
+      )}
     </EditorRows>
   );
 }
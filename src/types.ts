@@ -1,5 +1,5 @@
 import { AwsAuthDataSourceJsonData, AwsAuthDataSourceSecureJsonData } from '@grafana/aws-sdk';
-import { DataSourceSettings, SelectableValue } from '@grafana/data';
+import { AdHocVariableFilter, DataSourceSettings, SelectableValue } from '@grafana/data';
 import { type DataQuery } from '@grafana/schema';
 
 export interface ColumnInfo {
@@ -27,6 +27,9 @@ export enum DataType {
 export enum FormatOptions {
   Table,
   TimeSeries,
+  Logs,
+  StateTimeline,
+  Geo,
 }
 
 export const SelectableFormatOptions: Array<SelectableValue<FormatOptions>> = [
@@ -38,6 +41,18 @@ export const SelectableFormatOptions: Array<SelectableValue<FormatOptions>> = [
     label: 'Time Series',
     value: FormatOptions.TimeSeries,
   },
+  {
+    label: 'Logs',
+    value: FormatOptions.Logs,
+  },
+  {
+    label: 'State timeline',
+    value: FormatOptions.StateTimeline,
+  },
+  {
+    label: 'Geo',
+    value: FormatOptions.Geo,
+  },
 ];
 
 export interface MeasureInfo {
@@ -52,6 +67,71 @@ export interface SchemaInfo {
   measures?: MeasureInfo[];
 }
 
+// response of tables/{db}/{table}/retention
+export interface TableRetention {
+  database: string;
+  table: string;
+  memoryStoreHours: number;
+  magneticStoreDays: number;
+  earliest: string; // approximate time of the oldest available data point
+}
+
+// response of freshness, one entry per measure with data in the last day
+export interface Freshness {
+  database: string;
+  table: string;
+  measure: string;
+  lastTime: string;
+  ageSeconds: number;
+}
+
+export interface TableRef {
+  database: string;
+  table: string;
+}
+
+// response of the compare resource, the same query run against two tables
+export interface TableComparison {
+  baseline: TableResult;
+  candidate: TableResult;
+  series: SeriesDiff[];
+}
+
+export interface TableResult extends TableRef {
+  executedQuery: string;
+  rows: number;
+}
+
+export interface SeriesDiff {
+  name: string;
+  labels?: Record<string, string>;
+  matched: number;
+  missingInBaseline: number;
+  missingInCandidate: number;
+  maxAbsDelta: number;
+}
+
+// queryType returning the latest time and age of each measure of the table
+export const QueryTypeFreshness = 'freshness';
+// queryType returning the latest rows of the table, up to maxRows
+export const QueryTypePreview = 'preview';
+// queryType joining the time series of the queries named by refs into one wide frame
+export const QueryTypeMerge = 'merge';
+// queryType evaluating expression, e.g. $A / $B * 100, over the series of other queries
+export const QueryTypeMath = 'math';
+// queryType returning the rows before or after the row of a logs query
+export const QueryTypeLogContext = 'logContext';
+// queryType running rawQuery in each of the accounts of the datasource and concatenating the results
+export const QueryTypeMultiAccount = 'multiAccount';
+
+export interface LogContext {
+  time: number; // epoch milliseconds
+  // values of the row by column, its dimensions and measure_name select the context
+  values?: Record<string, string>;
+  direction: 'backward' | 'forward';
+  limit?: number;
+}
+
 export interface TimestreamCustomMeta {
   queryId: string;
   nextToken?: string;
@@ -69,11 +149,98 @@ export interface TimestreamCustomMeta {
     CumulativeBytesScanned?: number;
   };
 
+  // set when a Timestream quota rejected the query
+  quotaExceeded?: 'query-tps' | 'concurrent-queries' | 'bytes-scanned' | 'unknown';
+  retryAfterMs?: number;
+
+  // checksum of the returned data, set for alert queries
+  checksum?: string;
+  // set when paging stopped at the deadline of the request
+  truncatedByTimeout?: boolean;
+  // number of sub-range queries merged into the result
+  splitQueries?: number;
+
+  // set when the query was rejected before it was sent to Timestream
+  problem?: QueryProblem;
+
+  // the result columns with their Timestream types
+  columns?: ColumnMeta[];
+
   // when multiple queries exist we keep track of each request
   subs?: TimestreamCustomMeta[];
 }
 
+// a result column as Timestream returned it
+export interface ColumnMeta {
+  name: string;
+  type: string; // e.g. VARCHAR, DOUBLE or ARRAY(BIGINT)
+}
+
+// query the backend is paging through
+export interface RunningQuery {
+  queryId: string;
+  fingerprint: string;
+  query: string; // scrubbed
+  startedAt: string;
+  user?: string; // login, the queries of other users are listed to admins only
+}
+
+// problem+json style description of a rejected query
+export interface QueryProblem {
+  code: string;
+  title: string;
+  detail: string;
+  status: number;
+  spans?: QueryProblemSpan[];
+  docs?: string;
+  // suggests how to resolve problems with a common cause
+  fix?: string;
+  // kind of issue of the detail
+  issueCode?: IssueCode;
+}
+
+export interface QueryProblemSpan {
+  start: number;
+  end: number;
+  snippet?: string;
+  detail?: string;
+  issueCode?: IssueCode;
+}
+
+// stable kinds of the issues of the query checks
+export enum IssueCode {
+  InvalidOptions = 'invalid-options',
+  MissingWhere = 'missing-where',
+  WhereTooComplex = 'where-too-complex',
+  MissingTimePredicate = 'missing-time-predicate',
+  TautologicalTimePredicate = 'tautological-time-predicate',
+  UnboundedTime = 'unbounded-time',
+  TimeWindowTooWide = 'time-window-too-wide',
+  InvalidMeasurePredicate = 'invalid-measure-predicate',
+  NegatedMeasureLike = 'negated-measure-like',
+  InvalidMeasurePattern = 'invalid-measure-pattern',
+  BroadMeasurePattern = 'broad-measure-pattern',
+  MissingTenant = 'missing-tenant',
+  MissingRequiredColumn = 'missing-required-column',
+  RejectedRequiredValue = 'rejected-required-value',
+  NegatedDimensionFilter = 'negated-dimension-filter',
+  OrBranchUnfiltered = 'or-branch-unfiltered',
+  UnknownDimension = 'unknown-dimension',
+}
+
+export interface ColumnMapping {
+  name: string;
+  rename?: string;
+  hide?: boolean;
+  role?: 'time' | 'value' | 'label' | 'latitude' | 'longitude' | 'geohash';
+}
+
+// queries with a version are checked strictly by the backend, see the query-schema resource
+export const QueryModelVersion = 1;
+
 export interface TimestreamQuery extends DataQuery {
+  version?: number;
+
   // When specified, use this rather than the default for macros
   database?: string;
   table?: string;
@@ -87,14 +254,325 @@ export interface TimestreamQuery extends DataQuery {
 
   format?: FormatOptions;
 
+  // Expected number of series, scales $__limit
+  seriesHint?: number;
+  // Append $__limit when the query has no LIMIT
+  autoLimit?: boolean;
+
+  // Run only the statement enclosing this range of rawQuery
+  selection?: { start: number; end: number };
+
+  // Rename, hide, reorder and convert result columns server side
+  columns?: ColumnMapping[];
+
+  // Send low cardinality string columns of large tables as enums
+  dictionaryEncode?: boolean;
+
+  // explicit handling of NULL values and empty results, applied once all pages are read
+  nulls?: NullHandling;
+
+  // keep the largest series of each value column, over all pages
+  seriesLimit?: SeriesLimit;
+
+  // parts of builder queries, rawQuery holds their SQL; set in the query JSON, not by the editor
+  builder?: BuilderQuery;
+  // sorting and filters run in the SQL of builder queries, set in the query JSON
+  tableHints?: TableHints;
+
+  // named validator profile of the datasource settings checking the query, may be a variable
+  validatorProfile?: string;
+
+  // also return the series shifted back by this duration, e.g. 1w
+  compareOffset?: string;
+
+  // run long ranges as concurrent sub-range queries of this duration, e.g. 7d; queries whose
+  // results over sub-ranges differ, like ungrouped aggregates or LIMIT, are refused
+  splitInterval?: string;
+
+  // fill missing values of wide time series, previous reads all pages at once
+  fillMode?: FillMode;
+  fillValue?: number;
+
+  // stop reading results after this many rows
+  maxRows?: number;
+
+  // serve cached responses only while younger than this, bounded by resultCacheSeconds
+  maxStalenessSeconds?: number;
+
+  // request timeout, bounded by the datasource maximum
+  timeoutSeconds?: number;
+
+  // map dimension values with the lookups of the datasource
+  enrich?: Enrichment[];
+
+  // ad-hoc filters of the dashboard, added to queries of the table
+  adhocFilters?: AdHocVariableFilter[];
+
+  // refIds of the queries joined by a merge query
+  refs?: string[];
+  // expression of a math query
+  expression?: string;
+
+  // row of a log context query
+  logContext?: LogContext;
+
+  // names of the accounts a multi-account query runs in, all when empty
+  accounts?: string[];
+
   // Not a real parameter...
   // nextToken?: string;
 }
 
+export type FillMode = 'null' | 'previous' | 'value';
+
+// inherited by new queries, and by the backend for queries that don't set the option
+export interface QueryDefaults {
+  format?: FormatOptions;
+  fillMode?: FillMode;
+  fillValue?: number;
+  maxRows?: number;
+  maxStalenessSeconds?: number;
+}
+
+export interface SeriesLimit {
+  limit: number;
+  other?: 'sum' | 'avg'; // combines the remaining series, which are dropped without it
+}
+
+export interface BuilderFilter {
+  column: string;
+  operator: '=' | '!=' | '<>' | '<' | '<=' | '>' | '>=';
+  value: string;
+}
+
+export interface BuilderOrder {
+  column: string;
+  desc?: boolean;
+}
+
+export interface BuilderQuery {
+  database: string;
+  table: string;
+  measure: string;
+  valueType?: string;
+  attribute?: string;
+  aggregation?: string;
+  bin?: boolean;
+  groupBy?: string[];
+  filters?: BuilderFilter[]; // a filter of the measure column compares its values
+  orderBy?: BuilderOrder[];
+  limit?: number;
+}
+
+export interface TableHints {
+  sort?: BuilderOrder[];
+  filters?: BuilderFilter[];
+}
+
+export interface NullHandling {
+  dropEmptySeries?: boolean;
+  dropZeroSeries?: boolean; // also drops series whose values are all NULL or zero
+  replaceWith?: number; // a whole number for integer columns
+  errorOnNoData?: boolean;
+}
+
+export interface ValidatorProfile {
+  validator?: Record<string, unknown>;
+  // Grafana roles allowed to select the profile, all when empty
+  roles?: string[];
+}
+
 export interface TimestreamOptions extends AwsAuthDataSourceJsonData {
   defaultDatabase?: string;
   defaultTable?: string;
   defaultMeasure?: string;
+
+  // resource responses from this size (bytes) are gzip encoded, negative disables
+  compressionThreshold?: number;
+
+  // add the query time range to SELECTs rejected for their time filter instead of rejecting them
+  repairTimeFilter?: boolean;
+
+  // named validator configurations queries select with validatorProfile
+  validatorProfiles?: Record<string, ValidatorProfile>;
+  // profile of Explore queries not selecting one
+  exploreValidatorProfile?: string;
+
+  // masking of literals in logged and audited queries
+  logScrubbing?: ScrubOptions;
+
+  // export query audit records to S3
+  audit?: AuditSettings;
+
+  // defaults for new queries
+  queryDefaults?: QueryDefaults;
+
+  // notice on queries whose median latency exceeds this
+  slowQuerySeconds?: number;
+
+  // replica serving read queries while the primary is unavailable
+  fallback?: FallbackSettings;
+
+  // accounts multi-account queries run in
+  accounts?: AccountTarget[];
+
+  // scheduled queries writing pre-aggregated tables of dashboard queries
+  materialization?: MaterializationSettings;
+
+  // time ranges ending now are shifted back by this delay
+  ingestionDelaySeconds?: number;
+
+  // request timeout of queries without their own, and the most they may set
+  queryTimeoutSeconds?: number;
+  maxQueryTimeoutSeconds?: number;
+
+  // key/value tables queries can be enriched with
+  lookups?: LookupSource[];
+
+  // how long query responses are cached, enables dashboard prefetching
+  resultCacheSeconds?: number;
+
+  // dashboard queries per hour, a multi-account query spends one per account; refreshes over budget are served from the result cache
+  queryBudgetPerHour?: number;
+
+  // panel queries refreshed in the background for wallboards, the refreshes spend the query budget
+  keepWarm?: KeepWarmQuery[];
+
+  // tables ("db.table" or "table") whose measures are sampled from the last hour instead of SHOW MEASURES
+  sampledMeasureTables?: string[];
+
+  // tables ("db.table" or "table") the ad-hoc filters may read keys and values from besides the default table
+  adhocTables?: string[];
+
+  // query rewrite stages to skip, e.g. 'adhoc-filters'
+  disabledRewrites?: string[];
+
+  // numbers of the states of varchar measures
+  stateMappings?: StateMapping[];
+}
+
+export interface StateMapping {
+  // measure_name or multi-measure column, may be a glob pattern like '*_state'
+  measure: string;
+  states: Record<string, number>;
+}
+
+export interface KeepWarmQuery {
+  query: TimestreamQuery;
+  // relative range of the panel, e.g. 6h
+  range: string;
+  // must match the panel to hit the cache
+  intervalMs?: number;
+  maxDataPoints?: number;
+}
+
+export interface LookupSource {
+  name: string;
+  // Timestream query returning keys and values in the first two columns
+  query?: string;
+  // or a CSV object in S3 with a header row
+  bucket?: string;
+  key?: string;
+  format?: 'csv';
+  keyColumn?: string;
+  valueColumn?: string;
+  refreshSeconds?: number;
+}
+
+// response of lookups and lookups/refresh
+export interface LookupStatus {
+  name: string;
+  source: 'timestream' | 's3';
+  refreshSeconds: number;
+  entries: number;
+  fetchedAt?: string;
+  error?: string;
+}
+
+export interface Enrichment {
+  lookup: string;
+  column: string;
+  // added column or label, defaults to the lookup name
+  as?: string;
+}
+
+export interface ScrubOptions {
+  disabled?: boolean;
+  keepNumbers?: boolean;
+  keepColumns?: string[];
+}
+
+export interface AuditSettings {
+  bucket: string;
+  prefix?: string;
+  batchSize?: number;
+  flushIntervalSeconds?: number;
+}
+
+export interface FallbackSettings {
+  region?: string;
+  assumeRoleArn?: string;
+  externalId?: string;
+  failureThreshold?: number;
+  cooldownSeconds?: number;
+}
+
+export interface AccountTarget {
+  // value of the account column of its rows
+  name: string;
+  assumeRoleArn?: string;
+  externalId?: string;
+  region?: string;
+  // replaces $__database in the queries run in the account
+  database?: string;
+}
+
+export interface MaterializationSettings {
+  // role the scheduled queries run as
+  executionRoleArn: string;
+  // SNS topic notified of the runs
+  topicArn: string;
+  // S3 bucket of the reports of failed runs
+  errorReportBucket: string;
+  // database of the tables of requests without one
+  database?: string;
+}
+
+// body of the materializations/preview and materializations/create resources
+export interface MaterializationRequest {
+  // measure name of the written records without measureName
+  name: string;
+  query: TimestreamQuery;
+  // how often the scheduled query runs, e.g. 1h
+  interval: string;
+  // time each run reads and rewrites, and the value of $__interval; both default to the interval
+  lookback?: string;
+  resolution?: string;
+  database?: string;
+  // created with the retention below unless it exists
+  table: string;
+  measureName?: string;
+  memoryStoreHours?: number;
+  magneticStoreDays?: number;
+}
+
+export interface Materialization {
+  name: string;
+  arn?: string;
+  state?: 'ENABLED' | 'DISABLED';
+  database: string;
+  table: string;
+  // returned by preview and create
+  scheduledQuery?: string;
+  schedule?: string;
+  // reads the panel results from the table
+  panelQuery?: string;
+  dimensions?: string[];
+  measures?: string[];
+  tableCreated?: boolean;
+  lastRunStatus?: string;
+  previousRun?: string;
+  nextRun?: string;
 }
 
 export interface TimestreamSecureJsonData extends AwsAuthDataSourceSecureJsonData {